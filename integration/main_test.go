@@ -0,0 +1,323 @@
+//go:build integration
+
+// Package integration runs the checkers against real databases started with
+// testcontainers. It needs Docker and is excluded from the default build:
+//
+//	go test -tags integration ./integration/...
+//
+// Tests are skipped when no Docker daemon is reachable.
+package integration
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	tcmongodb "github.com/testcontainers/testcontainers-go/modules/mongodb"
+	tcmysql "github.com/testcontainers/testcontainers-go/modules/mysql"
+
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/mongocheck"
+	"github.com/tapclap/db-connect-checker/pkg/mysqlcheck"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+const (
+	mysqlImage = "mysql:8.0.36"
+	mongoImage = "mongo:7.0"
+	user       = "app"
+	password   = "s3cret"
+	database   = "app"
+)
+
+// startMySQL starts a MySQL server with an app database and returns a target
+// for it. root has the same password as app.
+func startMySQL(t *testing.T) types.Target {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	ctr, err := tcmysql.Run(ctx, mysqlImage,
+		tcmysql.WithDatabase(database),
+		tcmysql.WithUsername(user),
+		tcmysql.WithPassword(password),
+	)
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatalf("start mysql: %v", err)
+	}
+
+	host, err := ctr.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := ctr.MappedPort(ctx, "3306/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Target{Type: "mysql", Host: host, Port: port.Port(), Database: database, User: user, Pass: password}
+}
+
+// startMongo starts a MongoDB server with authentication enabled and returns
+// a target for its app database.
+func startMongo(t *testing.T) types.Target {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	ctr, err := tcmongodb.Run(ctx, mongoImage,
+		tcmongodb.WithUsername(user),
+		tcmongodb.WithPassword(password),
+	)
+	testcontainers.CleanupContainer(t, ctr)
+	if err != nil {
+		t.Fatalf("start mongodb: %v", err)
+	}
+
+	host, err := ctr.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := ctr.MappedPort(ctx, "27017/tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Target{
+		Type:     "mongodb",
+		Host:     host,
+		Port:     port.Port(),
+		Database: database,
+		User:     user,
+		Pass:     password,
+		Options:  map[string]string{"authSource": "admin"},
+	}
+}
+
+func TestMySQL(t *testing.T) {
+	target := startMySQL(t)
+
+	wrongPassword := target
+	wrongPassword.Pass = "wrong"
+
+	unknownDatabase := target
+	unknownDatabase.User = "root"
+	unknownDatabase.Database = "missing"
+
+	// MySQL 8 serves TLS with a self-signed certificate, so it only passes
+	// without verification.
+	tlsSkipVerify := target
+	tlsSkipVerify.TLS = true
+	tlsSkipVerify.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+	tlsVerify := target
+	tlsVerify.TLS = true
+
+	extraUsers := target
+	extraUsers.Credentials = []types.Credential{{User: "root", Pass: password}}
+
+	wrongExtraUser := target
+	wrongExtraUser.Credentials = []types.Credential{{User: "root", Pass: password}, {User: "migrator", Pass: password}}
+
+	tests := []struct {
+		name          string
+		target        types.Target
+		wantErr       error
+		wantRetryable bool
+	}{
+		{name: "available", target: target},
+		{name: "TLS without verification", target: tlsSkipVerify},
+		{name: "TLS with untrusted certificate", target: tlsVerify, wantErr: mysqlcheck.ErrTLS},
+		{name: "wrong password", target: wrongPassword, wantErr: mysqlcheck.ErrAuthFailed},
+		{name: "unknown database", target: unknownDatabase, wantErr: mysqlcheck.ErrUnknownDatabase},
+		{name: "extra users", target: extraUsers},
+		{name: "extra user without account", target: wrongExtraUser, wantErr: mysqlcheck.ErrAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := mysqlcheck.Check(context.Background(), tt.target, mysqlcheck.WithTimeout(10*time.Second))
+			if tt.wantErr == nil {
+				if !result.Success {
+					t.Fatalf("Check() failed (%s): %v", result.Reason, result.Err)
+				}
+				if !strings.HasPrefix(result.ServerVersion, "8.") {
+					t.Errorf("ServerVersion = %q, want 8.x", result.ServerVersion)
+				}
+				if len(result.Phases) != 2 {
+					t.Errorf("Phases = %v, want connect and query", result.Phases)
+				}
+				if len(result.Credentials) != len(tt.target.Credentials)+min(len(tt.target.Credentials), 1) {
+					t.Errorf("Credentials = %+v, want %s and every extra user", result.Credentials, tt.target.User)
+				}
+				return
+			}
+			if !errors.Is(result.Err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", result.Err, tt.wantErr)
+			}
+			if mysqlcheck.Retryable(result.Err) != tt.wantRetryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !tt.wantRetryable, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestMongo(t *testing.T) {
+	target := startMongo(t)
+
+	wrongPassword := target
+	wrongPassword.Pass = "wrong"
+
+	tests := []struct {
+		name    string
+		target  types.Target
+		wantErr error
+	}{
+		{name: "available", target: target},
+		{name: "wrong password", target: wrongPassword, wantErr: mongocheck.ErrAuthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := mongocheck.Check(context.Background(), tt.target)
+			if tt.wantErr == nil {
+				if !result.Success {
+					t.Fatalf("Check() failed (%s): %v", result.Reason, result.Err)
+				}
+				if !strings.HasPrefix(result.ServerVersion, "7.") {
+					t.Errorf("ServerVersion = %q, want 7.x", result.ServerVersion)
+				}
+				return
+			}
+			if !errors.Is(result.Err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", result.Err, tt.wantErr)
+			}
+			if mongocheck.Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true, want false", result.Err)
+			}
+		})
+	}
+}
+
+func TestRunnerRetriesUntilAvailable(t *testing.T) {
+	mysqlTarget := startMySQL(t)
+	mongoTarget := startMongo(t)
+
+	// The databases are reached through proxies that refuse connections
+	// until opened, like a server that is still starting.
+	var proxies []*gatedProxy
+	var targets []types.Target
+	for _, target := range []types.Target{mysqlTarget, mongoTarget} {
+		proxy := newGatedProxy(t, target.Address())
+		proxies = append(proxies, proxy)
+		host, port, _ := net.SplitHostPort(proxy.Addr())
+		target.Host, target.Port = host, port
+		targets = append(targets, target)
+	}
+
+	var failures int32
+	runner := checker.Runner{
+		Targets: targets,
+		Budget:  2 * time.Minute,
+		Backoff: retry.Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2},
+		Sinks: []checker.Sink{checker.SinkFunc(func(ctx context.Context, target types.Target, result types.Result) {
+			if !result.Success {
+				atomic.AddInt32(&failures, 1)
+			}
+		})},
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- runner.Run(context.Background()) }()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for atomic.LoadInt32(&failures) < int32(2*len(targets)) {
+		if time.Now().After(deadline) {
+			t.Fatal("targets were not retried")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for _, proxy := range proxies {
+		proxy.Open()
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+// gatedProxy forwards TCP connections to a backend once opened and closes
+// them immediately before that.
+type gatedProxy struct {
+	listener net.Listener
+	backend  string
+	open     atomic.Bool
+	wg       sync.WaitGroup
+}
+
+func newGatedProxy(t *testing.T, backend string) *gatedProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &gatedProxy{listener: listener, backend: backend}
+	p.wg.Add(1)
+	go p.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		p.wg.Wait()
+	})
+	return p
+}
+
+func (p *gatedProxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *gatedProxy) Open() {
+	p.open.Store(true)
+}
+
+func (p *gatedProxy) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		if !p.open.Load() {
+			conn.Close()
+			continue
+		}
+		go p.forward(conn)
+	}
+}
+
+func (p *gatedProxy) forward(conn net.Conn) {
+	defer conn.Close()
+	backend, err := net.Dial("tcp", p.backend)
+	if err != nil {
+		return
+	}
+	defer backend.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(backend, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, backend)
+		done <- struct{}{}
+	}()
+	<-done
+}
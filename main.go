@@ -1,119 +1,1267 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"context"
-	"net/url"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/config"
+	"github.com/tapclap/db-connect-checker/pkg/controller"
+	"github.com/tapclap/db-connect-checker/pkg/influx"
+	"github.com/tapclap/db-connect-checker/pkg/kafka"
+	"github.com/tapclap/db-connect-checker/pkg/kube"
+	"github.com/tapclap/db-connect-checker/pkg/labels"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/message"
 	"github.com/tapclap/db-connect-checker/pkg/metrics"
+	"github.com/tapclap/db-connect-checker/pkg/mongocheck"
+	"github.com/tapclap/db-connect-checker/pkg/mqtt"
 	"github.com/tapclap/db-connect-checker/pkg/mysqlcheck"
+	"github.com/tapclap/db-connect-checker/pkg/notify"
+	"github.com/tapclap/db-connect-checker/pkg/progress"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/readiness"
+	"github.com/tapclap/db-connect-checker/pkg/remotewrite"
+	"github.com/tapclap/db-connect-checker/pkg/report"
+	"github.com/tapclap/db-connect-checker/pkg/resolve"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/syslog"
+	"github.com/tapclap/db-connect-checker/pkg/tracing"
+	"github.com/tapclap/db-connect-checker/pkg/types"
 	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+	"github.com/tapclap/db-connect-checker/pkg/wait"
+	"github.com/tapclap/db-connect-checker/pkg/winsvc"
 
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/term"
 )
 
+// exitNotRetryable is returned when a check fails with an error that retries
+// cannot fix (bad credentials, unknown database, malformed settings), so that
+// scripts can tell a configuration problem from an unreachable database.
+const exitNotRetryable = 3
+
+// sinks receive the result of every check in every mode.
+var sinks []checker.Sink
+
+// ownerLabels (OWNER_LABELS) are added to every metric and Kubernetes Event.
+var ownerLabels map[string]string
+
 func main() {
-	dbType := util.GetEnvString("DB_TYPE", "mysql")
-	exporterEnabled := util.GetEnvBool("EXPORTER", false)
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	healthcheck := flag.Bool("healthcheck", false, "query the running exporter's cached status once and exit (for Docker HEALTHCHECK)")
+	targetsFile := flag.String("targets", "", "read a JSON or YAML list of targets from this file, - for stdin (overrides TARGETS_FILE)")
+	configFile := flag.String("config", "", "read targets of any type with their DSN, TLS, timeout and tries from this YAML or JSON file (overrides CONFIG_FILE)")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(version.String())
+		return
+	}
 
+	switch flag.Arg(0) {
+	case "validate":
+		os.Exit(runValidate(*configFile))
+	case "config":
+		if flag.Arg(1) != "init" {
+			fmt.Fprintf(os.Stderr, "Usage: %s config init\n", os.Args[0])
+			os.Exit(1)
+		}
+		util.WriteSampleEnv(os.Stdout)
+		return
+	case "service":
+		os.Exit(runService(flag.Arg(1)))
+	case "check":
+		// "check [file|-]" is the one-shot mode with targets from a file,
+		// e.g. generate-targets | db-connect-checker check -
+		if flag.Arg(1) != "" {
+			*targetsFile = flag.Arg(1)
+		}
+	}
+
+	settings := util.LoadSettings()
+	if err := log.Configure(settings.LogFormat, settings.LogLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *targetsFile != "" {
+		settings.TargetsFile = *targetsFile
+	}
+	if *configFile != "" {
+		settings.ConfigFile = *configFile
+	}
+
+	if *healthcheck {
+		timeout := time.Duration(settings.HealthcheckTimeout) * time.Second
+		os.Exit(runHealthcheck(settings.ExporterPort, timeout))
+	}
+
+	if winsvc.IsService() {
+		os.Exit(winsvc.Run(func(ctx context.Context) int {
+			return run(ctx, settings)
+		}))
+	}
+	os.Exit(run(context.Background(), settings))
+}
+
+// runService registers or removes the Windows service.
+func runService(command string) int {
+	var err error
+	switch command {
+	case "install":
+		err = winsvc.Install()
+	case "uninstall":
+		err = winsvc.Uninstall()
+	default:
+		fmt.Fprintf(os.Stderr, "Usage: %s service install|uninstall\n", os.Args[0])
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Service %s %sed\n", winsvc.Name, command)
+	return 0
+}
+
+// run checks the databases in the mode selected by settings and returns the
+// exit code. Long-running modes stop when ctx is cancelled, on SIGINT or on
+// SIGTERM.
+func run(ctx context.Context, settings types.Settings) int {
+	ratelimit.Configure(settings.ConnectRate, settings.ConnectBurst)
+
+	var err error
+	ownerLabels, err = labels.Parse(settings.OwnerLabels)
+	if err != nil {
+		log.Error("Invalid OWNER_LABELS", "error", err)
+		return 1
+	}
+
+	if settings.LogTemplate != "" {
+		logTemplate, err := message.Parse("LOG_TEMPLATE", settings.LogTemplate)
+		if err != nil {
+			log.Error("Invalid LOG_TEMPLATE", "error", err)
+			return 1
+		}
+		logTemplate.SetLabels(ownerLabels)
+		mysqlcheck.AttemptLog = logTemplate
+	}
+
+	if settings.MaxFlowControlPaused > 1 {
+		log.Error(fmt.Sprintf("\"MAX_FLOW_CONTROL_PAUSED\" is a fraction of time and must not be greater than 1, got %v", settings.MaxFlowControlPaused))
+		return 1
+	}
+	util.MaxTargetIndex = max(settings.MaxTargetIndex, 0)
+	for _, warning := range util.IndexWarnings() {
+		log.Warn(warning)
+	}
 	mysqlConfigs := util.GetAllMysqlConfigsFromEnvs()
+	dirConfigs, err := util.GetMysqlConfigsFromDir(settings.TargetsDir)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+	var fileTargets util.FileTargets
+	if settings.TargetsFile != "" {
+		fileTargets, err = util.GetTargetsFromFile(settings.TargetsFile, os.Stdin)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+	}
+	var configTargets config.Config
+	if settings.ConfigFile != "" {
+		configTargets, err = config.Load(settings.ConfigFile)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+	}
+	mysqlConfigs, conflicts := reconcileMysqlConfigs(settings, mysqlConfigs, dirConfigs, fileTargets.Mysql, configTargets.Mysql)
+
+	routes, err := notify.ParseRoutes(settings.NotifyRoutes)
+	if err != nil {
+		log.Error(fmt.Sprintf("NOTIFY_ROUTES: %v", err))
+		return 1
+	}
+	router := notify.NewRouter(routes)
+	escalation, err := notify.ParseEscalation(settings.NotifyEscalation)
+	if err != nil {
+		log.Error(fmt.Sprintf("NOTIFY_ESCALATION: %v", err))
+		return 1
+	}
+	// Outages are only timed across the checks of the exporter; the other
+	// modes exit long before a delay would pass.
+	if settings.Exporter {
+		router.Escalate(escalation)
+	} else if len(escalation) > 0 {
+		log.Warn("NOTIFY_ESCALATION only applies in exporter mode")
+	}
+	if settings.AuditLog != "" {
+		auditLog, err := audit.Open(settings.AuditLog, int64(settings.AuditLogMaxSize)<<20, settings.AuditLogMaxBackups)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		defer auditLog.Close()
+		router.Add("audit", auditLog)
+	}
+	if settings.SyslogAddr != "" {
+		syslogWriter, err := syslog.Dial(settings.SyslogAddr, settings.SyslogFacility)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		defer syslogWriter.Close()
+		router.Add("syslog", syslogWriter)
+	}
+	if settings.MQTTBroker != "" {
+		if settings.MQTTQoS < 0 || settings.MQTTQoS > 2 {
+			log.Error(fmt.Sprintf("\"MQTT_QOS\" must be 0, 1 or 2, got %d", settings.MQTTQoS))
+			return 1
+		}
+		mqttClient, err := mqtt.Dial(settings.MQTTBroker, settings.MQTTTopic, settings.MQTTClientID)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		defer mqttClient.Close()
+		mqttClient.QoS = byte(settings.MQTTQoS)
+		mqttClient.Retain = settings.MQTTRetain
+		mqttClient.Labels = ownerLabels
+		router.Add("mqtt", mqttClient)
+	}
+	if settings.KafkaBrokers != "" {
+		producer, err := kafka.New(strings.Split(settings.KafkaBrokers, ","), settings.KafkaTopic, kafka.Options{
+			TLS:       settings.KafkaTLS,
+			Mechanism: settings.KafkaSASLMechanism,
+			User:      settings.KafkaSASLUser,
+			Password:  settings.KafkaSASLPassword,
+		})
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		defer producer.Close()
+		producer.EveryCheck = settings.KafkaEvents == "checks"
+		producer.Labels = ownerLabels
+		router.Add("kafka", producer)
+	}
+	if settings.WindowsEventLog {
+		eventLog, err := winsvc.OpenEventLog()
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		defer eventLog.Close()
+		router.Add("eventlog", eventLog)
+	}
+	if settings.InfluxURL != "" {
+		influxWriter := influx.New(settings.InfluxURL, settings.InfluxMeasurement, 10*time.Second)
+		influxWriter.Token = settings.InfluxToken
+		influxWriter.Tags = ownerLabels
+		// Exporter checks run every CHECK_INTERVAL, so every cycle is one
+		// write; whatever is left is written on exit.
+		go influxWriter.Run(ctx, max(time.Duration(settings.CheckInterval)*time.Second, time.Second))
+		defer func() {
+			if err := influxWriter.Flush(context.Background()); err != nil {
+				log.Error(err.Error())
+			}
+		}()
+		router.Add("influx", influxWriter)
+	}
+	if settings.SlackWebhookURL != "" || settings.PagerDutyRoutingKey != "" {
+		var notifyTemplate *message.Template
+		if settings.NotifyTemplate != "" {
+			notifyTemplate, err = message.Parse("NOTIFY_TEMPLATE", settings.NotifyTemplate)
+			if err != nil {
+				log.Error(fmt.Sprintf("NOTIFY_TEMPLATE: %v", err))
+				return 1
+			}
+		}
+		if settings.SlackWebhookURL != "" {
+			slack := notify.NewSlack(settings.SlackWebhookURL)
+			slack.Template, slack.Labels = notifyTemplate, ownerLabels
+			router.Add("slack", slack)
+		}
+		if settings.PagerDutyRoutingKey != "" {
+			pagerDuty := notify.NewPagerDuty(settings.PagerDutyRoutingKey)
+			pagerDuty.Template, pagerDuty.Labels = notifyTemplate, ownerLabels
+			router.Add("pagerduty", pagerDuty)
+		}
+	}
+	if err := router.Validate(); err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+	sinks = append(sinks, router)
+	mysqlcheck.OnResult = func(ctx context.Context, target types.Target, result types.Result) {
+		for _, sink := range sinks {
+			sink.Observe(ctx, target, result)
+		}
+	}
 
 	// mongodb
-	mongoUri := os.Getenv("MONGODB_URI")
-	if mongoUri == "" && dbType == "mongodb" {
-		fmt.Fprintf(os.Stderr, "\"MONGODB_URI\" not set, but \"DB_TYPE\" is set \"mongodb\"")
-		os.Exit(1)
+	mongoUris := append(util.GetAllMongoURIsFromEnvs(), fileTargets.MongoDB...)
+	// Every other type is read from its own variables, e.g. MOCK_*, by the
+	// reader registered with the checker.
+	envConfigs := checker.FromEnv(settings)
+
+	// Configs of types that are not selected are dropped here, so the modes
+	// below check whatever is left.
+	configTypes := configTargets.Types()
+	configured := map[string]bool{
+		"mysql":   len(mysqlConfigs) > 0,
+		"mongodb": len(mongoUris) > 0 || configTypes["mongodb"],
+	}
+	for name, configs := range envConfigs {
+		configured[name] = len(configs) > 0 || configTypes[name]
+	}
+	dbTypes, err := util.DBTypes(settings, configured)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+	if !dbTypes["mysql"] {
+		mysqlConfigs = nil
+	}
+	if !dbTypes["mongodb"] {
+		mongoUris = nil
+	}
+	otherTargets := []types.Target{}
+	for _, name := range checker.Types() {
+		if !dbTypes[name] {
+			continue
+		}
+		for _, cfg := range envConfigs[name] {
+			otherTargets = append(otherTargets, cfg.Target())
+		}
+	}
+	// The config file has targets of every type, MongoDB included.
+	for _, target := range configTargets.Targets {
+		if dbTypes[target.Type] {
+			otherTargets = append(otherTargets, target)
+		}
 	}
 
-	tries := util.GetEnvNumber("TRIES", 10)
+	waitForAny := settings.WaitForAny
+	if settings.WaitFor != "available" && settings.WaitFor != "unavailable" {
+		log.Error(fmt.Sprintf("\"WAIT_FOR\" must be \"available\" or \"unavailable\", got %q", settings.WaitFor))
+		return 1
+	}
+	waitUnavailable := settings.WaitFor == "unavailable"
+	if waitUnavailable && waitForAny {
+		log.Error("\"WAIT_FOR_ANY\" cannot be combined with \"WAIT_FOR=unavailable\"")
+		return 1
+	}
 
-	if exporterEnabled {
-		checkIntervalSeconds := util.GetEnvNumber("CHECK_INTERVAL", 30)
-		checkInterval := time.Duration(checkIntervalSeconds) * time.Second
+	if settings.Exporter {
+		checkInterval := time.Duration(settings.CheckInterval) * time.Second
 
-		mysqlExporter := metrics.NewMultiMySQLExporter(mysqlConfigs, checkInterval)
+		if settings.Tracing {
+			shutdownTracing, err := tracing.Setup(context.Background())
+			if err != nil {
+				log.Error("Error setting up tracing", "error", err)
+				return 1
+			}
+			defer shutdownTracing(context.Background())
+		}
+
+		exportedTargets := []types.Target{}
+		for _, target := range otherTargets {
+			if checker.Exported(target.Type) {
+				exportedTargets = append(exportedTargets, target)
+			}
+		}
+		exporterTargets, _ := checkTargets(mysqlConfigs, nil, exportedTargets)
+		mysqlExporter := metrics.NewExporter(exporterTargets, checkInterval)
+		for _, sink := range sinks {
+			mysqlExporter.AddSink(sink)
+		}
+		if err := mysqlExporter.SetSchedule(settings.CheckSchedule); err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		mysqlExporter.SetConflicts(conflicts)
+		mysqlExporter.SetMaxClockSkew(settings.MaxClockSkew)
+		if dialer := dnsDialer(settings); dialer != nil {
+			mysqlExporter.SetDialer(dialer)
+		}
+		mysqlExporter.SetTablespaceMetrics(settings.MinFreeSpace > 0)
+		mysqlExporter.SetLongQueryThreshold(settings.LongQueryThreshold)
+		mysqlExporter.SetThreadsMetrics(settings.MaxThreadsConnected > 0 || settings.MaxThreadsRunning > 0)
+		mysqlExporter.SetFlowControlMetrics(settings.MaxFlowControlPaused > 0)
+		mysqlExporter.SetRetries(settings.CheckAttempts, settings.CheckRetryDelay)
+		mysqlExporter.SetAttemptTimeout(settings.AttemptTimeout)
+		mysqlExporter.SetPhaseTimeouts(settings.ConnectTimeout, settings.QueryTimeout)
+		mysqlExporter.SetConfirmStateChanges(settings.ConfirmStateChanges)
+		mysqlExporter.SetCircuitBreaker(settings.CircuitBreakerFailures, settings.CircuitBreakerCooldown, settings.CircuitBreakerMaxCooldown)
+		mysqlExporter.SetCredentialRefresh(settings.CredentialsRefresh)
+		if settings.CheckIntervalMin > 0 || settings.CheckIntervalMax > 0 {
+			minInterval, maxInterval := settings.CheckIntervalMin, settings.CheckIntervalMax
+			if minInterval <= 0 {
+				minInterval = checkInterval
+			}
+			if maxInterval <= 0 {
+				maxInterval = checkInterval
+			}
+			if minInterval > maxInterval {
+				log.Error(fmt.Sprintf("\"CHECK_INTERVAL_MIN\" (%v) must not be greater than \"CHECK_INTERVAL_MAX\" (%v)", minInterval, maxInterval))
+				return 1
+			}
+			mysqlExporter.SetAdaptiveInterval(minInterval, maxInterval)
+		}
+
+		faultWindows, err := metrics.ParseFaultWindows(settings.SimulateFailure)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		if settings.SimulateEndpoint && settings.TargetsAPIToken == "" {
+			log.Error("\"SIMULATE_ENDPOINT\" requires \"TARGETS_API_TOKEN\" to authorize requests to /simulate")
+			return 1
+		}
+		var faults *metrics.FaultInjector
+		if len(faultWindows) > 0 || settings.SimulateEndpoint {
+			faults = metrics.NewFaultInjector(faultWindows)
+			mysqlExporter.SetFaultInjector(faults)
+		}
+
+		events, err := eventPublisher(settings)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		if events != nil {
+			mysqlExporter.OnResult(func(status metrics.TargetStatus) {
+				database := fmt.Sprintf("mysql %s:%s/%s", status.Host, status.Port, status.Database)
+				if err := events.Publish(context.Background(), database, status.Reason); err != nil {
+					log.Error(err.Error())
+				}
+			})
+		}
 
 		mysqlExporter.Start()
 		defer mysqlExporter.Stop()
 
-		prometheus.MustRegister(mysqlExporter)
+		mongoTargets, err := checkTargets(nil, mongoUris, nil)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		for _, target := range otherTargets {
+			if target.Type == "mongodb" {
+				mongoTargets = append(mongoTargets, target)
+			}
+		}
+		mongoExporter := metrics.NewMultiMongoExporter(mongoTargets, checkInterval)
+		for _, sink := range sinks {
+			mongoExporter.AddSink(sink)
+		}
+		if dialer := dnsDialer(settings); dialer != nil {
+			mongoExporter.SetDialer(dialer)
+		}
+		if err := mongoExporter.SetSchedule(settings.CheckSchedule); err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		mongoExporter.SetRetries(settings.CheckAttempts, settings.CheckRetryDelay)
+		mongoExporter.SetAttemptTimeout(settings.AttemptTimeout)
+		mongoExporter.SetPhaseTimeouts(settings.ConnectTimeout, settings.QueryTimeout)
+		mongoExporter.SetConfirmStateChanges(settings.ConfirmStateChanges)
+		if events != nil {
+			mongoExporter.OnResult(func(status metrics.TargetStatus) {
+				database := fmt.Sprintf("mongodb %s/%s", status.Host, status.Database)
+				if err := events.Publish(context.Background(), database, status.Reason); err != nil {
+					log.Error(err.Error())
+				}
+			})
+		}
+		mongoExporter.Start()
+		defer mongoExporter.Stop()
+
+		registerer := prometheus.WrapRegistererWith(ownerLabels, prometheus.DefaultRegisterer)
+		// The pushed metrics leave out the Go runtime and HTTP handler
+		// metrics of the default registry.
+		pushRegistry := prometheus.NewRegistry()
+		pushRegisterer := prometheus.WrapRegistererWith(ownerLabels, pushRegistry)
+		for _, collector := range []prometheus.Collector{mysqlExporter, mongoExporter, metrics.NewBuildInfoCollector()} {
+			if err := registerer.Register(collector); err != nil {
+				log.Error("Invalid OWNER_LABELS", "error", err)
+				return 1
+			}
+			pushRegisterer.MustRegister(collector)
+		}
+
+		mux := http.NewServeMux()
+		// OpenMetrics is negotiated by Prometheus and is required to expose exemplars.
+		mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+		mux.Handle("/status", metrics.StatusHandler(mysqlExporter, mongoExporter))
+		mux.Handle("/probe", metrics.ProbeHandler(settings.ProbeCacheTTL, mysqlExporter, mongoExporter))
+		mux.Handle("/healthz", metrics.HealthzHandler())
+		mux.Handle("/readyz", metrics.ReadyzHandler(mysqlExporter, mongoExporter))
+		if settings.SimulateEndpoint {
+			mux.Handle("/simulate", metrics.SimulateHandler(faults, settings.TargetsAPIToken))
+		}
+		if settings.TargetsAPIToken != "" {
+			// Changes are saved to the config file if one is in use, else
+			// to the targets directory if it exists.
+			var store metrics.TargetStore
+			if settings.ConfigFile != "" {
+				store = config.NewStore(settings.ConfigFile)
+			} else if info, err := os.Stat(settings.TargetsDir); err == nil && info.IsDir() {
+				store = util.TargetsDir(settings.TargetsDir)
+			}
+			targetsHandler := metrics.TargetsHandler(mysqlExporter, settings.TargetsAPIToken, store)
+			mux.Handle("/targets", targetsHandler)
+			mux.Handle("/targets/", targetsHandler)
+		}
+		allTargets, err := checkTargets(mysqlConfigs, mongoUris, otherTargets)
+		if err != nil {
+			log.Error(err.Error())
+			return 1
+		}
+		registered := []string{"db_connect_checker_build_info"}
+		if len(exporterTargets) > 0 {
+			registered = append(registered, "mysql_connection_available")
+		}
+		if len(mongoTargets) > 0 {
+			registered = append(registered, "mongodb_connection_available")
+		}
+		mux.Handle("/-/selftest", metrics.SelfTestHandler(selfTestTimeout, selfTestChecks(settings, allTargets, registered)...))
+
+		addr := fmt.Sprintf(":%s", settings.ExporterPort)
+		shutdownTimeout := time.Duration(settings.ShutdownTimeout) * time.Second
 
-		http.Handle("/metrics", promhttp.Handler())
+		server := &http.Server{
+			Addr:    addr,
+			Handler: mux,
+		}
 
-		port := util.GetEnvString("EXPORTER_PORT", "38080")
-		addr := fmt.Sprintf(":%s", port)
+		ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
 
-		fmt.Printf("Starting metrics exporter on %s/metrics\n", addr)
-		fmt.Printf("Check interval: %v\n", checkInterval)
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting HTTP server: %v\n", err)
-			os.Exit(1)
+		if settings.CheckSchedule != "" {
+			log.Info("Starting metrics exporter", "version", version.String(), "address", addr+"/metrics", "check_schedule", settings.CheckSchedule)
+		} else {
+			log.Info("Starting metrics exporter", "version", version.String(), "address", addr+"/metrics", "check_interval", checkInterval)
 		}
+
+		if settings.RemoteWriteURL != "" {
+			if settings.RemoteWriteInterval <= 0 {
+				log.Error(fmt.Sprintf("\"REMOTE_WRITE_INTERVAL\" must be positive, got %v", settings.RemoteWriteInterval))
+				return 1
+			}
+			pusher := remotewrite.New(settings.RemoteWriteURL, pushRegistry, settings.RemoteWriteInterval)
+			pusher.BearerToken = settings.RemoteWriteBearerToken
+			pusher.Tenant = settings.RemoteWriteTenant
+			log.Info("Pushing metrics with remote write", "interval", settings.RemoteWriteInterval)
+			go pusher.Run(ctx, settings.RemoteWriteInterval)
+		}
+
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
+
+		select {
+		case err := <-serverErr:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Error starting HTTP server", "error", err)
+				return 1
+			}
+		case <-ctx.Done():
+			log.Info("Shutting down, waiting for in-flight requests", "timeout", shutdownTimeout)
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error("Error shutting down HTTP server", "error", err)
+		}
+		if err := mysqlExporter.Shutdown(shutdownCtx); err != nil {
+			log.Error("Error stopping checks", "error", err)
+		}
+		if err := mongoExporter.Shutdown(shutdownCtx); err != nil {
+			log.Error("Error stopping checks", "error", err)
+		}
+		return 0
+	} else if settings.Mode == "controller" {
+		return runController(ctx, settings)
+	} else if settings.Mode == "readiness-gate" {
+		return runReadinessGate(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
+	} else if settings.Mode == "readiness-file" {
+		return runReadinessFile(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
+	} else if settings.Mode == "init" {
+		return runInit(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
 	} else {
-		err := mysqlcheck.CheckConnections(mysqlConfigs, tries)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+		return runOnce(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
+	}
+}
+
+// runOnce runs the one-shot check and, with RESULT_FILE set, writes the
+// outcome of every target there before returning the exit code. With
+// OUTPUT_FORMAT=annotations the outcome is also printed as CI annotations.
+// In a terminal the attempts are shown as a live view instead of retry
+// lines, unless LOG_TEMPLATE is set, and the outcome as a table, colored
+// unless NO_COLOR is set.
+func runOnce(ctx context.Context, settings types.Settings, mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) int {
+	// SIGINT and SIGTERM stop the retries, so the outcome is still
+	// reported.
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	annotations := settings.OutputFormat == "annotations"
+	table := term.IsTerminal(int(os.Stdout.Fd()))
+	if settings.ResultFile == "" && !annotations && !table {
+		return checkOnce(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
+	}
+	collector := report.NewCollector()
+	sinks = append(sinks, collector)
+
+	var code int
+	if table && mysqlcheck.AttemptLog == nil && os.Getenv("TERM") != "dumb" {
+		width, _, _ := term.GetSize(int(os.Stdout.Fd()))
+		view := progress.New(os.Stdout, width, targetNames(mysqlConfigs, mongoUris, otherTargets))
+		mysqlcheck.AttemptLog = view
+		view.Start()
+		code = checkOnce(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
+		view.Stop()
+	} else {
+		code = checkOnce(ctx, settings, mysqlConfigs, mongoUris, otherTargets)
+	}
+	outcome := collector.Report(code, settings.WaitFor)
+	if table {
+		fmt.Println()
+		report.WriteTable(os.Stdout, outcome, os.Getenv("NO_COLOR") == "")
+	}
+	if annotations {
+		report.WriteAnnotations(os.Stdout, outcome)
+	}
+	if settings.ResultFile != "" {
+		if err := report.Write(settings.ResultFile, outcome); err != nil {
+			log.Error(err.Error())
+			return max(code, 1)
 		}
+	}
+	return code
+}
 
-		if dbType == "mongodb" {
-			i := 1
-			for i = 1; i <= tries; i += 1 {
-				sleepS := 3*i + 1
-				sleep := time.Duration(sleepS) * time.Second
+// targetNames returns the names of the targets in logs, e.g.
+// "mysql db:3306/app".
+func targetNames(mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) []string {
+	names := []string{}
+	// Invalid URIs are reported by the check itself.
+	targets, _ := checkTargets(mysqlConfigs, mongoUris, otherTargets)
+	for _, target := range targets {
+		names = append(names, target.String())
+	}
+	return names
+}
 
-				url, err := url.Parse(mongoUri)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error: cannot get db from uri: %v\n", err)
-					os.Exit(1)
-				}
+// checkOnce checks the MySQL databases and every MongoDB URI in parallel with
+// the same TRIES budget, so the worst-case wait is the slowest database
+// rather than the sum of both. It reports every failure and returns the
+// highest exit code among them.
+func checkOnce(ctx context.Context, settings types.Settings, mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) int {
+	// RETRY_BACKOFF_FACTORS is validated with the other settings.
+	factors, _ := retry.ParseFactors(settings.RetryBackoffFactors)
+	mysqlcheck.Backoff = retry.Linear.Override(settings.RetryBase, settings.RetryMultiplier, settings.RetryMaxSleep).WithJitter(settings.RetryJitter).WithFactors(factors)
+	mysqlcheck.MaxClockSkew = settings.MaxClockSkew
+	mysqlcheck.MinFreeSpace = settings.MinFreeSpace
+	mysqlcheck.MaxThreadsConnected, mysqlcheck.MaxThreadsRunning = settings.MaxThreadsConnected, settings.MaxThreadsRunning
+	mysqlcheck.MaxFlowControlPaused = settings.MaxFlowControlPaused
+	dialer := dnsDialer(settings)
+	mysqlcheck.DefaultDialer = dialer
+	mysqlcheck.AttemptTimeout = settings.AttemptTimeout
+	mysqlcheck.ConnectTimeout, mysqlcheck.QueryTimeout = settings.ConnectTimeout, settings.QueryTimeout
+	waitUnavailable := settings.WaitFor == "unavailable"
+	runner := &checker.Runner{
+		Dialer:               dialer,
+		AttemptTimeout:       settings.AttemptTimeout,
+		ConnectTimeout:       settings.ConnectTimeout,
+		QueryTimeout:         settings.QueryTimeout,
+		Unavailable:          waitUnavailable,
+		MaxClockSkew:         settings.MaxClockSkew,
+		MinFreeSpace:         settings.MinFreeSpace,
+		MaxThreadsConnected:  settings.MaxThreadsConnected,
+		MaxThreadsRunning:    settings.MaxThreadsRunning,
+		MaxFlowControlPaused: settings.MaxFlowControlPaused,
+	}
 
-				dbName := url.Path
-				if dbName[0] == '/' {
-					dbName = url.Path[1:]
-				}
+	// MySQL keeps its own retry loop with WAIT_FOR_ANY support, other
+	// types are checked one goroutine per group of identical targets.
+	targets, err := checkTargets(nil, mongoUris, otherTargets)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+
+	groups := checker.Group(targets)
+	codes := make(chan int, 1+len(groups))
+	go func() {
+		codes <- checkMysqlOnce(ctx, mysqlConfigs, settings.Tries, settings.WaitForAny, waitUnavailable)
+	}()
+	for _, group := range groups {
+		go func() {
+			codes <- checkTargetOnce(ctx, runner, group, settings.Tries)
+		}()
+	}
+
+	code := 0
+	for range cap(codes) {
+		code = max(code, <-codes)
+	}
+	return code
+}
 
-				client, err := mongo.NewClient(options.Client().ApplyURI(mongoUri))
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Try (%d/%d) sleep %d seconds error mongodb connect to '%s': %v\n", i, tries, sleepS, url.Host, err)
-					time.Sleep(sleep)
-					continue
+func checkMysqlOnce(ctx context.Context, mysqlConfigs []types.MysqlConfig, tries int, waitForAny, waitUnavailable bool) int {
+	check := mysqlcheck.CheckConnections
+	if waitForAny {
+		check = mysqlcheck.CheckAnyConnection
+	}
+	if waitUnavailable {
+		check = mysqlcheck.CheckUnavailableConnections
+	}
+	err := check(ctx, mysqlConfigs, tries)
+	if err != nil {
+		log.Error(err.Error())
+		if retry.IsPermanent(err) {
+			return exitNotRetryable
+		}
+		return 1
+	}
+	return 0
+}
+
+// checkTargetOnce retries one target up to tries times, or its own Tries,
+// with the options of runner and returns the process exit code. It stops early once the deadline
+// of ctx leaves no time for the next attempt. group are targets with the
+// same checker.Key: the first one is checked and the sinks get every result
+// for each of them.
+func checkTargetOnce(ctx context.Context, runner *checker.Runner, group []types.Target, tries int) int {
+	target := group[0]
+	if target.Tries > 0 {
+		tries = target.Tries
+	}
+	waitUnavailable := runner.Unavailable
+	check := func() error {
+		result := runner.Check(ctx, target)
+		for _, alias := range group {
+			for _, sink := range sinks {
+				sink.Observe(ctx, alias, result)
+			}
+		}
+		return result.Err
+	}
+	if waitUnavailable {
+		check = wait.Unavailable(check)
+	}
+
+	for i := 1; i <= tries; i += 1 {
+		start := time.Now()
+		err := check()
+		sleep := mysqlcheck.Backoff.DurationFor(i, checker.ErrorReason(target, err))
+		if mysqlcheck.AttemptLog != nil {
+			fields := message.Fields{Target: target.String(), Attempt: i, Tries: tries, Severity: target.SeverityLevel(), Duration: time.Since(start)}
+			if err != nil {
+				fields.Error, fields.Reason = err.Error(), checker.ErrorReason(target, err)
+				if waitUnavailable || checker.Retryable(target, err) {
+					fields.Sleep = sleep
 				}
+			}
+			mysqlcheck.AttemptLog.Log(fields)
+		}
+		if err != nil && !waitUnavailable && !checker.Retryable(target, err) {
+			if mysqlcheck.AttemptLog == nil {
+				log.Error("Connection attempt failed with a non-retryable error", log.Target(target), "attempt", i, "tries", tries, "reason", checker.ErrorReason(target, err), "error", err)
+			}
+			return exitNotRetryable
+		}
+		if err != nil {
+			if mysqlcheck.AttemptLog == nil {
+				log.Warn("Connection attempt failed", log.Target(target), "attempt", i, "tries", tries, "sleep", sleep, "reason", checker.ErrorReason(target, err), "error", err)
+			}
+			if err := retry.Sleep(ctx, clock.Real, sleep); err != nil {
+				log.Error("Connection attempts stopped", log.Target(target), "attempt", i, "tries", tries, "error", err)
+				return 2
+			}
+			continue
+		}
+
+		if waitUnavailable {
+			log.Info("Database is unreachable", log.Target(target), "attempt", i, "tries", tries)
+		} else {
+			log.Info("Connect success", log.Target(target), "attempt", i, "tries", tries)
+		}
+		return 0
+	}
 
-				ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-				err = client.Connect(ctx)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error cannot create context %v\n", err)
-					os.Exit(1)
+	log.Error("Connection attempts have failed", log.Target(target), "tries", tries)
+	return 2
+}
+
+// selfTestTimeout limits every check of /-/selftest.
+const selfTestTimeout = 10 * time.Second
+
+// selfTestChecks returns the checks behind /-/selftest: the collectors are
+// registered, the configuration resolves, secrets and CA files are readable
+// and one target of every type can be connected to.
+func selfTestChecks(settings types.Settings, targets []types.Target, registered []string) []metrics.SelfTestCheck {
+	checks := []metrics.SelfTestCheck{
+		metrics.GatherCheck(prometheus.DefaultGatherer, registered...),
+		{Name: "config", Run: func(ctx context.Context) error {
+			_, errs := util.ValidateSettings()
+			_, mysqlErrs := util.ValidateMysqlEnvs()
+			_, mongoErrs := util.ValidateMongoEnvs(mongocheck.ValidateURI)
+			_, typeErrs := checker.ValidateEnv(settings)
+			errs = append(errs, mysqlErrs...)
+			errs = append(errs, mongoErrs...)
+			for _, name := range checker.Types() {
+				errs = append(errs, typeErrs[name]...)
+			}
+			return errors.Join(errs...)
+		}},
+		{Name: "secrets", Run: func(ctx context.Context) error {
+			_, errs := util.ValidateMysqlDir(settings.TargetsDir)
+			for _, target := range targets {
+				if target.TLS && target.TLSCAFile != "" {
+					if _, err := util.LoadTLSConfig(target.TLSCAFile); err != nil {
+						errs = append(errs, fmt.Errorf("%s: %v", target, err))
+					}
 				}
+				for _, option := range []string{"private_key_file", "credentials_file"} {
+					if file := target.Options[option]; file != "" {
+						if _, err := os.ReadFile(file); err != nil {
+							errs = append(errs, fmt.Errorf("%s: %v", target, err))
+						}
+					}
+				}
+			}
+			return errors.Join(errs...)
+		}},
+	}
 
-				_, err = client.Database(dbName).ListCollectionNames(ctx, bson.D{})
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Try (%d/%d) sleep %d seconds error list collections: %v\n", i, tries, sleepS, err)
-					time.Sleep(sleep)
-					continue
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if seen[target.Type] {
+			continue
+		}
+		seen[target.Type] = true
+		checks = append(checks, metrics.SelfTestCheck{
+			Name: "connection " + target.Type,
+			Run: func(ctx context.Context) error {
+				if err := checker.Check(ctx, target).Err; err != nil {
+					return fmt.Errorf("%s: %s", target, util.Redact(err.Error(), target.Pass))
 				}
+				return nil
+			},
+		})
+	}
+	return checks
+}
 
-				fmt.Println("Connect success")
-				break
+// runHealthcheck makes a single request to the local exporter's /status
+// endpoint and returns the process exit code. It never opens database
+// connections itself, so it is cheap enough to run as a Docker HEALTHCHECK.
+func runHealthcheck(port string, timeout time.Duration) int {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%s/status", port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Healthcheck failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
 
-			}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Healthcheck failed: exporter reports status %s\n", resp.Status)
+		return 1
+	}
+	fmt.Println("Healthcheck passed")
+	return 0
+}
+
+// runInit waits for all configured databases within a total time budget
+// (MAX_WAIT) and returns the process exit code. It is meant to be used as a
+// Kubernetes initContainer: retries back off with jitter and a summary of
+// still failing targets is logged every PROGRESS_INTERVAL seconds. With
+// WAIT_FOR_ANY one reachable target per database type is enough. With
+// WAIT_FOR=unavailable it waits for the databases to become unreachable.
+// SIGINT and SIGTERM stop the wait like an exhausted budget.
+func runInit(ctx context.Context, settings types.Settings, mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) int {
+	budget := time.Duration(settings.MaxWait) * time.Second
+	waitUnavailable := settings.WaitFor == "unavailable"
+	// RETRY_BACKOFF_FACTORS is validated with the other settings.
+	factors, _ := retry.ParseFactors(settings.RetryBackoffFactors)
 
-			if i == tries+1 {
-				fmt.Fprintf(os.Stderr, "Connection attempts have failed")
-				os.Exit(2)
+	targets, err := checkTargets(mysqlConfigs, mongoUris, otherTargets)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+
+	runner := checker.Runner{
+		Targets:          targets,
+		Budget:           budget,
+		ProgressInterval: time.Duration(settings.ProgressInterval) * time.Second,
+		Any:              settings.WaitForAny,
+		Unavailable:      waitUnavailable,
+		Backoff: retry.Backoff{
+			Initial:    time.Second,
+			Max:        30 * time.Second,
+			Multiplier: 2,
+			Jitter:     retry.JitterEqual,
+		}.Override(settings.RetryBase, settings.RetryMultiplier, settings.RetryMaxSleep).WithJitter(settings.RetryJitter).WithFactors(factors),
+		Sinks:                sinks,
+		Dialer:               dnsDialer(settings),
+		AttemptTimeout:       settings.AttemptTimeout,
+		ConnectTimeout:       settings.ConnectTimeout,
+		QueryTimeout:         settings.QueryTimeout,
+		MaxClockSkew:         settings.MaxClockSkew,
+		MinFreeSpace:         settings.MinFreeSpace,
+		MaxThreadsConnected:  settings.MaxThreadsConnected,
+		MaxThreadsRunning:    settings.MaxThreadsRunning,
+		MaxFlowControlPaused: settings.MaxFlowControlPaused,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.Info("Waiting for databases", "budget", budget, "databases", len(targets))
+	err = runner.Run(ctx)
+	if err != nil {
+		log.Error(err.Error())
+		exitCode := 2
+		if retry.IsPermanent(err) {
+			exitCode = exitNotRetryable
+		}
+		if events, eventErr := eventPublisher(settings); eventErr != nil {
+			log.Error(eventErr.Error())
+		} else if events != nil {
+			if eventErr := events.Warning(context.Background(), "DatabaseWaitFailed", err.Error()); eventErr != nil {
+				log.Error(eventErr.Error())
 			}
 		}
+		return exitCode
+	}
+	if waitUnavailable {
+		log.Info("All databases are unreachable")
+	} else {
+		log.Info("All databases are available")
+	}
+	return 0
+}
+
+// checkTargets converts the configured databases to the generic targets
+// consumed by checker.Runner.
+func checkTargets(mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) ([]types.Target, error) {
+	targets := []types.Target{}
+	for _, cfg := range mysqlConfigs {
+		targets = append(targets, cfg.Target())
+	}
+	for _, mongoUri := range mongoUris {
+		target, err := mongocheck.TargetFromURI(mongoUri)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	targets = append(targets, otherTargets...)
+	return targets, nil
+}
+
+// runReadinessGate runs as a sidecar and keeps the READINESS_GATE condition
+// of its own pod in sync with database availability until SIGTERM.
+func runReadinessGate(ctx context.Context, settings types.Settings, mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) int {
+	if settings.PodName == "" || settings.PodNamespace == "" {
+		log.Error("\"POD_NAME\" and \"POD_NAMESPACE\" must be set for \"MODE=readiness-gate\"")
+		return 1
+	}
+	targets, err := checkTargets(mysqlConfigs, mongoUris, otherTargets)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+	kubeClient, _, err := kube.Clients()
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	interval := time.Duration(settings.CheckInterval) * time.Second
+	log.Info("Setting readiness condition", "version", version.String(), "condition", settings.ReadinessGate, "pod", settings.PodNamespace+"/"+settings.PodName, "interval", interval)
+
+	gate := readiness.NewPodGate(kubeClient, settings.PodNamespace, settings.PodName, settings.ReadinessGate)
+	reporter, err := withEvents(gate, settings)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+	runner := checker.Runner{Targets: targets, Interval: interval, Reporter: reporter, Sinks: sinks, Dialer: dnsDialer(settings), AttemptTimeout: settings.AttemptTimeout, ConnectTimeout: settings.ConnectTimeout, QueryTimeout: settings.QueryTimeout, MaxClockSkew: settings.MaxClockSkew}
+	runner.Serve(ctx)
+	return 0
+}
+
+// runReadinessFile keeps READINESS_FILE present while all databases are
+// reachable, until SIGTERM. The file is removed on exit so a stale file never
+// reports a database as reachable.
+func runReadinessFile(ctx context.Context, settings types.Settings, mysqlConfigs []types.MysqlConfig, mongoUris []string, otherTargets []types.Target) int {
+	targets, err := checkTargets(mysqlConfigs, mongoUris, otherTargets)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	interval := time.Duration(settings.CheckInterval) * time.Second
+	log.Info("Maintaining readiness file", "version", version.String(), "file", settings.ReadinessFile, "interval", interval)
+
+	file := readiness.NewFile(settings.ReadinessFile)
+	reporter, err := withEvents(file, settings)
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+	runner := checker.Runner{Targets: targets, Interval: interval, Reporter: reporter, Sinks: sinks, Dialer: dnsDialer(settings), AttemptTimeout: settings.AttemptTimeout, ConnectTimeout: settings.ConnectTimeout, QueryTimeout: settings.QueryTimeout, MaxClockSkew: settings.MaxClockSkew}
+	runner.Serve(ctx)
+	if err := file.Remove(); err != nil {
+		log.Error(err.Error())
+	}
+	return 0
+}
+
+// eventPublisher returns the publisher for EVENT_TARGET, or nil if Events are
+// not configured.
+func eventPublisher(settings types.Settings) (*kube.EventPublisher, error) {
+	if settings.EventTarget == "" {
+		return nil, nil
+	}
+	if settings.PodNamespace == "" {
+		return nil, fmt.Errorf("\"POD_NAMESPACE\" must be set to use \"EVENT_TARGET\"")
+	}
+	kubeClient, _, err := kube.Clients()
+	if err != nil {
+		return nil, err
+	}
+	events, err := kube.NewEventPublisher(context.Background(), kubeClient, settings.PodNamespace, settings.EventTarget)
+	if err != nil {
+		return nil, err
+	}
+	if settings.NotifyTemplate != "" {
+		notifyTemplate, err := message.Parse("NOTIFY_TEMPLATE", settings.NotifyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("NOTIFY_TEMPLATE: %v", err)
+		}
+		events.SetTemplate(notifyTemplate)
+	}
+	events.SetLabels(ownerLabels)
+	return events, nil
+}
+
+// withEvents adds Events on EVENT_TARGET to a readiness reporter.
+func withEvents(reporter readiness.Reporter, settings types.Settings) (readiness.Reporter, error) {
+	events, err := eventPublisher(settings)
+	if err != nil || events == nil {
+		return reporter, err
+	}
+	return readiness.Reporters{
+		reporter,
+		readiness.ReporterFunc(func(ctx context.Context, result readiness.Result) error {
+			return events.Report(ctx, result.Failing)
+		}),
+	}, nil
+}
+
+// dnsDialer returns the dialer of RERESOLVE_DNS, or nil to keep the drivers'
+// own dialers.
+func dnsDialer(settings types.Settings) checker.Dialer {
+	if !settings.ReresolveDNS {
+		return nil
+	}
+	return &resolve.Dialer{
+		Server: settings.DNSServer,
+		OnChange: func(host string, old, new []string) {
+			log.Info("DNS changed", "host", host, "old", strings.Join(old, ","), "new", strings.Join(new, ","))
+		},
+	}
+}
+
+// reconcileMysqlConfigs merges the MySQL targets of the environment and of
+// the targets directory. A database set in both is checked once, with the
+// settings from the environment; different settings are reported as a
+// warning.
+func reconcileMysqlConfigs(settings types.Settings, envConfigs, dirConfigs, fileConfigs, configFileConfigs []types.MysqlConfig) ([]types.MysqlConfig, []util.TargetConflict) {
+	fileName := settings.TargetsFile
+	if fileName == "-" {
+		fileName = "stdin"
+	}
+	configs, conflicts := util.ReconcileMysqlConfigs(
+		util.MysqlSource{Name: "environment", Configs: envConfigs},
+		util.MysqlSource{Name: settings.TargetsDir, Configs: dirConfigs},
+		util.MysqlSource{Name: fileName, Configs: fileConfigs},
+		util.MysqlSource{Name: settings.ConfigFile, Configs: configFileConfigs},
+	)
+	for _, conflict := range conflicts {
+		log.Warn("Target is configured differently in several sources", "target", conflict.Target,
+			"sources", strings.Join(conflict.Sources, ","), "fields", strings.Join(conflict.Fields, ","), "using", conflict.Sources[0])
+	}
+	return configs, conflicts
+}
+
+// runValidate resolves the configuration from the environment and the
+// config file, configFile if set, and reports every problem found without
+// opening any database connection.
+func runValidate(configFile string) int {
+	settings, errs := util.ValidateSettings()
+	if configFile != "" {
+		settings.ConfigFile = configFile
+	}
+	util.MaxTargetIndex = max(settings.MaxTargetIndex, 0)
+	for _, warning := range util.IndexWarnings() {
+		log.Warn(warning)
+	}
+
+	mysqlConfigs, mysqlErrs := util.ValidateMysqlEnvs()
+	errs = append(errs, mysqlErrs...)
+
+	dirConfigs, dirErrs := util.ValidateMysqlDir(settings.TargetsDir)
+	errs = append(errs, dirErrs...)
+	var fileTargets util.FileTargets
+	if settings.TargetsFile != "" {
+		var fileErrs []error
+		fileTargets, fileErrs = util.ValidateTargetsFile(settings.TargetsFile, os.Stdin)
+		errs = append(errs, fileErrs...)
+	}
+	var configTargets config.Config
+	if settings.ConfigFile != "" {
+		var configErrs []error
+		configTargets, configErrs = config.Validate(settings.ConfigFile)
+		errs = append(errs, configErrs...)
+	}
+	mysqlConfigs, _ = reconcileMysqlConfigs(settings, mysqlConfigs, dirConfigs, fileTargets.Mysql, configTargets.Mysql)
+
+	mongoUris, mongoErrs := util.ValidateMongoEnvs(mongocheck.ValidateURI)
+	for _, uri := range fileTargets.MongoDB {
+		if err := mongocheck.ValidateURI(uri); err != nil {
+			mongoErrs = append(mongoErrs, fmt.Errorf("%s: MONGODB_URI: %v", settings.TargetsFile, err))
+			continue
+		}
+		mongoUris = append(mongoUris, uri)
+	}
+	envConfigs, envErrs := checker.ValidateEnv(settings)
+	configTypes := configTargets.Types()
+
+	configured := map[string]bool{
+		"mysql":   len(mysqlConfigs)+len(mysqlErrs) > 0,
+		"mongodb": len(mongoUris)+len(mongoErrs) > 0 || configTypes["mongodb"],
+	}
+	for name, configs := range envConfigs {
+		configured[name] = len(configs)+len(envErrs[name]) > 0 || configTypes[name]
+	}
+	dbTypes, err := util.DBTypes(settings, configured)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err == nil && !dbTypes["mysql"] {
+		mysqlConfigs = nil
+	}
+	if err == nil && !dbTypes["mongodb"] {
+		mongoUris = nil
+	} else {
+		errs = append(errs, mongoErrs...)
+	}
+	for _, name := range checker.Types() {
+		if err == nil && !dbTypes[name] {
+			delete(envConfigs, name)
+		} else {
+			errs = append(errs, envErrs[name]...)
+		}
+	}
+
+	fmt.Println("Resolved targets:")
+	for _, cfg := range mysqlConfigs {
+		tls := "off"
+		if cfg.TLS {
+			tls = fmt.Sprintf("on, ca %s", cfg.TLSCAFile)
+		}
+		if cfg.Hosts != "" {
+			endpoints, _ := types.ParseHosts(cfg.Hosts, cfg.Port)
+			tls += ", endpoints: " + strings.Join(endpoints, ",")
+		}
+		fmt.Printf(" - mysql %s@%s:%s/%s (tls: %s)\n", cfg.User, cfg.Host, cfg.Port, cfg.Name, tls)
+	}
+	for _, mongoUri := range mongoUris {
+		mongoHost, mongoDB, _ := mongocheck.ParseURI(mongoUri)
+		fmt.Printf(" - mongodb %s/%s\n", mongoHost, mongoDB)
+	}
+	for _, name := range checker.Types() {
+		for _, cfg := range envConfigs[name] {
+			fmt.Printf(" - %s\n", cfg.Summary())
+		}
+	}
+	for _, target := range configTargets.Targets {
+		if err == nil && !dbTypes[target.Type] {
+			continue
+		}
+		fmt.Printf(" - %s (from %s)\n", target, settings.ConfigFile)
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Configuration has %d error(s):\n", len(errs))
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, " - %v\n", err)
+		}
+		return 1
+	}
+	fmt.Println("Configuration is valid")
+	return 0
+}
+
+// runController runs checks for DatabaseCheck custom resources and writes
+// results to their status until SIGTERM.
+func runController(ctx context.Context, settings types.Settings) int {
+	kubeClient, dynamicClient, err := kube.Clients()
+	if err != nil {
+		log.Error(err.Error())
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	namespace := settings.ControllerNamespace
+	if namespace == "" {
+		namespace = "all namespaces"
 	}
+	log.Info("Watching DatabaseCheck resources", "version", version.String(), "namespace", namespace)
 
+	controller.New(
+		dynamicClient,
+		kubeClient,
+		settings.ControllerNamespace,
+		time.Duration(settings.ControllerResync)*time.Second,
+		time.Duration(settings.CheckInterval)*time.Second,
+	).Run(ctx)
+	return 0
 }
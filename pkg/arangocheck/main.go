@@ -0,0 +1,216 @@
+// Package arangocheck checks ArangoDB servers through their HTTP API: it
+// reads the server version in the database of the target and optionally
+// checks that a collection exists.
+package arangocheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A missing
+// database or collection is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Numbers of ArangoDB errors with an error class.
+var (
+	authErrors = map[int]bool{
+		11:  true, // forbidden
+		401: true, // not authorized to execute this request
+	}
+	unknownDatabaseErrors = map[int]bool{
+		1203: true, // collection or view not found
+		1228: true, // database not found
+	}
+)
+
+// Error is an error answer of ArangoDB.
+type Error struct {
+	// Code is the HTTP status code.
+	Code    int
+	Num     int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("arangodb error %d (HTTP %d): %s", e.Num, e.Code, e.Message)
+}
+
+// defaultTimeout limits a check: the version and the collection request.
+const defaultTimeout = 10 * time.Second
+
+// Check reads the version of the ArangoDB server of target in its database
+// (_system if empty), which fails for a missing database, and checks the
+// collection of the collection option, if set. The phases are the version
+// and the collection request.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	tlsConfig, err := targetTLSConfig(target)
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+
+	transport := o.Transport(tlsConfig)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	scheme := "http"
+	if target.TLS {
+		scheme = "https"
+	}
+	database := target.Database
+	if database == "" {
+		database = "_system"
+	}
+	baseURL := scheme + "://" + net.JoinHostPort(target.Host, target.Port) + "/_db/" + url.PathEscape(database)
+
+	phases := []types.Phase{}
+	start := time.Now()
+	var serverVersion struct {
+		Version string `json:"version"`
+	}
+	err = get(ctx, client, target, baseURL+"/_api/version", &serverVersion)
+	phases = append(phases, types.Phase{Name: "version", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error reading version of database %s: %w", database, err))
+	}
+
+	if collection := target.Options["collection"]; collection != "" {
+		start = time.Now()
+		err = get(ctx, client, target, baseURL+"/_api/collection/"+url.PathEscape(collection), nil)
+		phases = append(phases, types.Phase{Name: "collection", Duration: time.Since(start)})
+		if err != nil {
+			return newResult(phases, serverVersion.Version, fmt.Errorf("error reading collection %s: %w", collection, err))
+		}
+	}
+	return newResult(phases, serverVersion.Version, nil)
+}
+
+// targetTLSConfig returns the TLS config of target: its TLSConfig, or one
+// trusting the CA bundle of TLSCAFile, or the system roots if neither is set.
+func targetTLSConfig(target types.Target) (*tls.Config, error) {
+	if !target.TLS || target.TLSConfig != nil {
+		return target.TLSConfig, nil
+	}
+	if target.TLSCAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// get sends a GET request to endpoint with the credentials of target and
+// decodes a successful answer into data. A failed answer is returned as
+// *Error.
+func get(ctx context.Context, client *http.Client, target types.Target, endpoint string, data interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", "db-connect-checker/"+version.Version)
+	if target.User != "" {
+		request.SetBasicAuth(target.User, target.Pass)
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			ErrorNum     int    `json:"errorNum"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		// Some proxies answer 401 without an ArangoDB error.
+		if (json.Unmarshal(content, &answer) != nil || answer.ErrorNum == 0) && resp.StatusCode != http.StatusUnauthorized {
+			return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		if answer.ErrorMessage == "" {
+			answer.ErrorMessage = resp.Status
+		}
+		return &Error{Code: resp.StatusCode, Num: answer.ErrorNum, Message: answer.ErrorMessage}
+	}
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(content, data); err != nil {
+		return fmt.Errorf("invalid answer: %w", err)
+	}
+	return nil
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	return checkbase.Result(phases, version, err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var arangoErr *Error
+	if errors.As(err, &arangoErr) {
+		if authErrors[arangoErr.Num] || arangoErr.Code == http.StatusUnauthorized {
+			return "auth error"
+		}
+		if unknownDatabaseErrors[arangoErr.Num] {
+			return "unknown database"
+		}
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures, missing databases or collections and invalid configs are not
+// retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
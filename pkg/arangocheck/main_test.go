@@ -0,0 +1,160 @@
+package arangocheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeArango answers like an ArangoDB server whose only user is root with
+// password secret and whose only database app has the collection orders.
+func fakeArango(t *testing.T, secure bool) types.Target {
+	t.Helper()
+	fail := func(w http.ResponseWriter, code, num int, message string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": true, "code": code, "errorNum": num, "errorMessage": message})
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "root" || pass != "secret" {
+			// ArangoDB answers without a body.
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		database, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/_db/"), "/")
+		switch {
+		case database != "app" && database != "_system":
+			fail(w, http.StatusNotFound, 1228, "database not found")
+		case path == "_api/version":
+			json.NewEncoder(w).Encode(map[string]string{"server": "arango", "version": "3.11.5", "license": "community"})
+		case path == "_api/collection/orders" && database == "app":
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "orders", "status": 3, "type": 2})
+		case strings.HasPrefix(path, "_api/collection/"):
+			fail(w, http.StatusNotFound, 1203, "collection or view not found")
+		default:
+			fail(w, http.StatusNotFound, 404, "unknown path")
+		}
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	if secure {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	target := types.ArangoDBConfig{Host: host, Port: port, Database: "app", User: "root", Pass: "secret", TLS: secure}.Target()
+	if secure {
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		target.TLSConfig = &tls.Config{RootCAs: pool}
+	}
+	return target
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		secure     bool
+		modify     func(target *types.Target)
+		wantReason string
+		wantPhases []string
+	}{
+		{
+			name:       "database",
+			modify:     func(target *types.Target) {},
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "collection over TLS",
+			secure:     true,
+			modify:     func(target *types.Target) { target.Options["collection"] = "orders" },
+			wantPhases: []string{"version", "collection"},
+		},
+		{
+			name:       "system database",
+			modify:     func(target *types.Target) { target.Database = "" },
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "missing collection",
+			modify:     func(target *types.Target) { target.Options["collection"] = "missing" },
+			wantReason: "unknown database",
+			wantPhases: []string{"version", "collection"},
+		},
+		{
+			name:       "missing database",
+			modify:     func(target *types.Target) { target.Database = "missing" },
+			wantReason: "unknown database",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "wrong password",
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:   "missing CA file",
+			secure: true,
+			modify: func(target *types.Target) {
+				target.TLSConfig = nil
+				target.TLSCAFile = filepath.Join(t.TempDir(), "ca.pem")
+			},
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeArango(t, tt.secure)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if tt.wantReason != "" && Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true", result.Err)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if result.Success && result.ServerVersion != "3.11.5" {
+				t.Errorf("ServerVersion = %q", result.ServerVersion)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	target := types.ArangoDBConfig{Host: host, Port: port, User: "root"}.Target()
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
@@ -0,0 +1,142 @@
+// Package audit writes every connection attempt as a JSON line to an
+// append-only file, as evidence of connectivity testing. The file is rotated
+// when it grows over a size limit.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Time           time.Time `json:"time"`
+	Target         string    `json:"target"`
+	Type           string    `json:"type"`
+	Severity       string    `json:"severity"`
+	Outcome        string    `json:"outcome"`
+	LatencySeconds float64   `json:"latency_seconds"`
+	ErrorClass     string    `json:"error_class,omitempty"`
+}
+
+// NewEntry describes one check of target finished at now.
+func NewEntry(now time.Time, target types.Target, result types.Result) Entry {
+	entry := Entry{
+		Time:           now.UTC(),
+		Target:         target.String(),
+		Type:           target.Type,
+		Severity:       target.SeverityLevel(),
+		Outcome:        "success",
+		LatencySeconds: result.Duration().Seconds(),
+	}
+	if !result.Success {
+		entry.Outcome = "failure"
+		entry.ErrorClass = result.Reason
+	}
+	return entry
+}
+
+// Log is an audit log file. It is safe for concurrent use.
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens path for appending, creating it if needed. When a line would
+// make the file larger than maxSize bytes, the file is renamed to path.1
+// (path.1 to path.2 and so on, keeping maxBackups old files) and a new one is
+// started. maxSize 0 disables rotation.
+func Open(path string, maxSize int64, maxBackups int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening audit log: %v", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends entry as one JSON line.
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing audit log: %v", err)
+	}
+	return nil
+}
+
+// Observe records one check result. It makes Log a checker.Sink.
+func (l *Log) Observe(ctx context.Context, target types.Target, result types.Result) {
+	if err := l.Record(NewEntry(time.Now(), target, result)); err != nil {
+		log.Error("Error writing audit log", log.Target(target), "error", err)
+	}
+}
+
+// rotate shifts the old files and starts a new one; l.mu must be held.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("rotating audit log: %v", err)
+	}
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i > 0; i-- {
+			os.Rename(backupName(l.path, i), backupName(l.path, i+1))
+		}
+		if err := os.Rename(l.path, backupName(l.path, 1)); err != nil {
+			return fmt.Errorf("rotating audit log: %v", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("rotating audit log: %v", err)
+	}
+	return l.open()
+}
+
+func backupName(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestNewEntry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	target := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app"}
+	warning := target
+	warning.Severity = "warning"
+
+	tests := []struct {
+		name   string
+		target types.Target
+		result types.Result
+		want   Entry
+	}{
+		{
+			name:   "success",
+			result: types.Result{Success: true, Phases: []types.Phase{{Name: "connect", Duration: 20 * time.Millisecond}}},
+			want:   Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Severity: "critical", Outcome: "success", LatencySeconds: 0.02},
+		},
+		{
+			name:   "failure",
+			result: types.Result{Reason: "auth error", Err: errors.New("access denied")},
+			want:   Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Severity: "critical", Outcome: "failure", ErrorClass: "auth error"},
+		},
+		{
+			name:   "warning",
+			target: warning,
+			result: types.Result{Reason: "timeout", Err: errors.New("i/o timeout")},
+			want:   Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Severity: "warning", Outcome: "failure", ErrorClass: "timeout"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.target.Type == "" {
+				tt.target = target
+			}
+			if got := NewEntry(now, tt.target, tt.result); got != tt.want {
+				t.Errorf("NewEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	entry := Entry{Time: time.Now().UTC(), Target: "mock mock/smoke", Type: "mock", Outcome: "success"}
+
+	for range 2 {
+		log, err := Open(path, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+		log.Close()
+	}
+
+	if entries := readEntries(t, path); len(entries) != 2 {
+		t.Errorf("audit log has %d entries after reopening, want 2", len(entries))
+	}
+}
+
+func TestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	entry := Entry{Time: time.Now().UTC(), Target: "mock mock/smoke", Type: "mock", Outcome: "success"}
+	line, _ := json.Marshal(entry)
+
+	// Two lines fit into a file, two backups are kept.
+	log, err := Open(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	for range 7 {
+		if err := log.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []struct {
+		path string
+		want int
+	}{
+		{path: path, want: 1},
+		{path: path + ".1", want: 2},
+		{path: path + ".2", want: 2},
+	} {
+		if entries := readEntries(t, file.path); len(entries) != file.want {
+			t.Errorf("%s has %d entries, want %d", filepath.Base(file.path), len(entries), file.want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("audit.log.3 exists, want at most 2 backups")
+	}
+}
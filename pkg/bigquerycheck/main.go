@@ -0,0 +1,204 @@
+// Package bigquerycheck checks BigQuery datasets: it obtains a token with
+// Application Default Credentials or a credentials file and runs a dry-run
+// query against the dataset, so missing IAM permissions fail the check
+// without scanning data or incurring cost.
+package bigquerycheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// scope is the OAuth scope of the check.
+const scope = "https://www.googleapis.com/auth/bigquery.readonly"
+
+// Error classes wrapped by check errors, see util.WithClass. Missing
+// permissions are reported as auth error, a missing project or dataset as
+// unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Error is an error answer of the BigQuery API.
+type Error struct {
+	// Code is the HTTP status code.
+	Code    int
+	Status  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bigquery error %d %s: %s", e.Code, e.Status, e.Message)
+}
+
+// defaultTimeout limits a check: fetching a token and a dry-run query.
+const defaultTimeout = 30 * time.Second
+
+// Check obtains a token for target and runs a dry-run query of the
+// INFORMATION_SCHEMA.TABLES view of its dataset in the project of the
+// project option. The phases are the token and the query.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	project := target.Options["project"]
+	if project == "" || target.Database == "" {
+		return newResult(nil, retry.Permanent(fmt.Errorf("bigquery project and dataset are required")))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	transport := o.Transport(target.TLSConfig)
+	defer transport.CloseIdleConnections()
+	// Tokens are fetched with the same transport.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+
+	phases := []types.Phase{}
+	start := time.Now()
+	credentials, err := findCredentials(ctx, target.Options["credentials_file"])
+	if err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	token, err := credentials.TokenSource.Token()
+	phases = append(phases, types.Phase{Name: "token", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error token: %w", err))
+	}
+
+	start = time.Now()
+	client := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(token), Base: transport}}
+	err = dryRun(ctx, client, "https://"+net.JoinHostPort(target.Host, target.Port), project, target.Database)
+	phases = append(phases, types.Phase{Name: "query", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error dry-run query of dataset %s: %w", target.Database, err))
+	}
+	return newResult(phases, nil)
+}
+
+// findCredentials reads the credentials file, or Application Default
+// Credentials if file is empty: GOOGLE_APPLICATION_CREDENTIALS, the gcloud
+// credentials or the metadata server.
+func findCredentials(ctx context.Context, file string) (*google.Credentials, error) {
+	if file == "" {
+		return google.FindDefaultCredentials(ctx, scope)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials: %w", err)
+	}
+	return google.CredentialsFromJSON(ctx, content, scope)
+}
+
+// dryRun validates a query of the dataset without running it. dataset is
+// DATASET or PROJECT.DATASET.
+func dryRun(ctx context.Context, client *http.Client, baseURL, project, dataset string) error {
+	if !strings.Contains(dataset, ".") {
+		dataset = project + "." + dataset
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"configuration": map[string]interface{}{
+			"dryRun": true,
+			"query": map[string]interface{}{
+				"query":        "SELECT 1 FROM `" + dataset + "`.INFORMATION_SCHEMA.TABLES LIMIT 1",
+				"useLegacySql": false,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/bigquery/v2/projects/"+url.PathEscape(project)+"/jobs", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var answer struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(content, &answer) != nil || answer.Error.Message == "" {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return &Error{Code: resp.StatusCode, Status: answer.Error.Status, Message: answer.Error.Message}
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "auth error"
+		case http.StatusNotFound:
+			return "unknown database"
+		}
+	}
+	// A rejected credential, e.g. a deleted service account key.
+	var tokenErr *oauth2.RetrieveError
+	if errors.As(err, &tokenErr) && tokenErr.Response != nil && tokenErr.Response.StatusCode >= 400 && tokenErr.Response.StatusCode < 500 {
+		return "auth error"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected
+// credentials, missing permissions, missing datasets and invalid configs are
+// not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
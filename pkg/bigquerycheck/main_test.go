@@ -0,0 +1,198 @@
+package bigquerycheck
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeBigQuery answers like the token endpoint of Google and the BigQuery API
+// of a project app-prod whose only dataset is analytics, readable by the
+// service account checker. It returns the target with a credentials file of
+// that account and the queries it received.
+func fakeBigQuery(t *testing.T) (types.Target, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries []string
+	apiError := func(w http.ResponseWriter, code int, status, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "status": status, "message": message}})
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			r.ParseForm()
+			assertion := r.PostForm.Get("assertion")
+			if strings.Count(assertion, ".") != 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Invalid JWT Signature."})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600})
+		case r.Header.Get("Authorization") != "Bearer access-token":
+			apiError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request is missing required authentication credential.")
+		case r.URL.Path == "/bigquery/v2/projects/app-prod/jobs":
+			var body struct {
+				Configuration struct {
+					DryRun bool `json:"dryRun"`
+					Query  struct {
+						Query string `json:"query"`
+					} `json:"query"`
+				} `json:"configuration"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			query := body.Configuration.Query.Query
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+			switch {
+			case !body.Configuration.DryRun:
+				apiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "not a dry run")
+			case strings.Contains(query, "`app-prod.analytics`"):
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": map[string]string{"state": "DONE"}})
+			case strings.Contains(query, "`other-project."):
+				apiError(w, http.StatusForbidden, "PERMISSION_DENIED", "Access Denied: Project other-project: User does not have bigquery.jobs.create permission.")
+			default:
+				apiError(w, http.StatusNotFound, "NOT_FOUND", "Not found: Dataset app-prod:missing was not found in location EU")
+			}
+		default:
+			apiError(w, http.StatusForbidden, "PERMISSION_DENIED", "Access Denied: Project other-project: User does not have bigquery.jobs.create permission.")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "app-prod",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "checker@app-prod.iam.gserviceaccount.com",
+		"token_uri":      server.URL + "/token",
+	})
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(file, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	target := types.BigQueryConfig{Project: "app-prod", Dataset: "analytics", CredentialsFile: file}.Target()
+	target.Host = host
+	target.Port = port
+	target.TLSConfig = &tls.Config{RootCAs: pool}
+	return target, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(target *types.Target)
+		wantReason  string
+		wantPhases  []string
+		wantQueries []string
+	}{
+		{
+			name:        "dataset",
+			modify:      func(target *types.Target) {},
+			wantPhases:  []string{"token", "query"},
+			wantQueries: []string{"SELECT 1 FROM `app-prod.analytics`.INFORMATION_SCHEMA.TABLES LIMIT 1"},
+		},
+		{
+			name:        "dataset with project",
+			modify:      func(target *types.Target) { target.Database = "app-prod.analytics" },
+			wantPhases:  []string{"token", "query"},
+			wantQueries: []string{"SELECT 1 FROM `app-prod.analytics`.INFORMATION_SCHEMA.TABLES LIMIT 1"},
+		},
+		{
+			name:        "missing dataset",
+			modify:      func(target *types.Target) { target.Database = "missing" },
+			wantReason:  "unknown database",
+			wantPhases:  []string{"token", "query"},
+			wantQueries: []string{"SELECT 1 FROM `app-prod.missing`.INFORMATION_SCHEMA.TABLES LIMIT 1"},
+		},
+		{
+			name:       "no permission",
+			modify:     func(target *types.Target) { target.Options["project"] = "other-project" },
+			wantReason: "auth error",
+			wantPhases: []string{"token", "query"},
+		},
+		{
+			name: "missing credentials file",
+			modify: func(target *types.Target) {
+				target.Options["credentials_file"] = filepath.Join(t.TempDir(), "missing.json")
+			},
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, queries := fakeBigQuery(t)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if tt.wantReason != "" && Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true", result.Err)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if got := queries(); strings.Join(got, ";") != strings.Join(tt.wantQueries, ";") {
+				t.Errorf("queries = %q, want %q", got, tt.wantQueries)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	target, _ := fakeBigQuery(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	// The token endpoint answers, the API does not.
+	target.Host, target.Port, _ = net.SplitHostPort(addr)
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
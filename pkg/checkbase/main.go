@@ -0,0 +1,110 @@
+// Package checkbase holds what the check packages built on a plain
+// connection or HTTP client share: the options of Check, dialing and the
+// result with its error class. A check package only picks its default
+// timeout and how to name its errors.
+package checkbase
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Dialer opens the network connections of a check. *net.Dialer implements
+// it; tests pass one that fails or answers without a real server.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Option customizes a single Check call.
+type Option func(*Options)
+
+// Options are the settings of a single Check call.
+type Options struct {
+	// Timeout limits the whole check.
+	Timeout time.Duration
+	// Dialer opens the connections, a *net.Dialer if nil.
+	Dialer Dialer
+}
+
+// New returns the options of a check package with the given default
+// timeout, changed by opts.
+func New(defaultTimeout time.Duration, opts []Option) Options {
+	o := Options{Timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTimeout limits the whole check instead of the default timeout of the
+// check package.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = timeout
+	}
+}
+
+// WithDialer opens connections with dialer instead of a *net.Dialer.
+func WithDialer(dialer Dialer) Option {
+	return func(o *Options) {
+		o.Dialer = dialer
+	}
+}
+
+// Dial connects to address with the dialer of o. The deadline of ctx
+// applies to every read and write on the connection.
+func (o Options) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := o.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// Transport returns an HTTP transport that connects with the dialer of o
+// and tlsConfig, if it is not nil. The caller closes its idle connections
+// when the check is done.
+func (o Options) Transport(tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if o.Dialer != nil {
+		transport.DialContext = o.Dialer.DialContext
+	}
+	return transport
+}
+
+// Result returns the result of one check attempt. reason is the ErrorReason
+// of the check package: err is wrapped with util.ErrAuthFailed for
+// "auth error", with util.ErrUnknownDatabase for "unknown database" and
+// with its network error class otherwise.
+func Result(phases []types.Phase, version string, err error, reason func(error) string) types.Result {
+	switch reason(err) {
+	case "auth error":
+		err = util.WithClass(util.ErrAuthFailed, err)
+	case "unknown database":
+		err = util.WithClass(util.ErrUnknownDatabase, err)
+	default:
+		err = util.ClassifyNetError(err)
+	}
+	return types.Result{
+		Success:       err == nil,
+		Attempts:      1,
+		Phases:        phases,
+		ServerVersion: version,
+		Reason:        reason(err),
+		Err:           err,
+	}
+}
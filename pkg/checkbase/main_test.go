@@ -0,0 +1,84 @@
+package checkbase
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+var errDenied = errors.New("denied")
+
+func reason(err error) string {
+	if errors.Is(err, errDenied) {
+		return "auth error"
+	}
+	return util.NetErrorReason(err)
+}
+
+func TestResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantClass  error
+		wantReason string
+	}{
+		{name: "success"},
+		{name: "auth error", err: errDenied, wantClass: util.ErrAuthFailed, wantReason: "auth error"},
+		{name: "timeout", err: context.DeadlineExceeded, wantClass: util.ErrTimeout, wantReason: "timeout"},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, wantReason: "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Result(nil, "1.0", tt.err, reason)
+			if result.Success != (tt.err == nil) || result.Attempts != 1 || result.ServerVersion != "1.0" {
+				t.Errorf("Result() = %+v, want success %v in one attempt", result, tt.err == nil)
+			}
+			if result.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", result.Reason, tt.wantReason)
+			}
+			if tt.wantClass != nil && !errors.Is(result.Err, tt.wantClass) {
+				t.Errorf("Err = %v, want it wrapped with %v", result.Err, tt.wantClass)
+			}
+			if tt.err != nil && !errors.Is(result.Err, tt.err) {
+				t.Errorf("Err = %v, want it to wrap %v", result.Err, tt.err)
+			}
+		})
+	}
+}
+
+type pipeDialer struct{ server net.Conn }
+
+func (d *pipeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	client, server := net.Pipe()
+	d.server = server
+	return client, nil
+}
+
+func TestDialAppliesDeadline(t *testing.T) {
+	dialer := &pipeDialer{}
+	o := New(time.Second, []Option{WithDialer(dialer), WithTimeout(time.Minute)})
+	if o.Timeout != time.Minute {
+		t.Errorf("Timeout = %v, want the one of WithTimeout", o.Timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conn, err := o.Dial(ctx, "tcp", "db:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer dialer.server.Close()
+
+	// Nothing is written to the pipe, so only the deadline ends the read.
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Read() = %v, want a timeout from the deadline of ctx", err)
+	}
+}
@@ -0,0 +1,270 @@
+package checker
+
+import (
+	"context"
+
+	"github.com/tapclap/db-connect-checker/pkg/arangocheck"
+	"github.com/tapclap/db-connect-checker/pkg/bigquerycheck"
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/dynamocheck"
+	"github.com/tapclap/db-connect-checker/pkg/escheck"
+	"github.com/tapclap/db-connect-checker/pkg/firestorecheck"
+	"github.com/tapclap/db-connect-checker/pkg/imapcheck"
+	"github.com/tapclap/db-connect-checker/pkg/kafkacheck"
+	"github.com/tapclap/db-connect-checker/pkg/mockcheck"
+	"github.com/tapclap/db-connect-checker/pkg/mongocheck"
+	"github.com/tapclap/db-connect-checker/pkg/mysqlcheck"
+	"github.com/tapclap/db-connect-checker/pkg/redischeck"
+	"github.com/tapclap/db-connect-checker/pkg/sftpcheck"
+	"github.com/tapclap/db-connect-checker/pkg/smtpcheck"
+	"github.com/tapclap/db-connect-checker/pkg/snowflakecheck"
+	"github.com/tapclap/db-connect-checker/pkg/spannercheck"
+	"github.com/tapclap/db-connect-checker/pkg/trinocheck"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+func init() {
+	Register(Funcs{Type: "mysql", Run: checkMysql, Reason: mysqlcheck.ErrorReason, Retry: mysqlcheck.Retryable})
+	// MongoDB targets have an exporter of their own, metrics.MultiMongoExporter.
+	Register(Funcs{Type: "mongodb", Run: checkMongo, Reason: mongocheck.ErrorReason, Retry: mongocheck.Retryable, NotExported: true})
+	Register(Funcs{
+		Type:   "mock",
+		Run:    checkMock,
+		Reason: mockcheck.ErrorReason,
+		Retry:  mockcheck.Retryable,
+		Read:   func(types.Settings) []EnvConfig { return envConfigs(util.GetAllMockConfigsFromEnvs()) },
+		Validate: func(types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateMockEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "snowflake",
+		Run:    checkWith(snowflakecheck.Check),
+		Reason: snowflakecheck.ErrorReason,
+		Retry:  snowflakecheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllSnowflakeConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateSnowflakeEnvs())
+		},
+		// A check every CHECK_INTERVAL would keep the warehouse running.
+		NotExported: true,
+	})
+	Register(Funcs{
+		Type:   "bigquery",
+		Run:    checkWith(bigquerycheck.Check),
+		Reason: bigquerycheck.ErrorReason,
+		Retry:  bigquerycheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllBigQueryConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateBigQueryEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "dynamodb",
+		Run:    checkWith(dynamocheck.Check),
+		Reason: dynamocheck.ErrorReason,
+		Retry:  dynamocheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllDynamoDBConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateDynamoDBEnvs(dynamocheck.ValidateKey))
+		},
+	})
+	Register(Funcs{
+		Type:   "arangodb",
+		Run:    checkWith(arangocheck.Check),
+		Reason: arangocheck.ErrorReason,
+		Retry:  arangocheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllArangoDBConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateArangoDBEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "spanner",
+		Run:    checkWith(spannercheck.Check),
+		Reason: spannercheck.ErrorReason,
+		Retry:  spannercheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllSpannerConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateSpannerEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "firestore",
+		Run:    checkWith(firestorecheck.Check),
+		Reason: firestorecheck.ErrorReason,
+		Retry:  firestorecheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllFirestoreConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateFirestoreEnvs(firestorecheck.ValidatePaths))
+		},
+	})
+	Register(Funcs{
+		Type:   "trino",
+		Run:    checkWith(trinocheck.Check),
+		Reason: trinocheck.ErrorReason,
+		Retry:  trinocheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllTrinoConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateTrinoEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "redis",
+		Run:    checkWith(redischeck.Check),
+		Reason: redischeck.ErrorReason,
+		Retry:  redischeck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllRedisConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateRedisEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "smtp",
+		Run:    checkWith(smtpcheck.Check),
+		Reason: smtpcheck.ErrorReason,
+		Retry:  smtpcheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllSMTPConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateSMTPEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "imap",
+		Run:    checkWith(imapcheck.Check),
+		Reason: imapcheck.ErrorReason,
+		Retry:  imapcheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllIMAPConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateIMAPEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "sftp",
+		Run:    checkWith(sftpcheck.Check),
+		Reason: sftpcheck.ErrorReason,
+		Retry:  sftpcheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllSFTPConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateSFTPEnvs())
+		},
+	})
+	Register(Funcs{
+		Type:   "kafka",
+		Run:    checkWith(kafkacheck.Check),
+		Reason: kafkacheck.ErrorReason,
+		Retry:  kafkacheck.Retryable,
+		Read: func(settings types.Settings) []EnvConfig {
+			return envConfigs(util.GetAllKafkaConfigsFromEnvs(util.ListsDBType(settings, "kafka")))
+		},
+		Validate: func(settings types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateKafkaEnvs(util.ListsDBType(settings, "kafka")))
+		},
+	})
+	Register(Funcs{
+		Type:   "elasticsearch",
+		Run:    checkWith(escheck.Check),
+		Reason: escheck.ErrorReason,
+		Retry:  escheck.Retryable,
+		Read:   func(_ types.Settings) []EnvConfig { return envConfigs(util.GetAllElasticsearchConfigsFromEnvs()) },
+		Validate: func(_ types.Settings) ([]EnvConfig, []error) {
+			return validatedEnvConfigs(util.ValidateElasticsearchEnvs())
+		},
+	})
+}
+
+func checkMysql(ctx context.Context, target types.Target, opts Options) types.Result {
+	var mysqlOpts []mysqlcheck.Option
+	if opts.Dialer != nil {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithDialer(opts.Dialer))
+	}
+	if opts.Timeout > 0 {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithTimeout(opts.Timeout))
+	}
+	if opts.ConnectTimeout > 0 {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithConnectTimeout(opts.ConnectTimeout))
+	}
+	if opts.QueryTimeout > 0 {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithQueryTimeout(opts.QueryTimeout))
+	}
+	if opts.MaxClockSkew > 0 {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithClockSkew(opts.MaxClockSkew))
+	}
+	if opts.MinFreeSpace > 0 || opts.Tablespace {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithTablespace(opts.MinFreeSpace))
+	}
+	if opts.LongQueryThreshold > 0 {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithSessions(opts.LongQueryThreshold))
+	}
+	if opts.MaxThreadsConnected > 0 || opts.MaxThreadsRunning > 0 || opts.Threads {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithThreads(opts.MaxThreadsConnected, opts.MaxThreadsRunning))
+	}
+	if opts.MaxFlowControlPaused > 0 || opts.FlowControl {
+		mysqlOpts = append(mysqlOpts, mysqlcheck.WithFlowControl(opts.MaxFlowControlPaused))
+	}
+	if opts.Unavailable {
+		// A reachable server with other variables is still reachable.
+		target.ExpectVariables = nil
+	}
+	return mysqlcheck.Check(ctx, target, mysqlOpts...)
+}
+
+func checkMongo(ctx context.Context, target types.Target, opts Options) types.Result {
+	var mongoOpts []mongocheck.Option
+	if opts.Dialer != nil {
+		mongoOpts = append(mongoOpts, mongocheck.WithDialer(opts.Dialer))
+	}
+	if opts.Timeout > 0 {
+		mongoOpts = append(mongoOpts, mongocheck.WithTimeout(opts.Timeout))
+	}
+	if opts.ConnectTimeout > 0 {
+		mongoOpts = append(mongoOpts, mongocheck.WithConnectTimeout(opts.ConnectTimeout))
+	}
+	if opts.QueryTimeout > 0 {
+		mongoOpts = append(mongoOpts, mongocheck.WithQueryTimeout(opts.QueryTimeout))
+	}
+	if opts.MaxClockSkew > 0 {
+		mongoOpts = append(mongoOpts, mongocheck.WithClockSkew(opts.MaxClockSkew))
+	}
+	return mongocheck.Check(ctx, target, mongoOpts...)
+}
+
+func checkMock(ctx context.Context, target types.Target, opts Options) types.Result {
+	// Mock targets do not dial.
+	var mockOpts []mockcheck.Option
+	if opts.MaxClockSkew > 0 {
+		mockOpts = append(mockOpts, mockcheck.WithClockSkew(opts.MaxClockSkew))
+	}
+	return mockcheck.Check(ctx, target, mockOpts...)
+}
+
+// checkWith runs the Check of a package built on checkbase with the
+// dialer and timeout of opts.
+func checkWith(check func(context.Context, types.Target, ...checkbase.Option) types.Result) func(context.Context, types.Target, Options) types.Result {
+	return func(ctx context.Context, target types.Target, opts Options) types.Result {
+		var checkOpts []checkbase.Option
+		if opts.Dialer != nil {
+			checkOpts = append(checkOpts, checkbase.WithDialer(opts.Dialer))
+		}
+		if opts.Timeout > 0 {
+			checkOpts = append(checkOpts, checkbase.WithTimeout(opts.Timeout))
+		}
+		return check(ctx, target, checkOpts...)
+	}
+}
+
+// envConfigs returns configs as EnvConfigs.
+func envConfigs[T EnvConfig](configs []T) []EnvConfig {
+	converted := make([]EnvConfig, len(configs))
+	for i, config := range configs {
+		converted[i] = config
+	}
+	return converted
+}
+
+// validatedEnvConfigs returns the configs and errors of a validation as
+// EnvConfigs.
+func validatedEnvConfigs[T EnvConfig](configs []T, errs []error) ([]EnvConfig, []error) {
+	return envConfigs(configs), errs
+}
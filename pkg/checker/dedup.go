@@ -0,0 +1,89 @@
+package checker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Key identifies the connection a check of target makes. Targets with the
+// same Key are the same database configured twice, e.g. in the environment
+// and in a config file or as "DB.internal" and "db.internal.", and one
+// check answers for all of them. Host names are compared case-insensitively
+// without a trailing dot and regardless of the order of a host list; the
+// schedule, the labels, the severity and where the credentials were read
+// from do not matter.
+func Key(target types.Target) string {
+	target.Host = canonicalHosts(target.Host)
+	target.Schedule, target.CredentialsFile = "", ""
+	target.Labels, target.Severity = nil, ""
+	// The TLS config is loaded from TLSCAFile, which is compared instead.
+	target.TLSConfig = nil
+	return fmt.Sprintf("%#v", target)
+}
+
+func canonicalHosts(hosts string) string {
+	list := strings.Split(hosts, ",")
+	for i, host := range list {
+		list[i] = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// Group splits targets into groups with the same Key, in the order their
+// first target appears in targets.
+func Group(targets []types.Target) [][]types.Target {
+	groups := [][]types.Target{}
+	index := map[string]int{}
+	for _, target := range targets {
+		key := Key(target)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], target)
+	}
+	return groups
+}
+
+// Shared lets targets with the same Key checked together share one check:
+// the first Do for a Key runs its check, the others wait for it and get the
+// same result. Use a new Shared for every round of checks; the zero value
+// is ready to use.
+type Shared struct {
+	mu    sync.Mutex
+	calls map[string]*sharedCall
+}
+
+type sharedCall struct {
+	done   chan struct{}
+	result types.Result
+}
+
+// Do returns the result of check, or of the check another target with the
+// same Key as target is running or has run through s.
+func (s *Shared) Do(target types.Target, check func() types.Result) types.Result {
+	key := Key(target)
+	s.mu.Lock()
+	if s.calls == nil {
+		s.calls = map[string]*sharedCall{}
+	}
+	if call, ok := s.calls[key]; ok {
+		s.mu.Unlock()
+		<-call.done
+		return call.result
+	}
+	call := &sharedCall{done: make(chan struct{})}
+	s.calls[key] = call
+	s.mu.Unlock()
+
+	call.result = check()
+	close(call.done)
+	return call.result
+}
@@ -0,0 +1,98 @@
+package checker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestKey(t *testing.T) {
+	target := types.Target{Type: "mysql", Host: "DB.internal", Port: "3306", Database: "orders", User: "app", Pass: "secret"}
+	same := func(change func(*types.Target)) types.Target {
+		other := target
+		change(&other)
+		return other
+	}
+
+	tests := []struct {
+		name  string
+		other types.Target
+		want  bool
+	}{
+		{"host case and trailing dot", same(func(t *types.Target) { t.Host = "db.internal." }), true},
+		{"schedule", same(func(t *types.Target) { t.Schedule = "*/5 * * * *" }), true},
+		{"credentials file", same(func(t *types.Target) { t.CredentialsFile = "/etc/db/orders" }), true},
+		{"port", same(func(t *types.Target) { t.Port = "3307" }), false},
+		{"user", same(func(t *types.Target) { t.User = "reader" }), false},
+		{"type", same(func(t *types.Target) { t.Type = "mock" }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Key(target) == Key(tt.other); got != tt.want {
+				t.Errorf("Key(%s) == Key(%s) is %v, want %v", target, tt.other, got, tt.want)
+			}
+		})
+	}
+
+	hosts := types.Target{Type: "mongodb", Host: "mongo-0:27017,mongo-1:27017"}
+	reordered := types.Target{Type: "mongodb", Host: "mongo-1:27017, mongo-0:27017"}
+	if Key(hosts) != Key(reordered) {
+		t.Errorf("Key() differs for the same hosts in another order")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	a := types.Target{Type: "mysql", Host: "a", Port: "3306", Database: "app"}
+	b := types.Target{Type: "mysql", Host: "b", Port: "3306", Database: "app"}
+	alias := a
+	alias.Host = "A"
+
+	groups := Group([]types.Target{a, b, alias})
+	if len(groups) != 2 || len(groups[0]) != 2 || groups[0][1].Host != "A" || len(groups[1]) != 1 || groups[1][0].Host != "b" {
+		t.Errorf("Group() = %v, want [[a A] [b]]", groups)
+	}
+}
+
+func TestShared(t *testing.T) {
+	target := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app"}
+	alias := target
+	alias.Host = "DB."
+	other := target
+	other.Database = "reports"
+
+	var shared Shared
+	var checks atomic.Int32
+	check := func() types.Result {
+		checks.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return types.Result{Success: true, Attempts: 1}
+	}
+
+	var wg sync.WaitGroup
+	results := make([]types.Result, 3)
+	for i, target := range []types.Target{target, alias, other} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = shared.Do(target, check)
+		}()
+	}
+	wg.Wait()
+
+	if checks.Load() != 2 {
+		t.Errorf("checked %d times, want once for db and once for reports", checks.Load())
+	}
+	for i, result := range results {
+		if !result.Success {
+			t.Errorf("result %d = %+v, want success", i, result)
+		}
+	}
+	// Later calls in the same round reuse the result.
+	shared.Do(alias, check)
+	if checks.Load() != 2 {
+		t.Errorf("checked %d times after the round, want 2", checks.Load())
+	}
+}
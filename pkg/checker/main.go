@@ -0,0 +1,215 @@
+// Package checker is the engine behind the db-connect-checker binary in a
+// form other programs can embed: it waits for a set of databases, or keeps
+// watching them, and passes every check result to sinks.
+package checker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/readiness"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/wait"
+)
+
+// Sink receives the result of every single check, e.g. to record metrics,
+// write logs or send notifications.
+type Sink interface {
+	Observe(ctx context.Context, target types.Target, result types.Result)
+}
+
+// SinkFunc adapts a function to Sink.
+type SinkFunc func(ctx context.Context, target types.Target, result types.Result)
+
+func (f SinkFunc) Observe(ctx context.Context, target types.Target, result types.Result) {
+	f(ctx, target, result)
+}
+
+// Runner checks Targets with the checker registered for their Type.
+// Targets with the same Key are checked once.
+type Runner struct {
+	Targets []types.Target
+	// Backoff is the sleep between attempts of one target in Run.
+	Backoff retry.Backoff
+	// Budget is the total time Run waits, zero waits until ctx is done.
+	Budget time.Duration
+	// ProgressInterval is how often Run logs the still failing targets.
+	ProgressInterval time.Duration
+	// Any makes Run succeed once one target of every type is available.
+	Any bool
+	// Unavailable makes Run wait until all targets are unreachable.
+	Unavailable bool
+	// Interval is the time between rounds of Serve.
+	Interval time.Duration
+	// Reporter receives the combined result of every round of Serve.
+	Reporter readiness.Reporter
+	Sinks    []Sink
+	// Clock measures the budget and the backoff sleeps of Run, clock.Real
+	// if nil.
+	Clock clock.Clock
+	// Dialer opens the connections of every check instead of the drivers'
+	// TCP dialers when set.
+	Dialer Dialer
+	// AttemptTimeout, if positive, limits every single check, connecting
+	// included, instead of the default of its checker. Budget and Backoff
+	// apply on top of it.
+	AttemptTimeout time.Duration
+	// ConnectTimeout and QueryTimeout, if positive, limit connecting and the
+	// queries after it in every check of a MySQL or MongoDB target.
+	ConnectTimeout, QueryTimeout time.Duration
+	// MaxClockSkew, if positive, fails checks of targets whose server clock
+	// differs from the local one by more than that. It is ignored with
+	// Unavailable.
+	MaxClockSkew time.Duration
+	// MinFreeSpace, if positive, fails checks of MySQL targets with less
+	// free space in their tablespaces than that percentage. It is ignored
+	// with Unavailable.
+	MinFreeSpace float64
+	// MaxThreadsConnected and MaxThreadsRunning, if positive, fail checks of
+	// MySQL targets with more threads. They are ignored with Unavailable.
+	MaxThreadsConnected, MaxThreadsRunning int
+	// MaxFlowControlPaused, if positive, fails checks of Percona XtraDB
+	// Cluster targets paused by flow control for more than that fraction of
+	// the time. It is ignored with Unavailable.
+	MaxFlowControlPaused float64
+}
+
+// Dialer opens network connections; *net.Dialer implements it. It is the
+// Dialer of every check package.
+type Dialer = checkbase.Dialer
+
+// Run retries every target until all of them are available (or, with
+// Unavailable, unreachable) and returns nil, or returns an error once the
+// budget is exhausted. A non-retryable error ends the wait early with a
+// retry.Permanent error.
+func (r *Runner) Run(ctx context.Context) error {
+	return wait.ForAll(ctx, r.waitTargets(ctx, r.Unavailable), wait.Options{
+		Budget:           r.Budget,
+		ProgressInterval: r.ProgressInterval,
+		Backoff:          r.Backoff,
+		Any:              r.Any,
+		Clock:            r.Clock,
+	})
+}
+
+// Serve checks all targets every Interval and passes the combined result of
+// each round to Reporter until ctx is cancelled.
+func (r *Runner) Serve(ctx context.Context) {
+	reporter := r.Reporter
+	if reporter == nil {
+		reporter = readiness.Reporters{}
+	}
+	readiness.Run(ctx, r.waitTargets(ctx, false), r.Interval, reporter)
+}
+
+// waitTargets returns one wait target for every Group of r.Targets: the
+// first target of a group is checked and the sinks get the result for each
+// of them.
+func (r *Runner) waitTargets(ctx context.Context, unavailable bool) []wait.Target {
+	groups := Group(r.Targets)
+	targets := make([]wait.Target, 0, len(groups))
+	for _, group := range groups {
+		target := group[0]
+		waitTarget := wait.Target{
+			Name:  target.String(),
+			Group: target.Type,
+			Log:   log.Target(target),
+			Check: func() error {
+				result := r.Check(ctx, target)
+				for _, warning := range result.Warnings {
+					log.Warn(warning, log.Target(target))
+				}
+				for _, alias := range group {
+					for _, sink := range r.Sinks {
+						sink.Observe(ctx, alias, result)
+					}
+				}
+				return result.Err
+			},
+			Reason:    reasonFunc(target.Type),
+			Retryable: retryableFunc(target.Type),
+		}
+		if unavailable {
+			waitTarget.Check = wait.Unavailable(waitTarget.Check)
+			waitTarget.Reason = func(error) string { return "still reachable" }
+			waitTarget.Retryable = nil
+		}
+		targets = append(targets, waitTarget)
+	}
+	return targets
+}
+
+// Check runs one check of target with the checker registered for its type,
+// using the Dialer, AttemptTimeout, ConnectTimeout, QueryTimeout,
+// MaxClockSkew, MinFreeSpace, thread and flow control limits of r. Clock,
+// server variables, free space, threads and flow control are not checked
+// with Unavailable.
+func (r *Runner) Check(ctx context.Context, target types.Target) types.Result {
+	opts := Options{Dialer: r.Dialer, Unavailable: r.Unavailable, Timeout: r.AttemptTimeout, ConnectTimeout: r.ConnectTimeout, QueryTimeout: r.QueryTimeout}
+	if !r.Unavailable {
+		opts.MaxClockSkew = r.MaxClockSkew
+		opts.MinFreeSpace = r.MinFreeSpace
+		opts.MaxThreadsConnected, opts.MaxThreadsRunning = r.MaxThreadsConnected, r.MaxThreadsRunning
+		opts.MaxFlowControlPaused = r.MaxFlowControlPaused
+	}
+	return CheckWith(ctx, target, opts)
+}
+
+// Check runs one check of target with the checker registered for its type.
+func Check(ctx context.Context, target types.Target) types.Result {
+	return CheckWith(ctx, target, Options{})
+}
+
+// CheckWith runs one check of target with the checker registered for its
+// type and opts. The Timeout, ConnectTimeout and QueryTimeout of target
+// replace those of opts.
+func CheckWith(ctx context.Context, target types.Target, opts Options) types.Result {
+	if target.Timeout > 0 {
+		opts.Timeout = target.Timeout
+	}
+	if target.ConnectTimeout > 0 {
+		opts.ConnectTimeout = target.ConnectTimeout
+	}
+	if target.QueryTimeout > 0 {
+		opts.QueryTimeout = target.QueryTimeout
+	}
+	c, ok := Lookup(target.Type)
+	if !ok {
+		return types.Result{
+			Attempts: 1,
+			Reason:   "invalid config",
+			Err:      retry.Permanent(fmt.Errorf("unsupported database type %q", target.Type)),
+		}
+	}
+	return c.Check(ctx, target, opts)
+}
+
+// ErrorReason returns the short class of a check error of target, e.g.
+// "auth error", as reported by the checker for its type.
+func ErrorReason(target types.Target, err error) string {
+	return reasonFunc(target.Type)(err)
+}
+
+// Retryable reports whether another check of target may succeed after err.
+func Retryable(target types.Target, err error) bool {
+	return retryableFunc(target.Type)(err)
+}
+
+func reasonFunc(targetType string) func(error) string {
+	if c, ok := Lookup(targetType); ok {
+		return c.ErrorReason
+	}
+	return func(error) string { return "invalid config" }
+}
+
+func retryableFunc(targetType string) func(error) bool {
+	if c, ok := Lookup(targetType); ok {
+		return c.Retryable
+	}
+	return func(error) bool { return false }
+}
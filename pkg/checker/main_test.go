@@ -0,0 +1,253 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/readiness"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Nothing listens on port 1, so checks fail with connection refused.
+var refusedTarget = types.Target{Type: "mysql", Host: "127.0.0.1", Port: "1", Database: "app", User: "app", Pass: "app"}
+
+type recordingSink struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+func (s *recordingSink) Observe(ctx context.Context, target types.Target, result types.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reasons = append(s.reasons, target.String()+": "+result.Reason)
+}
+
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		runner        Runner
+		wantErr       bool
+		wantPermanent bool
+		wantReason    string
+	}{
+		{
+			name:          "unsupported type is not retried",
+			runner:        Runner{Targets: []types.Target{{Type: "postgres", Host: "db", Port: "5432", Database: "app"}}},
+			wantErr:       true,
+			wantPermanent: true,
+			wantReason:    "postgres db:5432/app: invalid config",
+		},
+		{
+			name:       "mock target is available",
+			runner:     Runner{Targets: []types.Target{types.MockConfig{Name: "smoke", Result: "success"}.Target()}},
+			wantReason: "mock mock/smoke: ",
+		},
+		{
+			name:          "mock auth error is not retried",
+			runner:        Runner{Targets: []types.Target{types.MockConfig{Name: "smoke", Result: "failure", Reason: "auth error"}.Target()}},
+			wantErr:       true,
+			wantPermanent: true,
+			wantReason:    "mock mock/smoke: auth error",
+		},
+		{
+			name:       "wait for unavailable",
+			runner:     Runner{Targets: []types.Target{refusedTarget}, Unavailable: true},
+			wantReason: "mysql 127.0.0.1:1/app: connection refused",
+		},
+		{
+			name: "budget exhausted",
+			runner: Runner{
+				Targets: []types.Target{refusedTarget},
+				Budget:  300 * time.Millisecond,
+				Backoff: retry.Backoff{Initial: 100 * time.Millisecond},
+			},
+			wantErr:    true,
+			wantReason: "mysql 127.0.0.1:1/app: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			tt.runner.Sinks = []Sink{sink}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := tt.runner.Run(ctx)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if retry.IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("Run() error = %v, want permanent: %v", err, tt.wantPermanent)
+			}
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			if len(sink.reasons) == 0 || sink.reasons[0] != tt.wantReason {
+				t.Errorf("sink observed %v, want first %q", sink.reasons, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRunnerChecksIdenticalTargetsOnce(t *testing.T) {
+	checks := 0
+	Register(Funcs{
+		Type: "counted",
+		Run: func(ctx context.Context, target types.Target, opts Options) types.Result {
+			checks++
+			return types.Result{Success: true, Attempts: 1}
+		},
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "counted")
+		registryMu.Unlock()
+	}()
+
+	target := types.Target{Type: "counted", Host: "db.internal", Port: "1", Database: "app"}
+	alias := target
+	alias.Host = "DB.internal."
+	sink := &recordingSink{}
+	runner := Runner{Targets: []types.Target{target, alias}, Sinks: []Sink{sink}}
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if checks != 1 {
+		t.Errorf("checked %d times, want once", checks)
+	}
+	want := []string{"counted db.internal:1/app: ", "counted DB.internal.:1/app: "}
+	if !slices.Equal(sink.reasons, want) {
+		t.Errorf("sink observed %v, want %v", sink.reasons, want)
+	}
+}
+
+func TestRunnerServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var results []readiness.Result
+	runner := Runner{
+		Targets:  []types.Target{refusedTarget},
+		Interval: time.Hour,
+		Reporter: readiness.ReporterFunc(func(ctx context.Context, result readiness.Result) error {
+			results = append(results, result)
+			cancel()
+			return nil
+		}),
+	}
+	runner.Serve(ctx)
+
+	if len(results) != 1 || results[0].Ready || results[0].Failing["mysql 127.0.0.1:1/app"] != "connection refused" {
+		t.Errorf("Serve() reported %+v, want one round with the target failing", results)
+	}
+}
+
+func TestRunnerAttemptTimeout(t *testing.T) {
+	// The server accepts connections but never sends the MySQL handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	target := types.Target{Type: "mysql", Host: host, Port: port, Database: "app", User: "app", Pass: "app"}
+	runner := Runner{AttemptTimeout: 200 * time.Millisecond}
+	start := time.Now()
+	result := runner.Check(context.Background(), target)
+	if result.Reason != "timeout" {
+		t.Errorf("Check() = %v (%q), want timeout", result.Err, result.Reason)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Check() took %v, want about the attempt timeout", elapsed)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var got Options
+	Register(Funcs{
+		Type: "custom",
+		Run: func(ctx context.Context, target types.Target, opts Options) types.Result {
+			got = opts
+			return types.Result{Attempts: 1, Reason: "auth error", Err: errors.New("denied")}
+		},
+		Reason: func(error) string { return "auth error" },
+		Retry:  func(error) bool { return false },
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "custom")
+		registryMu.Unlock()
+	}()
+
+	if !slices.Contains(Types(), "custom") || !slices.Contains(Types(), "mysql") {
+		t.Errorf("Types() = %v, want custom and the built-in types", Types())
+	}
+	target := types.Target{Type: "custom", Host: "db", Port: "1", Database: "app"}
+	runner := Runner{Targets: []types.Target{target}, MaxClockSkew: time.Second}
+	err := runner.Run(context.Background())
+	if !retry.IsPermanent(err) || ErrorReason(target, err) != "auth error" {
+		t.Errorf("Run() = %v, want a permanent auth error", err)
+	}
+	if got.MaxClockSkew != time.Second {
+		t.Errorf("checker got options %+v, want the limits of the runner", got)
+	}
+
+	runner.Unavailable = true
+	runner.Check(context.Background(), target)
+	if !got.Unavailable || got.MaxClockSkew != 0 {
+		t.Errorf("checker got options %+v, want no limits with Unavailable", got)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("TARGET_TYPE_0", "mock")
+	t.Setenv("MOCK_NAME_0", "smoke")
+	t.Setenv("TARGET_TYPE_1", "mock")
+	t.Setenv("MOCK_RESULT_1", "failure")
+
+	configs := FromEnv(types.Settings{})
+	if len(configs["mock"]) != 1 || configs["mock"][0].Target().Database != "smoke" {
+		t.Errorf("FromEnv()[mock] = %v, want the smoke target", configs["mock"])
+	}
+	if _, ok := configs["mysql"]; ok {
+		t.Errorf("FromEnv() has mysql configs, want them read by the caller")
+	}
+
+	configs, errs := ValidateEnv(types.Settings{})
+	if len(configs["mock"]) != 1 || len(errs["mock"]) != 1 {
+		t.Errorf("ValidateEnv()[mock] = %v, %v, want one config and one error", configs["mock"], errs["mock"])
+	}
+}
+
+func TestExported(t *testing.T) {
+	for targetType, want := range map[string]bool{
+		"mysql":         true,
+		"mock":          true,
+		"elasticsearch": true,
+		"redis":         true,
+		"mongodb":       false,
+		"snowflake":     false,
+		"unknown":       false,
+	} {
+		if got := Exported(targetType); got != want {
+			t.Errorf("Exported(%q) = %v, want %v", targetType, got, want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package checker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Checker checks the targets of one database type. Runner, Check,
+// ErrorReason and Retryable find it by the Type of the target, see Register.
+type Checker interface {
+	// Name is the database type, e.g. "mysql".
+	Name() string
+	// Check runs one check of target. Checkers ignore the options that do
+	// not apply to their database type.
+	Check(ctx context.Context, target types.Target, opts Options) types.Result
+	// ErrorReason returns the short class of a check error, e.g.
+	// "auth error".
+	ErrorReason(err error) string
+	// Retryable reports whether another check may succeed after err.
+	Retryable(err error) bool
+}
+
+// Options are the settings of a Runner passed to every check. The limits
+// are zero with Unavailable.
+type Options struct {
+	// Dialer opens the connections of the check instead of the driver's
+	// TCP dialer when set.
+	Dialer Dialer
+	// Unavailable is set when the check only has to tell whether the
+	// target is reachable.
+	Unavailable bool
+	// Timeout, if positive, limits the check instead of the default of the
+	// checker.
+	Timeout time.Duration
+	// ConnectTimeout and QueryTimeout, if positive, limit connecting and the
+	// queries after it, for checkers with these phases.
+	ConnectTimeout, QueryTimeout time.Duration
+	// MaxClockSkew, MinFreeSpace, MaxThreadsConnected, MaxThreadsRunning
+	// and MaxFlowControlPaused are the limits of the same Runner fields.
+	MaxClockSkew                           time.Duration
+	MinFreeSpace                           float64
+	MaxThreadsConnected, MaxThreadsRunning int
+	MaxFlowControlPaused                   float64
+	// Tablespace, Threads and FlowControl make MySQL checks measure the
+	// tablespaces, threads and flow control for metrics even without a
+	// limit above; LongQueryThreshold, if positive, counts the queries
+	// running for that long and the sessions waiting for locks.
+	Tablespace, Threads, FlowControl bool
+	LongQueryThreshold               time.Duration
+}
+
+// EnvConfig is the config of one target read from environment variables,
+// e.g. types.RedisConfig.
+type EnvConfig interface {
+	Target() types.Target
+	// Summary describes the target for the validate command.
+	Summary() string
+}
+
+// EnvReader is implemented by the checkers of types configured by their own
+// environment variables, e.g. REDIS_*_N for TARGET_TYPE_N=redis. MySQL and
+// MongoDB are read with their targets directories and files instead.
+type EnvReader interface {
+	// FromEnv returns the configs of the targets of the type.
+	FromEnv(settings types.Settings) []EnvConfig
+	// ValidateEnv returns them like FromEnv, reporting every invalid
+	// variable.
+	ValidateEnv(settings types.Settings) ([]EnvConfig, []error)
+}
+
+// Funcs is a Checker made of the functions of a check package. With Read
+// and Validate set it is an EnvReader.
+type Funcs struct {
+	Type     string
+	Run      func(ctx context.Context, target types.Target, opts Options) types.Result
+	Reason   func(err error) string
+	Retry    func(err error) bool
+	Read     func(settings types.Settings) []EnvConfig
+	Validate func(settings types.Settings) ([]EnvConfig, []error)
+	// NotExported keeps the exporter from checking targets of the type on
+	// its schedule, see Exported.
+	NotExported bool
+}
+
+func (f Funcs) Name() string { return f.Type }
+
+func (f Funcs) Check(ctx context.Context, target types.Target, opts Options) types.Result {
+	return f.Run(ctx, target, opts)
+}
+
+func (f Funcs) ErrorReason(err error) string { return f.Reason(err) }
+
+func (f Funcs) Retryable(err error) bool { return f.Retry(err) }
+
+func (f Funcs) FromEnv(settings types.Settings) []EnvConfig {
+	if f.Read == nil {
+		return nil
+	}
+	return f.Read(settings)
+}
+
+func (f Funcs) ValidateEnv(settings types.Settings) ([]EnvConfig, []error) {
+	if f.Validate == nil {
+		return nil, nil
+	}
+	return f.Validate(settings)
+}
+
+func (f Funcs) Exported() bool { return !f.NotExported }
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Checker{}
+)
+
+// Register makes c the checker of targets whose Type is c.Name(), replacing
+// the one registered before, if any. The built-in database types are
+// registered on start; programs embedding the package may add their own.
+func Register(c Checker) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[c.Name()] = c
+}
+
+// Lookup returns the checker registered for targetType.
+func Lookup(targetType string) (Checker, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := registry[targetType]
+	return c, ok
+}
+
+// Types returns the registered database types in alphabetical order.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Exported reports whether the exporter checks targets of targetType on its
+// schedule: the type is registered and its checker does not opt out with an
+// Exported method returning false, as Snowflake does, whose checks would
+// keep a warehouse running.
+func Exported(targetType string) bool {
+	c, ok := Lookup(targetType)
+	if !ok {
+		return false
+	}
+	if e, ok := c.(interface{ Exported() bool }); ok {
+		return e.Exported()
+	}
+	return true
+}
+
+// FromEnv returns the configs read from environment variables by every
+// registered EnvReader, by type.
+func FromEnv(settings types.Settings) map[string][]EnvConfig {
+	configs := map[string][]EnvConfig{}
+	for _, name := range Types() {
+		if r, ok := lookupEnvReader(name); ok {
+			configs[name] = r.FromEnv(settings)
+		}
+	}
+	return configs
+}
+
+// ValidateEnv returns the configs like FromEnv and the errors of every
+// EnvReader, by type.
+func ValidateEnv(settings types.Settings) (map[string][]EnvConfig, map[string][]error) {
+	configs, errs := map[string][]EnvConfig{}, map[string][]error{}
+	for _, name := range Types() {
+		if r, ok := lookupEnvReader(name); ok {
+			configs[name], errs[name] = r.ValidateEnv(settings)
+		}
+	}
+	return configs, errs
+}
+
+func lookupEnvReader(targetType string) (EnvReader, bool) {
+	c, ok := Lookup(targetType)
+	if f, isFuncs := c.(Funcs); !ok || isFuncs && f.Read == nil {
+		return nil, false
+	}
+	r, ok := c.(EnvReader)
+	return r, ok
+}
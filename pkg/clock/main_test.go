@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFake(start)
+
+	c := clock.After(10 * time.Second)
+	clock.Advance(9 * time.Second)
+	select {
+	case <-c:
+		t.Fatal("timer fired before it was due")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case at := <-c:
+		if !at.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("timer fired at %v, want %v", at, start.Add(10*time.Second))
+		}
+	default:
+		t.Fatal("timer did not fire when due")
+	}
+	if len(clock.Pending()) != 0 {
+		t.Errorf("Pending() = %v after the timer fired, want none", clock.Pending())
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	clock := NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ticker := clock.NewTicker(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		select {
+		case <-ticker.C():
+		default:
+			t.Fatalf("tick %d missing", i+1)
+		}
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Error("stopped ticker fired")
+	default:
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	clock := NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	done := make(chan struct{})
+	go func() {
+		<-clock.After(time.Hour)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	if pending := clock.Pending(); len(pending) != 1 || pending[0] != time.Hour {
+		t.Fatalf("Pending() = %v, want [1h]", pending)
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sleeping goroutine was not woken up")
+	}
+}
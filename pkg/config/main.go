@@ -0,0 +1,344 @@
+// Package config reads a config file (CONFIG_FILE or -config) describing
+// databases of any type the checker knows about, each with its own DSN,
+// TLS settings, timeout and tries:
+//
+//	targets:
+//	  - dsn: app:secret@tcp(orders-db:3306)/orders
+//	    tls: true
+//	    timeout: 5s
+//	    tries: 10
+//	    labels: {env: prod}
+//	  - type: mongodb
+//	    dsn: mongodb://events-db:27017/events
+//	  - type: redis
+//	    env: {REDIS_ADDR: "cache:6379"}
+//
+// env sets any variable of the type without the _N suffix, e.g. REDIS_DB.
+// JSON is accepted as well.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"sigs.k8s.io/yaml"
+
+	"github.com/tapclap/db-connect-checker/pkg/mongocheck"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// File is the content of a config file.
+type File struct {
+	Targets []Entry `json:"targets"`
+}
+
+// Entry is one database of a config file.
+type Entry struct {
+	// Type is one of the values of TARGET_TYPE, mysql if empty.
+	Type string `json:"type,omitempty"`
+	// DSN is a go-sql-driver/mysql DSN for mysql, e.g.
+	// "app:secret@tcp(orders-db:3306)/orders", or the URI for mongodb.
+	DSN string `json:"dsn,omitempty"`
+	// TLS and TLSCAFile set the TLS variables of the type, e.g. MYSQL_TLS
+	// and MYSQL_TLS_CA_FILE.
+	TLS       *bool  `json:"tls,omitempty"`
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+	// Timeout limits every check of the target instead of ATTEMPT_TIMEOUT.
+	Timeout Duration `json:"timeout,omitempty"`
+	// ConnectTimeout and QueryTimeout limit connecting and the queries
+	// after it instead of CONNECT_TIMEOUT and QUERY_TIMEOUT, for mysql and
+	// mongodb.
+	ConnectTimeout Duration `json:"connect_timeout,omitempty"`
+	QueryTimeout   Duration `json:"query_timeout,omitempty"`
+	// Tries replaces TRIES for the target in the one-shot mode.
+	Tries int `json:"tries,omitempty"`
+	// Labels describe the target for NOTIFY_ROUTES and notifications, e.g.
+	// {env: prod}.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Severity is critical, warning or info, see MYSQL_SEVERITY; it
+	// replaces MYSQL_SEVERITY in env.
+	Severity string `json:"severity,omitempty"`
+	// Env are further variables of the type without the _N suffix.
+	Env map[string]any `json:"env,omitempty"`
+}
+
+// Duration is a Go duration ("30s") or a number of seconds, see
+// util.ParseDuration.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	parsed, err := util.ParseDuration(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Config are the databases of a config file in the form the modes consume.
+type Config struct {
+	Mysql []types.MysqlConfig
+	// Targets are the databases of every other type, MongoDB included.
+	Targets []types.Target
+}
+
+// Types returns the database types the config has targets of.
+func (c Config) Types() map[string]bool {
+	found := map[string]bool{"mysql": len(c.Mysql) > 0}
+	for _, target := range c.Targets {
+		found[target.Type] = true
+	}
+	return found
+}
+
+// Load reads the config file path and loads the CA files of MySQL targets
+// using TLS.
+func Load(path string) (Config, error) {
+	config, errs := Validate(path)
+	if len(errs) > 0 {
+		return Config{}, errs[0]
+	}
+	for i := range config.Mysql {
+		if config.Mysql[i].TLS {
+			tlsConfig, err := util.LoadTLSConfig(config.Mysql[i].TLSCAFile)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s: %v", path, err)
+			}
+			config.Mysql[i].TLSConfig = tlsConfig
+		}
+	}
+	return config, nil
+}
+
+// readFile reads the config file path and its content.
+func readFile(path string) (File, []byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, nil, fmt.Errorf("reading config from %s: %v", path, err)
+	}
+	// JSON is YAML, so one parser takes both.
+	data, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return File{}, nil, fmt.Errorf("reading config from %s: %v", path, err)
+	}
+	var file File
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return File{}, nil, fmt.Errorf("reading config from %s: %v", path, err)
+	}
+	return file, content, nil
+}
+
+// Validate reads the config file path like Load, reporting every problem
+// found instead of stopping at the first one. The CA files are checked but
+// not loaded.
+func Validate(path string) (Config, []error) {
+	file, _, err := readFile(path)
+	if err != nil {
+		return Config{}, []error{err}
+	}
+
+	config := Config{Mysql: []types.MysqlConfig{}, Targets: []types.Target{}}
+	errs := []error{}
+	for i, entry := range file.Targets {
+		source := fmt.Sprintf("%s: targets[%d]", path, i)
+		targetType := entry.Type
+		if targetType == "" {
+			targetType = "mysql"
+		}
+		values, entryErrs := entry.values(source, targetType)
+		if entry.Tries < 0 {
+			entryErrs = append(entryErrs, fmt.Errorf("%s: tries must not be negative", source))
+		}
+		if entry.Severity != "" && !slices.Contains(types.Severities, entry.Severity) {
+			entryErrs = append(entryErrs, fmt.Errorf("%s: severity must be one of %s, got %q", source, strings.Join(types.Severities, ", "), entry.Severity))
+		}
+		if (entry.ConnectTimeout != 0 || entry.QueryTimeout != 0) && targetType != "mysql" && targetType != "mongodb" {
+			entryErrs = append(entryErrs, fmt.Errorf("%s: connect_timeout and query_timeout are only supported for mysql and mongodb", source))
+		}
+		if len(entryErrs) > 0 {
+			errs = append(errs, entryErrs...)
+			continue
+		}
+
+		switch targetType {
+		case "mysql":
+			mysqlConfig, mysqlErrs := util.MysqlConfigFromValues(source, values)
+			if len(mysqlErrs) > 0 {
+				errs = append(errs, mysqlErrs...)
+				continue
+			}
+			mysqlConfig.Timeout, mysqlConfig.Tries = time.Duration(entry.Timeout), entry.Tries
+			mysqlConfig.ConnectTimeout, mysqlConfig.QueryTimeout = time.Duration(entry.ConnectTimeout), time.Duration(entry.QueryTimeout)
+			mysqlConfig.Labels = entry.Labels
+			if entry.Severity != "" {
+				mysqlConfig.Severity = entry.Severity
+			}
+			config.Mysql = append(config.Mysql, mysqlConfig)
+		case "mongodb":
+			uri := values["MONGODB_URI"]
+			if uri == "" {
+				errs = append(errs, fmt.Errorf("%s: dsn or MONGODB_URI is required", source))
+				continue
+			}
+			if err := mongocheck.ValidateURI(uri); err != nil {
+				errs = append(errs, fmt.Errorf("%s: MONGODB_URI: %v", source, err))
+				continue
+			}
+			target, err := mongocheck.TargetFromURI(uri)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: MONGODB_URI: %v", source, err))
+				continue
+			}
+			if entry.TLS != nil {
+				target.TLS = *entry.TLS
+			}
+			target.TLSCAFile = entry.TLSCAFile
+			target.Timeout, target.Tries = time.Duration(entry.Timeout), entry.Tries
+			target.ConnectTimeout, target.QueryTimeout = time.Duration(entry.ConnectTimeout), time.Duration(entry.QueryTimeout)
+			target.Labels, target.Severity = entry.Labels, entry.Severity
+			config.Targets = append(config.Targets, target)
+		default:
+			target, targetErrs := util.TargetFromValues(source, targetType, values)
+			if len(targetErrs) > 0 {
+				errs = append(errs, targetErrs...)
+				continue
+			}
+			target.Timeout, target.Tries = time.Duration(entry.Timeout), entry.Tries
+			target.Labels, target.Severity = entry.Labels, entry.Severity
+			config.Targets = append(config.Targets, target)
+		}
+	}
+	return config, errs
+}
+
+// values returns the variables of the entry as read from a targets
+// directory: env, the fields of the DSN and the TLS variables of the type.
+func (e Entry) values(source, targetType string) (map[string]string, []error) {
+	fields := util.TargetFields(targetType)
+	if fields == nil {
+		return nil, []error{fmt.Errorf("%s: unsupported type %q", source, targetType)}
+	}
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.Env] = true
+	}
+
+	errs := []error{}
+	values := map[string]string{}
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("%s: env: unknown variable %s for type %s", source, name, targetType))
+			continue
+		}
+		// YAML reads ports and flags as numbers and booleans.
+		values[name] = fmt.Sprint(e.Env[name])
+	}
+
+	set := func(name, value string) {
+		if _, ok := values[name]; ok {
+			errs = append(errs, fmt.Errorf("%s: env: %s is already set by the entry", source, name))
+		}
+		values[name] = value
+	}
+	if e.DSN != "" {
+		switch targetType {
+		case "mysql":
+			dsnValues, err := mysqlValues(e.DSN)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: dsn: %v", source, err))
+				break
+			}
+			for _, name := range []string{"MYSQL_USER", "MYSQL_PASS", "MYSQL_HOST", "MYSQL_PORT", "MYSQL_NAME", "MYSQL_TLS"} {
+				if value, ok := dsnValues[name]; ok {
+					set(name, value)
+				}
+			}
+		case "mongodb":
+			set("MONGODB_URI", e.DSN)
+		default:
+			errs = append(errs, fmt.Errorf("%s: dsn is only supported for mysql and mongodb, set the variables of %s in env", source, targetType))
+		}
+	}
+
+	// MongoDB takes TLS from the target, not from a variable.
+	if targetType != "mongodb" && (e.TLS != nil || e.TLSCAFile != "") {
+		tlsName, caName := "", ""
+		for _, field := range fields {
+			switch {
+			case strings.HasSuffix(field.Env, "_TLS"):
+				tlsName = field.Env
+			case strings.HasSuffix(field.Env, "_TLS_CA_FILE"):
+				caName = field.Env
+			}
+		}
+		if e.TLS != nil && tlsName == "" || e.TLSCAFile != "" && caName == "" {
+			errs = append(errs, fmt.Errorf("%s: tls is not supported for type %s", source, targetType))
+		} else {
+			if e.TLS != nil {
+				set(tlsName, strconv.FormatBool(*e.TLS))
+			}
+			if e.TLSCAFile != "" {
+				set(caName, e.TLSCAFile)
+			}
+		}
+	}
+	return values, errs
+}
+
+// mysqlValues returns the MYSQL_* variables of a go-sql-driver/mysql DSN.
+// Only its tls parameter is used; server variables, which the driver keeps
+// in Params, are rejected as they would not be set.
+func mysqlValues(dsn string) (map[string]string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Net != "tcp" {
+		return nil, fmt.Errorf("unsupported network %q, only tcp is", cfg.Net)
+	}
+	if len(cfg.Params) > 0 {
+		params := make([]string, 0, len(cfg.Params))
+		for name := range cfg.Params {
+			params = append(params, name)
+		}
+		sort.Strings(params)
+		return nil, fmt.Errorf("unsupported parameters %s", strings.Join(params, ", "))
+	}
+	host, port, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{
+		"MYSQL_USER": cfg.User,
+		"MYSQL_PASS": cfg.Passwd,
+		"MYSQL_HOST": host,
+		"MYSQL_PORT": port,
+		"MYSQL_NAME": cfg.DBName,
+	}
+	if cfg.TLSConfig != "" && cfg.TLSConfig != "false" {
+		values["MYSQL_TLS"] = "true"
+	}
+	return values, nil
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `
+targets:
+  - dsn: app:secret@tcp(orders-db:3307)/orders
+    timeout: 3s
+    connect_timeout: 1s
+    tries: 10
+    labels: {env: prod, team: orders}
+  - type: mysql
+    env: {MYSQL_HOST: billing-db, MYSQL_NAME: billing, MYSQL_USER: app, MYSQL_PASS: secret, MYSQL_SEVERITY: warning}
+  - type: mongodb
+    dsn: mongodb://events-db:27017/events
+    tls: true
+    timeout: 15
+    query_timeout: 5s
+  - type: redis
+    tls: true
+    labels: {env: staging}
+    severity: info
+    env:
+      REDIS_ADDR: cache:6379
+      REDIS_DB: 2
+`)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(config.Mysql) != 2 {
+		t.Fatalf("Mysql = %+v, want 2 targets", config.Mysql)
+	}
+	orders := config.Mysql[0]
+	if orders.Host != "orders-db" || orders.Port != "3307" || orders.Name != "orders" || orders.User != "app" || orders.Pass != "secret" {
+		t.Errorf("Mysql[0] = %+v, want app:secret@orders-db:3307/orders", orders)
+	}
+	if orders.Timeout != 3*time.Second || orders.Tries != 10 {
+		t.Errorf("Mysql[0] timeout, tries = %v, %d, want 3s, 10", orders.Timeout, orders.Tries)
+	}
+	if target := orders.Target(); target.Timeout != 3*time.Second || target.ConnectTimeout != time.Second || target.Tries != 10 {
+		t.Errorf("Mysql[0].Target() timeout, connect timeout, tries = %v, %v, %d, want 3s, 1s, 10", target.Timeout, target.ConnectTimeout, target.Tries)
+	}
+	if labels := orders.Target().Labels; labels["env"] != "prod" || labels["team"] != "orders" {
+		t.Errorf("Mysql[0].Target() labels = %v, want env=prod and team=orders", labels)
+	}
+	if billing := config.Mysql[1]; billing.Host != "billing-db" || billing.Port != "3306" || billing.Timeout != 0 || billing.Labels != nil {
+		t.Errorf("Mysql[1] = %+v, want billing-db:3306 without a timeout and labels", billing)
+	}
+	if orders.Severity != "critical" || config.Mysql[1].Severity != "warning" {
+		t.Errorf("Mysql severities = %q, %q, want critical by default and warning from MYSQL_SEVERITY", orders.Severity, config.Mysql[1].Severity)
+	}
+
+	if len(config.Targets) != 2 {
+		t.Fatalf("Targets = %+v, want 2 targets", config.Targets)
+	}
+	mongo := config.Targets[0]
+	if mongo.Type != "mongodb" || mongo.Host != "events-db:27017" || mongo.Database != "events" || !mongo.TLS || mongo.Timeout != 15*time.Second || mongo.QueryTimeout != 5*time.Second {
+		t.Errorf("Targets[0] = %+v, want mongodb events-db:27017/events with TLS, a 15s timeout and a 5s query timeout", mongo)
+	}
+	redis := config.Targets[1]
+	if redis.Type != "redis" || redis.Address() != "cache:6379" || redis.Database != "2" || !redis.TLS || redis.Labels["env"] != "staging" || redis.Severity != "info" {
+		t.Errorf("Targets[1] = %+v, want redis cache:6379/2 with TLS, env=staging and severity info", redis)
+	}
+
+	types := config.Types()
+	for _, name := range []string{"mysql", "mongodb", "redis"} {
+		if !types[name] {
+			t.Errorf("Types()[%q] = false, want true", name)
+		}
+	}
+	if types["sftp"] {
+		t.Errorf("Types()[%q] = true, want false", "sftp")
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeConfig(t, `{"targets": [{"type": "mock", "env": {"MOCK_NAME": "payments"}, "tries": 1}]}`)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(config.Targets) != 1 || config.Targets[0].Type != "mock" || config.Targets[0].Database != "payments" || config.Targets[0].Tries != 1 {
+		t.Errorf("Targets = %+v, want the mock target payments with 1 try", config.Targets)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown field",
+			content: "targets:\n  - dsn: app:secret@tcp(db)/orders\n    retries: 3\n",
+			wantErr: `unknown field "retries"`,
+		},
+		{
+			name:    "unknown type",
+			content: "targets:\n  - type: oracle\n",
+			wantErr: `targets[0]: unsupported type "oracle"`,
+		},
+		{
+			name:    "unknown variable",
+			content: "targets:\n  - type: redis\n    env: {REDIS_ADDR: cache, MYSQL_HOST: db}\n",
+			wantErr: "env: unknown variable MYSQL_HOST for type redis",
+		},
+		{
+			name:    "dsn of another type",
+			content: "targets:\n  - type: redis\n    dsn: redis://cache\n",
+			wantErr: "dsn is only supported for mysql and mongodb",
+		},
+		{
+			name:    "dsn and env",
+			content: "targets:\n  - dsn: app:secret@tcp(db)/orders\n    env: {MYSQL_HOST: other-db}\n",
+			wantErr: "MYSQL_HOST is already set",
+		},
+		{
+			name:    "dsn parameters",
+			content: "targets:\n  - dsn: app:secret@tcp(db)/orders?autocommit=1\n",
+			wantErr: "unsupported parameters autocommit",
+		},
+		{
+			name:    "unix socket",
+			content: "targets:\n  - dsn: app:secret@unix(/run/mysqld.sock)/orders\n",
+			wantErr: `unsupported network "unix"`,
+		},
+		{
+			name:    "tls of a type without tls",
+			content: "targets:\n  - type: mock\n    tls: true\n    env: {MOCK_NAME: payments}\n",
+			wantErr: "tls is not supported for type mock",
+		},
+		{
+			name:    "invalid timeout",
+			content: "targets:\n  - dsn: app:secret@tcp(db)/orders\n    timeout: soon\n",
+			wantErr: "invalid duration",
+		},
+		{
+			name:    "phase timeouts of another type",
+			content: "targets:\n  - type: mock\n    connect_timeout: 1s\n    env: {MOCK_NAME: payments}\n",
+			wantErr: "connect_timeout and query_timeout are only supported for mysql and mongodb",
+		},
+		{
+			name:    "negative tries",
+			content: "targets:\n  - dsn: app:secret@tcp(db)/orders\n    tries: -1\n",
+			wantErr: "tries must not be negative",
+		},
+		{
+			name:    "unknown severity",
+			content: "targets:\n  - dsn: app:secret@tcp(db)/orders\n    severity: high\n",
+			wantErr: `severity must be one of critical, warning, info, got "high"`,
+		},
+		{
+			name:    "missing mysql variable",
+			content: "targets:\n  - dsn: app@tcp(db)/orders\n",
+			wantErr: "MYSQL_PASS is not set",
+		},
+		{
+			name:    "mongodb uri without database",
+			content: "targets:\n  - type: mongodb\n    dsn: mongodb://events-db:27017\n",
+			wantErr: "MONGODB_URI: database name is missing",
+		},
+		{
+			name:    "invalid variable of another type",
+			content: "targets:\n  - type: redis\n    env: {REDIS_ADDR: cache, REDIS_DB: first}\n",
+			wantErr: "REDIS_DB: value \"first\" is not a number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := Validate(writeConfig(t, tt.content))
+			messages := []string{}
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			if !strings.Contains(strings.Join(messages, "\n"), tt.wantErr) {
+				t.Errorf("Validate() errors = %q, want %q", messages, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryTarget(t *testing.T) {
+	path := writeConfig(t, "targets:\n  - type: oracle\n  - dsn: app:secret@tcp(db)/orders\n  - type: redis\n")
+	config, errs := Validate(path)
+	if len(errs) != 2 {
+		t.Errorf("Validate() errors = %v, want one for targets[0] and one for targets[2]", errs)
+	}
+	if len(config.Mysql) != 1 {
+		t.Errorf("Mysql = %+v, want the valid target", config.Mysql)
+	}
+}
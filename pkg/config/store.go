@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Store keeps MySQL targets added and removed at runtime in a config file,
+// so they survive a restart like the targets loaded from it. The file is
+// written back in its format, YAML or JSON; comments and formatting of a
+// YAML file are not kept.
+type Store struct {
+	path string
+	// mu serializes the read-modify-write of the file.
+	mu sync.Mutex
+}
+
+// NewStore returns a Store writing to the config file path.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Save adds a mysql entry with values as env, replacing the entries of the
+// target at address (host:port/database). A key that is not a variable of
+// a MySQL target is an error, and nothing is written.
+func (s *Store) Save(address string, values map[string]string) error {
+	if errs := util.CheckMysqlVariables("saving target "+address, values); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	env := make(map[string]any, len(values))
+	for key, value := range values {
+		env[key] = value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, content, err := readFile(s.path)
+	if err != nil {
+		return fmt.Errorf("saving target %s: %v", address, err)
+	}
+	file.Targets = append(s.without(file.Targets, address), Entry{Env: env})
+	if err := s.write(file, content); err != nil {
+		return fmt.Errorf("saving target %s: %v", address, err)
+	}
+	return nil
+}
+
+// Delete removes every mysql entry of the file that configures the target
+// at address. No entry is not an error, and the file is left as it is.
+func (s *Store) Delete(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, content, err := readFile(s.path)
+	if err != nil {
+		return fmt.Errorf("deleting target %s: %v", address, err)
+	}
+	targets := s.without(file.Targets, address)
+	if len(targets) == len(file.Targets) {
+		return nil
+	}
+	file.Targets = targets
+	if err := s.write(file, content); err != nil {
+		return fmt.Errorf("deleting target %s: %v", address, err)
+	}
+	return nil
+}
+
+// without returns the entries except the mysql ones of the target at
+// address.
+func (s *Store) without(entries []Entry, address string) []Entry {
+	kept := []Entry{}
+	for i, entry := range entries {
+		if entry.Type == "" || entry.Type == "mysql" {
+			source := fmt.Sprintf("%s: targets[%d]", s.path, i)
+			values, _ := entry.values(source, "mysql")
+			config, _ := util.MysqlConfigFromValues(source, values)
+			if fmt.Sprintf("%s:%s/%s", config.Host, config.Port, config.Name) == address {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// write replaces the file with file, as JSON if its previous content was
+// JSON and as YAML otherwise. The new content is renamed over the file, so
+// a reader never sees it half written.
+func (s *Store) write(file File, previous []byte) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(previous), []byte("{")) {
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(s.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	temp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), s.path)
+}
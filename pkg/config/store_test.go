@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := writeConfig(t, `
+targets:
+  - dsn: app:secret@tcp(orders-db:3306)/orders
+  - type: redis
+    env: {REDIS_ADDR: "cache:6379", REDIS_DB: 2}
+`)
+	store := NewStore(path)
+
+	billing := map[string]string{"MYSQL_HOST": "billing-db", "MYSQL_NAME": "billing", "MYSQL_USER": "app", "MYSQL_PASS": "it's"}
+	if err := store.Save("billing-db:3306/billing", billing); err != nil {
+		t.Fatal(err)
+	}
+	billing["MYSQL_USER"] = "checker"
+	if err := store.Save("billing-db:3306/billing", billing); err != nil {
+		t.Fatal(err)
+	}
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Mysql) != 2 || len(config.Targets) != 1 {
+		t.Fatalf("got %d mysql and %d other targets, want 2 and 1", len(config.Mysql), len(config.Targets))
+	}
+	if got := config.Mysql[1]; got.Host != "billing-db" || got.User != "checker" || got.Pass != "it's" {
+		t.Errorf("saved target = %+v, want billing-db with user checker", got)
+	}
+
+	if err := store.Delete("orders-db:3306/orders"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("unknown-db:3306/unknown"); err != nil {
+		t.Fatal(err)
+	}
+	config, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Mysql) != 1 || config.Mysql[0].Host != "billing-db" || len(config.Targets) != 1 {
+		t.Errorf("after delete got %+v, want billing-db and the redis target", config)
+	}
+
+	if err := store.Save("x:3306/x", map[string]string{"MYSQL_HOST": "x", "MYSQL_NAME": "x", "MYSQL_HSOT": "y"}); err == nil {
+		t.Error("Save with an unknown variable succeeded")
+	}
+}
+
+func TestStoreKeepsJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"targets": [{"dsn": "app:secret@tcp(orders-db:3306)/orders", "timeout": "3s"}]}`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewStore(path).Save("billing-db:3306/billing", map[string]string{"MYSQL_HOST": "billing-db", "MYSQL_NAME": "billing", "MYSQL_USER": "app", "MYSQL_PASS": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "{") || !strings.Contains(string(content), `"timeout": "3s"`) {
+		t.Errorf("content = %s, want JSON keeping the timeout", content)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, %v, want 0640", info.Mode().Perm(), err)
+	}
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Mysql) != 2 {
+		t.Errorf("got %d mysql targets, want 2", len(config.Mysql))
+	}
+}
@@ -0,0 +1,405 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/mongocheck"
+	"github.com/tapclap/db-connect-checker/pkg/mysqlcheck"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Credentials resolved from the DatabaseCheck secretRef.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CheckFunc performs one connection attempt for a DatabaseCheck.
+type CheckFunc func(check *DatabaseCheck, creds Credentials) error
+
+// Controller periodically lists DatabaseCheck resources, runs the check of
+// every resource whose interval has elapsed and writes the result to the
+// resource status.
+type Controller struct {
+	client          dynamic.Interface
+	kube            kubernetes.Interface
+	namespace       string
+	resync          time.Duration
+	defaultInterval time.Duration
+	check           CheckFunc
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	wg       sync.WaitGroup
+}
+
+// New creates a controller watching DatabaseChecks in namespace, or in all
+// namespaces if it is empty.
+func New(client dynamic.Interface, kube kubernetes.Interface, namespace string, resync time.Duration, defaultInterval time.Duration) *Controller {
+	return &Controller{
+		client:          client,
+		kube:            kube,
+		namespace:       namespace,
+		resync:          resync,
+		defaultInterval: defaultInterval,
+		check:           Check,
+		inFlight:        map[string]bool{},
+	}
+}
+
+// Run reconciles until ctx is cancelled and then waits for in-flight checks.
+func (c *Controller) Run(ctx context.Context) {
+	defer c.wg.Wait()
+
+	ticker := time.NewTicker(c.resync)
+	defer ticker.Stop()
+
+	for {
+		if err := c.syncAll(ctx); err != nil {
+			log.Error("Error listing DatabaseChecks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) syncAll(ctx context.Context) error {
+	list, err := c.client.Resource(DatabaseCheckResource).Namespace(c.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, item := range list.Items {
+		var check DatabaseCheck
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), &check); err != nil {
+			log.Error("Error decoding DatabaseCheck", "namespace", item.GetNamespace(), "name", item.GetName(), "error", err)
+			continue
+		}
+		if !c.due(&check, now) {
+			continue
+		}
+
+		key := check.Namespace + "/" + check.Name
+		c.mu.Lock()
+		if c.inFlight[key] {
+			c.mu.Unlock()
+			continue
+		}
+		c.inFlight[key] = true
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go func(check DatabaseCheck) {
+			defer c.wg.Done()
+			defer func() {
+				c.mu.Lock()
+				delete(c.inFlight, key)
+				c.mu.Unlock()
+			}()
+			c.process(ctx, &check)
+		}(check)
+	}
+	return nil
+}
+
+func (c *Controller) due(check *DatabaseCheck, now time.Time) bool {
+	if check.Status.ObservedGeneration != check.Generation {
+		return true
+	}
+	last, err := time.Parse(time.RFC3339, check.Status.LastCheckTime)
+	if err != nil {
+		return true
+	}
+	return now.Sub(last) >= c.interval(check)
+}
+
+func (c *Controller) interval(check *DatabaseCheck) time.Duration {
+	interval, err := time.ParseDuration(check.Spec.Interval)
+	if err != nil || interval <= 0 {
+		return c.defaultInterval
+	}
+	return interval
+}
+
+func (c *Controller) process(ctx context.Context, check *DatabaseCheck) {
+	start := time.Now()
+	creds, err := c.credentials(ctx, check)
+	if err == nil {
+		err = c.check(check, creds)
+	}
+	if err != nil {
+		log.Warn("Check failed", "namespace", check.Namespace, "name", check.Name, "error", err)
+	}
+
+	status := nextStatus(check, err, start, time.Since(start))
+	if err := c.updateStatus(ctx, check, status); err != nil {
+		log.Error("Error updating status", "namespace", check.Namespace, "name", check.Name, "error", err)
+		return
+	}
+	c.recordTransitions(ctx, check, status)
+}
+
+// recordTransitions emits an Event for every condition that changed its
+// status, so that kubectl describe shows failures and recoveries without
+// an Event on every check.
+func (c *Controller) recordTransitions(ctx context.Context, check *DatabaseCheck, status DatabaseCheckStatus) {
+	for _, conditionType := range []string{ConditionAvailable, ConditionDegraded} {
+		condition := meta.FindStatusCondition(status.Conditions, conditionType)
+		if condition == nil {
+			continue
+		}
+		previous := meta.FindStatusCondition(check.Status.Conditions, conditionType)
+		if previous != nil && previous.Status == condition.Status {
+			continue
+		}
+
+		eventType := corev1.EventTypeNormal
+		if (conditionType == ConditionAvailable) != (condition.Status == metav1.ConditionTrue) {
+			eventType = corev1.EventTypeWarning
+		}
+		// A resource that starts healthy does not need a "not degraded" Event.
+		if previous == nil && eventType == corev1.EventTypeNormal && conditionType == ConditionDegraded {
+			continue
+		}
+		if err := c.recordEvent(ctx, check, eventType, condition.Reason, condition.Message); err != nil {
+			log.Error("Error recording event", "namespace", check.Namespace, "name", check.Name, "error", err)
+		}
+	}
+}
+
+func (c *Controller) recordEvent(ctx context.Context, check *DatabaseCheck, eventType, reason, message string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", check.Name, now.UnixNano()),
+			Namespace: check.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      DatabaseCheckResource.GroupVersion().String(),
+			Kind:            "DatabaseCheck",
+			Namespace:       check.Namespace,
+			Name:            check.Name,
+			UID:             check.UID,
+			ResourceVersion: check.ResourceVersion,
+		},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         corev1.EventSource{Component: "db-connect-checker"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := c.kube.CoreV1().Events(check.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
+
+func (c *Controller) credentials(ctx context.Context, check *DatabaseCheck) (Credentials, error) {
+	ref := check.Spec.SecretRef
+	if ref == nil {
+		return Credentials{}, nil
+	}
+
+	secret, err := c.kube.CoreV1().Secrets(check.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return Credentials{}, fmt.Errorf("cannot read secret %s: %v", ref.Name, err)
+	}
+
+	userKey := ref.UserKey
+	if userKey == "" {
+		userKey = "username"
+	}
+	passwordKey := ref.PasswordKey
+	if passwordKey == "" {
+		passwordKey = "password"
+	}
+	return Credentials{
+		User:     string(secret.Data[userKey]),
+		Password: string(secret.Data[passwordKey]),
+	}, nil
+}
+
+func (c *Controller) updateStatus(ctx context.Context, check *DatabaseCheck, status DatabaseCheckStatus) error {
+	patch, err := json.Marshal(map[string]interface{}{"status": status})
+	if err != nil {
+		return err
+	}
+	_, err = c.client.Resource(DatabaseCheckResource).Namespace(check.Namespace).
+		Patch(ctx, check.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// nextStatus applies one check result to the previous status. Availability
+// only flips after FailureThreshold consecutive failures or SuccessThreshold
+// consecutive successes (1 by default).
+func nextStatus(check *DatabaseCheck, checkErr error, checkedAt time.Time, duration time.Duration) DatabaseCheckStatus {
+	status := check.Status
+	status.LastCheckTime = checkedAt.UTC().Format(time.RFC3339)
+	status.LastDuration = duration.Round(time.Millisecond).String()
+	status.ObservedGeneration = check.Generation
+
+	failureThreshold := max(check.Spec.Thresholds.FailureThreshold, 1)
+	successThreshold := max(check.Spec.Thresholds.SuccessThreshold, 1)
+
+	if checkErr != nil {
+		status.ConsecutiveFailures++
+		status.ConsecutiveSuccesses = 0
+		status.Message = checkErr.Error()
+		if status.ConsecutiveFailures >= failureThreshold {
+			status.Available = false
+		}
+	} else {
+		status.ConsecutiveSuccesses++
+		status.ConsecutiveFailures = 0
+		status.Message = "connect success"
+		if status.ConsecutiveSuccesses >= successThreshold {
+			status.Available = true
+		}
+	}
+
+	setConditions(&status, checkErr != nil, checkedAt)
+	return status
+}
+
+// setConditions derives the Available and Degraded conditions from the
+// status. lastTransitionTime is only moved when a condition flips.
+func setConditions(status *DatabaseCheckStatus, failed bool, checkedAt time.Time) {
+	conditions := append([]metav1.Condition(nil), status.Conditions...)
+	transitionTime := metav1.NewTime(checkedAt.UTC().Truncate(time.Second))
+
+	available := metav1.Condition{
+		Type:               ConditionAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "CheckSucceeded",
+		Message:            status.Message,
+		ObservedGeneration: status.ObservedGeneration,
+		LastTransitionTime: transitionTime,
+	}
+	switch {
+	case status.Available && failed:
+		available.Reason = "FailureThresholdNotReached"
+	case !status.Available && failed:
+		available.Status = metav1.ConditionFalse
+		available.Reason = "CheckFailed"
+	case !status.Available:
+		available.Status = metav1.ConditionFalse
+		available.Reason = "SuccessThresholdNotReached"
+	}
+	meta.SetStatusCondition(&conditions, available)
+
+	degraded := metav1.Condition{
+		Type:               ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             "CheckSucceeded",
+		Message:            status.Message,
+		ObservedGeneration: status.ObservedGeneration,
+		LastTransitionTime: transitionTime,
+	}
+	if failed {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "CheckFailed"
+	}
+	meta.SetStatusCondition(&conditions, degraded)
+
+	status.Conditions = conditions
+}
+
+// Check connects to the database described by a DatabaseCheck.
+func Check(check *DatabaseCheck, creds Credentials) error {
+	switch check.Spec.Type {
+	case "mysql":
+		config, err := mysqlConfig(check, creds)
+		if err != nil {
+			return err
+		}
+		if result := mysqlcheck.CheckConnection(context.Background(), config); !result.Success {
+			return fmt.Errorf("%s: %v", result.Reason, result.Err)
+		}
+		return nil
+	case "mongodb":
+		uri, err := mongoURI(check, creds)
+		if err != nil {
+			return err
+		}
+		if result := mongocheck.CheckConnection(context.Background(), uri); !result.Success {
+			return fmt.Errorf("%s: %v", result.Reason, result.Err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported database type %q", check.Spec.Type)
+	}
+}
+
+func mysqlConfig(check *DatabaseCheck, creds Credentials) (types.MysqlConfig, error) {
+	address, database, ok := strings.Cut(check.Spec.Endpoint, "/")
+	if !ok || database == "" {
+		return types.MysqlConfig{}, fmt.Errorf("endpoint %q must be host:port/database", check.Spec.Endpoint)
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "3306"
+	}
+
+	config := types.MysqlConfig{
+		Name: database,
+		User: creds.User,
+		Pass: creds.Password,
+		Host: host,
+		Port: port,
+		TLS:  check.Spec.TLS,
+	}
+	if config.TLS {
+		tlsConfig, err := util.LoadTLSConfig("/etc/ssl/certs/ca-certificates.crt")
+		if err != nil {
+			return types.MysqlConfig{}, err
+		}
+		config.TLSConfig = tlsConfig
+	}
+	return config, nil
+}
+
+func mongoURI(check *DatabaseCheck, creds Credentials) (string, error) {
+	u, err := url.Parse(check.Spec.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint: %v", err)
+	}
+	if creds.User != "" {
+		u.User = url.UserPassword(creds.User, creds.Password)
+	}
+	return u.String(), nil
+}
+
+// ToUnstructured is a helper for building DatabaseCheck objects, e.g. in tests.
+func ToUnstructured(check *DatabaseCheck) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(check)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetAPIVersion(DatabaseCheckResource.GroupVersion().String())
+	obj.SetKind("DatabaseCheck")
+	return obj, nil
+}
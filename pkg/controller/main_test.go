@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNextStatus(t *testing.T) {
+	checkedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		thresholds    Thresholds
+		previous      DatabaseCheckStatus
+		checkErr      error
+		wantAvailable bool
+		wantFailures  int
+		wantSuccesses int
+	}{
+		{
+			name:          "success marks available",
+			previous:      DatabaseCheckStatus{},
+			checkErr:      nil,
+			wantAvailable: true,
+			wantSuccesses: 1,
+		},
+		{
+			name:          "failure marks unavailable with default threshold",
+			previous:      DatabaseCheckStatus{Available: true, ConsecutiveSuccesses: 5},
+			checkErr:      errors.New("connection refused"),
+			wantAvailable: false,
+			wantFailures:  1,
+		},
+		{
+			name:          "failure below threshold keeps available",
+			thresholds:    Thresholds{FailureThreshold: 3},
+			previous:      DatabaseCheckStatus{Available: true, ConsecutiveFailures: 1},
+			checkErr:      errors.New("connection refused"),
+			wantAvailable: true,
+			wantFailures:  2,
+		},
+		{
+			name:          "failure reaching threshold marks unavailable",
+			thresholds:    Thresholds{FailureThreshold: 3},
+			previous:      DatabaseCheckStatus{Available: true, ConsecutiveFailures: 2},
+			checkErr:      errors.New("connection refused"),
+			wantAvailable: false,
+			wantFailures:  3,
+		},
+		{
+			name:          "success below threshold keeps unavailable",
+			thresholds:    Thresholds{SuccessThreshold: 2},
+			previous:      DatabaseCheckStatus{Available: false, ConsecutiveFailures: 4},
+			checkErr:      nil,
+			wantAvailable: false,
+			wantSuccesses: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &DatabaseCheck{
+				Spec:   DatabaseCheckSpec{Thresholds: tt.thresholds},
+				Status: tt.previous,
+			}
+			status := nextStatus(check, tt.checkErr, checkedAt, 15*time.Millisecond)
+
+			if status.Available != tt.wantAvailable {
+				t.Errorf("nextStatus() Available = %v, want %v", status.Available, tt.wantAvailable)
+			}
+			if status.ConsecutiveFailures != tt.wantFailures {
+				t.Errorf("nextStatus() ConsecutiveFailures = %d, want %d", status.ConsecutiveFailures, tt.wantFailures)
+			}
+			if status.ConsecutiveSuccesses != tt.wantSuccesses {
+				t.Errorf("nextStatus() ConsecutiveSuccesses = %d, want %d", status.ConsecutiveSuccesses, tt.wantSuccesses)
+			}
+			if status.LastCheckTime != "2024-01-01T12:00:00Z" {
+				t.Errorf("nextStatus() LastCheckTime = %q", status.LastCheckTime)
+			}
+		})
+	}
+}
+
+func TestSetConditions(t *testing.T) {
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	later := first.Add(time.Minute)
+
+	tests := []struct {
+		name           string
+		status         DatabaseCheckStatus
+		failed         bool
+		wantAvailable  metav1.ConditionStatus
+		wantDegraded   metav1.ConditionStatus
+		wantReason     string
+		wantTransition time.Time
+	}{
+		{
+			name:           "healthy",
+			status:         DatabaseCheckStatus{Available: true},
+			wantAvailable:  metav1.ConditionTrue,
+			wantDegraded:   metav1.ConditionFalse,
+			wantReason:     "CheckSucceeded",
+			wantTransition: first,
+		},
+		{
+			name:           "failing below threshold is degraded but available",
+			status:         DatabaseCheckStatus{Available: true},
+			failed:         true,
+			wantAvailable:  metav1.ConditionTrue,
+			wantDegraded:   metav1.ConditionTrue,
+			wantReason:     "FailureThresholdNotReached",
+			wantTransition: first,
+		},
+		{
+			name:           "unavailable",
+			status:         DatabaseCheckStatus{Available: false},
+			failed:         true,
+			wantAvailable:  metav1.ConditionFalse,
+			wantDegraded:   metav1.ConditionTrue,
+			wantReason:     "CheckFailed",
+			wantTransition: later,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every case starts from a condition set at "first" while healthy.
+			status := DatabaseCheckStatus{Available: true}
+			setConditions(&status, false, first)
+
+			tt.status.Conditions = status.Conditions
+			setConditions(&tt.status, tt.failed, later)
+
+			available := meta.FindStatusCondition(tt.status.Conditions, ConditionAvailable)
+			degraded := meta.FindStatusCondition(tt.status.Conditions, ConditionDegraded)
+			if available == nil || degraded == nil {
+				t.Fatalf("conditions not set: %+v", tt.status.Conditions)
+			}
+			if available.Status != tt.wantAvailable || available.Reason != tt.wantReason {
+				t.Errorf("Available = %s/%s, want %s/%s", available.Status, available.Reason, tt.wantAvailable, tt.wantReason)
+			}
+			if degraded.Status != tt.wantDegraded {
+				t.Errorf("Degraded = %s, want %s", degraded.Status, tt.wantDegraded)
+			}
+			if !available.LastTransitionTime.Time.Equal(tt.wantTransition) {
+				t.Errorf("Available lastTransitionTime = %v, want %v", available.LastTransitionTime.Time, tt.wantTransition)
+			}
+		})
+	}
+}
+
+func TestMysqlConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantHost string
+		wantPort string
+		wantDB   string
+		wantErr  bool
+	}{
+		{name: "host port and database", endpoint: "orders-db:3307/orders", wantHost: "orders-db", wantPort: "3307", wantDB: "orders"},
+		{name: "default port", endpoint: "orders-db/orders", wantHost: "orders-db", wantPort: "3306", wantDB: "orders"},
+		{name: "missing database", endpoint: "orders-db:3306", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &DatabaseCheck{Spec: DatabaseCheckSpec{Type: "mysql", Endpoint: tt.endpoint}}
+			config, err := mysqlConfig(check, Credentials{User: "app", Password: "secret"})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("mysqlConfig() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mysqlConfig() unexpected error: %v", err)
+			}
+			if config.Host != tt.wantHost || config.Port != tt.wantPort || config.Name != tt.wantDB {
+				t.Errorf("mysqlConfig() = %s:%s/%s, want %s:%s/%s", config.Host, config.Port, config.Name, tt.wantHost, tt.wantPort, tt.wantDB)
+			}
+			if config.User != "app" || config.Pass != "secret" {
+				t.Errorf("mysqlConfig() credentials not applied: %s/%s", config.User, config.Pass)
+			}
+		})
+	}
+}
+
+func TestControllerUpdatesStatus(t *testing.T) {
+	check := &DatabaseCheck{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "shop", Generation: 1},
+		Spec: DatabaseCheckSpec{
+			Type:      "mysql",
+			Endpoint:  "orders-db:3306/orders",
+			SecretRef: &SecretRef{Name: "orders-db"},
+		},
+	}
+	obj, err := ToUnstructured(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{DatabaseCheckResource: "DatabaseCheckList"}, obj)
+	kube := kubefake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-db", Namespace: "shop"},
+		Data:       map[string][]byte{"username": []byte("app"), "password": []byte("secret")},
+	})
+
+	var gotCreds Credentials
+	c := New(client, kube, "", time.Hour, 30*time.Second)
+	c.check = func(check *DatabaseCheck, creds Credentials) error {
+		gotCreds = creds
+		return errors.New("auth error: access denied")
+	}
+
+	if err := c.syncAll(context.Background()); err != nil {
+		t.Fatalf("syncAll() unexpected error: %v", err)
+	}
+	c.wg.Wait()
+
+	if gotCreds.User != "app" || gotCreds.Password != "secret" {
+		t.Errorf("check received credentials %+v, want app/secret from secret", gotCreds)
+	}
+
+	updated, err := client.Resource(DatabaseCheckResource).Namespace("shop").Get(context.Background(), "orders", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result DatabaseCheck
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(updated.UnstructuredContent(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status.Available {
+		t.Error("status.available = true, want false")
+	}
+	if result.Status.ConsecutiveFailures != 1 {
+		t.Errorf("status.consecutiveFailures = %d, want 1", result.Status.ConsecutiveFailures)
+	}
+	if result.Status.Message != "auth error: access denied" {
+		t.Errorf("status.message = %q", result.Status.Message)
+	}
+
+	available := meta.FindStatusCondition(result.Status.Conditions, ConditionAvailable)
+	if available == nil || available.Status != metav1.ConditionFalse || available.Reason != "CheckFailed" {
+		t.Errorf("Available condition = %+v, want False/CheckFailed", available)
+	}
+
+	events, err := kube.CoreV1().Events("shop").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) == 0 {
+		t.Fatal("no events recorded for the failed check")
+	}
+	for _, event := range events.Items {
+		if event.Type != corev1.EventTypeWarning || event.InvolvedObject.Name != "orders" {
+			t.Errorf("event %s/%s for %s, want Warning for orders", event.Type, event.Reason, event.InvolvedObject.Name)
+		}
+	}
+
+	// A freshly checked resource is not due again before its interval.
+	if c.due(&result, time.Now()) {
+		t.Error("due() = true right after a check, want false")
+	}
+}
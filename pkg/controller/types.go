@@ -0,0 +1,69 @@
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DatabaseCheckResource is the DatabaseCheck custom resource, see deploy/crd.yaml.
+var DatabaseCheckResource = schema.GroupVersionResource{
+	Group:    "dbcheck.tapclap.com",
+	Version:  "v1alpha1",
+	Resource: "databasechecks",
+}
+
+type DatabaseCheck struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseCheckSpec   `json:"spec"`
+	Status DatabaseCheckStatus `json:"status,omitempty"`
+}
+
+type DatabaseCheckSpec struct {
+	// Type is mysql or mongodb.
+	Type string `json:"type"`
+	// Endpoint is host:port/database for mysql and a connection URI
+	// without credentials for mongodb.
+	Endpoint   string     `json:"endpoint"`
+	SecretRef  *SecretRef `json:"secretRef,omitempty"`
+	TLS        bool       `json:"tls,omitempty"`
+	Interval   string     `json:"interval,omitempty"`
+	Thresholds Thresholds `json:"thresholds,omitempty"`
+}
+
+// SecretRef points to a Secret in the namespace of the DatabaseCheck.
+type SecretRef struct {
+	Name        string `json:"name"`
+	UserKey     string `json:"userKey,omitempty"`
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// Thresholds control how many consecutive results are needed to flip
+// status.available, to avoid flapping on one-off errors.
+type Thresholds struct {
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+}
+
+type DatabaseCheckStatus struct {
+	Available            bool   `json:"available"`
+	ConsecutiveFailures  int    `json:"consecutiveFailures"`
+	ConsecutiveSuccesses int    `json:"consecutiveSuccesses"`
+	LastCheckTime        string `json:"lastCheckTime,omitempty"`
+	LastDuration         string `json:"lastDuration,omitempty"`
+	Message              string `json:"message,omitempty"`
+	ObservedGeneration   int64  `json:"observedGeneration,omitempty"`
+
+	// Conditions holds the Available and Degraded conditions, so that
+	// kubectl describe shows when the database state last changed.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// ConditionAvailable is True while status.available is true.
+	ConditionAvailable = "Available"
+	// ConditionDegraded is True while the latest checks fail, including
+	// failures below the failure threshold.
+	ConditionDegraded = "Degraded"
+)
@@ -0,0 +1,342 @@
+// Package dynamocheck checks DynamoDB tables: it describes the table and
+// optionally reads a canary item, signing the requests with AWS Signature
+// Version 4 like the AWS SDKs do.
+package dynamocheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A missing
+// table is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Types of DynamoDB errors with an error class.
+var (
+	authTypes = map[string]bool{
+		"AccessDeniedException":               true,
+		"UnrecognizedClientException":         true,
+		"InvalidSignatureException":           true,
+		"MissingAuthenticationTokenException": true,
+		"ExpiredTokenException":               true,
+		"IncompleteSignatureException":        true,
+	}
+	unknownDatabaseTypes = map[string]bool{
+		"ResourceNotFoundException": true,
+	}
+	invalidConfigTypes = map[string]bool{
+		"ValidationException": true,
+	}
+)
+
+// Error is an error answer of DynamoDB.
+type Error struct {
+	// Type is the exception name without its namespace, e.g.
+	// ResourceNotFoundException.
+	Type    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dynamodb error %s: %s", e.Type, e.Message)
+}
+
+// credentials are the AWS credentials requests are signed with.
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// client sends the requests of a check.
+type client struct {
+	http        *http.Client
+	endpoint    string
+	region      string
+	credentials credentials
+}
+
+// defaultTimeout limits a check: DescribeTable and the optional GetItem.
+const defaultTimeout = 10 * time.Second
+
+// Check describes the table of target in the region of the region option
+// and reads the item with the primary key of the canary_key option, if set.
+// The phases are the DescribeTable and GetItem calls. A table that is being
+// created or deleted fails the check.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	region := target.Options["region"]
+	if region == "" || target.Database == "" {
+		return newResult(nil, retry.Permanent(fmt.Errorf("dynamodb region and table are required")))
+	}
+	creds := targetCredentials(target)
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return newResult(nil, retry.Permanent(fmt.Errorf("dynamodb table %s has no access key, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", target.Database)))
+	}
+	var canaryKey json.RawMessage
+	if key := target.Options["canary_key"]; key != "" {
+		if err := ValidateKey(key); err != nil {
+			return newResult(nil, retry.Permanent(err))
+		}
+		canaryKey = json.RawMessage(key)
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	transport := o.Transport(target.TLSConfig)
+	defer transport.CloseIdleConnections()
+	endpoint := target.Options["endpoint"]
+	if endpoint == "" {
+		endpoint = "https://" + net.JoinHostPort(target.Host, target.Port)
+	}
+	c := &client{http: &http.Client{Transport: transport}, endpoint: endpoint, region: region, credentials: creds}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	var table struct {
+		Table struct {
+			TableStatus string `json:"TableStatus"`
+		} `json:"Table"`
+	}
+	err := c.do(ctx, "DescribeTable", map[string]interface{}{"TableName": target.Database}, &table)
+	phases = append(phases, types.Phase{Name: "describe table", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error describing table %s: %w", target.Database, err))
+	}
+	// Updating tables serve reads and writes.
+	if status := table.Table.TableStatus; status != "ACTIVE" && status != "UPDATING" {
+		return newResult(phases, fmt.Errorf("table %s is %s", target.Database, status))
+	}
+
+	if canaryKey != nil {
+		start = time.Now()
+		var item struct {
+			Item map[string]json.RawMessage `json:"Item"`
+		}
+		err = c.do(ctx, "GetItem", map[string]interface{}{"TableName": target.Database, "Key": canaryKey}, &item)
+		phases = append(phases, types.Phase{Name: "get item", Duration: time.Since(start)})
+		if err == nil && item.Item == nil {
+			err = fmt.Errorf("no item with key %s", canaryKey)
+		}
+		if err != nil {
+			return newResult(phases, fmt.Errorf("error reading canary item of table %s: %w", target.Database, err))
+		}
+	}
+	return newResult(phases, nil)
+}
+
+// ValidateKey checks that key is the JSON primary key of an item in the
+// attribute value format of DynamoDB, e.g. {"pk":{"S":"canary"}}.
+func ValidateKey(key string) error {
+	var attributes map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(key), &attributes); err != nil || len(attributes) == 0 {
+		return fmt.Errorf("canary key %s is not a DynamoDB key like {\"pk\":{\"S\":\"canary\"}}", key)
+	}
+	return nil
+}
+
+// targetCredentials returns the access key of target, or the one of the
+// standard AWS_* variables if target has none.
+func targetCredentials(target types.Target) credentials {
+	if target.User != "" {
+		return credentials{accessKeyID: target.User, secretAccessKey: target.Pass, sessionToken: target.Options["session_token"]}
+	}
+	return credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// do calls the DynamoDB operation with input and decodes the answer into
+// output. A failed answer is returned as *Error.
+func (c *client) do(ctx context.Context, operation string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	request.Header.Set("X-Amz-Target", "DynamoDB_20120810."+operation)
+	request.Header.Set("User-Agent", "db-connect-checker/"+version.Version)
+	sign(request, body, c.credentials, c.region, "dynamodb", time.Now())
+
+	resp, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Type string `json:"__type"`
+			// Some errors spell it Message, which also matches.
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(content, &answer) != nil || answer.Type == "" {
+			return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		// The type is namespaced, e.g.
+		// com.amazonaws.dynamodb.v20120810#ResourceNotFoundException.
+		errorType := answer.Type[strings.LastIndex(answer.Type, "#")+1:]
+		return &Error{Type: errorType, Message: answer.Message}
+	}
+	if err := json.Unmarshal(content, output); err != nil {
+		return fmt.Errorf("invalid answer: %w", err)
+	}
+	return nil
+}
+
+// sign adds the Signature Version 4 headers of service, e.g. dynamodb, to
+// request with body.
+func sign(request *http.Request, body []byte, creds credentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		path,
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + creds.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the sorted, escaped query string of a signature.
+func canonicalQuery(query url.Values) string {
+	pairs := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, escape(name)+"="+escape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escape percent-encodes everything but the unreserved characters of
+// RFC 3986, as Signature Version 4 requires.
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var dynamoErr *Error
+	if errors.As(err, &dynamoErr) {
+		switch {
+		case authTypes[dynamoErr.Type]:
+			return "auth error"
+		case unknownDatabaseTypes[dynamoErr.Type]:
+			return "unknown database"
+		case invalidConfigTypes[dynamoErr.Type]:
+			return "invalid config"
+		}
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected or
+// insufficient credentials, missing tables and invalid configs, e.g. a
+// canary key that does not match the key schema, are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database", "invalid config":
+		return false
+	}
+	return true
+}
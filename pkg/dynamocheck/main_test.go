@@ -0,0 +1,216 @@
+package dynamocheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// TestSign checks the get-vanilla case of the AWS Signature Version 4 test
+// suite.
+func TestSign(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := credentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	sign(request, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := request.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+}
+
+// fakeDynamo answers like DynamoDB Local with the credentials AKID/secret
+// and the tables orders, ACTIVE with the item {"pk":{"S":"canary"}}, and
+// archive, CREATING. It returns the target and the operations it ran.
+func fakeDynamo(t *testing.T) (types.Target, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var operations []string
+	fail := func(w http.ResponseWriter, errorType, message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#" + errorType, "message": message})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !validSignature(r, body) {
+			fail(w, "UnrecognizedClientException", "The security token included in the request is invalid.")
+			return
+		}
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		mu.Lock()
+		operations = append(operations, operation)
+		mu.Unlock()
+
+		var input struct {
+			TableName string          `json:"TableName"`
+			Key       json.RawMessage `json:"Key"`
+		}
+		json.Unmarshal(body, &input)
+		status := map[string]string{"orders": "ACTIVE", "archive": "CREATING"}[input.TableName]
+		switch {
+		case status == "":
+			fail(w, "ResourceNotFoundException", "Requested resource not found: Table: "+input.TableName+" not found")
+		case operation == "DescribeTable":
+			json.NewEncoder(w).Encode(map[string]interface{}{"Table": map[string]string{"TableName": input.TableName, "TableStatus": status}})
+		case operation == "GetItem" && !strings.Contains(string(input.Key), `"pk"`):
+			fail(w, "ValidationException", "The provided key element does not match the schema")
+		case operation == "GetItem" && string(input.Key) == `{"pk":{"S":"canary"}}`:
+			json.NewEncoder(w).Encode(map[string]interface{}{"Item": map[string]interface{}{"pk": map[string]string{"S": "canary"}}})
+		case operation == "GetItem":
+			w.Write([]byte("{}"))
+		default:
+			fail(w, "UnknownOperationException", "")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	target := types.DynamoDBConfig{Table: "orders", Region: "eu-west-1", Endpoint: server.URL, AccessKeyID: "AKID", SecretAccessKey: "secret"}.Target()
+	return target, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return operations
+	}
+}
+
+// validSignature signs a copy of r with the secret of AKID at the same time
+// and compares the signatures.
+func validSignature(r *http.Request, body []byte) bool {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential=AKID/") {
+		return false
+	}
+	now, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	copied, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.String(), bytes.NewReader(body))
+	for _, name := range []string{"Content-Type", "X-Amz-Target"} {
+		copied.Header.Set(name, r.Header.Get(name))
+	}
+	sign(copied, body, credentials{accessKeyID: "AKID", secretAccessKey: "secret"}, "eu-west-1", "dynamodb", now)
+	return copied.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		modify         func(target *types.Target)
+		wantReason     string
+		wantPhases     []string
+		wantOperations []string
+	}{
+		{
+			name:           "table",
+			modify:         func(target *types.Target) {},
+			wantPhases:     []string{"describe table"},
+			wantOperations: []string{"DescribeTable"},
+		},
+		{
+			name:           "canary item",
+			modify:         func(target *types.Target) { target.Options["canary_key"] = `{"pk":{"S":"canary"}}` },
+			wantPhases:     []string{"describe table", "get item"},
+			wantOperations: []string{"DescribeTable", "GetItem"},
+		},
+		{
+			name:           "missing canary item",
+			modify:         func(target *types.Target) { target.Options["canary_key"] = `{"pk":{"S":"missing"}}` },
+			wantReason:     "error",
+			wantPhases:     []string{"describe table", "get item"},
+			wantOperations: []string{"DescribeTable", "GetItem"},
+		},
+		{
+			name:           "canary key not matching the schema",
+			modify:         func(target *types.Target) { target.Options["canary_key"] = `{"id":{"N":"1"}}` },
+			wantReason:     "invalid config",
+			wantPhases:     []string{"describe table", "get item"},
+			wantOperations: []string{"DescribeTable", "GetItem"},
+		},
+		{
+			name:           "table being created",
+			modify:         func(target *types.Target) { target.Database = "archive" },
+			wantReason:     "error",
+			wantPhases:     []string{"describe table"},
+			wantOperations: []string{"DescribeTable"},
+		},
+		{
+			name:           "missing table",
+			modify:         func(target *types.Target) { target.Database = "missing" },
+			wantReason:     "unknown database",
+			wantPhases:     []string{"describe table"},
+			wantOperations: []string{"DescribeTable"},
+		},
+		{
+			name:       "wrong secret",
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"describe table"},
+		},
+		{
+			name:       "invalid canary key",
+			modify:     func(target *types.Target) { target.Options["canary_key"] = "canary" },
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, operations := fakeDynamo(t)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if retryable := tt.wantReason == "error"; tt.wantReason != "" && Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if got := operations(); strings.Join(got, ",") != strings.Join(tt.wantOperations, ",") {
+				t.Errorf("operations = %v, want %v", got, tt.wantOperations)
+			}
+		})
+	}
+}
+
+func TestCheckEnvironmentCredentials(t *testing.T) {
+	target, _ := fakeDynamo(t)
+	target.User, target.Pass = "", ""
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	if result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second)); !result.Success {
+		t.Errorf("Check() = %v, want success with AWS_ACCESS_KEY_ID", result.Err)
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	target := types.DynamoDBConfig{Table: "orders", Region: "eu-west-1", Endpoint: "http://" + addr, AccessKeyID: "AKID", SecretAccessKey: "secret"}.Target()
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
@@ -0,0 +1,219 @@
+// Package escheck checks Elasticsearch and OpenSearch clusters through their
+// HTTP API: it reads the version of the node and the health of the cluster
+// and optionally fails if the health is worse than required.
+package escheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// Error classes wrapped by check errors, see util.WithClass.
+var (
+	ErrAuthFailed = util.ErrAuthFailed
+	ErrDNS        = util.ErrDNS
+	ErrTimeout    = util.ErrTimeout
+	ErrTLS        = util.ErrTLS
+	// ErrClusterUnhealthy fails checks with the min_status option if the
+	// cluster health is worse.
+	ErrClusterUnhealthy = util.ErrClusterUnhealthy
+)
+
+// statuses ranks the cluster health statuses, worst first.
+var statuses = map[string]int{"red": 0, "yellow": 1, "green": 2}
+
+// Error is an error answer of the cluster.
+type Error struct {
+	// Code is the HTTP status code.
+	Code int
+	// Type is the type of the error, e.g. security_exception.
+	Type   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("HTTP %d: %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("%s (HTTP %d): %s", e.Type, e.Code, e.Reason)
+}
+
+// defaultTimeout limits a check: the version and the cluster health request.
+const defaultTimeout = 10 * time.Second
+
+// Check reads the version of the node at the url option and the health of
+// its cluster, authenticating with User and Pass if User is set. With the
+// min_status option yellow it fails with ErrClusterUnhealthy if the cluster
+// is red, with green also if it is yellow. The phases are the version and
+// the health request.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	baseURL, err := url.Parse(target.Options["url"])
+	if err != nil || baseURL.Host == "" || (baseURL.Scheme != "http" && baseURL.Scheme != "https") {
+		return newResult(nil, "", retry.Permanent(fmt.Errorf("%q is not an http or https URL", target.Options["url"])))
+	}
+	minStatus := target.Options["min_status"]
+	if minStatus == "" {
+		minStatus = "red"
+	}
+	if _, ok := statuses[minStatus]; !ok {
+		return newResult(nil, "", retry.Permanent(fmt.Errorf("unknown minimum status %q, want red, yellow or green", minStatus)))
+	}
+	tlsConfig, err := targetTLSConfig(target, baseURL.Scheme == "https")
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+
+	transport := o.Transport(tlsConfig)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	var node struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	err = get(ctx, client, target, baseURL.String(), &node)
+	phases = append(phases, types.Phase{Name: "version", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error reading version: %w", err))
+	}
+	// OpenSearch names itself, Elasticsearch does not.
+	serverVersion := node.Version.Number
+	if node.Version.Distribution != "" {
+		serverVersion = node.Version.Distribution + " " + serverVersion
+	}
+
+	start = time.Now()
+	var health struct {
+		ClusterName string `json:"cluster_name"`
+		Status      string `json:"status"`
+	}
+	err = get(ctx, client, target, baseURL.JoinPath("_cluster", "health").String(), &health)
+	phases = append(phases, types.Phase{Name: "health", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, serverVersion, fmt.Errorf("error reading cluster health: %w", err))
+	}
+	rank, ok := statuses[health.Status]
+	if !ok {
+		return newResult(phases, serverVersion, fmt.Errorf("unknown cluster health %q", health.Status))
+	}
+	if rank < statuses[minStatus] {
+		return newResult(phases, serverVersion, util.WithClass(ErrClusterUnhealthy, fmt.Errorf("cluster %s is %s, want %s or better", health.ClusterName, health.Status, minStatus)))
+	}
+	return newResult(phases, serverVersion, nil)
+}
+
+// targetTLSConfig returns the TLS config of target for an https URL: its
+// TLSConfig, or one trusting the CA bundle of TLSCAFile, or the system roots
+// if neither is set.
+func targetTLSConfig(target types.Target, https bool) (*tls.Config, error) {
+	if !https || target.TLSConfig != nil {
+		return target.TLSConfig, nil
+	}
+	if target.TLSCAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// get sends a GET request to endpoint with the credentials of target and
+// decodes a successful answer into data. A failed answer is returned as
+// *Error.
+func get(ctx context.Context, client *http.Client, target types.Target, endpoint string, data interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", "db-connect-checker/"+version.Version)
+	if target.User != "" {
+		request.SetBasicAuth(target.User, target.Pass)
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		// Proxies answer without an error object.
+		if json.Unmarshal(content, &answer) != nil || answer.Error.Reason == "" {
+			answer.Error.Reason = resp.Status
+		}
+		return &Error{Code: resp.StatusCode, Type: answer.Error.Type, Reason: answer.Error.Reason}
+	}
+	if err := json.Unmarshal(content, data); err != nil {
+		return fmt.Errorf("invalid answer: %w", err)
+	}
+	return nil
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	return checkbase.Result(phases, version, err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "cluster unhealthy".
+func ErrorReason(err error) string {
+	var esErr *Error
+	if errors.As(err, &esErr) && (esErr.Code == http.StatusUnauthorized || esErr.Code == http.StatusForbidden) {
+		return "auth error"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures and invalid configs are not retryable; unhealthy clusters are,
+// as shards may still be recovering.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	return ErrorReason(err) != "auth error"
+}
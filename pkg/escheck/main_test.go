@@ -0,0 +1,321 @@
+package escheck
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeElasticsearch answers like a node of the cluster logs with the given
+// health, behind the path prefix /search, whose only user is elastic with
+// password secret. OpenSearch nodes name their distribution.
+func fakeElasticsearch(t *testing.T, secure bool, health, distribution string) types.Target {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "elastic" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":  map[string]string{"type": "security_exception", "reason": "unable to authenticate user [elastic]"},
+				"status": 401,
+			})
+			return
+		}
+		switch r.URL.Path {
+		case "/search":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"cluster_name": "logs",
+				"version":      map[string]string{"number": "8.13.4", "distribution": distribution},
+			})
+		case "/search/_cluster/health":
+			json.NewEncoder(w).Encode(map[string]interface{}{"cluster_name": "logs", "status": health, "number_of_nodes": 3})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server := httptest.NewUnstartedServer(handler)
+	if secure {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+
+	target := types.ElasticsearchConfig{URL: server.URL + "/search", User: "elastic", Pass: "secret", MinStatus: "red"}.Target()
+	if secure {
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		target.TLSConfig = &tls.Config{RootCAs: pool}
+	}
+	return target
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		secure       bool
+		health       string
+		distribution string
+		modify       func(target *types.Target)
+		wantReason   string
+		wantPhases   []string
+		wantVersion  string
+	}{
+		{
+			name:        "red cluster",
+			health:      "red",
+			modify:      func(target *types.Target) {},
+			wantPhases:  []string{"version", "health"},
+			wantVersion: "8.13.4",
+		},
+		{
+			name:         "opensearch over TLS",
+			secure:       true,
+			health:       "green",
+			distribution: "opensearch",
+			modify:       func(target *types.Target) { target.Options["min_status"] = "green" },
+			wantPhases:   []string{"version", "health"},
+			wantVersion:  "opensearch 8.13.4",
+		},
+		{
+			name:        "yellow cluster",
+			health:      "yellow",
+			modify:      func(target *types.Target) { target.Options["min_status"] = "yellow" },
+			wantPhases:  []string{"version", "health"},
+			wantVersion: "8.13.4",
+		},
+		{
+			name:       "yellow cluster, green required",
+			health:     "yellow",
+			modify:     func(target *types.Target) { target.Options["min_status"] = "green" },
+			wantReason: "cluster unhealthy",
+			wantPhases: []string{"version", "health"},
+		},
+		{
+			name:       "wrong password",
+			health:     "green",
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:   "missing CA file",
+			secure: true,
+			health: "green",
+			modify: func(target *types.Target) {
+				target.TLSConfig = nil
+				target.TLSCAFile = filepath.Join(t.TempDir(), "ca.pem")
+			},
+			wantReason: "invalid config",
+		},
+		{
+			name:       "unknown minimum status",
+			health:     "green",
+			modify:     func(target *types.Target) { target.Options["min_status"] = "blue" },
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeElasticsearch(t, tt.secure, tt.health, tt.distribution)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if tt.wantReason == "invalid config" && !retry.IsPermanent(result.Err) {
+				t.Errorf("Check() error %v is not permanent", result.Err)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if result.Success && result.ServerVersion != tt.wantVersion {
+				t.Errorf("ServerVersion = %q, want %q", result.ServerVersion, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestCheckUnhealthyMessage(t *testing.T) {
+	target := fakeElasticsearch(t, false, "red", "")
+	target.Options["min_status"] = "yellow"
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "cluster logs is red, want yellow or better") {
+		t.Errorf("Check() error = %v, want the health of the cluster", result.Err)
+	}
+	if !Retryable(result.Err) {
+		t.Errorf("Retryable(%v) = false, want true", result.Err)
+	}
+}
+
+// answer returns a handler that answers the version and health requests
+// with the given statuses and bodies.
+func answer(rootCode int, root string, healthCode int, health string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, body := rootCode, root
+		if strings.HasSuffix(r.URL.Path, "/_cluster/health") {
+			code, body = healthCode, health
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	}
+}
+
+func TestCheckProtocolErrors(t *testing.T) {
+	const root = `{"version":{"number":"8.13.4"}}`
+	tests := []struct {
+		name string
+		// handler answers over HTTP; without it the server answers the
+		// request with raw, and without raw nothing listens.
+		handler    http.HandlerFunc
+		raw        string
+		wantReason string
+		wantErr    string
+		wantPhases []string
+	}{
+		{
+			name:       "connection refused",
+			wantReason: "connection refused",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "not HTTP",
+			raw:        "-ERR unknown command\r\n",
+			wantReason: "error",
+			wantErr:    "malformed HTTP",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "not JSON",
+			handler:    answer(http.StatusOK, "<html>It works!</html>", http.StatusOK, ""),
+			wantReason: "error",
+			wantErr:    "invalid answer",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "proxy error page",
+			handler:    answer(http.StatusBadGateway, "<html>502 Bad Gateway</html>", http.StatusOK, ""),
+			wantReason: "error",
+			wantErr:    "502 Bad Gateway",
+			wantPhases: []string{"version"},
+		},
+		{
+			name:       "health forbidden",
+			handler:    answer(http.StatusOK, root, http.StatusForbidden, `{"error":{"type":"security_exception","reason":"action [cluster:monitor/health] is unauthorized"},"status":403}`),
+			wantReason: "auth error",
+			wantErr:    "is unauthorized",
+			wantPhases: []string{"version", "health"},
+		},
+		{
+			name:       "no master",
+			handler:    answer(http.StatusOK, root, http.StatusServiceUnavailable, `{"error":{"type":"master_not_discovered_exception","reason":"no master"},"status":503}`),
+			wantReason: "error",
+			wantErr:    "no master",
+			wantPhases: []string{"version", "health"},
+		},
+		{
+			name:       "unknown health",
+			handler:    answer(http.StatusOK, root, http.StatusOK, `{"cluster_name":"logs","status":"purple"}`),
+			wantReason: "error",
+			wantErr:    `unknown cluster health "purple"`,
+			wantPhases: []string{"version", "health"},
+		},
+		{
+			name:       "truncated health",
+			handler:    answer(http.StatusOK, root, http.StatusOK, `{"cluster_name":"logs","sta`),
+			wantReason: "error",
+			wantErr:    "invalid answer",
+			wantPhases: []string{"version", "health"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := listener.Addr().String()
+			switch {
+			case tt.handler != nil:
+				server := &httptest.Server{Listener: listener, Config: &http.Server{Handler: tt.handler}}
+				server.Start()
+				t.Cleanup(server.Close)
+			case tt.raw != "":
+				t.Cleanup(func() { listener.Close() })
+				go func() {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					if _, err := http.ReadRequest(bufio.NewReader(conn)); err == nil {
+						io.WriteString(conn, tt.raw)
+					}
+				}()
+			default:
+				listener.Close()
+			}
+
+			target := types.ElasticsearchConfig{URL: "http://" + addr}.Target()
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Success || result.Reason != tt.wantReason {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want it to mention %q", result.Err, tt.wantErr)
+			}
+			if retryable := tt.wantReason != "auth error"; Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	tests := []struct {
+		err       error
+		want      string
+		retryable bool
+	}{
+		{&Error{Code: http.StatusUnauthorized, Type: "security_exception", Reason: "unable to authenticate user"}, "auth error", false},
+		{&Error{Code: http.StatusForbidden, Type: "security_exception", Reason: "action [cluster:monitor/health] is unauthorized"}, "auth error", false},
+		{&Error{Code: http.StatusServiceUnavailable, Type: "master_not_discovered_exception", Reason: "no master"}, "error", true},
+		{context.DeadlineExceeded, "timeout", true},
+	}
+	for _, tt := range tests {
+		if got := ErrorReason(tt.err); got != tt.want {
+			t.Errorf("ErrorReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+		if got := Retryable(tt.err); got != tt.retryable {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package firestorecheck checks Firestore databases, including Firestore in
+// Datastore mode: it obtains a token with Application Default Credentials or
+// a credentials file, reads a canary document and lists one document of a
+// collection.
+package firestorecheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// scope is the OAuth scope of the check.
+const scope = "https://www.googleapis.com/auth/datastore"
+
+// Error classes wrapped by check errors, see util.WithClass. Missing
+// permissions are reported as auth error, a missing project or database as
+// unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Error is an error answer of the Firestore API.
+type Error struct {
+	// Code is the HTTP status code.
+	Code    int
+	Status  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("firestore error %d %s: %s", e.Code, e.Status, e.Message)
+}
+
+// defaultTimeout limits a check: fetching a token and reading the document and the collection.
+const defaultTimeout = 30 * time.Second
+
+// Check obtains a token for target and, in its database of the project
+// option, reads the document of the document option and lists one document
+// of the collection option; at least one of them must be set. The phases are
+// the token, the document and the collection.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	project := target.Options["project"]
+	document, collection := target.Options["document"], target.Options["collection"]
+	if project == "" {
+		return newResult(nil, retry.Permanent(fmt.Errorf("firestore project is required")))
+	}
+	if err := ValidatePaths(document, collection); err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	transport := o.Transport(target.TLSConfig)
+	defer transport.CloseIdleConnections()
+	// Tokens are fetched with the same transport.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+
+	phases := []types.Phase{}
+	start := time.Now()
+	credentials, err := findCredentials(ctx, target.Options["credentials_file"])
+	if err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	token, err := credentials.TokenSource.Token()
+	phases = append(phases, types.Phase{Name: "token", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error token: %w", err))
+	}
+
+	client := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(token), Base: transport}}
+	database := target.Database
+	if database == "" {
+		database = "(default)"
+	}
+	baseURL := "https://" + net.JoinHostPort(target.Host, target.Port) + "/v1/projects/" + url.PathEscape(project) + "/databases/" + url.PathEscape(database) + "/documents/"
+
+	if document != "" {
+		start = time.Now()
+		err = get(ctx, client, baseURL+escapePath(document))
+		phases = append(phases, types.Phase{Name: "document", Duration: time.Since(start)})
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound && strings.HasPrefix(apiErr.Message, "Document") {
+			// The database exists; the document may be restored.
+			return newResult(phases, fmt.Errorf("canary document %s does not exist", document))
+		}
+		if err != nil {
+			return newResult(phases, fmt.Errorf("error reading document %s: %w", document, err))
+		}
+	}
+
+	if collection != "" {
+		start = time.Now()
+		err = get(ctx, client, baseURL+escapePath(collection)+"?pageSize=1")
+		phases = append(phases, types.Phase{Name: "collection", Duration: time.Since(start)})
+		if err != nil {
+			return newResult(phases, fmt.Errorf("error listing collection %s: %w", collection, err))
+		}
+	}
+	return newResult(phases, nil)
+}
+
+// ValidatePaths checks that document is the path of a document, e.g.
+// health/canary, and collection the path of a collection, e.g. users or
+// users/1/orders. At least one of them must be set.
+func ValidatePaths(document, collection string) error {
+	if document == "" && collection == "" {
+		return fmt.Errorf("a canary document or a collection is required")
+	}
+	if segments := pathSegments(document); document != "" && (segments == 0 || segments%2 != 0) {
+		return fmt.Errorf("document %s is not a document path like health/canary", document)
+	}
+	if segments := pathSegments(collection); collection != "" && (segments == 0 || segments%2 != 1) {
+		return fmt.Errorf("collection %s is not a collection path like users or users/1/orders", collection)
+	}
+	return nil
+}
+
+// pathSegments returns the number of segments of path, or 0 if one of them
+// is empty.
+func pathSegments(path string) int {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, segment := range segments {
+		if segment == "" {
+			return 0
+		}
+	}
+	return len(segments)
+}
+
+// escapePath escapes every segment of a document or collection path.
+func escapePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// findCredentials reads the credentials file, or Application Default
+// Credentials if file is empty: GOOGLE_APPLICATION_CREDENTIALS, the gcloud
+// credentials or the metadata server.
+func findCredentials(ctx context.Context, file string) (*google.Credentials, error) {
+	if file == "" {
+		return google.FindDefaultCredentials(ctx, scope)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials: %w", err)
+	}
+	return google.CredentialsFromJSON(ctx, content, scope)
+}
+
+// get sends a GET request to endpoint. The answer is not needed; a failed
+// answer is returned as *Error.
+func get(ctx context.Context, client *http.Client, endpoint string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var answer struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(content, &answer) != nil || answer.Error.Message == "" {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return &Error{Code: resp.StatusCode, Status: answer.Error.Status, Message: answer.Error.Message}
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "auth error"
+		case http.StatusNotFound:
+			return "unknown database"
+		}
+	}
+	// A rejected credential, e.g. a deleted service account key.
+	var tokenErr *oauth2.RetrieveError
+	if errors.As(err, &tokenErr) && tokenErr.Response != nil && tokenErr.Response.StatusCode >= 400 && tokenErr.Response.StatusCode < 500 {
+		return "auth error"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected
+// credentials, missing permissions, missing databases and invalid configs
+// are not retryable; a missing canary document is.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
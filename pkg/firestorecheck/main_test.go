@@ -0,0 +1,236 @@
+package firestorecheck
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeFirestore answers like the token endpoint of Google and the Firestore
+// API of a project app-prod whose only database (default) has the document
+// health/canary, readable by the service account checker. It returns the
+// target with a credentials file of that account and the requests it
+// received.
+func fakeFirestore(t *testing.T) (types.Target, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	apiError := func(w http.ResponseWriter, code int, status, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "status": status, "message": message}})
+	}
+	const documents = "/v1/projects/app-prod/databases/(default)/documents/"
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			if strings.Count(r.PostForm.Get("assertion"), ".") != 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Invalid JWT Signature."})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			apiError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request is missing required authentication credential.")
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+
+		path, found := strings.CutPrefix(r.URL.Path, documents)
+		switch {
+		case !strings.HasPrefix(r.URL.Path, "/v1/projects/app-prod/"):
+			apiError(w, http.StatusForbidden, "PERMISSION_DENIED", "Missing or insufficient permissions.")
+		case !found:
+			apiError(w, http.StatusNotFound, "NOT_FOUND", "The database (missing) does not exist for project app-prod")
+		case path == "health/canary":
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "projects/app-prod/databases/(default)/documents/health/canary", "fields": map[string]interface{}{}})
+		case strings.Count(path, "/")%2 == 1:
+			apiError(w, http.StatusNotFound, "NOT_FOUND", `Document "projects/app-prod/databases/(default)/documents/`+path+`" not found.`)
+		case r.URL.Query().Get("pageSize") != "1":
+			apiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "unexpected page size")
+		default:
+			// Collections exist implicitly, an empty one lists no documents.
+			w.Write([]byte("{}"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "app-prod",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "checker@app-prod.iam.gserviceaccount.com",
+		"token_uri":      server.URL + "/token",
+	})
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(file, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	target := types.FirestoreConfig{Project: "app-prod", Database: "(default)", Document: "health/canary", CredentialsFile: file}.Target()
+	target.Host = host
+	target.Port = port
+	target.TLSConfig = &tls.Config{RootCAs: pool}
+	return target, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(target *types.Target)
+		wantReason   string
+		wantPhases   []string
+		wantRequests []string
+	}{
+		{
+			name:         "canary document",
+			modify:       func(target *types.Target) {},
+			wantPhases:   []string{"token", "document"},
+			wantRequests: []string{"/v1/projects/app-prod/databases/(default)/documents/health/canary"},
+		},
+		{
+			name: "document and collection",
+			modify: func(target *types.Target) {
+				target.Database = ""
+				target.Options["collection"] = "users"
+			},
+			wantPhases: []string{"token", "document", "collection"},
+			wantRequests: []string{
+				"/v1/projects/app-prod/databases/(default)/documents/health/canary",
+				"/v1/projects/app-prod/databases/(default)/documents/users",
+			},
+		},
+		{
+			name:         "missing canary document",
+			modify:       func(target *types.Target) { target.Options["document"] = "health/missing" },
+			wantReason:   "error",
+			wantPhases:   []string{"token", "document"},
+			wantRequests: []string{"/v1/projects/app-prod/databases/(default)/documents/health/missing"},
+		},
+		{
+			name:         "missing database",
+			modify:       func(target *types.Target) { target.Database = "missing" },
+			wantReason:   "unknown database",
+			wantPhases:   []string{"token", "document"},
+			wantRequests: []string{"/v1/projects/app-prod/databases/missing/documents/health/canary"},
+		},
+		{
+			name:         "no permission",
+			modify:       func(target *types.Target) { target.Options["project"] = "other-project" },
+			wantReason:   "auth error",
+			wantPhases:   []string{"token", "document"},
+			wantRequests: []string{"/v1/projects/other-project/databases/(default)/documents/health/canary"},
+		},
+		{
+			name:       "collection path as document",
+			modify:     func(target *types.Target) { target.Options["document"] = "health" },
+			wantReason: "invalid config",
+		},
+		{
+			name: "missing credentials file",
+			modify: func(target *types.Target) {
+				target.Options["credentials_file"] = filepath.Join(t.TempDir(), "missing.json")
+			},
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, requests := fakeFirestore(t)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if retryable := tt.wantReason == "error"; tt.wantReason != "" && Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if got := requests(); strings.Join(got, ";") != strings.Join(tt.wantRequests, ";") {
+				t.Errorf("requests = %q, want %q", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestValidatePaths(t *testing.T) {
+	tests := []struct {
+		document   string
+		collection string
+		wantErr    bool
+	}{
+		{document: "health/canary"},
+		{collection: "users"},
+		{document: "users/1/orders/2", collection: "users/1/orders"},
+		{wantErr: true},
+		{document: "health", wantErr: true},
+		{document: "health//canary", wantErr: true},
+		{collection: "users/1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidatePaths(tt.document, tt.collection); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePaths(%q, %q) = %v, want error %v", tt.document, tt.collection, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	target, _ := fakeFirestore(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	// The token endpoint answers, the API does not.
+	target.Host, target.Port, _ = net.SplitHostPort(addr)
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
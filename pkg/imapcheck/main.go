@@ -0,0 +1,236 @@
+// Package imapcheck checks IMAP servers the way a service reading a mailbox
+// uses them: it logs in and selects the mailbox read-only.
+package imapcheck
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A mailbox that
+// does not exist is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Error is a NO or BAD response of the server to a command.
+type Error struct {
+	// Command is the command that failed, e.g. LOGIN.
+	Command string
+	// Status is NO or BAD.
+	Status string
+	// Message is the text of the response, with its response code, e.g.
+	// [AUTHENTICATIONFAILED] Invalid credentials.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("imap %s %s: %s", e.Command, e.Status, e.Message)
+}
+
+// defaultTimeout limits a check: connecting, LOGIN and SELECT.
+const defaultTimeout = 10 * time.Second
+
+// Check connects to the IMAP server of target, with TLS if target.TLS is
+// set, reads the greeting, logs in as User and selects the mailbox in
+// Database with EXAMINE, so no flags change. The phases are connect, login
+// and select.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	tlsConfig, err := targetTLSConfig(target)
+	if err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	c, err := connect(ctx, target, tlsConfig, o)
+	phases = append(phases, types.Phase{Name: "connect", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error connecting: %w", err))
+	}
+	defer c.conn.Close()
+
+	start = time.Now()
+	err = c.do("LOGIN", quote(target.User), quote(target.Pass))
+	phases = append(phases, types.Phase{Name: "login", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error login: %w", err))
+	}
+
+	start = time.Now()
+	err = c.do("EXAMINE", quote(target.Database))
+	phases = append(phases, types.Phase{Name: "select", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error selecting mailbox %s: %w", target.Database, err))
+	}
+	c.do("LOGOUT")
+	return newResult(phases, nil)
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// targetTLSConfig returns the TLS config of target: its TLSConfig, or one
+// trusting the CA bundle of TLSCAFile, or the system roots if neither is set.
+func targetTLSConfig(target types.Target) (*tls.Config, error) {
+	if !target.TLS {
+		return nil, nil
+	}
+	if target.TLSConfig != nil {
+		return target.TLSConfig.Clone(), nil
+	}
+	config := &tls.Config{ServerName: target.Host}
+	if target.TLSCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return config, nil
+}
+
+// client sends tagged commands over one connection.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// connect opens a connection to target, with TLS if tlsConfig is set, and
+// reads the greeting. The deadline of ctx applies to every command.
+func connect(ctx context.Context, target types.Target, tlsConfig *tls.Config, o checkbase.Options) (*client, error) {
+	conn, err := o.Dial(ctx, "tcp", net.JoinHostPort(target.Host, target.Port))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = target.Host
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	c := &client{conn: conn, reader: bufio.NewReader(conn)}
+	line, err := c.readLine()
+	if err == nil && !strings.HasPrefix(line, "* OK") {
+		err = fmt.Errorf("unexpected greeting %q", line)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// do sends a command and reads the responses up to its tagged completion.
+// Untagged responses are skipped.
+func (c *client) do(command string, args ...string) error {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	line := strings.Join(append([]string{tag, command}, args...), " ")
+	if _, err := io.WriteString(c.conn, line+"\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		rest, found := strings.CutPrefix(line, tag+" ")
+		if !found {
+			continue
+		}
+		status, message, _ := strings.Cut(rest, " ")
+		if status == "OK" {
+			return nil
+		}
+		return &Error{Command: command, Status: status, Message: message}
+	}
+}
+
+func (c *client) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "unknown database".
+func ErrorReason(err error) string {
+	var imapErr *Error
+	if errors.As(err, &imapErr) && imapErr.Status == "NO" {
+		switch imapErr.Command {
+		case "LOGIN":
+			// UNAVAILABLE is a temporary failure of the authentication
+			// backend, not a rejected login.
+			if !strings.HasPrefix(imapErr.Message, "[UNAVAILABLE]") {
+				return "auth error"
+			}
+		case "EXAMINE":
+			if strings.HasPrefix(imapErr.Message, "[NONEXISTENT]") || strings.Contains(strings.ToLower(imapErr.Message), "exist") {
+				return "unknown database"
+			}
+		}
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected logins,
+// missing mailboxes and invalid configs are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package imapcheck
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeIMAP answers like an IMAPS server with the mailboxes INBOX and Orders
+// of the user checker, whose password is secret. loginUnavailable makes the
+// authentication backend fail. It returns the target with a TLS config
+// trusting the server.
+func fakeIMAP(t *testing.T, loginUnavailable bool) types.Target {
+	t.Helper()
+	// The test server is only used for its certificate.
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	certServer.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveIMAP(conn, loginUnavailable)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(certServer.Certificate())
+	target := types.IMAPConfig{Host: host, Port: port, User: "checker", Pass: "secret", Mailbox: "INBOX", TLS: true}.Target()
+	target.TLSConfig = &tls.Config{RootCAs: pool}
+	return target
+}
+
+func serveIMAP(conn net.Conn, loginUnavailable bool) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		io.WriteString(conn, fmt.Sprintf(format, args...)+"\r\n")
+	}
+	reply("* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] Dovecot ready.")
+	loggedIn := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(strings.ReplaceAll(strings.TrimSpace(line), `"`, ""))
+		if len(fields) < 2 {
+			reply("* BAD Error in IMAP command")
+			continue
+		}
+		tag, command, args := fields[0], strings.ToUpper(fields[1]), fields[2:]
+		switch {
+		case command == "LOGIN" && loginUnavailable:
+			reply("%s NO [UNAVAILABLE] Temporary authentication failure.", tag)
+		case command == "LOGIN" && len(args) == 2 && args[0] == "checker" && args[1] == "secret":
+			loggedIn = true
+			reply("%s OK [CAPABILITY IMAP4rev1] Logged in", tag)
+		case command == "LOGIN":
+			reply("%s NO [AUTHENTICATIONFAILED] Authentication failed.", tag)
+		case !loggedIn:
+			reply("%s BAD Error in IMAP command: Not logged in", tag)
+		case command == "EXAMINE" && len(args) == 1 && (args[0] == "INBOX" || args[0] == "Orders"):
+			reply("* 3 EXISTS")
+			reply("* 0 RECENT")
+			reply("%s OK [READ-ONLY] Examine completed.", tag)
+		case command == "EXAMINE":
+			reply("%s NO [NONEXISTENT] Mailbox doesn't exist: %s", tag, strings.Join(args, " "))
+		case command == "LOGOUT":
+			reply("* BYE Logging out")
+			reply("%s OK Logout completed.", tag)
+			return
+		default:
+			reply("%s BAD Error in IMAP command", tag)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name             string
+		loginUnavailable bool
+		modify           func(target *types.Target)
+		wantReason       string
+		wantPhases       []string
+	}{
+		{
+			name:       "inbox",
+			modify:     func(target *types.Target) {},
+			wantPhases: []string{"connect", "login", "select"},
+		},
+		{
+			name:       "other mailbox",
+			modify:     func(target *types.Target) { target.Database = "Orders" },
+			wantPhases: []string{"connect", "login", "select"},
+		},
+		{
+			name:       "missing mailbox",
+			modify:     func(target *types.Target) { target.Database = "Archive" },
+			wantReason: "unknown database",
+			wantPhases: []string{"connect", "login", "select"},
+		},
+		{
+			name:       "wrong password",
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"connect", "login"},
+		},
+		{
+			name:             "authentication backend unavailable",
+			loginUnavailable: true,
+			modify:           func(target *types.Target) {},
+			wantReason:       "error",
+			wantPhases:       []string{"connect", "login"},
+		},
+		{
+			name:       "untrusted certificate",
+			modify:     func(target *types.Target) { target.TLSConfig = nil },
+			wantReason: "tls error",
+			wantPhases: []string{"connect"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeIMAP(t, tt.loginUnavailable)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if retryable := tt.wantReason == "error" || tt.wantReason == "tls error"; tt.wantReason != "" && Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	target := types.IMAPConfig{Host: host, Port: port, User: "checker", Pass: "secret", Mailbox: "INBOX"}.Target()
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
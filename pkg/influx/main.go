@@ -0,0 +1,161 @@
+// Package influx pushes check results in InfluxDB line protocol to an HTTP
+// write endpoint: InfluxDB 1.x (/write?db=...), 2.x
+// (/api/v2/write?org=...&bucket=...) or VictoriaMetrics (/write). Results
+// are buffered and sent in one request per check cycle.
+package influx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// maxBuffered limits the lines kept while the endpoint is unreachable; the
+// oldest are dropped first.
+const maxBuffered = 10000
+
+// Writer buffers one line per check result and writes them to an endpoint
+// on Flush. It is a checker.Sink and safe for concurrent use.
+type Writer struct {
+	url         string
+	measurement string
+	client      *http.Client
+
+	// Token, if set, is sent as "Authorization: Token <Token>", the
+	// InfluxDB 2.x API token. InfluxDB 1.x takes u and p in the URL.
+	Token string
+	// Tags are added to every line, e.g. the owner labels.
+	Tags map[string]string
+
+	mu    sync.Mutex
+	lines []string
+}
+
+// New returns a writer of lines of measurement to url. Every write may take
+// up to timeout.
+func New(url, measurement string, timeout time.Duration) *Writer {
+	return &Writer{url: url, measurement: measurement, client: &http.Client{Timeout: timeout}}
+}
+
+// Observe buffers the line of one check result.
+func (w *Writer) Observe(ctx context.Context, target types.Target, result types.Result) {
+	line := Line(w.measurement, w.Tags, time.Now(), target, result)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, line)
+	if len(w.lines) > maxBuffered {
+		w.lines = w.lines[len(w.lines)-maxBuffered:]
+	}
+}
+
+// Run flushes the buffer every interval until ctx is done.
+func (w *Writer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Flush(ctx); err != nil && ctx.Err() == nil {
+				log.Error("Error writing to InfluxDB", "error", err)
+			}
+		}
+	}
+}
+
+// Flush writes the buffered lines. Lines that could not be written stay in
+// the buffer for the next flush.
+func (w *Writer) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	lines := w.lines
+	w.lines = nil
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err := w.write(ctx, lines); err != nil {
+		w.mu.Lock()
+		w.lines = append(lines, w.lines...)
+		if len(w.lines) > maxBuffered {
+			w.lines = w.lines[len(w.lines)-maxBuffered:]
+		}
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (w *Writer) write(ctx context.Context, lines []string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("influx write: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.Token)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("influx write: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx write: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Line formats one check result, e.g.
+//
+//	db_connection,database=app,host=db,port=3306,type=mysql available=false,duration_seconds=5.001,reason="timeout" 1704110400000000000
+func Line(measurement string, tags map[string]string, now time.Time, target types.Target, result types.Result) string {
+	all := map[string]string{"type": target.Type, "host": target.Host, "port": target.Port, "database": target.Database}
+	for name, value := range tags {
+		all[name] = value
+	}
+	names := make([]string, 0, len(all))
+	for name, value := range all {
+		// Empty tag values are not allowed.
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(escape(measurement, ", "))
+	for _, name := range names {
+		fmt.Fprintf(&b, ",%s=%s", escape(name, ",= "), escape(all[name], ",= "))
+	}
+	fmt.Fprintf(&b, " available=%t,duration_seconds=%g", result.Success, result.Duration().Seconds())
+	if result.Reason != "" {
+		fmt.Fprintf(&b, ",reason=\"%s\"", strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(result.Reason))
+	}
+	fmt.Fprintf(&b, " %d", now.UnixNano())
+	return b.String()
+}
+
+// escape puts a backslash in front of every character of special in s.
+func escape(s, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
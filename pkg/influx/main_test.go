@@ -0,0 +1,99 @@
+package influx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestLine(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	target := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app"}
+
+	tests := []struct {
+		name   string
+		tags   map[string]string
+		target types.Target
+		result types.Result
+		want   string
+	}{
+		{
+			name:   "success",
+			target: target,
+			result: types.Result{Success: true, Phases: []types.Phase{{Name: "connect", Duration: 12 * time.Millisecond}}},
+			want:   "db_connection,database=app,host=db,port=3306,type=mysql available=true,duration_seconds=0.012 1704110400000000000",
+		},
+		{
+			name:   "failure with owner labels",
+			tags:   map[string]string{"team": "payments", "site": "edge 1"},
+			target: target,
+			result: types.Result{Reason: "auth error", Err: errors.New("access denied")},
+			want:   `db_connection,database=app,host=db,port=3306,site=edge\ 1,team=payments,type=mysql available=false,duration_seconds=0,reason="auth error" 1704110400000000000`,
+		},
+		{
+			name:   "escaped tags and empty port",
+			target: types.Target{Type: "mock", Host: "a,b", Database: "x=y"},
+			result: types.Result{Success: true},
+			want:   `db_connection,database=x\=y,host=a\,b,type=mock available=true,duration_seconds=0 1704110400000000000`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Line("db_connection", tt.tags, now, tt.target, tt.result); got != tt.want {
+				t.Errorf("Line() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	fail := true
+	var bodies []string
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w := New(server.URL, "db_connection", time.Second)
+	w.Token = "secret"
+	target := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app"}
+	w.Observe(context.Background(), target, types.Result{Success: true})
+
+	if err := w.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "404 Not Found: bucket not found") {
+		t.Fatalf("Flush() error = %v, want the response", err)
+	}
+
+	// The failed line is written with the next one.
+	fail = false
+	w.Observe(context.Background(), target, types.Result{Reason: "timeout"})
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || strings.Count(bodies[0], "\n") != 2 || !strings.Contains(bodies[0], "available=true") || !strings.Contains(bodies[0], `reason="timeout"`) {
+		t.Errorf("bodies = %q, want both lines in one write", bodies)
+	}
+	if auth != "Token secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	// Nothing is buffered, so nothing is written.
+	if err := w.Flush(context.Background()); err != nil || len(bodies) != 1 {
+		t.Errorf("empty Flush() = %v with %d writes", err, len(bodies))
+	}
+}
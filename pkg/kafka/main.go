@@ -0,0 +1,155 @@
+// Package kafka produces check results as JSON events to a Kafka topic, so
+// event driven incident tooling can consume database availability directly.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Event is the value of every message: the audit log entry of the check,
+// the outcome of the previous check of the target and the owner labels.
+type Event struct {
+	audit.Entry
+	// PreviousOutcome is empty for the first check of the target.
+	PreviousOutcome string            `json:"previous_outcome,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+// messageWriter is the part of kafkago.Writer used by Producer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafkago.Message) error
+	Close() error
+}
+
+// Options configure the connection to the brokers.
+type Options struct {
+	// TLS enables TLS with the system CA bundle.
+	TLS bool
+	// Mechanism is the SASL mechanism used when User is set: plain,
+	// scram-sha-256 or scram-sha-512.
+	Mechanism      string
+	User, Password string
+}
+
+// Producer sends one event per check, or per change of the outcome of a
+// target. It is a checker.Sink and safe for concurrent use.
+type Producer struct {
+	writer messageWriter
+
+	// EveryCheck sends an event for every check instead of only for the
+	// first check of a target and when its outcome changes.
+	EveryCheck bool
+	// Labels are added to every event, e.g. the owner labels.
+	Labels map[string]string
+
+	mu       sync.Mutex
+	outcomes map[string]string
+}
+
+// New returns a producer of events to topic on brokers, given as host:port.
+// Messages are keyed by target, so the events of one target stay in order,
+// and sent in the background; failed sends are logged.
+func New(brokers []string, topic string, options Options) (*Producer, error) {
+	transport := &kafkago.Transport{ClientID: "db-connect-checker", DialTimeout: 10 * time.Second}
+	if options.TLS {
+		transport.TLS = &tls.Config{}
+	}
+	if options.User != "" {
+		mechanism, err := SASLMechanism(options)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	addresses := make([]string, len(brokers))
+	for i, broker := range brokers {
+		addresses[i] = strings.TrimSpace(broker)
+	}
+	writer := &kafkago.Writer{
+		Addr:         kafkago.TCP(addresses...),
+		Topic:        topic,
+		Balancer:     &kafkago.Hash{},
+		RequiredAcks: kafkago.RequireAll,
+		BatchTimeout: 100 * time.Millisecond,
+		WriteTimeout: 10 * time.Second,
+		Async:        true,
+		Transport:    transport,
+		Completion: func(messages []kafkago.Message, err error) {
+			if err != nil {
+				log.Error("Error producing events to Kafka", "topic", topic, "events", len(messages), "error", err)
+			}
+		},
+	}
+	return newProducer(writer), nil
+}
+
+func newProducer(writer messageWriter) *Producer {
+	return &Producer{writer: writer, outcomes: map[string]string{}}
+}
+
+// SASLMechanism returns the SASL mechanism of options, which must have a
+// User.
+func SASLMechanism(options Options) (sasl.Mechanism, error) {
+	switch strings.ToLower(options.Mechanism) {
+	case "", "plain":
+		return plain.Mechanism{Username: options.User, Password: options.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, options.User, options.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, options.User, options.Password)
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism %q, want plain, scram-sha-256 or scram-sha-512", options.Mechanism)
+	}
+}
+
+// Observe sends the event of one check result if it is due.
+func (p *Producer) Observe(ctx context.Context, target types.Target, result types.Result) {
+	event, ok := p.event(time.Now(), target, result)
+	if !ok {
+		return
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		log.Error("Error encoding Kafka event", log.Target(target), "error", err)
+		return
+	}
+	// The check context may end right after the check; the writer sends in
+	// the background anyway.
+	message := kafkago.Message{Key: []byte(event.Target), Value: value, Time: event.Time}
+	if err := p.writer.WriteMessages(context.WithoutCancel(ctx), message); err != nil {
+		log.Error("Error producing event to Kafka", log.Target(target), "error", err)
+	}
+}
+
+// event returns the event of one check and whether it is to be sent.
+func (p *Producer) event(now time.Time, target types.Target, result types.Result) (Event, bool) {
+	event := Event{Entry: audit.NewEntry(now, target, result), Labels: p.Labels}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous, seen := p.outcomes[event.Target]
+	p.outcomes[event.Target] = event.Outcome
+	event.PreviousOutcome = previous
+	return event, p.EveryCheck || !seen || previous != event.Outcome
+}
+
+// Close sends the pending events and closes the connections.
+func (p *Producer) Close() error {
+	return p.writer.Close()
+}
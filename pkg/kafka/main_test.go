@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+type fakeWriter struct {
+	messages []kafkago.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, messages ...kafkago.Message) error {
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func TestObserve(t *testing.T) {
+	db := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app"}
+	cache := types.Target{Type: "mongodb", Host: "mongo", Port: "27017", Database: "cache"}
+	ok, down := types.Result{Success: true}, types.Result{Reason: "timeout"}
+	checks := []struct {
+		target types.Target
+		result types.Result
+	}{
+		{db, ok}, {cache, down}, {db, ok}, {db, down}, {db, down}, {cache, ok},
+	}
+
+	tests := []struct {
+		name       string
+		everyCheck bool
+		want       []string
+	}{
+		{
+			name: "changes",
+			want: []string{
+				"mysql db:3306/app success ",
+				"mongodb mongo:27017/cache failure ",
+				"mysql db:3306/app failure success",
+				"mongodb mongo:27017/cache success failure",
+			},
+		},
+		{
+			name:       "every check",
+			everyCheck: true,
+			want: []string{
+				"mysql db:3306/app success ",
+				"mongodb mongo:27017/cache failure ",
+				"mysql db:3306/app success success",
+				"mysql db:3306/app failure success",
+				"mysql db:3306/app failure failure",
+				"mongodb mongo:27017/cache success failure",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &fakeWriter{}
+			p := newProducer(writer)
+			p.EveryCheck = tt.everyCheck
+			p.Labels = map[string]string{"site": "edge-1"}
+			for _, check := range checks {
+				p.Observe(context.Background(), check.target, check.result)
+			}
+
+			got := []string{}
+			for _, message := range writer.messages {
+				var event Event
+				if err := json.Unmarshal(message.Value, &event); err != nil {
+					t.Fatal(err)
+				}
+				if string(message.Key) != event.Target {
+					t.Errorf("key = %q, want the target %q", message.Key, event.Target)
+				}
+				if event.Labels["site"] != "edge-1" {
+					t.Errorf("labels = %v", event.Labels)
+				}
+				got = append(got, strings.Join([]string{event.Target, event.Outcome, event.PreviousOutcome}, " "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("events =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestNewUnsupportedMechanism(t *testing.T) {
+	_, err := New([]string{"kafka:9092"}, "checks", Options{User: "checker", Mechanism: "gssapi"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported SASL mechanism") {
+		t.Errorf("New() error = %v, want unsupported mechanism", err)
+	}
+}
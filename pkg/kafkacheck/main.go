@@ -0,0 +1,209 @@
+// Package kafkacheck checks Kafka clusters: it connects to the first
+// reachable bootstrap broker, with TLS and SASL if configured, reads the
+// brokers of the cluster from its metadata and optionally fails if a topic
+// the application needs does not exist.
+package kafkacheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/kafka"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A topic that
+// does not exist is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// defaultTimeout limits a check: connecting with TLS and SASL and reading
+// the cluster metadata.
+const defaultTimeout = 10 * time.Second
+
+// Check connects to the brokers in Host, a comma separated list of
+// host:port, in order until one accepts the connection, authenticating with
+// User and Pass and the sasl_mechanism option if User is set. It then reads
+// the brokers of the cluster and, if Database is set, fails unless that
+// topic exists. Topics are never created by the check. The phases are
+// connecting, with TLS and SASL, the metadata and the topic lookup.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	dialer, err := newDialer(target, o)
+	if err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	conn, err := connect(ctx, dialer, target)
+	phases = append(phases, types.Phase{Name: "connect", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error connecting: %w", err))
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	start = time.Now()
+	brokers, err := conn.Brokers()
+	phases = append(phases, types.Phase{Name: "metadata", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error reading metadata: %w", err))
+	}
+	if len(brokers) == 0 {
+		return newResult(phases, errors.New("the cluster metadata lists no brokers"))
+	}
+	if target.Database == "" {
+		return newResult(phases, nil)
+	}
+
+	start = time.Now()
+	err = findTopic(conn, target.Database)
+	phases = append(phases, types.Phase{Name: "topic", Duration: time.Since(start)})
+	return newResult(phases, err)
+}
+
+// newDialer returns the dialer of target with its TLS config and SASL
+// mechanism.
+func newDialer(target types.Target, o checkbase.Options) (*kafkago.Dialer, error) {
+	d := &kafkago.Dialer{ClientID: "db-connect-checker"}
+	if o.Dialer != nil {
+		d.DialFunc = o.Dialer.DialContext
+	}
+	if target.TLS {
+		config, err := targetTLSConfig(target)
+		if err != nil {
+			return nil, err
+		}
+		d.TLS = config
+	}
+	if target.User != "" {
+		mechanism, err := kafka.SASLMechanism(kafka.Options{Mechanism: target.Options["sasl_mechanism"], User: target.User, Password: target.Pass})
+		if err != nil {
+			return nil, err
+		}
+		d.SASLMechanism = mechanism
+	}
+	return d, nil
+}
+
+// connect returns a connection to the first broker of target that accepts
+// one. If none does, the error lists the errors of all of them.
+func connect(ctx context.Context, dialer *kafkago.Dialer, target types.Target) (*kafkago.Conn, error) {
+	var errs []error
+	for _, address := range strings.Split(target.Host, ",") {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", address, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("every broker failed: %w", errors.Join(errs...))
+}
+
+// findTopic returns an error unless topic exists. The partitions of every
+// topic are read, since asking for one topic makes brokers with
+// auto.create.topics.enable create it.
+func findTopic(conn *kafkago.Conn, topic string) error {
+	partitions, err := conn.ReadPartitions()
+	if err != nil {
+		return fmt.Errorf("error reading topics: %w", err)
+	}
+	for _, partition := range partitions {
+		if partition.Topic == topic {
+			return nil
+		}
+	}
+	return util.WithClass(ErrUnknownDatabase, fmt.Errorf("topic %s does not exist", topic))
+}
+
+// targetTLSConfig returns the TLS config of target: its TLSConfig, or one
+// trusting the CA bundle of TLSCAFile, or the system roots if neither is set.
+func targetTLSConfig(target types.Target) (*tls.Config, error) {
+	if target.TLSConfig != nil {
+		return target.TLSConfig.Clone(), nil
+	}
+	config := &tls.Config{}
+	if target.TLSCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return config, nil
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "unknown database".
+func ErrorReason(err error) string {
+	var kafkaErr kafkago.Error
+	if errors.As(err, &kafkaErr) {
+		switch kafkaErr {
+		case kafkago.SASLAuthenticationFailed, kafkago.UnsupportedSASLMechanism, kafkago.IllegalSASLState,
+			kafkago.ClusterAuthorizationFailed, kafkago.TopicAuthorizationFailed:
+			return "auth error"
+		case kafkago.UnknownTopicOrPartition:
+			return "unknown database"
+		}
+	}
+	if errors.Is(err, ErrUnknownDatabase) {
+		return "unknown database"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures, missing topics and invalid configs are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,368 @@
+package kafkacheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/saslauthenticate"
+	"github.com/segmentio/kafka-go/protocol/saslhandshake"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeKafka answers ApiVersions and Metadata requests like a one broker
+// cluster with topics and returns its address.
+func fakeKafka(t *testing.T, topics ...string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	host, portText, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+	response := &metadata.Response{
+		Brokers:      []metadata.ResponseBroker{{NodeID: 1, Host: host, Port: int32(port)}},
+		ControllerID: 1,
+	}
+	for _, topic := range topics {
+		response.Topics = append(response.Topics, metadata.ResponseTopic{
+			Name:       topic,
+			Partitions: []metadata.ResponsePartition{{PartitionIndex: 0, LeaderID: 1, ReplicaNodes: []int32{1}, IsrNodes: []int32{1}}},
+		})
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveKafka(conn, response)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveKafka(conn net.Conn, response *metadata.Response) {
+	defer conn.Close()
+	for {
+		version, id, _, request, err := protocol.ReadRequest(conn)
+		if err != nil {
+			return
+		}
+		var reply protocol.Message
+		switch request.(type) {
+		case *apiversions.Request:
+			reply = &apiversions.Response{ApiKeys: []apiversions.ApiKeyResponse{{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 1}}}
+		case *metadata.Request:
+			reply = response
+		default:
+			return
+		}
+		if err := protocol.WriteResponse(conn, version, id, reply); err != nil {
+			return
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	address := fakeKafka(t, "orders", "payments")
+
+	t.Run("brokers only", func(t *testing.T) {
+		result := Check(context.Background(), types.Target{Type: "kafka", Host: address})
+		if !result.Success {
+			t.Fatalf("Check() = %v, want success", result.Err)
+		}
+		if len(result.Phases) != 2 || result.Phases[0].Name != "connect" || result.Phases[1].Name != "metadata" {
+			t.Errorf("Check() phases = %+v, want connect and metadata", result.Phases)
+		}
+	})
+
+	t.Run("existing topic", func(t *testing.T) {
+		result := Check(context.Background(), types.Target{Type: "kafka", Host: address, Database: "payments"})
+		if !result.Success {
+			t.Fatalf("Check() = %v, want success", result.Err)
+		}
+		if len(result.Phases) != 3 || result.Phases[2].Name != "topic" {
+			t.Errorf("Check() phases = %+v, want a topic phase", result.Phases)
+		}
+	})
+
+	t.Run("missing topic", func(t *testing.T) {
+		result := Check(context.Background(), types.Target{Type: "kafka", Host: address, Database: "invoices"})
+		if result.Success || result.Reason != "unknown database" || !errors.Is(result.Err, ErrUnknownDatabase) {
+			t.Fatalf("Check() = %+v, want an unknown database", result)
+		}
+		if !strings.Contains(result.Err.Error(), "topic invoices does not exist") {
+			t.Errorf("Check() error = %v, want the missing topic", result.Err)
+		}
+		if Retryable(result.Err) {
+			t.Errorf("Retryable(%v) = true, want false", result.Err)
+		}
+	})
+}
+
+// addressDialer fails to connect to every address but the one of a running
+// broker, and records the addresses.
+type addressDialer struct {
+	reachable string
+
+	mu        sync.Mutex
+	addresses []string
+}
+
+func (d *addressDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.addresses = append(d.addresses, address)
+	d.mu.Unlock()
+	if address == d.reachable {
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}
+	return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+}
+
+func TestCheckBootstrapBrokers(t *testing.T) {
+	address := fakeKafka(t)
+
+	t.Run("first reachable broker", func(t *testing.T) {
+		dialer := &addressDialer{reachable: address}
+		result := Check(context.Background(), types.Target{Type: "kafka", Host: "kafka-0:9092," + address + ",kafka-2:9092"}, checkbase.WithDialer(dialer))
+		if !result.Success {
+			t.Fatalf("Check() = %v, want success", result.Err)
+		}
+		if want := []string{"kafka-0:9092", address}; fmt.Sprint(dialer.addresses) != fmt.Sprint(want) {
+			t.Errorf("dialed %v, want %v", dialer.addresses, want)
+		}
+	})
+
+	t.Run("no reachable broker", func(t *testing.T) {
+		dialer := &addressDialer{}
+		result := Check(context.Background(), types.Target{Type: "kafka", Host: "kafka-0:9092,kafka-1:9092"}, checkbase.WithDialer(dialer))
+		if result.Success || result.Reason != "connection refused" {
+			t.Fatalf("Check() = %+v, want connection refused", result)
+		}
+		for _, want := range []string{"every broker failed", "kafka-0:9092", "kafka-1:9092"} {
+			if !strings.Contains(result.Err.Error(), want) {
+				t.Errorf("Check() error = %v, want it to contain %q", result.Err, want)
+			}
+		}
+		if !Retryable(result.Err) {
+			t.Errorf("Retryable(%v) = false, want true", result.Err)
+		}
+	})
+}
+
+// scriptedKafka answers the requests of one check with reply and returns
+// the address of the broker. A nil reply closes the connection. With raw,
+// the broker answers the first request with raw bytes instead.
+func scriptedKafka(t *testing.T, raw string, reply func(request protocol.Message) protocol.Message) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			version, id, _, request, err := protocol.ReadRequest(conn)
+			if err != nil {
+				return
+			}
+			if raw != "" {
+				io.WriteString(conn, raw)
+				return
+			}
+			response := reply(request)
+			if response == nil {
+				return
+			}
+			if err := protocol.WriteResponse(conn, version, id, response); err != nil {
+				return
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// broker answers ApiVersions with the APIs of a check and Metadata with one
+// broker and topics; other requests are passed to next.
+func broker(topics []metadata.ResponseTopic, next func(request protocol.Message) protocol.Message) func(protocol.Message) protocol.Message {
+	return func(request protocol.Message) protocol.Message {
+		switch request.(type) {
+		case *apiversions.Request:
+			return &apiversions.Response{ApiKeys: []apiversions.ApiKeyResponse{
+				{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 1},
+				{ApiKey: int16(protocol.SaslHandshake), MinVersion: 0, MaxVersion: 1},
+				{ApiKey: int16(protocol.SaslAuthenticate), MinVersion: 0, MaxVersion: 0},
+			}}
+		case *metadata.Request:
+			return &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: "127.0.0.1", Port: 9092}}, ControllerID: 1, Topics: topics}
+		}
+		if next == nil {
+			return nil
+		}
+		return next(request)
+	}
+}
+
+func TestCheckProtocolErrors(t *testing.T) {
+	handshake := func(errorCode int16) func(protocol.Message) protocol.Message {
+		return func(request protocol.Message) protocol.Message {
+			if _, ok := request.(*saslhandshake.Request); ok {
+				return &saslhandshake.Response{ErrorCode: errorCode, Mechanisms: []string{"PLAIN"}}
+			}
+			return nil
+		}
+	}
+	tests := []struct {
+		name       string
+		raw        string
+		reply      func(request protocol.Message) protocol.Message
+		sasl       bool
+		topic      string
+		wantReason string
+		wantErr    string
+		wantPhases []string
+	}{
+		{
+			name:       "not a Kafka broker",
+			raw:        "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n",
+			wantReason: "error",
+			wantPhases: []string{"connect", "metadata"},
+		},
+		{
+			name:       "closed on metadata",
+			reply:      func(protocol.Message) protocol.Message { return nil },
+			wantReason: "error",
+			wantErr:    "EOF",
+			wantPhases: []string{"connect", "metadata"},
+		},
+		{
+			name:       "SASL mechanism not enabled",
+			reply:      broker(nil, handshake(int16(kafkago.UnsupportedSASLMechanism))),
+			sasl:       true,
+			wantReason: "auth error",
+			wantErr:    "SASL handshake failed",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name: "SASL credentials rejected",
+			reply: broker(nil, func(request protocol.Message) protocol.Message {
+				if _, ok := request.(*saslauthenticate.Request); ok {
+					return &saslauthenticate.Response{ErrorCode: int16(kafkago.SASLAuthenticationFailed), ErrorMessage: "Authentication failed: Invalid username or password"}
+				}
+				return handshake(0)(request)
+			}),
+			sasl:       true,
+			wantReason: "auth error",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "closed during SASL",
+			reply:      broker(nil, handshake(0)),
+			sasl:       true,
+			wantReason: "auth error",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "topics not authorized",
+			reply:      broker([]metadata.ResponseTopic{{Name: "orders", ErrorCode: int16(kafkago.TopicAuthorizationFailed)}}, nil),
+			topic:      "orders",
+			wantReason: "auth error",
+			wantErr:    "error reading topics",
+			wantPhases: []string{"connect", "metadata", "topic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := types.Target{Type: "kafka", Host: scriptedKafka(t, tt.raw, tt.reply), Database: tt.topic}
+			if tt.sasl {
+				target.User, target.Pass, target.Options = "app", "secret", map[string]string{"sasl_mechanism": "plain"}
+			}
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Success || result.Reason != tt.wantReason {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want it to mention %q", result.Err, tt.wantErr)
+			}
+			if retryable := tt.wantReason != "auth error"; Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
+
+func TestCheckInvalidConfig(t *testing.T) {
+	for name, target := range map[string]types.Target{
+		"unknown SASL mechanism": {Type: "kafka", Host: "kafka:9092", User: "app", Pass: "secret", Options: map[string]string{"sasl_mechanism": "gssapi"}},
+		"missing CA file":        {Type: "kafka", Host: "kafka:9092", TLS: true, TLSCAFile: "/nonexistent/ca.pem"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dialer := &addressDialer{}
+			result := Check(context.Background(), target, checkbase.WithDialer(dialer))
+			if result.Success || result.Reason != "invalid config" || !retry.IsPermanent(result.Err) {
+				t.Errorf("Check() = %+v, want an invalid config", result)
+			}
+			if len(dialer.addresses) != 0 {
+				t.Errorf("dialed %v, want no connection", dialer.addresses)
+			}
+		})
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	tests := []struct {
+		err       error
+		want      string
+		retryable bool
+	}{
+		{fmt.Errorf("error connecting: %w", kafkago.SASLAuthenticationFailed), "auth error", false},
+		{fmt.Errorf("error reading topics: %w", kafkago.TopicAuthorizationFailed), "auth error", false},
+		{kafkago.UnknownTopicOrPartition, "unknown database", false},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, "connection refused", true},
+		{&net.DNSError{Err: "no such host", Name: "kafka", IsNotFound: true}, "dns error", true},
+		{context.DeadlineExceeded, "timeout", true},
+		{kafkago.LeaderNotAvailable, "error", true},
+	}
+	for _, tt := range tests {
+		if got := ErrorReason(tt.err); got != tt.want {
+			t.Errorf("ErrorReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+		if got := Retryable(tt.err); got != tt.retryable {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.retryable)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/tapclap/db-connect-checker/pkg/message"
+)
+
+// EventPublisher posts database check results as Events on a workload
+// (pod, deployment, statefulset or daemonset), so that the root cause of a
+// failing application shows up in kubectl describe of that workload.
+// Only changes are published: a Warning when a database becomes unreachable
+// or fails for a different reason, and a Normal Event when it recovers.
+type EventPublisher struct {
+	client kubernetes.Interface
+	ref    corev1.ObjectReference
+
+	// template renders the message of DatabaseUnreachable Events if set.
+	template *message.Template
+	// annotations are added to every Event.
+	annotations map[string]string
+
+	mu      sync.Mutex
+	failing map[string]string
+}
+
+// NewEventPublisher resolves target, given as kind/name (e.g.
+// deployment/orders-api), in namespace.
+func NewEventPublisher(ctx context.Context, client kubernetes.Interface, namespace, target string) (*EventPublisher, error) {
+	kind, name, ok := strings.Cut(target, "/")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("event target %q must be kind/name", target)
+	}
+
+	var object metav1.Object
+	var err error
+	ref := corev1.ObjectReference{Namespace: namespace, Name: name}
+	switch strings.ToLower(kind) {
+	case "pod":
+		ref.APIVersion, ref.Kind = "v1", "Pod"
+		object, err = client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "deployment":
+		ref.APIVersion, ref.Kind = "apps/v1", "Deployment"
+		object, err = client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "statefulset":
+		ref.APIVersion, ref.Kind = "apps/v1", "StatefulSet"
+		object, err = client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "daemonset":
+		ref.APIVersion, ref.Kind = "apps/v1", "DaemonSet"
+		object, err = client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported event target kind %q, want pod, deployment, statefulset or daemonset", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get event target %s/%s: %w", namespace, target, err)
+	}
+	ref.UID = object.GetUID()
+
+	return &EventPublisher{
+		client:  client,
+		ref:     ref,
+		failing: map[string]string{},
+	}, nil
+}
+
+// SetTemplate renders the messages of DatabaseUnreachable Events with t. The
+// database is passed as Target, the failure reason as both Error and Reason
+// and the labels set by SetLabels as Labels.
+func (p *EventPublisher) SetTemplate(t *message.Template) {
+	p.template = t
+}
+
+// SetLabels adds labels (OWNER_LABELS) to every Event as annotations, so
+// Events of different clusters and teams can be told apart once collected.
+// Annotations are used because label values are too restricted for
+// arbitrary values.
+func (p *EventPublisher) SetLabels(labels map[string]string) {
+	p.annotations = labels
+}
+
+// unreachableMessage describes a failure of database.
+func (p *EventPublisher) unreachableMessage(database, reason string) string {
+	if p.template != nil {
+		text, err := p.template.Execute(message.Fields{Target: database, Error: reason, Reason: reason, Labels: p.annotations})
+		if err == nil {
+			return text
+		}
+	}
+	return fmt.Sprintf("database %s unreachable: %s", database, reason)
+}
+
+// Publish records the result of one check of database. An empty reason
+// means the check succeeded.
+func (p *EventPublisher) Publish(ctx context.Context, database, reason string) error {
+	p.mu.Lock()
+	previous, wasFailing := p.failing[database]
+	if reason == "" {
+		delete(p.failing, database)
+	} else {
+		p.failing[database] = reason
+	}
+	p.mu.Unlock()
+
+	switch {
+	case reason != "" && (!wasFailing || previous != reason):
+		return p.Warning(ctx, "DatabaseUnreachable", p.unreachableMessage(database, reason))
+	case reason == "" && wasFailing:
+		return p.event(ctx, corev1.EventTypeNormal, "DatabaseReachable", fmt.Sprintf("database %s is reachable again", database))
+	}
+	return nil
+}
+
+// Report publishes a whole round of checks given as failing databases and
+// their reasons; databases missing from failing are treated as reachable.
+func (p *EventPublisher) Report(ctx context.Context, failing map[string]string) error {
+	p.mu.Lock()
+	var recovered []string
+	for database := range p.failing {
+		if _, ok := failing[database]; !ok {
+			recovered = append(recovered, database)
+		}
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, database := range recovered {
+		if err := p.Publish(ctx, database, ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for database, reason := range failing {
+		if err := p.Publish(ctx, database, reason); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Warning posts a Warning Event unconditionally.
+func (p *EventPublisher) Warning(ctx context.Context, reason, message string) error {
+	return p.event(ctx, corev1.EventTypeWarning, reason, message)
+}
+
+func (p *EventPublisher) event(ctx context.Context, eventType, reason, message string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s.%x", p.ref.Name, now.UnixNano()),
+			Namespace:   p.ref.Namespace,
+			Annotations: p.annotations,
+		},
+		InvolvedObject: p.ref,
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         corev1.EventSource{Component: "db-connect-checker"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := p.client.CoreV1().Events(p.ref.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot create event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tapclap/db-connect-checker/pkg/message"
+)
+
+func TestNewEventPublisher(t *testing.T) {
+	client := kubefake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-api", Namespace: "shop", UID: "uid-1"},
+	})
+
+	tests := []struct {
+		name    string
+		target  string
+		wantErr bool
+	}{
+		{name: "deployment", target: "deployment/orders-api"},
+		{name: "kind is case insensitive", target: "Deployment/orders-api"},
+		{name: "missing name", target: "deployment", wantErr: true},
+		{name: "unsupported kind", target: "service/orders-api", wantErr: true},
+		{name: "missing object", target: "pod/orders-api-0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher, err := NewEventPublisher(context.Background(), client, "shop", tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("NewEventPublisher() expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewEventPublisher() unexpected error: %v", err)
+			}
+			if publisher.ref.UID != "uid-1" || publisher.ref.Kind != "Deployment" {
+				t.Errorf("resolved reference %+v, want Deployment with uid-1", publisher.ref)
+			}
+		})
+	}
+}
+
+func TestEventPublisherPublishesChanges(t *testing.T) {
+	ctx := context.Background()
+	client := kubefake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-api", Namespace: "shop"},
+	})
+	publisher, err := NewEventPublisher(ctx, client, "shop", "deployment/orders-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name       string
+		failing    map[string]string
+		wantEvents []string
+	}{
+		{
+			name:       "first failure",
+			failing:    map[string]string{"orders-db": "auth error"},
+			wantEvents: []string{"Warning database orders-db unreachable: auth error"},
+		},
+		{
+			name:    "same failure is not repeated",
+			failing: map[string]string{"orders-db": "auth error"},
+		},
+		{
+			name:       "new reason",
+			failing:    map[string]string{"orders-db": "timeout"},
+			wantEvents: []string{"Warning database orders-db unreachable: timeout"},
+		},
+		{
+			name:       "recovery",
+			failing:    map[string]string{},
+			wantEvents: []string{"Normal database orders-db is reachable again"},
+		},
+	}
+
+	seen := 0
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := publisher.Report(ctx, step.failing); err != nil {
+				t.Fatalf("Report() unexpected error: %v", err)
+			}
+			events, err := client.CoreV1().Events("shop").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events.Items[seen:] {
+				got = append(got, event.Type+" "+event.Message)
+				if event.InvolvedObject.Kind != "Deployment" || event.InvolvedObject.Name != "orders-api" {
+					t.Errorf("event involves %s/%s, want Deployment/orders-api", event.InvolvedObject.Kind, event.InvolvedObject.Name)
+				}
+			}
+			seen = len(events.Items)
+
+			if len(got) != len(step.wantEvents) {
+				t.Fatalf("new events %q, want %q", got, step.wantEvents)
+			}
+			for i := range got {
+				if got[i] != step.wantEvents[i] {
+					t.Errorf("event %d = %q, want %q", i, got[i], step.wantEvents[i])
+				}
+			}
+		})
+	}
+
+	if err := publisher.Warning(ctx, "DatabaseWaitFailed", "timed out"); err != nil {
+		t.Fatal(err)
+	}
+	events, _ := client.CoreV1().Events("shop").List(ctx, metav1.ListOptions{})
+	last := events.Items[len(events.Items)-1]
+	if last.Type != corev1.EventTypeWarning || last.Reason != "DatabaseWaitFailed" {
+		t.Errorf("Warning() created %s/%s", last.Type, last.Reason)
+	}
+}
+
+func TestEventPublisherTemplate(t *testing.T) {
+	ctx := context.Background()
+	client := kubefake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-api", Namespace: "shop"},
+	})
+	publisher, err := NewEventPublisher(ctx, client, "shop", "deployment/orders-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := message.Parse("notify", "DB DOWN {{.Target}} ({{.Reason}}) in {{.Labels.cluster}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher.SetTemplate(tmpl)
+	publisher.SetLabels(map[string]string{"cluster": "eu-1"})
+
+	if err := publisher.Publish(ctx, "orders-db", "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(ctx, "orders-db", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := client.CoreV1().Events("shop").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DB DOWN orders-db (timeout) in eu-1", "database orders-db is reachable again"}
+	if len(events.Items) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events.Items), len(want))
+	}
+	for i, event := range events.Items {
+		if event.Message != want[i] {
+			t.Errorf("event %d = %q, want %q", i, event.Message, want[i])
+		}
+		if event.Annotations["cluster"] != "eu-1" {
+			t.Errorf("event %d annotations = %v, want cluster=eu-1", i, event.Annotations)
+		}
+	}
+}
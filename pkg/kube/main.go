@@ -0,0 +1,51 @@
+package kube
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Config returns the in-cluster configuration of the pod's service account,
+// falling back to KUBECONFIG (or ~/.kube/config) when running outside a cluster.
+func Config() (*rest.Config, error) {
+	config, err := rest.InClusterConfig()
+	if err == nil {
+		return config, nil
+	}
+
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		home, _ := os.UserHomeDir()
+		kubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load kubernetes config: %v", err)
+	}
+	return config, nil
+}
+
+// Clients returns a typed client for core resources and a dynamic client for
+// custom resources.
+func Clients() (kubernetes.Interface, dynamic.Interface, error) {
+	config, err := Config()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create kubernetes client: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create kubernetes dynamic client: %v", err)
+	}
+	return clientset, dynamicClient, nil
+}
@@ -0,0 +1,101 @@
+// Package labels resolves ownership labels (team, namespace, node, ...)
+// attached to every metric and notification of the checker. Values may come
+// from the environment or from files of a Kubernetes downward API volume, so
+// one image reports correctly attributed data in every cluster.
+package labels
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parse resolves a comma separated list of name=value pairs. A value is
+//
+//   - a literal, e.g. team=payments;
+//   - expanded from the environment where it contains $VAR or ${VAR}, e.g.
+//     namespace=${POD_NAMESPACE} with POD_NAMESPACE set by a fieldRef;
+//   - file:<path>, the content of a file, e.g.
+//     node=file:/etc/podinfo/nodename;
+//   - file:<path>#<key>, one entry of a downward API labels or annotations
+//     file (key="value" per line), e.g. app=file:/etc/podinfo/labels#app.
+//
+// Names must be valid Prometheus label names. A value that resolves to an
+// empty string is an error, as it usually means the downward API is not
+// configured.
+func Parse(spec string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("label %q must be name=value", pair)
+		}
+		if !namePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("invalid label name %q", name)
+		}
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("label %s is set twice", name)
+		}
+
+		value, err := resolve(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %v", name, err)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("label %s: value %q is empty", name, raw)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+func resolve(raw string) (string, error) {
+	path, ok := strings.CutPrefix(raw, "file:")
+	if !ok {
+		return os.ExpandEnv(raw), nil
+	}
+
+	path, key, hasKey := strings.Cut(path, "#")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !hasKey {
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || name != key {
+			continue
+		}
+		// The downward API writes values as Go quoted strings.
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("%s has no %s", path, key)
+}
+
+// String formats labels as sorted name=value pairs, for logs.
+func String(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,61 @@
+package labels
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "nodename"), []byte("node-1\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "labels"), []byte("app=\"orders-api\"\nteam=\"payments \\\"core\\\"\"\n"), 0o644)
+	t.Setenv("POD_NAMESPACE", "shop")
+	t.Setenv("CLUSTER", "")
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "empty", spec: "", want: map[string]string{}},
+		{name: "literal", spec: "team=payments", want: map[string]string{"team": "payments"}},
+		{name: "environment", spec: "namespace=${POD_NAMESPACE}, env=prod-$POD_NAMESPACE", want: map[string]string{"namespace": "shop", "env": "prod-shop"}},
+		{name: "file", spec: "node=file:" + filepath.Join(dir, "nodename"), want: map[string]string{"node": "node-1"}},
+		{name: "downward api labels file", spec: "app=file:" + filepath.Join(dir, "labels") + "#app,team=file:" + filepath.Join(dir, "labels") + "#team", want: map[string]string{"app": "orders-api", "team": `payments "core"`}},
+		{name: "missing key", spec: "owner=file:" + filepath.Join(dir, "labels") + "#owner", wantErr: "has no owner"},
+		{name: "missing file", spec: "node=file:" + filepath.Join(dir, "missing"), wantErr: "no such file"},
+		{name: "unset variable", spec: "cluster=${CLUSTER}", wantErr: "label cluster: value \"${CLUSTER}\" is empty"},
+		{name: "no value", spec: "team", wantErr: "must be name=value"},
+		{name: "invalid name", spec: "team-name=payments", wantErr: "invalid label name"},
+		{name: "reserved name", spec: "__name__=x", wantErr: "invalid label name"},
+		{name: "duplicate", spec: "team=a,team=b", wantErr: "set twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	if got := String(map[string]string{"team": "payments", "namespace": "shop"}); got != "namespace=shop,team=payments" {
+		t.Errorf("String() = %q", got)
+	}
+}
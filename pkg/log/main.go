@@ -0,0 +1,98 @@
+// Package log writes the diagnostic output of the checker as structured
+// records, in logfmt-style text or as JSON lines, filtered by level
+// (LOG_FORMAT and LOG_LEVEL). Records about a database carry the same
+// fields everywhere, see Target:
+//
+//	log.Warn("Connection attempt failed", log.Target(target), "attempt", 2, "error", err)
+//
+// Output meant for a person, such as the result of validate or the
+// summary table, is not a log and is printed as before.
+package log
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Formats and Levels are the accepted values of LOG_FORMAT and LOG_LEVEL.
+var (
+	Formats = []string{"text", "json"}
+	Levels  = []string{"debug", "info", "warn", "error"}
+)
+
+var logger = slog.New(slog.NewTextHandler(stderr{}, nil))
+
+// stderr writes to the current os.Stderr, which the progress view replaces
+// while it is shown.
+type stderr struct{}
+
+func (stderr) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+// New returns a logger writing records of level and above to w in format.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil || !slices.Contains(Levels, level) {
+		return nil, fmt.Errorf("unknown log level %q, want one of %s", level, strings.Join(Levels, ", "))
+	}
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: formatDuration}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, want one of %s", format, strings.Join(Formats, ", "))
+}
+
+// formatDuration writes durations as "4s" rather than as nanoseconds, which
+// is what the JSON handler does.
+func formatDuration(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindDuration {
+		attr.Value = slog.StringValue(attr.Value.Duration().String())
+	}
+	return attr
+}
+
+// Configure makes the package functions, and the standard library's
+// default logger, write to stderr in format from level up.
+func Configure(format, level string) error {
+	configured, err := New(stderr{}, format, level)
+	if err != nil {
+		return err
+	}
+	logger = configured
+	slog.SetDefault(configured)
+	return nil
+}
+
+// Target returns the fields identifying target: db_type, host, port and
+// database, leaving out empty ones. Its attributes are added to the record
+// directly, not as a group.
+func Target(target types.Target) slog.Attr {
+	attrs := []slog.Attr{slog.String("db_type", target.Type), slog.String("host", target.Host)}
+	if target.Port != "" {
+		attrs = append(attrs, slog.String("port", target.Port))
+	}
+	if target.Database != "" {
+		attrs = append(attrs, slog.String("database", target.Database))
+	}
+	return slog.Attr{Key: "", Value: slog.GroupValue(attrs...)}
+}
+
+// Debug, Info, Warn and Error log msg with the key-value pairs or
+// slog.Attr values of args.
+func Debug(msg string, args ...any) { logger.Debug(msg, args...) }
+
+func Info(msg string, args ...any) { logger.Info(msg, args...) }
+
+func Warn(msg string, args ...any) { logger.Warn(msg, args...) }
+
+func Error(msg string, args ...any) { logger.Error(msg, args...) }
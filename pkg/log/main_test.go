@@ -0,0 +1,79 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	target := types.Target{Type: "mysql", Host: "orders-db", Port: "3306", Database: "orders"}
+	logger.Info("Connect success", Target(target))
+	logger.Warn("Connection attempt failed", Target(target), "attempt", 2, "sleep", 4*time.Second, "error", errors.New("connection refused"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %q, want only the warning", buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("record %q is not JSON: %v", lines[0], err)
+	}
+	want := map[string]any{
+		"level":    "WARN",
+		"msg":      "Connection attempt failed",
+		"db_type":  "mysql",
+		"host":     "orders-db",
+		"port":     "3306",
+		"database": "orders",
+		"attempt":  float64(2),
+		"sleep":    "4s",
+		"error":    "connection refused",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("record[%q] = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestNewText(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "text", "debug")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	logger.Debug("Discovered MongoDB configuration", Target(types.Target{Type: "mongodb", Host: "mongo-0:27017,mongo-1:27017"}))
+
+	line := buf.String()
+	for _, want := range []string{"level=DEBUG", `msg="Discovered MongoDB configuration"`, "db_type=mongodb", "host=mongo-0:27017,mongo-1:27017"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("logged %q, want it to contain %q", line, want)
+		}
+	}
+	// Empty fields are left out.
+	if strings.Contains(line, "port=") || strings.Contains(line, "database=") {
+		t.Errorf("logged %q, want no port and database", line)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil || !strings.Contains(err.Error(), "unknown log format") {
+		t.Errorf("New(xml) error = %v, want an unknown log format", err)
+	}
+	for _, level := range []string{"verbose", "INFO", "debug+2"} {
+		if _, err := New(&bytes.Buffer{}, "text", level); err == nil || !strings.Contains(err.Error(), "unknown log level") {
+			t.Errorf("New(%s) error = %v, want an unknown log level", level, err)
+		}
+	}
+}
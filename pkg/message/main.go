@@ -0,0 +1,92 @@
+// Package message renders user supplied text/template templates for log lines
+// and notifications, so their format can match existing tooling.
+package message
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+)
+
+// Fields are the values available to templates. Fields that do not apply
+// to a message are zero, e.g. Attempt in notifications about the exporter.
+type Fields struct {
+	// Target is the type and address of the database, e.g.
+	// "mysql db:3306/app".
+	Target string
+	// Attempt is the number of the attempt, starting at 1, out of Tries.
+	Attempt int
+	Tries   int
+	// Error is the error message, empty if the check succeeded.
+	Error string
+	// Reason is the error class, e.g. "timeout" or "auth error".
+	Reason string
+	// Severity is how bad an outage of the database is: critical, warning
+	// or info.
+	Severity string
+	// Duration is how long the check took.
+	Duration time.Duration
+	// Sleep is the pause before the next attempt.
+	Sleep time.Duration
+	// Labels are the ownership labels of the checker (OWNER_LABELS), e.g.
+	// {{.Labels.namespace}}. Filled from SetLabels if not set.
+	Labels map[string]string
+}
+
+// Template is a parsed template.
+type Template struct {
+	tmpl   *template.Template
+	labels map[string]string
+}
+
+// Parse parses text and renders it once with example fields, so references
+// to unknown fields are reported here rather than on the first message.
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	t := &Template{tmpl: tmpl}
+	example := Fields{Target: "mysql db:3306/app", Attempt: 1, Tries: 10, Error: "dial tcp: connection refused", Reason: "connection refused", Severity: "critical", Duration: time.Millisecond, Sleep: time.Second}
+	if _, err := t.Execute(example); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetLabels sets the Labels of every message rendered by t.
+func (t *Template) SetLabels(labels map[string]string) {
+	t.labels = labels
+}
+
+// Execute renders the template with fields. Trailing newlines are removed,
+// the caller adds its own.
+func (t *Template) Execute(fields Fields) (string, error) {
+	if fields.Labels == nil {
+		fields.Labels = t.labels
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("invalid template: %v", err)
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// Log prints the rendered line to stderr if fields.Error is set, otherwise
+// to stdout.
+func (t *Template) Log(fields Fields) {
+	line, err := t.Execute(fields)
+	if err != nil {
+		log.Error("Error executing template", "template", t.tmpl.Name(), "error", err)
+		return
+	}
+	if fields.Error != "" {
+		fmt.Fprintln(os.Stderr, line)
+	} else {
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,45 @@
+package message
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	fields := Fields{Target: "mysql db:3306/app", Attempt: 2, Tries: 5, Error: "i/o timeout", Reason: "timeout", Duration: 1500 * time.Millisecond, Sleep: 2 * time.Second}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{name: "all fields", text: "{{.Target}} {{.Attempt}}/{{.Tries}} {{.Reason}}: {{.Error}} in {{.Duration}}, next in {{.Sleep}}", want: "mysql db:3306/app 2/5 timeout: i/o timeout in 1.5s, next in 2s"},
+		{name: "methods of fields", text: "duration_ms={{.Duration.Milliseconds}}", want: "duration_ms=1500"},
+		{name: "conditionals", text: "{{if .Error}}FAIL{{else}}OK{{end}} {{.Target}}", want: "FAIL mysql db:3306/app"},
+		{name: "labels", text: "{{.Target}} team={{.Labels.team}}", want: "mysql db:3306/app team=payments"},
+		{name: "trailing newline is removed", text: "{{.Target}}\n", want: "mysql db:3306/app"},
+		{name: "syntax error", text: "{{.Target", wantErr: true},
+		{name: "unknown field", text: "{{.Host}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse("test", tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			tmpl.SetLabels(map[string]string{"team": "payments"})
+			got, err := tmpl.Execute(fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
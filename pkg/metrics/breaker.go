@@ -0,0 +1,56 @@
+package metrics
+
+import "time"
+
+// breaker - автоматический выключатель проверок одной базы. После threshold
+// неудачных проверок подряд он размыкается, и база не проверяется cooldown.
+// Затем выполняется одна пробная проверка (half-open): успех замыкает
+// выключатель, неудача снова размыкает его на вдвое больший срок, но не
+// больше maxCooldown. Так экспортер не копит долгие таймауты подключения к
+// базе, о которой уже известно, что она недоступна.
+type breaker struct {
+	threshold   int
+	cooldown    time.Duration
+	maxCooldown time.Duration
+
+	failures  int
+	current   time.Duration
+	openUntil time.Time
+}
+
+// allow сообщает, нужно ли проверять базу в момент now.
+func (b *breaker) allow(now time.Time) bool {
+	return b.threshold <= 0 || !now.Before(b.openUntil)
+}
+
+// open сообщает, разомкнут ли выключатель (включая ожидание пробной проверки).
+func (b *breaker) open() bool {
+	return b.threshold > 0 && b.failures >= b.threshold
+}
+
+// record учитывает результат проверки, выполненной в момент now.
+func (b *breaker) record(success bool, now time.Time) {
+	if b.threshold <= 0 {
+		return
+	}
+	if success {
+		b.failures = 0
+		b.current = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	if b.failures < b.threshold {
+		return
+	}
+	if b.current == 0 {
+		b.current = b.cooldown
+	} else {
+		b.current *= 2
+	}
+	if b.maxCooldown > 0 && b.current > b.maxCooldown {
+		b.current = b.maxCooldown
+	}
+	b.openUntil = now.Add(b.current)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := &breaker{threshold: 3, cooldown: time.Minute, maxCooldown: 3 * time.Minute}
+
+	steps := []struct {
+		name      string
+		at        time.Duration
+		success   bool
+		wantAllow bool
+		wantOpen  bool
+	}{
+		{name: "first failure", at: 0, wantAllow: true},
+		{name: "second failure", at: 30 * time.Second, wantAllow: true},
+		{name: "third failure opens", at: time.Minute, wantAllow: false, wantOpen: true},
+		{name: "probe fails, cooldown doubles", at: 2 * time.Minute, wantAllow: false, wantOpen: true},
+		{name: "probe fails, cooldown capped", at: 4 * time.Minute, wantAllow: false, wantOpen: true},
+		{name: "probe succeeds, closes", at: 7 * time.Minute, success: true, wantAllow: true},
+	}
+
+	for _, step := range steps {
+		now := start.Add(step.at)
+		if !b.allow(now) {
+			t.Fatalf("%s: check not allowed at %v", step.name, step.at)
+		}
+		b.record(step.success, now)
+
+		if got := b.allow(now.Add(time.Second)); got != step.wantAllow {
+			t.Errorf("%s: allow() right after = %v, want %v", step.name, got, step.wantAllow)
+		}
+		if got := b.open(); got != step.wantOpen {
+			t.Errorf("%s: open() = %v, want %v", step.name, got, step.wantOpen)
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := &breaker{}
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		b.record(false, now)
+	}
+	if !b.allow(now) || b.open() {
+		t.Error("disabled breaker should always allow checks")
+	}
+}
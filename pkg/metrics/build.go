@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// NewBuildInfoCollector возвращает метрику db_connect_checker_build_info,
+// значение которой всегда равно 1, а версия сборки передается в labels.
+func NewBuildInfoCollector() prometheus.Collector {
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "db_connect_checker_build_info",
+		Help: "A metric with a constant '1' value labeled by version, commit, build date and Go version of the checker",
+		ConstLabels: prometheus.Labels{
+			"version":   version.Version,
+			"commit":    version.Commit,
+			"date":      version.Date,
+			"goversion": runtime.Version(),
+		},
+	})
+	buildInfo.Set(1)
+	return buildInfo
+}
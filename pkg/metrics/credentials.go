@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// SetCredentialRefresh включает повторное чтение пользователя и пароля баз,
+// прочитанных из записи TARGETS_DIR (Target.CredentialsFile): перед
+// проверкой, если они прочитаны больше ttl назад, и сразу после ошибки
+// авторизации. Если после ошибки авторизации пароль оказался новым,
+// проверка сразу повторяется с ним, поэтому плановая ротация пароля в
+// Secret или в менеджере секретов не вызывает ложных алертов "auth error".
+// 0 выключает повторное чтение. Вызывается до Start.
+func (e *MultiMySQLExporter) SetCredentialRefresh(ttl time.Duration) {
+	e.credentialTTL = ttl
+}
+
+// refreshCredentials перечитывает пользователя и пароль базы с индексом i,
+// если они прочитаны больше e.credentialTTL назад или force. Возвращает
+// базу с текущими учетными данными и true, если они изменились.
+// Вызывается под e.mu.
+func (e *MultiMySQLExporter) refreshCredentials(i int, force bool) (types.Target, bool) {
+	target := e.targets[i]
+	if e.credentialTTL <= 0 || target.CredentialsFile == "" {
+		return target, false
+	}
+	now := e.clock.Now()
+	if !force && now.Sub(e.credentialsReadAt[i]) < e.credentialTTL {
+		return target, false
+	}
+	e.credentialsReadAt[i] = now
+
+	credential, err := util.ReadMysqlCredentials(target.CredentialsFile)
+	if err != nil {
+		// Пока Kubernetes обновляет Secret, файлов может не быть; проверка
+		// идет с прежними учетными данными.
+		log.Error("Error reading credentials", log.Target(target), "error", err)
+		return target, false
+	}
+	if credential.User == target.User && credential.Pass == target.Pass {
+		return target, false
+	}
+	target.User, target.Pass = credential.User, credential.Pass
+	e.targets[i] = target
+	log.Info("Credentials changed, using the new ones", log.Target(target), "file", target.CredentialsFile)
+	return target, true
+}
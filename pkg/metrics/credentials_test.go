@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestCredentialRefresh(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.env")
+	rotate := func(pass string) {
+		if err := os.WriteFile(file, []byte("MYSQL_USER=app\nMYSQL_PASS="+pass+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotate("old")
+
+	// The mock targets ignore the password: "rejected" fails with an auth
+	// error whatever it is, "healthy" always connects.
+	rejected := types.MockConfig{Name: "rejected", Result: "failure", Reason: "auth error"}.Target()
+	healthy := types.MockConfig{Name: "healthy", Result: "success"}.Target()
+	for _, target := range []*types.Target{&rejected, &healthy} {
+		target.User, target.Pass, target.CredentialsFile = "app", "old", file
+	}
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	exporter := NewExporter([]types.Target{rejected, healthy}, time.Hour)
+	exporter.SetClock(fake)
+	exporter.SetCredentialRefresh(time.Minute)
+	checks := map[string][]string{}
+	exporter.AddSink(checker.SinkFunc(func(ctx context.Context, target types.Target, result types.Result) {
+		checks[target.Database] = append(checks[target.Database], target.Pass)
+	}))
+
+	exporter.performChecks([]int{0})
+	if len(checks["rejected"]) != 1 {
+		t.Fatalf("unchanged password checked %v, want one check", checks["rejected"])
+	}
+
+	// An auth error reads the password again at once and checks with the
+	// new one.
+	rotate("new")
+	exporter.performChecks([]int{0})
+	if got := checks["rejected"]; len(got) != 3 || got[1] != "old" || got[2] != "new" {
+		t.Errorf("rotated password checked with %v, want old, old, new", got)
+	}
+
+	// Without errors it is read again once the TTL has passed.
+	exporter.performChecks([]int{1})
+	rotate("newer")
+	fake.Advance(59 * time.Second)
+	exporter.performChecks([]int{1})
+	fake.Advance(time.Second)
+	exporter.performChecks([]int{1})
+	if got := checks["healthy"]; len(got) != 3 || got[1] != "new" || got[2] != "newer" {
+		t.Errorf("healthy target checked with %v, want new, new, newer", got)
+	}
+
+	// A missing file keeps the last password.
+	os.Remove(file)
+	fake.Advance(time.Minute)
+	exporter.performChecks([]int{1})
+	if got := checks["healthy"]; got[len(got)-1] != "newer" {
+		t.Errorf("checked with %q after the file was removed, want newer", got[len(got)-1])
+	}
+}
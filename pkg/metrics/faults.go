@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reasonSimulated - класс ошибки у проверок, сорванных FaultInjector.
+const reasonSimulated = "simulated failure"
+
+var errSimulated = errors.New("failure simulated by fault injection")
+
+// FaultWindow - ежедневный интервал локального времени, в который проверки
+// базы Target (в виде host:port/database) считаются неудачными. Интервал
+// может переходить через полночь, например 23:50-00:10.
+type FaultWindow struct {
+	Target string
+	From   time.Duration
+	To     time.Duration
+}
+
+func (w FaultWindow) contains(now time.Time) bool {
+	offset := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	if w.From <= w.To {
+		return offset >= w.From && offset < w.To
+	}
+	return offset >= w.From || offset < w.To
+}
+
+// ParseFaultWindows разбирает SIMULATE_FAILURE: окна через запятую в виде
+// host:port/database@HH:MM-HH:MM.
+func ParseFaultWindows(spec string) ([]FaultWindow, error) {
+	windows := []FaultWindow{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		at := strings.LastIndex(item, "@")
+		if at <= 0 {
+			return nil, fmt.Errorf("invalid fault window %q: want target@HH:MM-HH:MM", item)
+		}
+		from, to, ok := strings.Cut(item[at+1:], "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid fault window %q: want target@HH:MM-HH:MM", item)
+		}
+		fromOffset, err := parseClockTime(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault window %q: %v", item, err)
+		}
+		toOffset, err := parseClockTime(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault window %q: %v", item, err)
+		}
+		windows = append(windows, FaultWindow{Target: item[:at], From: fromOffset, To: toOffset})
+	}
+	return windows, nil
+}
+
+// parseClockTime переводит HH:MM в смещение от полуночи.
+func parseClockTime(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// FaultInjector срывает проверки выбранных баз по расписанию FaultWindow или
+// по запросу к SimulateHandler, не трогая сами базы. Так можно проверить
+// алерты, маршрутизацию уведомлений и дашборды.
+type FaultInjector struct {
+	mu      sync.Mutex
+	windows []FaultWindow
+	forced  map[string]time.Time
+}
+
+func NewFaultInjector(windows []FaultWindow) *FaultInjector {
+	return &FaultInjector{
+		windows: windows,
+		forced:  map[string]time.Time{},
+	}
+}
+
+// Active сообщает, нужно ли сорвать проверку базы target в момент now.
+func (f *FaultInjector) Active(target string, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if until, ok := f.forced[target]; ok {
+		if now.Before(until) {
+			return true
+		}
+		delete(f.forced, target)
+	}
+	for _, window := range f.windows {
+		if window.Target == target && window.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Force срывает проверки базы target до момента until.
+func (f *FaultInjector) Force(target string, until time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forced[target] = until
+}
+
+// Clear отменяет Force для базы target; окна из расписания остаются.
+func (f *FaultInjector) Clear(target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.forced, target)
+}
+
+// SimulateHandler управляет FaultInjector по HTTP:
+//
+//	POST /simulate?target=db:3306/app&duration=5m - срывать проверки 5 минут
+//	DELETE /simulate?target=db:3306/app           - снова проверять базу
+//
+// Как и у TargetsHandler, каждый запрос должен содержать заголовок
+// "Authorization: Bearer <token>": иначе любой, кто видит порт метрик, мог
+// бы поднять алерты по всем базам.
+func SimulateHandler(injector *FaultInjector, token string) http.Handler {
+	return requireToken(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target is required", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+			if err != nil || duration <= 0 {
+				http.Error(w, "duration must be a positive Go duration, e.g. 5m", http.StatusBadRequest)
+				return
+			}
+			until := time.Now().Add(duration)
+			injector.Force(target, until)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"target": target, "until": until})
+		case http.MethodDelete:
+			injector.Clear(target)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+}
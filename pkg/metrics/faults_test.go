@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestParseFaultWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []FaultWindow
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: []FaultWindow{}},
+		{
+			name: "single window",
+			spec: "db:3306/app@14:00-14:05",
+			want: []FaultWindow{{Target: "db:3306/app", From: 14 * time.Hour, To: 14*time.Hour + 5*time.Minute}},
+		},
+		{
+			name: "several windows",
+			spec: "db1:3306/app@14:00-14:05, db2:3306/app@23:50-00:10",
+			want: []FaultWindow{
+				{Target: "db1:3306/app", From: 14 * time.Hour, To: 14*time.Hour + 5*time.Minute},
+				{Target: "db2:3306/app", From: 23*time.Hour + 50*time.Minute, To: 10 * time.Minute},
+			},
+		},
+		{name: "missing target", spec: "@14:00-14:05", wantErr: true},
+		{name: "missing window", spec: "db:3306/app", wantErr: true},
+		{name: "missing end", spec: "db:3306/app@14:00", wantErr: true},
+		{name: "invalid time", spec: "db:3306/app@25:00-26:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFaultWindows(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFaultWindows(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFaultWindows(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFaultInjectorActive(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	injector := NewFaultInjector([]FaultWindow{
+		{Target: "db:3306/app", From: 14 * time.Hour, To: 14*time.Hour + 5*time.Minute},
+		{Target: "night:3306/app", From: 23*time.Hour + 50*time.Minute, To: 10 * time.Minute},
+	})
+	injector.Force("forced:3306/app", day.Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		target string
+		at     time.Duration
+		want   bool
+	}{
+		{name: "before window", target: "db:3306/app", at: 13*time.Hour + 59*time.Minute},
+		{name: "inside window", target: "db:3306/app", at: 14*time.Hour + 2*time.Minute, want: true},
+		{name: "window end is exclusive", target: "db:3306/app", at: 14*time.Hour + 5*time.Minute},
+		{name: "other target", target: "other:3306/app", at: 14*time.Hour + 2*time.Minute},
+		{name: "window across midnight, evening", target: "night:3306/app", at: 23*time.Hour + 55*time.Minute, want: true},
+		{name: "window across midnight, morning", target: "night:3306/app", at: 5 * time.Minute, want: true},
+		{name: "window across midnight, day", target: "night:3306/app", at: 12 * time.Hour},
+		{name: "forced", target: "forced:3306/app", at: 30 * time.Minute, want: true},
+		{name: "forced expired", target: "forced:3306/app", at: 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injector.Active(tt.target, day.Add(tt.at)); got != tt.want {
+				t.Errorf("Active(%q, %v) = %v, want %v", tt.target, tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulateHandler(t *testing.T) {
+	injector := NewFaultInjector(nil)
+	handler := SimulateHandler(injector, "s3cret")
+	const authorized = "Bearer s3cret"
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		authorization string
+		wantCode      int
+		wantActive    bool
+	}{
+		{name: "no token", method: http.MethodPost, url: "/simulate?target=db:3306/app&duration=5m", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, url: "/simulate?target=db:3306/app&duration=5m", authorization: "Bearer guess", wantCode: http.StatusUnauthorized},
+		{name: "missing target", method: http.MethodPost, url: "/simulate?duration=5m", authorization: authorized, wantCode: http.StatusBadRequest},
+		{name: "invalid duration", method: http.MethodPost, url: "/simulate?target=db:3306/app&duration=soon", authorization: authorized, wantCode: http.StatusBadRequest},
+		{name: "force", method: http.MethodPost, url: "/simulate?target=db:3306/app&duration=5m", authorization: authorized, wantCode: http.StatusOK, wantActive: true},
+		{name: "unsupported method", method: http.MethodGet, url: "/simulate?target=db:3306/app", authorization: authorized, wantCode: http.StatusMethodNotAllowed, wantActive: true},
+		{name: "clear without token", method: http.MethodDelete, url: "/simulate?target=db:3306/app", wantCode: http.StatusUnauthorized, wantActive: true},
+		{name: "clear", method: http.MethodDelete, url: "/simulate?target=db:3306/app", authorization: authorized, wantCode: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("SimulateHandler() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := injector.Active("db:3306/app", time.Now()); got != tt.wantActive {
+				t.Errorf("Active() after request = %v, want %v", got, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestPerformChecksSimulatedFailure(t *testing.T) {
+	dialer := &refusingDialer{}
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{
+		{Host: "db.internal", Port: "3306", Name: "app", User: "app", Pass: "app"},
+	}, time.Hour)
+	exporter.SetDialer(dialer)
+	injector := NewFaultInjector(nil)
+	injector.Force("db.internal:3306/app", time.Now().Add(time.Hour))
+	exporter.SetFaultInjector(injector)
+
+	exporter.performChecks(nil)
+	status := exporter.Status()[0]
+	if status.Available || status.Reason != "simulated failure" {
+		t.Errorf("status = available %v, reason %q, want simulated failure", status.Available, status.Reason)
+	}
+	if dialer.dials != 0 {
+		t.Errorf("dialer called %d times during a simulated failure, want 0", dialer.dials)
+	}
+}
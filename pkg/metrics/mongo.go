@@ -0,0 +1,372 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// MultiMongoExporter периодически проверяет базы MongoDB (MONGODB_URI) и
+// отдает метрики:
+//   - mongodb_connection_available: доступность подключения (1 = доступно,
+//     0 = недоступно)
+//   - mongodb_connection_duration_seconds: время выполнения проверки
+//     подключения в секундах
+//
+// Label host содержит хосты из URI так, как они там записаны, например
+// "mongo-0:27017,mongo-1:27017" для replica set, поэтому отдельного label
+// port нет. Label severity - важность базы, как у MultiMySQLExporter.
+//
+// Базы проверяются по тем же расписаниям и с теми же повторами, что у
+// MultiMySQLExporter (SetSchedule, SetRetries).
+type MultiMongoExporter struct {
+	targets            []types.Target
+	availabilityMetric *prometheus.GaugeVec
+	durationMetric     *prometheus.GaugeVec
+	checkInterval      time.Duration
+	mu                 sync.RWMutex
+	probeMu            sync.Mutex
+	ctx                context.Context
+	cancel             context.CancelFunc
+	loopWg             sync.WaitGroup
+	statuses           []TargetStatus
+	clock              clock.Clock
+	dialer             checker.Dialer
+	defaultSchedule    string
+	retries            retries
+	attemptTimeout     time.Duration
+	connectTimeout     time.Duration
+	queryTimeout       time.Duration
+	confirmChanges     bool
+	onResult           func(TargetStatus)
+	sinks              []checker.Sink
+}
+
+// NewMultiMongoExporter создает экспортер для целей MongoDB, например
+// полученных mongocheck.TargetFromURI.
+func NewMultiMongoExporter(targets []types.Target, checkInterval time.Duration) *MultiMongoExporter {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if checkInterval == 0 {
+		checkInterval = 30 * time.Second
+	}
+
+	return &MultiMongoExporter{
+		targets:       targets,
+		statuses:      make([]TargetStatus, len(targets)),
+		retries:       retries{attempts: 1},
+		clock:         clock.Real,
+		checkInterval: checkInterval,
+		ctx:           ctx,
+		cancel:        cancel,
+		availabilityMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mongodb_connection_available",
+				Help: "MongoDB connection availability (1 = available, 0 = unavailable)",
+			},
+			[]string{"host", "database", "severity"},
+		),
+		durationMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mongodb_connection_duration_seconds",
+				Help: "MongoDB connection check duration in seconds",
+			},
+			[]string{"host", "database", "severity"},
+		),
+	}
+}
+
+func (e *MultiMongoExporter) Describe(ch chan<- *prometheus.Desc) {
+	e.availabilityMetric.Describe(ch)
+	e.durationMetric.Describe(ch)
+}
+
+// SetClock задает часы, по которым отмечается время проверок. Вызывается до
+// Start.
+func (e *MultiMongoExporter) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+// SetDialer задает, как открываются подключения проверок, например через
+// DNS_SERVER. Вызывается до Start.
+func (e *MultiMongoExporter) SetDialer(dialer checker.Dialer) {
+	e.dialer = dialer
+}
+
+// SetAttemptTimeout ограничивает одну проверку вместо 10 секунд по
+// умолчанию, 0 оставляет их. Timeout цели важнее. Вызывается до Start.
+func (e *MultiMongoExporter) SetAttemptTimeout(timeout time.Duration) {
+	e.attemptTimeout = timeout
+}
+
+// SetPhaseTimeouts ограничивает подключение и команды после него, как у
+// MultiMySQLExporter. Вызывается до Start.
+func (e *MultiMongoExporter) SetPhaseTimeouts(connect, query time.Duration) {
+	e.connectTimeout, e.queryTimeout = connect, query
+}
+
+// SetConfirmStateChanges включает подтверждение смены состояния второй
+// проверкой, как у MultiMySQLExporter. Вызывается до Start.
+func (e *MultiMongoExporter) SetConfirmStateChanges(enabled bool) {
+	e.confirmChanges = enabled
+}
+
+// SetSchedule задает cron-выражение для баз без собственного расписания
+// вместо checkInterval, как у MultiMySQLExporter. Вызывается до Start.
+func (e *MultiMongoExporter) SetSchedule(spec string) error {
+	if spec != "" {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return fmt.Errorf("invalid check schedule %q: %v", spec, err)
+		}
+	}
+	e.defaultSchedule = spec
+	return nil
+}
+
+// SetRetries задает число попыток в одной проверке базы и паузу между ними,
+// как у MultiMySQLExporter. Вызывается до Start.
+func (e *MultiMongoExporter) SetRetries(attempts int, delay time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	e.retries = retries{attempts: attempts, delay: delay}
+}
+
+// AddSink передает sink результат каждой попытки проверки каждой базы,
+// включая подтверждающую, например для журнала аудита. Вызывается до Start.
+func (e *MultiMongoExporter) AddSink(sink checker.Sink) {
+	e.sinks = append(e.sinks, sink)
+}
+
+// OnResult задает функцию, которая вызывается после каждой проверки каждой
+// базы. Вызывается до Start.
+func (e *MultiMongoExporter) OnResult(hook func(TargetStatus)) {
+	e.onResult = hook
+}
+
+// Start выполняет первую проверку всех баз и запускает проверки по
+// расписанию: собственному расписанию базы, SetSchedule или каждые
+// checkInterval. Следующая проверка группы баз пропускается, если
+// предыдущая еще не закончилась.
+func (e *MultiMongoExporter) Start() {
+	e.performChecks(nil)
+
+	groups := map[string][]int{}
+	for i, target := range e.targets {
+		spec := target.Schedule
+		if spec == "" {
+			spec = e.defaultSchedule
+		}
+		groups[spec] = append(groups[spec], i)
+	}
+	scheduler := newScheduler()
+	for spec, targets := range groups {
+		schedule, _ := parseSchedule(spec, e.checkInterval)
+		scheduler.Schedule(schedule, cron.FuncJob(func() { e.performChecks(targets) }))
+	}
+	scheduler.Start()
+
+	e.loopWg.Add(1)
+	go func() {
+		defer e.loopWg.Done()
+		<-e.ctx.Done()
+		<-scheduler.Stop().Done()
+	}()
+}
+
+func (e *MultiMongoExporter) Stop() {
+	e.cancel()
+}
+
+// Shutdown останавливает цикл проверок и ждет завершения текущей проверки,
+// но не дольше, чем позволяет ctx.
+func (e *MultiMongoExporter) Shutdown(ctx context.Context) error {
+	e.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		e.loopWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// performChecks проверяет базы с индексами targets, nil - все базы.
+func (e *MultiMongoExporter) performChecks(targets []int) {
+	if targets == nil {
+		targets = make([]int, len(e.targets))
+		for i := range targets {
+			targets[i] = i
+		}
+	}
+	statuses := e.checkTargets(targets)
+
+	// Хук может ходить в сеть, поэтому вызывается без блокировки, как у
+	// MultiMySQLExporter.
+	if e.onResult != nil {
+		for _, status := range statuses {
+			e.onResult(status)
+		}
+	}
+}
+
+func (e *MultiMongoExporter) checkTargets(targets []int) []TargetStatus {
+	// Как у MultiMySQLExporter, проверки идут без e.mu, чтобы медленная
+	// база не задерживала сбор метрик, /status и /readyz.
+	e.mu.RLock()
+	configs := make([]types.Target, len(targets))
+	previous := make([]TargetStatus, len(targets))
+	for i, target := range targets {
+		configs[i] = e.targets[target]
+		previous[i] = e.statuses[target]
+	}
+	e.mu.RUnlock()
+
+	// Одинаковые базы проверяются одним подключением, см. checker.Key;
+	// sinks получают результат для каждой.
+	checks, confirmations := &checker.Shared{}, &checker.Shared{}
+	aliases := map[string][]types.Target{}
+	for _, group := range checker.Group(configs) {
+		aliases[checker.Key(group[0])] = group
+	}
+
+	results := make([]types.Result, len(targets))
+	startTimes := make([]time.Time, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int, cfg types.Target) {
+			defer wg.Done()
+
+			check := func() types.Result { return e.checkWithRetries(cfg, aliases[checker.Key(cfg)]) }
+			startTimes[i] = e.clock.Now()
+			result := checks.Do(cfg, check)
+			if e.confirmChanges && changed(previous[i], result) {
+				result = confirmations.Do(cfg, check)
+			}
+			results[i] = result
+		}(i, configs[i])
+	}
+	wg.Wait()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]TargetStatus, len(targets))
+	for i, target := range targets {
+		cfg, result := configs[i], results[i]
+		duration := result.Duration().Seconds()
+
+		labels := prometheus.Labels{
+			"host":     cfg.Host,
+			"database": cfg.Database,
+			"severity": cfg.SeverityLevel(),
+		}
+		var message string
+		if result.Err != nil {
+			message = util.Redact(result.Err.Error(), cfg.Pass)
+			e.availabilityMetric.With(labels).Set(0)
+		} else {
+			e.availabilityMetric.With(labels).Set(1)
+		}
+		e.durationMetric.With(labels).Set(duration)
+
+		status := TargetStatus{
+			Host:            cfg.Host,
+			Database:        cfg.Database,
+			Severity:        cfg.SeverityLevel(),
+			Available:       result.Err == nil,
+			DurationSeconds: duration,
+			CheckedAt:       startTimes[i],
+			ServerVersion:   result.ServerVersion,
+			Reason:          result.Reason,
+			Error:           message,
+			Attempts:        result.Attempts,
+		}
+		if !status.Available {
+			status.ConsecutiveFailures = e.statuses[target].ConsecutiveFailures + 1
+		}
+		e.statuses[target] = status
+		statuses[i] = status
+	}
+	return statuses
+}
+
+// checkWithRetries проверяет цель с повторами SetRetries. Результат каждой
+// попытки передается sinks для каждой из observed - целей, которые
+// разделяют эту проверку.
+func (e *MultiMongoExporter) checkWithRetries(target types.Target, observed []types.Target) types.Result {
+	check := func() types.Result {
+		return checker.CheckWith(e.ctx, target, checker.Options{
+			Dialer:         e.dialer,
+			Timeout:        e.attemptTimeout,
+			ConnectTimeout: e.connectTimeout,
+			QueryTimeout:   e.queryTimeout,
+		})
+	}
+	return e.retries.check(e.ctx, e.clock, target, check, func(result types.Result) {
+		for _, alias := range observed {
+			for _, sink := range e.sinks {
+				sink.Observe(e.ctx, alias, result)
+			}
+		}
+	})
+}
+
+// Status возвращает результаты последней проверки каждой базы.
+func (e *MultiMongoExporter) Status() []TargetStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	statuses := make([]TargetStatus, 0, len(e.statuses))
+	for _, status := range e.statuses {
+		if !status.CheckedAt.IsZero() {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// Probe перепроверяет базы, результат которых старше maxAge или еще не
+// получен, и возвращает результаты всех баз.
+func (e *MultiMongoExporter) Probe(maxAge time.Duration) []TargetStatus {
+	e.probeMu.Lock()
+	defer e.probeMu.Unlock()
+
+	e.mu.RLock()
+	stale := []int{}
+	for i := range e.targets {
+		if e.clock.Now().Sub(e.statuses[i].CheckedAt) >= maxAge {
+			stale = append(stale, i)
+		}
+	}
+	e.mu.RUnlock()
+
+	if len(stale) > 0 {
+		e.performChecks(stale)
+	}
+	return e.Status()
+}
+
+func (e *MultiMongoExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	e.availabilityMetric.Collect(ch)
+	e.durationMetric.Collect(ch)
+}
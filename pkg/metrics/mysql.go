@@ -2,19 +2,69 @@ package metrics
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/tapclap/db-connect-checker/pkg/mysqlcheck"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/tracing"
 	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
 )
 
-// Пакет metrics предоставляет экспортеры метрик для мониторинга подключений к MySQL.
+// Пакет metrics предоставляет экспортеры метрик для мониторинга подключений к
+// MySQL и, через MultiMongoExporter, к MongoDB.
 //
 // Метрики:
 //   - mysql_connection_available: доступность подключения (1 = доступно, 0 = недоступно)
 //   - mysql_connection_duration_seconds: время выполнения проверки подключения в секундах
+//   - db_connection_last_error_info: равна 1 для недоступной базы, label reason
+//     содержит класс ошибки (auth error, timeout, ...)
+//   - mysql_connection_attempts_used: сколько попыток понадобилось последней
+//     успешной проверке (см. SetRetries)
+//   - mysql_connection_consecutive_failures: число неудачных проверок базы
+//     подряд, 0 после успешной
+//   - mysql_connection_circuit_open: 1, если проверки базы приостановлены
+//     автоматическим выключателем (см. SetCircuitBreaker)
+//   - db_connect_checker_cycle_duration_seconds: длительность последнего цикла
+//     проверок группы баз с общим расписанием (label schedule)
+//   - db_connect_checker_cycle_overruns_total: число циклов, которые не
+//     уложились в интервал до следующего запуска по расписанию
+//   - db_clock_skew_seconds: насколько часы сервера базы спешат (или отстают,
+//     если значение отрицательное) относительно часов экспортера (см.
+//     SetMaxClockSkew)
+//   - mysql_server_variable_conformant: 1, если глобальная переменная сервера
+//     (label variable) совпадает с ожидаемым значением из
+//     MYSQL_EXPECT_VARIABLES, иначе 0
+//   - mysql_tablespace_bytes: место, занятое таблицами базы (kind="data"), и
+//     свободное место в их табличных пространствах (kind="free"), см.
+//     SetTablespaceMetrics
+//   - mysql_long_running_queries, mysql_lock_waiting_sessions: число запросов,
+//     которые выполняются дольше порога, и сессий, ожидающих блокировок (см.
+//     SetLongQueryThreshold)
+//   - mysql_threads: Threads_connected (state="connected") и Threads_running
+//     (state="running") сервера, см. SetThreadsMetrics
+//   - mysql_wsrep_flow_control_paused, mysql_wsrep_flow_control_events: доля
+//     времени, которую узел Percona XtraDB Cluster простоял из-за flow
+//     control, и число запросов паузы (direction="sent" или "received"), см.
+//     SetFlowControlMetrics
+//   - mysql_credential_valid: 1, если пользователь (label user) базы с
+//     MYSQL_EXTRA_USERS смог подключиться, иначе 0
+//   - mysql_account_expected: аккаунт (label account), с которым сервер
+//     сопоставил пользователя базы с MYSQL_ACCOUNT_HOST; 1, если это ожидаемый
+//     аккаунт, иначе 0
+//   - db_connect_checker_target_conflicts: для баз, которые заданы в нескольких
+//     источниках с разными настройками, число источников (см. SetConflicts)
+//   - mysql_connection_check_duration_seconds: гистограмма времени проверок; при
+//     включенной трассировке сэмплы содержат exemplar с trace_id
 //
 // Пример использования для нескольких баз данных:
 //
@@ -26,40 +76,253 @@ import (
 //	http.ListenAndServe(":8080", nil)
 
 type MultiMySQLExporter struct {
-	configs            []types.MysqlConfig
+	targets            []types.Target
 	availabilityMetric *prometheus.GaugeVec
 	durationMetric     *prometheus.GaugeVec
+	durationHistogram  *prometheus.HistogramVec
+	lastErrorMetric    *prometheus.GaugeVec
+	circuitMetric      *prometheus.GaugeVec
+	failuresMetric     *prometheus.GaugeVec
+	attemptsMetric     *prometheus.GaugeVec
+	cycleMetric        *prometheus.GaugeVec
+	overrunsMetric     *prometheus.CounterVec
+	conflictsMetric    *prometheus.GaugeVec
+	clockSkewMetric    *prometheus.GaugeVec
+	variablesMetric    *prometheus.GaugeVec
+	tablespaceMetric   *prometheus.GaugeVec
+	longQueriesMetric  *prometheus.GaugeVec
+	lockWaitsMetric    *prometheus.GaugeVec
+	threadsMetric      *prometheus.GaugeVec
+	flowPausedMetric   *prometheus.GaugeVec
+	flowEventsMetric   *prometheus.GaugeVec
+	credentialsMetric  *prometheus.GaugeVec
+	accountMetric      *prometheus.GaugeVec
+	intervalMetric     *prometheus.GaugeVec
 	checkInterval      time.Duration
+	defaultSchedule    string
 	mu                 sync.RWMutex
+	probeMu            sync.Mutex
 	ctx                context.Context
 	cancel             context.CancelFunc
+	loopWg             sync.WaitGroup
+	statuses           []TargetStatus
+	onResult           func(TargetStatus)
+	breakers           []*breaker
+	breakerConfig      breaker
+	pacers             []*pacer
+	pacerConfig        pacer
+	clock              clock.Clock
+	dialer             checker.Dialer
+	faults             *FaultInjector
+	sinks              []checker.Sink
+	retries            retries
+	attemptTimeout     time.Duration
+	connectTimeout     time.Duration
+	queryTimeout       time.Duration
+	confirmChanges     bool
+	maxClockSkew       time.Duration
+	tablespace         bool
+	longQuery          time.Duration
+	threads            bool
+	flowControl        bool
+	scheduler          *cron.Cron
+	scheduled          map[string]bool
+	conflicts          []util.TargetConflict
+	credentialTTL      time.Duration
+	credentialsReadAt  []time.Time
+	// removed отмечает цели, удаленные RemoveTarget. Элементы срезов целей
+	// не удаляются, чтобы индексы в запланированных проверках оставались
+	// верными.
+	removed []bool
 }
 
 func NewMultiMySQLExporter(configs []types.MysqlConfig, checkInterval time.Duration) *MultiMySQLExporter {
+	targets := make([]types.Target, len(configs))
+	for i, cfg := range configs {
+		targets[i] = cfg.Target()
+	}
+	return NewExporter(targets, checkInterval)
+}
+
+// NewExporter создает экспортер для целей любых типов, зарегистрированных в
+// checker. Метрики те же, что у NewMultiMySQLExporter, а тип цели различает
+// label type метрик mysql_connection_*: у mock-цели type равен "mock", host -
+// "mock", а port пустой.
+func NewExporter(targets []types.Target, checkInterval time.Duration) *MultiMySQLExporter {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	if checkInterval == 0 {
 		checkInterval = 30 * time.Second
 	}
 
+	breakers := make([]*breaker, len(targets))
+	pacers := make([]*pacer, len(targets))
+	for i := range breakers {
+		breakers[i] = &breaker{}
+		pacers[i] = &pacer{}
+	}
+
 	return &MultiMySQLExporter{
-		configs:       configs,
-		checkInterval: checkInterval,
-		ctx:           ctx,
-		cancel:        cancel,
+		targets:           targets,
+		breakers:          breakers,
+		pacers:            pacers,
+		removed:           make([]bool, len(targets)),
+		statuses:          make([]TargetStatus, len(targets)),
+		credentialsReadAt: make([]time.Time, len(targets)),
+		retries:           retries{attempts: 1},
+		clock:             clock.Real,
+		checkInterval:     checkInterval,
+		ctx:               ctx,
+		cancel:            cancel,
 		availabilityMetric: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "mysql_connection_available",
 				Help: "MySQL connection availability (1 = available, 0 = unavailable)",
 			},
-			[]string{"host", "port", "database"},
+			[]string{"type", "host", "port", "database", "severity"},
 		),
 		durationMetric: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "mysql_connection_duration_seconds",
 				Help: "MySQL connection check duration in seconds",
 			},
-			[]string{"host", "port", "database"},
+			[]string{"type", "host", "port", "database", "severity"},
+		),
+		// Не больше одной серии на базу: reason берется из ограниченного
+		// набора классов, а полный текст ошибки отдается только в /status.
+		lastErrorMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "db_connection_last_error_info",
+				Help: "Class of the last connection error for currently unavailable databases (always 1)",
+			},
+			[]string{"target", "reason", "severity"},
+		),
+		failuresMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_connection_consecutive_failures",
+				Help: "Number of consecutive failed checks of a MySQL database, 0 after a successful check",
+			},
+			[]string{"target"},
+		),
+		attemptsMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_connection_attempts_used",
+				Help: "Attempts the last successful check of a MySQL database needed",
+			},
+			[]string{"type", "host", "port", "database", "severity"},
+		),
+		cycleMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "db_connect_checker_cycle_duration_seconds",
+				Help: "Duration of the last check cycle of databases sharing a schedule in seconds",
+			},
+			[]string{"schedule"},
+		),
+		overrunsMetric: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "db_connect_checker_cycle_overruns_total",
+				Help: "Check cycles that lasted longer than the time until the next scheduled cycle",
+			},
+			[]string{"schedule"},
+		),
+		clockSkewMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "db_clock_skew_seconds",
+				Help: "Server clock of a database minus the clock of the exporter in seconds, measured when MAX_CLOCK_SKEW is set",
+			},
+			[]string{"target"},
+		),
+		variablesMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_server_variable_conformant",
+				Help: "Whether a global server variable has the value expected by MYSQL_EXPECT_VARIABLES (1 = yes, 0 = no)",
+			},
+			[]string{"target", "variable"},
+		),
+		tablespaceMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_tablespace_bytes",
+				Help: "Space of the tables of a database from information_schema.TABLES: kind=data for data and indexes, kind=free for allocated but unused space",
+			},
+			[]string{"target", "kind"},
+		),
+		longQueriesMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_long_running_queries",
+				Help: "Queries running for at least LONG_QUERY_THRESHOLD",
+			},
+			[]string{"target"},
+		),
+		lockWaitsMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_lock_waiting_sessions",
+				Help: "Sessions waiting for a metadata, table or InnoDB row lock",
+			},
+			[]string{"target"},
+		),
+		threadsMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_threads",
+				Help: "Threads_connected (state=connected) and Threads_running (state=running) of a MySQL server",
+			},
+			[]string{"target", "state"},
+		),
+		flowPausedMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_wsrep_flow_control_paused",
+				Help: "Fraction of time a Percona XtraDB Cluster node was paused by flow control since the last FLUSH STATUS (wsrep_flow_control_paused)",
+			},
+			[]string{"target"},
+		),
+		flowEventsMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_wsrep_flow_control_events",
+				Help: "Flow control pause requests a Percona XtraDB Cluster node sent (direction=sent) and received (direction=received) since the last FLUSH STATUS",
+			},
+			[]string{"target", "direction"},
+		),
+		credentialsMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_credential_valid",
+				Help: "Whether a user of a database with MYSQL_EXTRA_USERS could connect (1 = yes, 0 = no)",
+			},
+			[]string{"target", "user"},
+		),
+		accountMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_account_expected",
+				Help: "Whether the account the server matched the user to (label account) is the one of MYSQL_ACCOUNT_HOST (1 = yes, 0 = no)",
+			},
+			[]string{"target", "account"},
+		),
+		intervalMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "db_connect_checker_check_interval_seconds",
+				Help: "Current interval between checks of a database chosen by CHECK_INTERVAL_MIN and CHECK_INTERVAL_MAX",
+			},
+			[]string{"target"},
+		),
+		conflictsMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "db_connect_checker_target_conflicts",
+				Help: "Number of sources configuring a database with different settings",
+			},
+			[]string{"target"},
+		),
+		circuitMetric: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mysql_connection_circuit_open",
+				Help: "Whether checks of a MySQL database are suspended by the circuit breaker (1 = suspended)",
+			},
+			[]string{"type", "host", "port", "database", "severity"},
+		),
+		durationHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "mysql_connection_check_duration_seconds",
+				Help:    "Histogram of MySQL connection check durations in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"type", "host", "port", "database", "severity"},
 		),
 	}
 }
@@ -67,63 +330,654 @@ func NewMultiMySQLExporter(configs []types.MysqlConfig, checkInterval time.Durat
 func (e *MultiMySQLExporter) Describe(ch chan<- *prometheus.Desc) {
 	e.availabilityMetric.Describe(ch)
 	e.durationMetric.Describe(ch)
+	e.durationHistogram.Describe(ch)
+	e.lastErrorMetric.Describe(ch)
+	e.circuitMetric.Describe(ch)
+	e.failuresMetric.Describe(ch)
+	e.attemptsMetric.Describe(ch)
+	e.cycleMetric.Describe(ch)
+	e.overrunsMetric.Describe(ch)
+	e.conflictsMetric.Describe(ch)
+	e.clockSkewMetric.Describe(ch)
+	e.variablesMetric.Describe(ch)
+	e.tablespaceMetric.Describe(ch)
+	e.longQueriesMetric.Describe(ch)
+	e.lockWaitsMetric.Describe(ch)
+	e.threadsMetric.Describe(ch)
+	e.flowPausedMetric.Describe(ch)
+	e.flowEventsMetric.Describe(ch)
+	e.credentialsMetric.Describe(ch)
+	e.accountMetric.Describe(ch)
+	e.intervalMetric.Describe(ch)
+}
+
+// SetSchedule задает cron-выражение (например, "*/5 * * * *") для баз без
+// собственного MYSQL_CHECK_SCHEDULE вместо фиксированного интервала.
+// Вызывается до Start.
+func (e *MultiMySQLExporter) SetSchedule(spec string) error {
+	if spec != "" {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return fmt.Errorf("invalid check schedule %q: %v", spec, err)
+		}
+	}
+	e.defaultSchedule = spec
+	return nil
+}
+
+// SetCircuitBreaker включает автоматический выключатель: после threshold
+// неудачных проверок подряд база не проверяется cooldown, затем выполняется
+// одна пробная проверка; каждая неудачная пробная проверка удваивает паузу,
+// но не больше maxCooldown. threshold 0 выключает выключатель. Вызывается до
+// Start.
+func (e *MultiMySQLExporter) SetCircuitBreaker(threshold int, cooldown, maxCooldown time.Duration) {
+	e.breakerConfig = breaker{threshold: threshold, cooldown: cooldown, maxCooldown: maxCooldown}
+	for _, b := range e.breakers {
+		b.threshold = threshold
+		b.cooldown = cooldown
+		b.maxCooldown = maxCooldown
+	}
+}
+
+// SetAdaptiveInterval включает адаптивный интервал проверок баз без
+// собственного расписания: после неудачной проверки база проверяется каждые
+// min, а после каждой успешной интервал удваивается, но не больше max.
+// Первый интервал - checkInterval. Текущий интервал попадает в метрику
+// db_connect_checker_check_interval_seconds. Не действует, если задано
+// общее cron-расписание SetSchedule. max 0 выключает адаптивный интервал.
+// Вызывается до Start.
+func (e *MultiMySQLExporter) SetAdaptiveInterval(min, max time.Duration) {
+	e.pacerConfig = pacer{min: min, max: max}
+	for _, p := range e.pacers {
+		p.min = min
+		p.max = max
+	}
+}
+
+// adaptive сообщает, подбирается ли интервал проверок target.
+func (e *MultiMySQLExporter) adaptive(target types.Target) bool {
+	return e.pacerConfig.max > 0 && e.scheduleOf(target) == ""
 }
 
+// SetRetries задает число попыток в одной проверке базы: проверка считается
+// неудачной, только если не прошли все attempts попыток, между попытками
+// выдерживается delay. Неповторяемые ошибки (например, ошибка авторизации)
+// не повторяются. attempts 1 - без повторов. Вызывается до Start.
+func (e *MultiMySQLExporter) SetRetries(attempts int, delay time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	e.retries = retries{attempts: attempts, delay: delay}
+}
+
+// SetAttemptTimeout ограничивает одну попытку проверки, вместе с
+// подключением, вместо таймаута по умолчанию ее чекера (5 секунд для
+// MySQL). Зависшее TCP-подключение тогда не занимает всю проверку. 0
+// оставляет таймаут по умолчанию. Вызывается до Start.
+func (e *MultiMySQLExporter) SetAttemptTimeout(timeout time.Duration) {
+	e.attemptTimeout = timeout
+}
+
+// SetPhaseTimeouts ограничивает подключение (connect) и запросы после него
+// (query) в одной попытке проверки баз MySQL; SetAttemptTimeout по-прежнему
+// ограничивает попытку целиком. 0 не ограничивает фазу отдельно.
+// ConnectTimeout и QueryTimeout цели важнее. Вызывается до Start.
+func (e *MultiMySQLExporter) SetPhaseTimeouts(connect, query time.Duration) {
+	e.connectTimeout, e.queryTimeout = connect, query
+}
+
+// SetConfirmStateChanges включает подтверждение смены состояния: если
+// проверка базы дала не тот результат, что предыдущая (база упала или
+// поднялась), сразу выполняется вторая проверка, и в метрики, /status и
+// OnResult попадает ее результат. Разовый сбой сети тогда не меняет
+// состояние базы дважды. Вызывается до Start.
+func (e *MultiMySQLExporter) SetConfirmStateChanges(enabled bool) {
+	e.confirmChanges = enabled
+}
+
+// SetClock подменяет часы, по которым отмечается время проверок, считаются
+// паузы выключателя и возраст результатов в Probe. Нужен тестам; расписание
+// проверок в Start всегда идет по реальному времени. Вызывается до Start.
+func (e *MultiMySQLExporter) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+// SetDialer задает, через что открываются соединения с базами, например
+// через SSH-туннель или тестовую заглушку. Вызывается до Start.
+func (e *MultiMySQLExporter) SetDialer(dialer checker.Dialer) {
+	e.dialer = dialer
+}
+
+// SetMaxClockSkew включает проверку часов: после успешного подключения время
+// сервера сравнивается с локальным, разница попадает в метрику
+// db_clock_skew_seconds, а проверка считается неудачной с reason
+// "clock skew", если разница больше max. Расхождение часов ломает проверку
+// TLS-сертификатов и авторизацию по токенам, и больше ничто о нем не
+// сообщает. 0 выключает проверку. Вызывается до Start.
+func (e *MultiMySQLExporter) SetMaxClockSkew(max time.Duration) {
+	e.maxClockSkew = max
+}
+
+// SetTablespaceMetrics включает измерение места, занятого таблицами баз
+// MySQL, и свободного места в их табличных пространствах (метрика
+// mysql_tablespace_bytes). В отличие от одноразовой проверки с MIN_FREE_SPACE,
+// мало свободного места не делает базу недоступной. Вызывается до Start.
+func (e *MultiMySQLExporter) SetTablespaceMetrics(enabled bool) {
+	e.tablespace = enabled
+}
+
+// SetLongQueryThreshold включает подсчет запросов, которые выполняются не
+// меньше threshold, и сессий, ожидающих блокировок (метрики
+// mysql_long_running_queries и mysql_lock_waiting_sessions): база, которая
+// принимает подключения, но не выполняет запросы, иначе выглядит доступной.
+// Пользователю нужна привилегия PROCESS. 0 выключает подсчет. Вызывается до
+// Start.
+func (e *MultiMySQLExporter) SetLongQueryThreshold(threshold time.Duration) {
+	e.longQuery = threshold
+}
+
+// SetThreadsMetrics включает чтение Threads_connected и Threads_running
+// (метрика mysql_threads). В отличие от одноразовой проверки с
+// MAX_THREADS_CONNECTED и MAX_THREADS_RUNNING, превышение не делает базу
+// недоступной. Вызывается до Start.
+func (e *MultiMySQLExporter) SetThreadsMetrics(enabled bool) {
+	e.threads = enabled
+}
+
+// SetFlowControlMetrics включает чтение статуса flow control узлов Percona
+// XtraDB Cluster (метрики mysql_wsrep_flow_control_paused и
+// mysql_wsrep_flow_control_events); у серверов без Galera метрик нет. Как и
+// для SetThreadsMetrics, предел MAX_FLOW_CONTROL_PAUSED не делает базу
+// недоступной. Вызывается до Start.
+func (e *MultiMySQLExporter) SetFlowControlMetrics(enabled bool) {
+	e.flowControl = enabled
+}
+
+// SetFaultInjector включает имитацию отказов: пока injector активен для базы,
+// ее проверка не выполняется и считается неудачной с reason
+// "simulated failure". Вызывается до Start.
+func (e *MultiMySQLExporter) SetFaultInjector(injector *FaultInjector) {
+	e.faults = injector
+}
+
+// AddSink передает sink результат каждой настоящей проверки каждой базы,
+// например для журнала аудита. Сорванные FaultInjector проверки не
+// передаются. Вызывается до Start.
+func (e *MultiMySQLExporter) AddSink(sink checker.Sink) {
+	e.sinks = append(e.sinks, sink)
+}
+
+// Start выполняет первую проверку всех баз и запускает периодические
+// проверки. Базы с одинаковым расписанием проверяются вместе; следующая
+// проверка группы пропускается, если предыдущая еще не закончилась.
 func (e *MultiMySQLExporter) Start() {
-	e.performChecks()
+	e.performChecks(nil)
+
+	e.mu.Lock()
+	e.scheduler = newScheduler()
+	e.scheduled = map[string]bool{}
+	for _, target := range e.targets {
+		e.scheduleGroup(e.scheduleOf(target))
+	}
+	scheduler := e.scheduler
+	e.mu.Unlock()
+	scheduler.Start()
 
+	e.loopWg.Add(1)
 	go func() {
-		ticker := time.NewTicker(e.checkInterval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				e.performChecks()
-			case <-e.ctx.Done():
-				return
-			}
-		}
+		defer e.loopWg.Done()
+		<-e.ctx.Done()
+		<-scheduler.Stop().Done()
 	}()
 }
 
+// scheduleOf возвращает расписание цели: собственное или общее.
+func (e *MultiMySQLExporter) scheduleOf(target types.Target) string {
+	if target.Schedule != "" {
+		return target.Schedule
+	}
+	return e.defaultSchedule
+}
+
+// scheduleGroup добавляет в планировщик циклы проверок баз с расписанием
+// spec, если их еще нет. Вызывается с захваченным e.mu.
+func (e *MultiMySQLExporter) scheduleGroup(spec string) {
+	if e.scheduled[spec] {
+		return
+	}
+	e.scheduled[spec] = true
+
+	interval := e.checkInterval
+	if e.pacerConfig.max > 0 {
+		interval = e.pacerConfig.min
+	}
+	schedule, name := parseSchedule(spec, interval)
+	e.cycleMetric.With(prometheus.Labels{"schedule": name})
+	e.overrunsMetric.With(prometheus.Labels{"schedule": name})
+	e.scheduler.Schedule(schedule, cron.FuncJob(func() { e.runCycle(name, schedule, e.groupTargets(spec)) }))
+}
+
+// groupTargets возвращает индексы оставшихся баз с расписанием spec.
+func (e *MultiMySQLExporter) groupTargets(spec string) []int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	targets := []int{}
+	for i, target := range e.targets {
+		if !e.removed[i] && e.scheduleOf(target) == spec {
+			targets = append(targets, i)
+		}
+	}
+	return targets
+}
+
 func (e *MultiMySQLExporter) Stop() {
 	e.cancel()
 }
 
-func (e *MultiMySQLExporter) performChecks() {
+// OnResult задает функцию, которая вызывается после каждой проверки каждой
+// базы. Вызывается до Start.
+func (e *MultiMySQLExporter) OnResult(hook func(TargetStatus)) {
+	e.onResult = hook
+}
+
+// Shutdown останавливает цикл проверок и ждет завершения текущей проверки,
+// но не дольше, чем позволяет ctx.
+func (e *MultiMySQLExporter) Shutdown(ctx context.Context) error {
+	e.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		e.loopWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runCycle выполняет один цикл проверок группы баз с расписанием schedule и
+// отмечает его длительность. Цикл, закончившийся позже следующего запуска по
+// расписанию, считается переполнением: этот запуск будет пропущен.
+func (e *MultiMySQLExporter) runCycle(name string, schedule cron.Schedule, targets []int) {
+	start := time.Now()
+	next := schedule.Next(start)
+	e.performChecks(e.dueTargets(targets))
+	duration := time.Since(start)
+
+	labels := prometheus.Labels{"schedule": name}
+	e.cycleMetric.With(labels).Set(duration.Seconds())
+	if time.Now().After(next) {
+		e.overrunsMetric.With(labels).Inc()
+		log.Warn("Check cycle took longer than the time until the next cycle", "schedule", name, "duration", duration.Round(time.Millisecond), "next_cycle_in", next.Sub(start).Round(time.Millisecond))
+	}
+}
+
+// dueTargets возвращает базы из targets, которые пора проверить: адаптивный
+// интервал которых истек или которые проверяются без него.
+func (e *MultiMySQLExporter) dueTargets(targets []int) []int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := e.clock.Now()
+	due := []int{}
+	for _, target := range targets {
+		if !e.adaptive(e.targets[target]) || e.pacers[target].allow(now) {
+			due = append(due, target)
+		}
+	}
+	return due
+}
+
+// performChecks проверяет базы с индексами targets, nil - все базы.
+func (e *MultiMySQLExporter) performChecks(targets []int) {
+	if targets == nil {
+		targets = make([]int, len(e.targets))
+		for i := range targets {
+			targets[i] = i
+		}
+	}
+	statuses := e.checkTargets(targets)
+
+	// Хук может ходить в сеть, поэтому вызывается без блокировки, чтобы не
+	// задерживать сбор метрик.
+	if e.onResult != nil {
+		for _, status := range statuses {
+			e.onResult(status)
+		}
+	}
+}
+
+func (e *MultiMySQLExporter) checkTargets(targets []int) []TargetStatus {
+	// Проверки и паузы между попытками идут без e.mu, чтобы медленная база
+	// не задерживала сбор метрик, /status и /targets: блокировка нужна,
+	// только чтобы выбрать базы и записать результаты.
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	// Базы с разомкнутым выключателем пропускаются, их метрики и статус
+	// остаются от последней проверки.
+	now := e.clock.Now()
+	allowed := targets[:0:0]
+	for _, target := range targets {
+		if !e.removed[target] && e.breakers[target].allow(now) {
+			allowed = append(allowed, target)
+		}
+	}
+	targets = allowed
+	configs := make([]types.Target, len(targets))
+	previous := make([]TargetStatus, len(targets))
+	for i, target := range targets {
+		configs[i], _ = e.refreshCredentials(target, false)
+		previous[i] = e.statuses[target]
+	}
+	e.mu.Unlock()
 
-	e.availabilityMetric.Reset()
-	e.durationMetric.Reset()
+	// Одинаковые базы, заданные под разными именами, проверяются одним
+	// подключением, см. checker.Key; sinks получают результат для каждой.
+	checks, confirmations := &checker.Shared{}, &checker.Shared{}
+	aliases := map[string][]types.Target{}
+	for _, group := range checker.Group(configs) {
+		aliases[checker.Key(group[0])] = group
+	}
+	observed := func(cfg types.Target) []types.Target {
+		if group, ok := aliases[checker.Key(cfg)]; ok {
+			return group
+		}
+		// Цель с обновленными учетными данными.
+		return []types.Target{cfg}
+	}
 
+	checked := make([]checkedTarget, len(targets))
 	var wg sync.WaitGroup
-	for _, config := range e.configs {
+	for i := range targets {
 		wg.Add(1)
-		go func(cfg types.MysqlConfig) {
+		go func(i int, cfg types.Target) {
 			defer wg.Done()
 
-			startTime := time.Now()
-			err := mysqlcheck.CheckConnection(cfg)
-
-			duration := time.Since(startTime).Seconds()
-			labels := prometheus.Labels{
-				"host":     cfg.Host,
-				"port":     cfg.Port,
-				"database": cfg.Name,
+			ctx, span := tracing.Tracer().Start(e.ctx, cfg.Type+" connection check", trace.WithAttributes(
+				attribute.String("db.system", cfg.Type),
+				attribute.String("server.address", cfg.Host),
+				attribute.String("server.port", cfg.Port),
+				attribute.String("db.namespace", cfg.Database),
+			))
+			startTime := e.clock.Now()
+			var result types.Result
+			if e.faults != nil && e.faults.Active(targetName(cfg), startTime) {
+				result = types.Result{Attempts: 1, Reason: reasonSimulated, Err: errSimulated}
+			} else {
+				result = checks.Do(cfg, func() types.Result { return e.checkWithRetries(ctx, cfg, observed(cfg)) })
+				if result.Reason == "auth error" {
+					e.mu.Lock()
+					refreshed, changed := e.refreshCredentials(targets[i], true)
+					e.mu.Unlock()
+					if changed {
+						cfg = refreshed
+						result = checks.Do(cfg, func() types.Result { return e.checkWithRetries(ctx, cfg, observed(cfg)) })
+					}
+				}
+				if e.confirmChanges && changed(previous[i], result) {
+					result = confirmations.Do(cfg, func() types.Result { return e.checkWithRetries(ctx, cfg, observed(cfg)) })
+				}
+			}
+			if result.Err != nil {
+				span.RecordError(result.Err)
+				span.SetStatus(codes.Error, result.Reason)
 			}
+			span.End()
+			checked[i] = checkedTarget{ctx: ctx, target: cfg, result: result, startTime: startTime}
+		}(i, configs[i])
+	}
+	wg.Wait()
 
-			if err != nil {
-				e.availabilityMetric.With(labels).Set(0)
-			} else {
-				e.availabilityMetric.With(labels).Set(1)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]TargetStatus, 0, len(targets))
+	for i, target := range targets {
+		// База удалена, пока шла проверка: ее метрики не возвращаются.
+		if e.removed[target] {
+			continue
+		}
+		status := e.publish(checked[i])
+
+		b := e.breakers[target]
+		b.record(status.Available, now)
+		status.CircuitOpen = b.open()
+
+		circuitOpen := 0.0
+		if b.open() {
+			circuitOpen = 1
+		}
+		e.circuitMetric.With(targetLabels(e.targets[target])).Set(circuitOpen)
+
+		if e.adaptive(e.targets[target]) {
+			p := e.pacers[target]
+			p.record(status.Available, now, e.checkInterval)
+			e.intervalMetric.With(prometheus.Labels{"target": targetName(e.targets[target])}).Set(p.current.Seconds())
+		}
+
+		// Пропущенные выключателем проверки счетчик не меняют.
+		if !status.Available {
+			status.ConsecutiveFailures = e.statuses[target].ConsecutiveFailures + 1
+		}
+		e.failuresMetric.With(prometheus.Labels{"target": targetName(e.targets[target])}).Set(float64(status.ConsecutiveFailures))
+
+		e.statuses[target] = status
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// checkedTarget - результат проверки базы, который еще не записан в
+// метрики.
+type checkedTarget struct {
+	ctx       context.Context
+	target    types.Target
+	result    types.Result
+	startTime time.Time
+}
+
+// publish записывает результат проверки в метрики и возвращает статус
+// базы без состояния выключателя и счетчика неудач. Вызывается под e.mu.
+func (e *MultiMySQLExporter) publish(checked checkedTarget) TargetStatus {
+	ctx, cfg, result, startTime := checked.ctx, checked.target, checked.result, checked.startTime
+	err := result.Err
+	targetLabel := targetName(cfg)
+
+	duration := result.Duration().Seconds()
+	labels := targetLabels(cfg)
+
+	e.lastErrorMetric.DeletePartialMatch(prometheus.Labels{"target": targetLabel})
+
+	var message string
+	if err != nil {
+		message = util.Redact(err.Error(), cfg.Pass)
+		e.availabilityMetric.With(labels).Set(0)
+		e.lastErrorMetric.With(prometheus.Labels{
+			"target":   targetLabel,
+			"reason":   result.Reason,
+			"severity": cfg.SeverityLevel(),
+		}).Set(1)
+	} else {
+		e.availabilityMetric.With(labels).Set(1)
+		e.attemptsMetric.With(labels).Set(float64(result.Attempts))
+	}
+
+	if result.ClockSkewMeasured {
+		e.clockSkewMetric.With(prometheus.Labels{"target": targetLabel}).Set(result.ClockSkew.Seconds())
+	}
+	if result.TablespaceMeasured {
+		e.tablespaceMetric.With(prometheus.Labels{"target": targetLabel, "kind": "data"}).Set(float64(result.Tablespace.DataBytes))
+		e.tablespaceMetric.With(prometheus.Labels{"target": targetLabel, "kind": "free"}).Set(float64(result.Tablespace.FreeBytes))
+	}
+	if result.SessionsMeasured {
+		e.longQueriesMetric.With(prometheus.Labels{"target": targetLabel}).Set(float64(result.Sessions.LongQueries))
+		e.lockWaitsMetric.With(prometheus.Labels{"target": targetLabel}).Set(float64(result.Sessions.LockWaits))
+	}
+	if result.ThreadsMeasured {
+		e.threadsMetric.With(prometheus.Labels{"target": targetLabel, "state": "connected"}).Set(float64(result.Threads.Connected))
+		e.threadsMetric.With(prometheus.Labels{"target": targetLabel, "state": "running"}).Set(float64(result.Threads.Running))
+	}
+	if result.FlowControlMeasured {
+		e.flowPausedMetric.With(prometheus.Labels{"target": targetLabel}).Set(result.FlowControl.Paused)
+		e.flowEventsMetric.With(prometheus.Labels{"target": targetLabel, "direction": "sent"}).Set(float64(result.FlowControl.Sent))
+		e.flowEventsMetric.With(prometheus.Labels{"target": targetLabel, "direction": "received"}).Set(float64(result.FlowControl.Received))
+	}
+	if result.Account != "" {
+		// Одна серия на базу: прежний аккаунт удаляется.
+		e.accountMetric.DeletePartialMatch(prometheus.Labels{"target": targetLabel})
+		expected := 1.0
+		if len(result.Warnings) > 0 {
+			expected = 0
+		}
+		e.accountMetric.With(prometheus.Labels{"target": targetLabel, "account": result.Account}).Set(expected)
+	}
+	for _, credential := range result.Credentials {
+		valid := 0.0
+		if credential.Err == nil {
+			valid = 1
+		}
+		e.credentialsMetric.With(prometheus.Labels{"target": targetLabel, "user": credential.User}).Set(valid)
+	}
+	for _, variable := range result.Variables {
+		conformant := 0.0
+		if variable.Match {
+			conformant = 1
+		}
+		e.variablesMetric.With(prometheus.Labels{"target": targetLabel, "variable": variable.Name}).Set(conformant)
+	}
+	e.durationMetric.With(labels).Set(duration)
+	observeDuration(ctx, e.durationHistogram.With(labels), duration)
+
+	status := TargetStatus{
+		Host:            cfg.Host,
+		Port:            cfg.Port,
+		Database:        cfg.Database,
+		Severity:        cfg.SeverityLevel(),
+		Available:       err == nil,
+		DurationSeconds: duration,
+		CheckedAt:       startTime,
+		ServerVersion:   result.ServerVersion,
+		Reason:          result.Reason,
+		Error:           message,
+		Attempts:        result.Attempts,
+	}
+	if result.ClockSkewMeasured {
+		status.ClockSkewSeconds = result.ClockSkew.Seconds()
+	}
+	if result.SessionsMeasured {
+		status.LongQueries = result.Sessions.LongQueries
+		status.LockWaits = result.Sessions.LockWaits
+	}
+	status.Account = result.Account
+	status.Warnings = result.Warnings
+	for _, credential := range result.Credentials {
+		if credential.Err != nil {
+			status.FailedUsers = append(status.FailedUsers, credential.User)
+		}
+	}
+	if result.ThreadsMeasured {
+		status.ThreadsConnected = result.Threads.Connected
+		status.ThreadsRunning = result.Threads.Running
+	}
+	if result.FlowControlMeasured {
+		status.FlowControlPaused = result.FlowControl.Paused
+	}
+	if result.TablespaceMeasured {
+		status.FreeSpacePercent = result.Tablespace.FreePercent()
+	}
+	for _, variable := range result.Variables {
+		if !variable.Match {
+			status.VariableMismatches = append(status.VariableMismatches, variable.Name)
+		}
+	}
+	return status
+}
+
+// changed сообщает, что result меняет состояние базы с результатом
+// последней проверки previous. Первая проверка базы состояние не меняет.
+func changed(previous TargetStatus, result types.Result) bool {
+	return !previous.CheckedAt.IsZero() && previous.Available != (result.Err == nil)
+}
+
+// checkWithRetries проверяет цель с повторами SetRetries. Результат каждой
+// попытки передается sinks для каждой из observed - целей, которые
+// разделяют эту проверку.
+func (e *MultiMySQLExporter) checkWithRetries(ctx context.Context, target types.Target, observed []types.Target) types.Result {
+	return e.retries.check(ctx, e.clock, target, func() types.Result { return e.check(ctx, target) }, func(result types.Result) {
+		for _, alias := range observed {
+			for _, sink := range e.sinks {
+				sink.Observe(ctx, alias, result)
 			}
+		}
+	})
+}
 
-			e.durationMetric.With(labels).Set(duration)
-		}(config)
+// check проверяет одну цель чекером, зарегистрированным для ее типа (см.
+// checker.Register). Timeout, ConnectTimeout и QueryTimeout цели заменяют
+// SetAttemptTimeout и SetPhaseTimeouts.
+func (e *MultiMySQLExporter) check(ctx context.Context, target types.Target) types.Result {
+	return checker.CheckWith(ctx, target, checker.Options{
+		Dialer:             e.dialer,
+		Timeout:            e.attemptTimeout,
+		ConnectTimeout:     e.connectTimeout,
+		QueryTimeout:       e.queryTimeout,
+		MaxClockSkew:       e.maxClockSkew,
+		Tablespace:         e.tablespace,
+		LongQueryThreshold: e.longQuery,
+		Threads:            e.threads,
+		FlowControl:        e.flowControl,
+	})
+}
+
+// observeDuration добавляет в гистограмму exemplar с trace_id, если проверка
+// попала в сэмплированный трейс, чтобы из Grafana можно было перейти к трейсу.
+func observeDuration(ctx context.Context, observer prometheus.Observer, duration float64) {
+	traceID := tracing.TraceID(ctx)
+	exemplarObserver, ok := observer.(prometheus.ExemplarObserver)
+	if traceID == "" || !ok {
+		observer.Observe(duration)
+		return
 	}
-	wg.Wait()
+	exemplarObserver.ObserveWithExemplar(duration, prometheus.Labels{"trace_id": traceID})
+}
+
+// Status возвращает результаты последней проверки каждой базы.
+func (e *MultiMySQLExporter) Status() []TargetStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	statuses := make([]TargetStatus, 0, len(e.statuses))
+	for _, status := range e.statuses {
+		if !status.CheckedAt.IsZero() {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// Probe перепроверяет базы, результат которых старше maxAge или еще не
+// получен, и возвращает результаты всех баз. Одновременные вызовы
+// выполняются по очереди, чтобы не проверять одну базу дважды.
+func (e *MultiMySQLExporter) Probe(maxAge time.Duration) []TargetStatus {
+	e.probeMu.Lock()
+	defer e.probeMu.Unlock()
+
+	e.mu.RLock()
+	stale := []int{}
+	for i := range e.targets {
+		if !e.removed[i] && e.clock.Now().Sub(e.statuses[i].CheckedAt) >= maxAge {
+			stale = append(stale, i)
+		}
+	}
+	e.mu.RUnlock()
+
+	if len(stale) > 0 {
+		e.performChecks(stale)
+	}
+	return e.Status()
 }
 
 func (e *MultiMySQLExporter) Collect(ch chan<- prometheus.Metric) {
@@ -132,4 +986,23 @@ func (e *MultiMySQLExporter) Collect(ch chan<- prometheus.Metric) {
 
 	e.availabilityMetric.Collect(ch)
 	e.durationMetric.Collect(ch)
+	e.durationHistogram.Collect(ch)
+	e.lastErrorMetric.Collect(ch)
+	e.circuitMetric.Collect(ch)
+	e.failuresMetric.Collect(ch)
+	e.attemptsMetric.Collect(ch)
+	e.cycleMetric.Collect(ch)
+	e.overrunsMetric.Collect(ch)
+	e.conflictsMetric.Collect(ch)
+	e.intervalMetric.Collect(ch)
+	e.clockSkewMetric.Collect(ch)
+	e.variablesMetric.Collect(ch)
+	e.tablespaceMetric.Collect(ch)
+	e.longQueriesMetric.Collect(ch)
+	e.lockWaitsMetric.Collect(ch)
+	e.threadsMetric.Collect(ch)
+	e.flowPausedMetric.Collect(ch)
+	e.flowEventsMetric.Collect(ch)
+	e.credentialsMetric.Collect(ch)
+	e.accountMetric.Collect(ch)
 }
@@ -0,0 +1,603 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestMultiMySQLExporterShutdown(t *testing.T) {
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{}, 10*time.Millisecond)
+	exporter.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() unexpected error: %v", err)
+	}
+}
+
+func TestObserveDurationExemplar(t *testing.T) {
+	tests := []struct {
+		name         string
+		sampler      sdktrace.Sampler
+		wantExemplar bool
+	}{
+		{name: "sampled trace adds exemplar", sampler: sdktrace.AlwaysSample(), wantExemplar: true},
+		{name: "unsampled trace has no exemplar", sampler: sdktrace.NeverSample(), wantExemplar: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(tt.sampler))
+			ctx, span := provider.Tracer("test").Start(context.Background(), "check")
+			span.End()
+
+			histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds"})
+			observeDuration(ctx, histogram, 0.2)
+
+			var m dto.Metric
+			if err := histogram.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			if m.GetHistogram().GetSampleCount() != 1 {
+				t.Fatalf("sample count = %d, want 1", m.GetHistogram().GetSampleCount())
+			}
+
+			var exemplar *dto.Exemplar
+			for _, bucket := range m.GetHistogram().GetBucket() {
+				if bucket.GetExemplar() != nil {
+					exemplar = bucket.GetExemplar()
+				}
+			}
+			if (exemplar != nil) != tt.wantExemplar {
+				t.Fatalf("exemplar = %v, want exemplar: %v", exemplar, tt.wantExemplar)
+			}
+			if exemplar != nil {
+				label := exemplar.GetLabel()[0]
+				if label.GetName() != "trace_id" || label.GetValue() != span.SpanContext().TraceID().String() {
+					t.Errorf("exemplar label %s=%s, want trace_id=%s", label.GetName(), label.GetValue(), span.SpanContext().TraceID())
+				}
+			}
+		})
+	}
+}
+
+func TestPerformChecksRecordsLastError(t *testing.T) {
+	// Nothing listens on port 1, so the check fails with connection refused.
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{
+		{Host: "127.0.0.1", Port: "1", Name: "app", User: "app", Pass: "s3cret"},
+	}, time.Hour)
+	exporter.performChecks(nil)
+
+	statuses := exporter.Status()
+	if len(statuses) != 1 {
+		t.Fatalf("Status() returned %d targets, want 1", len(statuses))
+	}
+	status := statuses[0]
+	if status.Available {
+		t.Fatal("target is available, want unavailable")
+	}
+	if status.Reason != "connection refused" {
+		t.Errorf("status reason = %q, want %q", status.Reason, "connection refused")
+	}
+	if status.Error == "" || strings.Contains(status.Error, "s3cret") {
+		t.Errorf("status error = %q, want non-empty redacted error", status.Error)
+	}
+
+	expected := `
+# HELP db_connection_last_error_info Class of the last connection error for currently unavailable databases (always 1)
+# TYPE db_connection_last_error_info gauge
+db_connection_last_error_info{reason="connection refused",severity="critical",target="127.0.0.1:1/app"} 1
+`
+	if err := testutil.CollectAndCompare(exporter.lastErrorMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "empty uses interval", spec: ""},
+		{name: "five fields", spec: "*/5 * * * *"},
+		{name: "business hours", spec: "0 9-18 * * 1-5"},
+		{name: "descriptor", spec: "@every 1m"},
+		{name: "invalid", spec: "every five minutes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := NewMultiMySQLExporter(nil, time.Minute)
+			err := exporter.SetSchedule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetSchedule(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPerformChecksSkipsOpenCircuit(t *testing.T) {
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{
+		{Host: "127.0.0.1", Port: "1", Name: "app", User: "app", Pass: "secret"},
+	}, time.Hour)
+	exporter.SetCircuitBreaker(1, time.Hour, time.Hour)
+
+	exporter.performChecks(nil)
+	first := exporter.Status()[0]
+	if !first.CircuitOpen {
+		t.Fatal("circuit is closed after reaching the failure threshold")
+	}
+
+	exporter.performChecks(nil)
+	second := exporter.Status()[0]
+	if !second.CheckedAt.Equal(first.CheckedAt) {
+		t.Error("database with an open circuit was checked again")
+	}
+
+	expected := `
+# HELP mysql_connection_circuit_open Whether checks of a MySQL database are suspended by the circuit breaker (1 = suspended)
+# TYPE mysql_connection_circuit_open gauge
+mysql_connection_circuit_open{database="app",host="127.0.0.1",port="1",severity="critical",type="mysql"} 1
+`
+	if err := testutil.CollectAndCompare(exporter.circuitMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProbeReusesFreshResults(t *testing.T) {
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{
+		{Host: "127.0.0.1", Port: "1", Name: "app", User: "app", Pass: "app"},
+	}, time.Hour)
+
+	first := exporter.Probe(time.Minute)
+	if len(first) != 1 {
+		t.Fatalf("Probe() returned %d targets, want 1", len(first))
+	}
+
+	cached := exporter.Probe(time.Minute)
+	if !cached[0].CheckedAt.Equal(first[0].CheckedAt) {
+		t.Errorf("Probe() within ttl checked again at %v, want cached result from %v", cached[0].CheckedAt, first[0].CheckedAt)
+	}
+
+	fresh := exporter.Probe(0)
+	if !fresh[0].CheckedAt.After(first[0].CheckedAt) {
+		t.Errorf("Probe() with expired ttl returned result from %v, want a new check", fresh[0].CheckedAt)
+	}
+}
+
+type refusingDialer struct {
+	dials int
+}
+
+func (d *refusingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dials++
+	return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+}
+
+func TestProbeWithFakeClockAndDialer(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	dialer := &refusingDialer{}
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{
+		{Host: "db.internal", Port: "3306", Name: "app", User: "app", Pass: "app"},
+	}, time.Hour)
+	exporter.SetClock(fake)
+	exporter.SetDialer(dialer)
+
+	first := exporter.Probe(time.Minute)
+	if dialer.dials != 1 {
+		t.Fatalf("dialer called %d times, want 1", dialer.dials)
+	}
+	if !first[0].CheckedAt.Equal(fake.Now()) || first[0].Reason != "connection refused" {
+		t.Fatalf("Probe() = checked at %v with reason %q, want %v and %q", first[0].CheckedAt, first[0].Reason, fake.Now(), "connection refused")
+	}
+
+	fake.Advance(59 * time.Second)
+	exporter.Probe(time.Minute)
+	if dialer.dials != 1 {
+		t.Errorf("Probe() within ttl dialed again, %d dials", dialer.dials)
+	}
+
+	fake.Advance(time.Second)
+	exporter.Probe(time.Minute)
+	if dialer.dials != 2 {
+		t.Errorf("Probe() after ttl made %d dials, want 2", dialer.dials)
+	}
+}
+
+// blockingDialer refuses connections once release is closed.
+type blockingDialer struct {
+	dialing chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialing <- struct{}{}
+	<-d.release
+	return nil, &net.OpError{Op: "dial", Net: network, Err: syscall.ECONNREFUSED}
+}
+
+func TestStatusDuringSlowCheck(t *testing.T) {
+	dialer := &blockingDialer{dialing: make(chan struct{}, 1), release: make(chan struct{})}
+	exporter := NewMultiMySQLExporter([]types.MysqlConfig{
+		{Host: "db.internal", Port: "3306", Name: "app", User: "app", Pass: "app"},
+	}, time.Hour)
+	exporter.SetDialer(dialer)
+
+	done := make(chan struct{})
+	go func() {
+		exporter.performChecks(nil)
+		close(done)
+	}()
+	<-dialer.dialing
+
+	statuses := make(chan []TargetStatus)
+	go func() { statuses <- exporter.Status() }()
+	select {
+	case got := <-statuses:
+		if len(got) != 0 {
+			t.Errorf("Status() = %+v during the first check, want no results yet", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Status() blocked by a running check")
+	}
+	if len(exporter.Targets()) != 1 {
+		t.Errorf("Targets() = %v, want the target", exporter.Targets())
+	}
+
+	close(dialer.release)
+	<-done
+	if got := exporter.Status(); len(got) != 1 || got[0].Reason != "connection refused" {
+		t.Errorf("Status() = %+v after the check, want connection refused", got)
+	}
+}
+
+func TestExporterMockTargets(t *testing.T) {
+	broken := types.MockConfig{Name: "broken", Result: "failure", Reason: "timeout"}.Target()
+	broken.Severity = "warning"
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "ok", Result: "success"}.Target(),
+		broken,
+	}, time.Hour)
+	exporter.performChecks(nil)
+
+	statuses := exporter.Status()
+	if len(statuses) != 2 || !statuses[0].Available || statuses[1].Available || statuses[1].Reason != "timeout" || statuses[1].Severity != "warning" {
+		t.Fatalf("Status() = %+v, want ok available and broken failing with timeout", statuses)
+	}
+
+	expected := `
+# HELP mysql_connection_available MySQL connection availability (1 = available, 0 = unavailable)
+# TYPE mysql_connection_available gauge
+mysql_connection_available{database="broken",host="mock",port="",severity="warning",type="mock"} 0
+mysql_connection_available{database="ok",host="mock",port="",severity="critical",type="mock"} 1
+`
+	if err := testutil.CollectAndCompare(exporter.availabilityMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	expected = `
+# HELP db_connection_last_error_info Class of the last connection error for currently unavailable databases (always 1)
+# TYPE db_connection_last_error_info gauge
+db_connection_last_error_info{reason="timeout",severity="warning",target="mock/broken"} 1
+`
+	if err := testutil.CollectAndCompare(exporter.lastErrorMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExporterArangoDBTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"server":"arango","version":"3.11.5","license":"community"}`)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	exporter := NewExporter([]types.Target{
+		types.ArangoDBConfig{Host: host, Port: port, Database: "_system"}.Target(),
+	}, time.Hour)
+	exporter.performChecks(nil)
+
+	statuses := exporter.Status()
+	if len(statuses) != 1 || !statuses[0].Available {
+		t.Fatalf("Status() = %+v, want the ArangoDB server available", statuses)
+	}
+}
+
+func TestExporterElasticsearchTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logs":
+			fmt.Fprint(w, `{"cluster_name":"logs","version":{"number":"8.13.4"}}`)
+		case "/logs/_cluster/health":
+			fmt.Fprint(w, `{"cluster_name":"logs","status":"green"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	exporter := NewExporter([]types.Target{
+		types.ElasticsearchConfig{URL: server.URL + "/logs", MinStatus: "green"}.Target(),
+	}, time.Hour)
+	exporter.SetAttemptTimeout(5 * time.Second)
+	exporter.performChecks(nil)
+
+	statuses := exporter.Status()
+	if len(statuses) != 1 || !statuses[0].Available {
+		t.Fatalf("Status() = %+v, want the Elasticsearch cluster available", statuses)
+	}
+
+	expected := fmt.Sprintf(`
+# HELP mysql_connection_available MySQL connection availability (1 = available, 0 = unavailable)
+# TYPE mysql_connection_available gauge
+mysql_connection_available{database="logs",host=%q,port=%q,severity="critical",type="elasticsearch"} 1
+`, host, port)
+	if err := testutil.CollectAndCompare(exporter.availabilityMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExporterSinksSkipSimulatedFailures(t *testing.T) {
+	observed := []string{}
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "real", Result: "success"}.Target(),
+		types.MockConfig{Name: "simulated", Result: "success"}.Target(),
+	}, time.Hour)
+	injector := NewFaultInjector(nil)
+	injector.Force("mock/simulated", time.Now().Add(time.Hour))
+	exporter.SetFaultInjector(injector)
+	exporter.AddSink(checker.SinkFunc(func(ctx context.Context, target types.Target, result types.Result) {
+		observed = append(observed, target.Database)
+	}))
+
+	exporter.performChecks(nil)
+	if len(observed) != 1 || observed[0] != "real" {
+		t.Errorf("sink observed %v, want only the real check", observed)
+	}
+}
+
+// flapName returns a new name for a flapping mock target. Flapping mock
+// targets keep their state between tests, so every test needs its own.
+func flapName(name string) string {
+	return fmt.Sprintf("%s-%d", name, flapTargets.Add(1))
+}
+
+var flapTargets atomic.Int64
+
+func TestConsecutiveFailures(t *testing.T) {
+	flap := flapName("flap")
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "down", Result: "failure"}.Target(),
+		types.MockConfig{Name: flap, Result: "flap"}.Target(),
+	}, time.Hour)
+
+	// flap fails, succeeds and fails again.
+	for range 3 {
+		exporter.performChecks(nil)
+	}
+
+	statuses := exporter.Status()
+	if statuses[0].ConsecutiveFailures != 3 || statuses[1].ConsecutiveFailures != 1 {
+		t.Errorf("consecutive failures = %d, %d, want 3, 1", statuses[0].ConsecutiveFailures, statuses[1].ConsecutiveFailures)
+	}
+
+	expected := `
+# HELP mysql_connection_consecutive_failures Number of consecutive failed checks of a MySQL database, 0 after a successful check
+# TYPE mysql_connection_consecutive_failures gauge
+mysql_connection_consecutive_failures{target="mock/down"} 3
+mysql_connection_consecutive_failures{target="mock/` + flap + `"} 1
+`
+	if err := testutil.CollectAndCompare(exporter.failuresMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfirmStateChanges(t *testing.T) {
+	flap := flapName("confirm")
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "up", Result: "success"}.Target(),
+		types.MockConfig{Name: flap, Result: "flap"}.Target(),
+	}, time.Hour)
+	exporter.SetConfirmStateChanges(true)
+	observed := 0
+	exporter.OnResult(func(status TargetStatus) {
+		observed++
+	})
+
+	// flap fails, then every check that finds it back up is confirmed by
+	// a failing second check.
+	for range 3 {
+		exporter.performChecks(nil)
+	}
+
+	statuses := exporter.Status()
+	if !statuses[0].Available || statuses[1].Available {
+		t.Errorf("statuses = %+v, want up available and flap unavailable", statuses)
+	}
+	if statuses[1].ConsecutiveFailures != 3 {
+		t.Errorf("flap consecutive failures = %d, want 3", statuses[1].ConsecutiveFailures)
+	}
+	if observed != 6 {
+		t.Errorf("OnResult called %d times, want once per check of each target", observed)
+	}
+}
+
+func TestExporterChecksIdenticalTargetsOnce(t *testing.T) {
+	flap := types.MockConfig{Name: flapName("shared"), Result: "flap"}.Target()
+	alias := flap
+	alias.Host = "MOCK."
+	exporter := NewExporter([]types.Target{flap, alias}, time.Hour)
+	observed := 0
+	exporter.AddSink(checker.SinkFunc(func(ctx context.Context, target types.Target, result types.Result) {
+		observed++
+	}))
+
+	// A flapping target changes its result on every check, so both
+	// targets only agree if they share one.
+	for round := range 2 {
+		exporter.performChecks(nil)
+		statuses := exporter.Status()
+		if statuses[0].Available != statuses[1].Available {
+			t.Fatalf("round %d: statuses = %+v, want the same result for both", round, statuses)
+		}
+	}
+	if observed != 4 {
+		t.Errorf("sink observed %d results, want one per target and round", observed)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "synced", Result: "success", ClockSkew: 200 * time.Millisecond}.Target(),
+		types.MockConfig{Name: "skewed", Result: "success", ClockSkew: 5 * time.Second}.Target(),
+		types.MockConfig{Name: "down", Result: "failure", ClockSkew: 5 * time.Second}.Target(),
+	}, time.Hour)
+	exporter.SetMaxClockSkew(time.Second)
+	exporter.performChecks(nil)
+
+	statuses := exporter.Status()
+	if !statuses[0].Available || statuses[1].Available || statuses[1].Reason != "clock skew" {
+		t.Errorf("statuses = %+v, want synced available and skewed failing with clock skew", statuses[:2])
+	}
+	if statuses[1].ClockSkewSeconds != 5 {
+		t.Errorf("skewed clock_skew_seconds = %v, want 5", statuses[1].ClockSkewSeconds)
+	}
+
+	// Unreachable databases have no server time to compare.
+	expected := `
+# HELP db_clock_skew_seconds Server clock of a database minus the clock of the exporter in seconds, measured when MAX_CLOCK_SKEW is set
+# TYPE db_clock_skew_seconds gauge
+db_clock_skew_seconds{target="mock/skewed"} 5
+db_clock_skew_seconds{target="mock/synced"} 0.2
+`
+	if err := testutil.CollectAndCompare(exporter.clockSkewMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       types.MockConfig
+		attempts     int
+		wantAttempts int
+		wantOK       bool
+		wantMetric   bool
+	}{
+		{name: "no retries", target: types.MockConfig{Name: flapName("retry"), Result: "flap"}, attempts: 1, wantAttempts: 1},
+		{name: "succeeds on second attempt", target: types.MockConfig{Name: flapName("retry"), Result: "flap"}, attempts: 3, wantAttempts: 2, wantOK: true, wantMetric: true},
+		{name: "all attempts fail", target: types.MockConfig{Name: "retry-down", Result: "failure"}, attempts: 3, wantAttempts: 3},
+		{name: "not retryable", target: types.MockConfig{Name: "retry-auth", Result: "failure", Reason: "auth error"}, attempts: 3, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed := 0
+			exporter := NewExporter([]types.Target{tt.target.Target()}, time.Hour)
+			exporter.SetRetries(tt.attempts, 0)
+			exporter.AddSink(checker.SinkFunc(func(ctx context.Context, target types.Target, result types.Result) {
+				observed++
+			}))
+			exporter.performChecks(nil)
+
+			status := exporter.Status()[0]
+			if status.Available != tt.wantOK || status.Attempts != tt.wantAttempts {
+				t.Errorf("status = available %v after %d attempts, want %v after %d", status.Available, status.Attempts, tt.wantOK, tt.wantAttempts)
+			}
+			if observed != tt.wantAttempts {
+				t.Errorf("sink observed %d attempts, want %d", observed, tt.wantAttempts)
+			}
+			if got := testutil.CollectAndCount(exporter.attemptsMetric); (got == 1) != tt.wantMetric {
+				t.Errorf("mysql_connection_attempts_used has %d series, want series %v", got, tt.wantMetric)
+			}
+			if tt.wantMetric && testutil.ToFloat64(exporter.attemptsMetric) != float64(tt.wantAttempts) {
+				t.Errorf("mysql_connection_attempts_used = %v, want %d", testutil.ToFloat64(exporter.attemptsMetric), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+// everySchedule starts cycles every d, unlike cron.Every it allows d under
+// a second.
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+func TestRunCycleOverruns(t *testing.T) {
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "slow", Result: "success", Delay: 20 * time.Millisecond}.Target(),
+	}, time.Hour)
+
+	exporter.runCycle("@every 1h", everySchedule(time.Hour), []int{0})
+	exporter.runCycle("@every 1ms", everySchedule(time.Millisecond), []int{0})
+	exporter.runCycle("@every 1ms", everySchedule(time.Millisecond), []int{0})
+
+	overruns := map[string]float64{
+		"@every 1h":  0,
+		"@every 1ms": 2,
+	}
+	for name, want := range overruns {
+		labels := prometheus.Labels{"schedule": name}
+		if got := testutil.ToFloat64(exporter.overrunsMetric.With(labels)); got != want {
+			t.Errorf("overruns of %q = %v, want %v", name, got, want)
+		}
+		if got := testutil.ToFloat64(exporter.cycleMetric.With(labels)); got < 0.02 {
+			t.Errorf("cycle duration of %q = %v, want at least the 20ms check", name, got)
+		}
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "ok", Result: "success"}.Target(),
+		types.MockConfig{Name: "broken", Result: "failure"}.Target(),
+	}, 30*time.Second)
+	exporter.SetClock(fake)
+	exporter.SetAdaptiveInterval(10*time.Second, time.Minute)
+
+	exporter.performChecks(nil)
+	fake.Advance(10 * time.Second)
+	if due := exporter.dueTargets([]int{0, 1}); !slices.Equal(due, []int{1}) {
+		t.Errorf("dueTargets() after 10s = %v, want only the failing database", due)
+	}
+	fake.Advance(20 * time.Second)
+	if due := exporter.dueTargets([]int{0, 1}); !slices.Equal(due, []int{0, 1}) {
+		t.Errorf("dueTargets() after 30s = %v, want both databases", due)
+	}
+
+	exporter.performChecks([]int{0, 1})
+	expected := `
+# HELP db_connect_checker_check_interval_seconds Current interval between checks of a database chosen by CHECK_INTERVAL_MIN and CHECK_INTERVAL_MAX
+# TYPE db_connect_checker_check_interval_seconds gauge
+db_connect_checker_check_interval_seconds{target="mock/broken"} 10
+db_connect_checker_check_interval_seconds{target="mock/ok"} 60
+`
+	if err := testutil.CollectAndCompare(exporter.intervalMetric, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import "time"
+
+// pacer подбирает интервал проверок одной базы: после неудачной проверки
+// база проверяется каждые min, чтобы восстановление было видно сразу, а
+// каждая успешная проверка удваивает интервал, но не больше max, чтобы
+// давно стабильные базы не нагружались зря. Проверки группы с адаптивным
+// интервалом запускаются каждые min, pacer решает, какие базы проверить.
+type pacer struct {
+	min time.Duration
+	max time.Duration
+
+	current time.Duration
+	next    time.Time
+}
+
+// allow сообщает, нужно ли проверять базу в момент now. Запуски группы
+// сдвигаются на доли секунды, поэтому база проверяется, если до срока
+// осталось меньше половины min.
+func (p *pacer) allow(now time.Time) bool {
+	return p.max <= 0 || !now.Add(p.min/2).Before(p.next)
+}
+
+// record учитывает результат проверки, выполненной в момент now; initial -
+// интервал до первой проверки.
+func (p *pacer) record(success bool, now time.Time, initial time.Duration) {
+	if p.max <= 0 {
+		return
+	}
+	switch {
+	case !success:
+		p.current = p.min
+	case p.current == 0:
+		p.current = initial
+	default:
+		p.current *= 2
+	}
+	p.current = min(max(p.current, p.min), p.max)
+	p.next = now.Add(p.current)
+}
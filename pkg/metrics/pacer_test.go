@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacer(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := &pacer{min: 10 * time.Second, max: 2 * time.Minute}
+
+	steps := []struct {
+		name    string
+		at      time.Duration
+		success bool
+		want    time.Duration
+	}{
+		{name: "first check keeps the initial interval", at: 0, success: true, want: 30 * time.Second},
+		{name: "stable, doubles", at: 30 * time.Second, success: true, want: time.Minute},
+		{name: "stable, capped", at: 90 * time.Second, success: true, want: 2 * time.Minute},
+		{name: "failure drops to min", at: 210 * time.Second, want: 10 * time.Second},
+		{name: "still failing", at: 220 * time.Second, want: 10 * time.Second},
+		{name: "recovered, grows again", at: 230 * time.Second, success: true, want: 20 * time.Second},
+	}
+
+	for _, step := range steps {
+		now := start.Add(step.at)
+		if !p.allow(now) {
+			t.Fatalf("%s: check not allowed at %v", step.name, step.at)
+		}
+		p.record(step.success, now, 30*time.Second)
+
+		if p.current != step.want {
+			t.Errorf("%s: interval = %v, want %v", step.name, p.current, step.want)
+		}
+		if p.allow(now.Add(step.want - p.min)) {
+			t.Errorf("%s: check allowed before the interval passed", step.name)
+		}
+		// Cycles run every min and may start a little early.
+		if !p.allow(now.Add(step.want - time.Second)) {
+			t.Errorf("%s: check not allowed in the cycle at the end of the interval", step.name)
+		}
+	}
+}
+
+func TestPacerDisabled(t *testing.T) {
+	p := &pacer{}
+	now := time.Now()
+	p.record(true, now, time.Hour)
+	if !p.allow(now) {
+		t.Error("disabled pacer should always allow checks")
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/tapclap/db-connect-checker/pkg/checker"
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// newScheduler возвращает планировщик циклов проверок: следующий запуск
+// цикла пропускается, если предыдущий еще не закончился.
+func newScheduler() *cron.Cron {
+	return cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+}
+
+// parseSchedule возвращает расписание spec и его имя для метрик и логов.
+// Пустое или неверное spec означает проверки каждые interval.
+func parseSchedule(spec string, interval time.Duration) (cron.Schedule, string) {
+	schedule := cron.Schedule(cron.Every(interval))
+	name := "@every " + interval.String()
+	if spec != "" {
+		parsed, err := cron.ParseStandard(spec)
+		if err != nil {
+			log.Error("Invalid check schedule, using the interval", "schedule", spec, "interval", interval, "error", err)
+		} else {
+			schedule, name = parsed, spec
+		}
+	}
+	return schedule, name
+}
+
+// retries - повторы попыток в одной проверке базы, см. SetRetries.
+type retries struct {
+	attempts int
+	delay    time.Duration
+}
+
+// check выполняет check до r.attempts раз, пока попытка не пройдет или не
+// вернет неповторяемую ошибку, и выдерживает r.delay по clk между
+// попытками. observe получает результат каждой попытки.
+func (r retries) check(ctx context.Context, clk clock.Clock, target types.Target, check func() types.Result, observe func(types.Result)) types.Result {
+	for attempt := 1; ; attempt++ {
+		result := check()
+		observe(result)
+		result.Attempts = attempt
+		if result.Err == nil || attempt >= r.attempts || !checker.Retryable(target, result.Err) {
+			return result
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-clk.After(r.delay):
+		}
+	}
+}
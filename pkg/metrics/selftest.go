@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SelfTestCheck - одна проверка самодиагностики экспортера.
+type SelfTestCheck struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// SelfTestResult - результат одной проверки самодиагностики.
+type SelfTestResult struct {
+	Name            string  `json:"name"`
+	Passed          bool    `json:"passed"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// SelfTestReport - тело ответа эндпоинта /-/selftest.
+type SelfTestReport struct {
+	Passed bool             `json:"passed"`
+	Checks []SelfTestResult `json:"checks"`
+}
+
+// GatherCheck проверяет, что gatherer собирает метрики без ошибок и среди них
+// есть семейства names, то есть коллекторы зарегистрированы.
+func GatherCheck(gatherer prometheus.Gatherer, names ...string) SelfTestCheck {
+	return SelfTestCheck{
+		Name: "metrics",
+		Run: func(ctx context.Context) error {
+			families, err := gatherer.Gather()
+			if err != nil {
+				return err
+			}
+			gathered := map[string]bool{}
+			for _, family := range families {
+				gathered[family.GetName()] = true
+			}
+			for _, name := range names {
+				if !gathered[name] {
+					return fmt.Errorf("metric %s is not registered", name)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// RunSelfTest выполняет проверки по очереди, каждую не дольше timeout.
+func RunSelfTest(ctx context.Context, timeout time.Duration, checks ...SelfTestCheck) SelfTestReport {
+	report := SelfTestReport{Passed: true, Checks: []SelfTestResult{}}
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := check.Run(checkCtx)
+		cancel()
+
+		result := SelfTestResult{
+			Name:            check.Name,
+			Passed:          err == nil,
+			DurationSeconds: time.Since(start).Seconds(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+			report.Passed = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// SelfTestHandler выполняет checks при каждом запросе и отдает отчет в JSON
+// для smoke-тестов после деплоя. Код ответа 200, если все проверки прошли,
+// иначе 503.
+func SelfTestHandler(timeout time.Duration, checks ...SelfTestCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := RunSelfTest(r.Context(), timeout, checks...)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Passed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSelfTestHandler(t *testing.T) {
+	pass := SelfTestCheck{Name: "pass", Run: func(ctx context.Context) error { return nil }}
+	fail := SelfTestCheck{Name: "fail", Run: func(ctx context.Context) error { return errors.New("broken") }}
+	slow := SelfTestCheck{Name: "slow", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name       string
+		checks     []SelfTestCheck
+		wantCode   int
+		wantPassed []bool
+	}{
+		{name: "no checks", wantCode: http.StatusOK, wantPassed: []bool{}},
+		{name: "all pass", checks: []SelfTestCheck{pass, pass}, wantCode: http.StatusOK, wantPassed: []bool{true, true}},
+		{name: "one fails", checks: []SelfTestCheck{pass, fail}, wantCode: http.StatusServiceUnavailable, wantPassed: []bool{true, false}},
+		{name: "slow check times out", checks: []SelfTestCheck{slow, pass}, wantCode: http.StatusServiceUnavailable, wantPassed: []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			SelfTestHandler(10*time.Millisecond, tt.checks...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/selftest", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("SelfTestHandler() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			var report SelfTestReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Checks) != len(tt.wantPassed) {
+				t.Fatalf("report has %d checks, want %d", len(report.Checks), len(tt.wantPassed))
+			}
+			for i, want := range tt.wantPassed {
+				if report.Checks[i].Passed != want || (want == (report.Checks[i].Error != "")) {
+					t.Errorf("check %s = %+v, want passed %v", report.Checks[i].Name, report.Checks[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestGatherCheck(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewBuildInfoCollector())
+
+	if err := GatherCheck(registry, "db_connect_checker_build_info").Run(context.Background()); err != nil {
+		t.Errorf("GatherCheck() for registered metric error = %v", err)
+	}
+	if err := GatherCheck(registry, "mysql_connection_available").Run(context.Background()); err == nil {
+		t.Error("GatherCheck() for missing metric expected error but got none")
+	}
+}
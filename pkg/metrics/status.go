@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TargetStatus - результат последней проверки одной базы данных.
+type TargetStatus struct {
+	Host            string    `json:"host"`
+	Port            string    `json:"port"`
+	Database        string    `json:"database"`
+	Severity        string    `json:"severity"`
+	Available       bool      `json:"available"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	CheckedAt       time.Time `json:"checked_at"`
+	// AgeSeconds - сколько секунд прошло с проверки на момент ответа.
+	AgeSeconds float64 `json:"age_seconds"`
+	// ServerVersion - версия сервера, если ее удалось прочитать.
+	ServerVersion string `json:"server_version,omitempty"`
+	// Reason и Error заполняются, только если проверка не прошла. Пароли в
+	// Error скрыты.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Attempts - сколько попыток заняла проверка (см. SetRetries).
+	Attempts int `json:"attempts"`
+	// ConsecutiveFailures - сколько проверок подряд закончились неудачей.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// ClockSkewSeconds - насколько часы сервера спешат относительно часов
+	// экспортера, если проверка часов включена (см. SetMaxClockSkew).
+	ClockSkewSeconds float64 `json:"clock_skew_seconds,omitempty"`
+	// VariableMismatches - переменные сервера, значения которых отличаются от
+	// ожидаемых (см. MYSQL_EXPECT_VARIABLES).
+	VariableMismatches []string `json:"variable_mismatches,omitempty"`
+	// FailedUsers - пользователи из MYSQL_EXTRA_USERS, которые не смогли
+	// подключиться.
+	FailedUsers []string `json:"failed_users,omitempty"`
+	// Account - аккаунт, с которым сервер сопоставил пользователя, если задан
+	// MYSQL_ACCOUNT_HOST.
+	Account string `json:"account,omitempty"`
+	// Warnings - проблемы, найденные успешной проверкой.
+	Warnings []string `json:"warnings,omitempty"`
+	// FreeSpacePercent - доля свободного места в табличных пространствах базы,
+	// если измерение включено (см. SetTablespaceMetrics).
+	FreeSpacePercent float64 `json:"free_space_percent,omitempty"`
+	// LongQueries и LockWaits - число долгих запросов и сессий, ожидающих
+	// блокировок (см. SetLongQueryThreshold).
+	LongQueries int `json:"long_queries,omitempty"`
+	LockWaits   int `json:"lock_waits,omitempty"`
+	// ThreadsConnected и ThreadsRunning - Threads_connected и Threads_running
+	// сервера (см. SetThreadsMetrics).
+	ThreadsConnected int `json:"threads_connected,omitempty"`
+	ThreadsRunning   int `json:"threads_running,omitempty"`
+	// FlowControlPaused - доля времени, которую узел Percona XtraDB Cluster
+	// простоял из-за flow control (см. SetFlowControlMetrics).
+	FlowControlPaused float64 `json:"flow_control_paused,omitempty"`
+	// CircuitOpen - проверки базы приостановлены после серии неудач.
+	CircuitOpen bool `json:"circuit_open,omitempty"`
+}
+
+// StatusResponse - тело ответа эндпоинта /status.
+type StatusResponse struct {
+	Healthy bool           `json:"healthy"`
+	Targets []TargetStatus `json:"targets"`
+}
+
+// StatusSource - источник закешированных результатов проверок.
+type StatusSource interface {
+	Status() []TargetStatus
+}
+
+// Prober - источник результатов, который перепроверяет базы, если их
+// результат старше maxAge.
+type Prober interface {
+	Probe(maxAge time.Duration) []TargetStatus
+}
+
+// StatusHandler отдает закешированные результаты проверок в JSON, не выполняя
+// новых подключений. Код ответа 200, если все базы доступны, иначе 503.
+func StatusHandler(sources ...StatusSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := []TargetStatus{}
+		for _, source := range sources {
+			statuses = append(statuses, source.Status()...)
+		}
+		writeStatus(w, statuses)
+	})
+}
+
+// ProbeHandler проверяет базы при запросе, но не чаще раза в ttl: пока
+// результат моложе ttl, он отдается из кеша, так что частые запросы не
+// создают новых подключений. Формат ответа тот же, что у StatusHandler.
+func ProbeHandler(ttl time.Duration, probers ...Prober) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := []TargetStatus{}
+		for _, prober := range probers {
+			statuses = append(statuses, prober.Probe(ttl)...)
+		}
+		writeStatus(w, statuses)
+	})
+}
+
+// HealthzHandler отвечает 200, пока процесс экспортера жив, и не зависит от
+// доступности баз. Подходит для liveness-проб Kubernetes.
+func HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadyzHandler отвечает 200, если все базы были доступны при последней
+// проверке, иначе 503 со списком недоступных баз. Как и StatusHandler, он
+// не открывает новых подключений. Подходит для readiness-проб Kubernetes.
+func ReadyzHandler(sources ...StatusSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unavailable := []TargetStatus{}
+		for _, source := range sources {
+			for _, status := range source.Status() {
+				if !status.Available {
+					unavailable = append(unavailable, status)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(unavailable) == 0 {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, status := range unavailable {
+			address := status.Host
+			if status.Port != "" {
+				address = net.JoinHostPort(status.Host, status.Port)
+			}
+			fmt.Fprintf(w, "%s/%s: unavailable (%s)\n", address, status.Database, status.Reason)
+		}
+	})
+}
+
+func writeStatus(w http.ResponseWriter, statuses []TargetStatus) {
+	response := StatusResponse{
+		Healthy: true,
+		Targets: statuses,
+	}
+	now := time.Now()
+	for i, status := range statuses {
+		if !status.Available {
+			response.Healthy = false
+		}
+		statuses[i].AgeSeconds = now.Sub(status.CheckedAt).Seconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !response.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
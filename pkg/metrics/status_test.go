@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticStatusSource []TargetStatus
+
+func (s staticStatusSource) Status() []TargetStatus {
+	return s
+}
+
+func TestStatusHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []TargetStatus
+		wantCode    int
+		wantHealthy bool
+	}{
+		{
+			name:        "no targets is healthy",
+			statuses:    nil,
+			wantCode:    http.StatusOK,
+			wantHealthy: true,
+		},
+		{
+			name: "all targets available",
+			statuses: []TargetStatus{
+				{Host: "db1", Port: "3306", Database: "app", Available: true},
+				{Host: "db2", Port: "3306", Database: "app", Available: true},
+			},
+			wantCode:    http.StatusOK,
+			wantHealthy: true,
+		},
+		{
+			name: "one target unavailable",
+			statuses: []TargetStatus{
+				{Host: "db1", Port: "3306", Database: "app", Available: true},
+				{Host: "db2", Port: "3306", Database: "app", Available: false},
+			},
+			wantCode:    http.StatusServiceUnavailable,
+			wantHealthy: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			StatusHandler(staticStatusSource(tt.statuses)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("StatusHandler() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			var response StatusResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("StatusHandler() returned invalid JSON: %v", err)
+			}
+			if response.Healthy != tt.wantHealthy {
+				t.Errorf("StatusHandler() healthy = %v, want %v", response.Healthy, tt.wantHealthy)
+			}
+			if len(response.Targets) != len(tt.statuses) {
+				t.Errorf("StatusHandler() returned %d targets, want %d", len(response.Targets), len(tt.statuses))
+			}
+		})
+	}
+}
+
+type countingProber struct {
+	calls  int
+	maxAge time.Duration
+	status TargetStatus
+}
+
+func (p *countingProber) Probe(maxAge time.Duration) []TargetStatus {
+	p.calls++
+	p.maxAge = maxAge
+	return []TargetStatus{p.status}
+}
+
+func TestProbeHandler(t *testing.T) {
+	prober := &countingProber{
+		status: TargetStatus{Host: "db1", Port: "3306", Database: "app", Available: false, CheckedAt: time.Now().Add(-5 * time.Second)},
+	}
+
+	rec := httptest.NewRecorder()
+	ProbeHandler(15*time.Second, prober).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe", nil))
+
+	if prober.calls != 1 || prober.maxAge != 15*time.Second {
+		t.Errorf("ProbeHandler() called Probe %d times with maxAge %v, want once with 15s", prober.calls, prober.maxAge)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ProbeHandler() code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	var response StatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("ProbeHandler() returned invalid JSON: %v", err)
+	}
+	if len(response.Targets) != 1 {
+		t.Fatalf("ProbeHandler() returned %d targets, want 1", len(response.Targets))
+	}
+	if age := response.Targets[0].AgeSeconds; age < 5 || age > 10 {
+		t.Errorf("ProbeHandler() age_seconds = %v, want about 5", age)
+	}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	HealthzHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Errorf("HealthzHandler() = %d %q, want 200 ok", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	mysql := staticStatusSource{
+		{Host: "db1", Port: "3306", Database: "app", Available: true},
+		{Host: "db2", Port: "3306", Database: "app", Available: false, Reason: "connection refused"},
+	}
+	mongo := staticStatusSource{
+		{Host: "mongo-0:27017,mongo-1:27017", Database: "events", Available: false, Reason: "timeout"},
+	}
+
+	rec := httptest.NewRecorder()
+	ReadyzHandler(mysql, mongo).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ReadyzHandler() code = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	for _, want := range []string{"db2:3306/app: unavailable (connection refused)", "mongo-0:27017,mongo-1:27017/events: unavailable (timeout)"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("ReadyzHandler() body = %q, want it to contain %q", rec.Body.String(), want)
+		}
+	}
+	if strings.Contains(rec.Body.String(), "db1") {
+		t.Errorf("ReadyzHandler() body = %q, want only unavailable targets", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ReadyzHandler(mysql[:1], staticStatusSource(nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Errorf("ReadyzHandler() = %d %q, want 200 ok", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// targetName - имя цели в API и в label target: host:port/database.
+func targetName(target types.Target) string {
+	return target.Address() + "/" + target.Database
+}
+
+// targetLabels - метки метрик доступности базы. Важность (severity) входит в
+// них, чтобы алерты могли отличать упавшую аналитическую реплику от упавшей
+// основной базы платежей, а тип (type) - чтобы отличать базы MySQL от
+// остальных целей NewExporter, метрики которых названы так же.
+func targetLabels(target types.Target) prometheus.Labels {
+	return prometheus.Labels{
+		"type":     target.Type,
+		"host":     target.Host,
+		"port":     target.Port,
+		"database": target.Database,
+		"severity": target.SeverityLevel(),
+	}
+}
+
+// TargetInfo - описание цели в ответе GET /targets.
+type TargetInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Database string `json:"database"`
+	Schedule string `json:"schedule,omitempty"`
+	// Conflict заполнен, если база задана в нескольких источниках с разными
+	// настройками.
+	Conflict *util.TargetConflict `json:"conflict,omitempty"`
+}
+
+// SetConflicts сообщает о базах, которые заданы в нескольких источниках
+// (переменные окружения, TARGETS_DIR) с разными настройками, см.
+// util.ReconcileMysqlConfigs. Конфликты попадают в метрику
+// db_connect_checker_target_conflicts и в ответ GET /targets.
+func (e *MultiMySQLExporter) SetConflicts(conflicts []util.TargetConflict) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.conflicts = slices.Clone(conflicts)
+	e.conflictsMetric.Reset()
+	for _, conflict := range conflicts {
+		e.conflictsMetric.WithLabelValues(conflict.Target).Set(float64(len(conflict.Sources)))
+	}
+}
+
+// AddTarget добавляет базу в работающий экспортер и сразу проверяет ее, не
+// дожидаясь расписания. Возвращает результат первой проверки или ошибку,
+// если база с тем же host:port/database уже проверяется.
+func (e *MultiMySQLExporter) AddTarget(target types.Target) (TargetStatus, error) {
+	name := targetName(target)
+
+	e.mu.Lock()
+	for i, existing := range e.targets {
+		if !e.removed[i] && targetName(existing) == name {
+			e.mu.Unlock()
+			return TargetStatus{}, fmt.Errorf("target %s already exists", name)
+		}
+	}
+	b := e.breakerConfig
+	p := e.pacerConfig
+	e.targets = append(e.targets, target)
+	e.breakers = append(e.breakers, &b)
+	e.pacers = append(e.pacers, &p)
+	e.removed = append(e.removed, false)
+	e.credentialsReadAt = append(e.credentialsReadAt, time.Time{})
+	e.statuses = append(e.statuses, TargetStatus{})
+	index := len(e.targets) - 1
+	if e.scheduler != nil {
+		e.scheduleGroup(e.scheduleOf(target))
+	}
+	e.mu.Unlock()
+
+	e.performChecks([]int{index})
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.statuses[index], nil
+}
+
+// RemoveTarget прекращает проверки базы с именем host:port/database и
+// удаляет ее метрики. Возвращает false, если такой базы нет.
+func (e *MultiMySQLExporter) RemoveTarget(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, target := range e.targets {
+		if e.removed[i] || targetName(target) != name {
+			continue
+		}
+		e.removed[i] = true
+		e.statuses[i] = TargetStatus{}
+
+		labels := targetLabels(target)
+		for _, vec := range []*prometheus.GaugeVec{e.availabilityMetric, e.durationMetric, e.circuitMetric, e.attemptsMetric} {
+			vec.Delete(labels)
+		}
+		e.durationHistogram.Delete(labels)
+		e.lastErrorMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.failuresMetric.Delete(prometheus.Labels{"target": name})
+		e.conflictsMetric.Delete(prometheus.Labels{"target": name})
+		e.clockSkewMetric.Delete(prometheus.Labels{"target": name})
+		e.variablesMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.tablespaceMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.longQueriesMetric.Delete(prometheus.Labels{"target": name})
+		e.lockWaitsMetric.Delete(prometheus.Labels{"target": name})
+		e.threadsMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.flowPausedMetric.Delete(prometheus.Labels{"target": name})
+		e.flowEventsMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.credentialsMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.accountMetric.DeletePartialMatch(prometheus.Labels{"target": name})
+		e.intervalMetric.Delete(prometheus.Labels{"target": name})
+		e.conflicts = slices.DeleteFunc(e.conflicts, func(c util.TargetConflict) bool { return c.Target == name })
+		return true
+	}
+	return false
+}
+
+// Targets возвращает проверяемые базы.
+func (e *MultiMySQLExporter) Targets() []TargetInfo {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	targets := []TargetInfo{}
+	for i, target := range e.targets {
+		if e.removed[i] {
+			continue
+		}
+		info := TargetInfo{
+			Name:     targetName(target),
+			Type:     target.Type,
+			Host:     target.Host,
+			Port:     target.Port,
+			Database: target.Database,
+			Schedule: target.Schedule,
+		}
+		for _, conflict := range e.conflicts {
+			if conflict.Target == info.Name {
+				info.Conflict = &conflict
+			}
+		}
+		targets = append(targets, info)
+	}
+	return targets
+}
+
+// TargetStore сохраняет цели, добавленные и удаленные через TargetsHandler,
+// например в файле конфигурации (config.Store) или каталоге TARGETS_DIR
+// (util.TargetsDir).
+type TargetStore interface {
+	Save(name string, values map[string]string) error
+	Delete(name string) error
+}
+
+// targetChange - ответ на добавление или удаление цели.
+type targetChange struct {
+	Name      string        `json:"name"`
+	Persisted bool          `json:"persisted"`
+	Error     string        `json:"error,omitempty"`
+	Status    *TargetStatus `json:"status,omitempty"`
+}
+
+// TargetsHandler управляет базами работающего экспортера:
+//
+//	GET /targets                 - список баз
+//	POST /targets                - добавить базу MySQL; тело - JSON-объект с
+//	                               переменными MYSQL_* без суффикса _N, как в
+//	                               файле TARGETS_DIR
+//	DELETE /targets/{name}       - удалить базу по имени host:port/database
+//
+// Каждый запрос должен содержать заголовок "Authorization: Bearer <token>".
+// Изменения сохраняются в store, если он задан. Если сохранить не удалось
+// (например, каталог смонтирован только для чтения), изменение все равно
+// действует до перезапуска, а в ответе persisted равно false.
+func TargetsHandler(exporter *MultiMySQLExporter, token string, store TargetStore) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /targets", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, exporter.Targets())
+	})
+	mux.HandleFunc("POST /targets", func(w http.ResponseWriter, r *http.Request) {
+		var values map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			http.Error(w, "request body must be a JSON object of MYSQL_* variables", http.StatusBadRequest)
+			return
+		}
+		// Unknown variables are rejected: they would be saved to the
+		// store and read on the next start.
+		if errs := util.CheckMysqlVariables("request", values); len(errs) > 0 {
+			http.Error(w, errors.Join(errs...).Error(), http.StatusBadRequest)
+			return
+		}
+		config, errs := util.MysqlConfigFromValues("request", values)
+		if len(errs) > 0 {
+			http.Error(w, errors.Join(errs...).Error(), http.StatusBadRequest)
+			return
+		}
+		if config.TLS {
+			tlsConfig, err := util.LoadTLSConfig(config.TLSCAFile)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			config.TLSConfig = tlsConfig
+		}
+
+		target := config.Target()
+		status, err := exporter.AddTarget(target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		change := targetChange{Name: targetName(target), Status: &status}
+		if store != nil {
+			change.record(store.Save(change.Name, values))
+		}
+		writeJSON(w, http.StatusCreated, change)
+	})
+	mux.HandleFunc("DELETE /targets/{name...}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if !exporter.RemoveTarget(name) {
+			http.Error(w, fmt.Sprintf("target %s not found", name), http.StatusNotFound)
+			return
+		}
+		change := targetChange{Name: name}
+		if store != nil {
+			change.record(store.Delete(name))
+		}
+		writeJSON(w, http.StatusOK, change)
+	})
+
+	return requireToken(token, mux)
+}
+
+// requireToken пропускает к next только запросы с заголовком
+// "Authorization: Bearer <token>".
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// record отмечает результат сохранения изменения в TargetStore.
+func (c *targetChange) record(err error) {
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	c.Persisted = true
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
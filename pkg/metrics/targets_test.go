@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// memoryStore records the targets saved by TargetsHandler.
+type memoryStore struct {
+	saved map[string]map[string]string
+	err   error
+}
+
+func (s *memoryStore) Save(name string, values map[string]string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.saved[name] = values
+	return nil
+}
+
+func (s *memoryStore) Delete(name string) error {
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.saved, name)
+	return nil
+}
+
+func TestTargetsHandler(t *testing.T) {
+	exporter := NewExporter([]types.Target{types.MockConfig{Name: "static", Result: "success"}.Target()}, time.Hour)
+	exporter.performChecks(nil)
+	store := &memoryStore{saved: map[string]map[string]string{}}
+	handler := TargetsHandler(exporter, "s3cret", store)
+
+	// Nothing listens on port 1, so the added target is unavailable.
+	orders := `{"MYSQL_NAME": "orders", "MYSQL_USER": "app", "MYSQL_PASS": "pass", "MYSQL_HOST": "127.0.0.1", "MYSQL_PORT": "1"}`
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "no token", method: http.MethodGet, path: "/targets", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/targets", token: "guess", wantCode: http.StatusUnauthorized},
+		{name: "list", method: http.MethodGet, path: "/targets", token: "s3cret", wantCode: http.StatusOK, wantBody: `"name":"mock/static"`},
+		{name: "add", method: http.MethodPost, path: "/targets", token: "s3cret", body: orders, wantCode: http.StatusCreated, wantBody: `"name":"127.0.0.1:1/orders","persisted":true,"status":{`},
+		{name: "add again", method: http.MethodPost, path: "/targets", token: "s3cret", body: orders, wantCode: http.StatusConflict},
+		{name: "add incomplete", method: http.MethodPost, path: "/targets", token: "s3cret", body: `{"MYSQL_NAME": "billing"}`, wantCode: http.StatusBadRequest, wantBody: "MYSQL_HOST is not set"},
+		{name: "add unknown variable", method: http.MethodPost, path: "/targets", token: "s3cret", body: `{"MYSQL_NAME": "billing", "MYSQL_HOST": "127.0.0.1", "MYSQL_USER": "app", "MYSQL_PASS": "pass", "MYSQL_NAME\nMYSQL_TLS": "true"}`, wantCode: http.StatusBadRequest, wantBody: `request: unknown variable "MYSQL_NAME\nMYSQL_TLS"`},
+		{name: "add invalid json", method: http.MethodPost, path: "/targets", token: "s3cret", body: `[]`, wantCode: http.StatusBadRequest},
+		{name: "list with added", method: http.MethodGet, path: "/targets", token: "s3cret", wantCode: http.StatusOK, wantBody: `"name":"127.0.0.1:1/orders"`},
+		{name: "delete", method: http.MethodDelete, path: "/targets/127.0.0.1:1/orders", token: "s3cret", wantCode: http.StatusOK, wantBody: `"persisted":true`},
+		{name: "delete again", method: http.MethodDelete, path: "/targets/127.0.0.1:1/orders", token: "s3cret", wantCode: http.StatusNotFound},
+		{name: "unsupported method", method: http.MethodPut, path: "/targets", token: "s3cret", wantCode: http.StatusMethodNotAllowed},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req := httptest.NewRequest(step.method, step.path, strings.NewReader(step.body))
+			if step.token != "" {
+				req.Header.Set("Authorization", "Bearer "+step.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != step.wantCode {
+				t.Fatalf("%s %s = %d %s, want %d", step.method, step.path, rec.Code, rec.Body, step.wantCode)
+			}
+			if !strings.Contains(rec.Body.String(), step.wantBody) {
+				t.Errorf("%s %s body = %s, want it to contain %s", step.method, step.path, rec.Body, step.wantBody)
+			}
+		})
+	}
+
+	if len(store.saved) != 0 {
+		t.Errorf("store has %d targets after add and delete, want 0", len(store.saved))
+	}
+	if got := testutil.CollectAndCount(exporter.availabilityMetric); got != 1 {
+		t.Errorf("mysql_connection_available has %d series after delete, want 1", got)
+	}
+	if statuses := exporter.Status(); len(statuses) != 1 || statuses[0].Database != "static" {
+		t.Errorf("Status() after delete = %+v, want only the static target", statuses)
+	}
+}
+
+func TestTargetsHandlerStoreFailure(t *testing.T) {
+	exporter := NewExporter(nil, time.Hour)
+	store := &memoryStore{err: errors.New("read-only file system")}
+	handler := TargetsHandler(exporter, "s3cret", store)
+
+	req := httptest.NewRequest(http.MethodPost, "/targets", strings.NewReader(`{"MYSQL_NAME": "orders", "MYSQL_USER": "app", "MYSQL_PASS": "pass", "MYSQL_HOST": "127.0.0.1", "MYSQL_PORT": "1"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// The target is checked until restart even if it could not be saved.
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"persisted":false,"error":"read-only file system"`) {
+		t.Errorf("POST /targets = %d %s, want 201 with persisted false", rec.Code, rec.Body)
+	}
+	if len(exporter.Targets()) != 1 {
+		t.Errorf("exporter has %d targets, want 1", len(exporter.Targets()))
+	}
+}
+
+func TestAddTargetWhileRunning(t *testing.T) {
+	exporter := NewExporter([]types.Target{types.MockConfig{Name: "static", Result: "success"}.Target()}, time.Hour)
+	exporter.Start()
+	defer exporter.Stop()
+
+	scheduled := types.MockConfig{Name: "scheduled", Result: "success"}.Target()
+	scheduled.Schedule = "*/5 * * * *"
+	for _, target := range []types.Target{types.MockConfig{Name: "added", Result: "success"}.Target(), scheduled} {
+		status, err := exporter.AddTarget(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !status.Available {
+			t.Errorf("first check of %s = %+v, want available", target.Database, status)
+		}
+	}
+
+	if got := exporter.groupTargets(""); len(got) != 2 {
+		t.Errorf("default schedule checks targets %v, want the static and the added one", got)
+	}
+	if got := exporter.groupTargets("*/5 * * * *"); len(got) != 1 || got[0] != 2 {
+		t.Errorf("*/5 schedule checks targets %v, want [2]", got)
+	}
+	if !exporter.scheduled["*/5 * * * *"] {
+		t.Error("schedule of the added target is not registered")
+	}
+
+	exporter.RemoveTarget("mock/added")
+	if got := exporter.groupTargets(""); len(got) != 1 || got[0] != 0 {
+		t.Errorf("default schedule checks targets %v after removal, want [0]", got)
+	}
+}
+
+func TestSetConflicts(t *testing.T) {
+	exporter := NewExporter([]types.Target{
+		types.MockConfig{Name: "orders", Result: "success"}.Target(),
+		types.MockConfig{Name: "billing", Result: "success"}.Target(),
+	}, time.Hour)
+	exporter.SetConflicts([]util.TargetConflict{
+		{Target: "mock/orders", Sources: []string{"env", "/targets"}, Fields: []string{"MOCK_RESULT"}},
+	})
+
+	if got := testutil.ToFloat64(exporter.conflictsMetric.WithLabelValues("mock/orders")); got != 2 {
+		t.Errorf("db_connect_checker_target_conflicts{target=mock/orders} = %v, want 2", got)
+	}
+	for _, target := range exporter.Targets() {
+		if wantConflict := target.Name == "mock/orders"; (target.Conflict != nil) != wantConflict {
+			t.Errorf("Targets() %s conflict = %+v, want conflict %v", target.Name, target.Conflict, wantConflict)
+		}
+	}
+
+	exporter.RemoveTarget("mock/orders")
+	if got := testutil.CollectAndCount(exporter.conflictsMetric); got != 0 {
+		t.Errorf("db_connect_checker_target_conflicts has %d series after removal, want 0", got)
+	}
+}
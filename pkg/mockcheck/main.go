@@ -0,0 +1,183 @@
+// Package mockcheck is a checker for fake "mock" targets. It never opens a
+// connection: a check succeeds, fails or takes time as the target's Options
+// say, so exporter wiring, notifications and alert rules can be tested in CI
+// without a database.
+package mockcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Error classes of failed mock checks, see util.WithClass.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+	ErrClockSkew       = util.ErrClockSkew
+)
+
+// flaps counts the checks of every flapping target, so that they alternate
+// between failure and success.
+var (
+	flapsMu sync.Mutex
+	flaps   = map[string]int{}
+)
+
+// Option customizes a single Check call like the options of the real
+// checkers.
+type Option func(*options)
+
+type options struct {
+	maxClockSkew time.Duration
+}
+
+// WithClockSkew reports the "clock_skew" option (server clock minus local
+// clock, 0 by default) as the measured skew of a successful check and fails
+// the check with ErrClockSkew if it is larger than max.
+func WithClockSkew(max time.Duration) Option {
+	return func(o *options) {
+		o.maxClockSkew = max
+	}
+}
+
+// Check waits for the "delay" option and then succeeds or fails according to
+// the "result" option: success (default), failure or flap. Failures wrap the
+// error class named by the "reason" option, connection refused by default.
+func Check(ctx context.Context, target types.Target, opts ...Option) types.Result {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	delay := time.Duration(0)
+	if value := target.Options["delay"]; value != "" {
+		var err error
+		delay, err = util.ParseDuration(value)
+		if err != nil {
+			return newResult(nil, retry.Permanent(fmt.Errorf("invalid mock delay %q: %w", value, err)))
+		}
+	}
+
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return newResult(nil, ctx.Err())
+	case <-time.After(delay):
+	}
+	phases := []types.Phase{{Name: "connect", Duration: time.Since(start)}}
+
+	fail := false
+	switch result := target.Options["result"]; result {
+	case "", "success":
+	case "failure":
+		fail = true
+	case "flap":
+		flapsMu.Lock()
+		flaps[target.String()]++
+		fail = flaps[target.String()]%2 == 1
+		flapsMu.Unlock()
+	default:
+		return newResult(nil, retry.Permanent(fmt.Errorf("invalid mock result %q, want success, failure or flap", result)))
+	}
+	if !fail {
+		return clockSkewResult(phases, target, o.maxClockSkew)
+	}
+
+	err, ok := reasonError(target.Options["reason"])
+	if !ok {
+		return newResult(nil, retry.Permanent(fmt.Errorf("invalid mock reason %q", target.Options["reason"])))
+	}
+	return newResult(phases, fmt.Errorf("mock %s: %w", target.Database, err))
+}
+
+// clockSkewResult is the result of a successful check with the clock skew
+// check enabled by a positive max.
+func clockSkewResult(phases []types.Phase, target types.Target, max time.Duration) types.Result {
+	if max <= 0 {
+		return newResult(phases, nil)
+	}
+	skew := time.Duration(0)
+	if value := target.Options["clock_skew"]; value != "" {
+		var err error
+		skew, err = time.ParseDuration(value)
+		if err != nil {
+			return newResult(nil, retry.Permanent(fmt.Errorf("invalid mock clock skew %q: %w", value, err)))
+		}
+	}
+	err := util.CheckClockSkew(skew, max)
+	if err != nil {
+		err = fmt.Errorf("mock %s: %w", target.Database, err)
+	}
+	result := newResult(phases, err)
+	result.ClockSkew, result.ClockSkewMeasured = skew, true
+	return result
+}
+
+// reasonError returns an error that ErrorReason reports as reason.
+func reasonError(reason string) (error, bool) {
+	switch reason {
+	case "", "connection refused":
+		return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true
+	case "timeout":
+		return ErrTimeout, true
+	case "auth error":
+		return ErrAuthFailed, true
+	case "unknown database":
+		return ErrUnknownDatabase, true
+	case "dns error":
+		return ErrDNS, true
+	case "tls error":
+		return ErrTLS, true
+	}
+	return nil, false
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	err = util.ClassifyNetError(err)
+	return types.Result{
+		Success:  err == nil,
+		Attempts: 1,
+		Phases:   phases,
+		Reason:   ErrorReason(err),
+		Err:      err,
+	}
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	for _, class := range []error{ErrAuthFailed, ErrUnknownDatabase, ErrDNS, ErrTimeout, ErrTLS, ErrClockSkew} {
+		if errors.Is(err, class) {
+			return class.Error()
+		}
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Like with real
+// databases, auth errors, unknown databases, clock skew and invalid options
+// are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	return !errors.Is(err, ErrAuthFailed) && !errors.Is(err, ErrUnknownDatabase) && !errors.Is(err, ErrClockSkew)
+}
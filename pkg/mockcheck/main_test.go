@@ -0,0 +1,106 @@
+package mockcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		options       map[string]string
+		wantSuccess   bool
+		wantReason    string
+		wantErr       error
+		wantRetryable bool
+	}{
+		{name: "success by default", wantSuccess: true},
+		{name: "explicit success", options: map[string]string{"result": "success"}, wantSuccess: true},
+		{name: "failure is connection refused by default", options: map[string]string{"result": "failure"}, wantReason: "connection refused", wantRetryable: true},
+		{name: "failure with timeout", options: map[string]string{"result": "failure", "reason": "timeout"}, wantReason: "timeout", wantErr: ErrTimeout, wantRetryable: true},
+		{name: "failure with auth error", options: map[string]string{"result": "failure", "reason": "auth error"}, wantReason: "auth error", wantErr: ErrAuthFailed},
+		{name: "failure with unknown database", options: map[string]string{"result": "failure", "reason": "unknown database"}, wantReason: "unknown database", wantErr: ErrUnknownDatabase},
+		{name: "invalid result", options: map[string]string{"result": "maybe"}, wantReason: "invalid config"},
+		{name: "invalid reason", options: map[string]string{"result": "failure", "reason": "bad luck"}, wantReason: "invalid config"},
+		{name: "invalid delay", options: map[string]string{"delay": "soon"}, wantReason: "invalid config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Check(context.Background(), types.Target{Type: "mock", Host: "mock", Database: tt.name, Options: tt.options})
+			if result.Success != tt.wantSuccess || result.Reason != tt.wantReason {
+				t.Fatalf("Check() = success %v, reason %q, want %v, %q", result.Success, result.Reason, tt.wantSuccess, tt.wantReason)
+			}
+			if tt.wantErr != nil && !errors.Is(result.Err, tt.wantErr) {
+				t.Errorf("Check() error = %v, want %v", result.Err, tt.wantErr)
+			}
+			if tt.wantReason == "invalid config" && !retry.IsPermanent(result.Err) {
+				t.Errorf("Check() error = %v, want permanent error", result.Err)
+			}
+			if Retryable(result.Err) != tt.wantRetryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !tt.wantRetryable, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestCheckFlap(t *testing.T) {
+	target := types.Target{Type: "mock", Host: "mock", Database: "flap", Options: map[string]string{"result": "flap"}}
+	want := []bool{false, true, false, true}
+	for i, wantSuccess := range want {
+		if got := Check(context.Background(), target).Success; got != wantSuccess {
+			t.Errorf("check %d: success = %v, want %v", i+1, got, wantSuccess)
+		}
+	}
+}
+
+func TestCheckDelay(t *testing.T) {
+	target := types.Target{Type: "mock", Host: "mock", Database: "slow", Options: map[string]string{"delay": "50ms"}}
+
+	result := Check(context.Background(), target)
+	if !result.Success || result.Duration() < 50*time.Millisecond {
+		t.Errorf("Check() = success %v in %v, want success after 50ms", result.Success, result.Duration())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result = Check(ctx, target)
+	if result.Success || !errors.Is(result.Err, ErrTimeout) || result.Reason != "timeout" {
+		t.Errorf("Check() with expired context = %+v, want timeout", result)
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     map[string]string
+		max         time.Duration
+		wantSuccess bool
+		wantSkew    time.Duration
+		wantReason  string
+	}{
+		{name: "not checked", options: map[string]string{"clock_skew": "1h"}, wantSuccess: true},
+		{name: "in sync by default", max: time.Second, wantSuccess: true},
+		{name: "within limit", options: map[string]string{"clock_skew": "-500ms"}, max: time.Second, wantSuccess: true, wantSkew: -500 * time.Millisecond},
+		{name: "over limit", options: map[string]string{"clock_skew": "3s"}, max: time.Second, wantSkew: 3 * time.Second, wantReason: "clock skew"},
+		{name: "invalid skew", options: map[string]string{"clock_skew": "soon"}, max: time.Second, wantReason: "invalid config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := types.Target{Type: "mock", Host: "mock", Database: tt.name, Options: tt.options}
+			result := Check(context.Background(), target, WithClockSkew(tt.max))
+			if result.Success != tt.wantSuccess || result.Reason != tt.wantReason || result.ClockSkew != tt.wantSkew {
+				t.Errorf("Check() = success %v, reason %q, skew %v, want %v, %q, %v", result.Success, result.Reason, result.ClockSkew, tt.wantSuccess, tt.wantReason, tt.wantSkew)
+			}
+			if result.Err != nil && Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true, want false", result.Err)
+			}
+		})
+	}
+}
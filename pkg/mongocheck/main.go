@@ -0,0 +1,251 @@
+package mongocheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+const mongoAuthFailedCode = 18
+
+// Error classes wrapped by check errors, see util.WithClass. MongoDB creates
+// databases on first use, so there is no unknown database class.
+var (
+	ErrAuthFailed = util.ErrAuthFailed
+	ErrDNS        = util.ErrDNS
+	ErrTimeout    = util.ErrTimeout
+	ErrTLS        = util.ErrTLS
+	ErrClockSkew  = util.ErrClockSkew
+)
+
+// ParseURI validates a MongoDB URI and returns its host and database name.
+func ParseURI(uri string) (host string, dbName string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get db from uri: %w", err)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// ValidateURI checks a MongoDB URI the same way the driver will parse it
+// and requires a database name in the path, without connecting.
+func ValidateURI(uri string) error {
+	if _, err := connstring.ParseAndValidate(uri); err != nil {
+		return err
+	}
+	_, dbName, err := ParseURI(uri)
+	if err != nil {
+		return err
+	}
+	if dbName == "" {
+		return fmt.Errorf("database name is missing in uri path")
+	}
+	return nil
+}
+
+// TargetFromURI converts a MongoDB URI to the generic target form. The URI
+// is kept as is, so options without a Target field are not lost.
+func TargetFromURI(uri string) (types.Target, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return types.Target{}, fmt.Errorf("cannot get db from uri: %w", err)
+	}
+	target := types.Target{
+		Type:     "mongodb",
+		Host:     u.Host,
+		Database: strings.TrimPrefix(u.Path, "/"),
+		URI:      uri,
+	}
+	if u.User != nil {
+		target.User = u.User.Username()
+		target.Pass, _ = u.User.Password()
+	}
+	return target, nil
+}
+
+// targetURI returns target.URI or builds a mongodb:// URI from its fields.
+func targetURI(target types.Target) string {
+	if target.URI != "" {
+		return target.URI
+	}
+	u := url.URL{
+		Scheme: "mongodb",
+		Host:   target.Address(),
+		Path:   "/" + target.Database,
+	}
+	if target.User != "" {
+		u.User = url.UserPassword(target.User, target.Pass)
+	}
+	query := url.Values{}
+	for key, value := range target.Options {
+		query.Set(key, value)
+	}
+	if target.TLS {
+		query.Set("tls", "true")
+		if target.TLSCAFile != "" {
+			query.Set("tlsCAFile", target.TLSCAFile)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func CheckConnection(ctx context.Context, uri string, opts ...Option) types.Result {
+	return Check(ctx, types.Target{Type: "mongodb", URI: uri}, opts...)
+}
+
+// Check connects to a MongoDB target, reads the server version and lists
+// the collections of its database.
+func Check(ctx context.Context, target types.Target, opts ...Option) types.Result {
+	o := newCheckOptions(opts)
+	uri := targetURI(target)
+	_, dbName, err := ParseURI(uri)
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+
+	clientOptions := options.Client().ApplyURI(uri)
+	if o.dialer != nil {
+		clientOptions.SetDialer(o.dialer)
+	}
+	client, err := mongo.NewClient(clientOptions)
+	if err != nil {
+		// NewClient does not connect, it only fails on invalid options.
+		return newResult(nil, "", retry.Permanent(fmt.Errorf("error mongodb client: %w", err)))
+	}
+
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+	ctx, cancel := within(ctx, o.timeout)
+	defer cancel()
+
+	phases := []types.Phase{}
+	start := time.Now()
+	connectCtx, cancelConnect := within(ctx, o.connectTimeout)
+	err = client.Connect(connectCtx)
+	if err == nil {
+		defer client.Disconnect(context.Background())
+		err = client.Ping(connectCtx, nil)
+	}
+	cancelConnect()
+	phases = append(phases, types.Phase{Name: "connect", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error connect: %w", err))
+	}
+
+	ctx, cancelQueries := within(ctx, o.queryTimeout)
+	defer cancelQueries()
+	start = time.Now()
+	// The version is informational, a user without access to buildInfo
+	// still passes the check.
+	var buildInfo struct {
+		Version string `bson:"version"`
+	}
+	client.Database(dbName).RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo)
+	_, err = client.Database(dbName).ListCollectionNames(ctx, bson.D{})
+	phases = append(phases, types.Phase{Name: "query", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, buildInfo.Version, fmt.Errorf("error list collections: %w", err))
+	}
+	if o.maxClockSkew <= 0 {
+		return newResult(phases, buildInfo.Version, nil)
+	}
+
+	skew, err := clockSkew(ctx, client)
+	measured := err == nil
+	if measured {
+		err = util.CheckClockSkew(skew, o.maxClockSkew)
+	}
+	result := newResult(phases, buildInfo.Version, err)
+	result.ClockSkew, result.ClockSkewMeasured = skew, measured
+	return result
+}
+
+// within returns ctx limited to timeout, or ctx itself if timeout is not
+// positive.
+func within(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// clockSkew returns the server clock minus the local one, comparing the
+// server time with the middle of the round trip of the command. localTime
+// has millisecond precision.
+func clockSkew(ctx context.Context, client *mongo.Client) (time.Duration, error) {
+	start := time.Now()
+	var hello struct {
+		LocalTime time.Time `bson:"localTime"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return 0, fmt.Errorf("error reading server time: %w", err)
+	}
+	if hello.LocalTime.IsZero() {
+		return 0, fmt.Errorf("error reading server time: hello has no localTime")
+	}
+	return hello.LocalTime.Sub(start.Add(time.Since(start) / 2)), nil
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	err = classify(err)
+	return types.Result{
+		Success:       err == nil,
+		Attempts:      1,
+		Phases:        phases,
+		ServerVersion: version,
+		Reason:        ErrorReason(err),
+		Err:           err,
+	}
+}
+
+// classify wraps err with its error class, if known.
+func classify(err error) error {
+	if ErrorReason(err) == "auth error" {
+		return util.WithClass(ErrAuthFailed, err)
+	}
+	return util.ClassifyNetError(err)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(mongoAuthFailedCode) {
+		return "auth error"
+	}
+	if err != nil && strings.Contains(err.Error(), "AuthenticationFailed") {
+		return "auth error"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures, clock skew and invalid URIs are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "clock skew":
+		return false
+	}
+	return true
+}
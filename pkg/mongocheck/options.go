@@ -0,0 +1,93 @@
+package mongocheck
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Dialer opens the network connections of a check. *net.Dialer implements
+// it; tests pass one that fails or answers without a real server.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Option customizes a single Check call.
+type Option func(*checkOptions)
+
+// defaultTimeout bounds a whole check: connecting and running the queries.
+// With WithConnectTimeout or WithQueryTimeout it bounds only the other
+// phase instead.
+const defaultTimeout = 10 * time.Second
+
+type checkOptions struct {
+	timeout time.Duration
+	dialer  Dialer
+	// connectTimeout and queryTimeout limit the phases of a check when
+	// positive.
+	connectTimeout, queryTimeout time.Duration
+	// maxClockSkew enables the clock skew check when positive.
+	maxClockSkew time.Duration
+}
+
+func newCheckOptions(opts []Option) checkOptions {
+	o := checkOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch {
+	case o.timeout > 0:
+	case o.connectTimeout <= 0 && o.queryTimeout <= 0:
+		o.timeout = defaultTimeout
+	case o.connectTimeout <= 0:
+		o.connectTimeout = defaultTimeout
+	case o.queryTimeout <= 0:
+		o.queryTimeout = defaultTimeout
+	}
+	return o
+}
+
+// WithTimeout limits the whole check. Without it a check takes at most 10
+// seconds or, with WithConnectTimeout or WithQueryTimeout, each phase takes
+// at most its own timeout, 10 seconds if it has none.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *checkOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithConnectTimeout limits connecting, the connect phase of the check:
+// server selection, the TLS handshake, authentication and the first ping.
+// WithTimeout still limits the whole check.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *checkOptions) {
+		o.connectTimeout = timeout
+	}
+}
+
+// WithQueryTimeout limits the commands run after connecting, together:
+// buildInfo, listing the collections and the optional WithClockSkew.
+// WithTimeout still limits the whole check.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(o *checkOptions) {
+		o.queryTimeout = timeout
+	}
+}
+
+// WithDialer opens connections with dialer instead of the driver's TCP
+// dialer.
+func WithDialer(dialer Dialer) Option {
+	return func(o *checkOptions) {
+		o.dialer = dialer
+	}
+}
+
+// WithClockSkew compares the server clock (localTime of the hello command)
+// with the local one after the check and reports the difference in
+// Result.ClockSkew. The check fails with ErrClockSkew if the clocks differ
+// by more than max.
+func WithClockSkew(max time.Duration) Option {
+	return func(o *checkOptions) {
+		o.maxClockSkew = max
+	}
+}
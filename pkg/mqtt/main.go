@@ -0,0 +1,411 @@
+// Package mqtt publishes check results to an MQTT broker, so fleets of edge
+// devices can report connectivity to a central broker without Prometheus.
+// Only the part of MQTT 3.1.1 needed to publish is implemented: CONNECT,
+// PUBLISH with QoS 0, 1 or 2 and DISCONNECT.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// Control packet types, shifted into the high nibble of the first byte.
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetPuback     = 4 << 4
+	packetPubrec     = 5 << 4
+	packetPubrel     = 6<<4 | 2
+	packetPubcomp    = 7 << 4
+	packetDisconnect = 14 << 4
+)
+
+// timeout limits connecting and every exchange with the broker.
+const timeout = 10 * time.Second
+
+// connackErrors are the CONNACK return codes of refused connections.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// TopicFields are the values available to topic templates.
+type TopicFields struct {
+	// Type, Host, Port and Database describe the checked database.
+	Type, Host, Port, Database string
+	// Hostname is the host name of the checker, e.g. of the edge device.
+	Hostname string
+	// Labels are the ownership labels of the checker (OWNER_LABELS).
+	Labels map[string]string
+}
+
+// ParseTopic parses a text/template for the topic of every message and
+// renders it once with example fields.
+func ParseTopic(text string) (*template.Template, error) {
+	tmpl, err := template.New("topic").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic template: %v", err)
+	}
+	example := TopicFields{Type: "mysql", Host: "db", Port: "3306", Database: "app", Hostname: "edge-1"}
+	if _, err := topic(tmpl, example); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// topic renders tmpl with fields. Characters with a meaning in topics are
+// replaced in the values, so a host name cannot add levels or wildcards.
+func topic(tmpl *template.Template, fields TopicFields) (string, error) {
+	clean := strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace
+	fields.Type, fields.Host, fields.Port, fields.Database, fields.Hostname =
+		clean(fields.Type), clean(fields.Host), clean(fields.Port), clean(fields.Database), clean(fields.Hostname)
+	labels := make(map[string]string, len(fields.Labels))
+	for name, value := range fields.Labels {
+		labels[name] = clean(value)
+	}
+	fields.Labels = labels
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("invalid topic template: %v", err)
+	}
+	if b.Len() == 0 {
+		return "", errors.New("invalid topic template: topic is empty")
+	}
+	if strings.ContainsAny(b.String(), "+#") {
+		return "", fmt.Errorf("invalid topic template: topic %q contains a wildcard", b.String())
+	}
+	return b.String(), nil
+}
+
+// Client publishes messages to one broker. It is safe for concurrent use.
+type Client struct {
+	address   string
+	tlsConfig *tls.Config
+	clientID  string
+	username  string
+	password  string
+	hasPass   bool
+
+	topic    *template.Template
+	hostname string
+
+	// QoS is the quality of service of published messages: 0 sends them
+	// without confirmation, 1 and 2 wait for the broker to acknowledge
+	// them.
+	QoS byte
+	// Retain makes the broker keep the last message of every topic for
+	// subscribers that connect later.
+	Retain bool
+	// Labels are passed to the topic template.
+	Labels map[string]string
+
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+}
+
+// Dial connects to broker, given as tcp://host:port or ssl://host:port
+// (also mqtt:// and mqtts://), with user:password@ for authentication.
+// Messages are published to the topic rendered from topicTemplate for every
+// target. An empty clientID is derived from the host name.
+func Dial(broker, topicTemplate, clientID string) (*Client, error) {
+	tmpl, err := ParseTopic(topicTemplate)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT broker %q: %v", broker, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid MQTT broker %q: host is empty", broker)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+
+	c := &Client{topic: tmpl, hostname: hostname, clientID: clientID}
+	if c.clientID == "" {
+		c.clientID = "db-connect-checker-" + hostname
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if port == "" {
+			port = "1883"
+		}
+	case "ssl", "tls", "mqtts":
+		if port == "" {
+			port = "8883"
+		}
+		c.tlsConfig = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("invalid MQTT broker %q: scheme must be tcp or ssl", broker)
+	}
+	c.address = net.JoinHostPort(u.Hostname(), port)
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, c.hasPass = u.User.Password()
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect opens the connection and sends CONNECT; c.mu must be held or c
+// not yet shared.
+func (c *Client) connect() error {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to MQTT broker: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Clean session, no keep alive: the broker does not disconnect idle
+	// clients, a broken connection is noticed by the next publish.
+	flags := byte(0x02)
+	payload := appendString(nil, c.clientID)
+	if c.username != "" {
+		flags |= 0x80
+		payload = appendString(payload, c.username)
+		if c.hasPass {
+			flags |= 0x40
+			payload = appendString(payload, c.password)
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 0)
+	body = append(body, payload...)
+
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(packet(packetConnect, body)); err != nil {
+		conn.Close()
+		return fmt.Errorf("connecting to MQTT broker: %v", err)
+	}
+	kind, ack, err := readPacket(reader)
+	switch {
+	case err != nil:
+	case kind != packetConnack:
+		err = fmt.Errorf("unexpected packet type %d", kind>>4)
+	case len(ack) != 2:
+		err = fmt.Errorf("malformed CONNACK of %d bytes", len(ack))
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("connecting to MQTT broker: %v", err)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		reason, ok := connackErrors[ack[1]]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", ack[1])
+		}
+		return fmt.Errorf("connecting to MQTT broker: connection refused: %s", reason)
+	}
+
+	conn.SetDeadline(time.Time{})
+	c.conn, c.reader = conn, reader
+	return nil
+}
+
+// Observe publishes one check result as the JSON of its audit log entry. It
+// makes Client a checker.Sink.
+func (c *Client) Observe(ctx context.Context, target types.Target, result types.Result) {
+	if err := c.publishResult(target, result); err != nil {
+		log.Error("Error publishing to MQTT", log.Target(target), "error", err)
+	}
+}
+
+func (c *Client) publishResult(target types.Target, result types.Result) error {
+	name, err := topic(c.topic, TopicFields{
+		Type:     target.Type,
+		Host:     target.Host,
+		Port:     target.Port,
+		Database: target.Database,
+		Hostname: c.hostname,
+		Labels:   c.Labels,
+	})
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(audit.NewEntry(time.Now(), target, result))
+	if err != nil {
+		return err
+	}
+	return c.Publish(name, payload)
+}
+
+// Publish sends payload to topic, reconnecting once if the connection fails
+// (e.g. after the broker restarted).
+func (c *Client) Publish(topic string, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		if err := c.publish(topic, payload); err == nil {
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if err := c.publish(topic, payload); err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return fmt.Errorf("publishing to MQTT broker: %v", err)
+	}
+	return nil
+}
+
+// publish sends one PUBLISH packet and waits for its acknowledgement; c.mu
+// must be held.
+func (c *Client) publish(topic string, payload []byte) error {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	header := byte(packetPublish) | c.QoS<<1
+	if c.Retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	var id uint16
+	if c.QoS > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		id = c.packetID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if _, err := c.conn.Write(packet(header, body)); err != nil {
+		return err
+	}
+
+	switch c.QoS {
+	case 1:
+		return c.await(packetPuback, id)
+	case 2:
+		if err := c.await(packetPubrec, id); err != nil {
+			return err
+		}
+		if _, err := c.conn.Write(packet(packetPubrel, binary.BigEndian.AppendUint16(nil, id))); err != nil {
+			return err
+		}
+		return c.await(packetPubcomp, id)
+	}
+	return nil
+}
+
+// await reads packets until the acknowledgement kind of packet id; c.mu must
+// be held.
+func (c *Client) await(kind byte, id uint16) error {
+	for {
+		got, body, err := readPacket(c.reader)
+		if err != nil {
+			return err
+		}
+		if got == kind && len(body) >= 2 && binary.BigEndian.Uint16(body) == id {
+			return nil
+		}
+	}
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	c.conn.Write(packet(packetDisconnect, nil))
+	return c.conn.Close()
+}
+
+// packet prepends the fixed header to body.
+func packet(header byte, body []byte) []byte {
+	b := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+// readPacket reads one packet and returns its type and body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+// appendString appends s with its two byte length.
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
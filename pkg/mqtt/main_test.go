@@ -0,0 +1,297 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestTopic(t *testing.T) {
+	fields := TopicFields{Type: "mysql", Host: "db", Port: "3306", Database: "app", Hostname: "edge-1", Labels: map[string]string{"site": "berlin/2"}}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "default",
+			template: "db-connect-checker/{{.Hostname}}/{{.Type}}/{{.Host}}/{{.Database}}",
+			want:     "db-connect-checker/edge-1/mysql/db/app",
+		},
+		{
+			name:     "labels with slashes",
+			template: "sites/{{.Labels.site}}/{{.Labels.missing}}/{{.Host}}:{{.Port}}",
+			want:     "sites/berlin_2//db:3306",
+		},
+		{
+			name:     "wildcard",
+			template: "checks/#",
+			wantErr:  "contains a wildcard",
+		},
+		{
+			name:     "empty",
+			template: "{{.Labels.missing}}",
+			wantErr:  "topic is empty",
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Address}}",
+			wantErr:  "can't evaluate field Address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTopic(tt.template)
+			var got string
+			if err == nil {
+				got, err = topic(tmpl, fields)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("topic() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("topic() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// published is a PUBLISH packet received by the broker.
+type published struct {
+	header  byte
+	topic   string
+	payload []byte
+}
+
+// broker accepts connections and answers like an MQTT broker, acknowledging
+// with connack; every PUBLISH is sent to the returned channel and every
+// CONNECT body to connects.
+func broker(t *testing.T, connack byte) (addr string, messages chan published, connects chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages, connects = make(chan published, 10), make(chan []byte, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					header, err := r.ReadByte()
+					if err != nil {
+						return
+					}
+					r.UnreadByte()
+					kind, body, err := readPacket(r)
+					if err != nil {
+						return
+					}
+					switch kind {
+					case packetConnect:
+						connects <- body
+						conn.Write(packet(packetConnack, []byte{0, connack}))
+					case packetPublish:
+						qos := header >> 1 & 0x03
+						n := int(binary.BigEndian.Uint16(body))
+						msg := published{header: header, topic: string(body[2 : 2+n])}
+						rest := body[2+n:]
+						if qos > 0 {
+							id := rest[:2]
+							rest = rest[2:]
+							if qos == 1 {
+								conn.Write(packet(packetPuback, id))
+							} else {
+								conn.Write(packet(packetPubrec, id))
+							}
+						}
+						msg.payload = rest
+						messages <- msg
+					case packetPubrel & 0xf0:
+						conn.Write(packet(packetPubcomp, body))
+					case packetDisconnect:
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), messages, connects
+}
+
+func TestPublish(t *testing.T) {
+	for _, qos := range []byte{0, 1, 2} {
+		addr, messages, connects := broker(t, 0)
+		c, err := Dial("tcp://edge:secret@"+addr, "checks/{{.Type}}/{{.Host}}", "edge-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.QoS, c.Retain = qos, true
+
+		connect := <-connects
+		for _, want := range []string{"MQTT", "edge-1", "edge", "secret"} {
+			if !strings.Contains(string(connect), want) {
+				t.Errorf("CONNECT %q does not contain %q", connect, want)
+			}
+		}
+
+		target := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app"}
+		if err := c.publishResult(target, types.Result{Reason: "timeout"}); err != nil {
+			t.Errorf("QoS %d: %v", qos, err)
+		}
+		c.Close()
+
+		select {
+		case msg := <-messages:
+			if msg.topic != "checks/mysql/db" {
+				t.Errorf("QoS %d: topic = %q", qos, msg.topic)
+			}
+			if msg.header != packetPublish|qos<<1|0x01 {
+				t.Errorf("QoS %d: header = %#x", qos, msg.header)
+			}
+			var entry audit.Entry
+			if err := json.Unmarshal(msg.payload, &entry); err != nil || entry.Outcome != "failure" || entry.ErrorClass != "timeout" {
+				t.Errorf("QoS %d: payload = %s (%v)", qos, msg.payload, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("QoS %d: no message published", qos)
+		}
+	}
+}
+
+// scriptedBroker accepts one connection, reads its CONNECT and answers with
+// reply, raw bytes that may be malformed, before closing its side.
+func scriptedBroker(t *testing.T, reply []byte) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, _, err := readPacket(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		conn.Write(reply)
+		conn.(*net.TCPConn).CloseWrite()
+		io.Copy(io.Discard, conn)
+	}()
+	return listener.Addr().String()
+}
+
+func TestDialProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   []byte
+		wantErr string
+	}{
+		{
+			name:    "closed before CONNACK",
+			wantErr: "EOF",
+		},
+		{
+			name:    "not an MQTT broker",
+			reply:   []byte("HTTP/1.1 400 Bad Request\r\n\r\n"),
+			wantErr: "EOF",
+		},
+		{
+			name:    "PUBLISH instead of CONNACK",
+			reply:   packet(packetPublish, appendString(nil, "checks")),
+			wantErr: "unexpected packet type 3",
+		},
+		{
+			name:    "short CONNACK",
+			reply:   packet(packetConnack, []byte{0}),
+			wantErr: "malformed CONNACK of 1 bytes",
+		},
+		{
+			name:    "malformed remaining length",
+			reply:   []byte{packetConnack, 0xff, 0xff, 0xff, 0xff, 0x01},
+			wantErr: "malformed remaining length",
+		},
+		{
+			name:    "bad user name or password",
+			reply:   packet(packetConnack, []byte{0, 4}),
+			wantErr: "connection refused: bad user name or password",
+		},
+		{
+			name:    "not authorized",
+			reply:   packet(packetConnack, []byte{0, 5}),
+			wantErr: "connection refused: not authorized",
+		},
+		{
+			name:    "unknown return code",
+			reply:   packet(packetConnack, []byte{0, 9}),
+			wantErr: "connection refused: return code 9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := scriptedBroker(t, tt.reply)
+			_, err := Dial("tcp://edge:secret@"+addr, "checks", "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Dial() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialInvalidBroker(t *testing.T) {
+	for _, broker := range []string{"ws://broker:80", "tcp://", "broker:1883"} {
+		if _, err := Dial(broker, "checks", ""); err == nil || !strings.Contains(err.Error(), "invalid MQTT broker") {
+			t.Errorf("Dial(%q) error = %v, want invalid broker", broker, err)
+		}
+	}
+}
+
+func TestPublishReconnects(t *testing.T) {
+	addr, messages, connects := broker(t, 0)
+	c, err := Dial("tcp://"+addr, "checks", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.QoS = 1
+	<-connects
+
+	// The broker restarted: the old connection is gone.
+	c.conn.Close()
+	if err := c.Publish("checks", []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	<-connects
+	if msg := <-messages; string(msg.payload) != "ok" {
+		t.Errorf("payload = %q, want ok", msg.payload)
+	}
+}
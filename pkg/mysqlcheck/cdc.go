@@ -0,0 +1,164 @@
+package mysqlcheck
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// cdcPrivileges are the global privileges a Debezium connector needs to read
+// the binary log, each with its MariaDB 10.5+ name.
+var cdcPrivileges = [][]string{
+	{"REPLICATION SLAVE", "REPLICATION REPLICA"},
+	{"REPLICATION CLIENT", "BINLOG MONITOR"},
+}
+
+// cdcPhases checks the whole change data capture chain of target: the server
+// must write a row based binary log that the user may read, and the Kafka
+// Connect connector at target.CDCConnector must be running with all of its
+// tasks.
+func cdcPhases(ctx context.Context, db *sql.DB, target types.Target, dialer Dialer) ([]types.Phase, error) {
+	start := time.Now()
+	err := checkCDCSource(ctx, db)
+	phases := []types.Phase{{Name: "cdc source", Duration: time.Since(start)}}
+	if err != nil {
+		return phases, err
+	}
+
+	start = time.Now()
+	err = checkConnector(ctx, target.CDCConnector, dialer)
+	phases = append(phases, types.Phase{Name: "connector", Duration: time.Since(start)})
+	return phases, err
+}
+
+// checkCDCSource returns an error of class ErrVariableMismatch if the binary
+// log is off or not row based, and of class ErrMissingPrivilege if the user
+// lacks a replication privilege. Privileges of roles that are not expanded
+// by SHOW GRANTS are not seen.
+func checkCDCSource(ctx context.Context, db *sql.DB) error {
+	var logBin int
+	var format string
+	if err := db.QueryRowContext(ctx, "SELECT @@log_bin, @@binlog_format").Scan(&logBin, &format); err != nil {
+		return fmt.Errorf("error reading binary log settings: %w", err)
+	}
+	if logBin != 1 || !strings.EqualFold(format, "ROW") {
+		return util.WithClass(ErrVariableMismatch, fmt.Errorf("binary log is not usable for change data capture: log_bin=%d, binlog_format=%s, want log_bin=1, binlog_format=ROW", logBin, format))
+	}
+
+	rows, err := queryRows(ctx, db, "SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return fmt.Errorf("error reading grants: %w", err)
+	}
+	granted := map[string]bool{}
+	for _, row := range rows {
+		for _, grant := range row {
+			privileges, found := strings.CutPrefix(grant, "GRANT ")
+			privileges, global, _ := strings.Cut(privileges, " ON ")
+			if !found || !strings.HasPrefix(global, "*.* TO ") {
+				continue
+			}
+			for _, privilege := range strings.Split(privileges, ",") {
+				granted[strings.ToUpper(strings.TrimSpace(privilege))] = true
+			}
+		}
+	}
+	if granted["ALL PRIVILEGES"] || granted["ALL"] {
+		return nil
+	}
+	missing := []string{}
+	for _, names := range cdcPrivileges {
+		if !granted[names[0]] && !granted[names[1]] {
+			missing = append(missing, names[0])
+		}
+	}
+	if len(missing) > 0 {
+		return util.WithClass(ErrMissingPrivilege, fmt.Errorf("user has no global %s privilege needed to read the binary log", strings.Join(missing, " and ")))
+	}
+	return nil
+}
+
+// connectorStatus is the answer of GET /connectors/{name}/status.
+type connectorStatus struct {
+	Name      string `json:"name"`
+	Connector struct {
+		State string `json:"state"`
+		Trace string `json:"trace"`
+	} `json:"connector"`
+	Tasks []struct {
+		ID    int    `json:"id"`
+		State string `json:"state"`
+		Trace string `json:"trace"`
+	} `json:"tasks"`
+	Message string `json:"message"`
+}
+
+// checkConnector reads the status of the Kafka Connect connector at
+// endpoint, e.g. http://connect:8083/connectors/inventory, and returns an
+// error of class ErrConnectorNotRunning unless the connector and all of its
+// tasks are RUNNING.
+func checkConnector(ctx context.Context, endpoint string, dialer Dialer) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if dialer != nil {
+		transport.DialContext = dialer.DialContext
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/status", nil)
+	if err != nil {
+		return fmt.Errorf("error connector: %w", err)
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", "db-connect-checker/"+version.Version)
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error connector: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error connector: %w", err)
+	}
+	var status connectorStatus
+	if json.Unmarshal(content, &status) != nil {
+		return fmt.Errorf("error connector: unexpected answer with HTTP status %s", resp.Status)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return util.WithClass(ErrConnectorNotRunning, fmt.Errorf("connector not found: %s", status.Message))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error connector: HTTP status %s: %s", resp.Status, status.Message)
+	}
+
+	if status.Connector.State != "RUNNING" {
+		return util.WithClass(ErrConnectorNotRunning, fmt.Errorf("connector %s is %s%s", status.Name, status.Connector.State, firstLine(status.Connector.Trace)))
+	}
+	if len(status.Tasks) == 0 {
+		return util.WithClass(ErrConnectorNotRunning, fmt.Errorf("connector %s has no tasks", status.Name))
+	}
+	for _, task := range status.Tasks {
+		if task.State != "RUNNING" {
+			return util.WithClass(ErrConnectorNotRunning, fmt.Errorf("task %d of connector %s is %s%s", task.ID, status.Name, task.State, firstLine(task.Trace)))
+		}
+	}
+	return nil
+}
+
+// firstLine returns the first line of a Java stack trace, the exception and
+// its message, prefixed with ": ".
+func firstLine(trace string) string {
+	line, _, _ := strings.Cut(trace, "\n")
+	if line = strings.TrimSpace(line); line == "" {
+		return ""
+	}
+	return ": " + line
+}
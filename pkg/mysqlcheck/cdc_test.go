@@ -0,0 +1,139 @@
+package mysqlcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestCDCPhases(t *testing.T) {
+	const debeziumGrant = "GRANT SELECT, RELOAD, SHOW DATABASES, REPLICATION SLAVE, REPLICATION CLIENT ON *.* TO `debezium`@`%`"
+	tests := []struct {
+		name      string
+		logBin    int
+		format    string
+		grants    []string
+		status    int
+		answer    string
+		wantErr   string
+		wantRetry bool
+		// wantMessage is part of the error message.
+		wantMessage string
+		// wantPhases is the number of phases run.
+		wantPhases int
+	}{
+		{
+			name:       "running",
+			logBin:     1,
+			format:     "ROW",
+			grants:     []string{debeziumGrant},
+			status:     http.StatusOK,
+			answer:     `{"name":"inventory","connector":{"state":"RUNNING"},"tasks":[{"id":0,"state":"RUNNING"}]}`,
+			wantPhases: 2,
+		},
+		{
+			name:       "all privileges on MariaDB",
+			logBin:     1,
+			format:     "ROW",
+			grants:     []string{"GRANT USAGE ON *.* TO `debezium`@`%`", "GRANT ALL PRIVILEGES ON *.* TO `debezium`@`%` IDENTIFIED BY PASSWORD '*AB'"},
+			status:     http.StatusOK,
+			answer:     `{"name":"inventory","connector":{"state":"RUNNING"},"tasks":[{"id":0,"state":"RUNNING"}]}`,
+			wantPhases: 2,
+		},
+		{
+			name:       "binary log off",
+			logBin:     0,
+			format:     "ROW",
+			wantErr:    "variable mismatch",
+			wantPhases: 1,
+		},
+		{
+			name:       "statement based binary log",
+			logBin:     1,
+			format:     "STATEMENT",
+			wantErr:    "variable mismatch",
+			wantPhases: 1,
+		},
+		{
+			name:       "privileges only on a schema",
+			logBin:     1,
+			format:     "ROW",
+			grants:     []string{"GRANT USAGE ON *.* TO `debezium`@`%`", "GRANT ALL PRIVILEGES ON `inventory`.* TO `debezium`@`%`"},
+			wantErr:    "missing privilege",
+			wantPhases: 1,
+		},
+		{
+			name:        "failed task",
+			logBin:      1,
+			format:      "ROW",
+			grants:      []string{debeziumGrant},
+			status:      http.StatusOK,
+			answer:      `{"name":"inventory","connector":{"state":"RUNNING"},"tasks":[{"id":0,"state":"FAILED","trace":"org.apache.kafka.connect.errors.ConnectException: binlog truncated\n\tat io.debezium..."}]}`,
+			wantErr:     "connector not running",
+			wantRetry:   true,
+			wantMessage: "task 0 of connector inventory is FAILED: org.apache.kafka.connect.errors.ConnectException: binlog truncated",
+			wantPhases:  2,
+		},
+		{
+			name:       "missing connector",
+			logBin:     1,
+			format:     "ROW",
+			grants:     []string{debeziumGrant},
+			status:     http.StatusNotFound,
+			answer:     `{"error_code":404,"message":"No status found for connector inventory"}`,
+			wantErr:    "connector not running",
+			wantRetry:  true,
+			wantPhases: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			mock.ExpectQuery("SELECT @@log_bin, @@binlog_format").WillReturnRows(sqlmock.NewRows([]string{"@@log_bin", "@@binlog_format"}).AddRow(tt.logBin, tt.format))
+			if tt.grants != nil {
+				rows := sqlmock.NewRows([]string{"Grants for debezium@%"})
+				for _, grant := range tt.grants {
+					rows.AddRow(grant)
+				}
+				mock.ExpectQuery("SHOW GRANTS FOR CURRENT_USER").WillReturnRows(rows)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/connectors/inventory/status" {
+					t.Errorf("request to %s", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.answer))
+			}))
+			defer server.Close()
+
+			target := types.Target{Type: "mysql", CDCConnector: server.URL + "/connectors/inventory"}
+			phases, err := cdcPhases(context.Background(), db, target, nil)
+			if len(phases) != tt.wantPhases {
+				t.Errorf("phases = %v, want %d", phases, tt.wantPhases)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("cdcPhases() = %v", err)
+				}
+				return
+			}
+			if err == nil || ErrorReason(err) != tt.wantErr || Retryable(err) != tt.wantRetry {
+				t.Errorf("cdcPhases() = %v, want %q (retryable %v)", err, tt.wantErr, tt.wantRetry)
+			}
+			if !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("cdcPhases() = %v, want message %q", err, tt.wantMessage)
+			}
+		})
+	}
+}
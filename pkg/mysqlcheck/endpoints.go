@@ -0,0 +1,69 @@
+package mysqlcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// endpointTargets returns target once per address of its Endpoints, or just
+// target if it has none.
+func endpointTargets(target types.Target) []types.Target {
+	if len(target.Endpoints) == 0 {
+		return []types.Target{target}
+	}
+	targets := make([]types.Target, 0, len(target.Endpoints))
+	for _, address := range target.Endpoints {
+		endpoint := target
+		endpoint.Endpoints = nil
+		// The addresses come from types.ParseHosts.
+		endpoint.Host, endpoint.Port, _ = net.SplitHostPort(address)
+		targets = append(targets, endpoint)
+	}
+	return targets
+}
+
+// race checks every endpoint of target at the same time, like a client
+// with a failover list would connect to them, and returns the first one
+// that succeeds with its result. The checks of the other endpoints are
+// cancelled. If every endpoint fails, the result is that of the first
+// endpoint with the errors of all of them.
+func race(ctx context.Context, target types.Target, check func(ctx context.Context, endpoint types.Target) types.Result) (types.Target, types.Result) {
+	endpoints := endpointTargets(target)
+	if len(endpoints) == 1 {
+		return endpoints[0], check(ctx, endpoints[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type outcome struct {
+		index  int
+		result types.Result
+	}
+	outcomes := make(chan outcome, len(endpoints))
+	for i, endpoint := range endpoints {
+		go func() {
+			outcomes <- outcome{index: i, result: check(ctx, endpoint)}
+		}()
+	}
+
+	results := make([]types.Result, len(endpoints))
+	for range endpoints {
+		o := <-outcomes
+		if o.result.Err == nil {
+			return endpoints[o.index], o.result
+		}
+		results[o.index] = o.result
+	}
+
+	errs := make([]error, len(endpoints))
+	for i, result := range results {
+		errs[i] = fmt.Errorf("%s: %w", endpoints[i].Address(), result.Err)
+	}
+	result := results[0]
+	result.Err = fmt.Errorf("every endpoint failed: %w", errors.Join(errs...))
+	return target, result
+}
@@ -0,0 +1,116 @@
+package mysqlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestRace(t *testing.T) {
+	target := types.Target{Type: "mysql", Host: "db1", Port: "3306", Database: "orders", Endpoints: []string{"db1:3306", "db2:3306", "db3:3307"}}
+
+	t.Run("first success wins and cancels the others", func(t *testing.T) {
+		var mu sync.Mutex
+		cancelled := []string{}
+		endpoint, result := race(context.Background(), target, func(ctx context.Context, endpoint types.Target) types.Result {
+			switch endpoint.Host {
+			case "db1":
+				return types.Result{Attempts: 1, Reason: "connection refused", Err: errors.New("connection refused")}
+			case "db2":
+				<-ctx.Done()
+				mu.Lock()
+				cancelled = append(cancelled, endpoint.Host)
+				mu.Unlock()
+				return types.Result{Attempts: 1, Reason: "timeout", Err: ctx.Err()}
+			}
+			return types.Result{Success: true, Attempts: 1, ServerVersion: "8.0.36"}
+		})
+		if !result.Success || result.ServerVersion != "8.0.36" {
+			t.Fatalf("race() = %+v, want the result of db3", result)
+		}
+		if endpoint.Address() != "db3:3307" || endpoint.Endpoints != nil {
+			t.Errorf("race() endpoint = %s %v, want db3:3307 without endpoints", endpoint.Address(), endpoint.Endpoints)
+		}
+		// The slow endpoint is cancelled when race returns.
+		deadline := time.Now().Add(time.Second)
+		for {
+			mu.Lock()
+			done := len(cancelled) == 1
+			mu.Unlock()
+			if done {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("the check of db2 was not cancelled")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("every endpoint fails", func(t *testing.T) {
+		endpoint, result := race(context.Background(), target, func(ctx context.Context, endpoint types.Target) types.Result {
+			if endpoint.Host == "db1" {
+				return types.Result{Attempts: 1, Reason: "auth error", Err: errors.New("access denied")}
+			}
+			return types.Result{Attempts: 1, Reason: "connection refused", Err: errors.New("connection refused")}
+		})
+		if result.Success || result.Reason != "auth error" {
+			t.Errorf("race() = %+v, want the failure of the first endpoint", result)
+		}
+		for _, want := range []string{"db1:3306: access denied", "db2:3306: connection refused", "db3:3307: connection refused"} {
+			if !strings.Contains(result.Err.Error(), want) {
+				t.Errorf("race() error = %v, want it to contain %q", result.Err, want)
+			}
+		}
+		if endpoint.Address() != "db1:3306" {
+			t.Errorf("race() endpoint = %s, want the target", endpoint.Address())
+		}
+	})
+
+	t.Run("target without endpoints", func(t *testing.T) {
+		single := types.Target{Type: "mysql", Host: "db", Port: "3306"}
+		calls := 0
+		endpoint, _ := race(context.Background(), single, func(ctx context.Context, endpoint types.Target) types.Result {
+			calls++
+			return types.Result{Success: true, Attempts: 1}
+		})
+		if calls != 1 || endpoint.Address() != "db:3306" {
+			t.Errorf("race() checked %d times at %s, want once at db:3306", calls, endpoint.Address())
+		}
+	})
+}
+
+// addressDialer fails every dial and records the addresses.
+type addressDialer struct {
+	mu        sync.Mutex
+	addresses []string
+}
+
+func (d *addressDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.addresses = append(d.addresses, address)
+	d.mu.Unlock()
+	return nil, errors.New("no route to host")
+}
+
+func TestCheckEndpoints(t *testing.T) {
+	target := types.MysqlConfig{Name: "orders", User: "app", Pass: "secret", Host: "db1", Port: "3306", Hosts: "db1,db2:3307"}.Target()
+	dialer := &addressDialer{}
+	result := Check(context.Background(), target, WithDialer(dialer), WithTimeout(time.Second))
+	if result.Success || !strings.Contains(result.Err.Error(), "every endpoint failed") {
+		t.Fatalf("Check() = %v, want every endpoint to fail", result.Err)
+	}
+	dialed := map[string]bool{}
+	for _, address := range dialer.addresses {
+		dialed[address] = true
+	}
+	if !dialed["db1:3306"] || !dialed["db2:3307"] {
+		t.Errorf("dialed %v, want db1:3306 and db2:3307", dialer.addresses)
+	}
+}
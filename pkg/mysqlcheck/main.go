@@ -3,39 +3,133 @@ package mysqlcheck
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/message"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
 	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
 )
 
-func CheckConnections(config []types.MysqlConfig, tries int) error {
+var errStillReachable = errors.New("database is still reachable")
+
+// Error classes wrapped by check errors, see util.WithClass.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+	ErrClockSkew       = util.ErrClockSkew
+	// ErrVariableMismatch fails checks of targets with FailOnMismatch set.
+	ErrVariableMismatch = util.ErrVariableMismatch
+	// ErrLowFreeSpace fails checks with WithTablespace, see MinFreeSpace.
+	ErrLowFreeSpace = util.ErrLowFreeSpace
+	// ErrTooManyThreads fails checks with WithThreads, see
+	// MaxThreadsConnected.
+	ErrTooManyThreads = util.ErrTooManyThreads
+	// ErrFlowControl fails checks with WithFlowControl, see
+	// MaxFlowControlPaused.
+	ErrFlowControl = util.ErrFlowControl
+	// ErrShardNotServing fails checks of Vitess targets with a shard
+	// without a serving primary tablet.
+	ErrShardNotServing = util.ErrShardNotServing
+	// ErrMissingPrivilege and ErrConnectorNotRunning fail checks of targets
+	// with a CDC connector, see types.Target.CDCConnector.
+	ErrMissingPrivilege    = util.ErrMissingPrivilege
+	ErrConnectorNotRunning = util.ErrConnectorNotRunning
+)
+
+// Backoff controls sleeps between the attempts of CheckConnections,
+// CheckUnavailableConnections and CheckAnyConnection.
+var Backoff = retry.Linear
+
+// Clock provides the sleeps between those attempts; tests replace it with a
+// clock.Fake.
+var Clock clock.Clock = clock.Real
+
+// OnResult, if set, is called after every attempt of CheckConnections,
+// CheckUnavailableConnections and CheckAnyConnection, e.g. to write an audit
+// log.
+var OnResult func(ctx context.Context, target types.Target, result types.Result)
+
+// MaxClockSkew, if positive, enables the clock skew check (see
+// WithClockSkew) in CheckConnections and CheckAnyConnection.
+var MaxClockSkew time.Duration
+
+// DefaultDialer, if set, opens the connections of CheckConnections,
+// CheckUnavailableConnections and CheckAnyConnection (see WithDialer).
+var DefaultDialer Dialer
+
+// AttemptTimeout, if positive, limits every attempt of CheckConnections,
+// CheckUnavailableConnections and CheckAnyConnection (see WithTimeout).
+var AttemptTimeout time.Duration
+
+// ConnectTimeout and QueryTimeout, if positive, limit the phases of those
+// attempts (see WithConnectTimeout and WithQueryTimeout).
+var ConnectTimeout, QueryTimeout time.Duration
+
+// MinFreeSpace, if positive, enables the tablespace check (see
+// WithTablespace) in CheckConnections and CheckAnyConnection.
+var MinFreeSpace float64
+
+// MaxThreadsConnected and MaxThreadsRunning, if positive, enable the threads
+// check (see WithThreads) in CheckConnections and CheckAnyConnection.
+var MaxThreadsConnected, MaxThreadsRunning int
+
+// MaxFlowControlPaused, if positive, enables the flow control check (see
+// WithFlowControl) in CheckConnections and CheckAnyConnection.
+var MaxFlowControlPaused float64
+
+// AttemptLogger reports one attempt of a one-shot check, e.g. as a line
+// rendered from LOG_TEMPLATE (*message.Template).
+type AttemptLogger interface {
+	Log(fields message.Fields)
+}
+
+// AttemptLog, if set, reports every attempt of CheckConnections and
+// CheckAnyConnection instead of the built-in "Try (i/n)" lines.
+var AttemptLog AttemptLogger
+
+// CheckConnections retries every config until it is reachable, up to tries
+// attempts each, and stops when ctx is done.
+func CheckConnections(ctx context.Context, config []types.MysqlConfig, tries int) error {
 	var errChan = make(chan error, len(config))
 
 	for _, cfg := range config {
 		go func(cfg types.MysqlConfig) {
-			i := 1
-			for i = 1; i <= tries; i += 1 {
-				sleepS := 3*i + 1
-				sleep := time.Duration(sleepS) * time.Second
-				err := CheckConnection(cfg)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "[%s:%s/%s] Try (%d/%d) sleep %d seconds error: %v\n", cfg.Host, cfg.Port, cfg.Name, i, tries, sleepS, err)
-					time.Sleep(sleep)
-					continue
-				}
-				fmt.Println("Connect success")
-				break
-			}
+			errChan <- checkWithRetries(ctx, cfg, tries, true)
+		}(cfg)
+	}
 
-			if i == tries+1 {
-				errChan <- fmt.Errorf("[%s:%s/%s] connection attempts have failed", cfg.Host, cfg.Name, cfg.Port)
-			} else {
-				errChan <- nil
-			}
+	for range config {
+		if err := <-errChan; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckUnavailableConnections is the inverse of CheckConnections: it succeeds
+// only once every config has become unreachable, using the same retry budget.
+// It is meant for teardown jobs waiting for a database to be decommissioned.
+func CheckUnavailableConnections(ctx context.Context, config []types.MysqlConfig, tries int) error {
+	var errChan = make(chan error, len(config))
+
+	for _, cfg := range config {
+		go func(cfg types.MysqlConfig) {
+			errChan <- checkWithRetries(ctx, cfg, tries, false)
 		}(cfg)
 	}
 
@@ -47,39 +141,667 @@ func CheckConnections(config []types.MysqlConfig, tries int) error {
 	return nil
 }
 
-func CheckConnection(config types.MysqlConfig) error {
-	connectString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", config.User, config.Pass, config.Host, config.Port, config.Name)
-	if config.TLS {
-		tlsConfigName := fmt.Sprintf("custom-tls-%s-%s", config.Host, config.Name)
-		err := mysql.RegisterTLSConfig(tlsConfigName, config.TLSConfig)
+// CheckAnyConnection returns as soon as one of the configs is reachable. It
+// is meant for groups of equivalent targets such as replicas of one database.
+func CheckAnyConnection(ctx context.Context, config []types.MysqlConfig, tries int) error {
+	if len(config) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var errChan = make(chan error, len(config))
+	for _, cfg := range config {
+		go func(cfg types.MysqlConfig) {
+			errChan <- checkWithRetries(ctx, cfg, tries, true)
+		}(cfg)
+	}
+
+	permanent := 0
+	for range config {
+		err := <-errChan
+		if err == nil {
+			return nil
+		}
+		if retry.IsPermanent(err) {
+			permanent++
+		}
+	}
+	err := fmt.Errorf("connection attempts have failed for all %d MySQL targets", len(config))
+	if permanent == len(config) {
+		return retry.Permanent(err)
+	}
+	return err
+}
+
+// checkWithRetries retries until the database is reachable, or, when
+// wantAvailable is false, until it is no longer reachable. The Tries,
+// Timeout, ConnectTimeout and QueryTimeout of cfg replace tries and the
+// package timeouts.
+func checkWithRetries(ctx context.Context, cfg types.MysqlConfig, tries int, wantAvailable bool) error {
+	if cfg.Tries > 0 {
+		tries = cfg.Tries
+	}
+	timeout, connectTimeout, queryTimeout := AttemptTimeout, ConnectTimeout, QueryTimeout
+	if cfg.Timeout > 0 {
+		timeout = cfg.Timeout
+	}
+	if cfg.ConnectTimeout > 0 {
+		connectTimeout = cfg.ConnectTimeout
+	}
+	if cfg.QueryTimeout > 0 {
+		queryTimeout = cfg.QueryTimeout
+	}
+	for i := 1; i <= tries; i += 1 {
+		var opts []Option
+		if DefaultDialer != nil {
+			opts = append(opts, WithDialer(DefaultDialer))
+		}
+		if timeout > 0 {
+			opts = append(opts, WithTimeout(timeout))
+		}
+		if connectTimeout > 0 {
+			opts = append(opts, WithConnectTimeout(connectTimeout))
+		}
+		if queryTimeout > 0 {
+			opts = append(opts, WithQueryTimeout(queryTimeout))
+		}
+		if MaxClockSkew > 0 && wantAvailable {
+			opts = append(opts, WithClockSkew(MaxClockSkew))
+		}
+		if MinFreeSpace > 0 && wantAvailable {
+			opts = append(opts, WithTablespace(MinFreeSpace))
+		}
+		if (MaxThreadsConnected > 0 || MaxThreadsRunning > 0) && wantAvailable {
+			opts = append(opts, WithThreads(MaxThreadsConnected, MaxThreadsRunning))
+		}
+		if MaxFlowControlPaused > 0 && wantAvailable {
+			opts = append(opts, WithFlowControl(MaxFlowControlPaused))
+		}
+		target := cfg.Target()
+		if !wantAvailable {
+			target.ExpectVariables = nil
+		}
+		result := Check(ctx, target, opts...)
+		if OnResult != nil {
+			OnResult(ctx, target, result)
+		}
+		err := result.Err
+		if err == nil {
+			for _, warning := range result.Warnings {
+				log.Warn(warning, log.Target(target), "attempt", i, "tries", tries)
+			}
+		}
+		if !wantAvailable {
+			if err != nil {
+				log.Info("Database is unreachable", log.Target(target), "attempt", i, "tries", tries, "error", err)
+				return nil
+			}
+			err = errStillReachable
+		}
+		sleep := Backoff.DurationFor(i, ErrorReason(err))
+		if AttemptLog != nil {
+			target := cfg.Target()
+			fields := message.Fields{Target: target.String(), Attempt: i, Tries: tries, Severity: target.SeverityLevel(), Duration: result.Duration()}
+			if err != nil {
+				fields.Error, fields.Reason = err.Error(), ErrorReason(err)
+				if Retryable(err) {
+					fields.Sleep = sleep
+				}
+			}
+			AttemptLog.Log(fields)
+		}
+		if err != nil && !Retryable(err) {
+			if AttemptLog == nil {
+				log.Error("Connection attempt failed with a non-retryable error", log.Target(target), "attempt", i, "tries", tries, "reason", ErrorReason(err), "error", err)
+			}
+			return retry.Permanent(fmt.Errorf("[%s:%s/%s] %s: %w", cfg.Host, cfg.Port, cfg.Name, ErrorReason(err), err))
+		}
 		if err != nil {
-			return fmt.Errorf("cannot register TLS config for MySQL connection: %v", err)
+			if AttemptLog == nil {
+				log.Warn("Connection attempt failed", log.Target(target), "attempt", i, "tries", tries, "sleep", sleep, "reason", ErrorReason(err), "error", err)
+			}
+			if err := retry.Sleep(ctx, Clock, sleep); err != nil {
+				return fmt.Errorf("[%s:%s/%s] %w", cfg.Host, cfg.Port, cfg.Name, err)
+			}
+			continue
+		}
+		log.Info("Connect success", log.Target(target), "attempt", i, "tries", tries)
+		return nil
+	}
+	if !wantAvailable {
+		return fmt.Errorf("[%s:%s/%s] database is still reachable after %d tries", cfg.Host, cfg.Port, cfg.Name, tries)
+	}
+	return fmt.Errorf("[%s:%s/%s] connection attempts have failed", cfg.Host, cfg.Port, cfg.Name)
+}
+
+func CheckConnection(ctx context.Context, config types.MysqlConfig, opts ...Option) types.Result {
+	return Check(ctx, config.Target(), opts...)
+}
+
+// Check connects to a MySQL target, reads the server version and lists the
+// tables of its database, or runs the query given by WithQuery. Vitess
+// targets run SELECT 1 instead and check the shards of their keyspace. If
+// target.XPort is set, it then authenticates on the X Protocol port, and if
+// target.CDCConnector is set, it checks the binary log, the replication
+// privileges and the connector. Then it connects as every user of
+// target.Credentials the same way. A target with Endpoints succeeds if any
+// of them does, see race; the other users are checked on that endpoint.
+func Check(ctx context.Context, target types.Target, opts ...Option) types.Result {
+	o := newOptions(opts)
+	target, result := race(ctx, target, func(ctx context.Context, endpoint types.Target) types.Result {
+		return check(ctx, endpoint, o)
+	})
+	if result.Err == nil && len(target.Credentials) > 0 {
+		checkCredentials(ctx, target, o, &result)
+	}
+	if o.logger != nil {
+		for _, phase := range result.Phases {
+			o.logger.Printf("%s: %s took %v", target, phase.Name, phase.Duration)
+		}
+		if result.Err != nil {
+			o.logger.Printf("%s: check failed (%s): %v", target, result.Reason, util.Redact(result.Err.Error(), target.Pass))
 		}
-		connectString = fmt.Sprintf("%s?tls=%s", connectString, tlsConfigName)
 	}
-	db, err := sql.Open("mysql", connectString)
+	return result
+}
+
+func check(ctx context.Context, target types.Target, o options) types.Result {
+	config, err := mysql.ParseDSN(dsn(target))
 	if err != nil {
-		return fmt.Errorf("error connect: %v", err)
+		return newResult(nil, "", retry.Permanent(fmt.Errorf("error connect: %w", err)))
 	}
+	if target.TLS {
+		config.TLS = target.TLSConfig
+		if config.TLS == nil {
+			config.TLSConfig = "true"
+		}
+	}
+	if o.dialer != nil {
+		config.DialFunc = o.dialer.DialContext
+	}
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(fmt.Errorf("error connect: %w", err)))
+	}
+	db := sql.OpenDB(connector)
 	defer db.Close()
 
-	_, err = getSQLTables(db)
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+	ctx, cancel := within(ctx, o.timeout)
+	defer cancel()
+	connectCtx, cancelConnect := within(ctx, o.connectTimeout)
+	phase, err := connect(connectCtx, db)
+	cancelConnect()
+	phases := []types.Phase{phase}
+	if err != nil {
+		return newResult(phases, "", err)
+	}
+
+	ctx, cancelQueries := within(ctx, o.queryTimeout)
+	defer cancelQueries()
+	query := o.query
+	if target.Vitess && query == "" {
+		query = vitessQuery
+	}
+	phase, version, err := queryDB(ctx, db, query)
+	phases = append(phases, phase)
+	if err == nil && target.Vitess {
+		var phase types.Phase
+		phase, err = vitessPhase(ctx, db, target.Database)
+		phases = append(phases, phase)
+	}
+	if err == nil && target.XPort != "" {
+		var phase types.Phase
+		phase, err = xPhase(ctx, target, o.dialer)
+		phases = append(phases, phase)
+	}
+	if err == nil && target.CDCConnector != "" {
+		var cdc []types.Phase
+		cdc, err = cdcPhases(ctx, db, target, o.dialer)
+		phases = append(phases, cdc...)
+	}
 	if err != nil {
-		return fmt.Errorf("error getting tables: %v", err)
+		return newResult(phases, version, err)
+	}
+
+	var variables []types.VariableCheck
+	if len(target.ExpectVariables) > 0 {
+		variables, err = checkVariables(ctx, db, target.ExpectVariables)
+		if err == nil && target.FailOnMismatch {
+			err = mismatchError(variables)
+		}
+	}
+
+	var skew time.Duration
+	measured := false
+	if err == nil && o.maxClockSkew > 0 {
+		skew, err = clockSkew(ctx, db)
+		measured = err == nil
+		if measured {
+			err = util.CheckClockSkew(skew, o.maxClockSkew)
+		}
+	}
+	var tablespace types.Tablespace
+	tablespaceMeasured := false
+	if err == nil && o.tablespace {
+		tablespace, err = readTablespace(ctx, db, target.Database)
+		tablespaceMeasured = err == nil
+		if tablespaceMeasured && tablespace.FreePercent() < o.minFreeSpace {
+			err = util.WithClass(ErrLowFreeSpace, fmt.Errorf("%.1f%% of the tablespace is free, less than %v%%", tablespace.FreePercent(), o.minFreeSpace))
+		}
+	}
+	var sessions types.Sessions
+	sessionsMeasured := false
+	if err == nil && o.longQuery > 0 {
+		sessions, err = readSessions(ctx, db, o.longQuery)
+		sessionsMeasured = err == nil
+	}
+	var account, warning string
+	if err == nil && target.AccountHost != "" {
+		account, warning, err = checkAccount(ctx, db, target.User, target.AccountHost)
 	}
 
+	var threads types.Threads
+	threadsMeasured := false
+	if err == nil && o.threads {
+		threads, err = readThreads(ctx, db)
+		threadsMeasured = err == nil
+		if threadsMeasured {
+			err = checkThreads(threads, o.maxThreadsConnected, o.maxThreadsRunning)
+		}
+	}
+	var flowControl types.FlowControl
+	flowControlMeasured := false
+	if err == nil && o.flowControl {
+		flowControl, flowControlMeasured, err = readFlowControl(ctx, db)
+		if flowControlMeasured {
+			err = checkFlowControl(flowControl, o.maxFlowControlPaused)
+		}
+	}
+	result := newResult(phases, version, err)
+	result.Variables = variables
+	result.ClockSkew, result.ClockSkewMeasured = skew, measured
+	result.Tablespace, result.TablespaceMeasured = tablespace, tablespaceMeasured
+	result.Sessions, result.SessionsMeasured = sessions, sessionsMeasured
+	result.Threads, result.ThreadsMeasured = threads, threadsMeasured
+	result.FlowControl, result.FlowControlMeasured = flowControl, flowControlMeasured
+	result.Account = account
+	if warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	if target.AccountHost != "" && errors.Is(result.Err, ErrAuthFailed) {
+		result.Err = fmt.Errorf("%w (check that the account %s exists and its host pattern matches this client)", result.Err, accountName(target.User, target.AccountHost))
+	}
+	return result
+}
+
+// checkAccount reads the account the server matched the session to
+// (CURRENT_USER()) and returns a warning if it is not user@host. MySQL
+// matches the most specific host pattern, so a session landing on user@'%'
+// or on the anonymous user means the grant for the expected host is missing
+// and the session has that other account's privileges.
+func checkAccount(ctx context.Context, db *sql.DB, user, host string) (account, warning string, err error) {
+	var current, client string
+	if err := db.QueryRowContext(ctx, "SELECT CURRENT_USER(), USER()").Scan(&current, &client); err != nil {
+		return "", "", fmt.Errorf("error reading account: %w", err)
+	}
+	currentUser, currentHost, _ := strings.Cut(current, "@")
+	if currentUser == user && strings.EqualFold(currentHost, host) {
+		return current, "", nil
+	}
+	_, clientHost, _ := strings.Cut(client, "@")
+	return current, fmt.Sprintf("connected from %s as account %s instead of %s: the server has no account %s matching this host, or a more specific one takes precedence",
+		clientHost, accountName(currentUser, currentHost), accountName(user, host), accountName(user, host)), nil
+}
+
+// accountName formats an account the way MySQL prints it, 'user'@'host'.
+func accountName(user, host string) string {
+	return fmt.Sprintf("'%s'@'%s'", user, host)
+}
+
+// checkCredentials connects as every further user of target after the check
+// of target.User succeeded. The result fails with the error of the first
+// user that could not connect; the results of all users are kept in
+// result.Credentials.
+func checkCredentials(ctx context.Context, target types.Target, o options, result *types.Result) {
+	// Only the connection and the query of the main check are repeated.
+	base := options{timeout: o.timeout, connectTimeout: o.connectTimeout, queryTimeout: o.queryTimeout, query: o.query, dialer: o.dialer}
+	result.Credentials = []types.CredentialCheck{{User: target.User}}
+	for _, credential := range target.Credentials {
+		userTarget := target
+		userTarget.User, userTarget.Pass = credential.User, credential.Pass
+		userTarget.Credentials, userTarget.ExpectVariables, userTarget.AccountHost = nil, nil, ""
+
+		userResult := check(ctx, userTarget, base)
+		result.Credentials = append(result.Credentials, types.CredentialCheck{
+			User:   credential.User,
+			Err:    userResult.Err,
+			Reason: userResult.Reason,
+		})
+		if userResult.Err != nil && result.Err == nil {
+			result.Success = false
+			result.Err = fmt.Errorf("user %s: %w", credential.User, userResult.Err)
+			result.Reason = userResult.Reason
+		}
+	}
+}
+
+// readThreads reads the Threads_connected and Threads_running status
+// variables.
+func readThreads(ctx context.Context, db *sql.DB) (types.Threads, error) {
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL STATUS WHERE Variable_name IN ('Threads_connected', 'Threads_running')")
+	if err != nil {
+		return types.Threads{}, fmt.Errorf("error reading threads: %w", err)
+	}
+	defer rows.Close()
+
+	var threads types.Threads
+	for rows.Next() {
+		var name string
+		var value int
+		if err := rows.Scan(&name, &value); err != nil {
+			return types.Threads{}, fmt.Errorf("error reading threads: %w", err)
+		}
+		switch strings.ToLower(name) {
+		case "threads_connected":
+			threads.Connected = value
+		case "threads_running":
+			threads.Running = value
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return types.Threads{}, fmt.Errorf("error reading threads: %w", err)
+	}
+	return threads, nil
+}
+
+// checkThreads returns an error of class ErrTooManyThreads if a thread
+// count exceeds its positive limit.
+func checkThreads(threads types.Threads, maxConnected, maxRunning int) error {
+	if maxConnected > 0 && threads.Connected > maxConnected {
+		return util.WithClass(ErrTooManyThreads, fmt.Errorf("%d threads connected, more than %d", threads.Connected, maxConnected))
+	}
+	if maxRunning > 0 && threads.Running > maxRunning {
+		return util.WithClass(ErrTooManyThreads, fmt.Errorf("%d threads running, more than %d", threads.Running, maxRunning))
+	}
+	return nil
+}
+
+// readFlowControl reads the wsrep_flow_control_* status variables. ok is
+// false if the server is not a Galera node, e.g. a plain MySQL server, which
+// has none of them.
+func readFlowControl(ctx context.Context, db *sql.DB) (flowControl types.FlowControl, ok bool, err error) {
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL STATUS WHERE Variable_name IN ('wsrep_flow_control_paused', 'wsrep_flow_control_sent', 'wsrep_flow_control_recv')")
+	if err != nil {
+		return types.FlowControl{}, false, fmt.Errorf("error reading flow control: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return types.FlowControl{}, false, fmt.Errorf("error reading flow control: %w", err)
+		}
+		switch strings.ToLower(name) {
+		case "wsrep_flow_control_paused":
+			flowControl.Paused, err = strconv.ParseFloat(value, 64)
+		case "wsrep_flow_control_sent":
+			flowControl.Sent, err = strconv.ParseInt(value, 10, 64)
+		case "wsrep_flow_control_recv":
+			flowControl.Received, err = strconv.ParseInt(value, 10, 64)
+		default:
+			continue
+		}
+		if err != nil {
+			return types.FlowControl{}, false, fmt.Errorf("error reading flow control: %s: %w", name, err)
+		}
+		ok = true
+	}
+	if err := rows.Err(); err != nil {
+		return types.FlowControl{}, false, fmt.Errorf("error reading flow control: %w", err)
+	}
+	return flowControl, ok, nil
+}
+
+// checkFlowControl returns an error of class ErrFlowControl if the node was
+// paused by flow control for more than the positive fraction maxPaused of
+// the time.
+func checkFlowControl(flowControl types.FlowControl, maxPaused float64) error {
+	if maxPaused > 0 && flowControl.Paused > maxPaused {
+		return util.WithClass(ErrFlowControl, fmt.Errorf("paused by flow control %.1f%% of the time, more than %v%%", flowControl.Paused*100, maxPaused*100))
+	}
+	return nil
+}
+
+// sessionsQuery counts the queries running for at least ? seconds, ignoring
+// idle connections and replication threads, and the sessions waiting for a
+// metadata or table lock or for an InnoDB row lock.
+const sessionsQuery = `SELECT
+	(SELECT COUNT(*) FROM information_schema.PROCESSLIST
+		WHERE COMMAND NOT IN ('Sleep', 'Daemon', 'Binlog Dump', 'Binlog Dump GTID', 'Connect') AND TIME >= ?),
+	(SELECT COUNT(*) FROM information_schema.PROCESSLIST WHERE STATE LIKE 'Waiting for % lock')
+		+ (SELECT COUNT(*) FROM information_schema.INNODB_TRX WHERE trx_state = 'LOCK WAIT')`
+
+// readSessions counts the busy sessions of the server.
+func readSessions(ctx context.Context, db *sql.DB, longQuery time.Duration) (types.Sessions, error) {
+	var s types.Sessions
+	// TIME is in whole seconds; round up so short thresholds still count
+	// only queries at least that old.
+	seconds := int64((longQuery + time.Second - 1) / time.Second)
+	if err := db.QueryRowContext(ctx, sessionsQuery, seconds).Scan(&s.LongQueries, &s.LockWaits); err != nil {
+		return types.Sessions{}, fmt.Errorf("error reading sessions: %w", err)
+	}
+	return s, nil
+}
+
+// readTablespace sums the size and free space of the tables of database.
+// With innodb_file_per_table (the default) DATA_FREE is the free space of the
+// table's own file; tables in a shared tablespace all report the free space
+// of that tablespace, so it is counted once per table there.
+func readTablespace(ctx context.Context, db *sql.DB, database string) (types.Tablespace, error) {
+	var t types.Tablespace
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0), COALESCE(SUM(DATA_FREE), 0)
+		FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?`, database).Scan(&t.DataBytes, &t.FreeBytes)
+	if err != nil {
+		return types.Tablespace{}, fmt.Errorf("error reading tablespace size: %w", err)
+	}
+	return t, nil
+}
+
+// checkVariables reads the global values of the expected server variables,
+// in name order.
+func checkVariables(ctx context.Context, db *sql.DB, expected map[string]string) ([]types.VariableCheck, error) {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	checks := make([]types.VariableCheck, 0, len(names))
+	for _, name := range names {
+		// Names are validated by types.ParseVariables, so they are safe to
+		// put into the query.
+		var actual sql.NullString
+		if err := db.QueryRowContext(ctx, "SELECT @@GLOBAL."+name).Scan(&actual); err != nil {
+			return nil, fmt.Errorf("error reading variable %s: %w", name, err)
+		}
+		checks = append(checks, types.VariableCheck{
+			Name:     name,
+			Expected: expected[name],
+			Actual:   actual.String,
+			Match:    sameValue(expected[name], actual.String),
+		})
+	}
+	return checks, nil
+}
+
+// sameValue compares variable values ignoring case, and the order of the
+// elements of comma separated lists such as sql_mode. Boolean variables such
+// as log_bin read as 1 or 0 match ON and OFF.
+func sameValue(expected, actual string) bool {
+	normalize := func(value string) string {
+		parts := strings.Split(strings.ToUpper(value), ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+			switch parts[i] {
+			case "1", "TRUE":
+				parts[i] = "ON"
+			case "0", "FALSE":
+				parts[i] = "OFF"
+			}
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	}
+	return normalize(expected) == normalize(actual)
+}
+
+// mismatchError returns an error of class ErrVariableMismatch listing the
+// variables that differ from their expected values.
+func mismatchError(checks []types.VariableCheck) error {
+	var diffs []string
+	for _, c := range checks {
+		if !c.Match {
+			diffs = append(diffs, fmt.Sprintf("%s is %q, expected %q", c.Name, c.Actual, c.Expected))
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	return util.WithClass(ErrVariableMismatch, errors.New(strings.Join(diffs, "; ")))
+}
+
+// clockSkew returns the server clock minus the local one. The server time is
+// compared with the middle of the round trip of the query. UTC_TIMESTAMP is
+// used because NOW() depends on the time zone of the session.
+func clockSkew(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	start := time.Now()
+	var raw any
+	if err := db.QueryRowContext(ctx, "SELECT UTC_TIMESTAMP(6)").Scan(&raw); err != nil {
+		return 0, fmt.Errorf("error reading server time: %w", err)
+	}
+	local := start.Add(time.Since(start) / 2)
+
+	var server time.Time
+	switch value := raw.(type) {
+	case time.Time:
+		// With parseTime=true the driver returns the time in loc, UTC by
+		// default; the wall clock is UTC either way.
+		server = time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), value.Nanosecond(), time.UTC)
+	case []byte:
+		var err error
+		server, err = time.Parse("2006-01-02 15:04:05.999999", string(value))
+		if err != nil {
+			return 0, fmt.Errorf("error reading server time: %w", err)
+		}
+	default:
+		return 0, fmt.Errorf("error reading server time: unexpected value %v", raw)
+	}
+	return server.Sub(local), nil
+}
+
+// within returns ctx limited to timeout, or ctx itself if timeout is not
+// positive.
+func within(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// connect runs the connect phase of a check on an opened pool: the first
+// ping opens the connection.
+func connect(ctx context.Context, db *sql.DB) (types.Phase, error) {
+	start := time.Now()
+	err := db.PingContext(ctx)
+	phase := types.Phase{Name: "connect", Duration: time.Since(start)}
+	if err != nil {
+		return phase, fmt.Errorf("error connect: %w", err)
+	}
+	return phase, nil
+}
+
+// queryDB runs the query phase of a check on a connected pool and reads the
+// server version. An empty query lists the tables.
+func queryDB(ctx context.Context, db *sql.DB, query string) (types.Phase, string, error) {
+	start := time.Now()
+	// The version is informational, a user without access to it still
+	// passes the check.
+	var version string
+	db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version)
+	var err error
+	if query == "" {
+		_, err = getSQLTables(ctx, db)
+		if err != nil {
+			err = fmt.Errorf("error getting tables: %w", err)
+		}
+	} else {
+		err = runQuery(ctx, db, query)
+	}
+	return types.Phase{Name: "query", Duration: time.Since(start)}, version, err
+}
+
+// runQuery runs query and reads all its rows.
+func runQuery(ctx context.Context, db *sql.DB, query string) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("query '%s': %w", query, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query '%s': %w", query, err)
+	}
 	return nil
 }
 
-func getSQLTables(db *sql.DB) ([]string, error) {
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	err = classify(err)
+	return types.Result{
+		Success:       err == nil,
+		Attempts:      1,
+		Phases:        phases,
+		ServerVersion: version,
+		Reason:        ErrorReason(err),
+		Err:           err,
+	}
+}
+
+// dsn builds the driver connection string of target, with its Options as
+// DSN parameters.
+func dsn(target types.Target) string {
+	connectString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", target.User, target.Pass, target.Host, target.Port, target.Database)
+	keys := make([]string, 0, len(target.Options))
+	for key := range target.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		connectString = withParam(connectString, key, target.Options[key])
+	}
+	return connectString
+}
+
+func withParam(connectString, key, value string) string {
+	separator := "?"
+	if strings.Contains(connectString, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%s%s=%s", connectString, separator, key, url.QueryEscape(value))
+}
+
+func getSQLTables(ctx context.Context, db *sql.DB) ([]string, error) {
 	errorFuncName := "Func GetSQLTables() error"
 	query := "SHOW TABLES"
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	tableRows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("%s: query: '%s': %v", errorFuncName, query, err)
+		return nil, fmt.Errorf("%s: query: '%s': %w", errorFuncName, query, err)
 	}
 	defer tableRows.Close()
 
@@ -94,3 +816,60 @@ func getSQLTables(db *sql.DB) ([]string, error) {
 	}
 	return tables, nil
 }
+
+// classify wraps err with its error class, if known.
+func classify(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1044, 1045:
+			return util.WithClass(ErrAuthFailed, err)
+		case 1049:
+			return util.WithClass(ErrUnknownDatabase, err)
+		}
+	}
+	return util.ClassifyNetError(err)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "unknown database".
+func ErrorReason(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1044, 1045:
+			return "auth error"
+		case 1049:
+			return "unknown database"
+		case 1040:
+			return "too many connections"
+		case 1129:
+			// Too many aborted connections from this host; lifted by
+			// FLUSH HOSTS or after max_connect_errors is raised.
+			return "host blocked"
+		case 3955:
+			// The account is locked after FAILED_LOGIN_ATTEMPTS.
+			return "auth throttled"
+		}
+		return fmt.Sprintf("mysql error %d", mysqlErr.Number)
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Wrong credentials,
+// an unknown database, clock skew, server variables differing from the
+// expected ones, low free space, missing privileges and malformed connection
+// settings are not retryable: retrying them only wastes the retry budget.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database", "clock skew", "variable mismatch", "low free space", "missing privilege":
+		return false
+	}
+	return true
+}
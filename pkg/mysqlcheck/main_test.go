@@ -1,12 +1,22 @@
 package mysqlcheck
 
 import (
+	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
 	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
 )
 
 func TestGetSQLTables(t *testing.T) {
@@ -100,7 +110,7 @@ func TestGetSQLTables(t *testing.T) {
 			tt.mockSetup(mock)
 
 			// Execute function
-			tables, err := getSQLTables(db)
+			tables, err := getSQLTables(context.Background(), db)
 
 			// Check error expectations
 			if tt.wantErr {
@@ -141,46 +151,386 @@ func TestGetSQLTables(t *testing.T) {
 	}
 }
 
-func TestCheckConnection(t *testing.T) {
+func TestCheckDB(t *testing.T) {
 	tests := []struct {
-		name      string
-		config    types.MysqlConfig
-		mockSetup func(sqlmock.Sqlmock)
-		wantErr   bool
+		name        string
+		mockSetup   func(sqlmock.Sqlmock)
+		wantPhases  []string
+		wantVersion string
+		wantErr     bool
 	}{
 		{
-			name: "successful connection without TLS",
-			config: types.MysqlConfig{
-				Name: "testdb",
-				User: "testuser",
-				Pass: "testpass",
-				Host: "localhost",
-				Port: "3306",
-				TLS:  false,
+			name: "successful check",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPing()
+				mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.36"))
+				mock.ExpectQuery("SHOW TABLES").WillReturnRows(sqlmock.NewRows([]string{"Tables_in_db"}).AddRow("users"))
 			},
+			wantPhases:  []string{"connect", "query"},
+			wantVersion: "8.0.36",
+		},
+		{
+			name: "version is optional",
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"Tables_in_db"}).
-					AddRow("users")
-				mock.ExpectQuery("SHOW TABLES").WillReturnRows(rows)
+				mock.ExpectPing()
+				mock.ExpectQuery("SELECT VERSION()").WillReturnError(errors.New("access denied"))
+				mock.ExpectQuery("SHOW TABLES").WillReturnRows(sqlmock.NewRows([]string{"Tables_in_db"}))
 			},
-			wantErr: false,
+			wantPhases: []string{"connect", "query"},
+		},
+		{
+			name: "connect failure stops after connect phase",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+			},
+			wantPhases: []string{"connect"},
+			wantErr:    true,
+		},
+		{
+			name: "query failure",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectPing()
+				mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.36"))
+				mock.ExpectQuery("SHOW TABLES").WillReturnError(errors.New("permission denied"))
+			},
+			wantPhases:  []string{"connect", "query"},
+			wantVersion: "8.0.36",
+			wantErr:     true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Note: Testing checkMysqlConnection with real DB connection is complex
-			// because sql.Open creates a real connection pool.
-			// For unit tests, we would need to refactor the code to accept *sql.DB
-			// as a parameter or use an interface.
-
-			// This test is more of an integration test and would require
-			// either a real MySQL instance or further refactoring.
-			t.Skip("checkMysqlConnection requires refactoring to be unit testable")
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			tt.mockSetup(mock)
+
+			phase, err := connect(context.Background(), db)
+			names := []string{phase.Name}
+			var version string
+			if err == nil {
+				phase, version, err = queryDB(context.Background(), db, "")
+				names = append(names, phase.Name)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("connect() and queryDB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("queryDB() version = %q, want %q", version, tt.wantVersion)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.wantPhases) {
+				t.Errorf("phases = %v, want %v", names, tt.wantPhases)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   driver.Value
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "text result", value: []byte(time.Now().UTC().Add(time.Hour).Format("2006-01-02 15:04:05.999999")), want: time.Hour},
+		{name: "parseTime result", value: time.Now().UTC().Add(-time.Hour), want: -time.Hour},
+		{name: "unparsable result", value: []byte("soon"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			mock.ExpectQuery("SELECT UTC_TIMESTAMP").WillReturnRows(sqlmock.NewRows([]string{"UTC_TIMESTAMP(6)"}).AddRow(tt.value))
+
+			skew, err := clockSkew(context.Background(), db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clockSkew() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (skew-tt.want).Abs() > time.Second {
+				t.Errorf("clockSkew() = %v, want about %v", skew, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckVariables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery(`SELECT @@GLOBAL\.character_set_server`).WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow("latin1"))
+	mock.ExpectQuery(`SELECT @@GLOBAL\.sql_mode`).WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow("NO_ZERO_DATE,STRICT_TRANS_TABLES"))
+
+	checks, err := checkVariables(context.Background(), db, map[string]string{
+		"sql_mode":             "strict_trans_tables, no_zero_date",
+		"character_set_server": "utf8mb4",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.VariableCheck{
+		{Name: "character_set_server", Expected: "utf8mb4", Actual: "latin1", Match: false},
+		{Name: "sql_mode", Expected: "strict_trans_tables, no_zero_date", Actual: "NO_ZERO_DATE,STRICT_TRANS_TABLES", Match: true},
+	}
+	if !reflect.DeepEqual(checks, want) {
+		t.Errorf("checkVariables() = %+v, want %+v", checks, want)
+	}
+
+	err = mismatchError(checks)
+	if !errors.Is(err, ErrVariableMismatch) || ErrorReason(err) != "variable mismatch" || Retryable(err) {
+		t.Errorf("mismatchError() = %v", err)
+	}
+	if !strings.Contains(err.Error(), `character_set_server is "latin1", expected "utf8mb4"`) {
+		t.Errorf("mismatchError() = %v", err)
+	}
+	if err := mismatchError(checks[1:]); err != nil {
+		t.Errorf("mismatchError() with matching variables = %v", err)
+	}
+}
+
+func TestSameValue(t *testing.T) {
+	tests := []struct {
+		expected, actual string
+		want             bool
+	}{
+		{"ROW", "ROW", true},
+		{"utf8mb4", "UTF8MB4", true},
+		{"STRICT_TRANS_TABLES,NO_ZERO_DATE", "NO_ZERO_DATE,STRICT_TRANS_TABLES", true},
+		{"STRICT_TRANS_TABLES", "STRICT_TRANS_TABLES,NO_ZERO_DATE", false},
+		{"ON", "1", true},
+		{"ON", "0", false},
+		{"OFF", "OFF", true},
+		{"ON", "OFF_PERMISSIVE", false},
+	}
+
+	for _, tt := range tests {
+		if got := sameValue(tt.expected, tt.actual); got != tt.want {
+			t.Errorf("sameValue(%q, %q) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+		}
+	}
+}
+
+func TestReadTablespace(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+	// SUM returns DECIMAL, which the driver reads as text.
+	mock.ExpectQuery("FROM information_schema.TABLES").WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"data", "free"}).AddRow([]byte("9437184"), []byte("1048576")))
+
+	tablespace, err := readTablespace(context.Background(), db, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tablespace != (types.Tablespace{DataBytes: 9437184, FreeBytes: 1048576}) {
+		t.Errorf("readTablespace() = %+v", tablespace)
+	}
+	if got := tablespace.FreePercent(); got != 10 {
+		t.Errorf("FreePercent() = %v, want 10", got)
+	}
+	if got := (types.Tablespace{}).FreePercent(); got != 100 {
+		t.Errorf("FreePercent() of an empty database = %v, want 100", got)
+	}
+}
+
+func TestReadSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		longQuery   time.Duration
+		wantSeconds int64
+	}{
+		{name: "whole seconds", longQuery: 30 * time.Second, wantSeconds: 30},
+		{name: "rounds up", longQuery: 1500 * time.Millisecond, wantSeconds: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			mock.ExpectQuery("FROM information_schema.PROCESSLIST").WithArgs(tt.wantSeconds).
+				WillReturnRows(sqlmock.NewRows([]string{"long", "locks"}).AddRow(3, 1))
+
+			sessions, err := readSessions(context.Background(), db, tt.longQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sessions != (types.Sessions{LongQueries: 3, LockWaits: 1}) {
+				t.Errorf("readSessions() = %+v", sessions)
+			}
+		})
+	}
+}
+
+func TestThreads(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SHOW GLOBAL STATUS").
+		WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("Threads_connected", "120").AddRow("Threads_running", "8"))
+
+	threads, err := readThreads(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threads != (types.Threads{Connected: 120, Running: 8}) {
+		t.Fatalf("readThreads() = %+v", threads)
+	}
+
+	tests := []struct {
+		name                     string
+		maxConnected, maxRunning int
+		wantErr                  string
+	}{
+		{name: "no limits"},
+		{name: "under limits", maxConnected: 200, maxRunning: 8},
+		{name: "too many connected", maxConnected: 100, wantErr: "120 threads connected, more than 100"},
+		{name: "too many running", maxRunning: 4, wantErr: "8 threads running, more than 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkThreads(threads, tt.maxConnected, tt.maxRunning)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkThreads() = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr || ErrorReason(err) != "too many threads" || !Retryable(err) {
+				t.Errorf("checkThreads() = %v, want retryable %q", err, tt.wantErr)
+			}
 		})
 	}
 }
 
+func TestFlowControl(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      [][2]string
+		maxPaused float64
+		want      types.FlowControl
+		wantOK    bool
+		wantErr   string
+	}{
+		{name: "not a galera node"},
+		{
+			name:   "no limit",
+			rows:   [][2]string{{"wsrep_flow_control_paused", "0.250000"}, {"wsrep_flow_control_sent", "12"}, {"wsrep_flow_control_recv", "40"}},
+			want:   types.FlowControl{Paused: 0.25, Sent: 12, Received: 40},
+			wantOK: true,
+		},
+		{
+			name:      "under limit",
+			rows:      [][2]string{{"wsrep_flow_control_paused", "0.05"}},
+			maxPaused: 0.1,
+			want:      types.FlowControl{Paused: 0.05},
+			wantOK:    true,
+		},
+		{
+			name:      "paused too long",
+			rows:      [][2]string{{"wsrep_flow_control_paused", "0.25"}, {"wsrep_flow_control_recv", "40"}},
+			maxPaused: 0.1,
+			want:      types.FlowControl{Paused: 0.25, Received: 40},
+			wantOK:    true,
+			wantErr:   "paused by flow control 25.0% of the time, more than 10%",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			rows := sqlmock.NewRows([]string{"Variable_name", "Value"})
+			for _, row := range tt.rows {
+				rows.AddRow(row[0], row[1])
+			}
+			mock.ExpectQuery("SHOW GLOBAL STATUS").WillReturnRows(rows)
+
+			flowControl, ok, err := readFlowControl(context.Background(), db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flowControl != tt.want || ok != tt.wantOK {
+				t.Fatalf("readFlowControl() = %+v, %v, want %+v, %v", flowControl, ok, tt.want, tt.wantOK)
+			}
+
+			err = checkFlowControl(flowControl, tt.maxPaused)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkFlowControl() = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr || ErrorReason(err) != "flow control" || !Retryable(err) {
+				t.Errorf("checkFlowControl() = %v, want retryable %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAccount(t *testing.T) {
+	tests := []struct {
+		name        string
+		host        string
+		current     string
+		wantWarning string
+	}{
+		{name: "expected account", host: "10.0.%", current: "app@10.0.%"},
+		{name: "host pattern differs in case", host: "app-%.svc", current: "app@APP-%.svc"},
+		{name: "wildcard account", host: "10.0.%", current: "app@%", wantWarning: "connected from 10.0.0.5 as account 'app'@'%' instead of 'app'@'10.0.%'"},
+		{name: "anonymous account", host: "10.0.%", current: "@localhost", wantWarning: "as account ''@'localhost' instead of 'app'@'10.0.%'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			mock.ExpectQuery(`SELECT CURRENT_USER\(\), USER\(\)`).
+				WillReturnRows(sqlmock.NewRows([]string{"current", "user"}).AddRow(tt.current, "app@10.0.0.5"))
+
+			account, warning, err := checkAccount(context.Background(), db, "app", tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if account != tt.current {
+				t.Errorf("checkAccount() account = %q, want %q", account, tt.current)
+			}
+			if (tt.wantWarning == "") != (warning == "") || !strings.Contains(warning, tt.wantWarning) {
+				t.Errorf("checkAccount() warning = %q, want %q", warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCheckResult(t *testing.T) {
+	result := Check(context.Background(), types.Target{Type: "mysql", Host: "127.0.0.1", Port: "1", Database: "d/b"})
+	if result.Success || result.Attempts != 1 || result.Reason != "invalid config" || !retry.IsPermanent(result.Err) {
+		t.Errorf("Check() with invalid DSN = %+v", result)
+	}
+}
+
 func TestCheckConnections(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -198,7 +548,7 @@ func TestCheckConnections(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := CheckConnections(tt.configs, tt.tries)
+			err := CheckConnections(context.Background(), tt.configs, tt.tries)
 
 			if tt.wantErr {
 				if err == nil {
@@ -213,6 +563,149 @@ func TestCheckConnections(t *testing.T) {
 	}
 }
 
+func TestCheckConnectionsSleepsWithClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer func(c clock.Clock, b retry.Backoff) { Clock, Backoff = c, b }(Clock, Backoff)
+	Clock = fake
+	Backoff = retry.Backoff{Initial: time.Minute, Step: time.Minute}
+
+	errc := make(chan error, 1)
+	go func() {
+		// Nothing listens on port 1, so every try fails with connection refused.
+		errc <- CheckConnections(context.Background(), []types.MysqlConfig{{Host: "127.0.0.1", Port: "1", Name: "app", User: "app"}}, 3)
+	}()
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		fake.BlockUntil(1)
+		if pending := fake.Pending(); len(pending) != 1 || pending[0] != want {
+			t.Fatalf("pending sleeps = %v, want [%v]", pending, want)
+		}
+		fake.Advance(want)
+	}
+	if err := <-errc; err == nil {
+		t.Error("CheckConnections() expected error but got none")
+	}
+}
+
+func TestCheckUnavailableConnections(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []types.MysqlConfig
+		tries   int
+		wantErr bool
+	}{
+		{
+			name:    "empty config list returns no error",
+			configs: []types.MysqlConfig{},
+			tries:   3,
+			wantErr: false,
+		},
+		{
+			name: "unreachable database succeeds on first try",
+			configs: []types.MysqlConfig{
+				{Name: "db", User: "user", Pass: "pass", Host: "127.0.0.1", Port: "1"},
+			},
+			tries:   1,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckUnavailableConnections(context.Background(), tt.configs, tt.tries)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Error("CheckUnavailableConnections() expected error but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("CheckUnavailableConnections() unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAnyConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []types.MysqlConfig
+		tries   int
+		wantErr bool
+	}{
+		{
+			name:    "empty config list returns no error",
+			configs: []types.MysqlConfig{},
+			tries:   3,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAnyConnection(context.Background(), tt.configs, tt.tries)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Error("CheckAnyConnection() expected error but got none")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("CheckAnyConnection() unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorReasonThrottling(t *testing.T) {
+	tests := map[uint16]string{1040: "too many connections", 1129: "host blocked", 3955: "auth throttled"}
+	for number, want := range tests {
+		if got := ErrorReason(&mysql.MySQLError{Number: number}); got != want {
+			t.Errorf("ErrorReason(%d) = %q, want %q", number, got, want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil error", err: nil, want: false},
+		{name: "access denied", err: fmt.Errorf("error getting tables: %w", &mysql.MySQLError{Number: 1045}), want: false},
+		{name: "database access denied", err: &mysql.MySQLError{Number: 1044}, want: false},
+		{name: "unknown database", err: &mysql.MySQLError{Number: 1049}, want: false},
+		{name: "invalid settings", err: retry.Permanent(errors.New("invalid DSN")), want: false},
+		{name: "too many connections", err: &mysql.MySQLError{Number: 1040}, want: true},
+		{name: "host blocked", err: &mysql.MySQLError{Number: 1129}, want: true},
+		{name: "account locked after failed logins", err: &mysql.MySQLError{Number: 3955}, want: true},
+		{name: "network error", err: errors.New("dial tcp: connection refused"), want: true},
+		{name: "clock skew", err: util.CheckClockSkew(time.Minute, time.Second), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckConnectionsStopsOnNonRetryableError(t *testing.T) {
+	// A DSN the driver cannot parse fails on the first attempt without
+	// sleeping through the remaining tries.
+	configs := []types.MysqlConfig{{Name: "d/b", User: "user", Pass: "pass", Host: "127.0.0.1", Port: "1"}}
+
+	err := CheckConnections(context.Background(), configs, 10)
+	if !retry.IsPermanent(err) {
+		t.Errorf("CheckConnections() error = %v, want permanent error", err)
+	}
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
@@ -227,3 +720,58 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestDSN(t *testing.T) {
+	tests := []struct {
+		name   string
+		target types.Target
+		want   string
+	}{
+		{
+			name:   "without options",
+			target: types.MysqlConfig{Host: "db", Port: "3306", Name: "app", User: "u", Pass: "p"}.Target(),
+			want:   "u:p@tcp(db:3306)/app",
+		},
+		{
+			name: "options as sorted parameters",
+			target: types.Target{
+				Type: "mysql", Host: "db", Port: "3306", Database: "app", User: "u", Pass: "p",
+				Options: map[string]string{"timeout": "5s", "charset": "utf8mb4"},
+			},
+			want: "u:p@tcp(db:3306)/app?charset=utf8mb4&timeout=5s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dsn(tt.target); got != tt.want {
+				t.Errorf("dsn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "access denied", err: fmt.Errorf("error getting tables: %w", &mysql.MySQLError{Number: 1045}), want: ErrAuthFailed},
+		{name: "unknown database", err: &mysql.MySQLError{Number: 1049}, want: ErrUnknownDatabase},
+		{name: "timeout", err: fmt.Errorf("error connect: %w", context.DeadlineExceeded), want: ErrTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("classify() = %v, want errors.Is %v", err, tt.want)
+			}
+			var mysqlErr *mysql.MySQLError
+			if errors.As(tt.err, &mysqlErr) && !errors.As(err, &mysqlErr) {
+				t.Error("classify() hides the driver error")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package mysqlcheck
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+)
+
+// defaultTimeout bounds a whole check: connecting and running the queries.
+// With WithConnectTimeout or WithQueryTimeout it bounds only the other
+// phase instead.
+const defaultTimeout = 5 * time.Second
+
+// Dialer opens the network connections of a check. *net.Dialer implements
+// it; a custom one can route through a proxy or an SSH tunnel.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Option customizes a single Check or CheckConnection call, so programs
+// embedding the package need neither environment variables nor globals.
+type Option func(*options)
+
+type options struct {
+	timeout time.Duration
+	query   string
+	logger  *log.Logger
+	dialer  Dialer
+	// connectTimeout and queryTimeout limit the phases of a check when
+	// positive.
+	connectTimeout, queryTimeout time.Duration
+	// maxClockSkew enables the clock skew check when positive.
+	maxClockSkew time.Duration
+	// tablespace enables measuring the size and free space of the database.
+	tablespace   bool
+	minFreeSpace float64
+	// longQuery enables counting busy sessions when positive.
+	longQuery time.Duration
+	// threads enables reading Threads_connected and Threads_running.
+	threads                                bool
+	maxThreadsConnected, maxThreadsRunning int
+	// flowControl enables reading the Galera flow control status.
+	flowControl          bool
+	maxFlowControlPaused float64
+}
+
+func newOptions(opts []Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	switch {
+	case o.timeout > 0:
+	case o.connectTimeout <= 0 && o.queryTimeout <= 0:
+		o.timeout = defaultTimeout
+	case o.connectTimeout <= 0:
+		o.connectTimeout = defaultTimeout
+	case o.queryTimeout <= 0:
+		o.queryTimeout = defaultTimeout
+	}
+	return o
+}
+
+// WithTimeout limits the whole check. Without it a check takes at most 5
+// seconds or, with WithConnectTimeout or WithQueryTimeout, each phase takes
+// at most its own timeout, 5 seconds if it has none.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithConnectTimeout limits opening the connection, the connect phase of
+// the check, including the TLS handshake and authentication. A server that
+// accepts connections slowly then fails with ErrTimeout no matter how fast
+// its queries are. WithTimeout still limits the whole check.
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.connectTimeout = timeout
+	}
+}
+
+// WithQueryTimeout limits the queries run after connecting, together: the
+// query phase and the optional checks such as WithClockSkew or
+// WithTablespace. WithTimeout still limits the whole check.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = timeout
+	}
+}
+
+// WithQuery runs query instead of SHOW TABLES after connecting. Its rows
+// are read and discarded.
+func WithQuery(query string) Option {
+	return func(o *options) {
+		o.query = query
+	}
+}
+
+// WithLogger logs the duration of every phase and the error of a failed
+// check. Checks do not log by default.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithDialer opens connections with dialer instead of the driver's TCP
+// dialer.
+func WithDialer(dialer Dialer) Option {
+	return func(o *options) {
+		o.dialer = dialer
+	}
+}
+
+// WithClockSkew compares the server clock with the local one after the
+// check and reports the difference in Result.ClockSkew. The check fails with
+// ErrClockSkew if the clocks differ by more than max: skew breaks TLS
+// certificate validation and token authentication in ways that are hard to
+// trace back.
+func WithClockSkew(max time.Duration) Option {
+	return func(o *options) {
+		o.maxClockSkew = max
+	}
+}
+
+// WithTablespace measures the size of the tables of the database and the
+// free space inside their tablespaces (DATA_LENGTH, INDEX_LENGTH and
+// DATA_FREE of information_schema.TABLES) after the check and reports them
+// in Result.Tablespace. The check fails with ErrLowFreeSpace if the free
+// space is below minFreePercent of the tablespace size; 0 only measures.
+func WithTablespace(minFreePercent float64) Option {
+	return func(o *options) {
+		o.tablespace = true
+		o.minFreeSpace = minFreePercent
+	}
+}
+
+// WithSessions counts the queries running for at least longQuery and the
+// sessions waiting for a lock after the check and reports them in
+// Result.Sessions: a server that accepts connections but whose queries pile
+// up is the most common partial outage. Reading the sessions of other users
+// needs the PROCESS privilege.
+func WithSessions(longQuery time.Duration) Option {
+	return func(o *options) {
+		o.longQuery = longQuery
+	}
+}
+
+// WithThreads reads the Threads_connected and Threads_running status
+// variables after the check and reports them in Result.Threads. The check
+// fails with ErrTooManyThreads if one exceeds its limit, 0 means no limit,
+// so deploys can wait while the database is saturated.
+func WithThreads(maxConnected, maxRunning int) Option {
+	return func(o *options) {
+		o.threads = true
+		o.maxThreadsConnected = maxConnected
+		o.maxThreadsRunning = maxRunning
+	}
+}
+
+// WithFlowControl reads the flow control status of a Percona XtraDB Cluster
+// or Galera node after the check and reports it in Result.FlowControl;
+// other servers report nothing. The check fails with ErrFlowControl if the
+// node was paused for more than the fraction maxPaused of the time since the
+// last FLUSH STATUS, 0 means no limit: a node that keeps pausing the cluster
+// is too slow to take more load.
+func WithFlowControl(maxPaused float64) Option {
+	return func(o *options) {
+		o.flowControl = true
+		o.maxFlowControlPaused = maxPaused
+	}
+}
@@ -0,0 +1,134 @@
+package mysqlcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+type fakeDialer struct {
+	addresses []string
+	err       error
+	block     bool
+}
+
+func (d *fakeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.addresses = append(d.addresses, address)
+	if d.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return nil, d.err
+}
+
+func TestCheckOptions(t *testing.T) {
+	target := types.Target{Type: "mysql", Host: "db.internal", Port: "3306", Database: "app", User: "app", Pass: "s3cret"}
+
+	tests := []struct {
+		name           string
+		dialer         *fakeDialer
+		timeout        time.Duration
+		connectTimeout time.Duration
+		wantReason     string
+	}{
+		{
+			name:       "dialer error is the check error",
+			dialer:     &fakeDialer{err: errors.New("tunnel closed")},
+			wantReason: "error",
+		},
+		{
+			name:       "timeout bounds the check",
+			dialer:     &fakeDialer{block: true},
+			timeout:    50 * time.Millisecond,
+			wantReason: "timeout",
+		},
+		{
+			name:           "connect timeout bounds the connection",
+			dialer:         &fakeDialer{block: true},
+			connectTimeout: 50 * time.Millisecond,
+			wantReason:     "timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			opts := []Option{WithDialer(tt.dialer), WithLogger(log.New(&logs, "", 0))}
+			if tt.timeout > 0 {
+				opts = append(opts, WithTimeout(tt.timeout))
+			}
+			if tt.connectTimeout > 0 {
+				opts = append(opts, WithConnectTimeout(tt.connectTimeout))
+			}
+
+			start := time.Now()
+			result := Check(context.Background(), target, opts...)
+
+			if result.Success || result.Reason != tt.wantReason {
+				t.Errorf("Check() = %+v, want failure with reason %q", result, tt.wantReason)
+			}
+			if len(tt.dialer.addresses) == 0 || tt.dialer.addresses[0] != "db.internal:3306" {
+				t.Errorf("dialer called with %v, want db.internal:3306", tt.dialer.addresses)
+			}
+			if (tt.timeout > 0 || tt.connectTimeout > 0) && time.Since(start) > time.Second {
+				t.Errorf("Check() took %v with timeout %v and connect timeout %v", time.Since(start), tt.timeout, tt.connectTimeout)
+			}
+			if !strings.Contains(logs.String(), "mysql db.internal:3306/app: check failed") || strings.Contains(logs.String(), "s3cret") {
+				t.Errorf("logger output = %q", logs.String())
+			}
+		})
+	}
+}
+
+func TestCheckDBWithQuery(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectPing()
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.36"))
+	mock.ExpectQuery("SELECT 1 FROM orders LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	if _, err := connect(context.Background(), db); err != nil {
+		t.Fatalf("connect() unexpected error: %v", err)
+	}
+	if _, _, err := queryDB(context.Background(), db, "SELECT 1 FROM orders LIMIT 1"); err != nil {
+		t.Errorf("queryDB() unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestNewOptionsTimeouts(t *testing.T) {
+	tests := []struct {
+		name                    string
+		opts                    []Option
+		timeout, connect, query time.Duration
+	}{
+		{"default", nil, defaultTimeout, 0, 0},
+		{"whole check", []Option{WithTimeout(time.Second)}, time.Second, 0, 0},
+		{"connect only", []Option{WithConnectTimeout(time.Second)}, 0, time.Second, defaultTimeout},
+		{"both phases", []Option{WithConnectTimeout(time.Second), WithQueryTimeout(2 * time.Second)}, 0, time.Second, 2 * time.Second},
+		{"phase within the whole check", []Option{WithTimeout(3 * time.Second), WithQueryTimeout(time.Second)}, 3 * time.Second, 0, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(tt.opts)
+			if o.timeout != tt.timeout || o.connectTimeout != tt.connect || o.queryTimeout != tt.query {
+				t.Errorf("timeouts = %v, %v, %v, want %v, %v, %v", o.timeout, o.connectTimeout, o.queryTimeout, tt.timeout, tt.connect, tt.query)
+			}
+		})
+	}
+}
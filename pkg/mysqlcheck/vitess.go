@@ -0,0 +1,110 @@
+package mysqlcheck
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// vitessQuery replaces SHOW TABLES for Vitess targets: vtgate answers
+// SHOW TABLES only for unsharded keyspaces or a selected shard.
+const vitessQuery = "SELECT 1"
+
+// vitessPhase checks the shards of the keyspace of database, which may be
+// given as keyspace, keyspace:shard or with a tablet type, e.g.
+// commerce@replica. Every shard must have a serving primary tablet. The
+// statements are Vitess extensions that managed services such as PlanetScale
+// may not allow; the shards are then not checked.
+func vitessPhase(ctx context.Context, db *sql.DB, database string) (types.Phase, error) {
+	start := time.Now()
+	err := checkVitess(ctx, db, database)
+	return types.Phase{Name: "vitess shards", Duration: time.Since(start)}, err
+}
+
+func checkVitess(ctx context.Context, db *sql.DB, database string) error {
+	keyspace, _, _ := strings.Cut(database, "@")
+	keyspace, shard, _ := strings.Cut(keyspace, ":")
+
+	rows, err := queryRows(ctx, db, "SHOW VITESS_SHARDS")
+	if unsupported(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading shards: %w", err)
+	}
+	shards := []string{}
+	for _, row := range rows {
+		name := row["shards"]
+		if rowKeyspace, rowShard, _ := strings.Cut(name, "/"); (keyspace == "" || rowKeyspace == keyspace) && (shard == "" || rowShard == shard) {
+			shards = append(shards, name)
+		}
+	}
+
+	rows, err = queryRows(ctx, db, "SHOW VITESS_TABLETS")
+	if unsupported(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading tablets: %w", err)
+	}
+	serving := map[string]bool{}
+	for _, row := range rows {
+		// Vitess before 14 calls the primary MASTER.
+		if (row["tablettype"] == "PRIMARY" || row["tablettype"] == "MASTER") && row["state"] == "SERVING" {
+			serving[row["keyspace"]+"/"+row["shard"]] = true
+		}
+	}
+	for _, name := range shards {
+		if !serving[name] {
+			return util.WithClass(ErrShardNotServing, fmt.Errorf("shard %s has no serving primary tablet", name))
+		}
+	}
+	return nil
+}
+
+// unsupported reports whether the server rejected a Vitess statement, e.g. a
+// plain MySQL server or a vtgate that does not allow it.
+func unsupported(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr)
+}
+
+// queryRows runs a statement and returns its rows keyed by the lower case
+// column names.
+func queryRows(ctx context.Context, db *sql.DB, statement string) ([]map[string]string, error) {
+	rows, err := db.QueryContext(ctx, statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]string{}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for i, column := range columns {
+			row[strings.ToLower(column)] = values[i].String
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
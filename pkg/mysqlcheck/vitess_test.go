@@ -0,0 +1,106 @@
+package mysqlcheck
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestCheckVitess(t *testing.T) {
+	shards := []string{"commerce/0", "customer/-80", "customer/80-"}
+	tabletColumns := []string{"Cell", "Keyspace", "Shard", "TabletType", "State", "Alias", "Hostname", "PrimaryTermStartTime"}
+	tests := []struct {
+		name     string
+		database string
+		tablets  [][]string
+		// unsupported is the statement the server rejects.
+		unsupported string
+		wantReason  string
+	}{
+		{
+			name:     "every shard serving",
+			database: "customer",
+			tablets: [][]string{
+				{"zone1", "customer", "-80", "PRIMARY", "SERVING", "zone1-100", "tablet-100", "2024-01-01T00:00:00Z"},
+				{"zone1", "customer", "-80", "REPLICA", "SERVING", "zone1-101", "tablet-101", ""},
+				{"zone1", "customer", "80-", "MASTER", "SERVING", "zone1-200", "tablet-200", ""},
+			},
+		},
+		{
+			name:     "shard without serving primary",
+			database: "customer@replica",
+			tablets: [][]string{
+				{"zone1", "customer", "-80", "PRIMARY", "SERVING", "zone1-100", "tablet-100", ""},
+				{"zone1", "customer", "80-", "PRIMARY", "NOT_SERVING", "zone1-200", "tablet-200", ""},
+			},
+			wantReason: "shard not serving",
+		},
+		{
+			name:     "other shards of the keyspace are ignored",
+			database: "customer:-80",
+			tablets: [][]string{
+				{"zone1", "customer", "-80", "PRIMARY", "SERVING", "zone1-100", "tablet-100", ""},
+			},
+		},
+		{
+			name:     "other keyspaces are ignored",
+			database: "commerce",
+			tablets: [][]string{
+				{"zone1", "commerce", "0", "PRIMARY", "SERVING", "zone1-300", "tablet-300", ""},
+			},
+		},
+		{name: "shards not allowed", database: "customer", unsupported: "SHOW VITESS_SHARDS"},
+		{name: "tablets not allowed", database: "customer", unsupported: "SHOW VITESS_TABLETS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer db.Close()
+			denied := &mysql.MySQLError{Number: 1105, Message: "unsupported"}
+
+			if tt.unsupported == "SHOW VITESS_SHARDS" {
+				mock.ExpectQuery("SHOW VITESS_SHARDS").WillReturnError(denied)
+			} else {
+				rows := sqlmock.NewRows([]string{"Shards"})
+				for _, shard := range shards {
+					rows.AddRow(shard)
+				}
+				mock.ExpectQuery("SHOW VITESS_SHARDS").WillReturnRows(rows)
+				if tt.unsupported == "SHOW VITESS_TABLETS" {
+					mock.ExpectQuery("SHOW VITESS_TABLETS").WillReturnError(denied)
+				} else {
+					rows := sqlmock.NewRows(tabletColumns)
+					for _, tablet := range tt.tablets {
+						values := make([]driver.Value, len(tablet))
+						for i, value := range tablet {
+							values[i] = value
+						}
+						rows.AddRow(values...)
+					}
+					mock.ExpectQuery("SHOW VITESS_TABLETS").WillReturnRows(rows)
+				}
+			}
+
+			phase, err := vitessPhase(context.Background(), db, tt.database)
+			if phase.Name != "vitess shards" {
+				t.Errorf("phase = %q, want vitess shards", phase.Name)
+			}
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Errorf("vitessPhase() = %v", err)
+				}
+				return
+			}
+			if err == nil || ErrorReason(err) != tt.wantReason || !Retryable(err) {
+				t.Errorf("vitessPhase() = %v, want retryable %q", err, tt.wantReason)
+			}
+		})
+	}
+}
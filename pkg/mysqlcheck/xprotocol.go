@@ -0,0 +1,322 @@
+package mysqlcheck
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// X Protocol message types (Mysqlx.ClientMessages and ServerMessages).
+const (
+	xClientCapabilitiesGet   = 1
+	xClientCapabilitiesSet   = 2
+	xClientClose             = 3
+	xClientAuthenticateStart = 4
+	xClientAuthenticateCont  = 5
+
+	xServerOk               = 0
+	xServerError            = 1
+	xServerCapabilities     = 2
+	xServerAuthenticateCont = 3
+	xServerAuthenticateOk   = 4
+	xServerNotice           = 11
+)
+
+// maxXMessage limits the size of a server message read by the check.
+const maxXMessage = 1 << 20
+
+// checkXProtocol connects to the X Protocol port of target (the X Plugin,
+// used by the X DevAPI and MySQL Shell), reads its capabilities and
+// authenticates as target.User, so a broken X Plugin is not hidden by a
+// working classic port. With target.TLS the connection is upgraded to TLS
+// and the password is sent with PLAIN; otherwise MYSQL41 is tried for
+// mysql_native_password accounts and SHA256_MEMORY for caching_sha2_password
+// accounts. Server errors are returned as *mysql.MySQLError, so they are
+// classified like errors of the classic protocol.
+func checkXProtocol(ctx context.Context, target types.Target, dialer Dialer) error {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.Host, target.XPort))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	x := &xConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := x.write(xClientCapabilitiesGet, nil); err != nil {
+		return err
+	}
+	if _, err := x.expect(xServerCapabilities); err != nil {
+		return err
+	}
+
+	mechanisms := []string{"MYSQL41", "SHA256_MEMORY"}
+	if target.TLS {
+		if err := x.startTLS(target); err != nil {
+			return err
+		}
+		mechanisms = []string{"PLAIN"}
+	}
+	for i, mechanism := range mechanisms {
+		err = x.authenticate(mechanism, target.Database, target.User, target.Pass)
+		var mysqlErr *mysql.MySQLError
+		// A wrong password and an account of another plugin fail alike,
+		// so only the last mechanism's error is returned.
+		if err == nil || !errors.As(err, &mysqlErr) || mysqlErr.Number != 1045 || i == len(mechanisms)-1 {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	x.write(xClientClose, nil)
+	return nil
+}
+
+// xConn reads and writes X Protocol messages: a four byte little endian
+// length, the message type and the protobuf encoded message.
+type xConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (x *xConn) write(kind byte, message []byte) error {
+	frame := binary.LittleEndian.AppendUint32(nil, uint32(len(message)+1))
+	frame = append(frame, kind)
+	_, err := x.conn.Write(append(frame, message...))
+	return err
+}
+
+func (x *xConn) read() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(x.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[:4])
+	if length < 1 || length > maxXMessage {
+		return 0, nil, fmt.Errorf("invalid X Protocol message length %d, is %s the X Protocol port?", length, x.conn.RemoteAddr())
+	}
+	message := make([]byte, length-1)
+	if _, err := io.ReadFull(x.reader, message); err != nil {
+		return 0, nil, err
+	}
+	return header[4], message, nil
+}
+
+// expect reads messages up to one of type kind, skipping notices. An Error
+// message is returned as *mysql.MySQLError.
+func (x *xConn) expect(kind byte) ([]byte, error) {
+	for {
+		got, message, err := x.read()
+		if err != nil {
+			return nil, err
+		}
+		switch got {
+		case kind:
+			return message, nil
+		case xServerNotice:
+			continue
+		case xServerError:
+			return nil, xError(message)
+		default:
+			return nil, fmt.Errorf("unexpected X Protocol message type %d, want %d", got, kind)
+		}
+	}
+}
+
+// startTLS enables the tls capability and runs the TLS handshake on the
+// connection.
+func (x *xConn) startTLS(target types.Target) error {
+	// Mysqlx.Connection.CapabilitiesSet{capabilities: {capabilities:
+	// [{name: "tls", value: Any{type: SCALAR, scalar: {type: V_BOOL,
+	// v_bool: true}}}]}}
+	var scalar, value, capability, capabilities, set []byte
+	scalar = protowire.AppendTag(scalar, 1, protowire.VarintType)
+	scalar = protowire.AppendVarint(scalar, 7)
+	scalar = protowire.AppendTag(scalar, 8, protowire.VarintType)
+	scalar = protowire.AppendVarint(scalar, 1)
+	value = protowire.AppendTag(value, 1, protowire.VarintType)
+	value = protowire.AppendVarint(value, 1)
+	value = protowire.AppendTag(value, 2, protowire.BytesType)
+	value = protowire.AppendBytes(value, scalar)
+	capability = protowire.AppendTag(capability, 1, protowire.BytesType)
+	capability = protowire.AppendString(capability, "tls")
+	capability = protowire.AppendTag(capability, 2, protowire.BytesType)
+	capability = protowire.AppendBytes(capability, value)
+	capabilities = protowire.AppendTag(capabilities, 1, protowire.BytesType)
+	capabilities = protowire.AppendBytes(capabilities, capability)
+	set = protowire.AppendTag(set, 1, protowire.BytesType)
+	set = protowire.AppendBytes(set, capabilities)
+
+	if err := x.write(xClientCapabilitiesSet, set); err != nil {
+		return err
+	}
+	if _, err := x.expect(xServerOk); err != nil {
+		return fmt.Errorf("enabling TLS: %w", err)
+	}
+
+	config := &tls.Config{ServerName: target.Host}
+	if target.TLSConfig != nil {
+		config = target.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = target.Host
+		}
+	}
+	conn := tls.Client(x.conn, config)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	x.conn, x.reader = conn, bufio.NewReader(conn)
+	return nil
+}
+
+// authenticate runs one SASL exchange of AuthenticateStart,
+// AuthenticateContinue and AuthenticateOk.
+func (x *xConn) authenticate(mechanism, database, user, password string) error {
+	var start []byte
+	start = protowire.AppendTag(start, 1, protowire.BytesType)
+	start = protowire.AppendString(start, mechanism)
+	if mechanism == "PLAIN" {
+		start = protowire.AppendTag(start, 3, protowire.BytesType)
+		start = protowire.AppendString(start, database+"\x00"+user+"\x00"+password)
+	}
+	if err := x.write(xClientAuthenticateStart, start); err != nil {
+		return err
+	}
+
+	if mechanism != "PLAIN" {
+		message, err := x.expect(xServerAuthenticateCont)
+		if err != nil {
+			return err
+		}
+		nonce := xField(message, 1)
+		var response string
+		if mechanism == "MYSQL41" {
+			response = database + "\x00" + user + "\x00"
+			if password != "" {
+				response += "*" + hex.EncodeToString(scrambleMySQL41(nonce, password))
+			}
+		} else {
+			response = database + "\x00" + user + "\x00" + hex.EncodeToString(scrambleSHA256(nonce, password))
+		}
+		var cont []byte
+		cont = protowire.AppendTag(cont, 1, protowire.BytesType)
+		cont = protowire.AppendString(cont, response)
+		if err := x.write(xClientAuthenticateCont, cont); err != nil {
+			return err
+		}
+	}
+	_, err := x.expect(xServerAuthenticateOk)
+	return err
+}
+
+// scrambleMySQL41 is SHA1(password) XOR SHA1(nonce + SHA1(SHA1(password))),
+// the mysql_native_password scramble.
+func scrambleMySQL41(nonce []byte, password string) []byte {
+	hash1 := sha1.Sum([]byte(password))
+	hash2 := sha1.Sum(hash1[:])
+	hash3 := sha1.Sum(append(append([]byte{}, nonce...), hash2[:]...))
+	for i := range hash1 {
+		hash1[i] ^= hash3[i]
+	}
+	return hash1[:]
+}
+
+// scrambleSHA256 is SHA256(password) XOR SHA256(SHA256(SHA256(password)) +
+// nonce), the response of SHA256_MEMORY.
+func scrambleSHA256(nonce []byte, password string) []byte {
+	hash1 := sha256.Sum256([]byte(password))
+	hash2 := sha256.Sum256(hash1[:])
+	hash3 := sha256.Sum256(append(hash2[:], nonce...))
+	for i := range hash1 {
+		hash1[i] ^= hash3[i]
+	}
+	return hash1[:]
+}
+
+// xError converts a Mysqlx.Error message (code 2, sql_state 4, msg 3).
+func xError(message []byte) error {
+	err := &mysql.MySQLError{Message: string(xField(message, 3))}
+	if code, ok := xVarint(message, 2); ok {
+		err.Number = uint16(code)
+	}
+	copy(err.SQLState[:], xField(message, 4))
+	return err
+}
+
+// xField returns the last length delimited field num of message.
+func xField(message []byte, num protowire.Number) []byte {
+	var value []byte
+	for len(message) > 0 {
+		n, typ, l := protowire.ConsumeTag(message)
+		if l < 0 {
+			return value
+		}
+		message = message[l:]
+		if typ == protowire.BytesType && n == num {
+			v, l := protowire.ConsumeBytes(message)
+			if l < 0 {
+				return value
+			}
+			value = v
+			message = message[l:]
+			continue
+		}
+		l = protowire.ConsumeFieldValue(n, typ, message)
+		if l < 0 {
+			return value
+		}
+		message = message[l:]
+	}
+	return value
+}
+
+// xVarint returns the varint field num of message.
+func xVarint(message []byte, num protowire.Number) (uint64, bool) {
+	for len(message) > 0 {
+		n, typ, l := protowire.ConsumeTag(message)
+		if l < 0 {
+			return 0, false
+		}
+		message = message[l:]
+		if typ == protowire.VarintType && n == num {
+			v, l := protowire.ConsumeVarint(message)
+			return v, l >= 0
+		}
+		l = protowire.ConsumeFieldValue(n, typ, message)
+		if l < 0 {
+			return 0, false
+		}
+		message = message[l:]
+	}
+	return 0, false
+}
+
+// xPhase runs the X Protocol check as a timed phase of a check.
+func xPhase(ctx context.Context, target types.Target, dialer Dialer) (types.Phase, error) {
+	start := time.Now()
+	err := checkXProtocol(ctx, target, dialer)
+	phase := types.Phase{Name: "x protocol", Duration: time.Since(start)}
+	if err != nil {
+		return phase, fmt.Errorf("error X Protocol port %s: %w", target.XPort, err)
+	}
+	return phase, nil
+}
@@ -0,0 +1,141 @@
+package mysqlcheck
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeXServer answers like an X Plugin whose only account is app with
+// password secret, authenticated by mechanism. It returns the address.
+func fakeXServer(t *testing.T, mechanism string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	nonce := []byte("0123456789abcdefghij")
+	accessDenied := func() []byte {
+		var e []byte
+		e = protowire.AppendTag(e, 2, protowire.VarintType)
+		e = protowire.AppendVarint(e, 1045)
+		e = protowire.AppendTag(e, 3, protowire.BytesType)
+		e = protowire.AppendString(e, "Access denied for user 'app'@'localhost'")
+		e = protowire.AppendTag(e, 4, protowire.BytesType)
+		return protowire.AppendString(e, "HY000")
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				x := &xConn{conn: conn, reader: bufio.NewReader(conn)}
+				var started string
+				for {
+					kind, message, err := x.read()
+					if err != nil {
+						return
+					}
+					switch kind {
+					case xClientCapabilitiesGet:
+						// A notice before the answer is skipped by the client.
+						x.write(xServerNotice, nil)
+						x.write(xServerCapabilities, nil)
+					case xClientAuthenticateStart:
+						started = string(xField(message, 1))
+						var cont []byte
+						cont = protowire.AppendTag(cont, 1, protowire.BytesType)
+						cont = protowire.AppendBytes(cont, nonce)
+						x.write(xServerAuthenticateCont, cont)
+					case xClientAuthenticateCont:
+						want := "app\x00app\x00*" + hex.EncodeToString(scrambleMySQL41(nonce, "secret"))
+						if mechanism == "SHA256_MEMORY" {
+							want = "app\x00app\x00" + hex.EncodeToString(scrambleSHA256(nonce, "secret"))
+						}
+						if started == mechanism && string(xField(message, 1)) == want {
+							x.write(xServerAuthenticateOk, nil)
+						} else {
+							x.write(xServerError, accessDenied())
+						}
+					case xClientClose:
+						x.write(xServerOk, nil)
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestCheckXProtocol(t *testing.T) {
+	tests := []struct {
+		name       string
+		mechanism  string
+		pass       string
+		wantReason string
+	}{
+		{name: "mysql_native_password account", mechanism: "MYSQL41", pass: "secret"},
+		{name: "caching_sha2_password account", mechanism: "SHA256_MEMORY", pass: "secret"},
+		{name: "wrong password", mechanism: "MYSQL41", pass: "wrong", wantReason: "auth error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, _ := net.SplitHostPort(fakeXServer(t, tt.mechanism))
+			target := types.Target{Type: "mysql", Host: host, Port: "3306", XPort: port, Database: "app", User: "app", Pass: tt.pass}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			phase, err := xPhase(ctx, target, nil)
+			if phase.Name != "x protocol" {
+				t.Errorf("phase = %q, want x protocol", phase.Name)
+			}
+			if got := ErrorReason(classify(err)); tt.wantReason == "" && err != nil || tt.wantReason != "" && got != tt.wantReason {
+				t.Errorf("error = %v (%s), want reason %q", err, got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCheckXProtocolClassicPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// The greeting of the classic protocol: length 74, sequence 0,
+		// protocol version 10.
+		greeting := append([]byte{74, 0, 0, 0, 10}, make([]byte, 73)...)
+		conn.Write(greeting)
+		time.Sleep(time.Second)
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = checkXProtocol(ctx, types.Target{Host: host, XPort: port, User: "app"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "unexpected X Protocol message type 10") {
+		t.Errorf("checkXProtocol() error = %v, want an unexpected message", err)
+	}
+}
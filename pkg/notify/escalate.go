@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// ParseEscalation parses NOTIFY_ESCALATION: comma separated sink=duration
+// pairs, e.g.
+//
+//	slack=2m,pagerduty=10m
+//
+// The durations must be positive.
+func ParseEscalation(spec string) (map[string]time.Duration, error) {
+	delays := map[string]time.Duration{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q must be sink=duration", pair)
+		}
+		if !slices.Contains(SinkNames, name) {
+			return nil, fmt.Errorf("%q: unknown sink %q, want one of %s", pair, name, strings.Join(SinkNames, ", "))
+		}
+		if _, ok := delays[name]; ok {
+			return nil, fmt.Errorf("sink %s is given twice", name)
+		}
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf("%q: the delay must be a positive duration, e.g. 2m", pair)
+		}
+		delays[name] = delay
+	}
+	return delays, nil
+}
+
+// Escalation holds back the failures of a target from a sink until the
+// target has been failing for a delay, so e.g. Slack hears about an outage
+// after 2 minutes and PagerDuty only if it lasts 10. Successes are passed
+// on and restart the delay. The outage is timed from the first failed check
+// seen, so the sink learns of it at the first check after the delay. It is
+// a checker.Sink and safe for concurrent use.
+type Escalation struct {
+	sink  Sink
+	delay time.Duration
+	clock clock.Clock
+
+	mu sync.Mutex
+	// since is keyed by targetKey.
+	since map[string]time.Time
+}
+
+// NewEscalation returns sink with the failures of every target held back
+// for delay.
+func NewEscalation(sink Sink, delay time.Duration) *Escalation {
+	return &Escalation{sink: sink, delay: delay, clock: clock.Real, since: map[string]time.Time{}}
+}
+
+// Observe passes result to the sink unless target has been failing for
+// less than the delay.
+func (e *Escalation) Observe(ctx context.Context, target types.Target, result types.Result) {
+	if !e.escalated(targetKey(target), result.Success) {
+		return
+	}
+	e.sink.Observe(ctx, target, result)
+}
+
+// escalated records a check of the target with key and reports whether it
+// reaches the sink.
+func (e *Escalation) escalated(key string, success bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if success {
+		delete(e.since, key)
+		return true
+	}
+	now := e.clock.Now()
+	since, ok := e.since[key]
+	if !ok {
+		since = now
+		e.since[key] = now
+	}
+	return now.Sub(since) >= e.delay
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestParseEscalation(t *testing.T) {
+	delays, err := ParseEscalation(" slack=2m, pagerduty = 10m ,")
+	if err != nil {
+		t.Fatalf("ParseEscalation() error = %v", err)
+	}
+	want := map[string]time.Duration{"slack": 2 * time.Minute, "pagerduty": 10 * time.Minute}
+	if !reflect.DeepEqual(delays, want) {
+		t.Errorf("ParseEscalation() = %v, want %v", delays, want)
+	}
+
+	for spec, wantErr := range map[string]string{
+		"slack":               "must be sink=duration",
+		"=2m":                 "must be sink=duration",
+		"email=2m":            `unknown sink "email"`,
+		"slack=soon":          "positive duration",
+		"slack=0s":            "positive duration",
+		"slack=2m,slack=5m":   "sink slack is given twice",
+		"pagerduty=-10m":      "positive duration",
+		"slack=2m;pagerduty=": "positive duration",
+	} {
+		if _, err := ParseEscalation(spec); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("ParseEscalation(%q) error = %v, want %q", spec, err, wantErr)
+		}
+	}
+}
+
+// resultSink records the results it observes.
+type resultSink []bool
+
+func (s *resultSink) Observe(ctx context.Context, target types.Target, result types.Result) {
+	*s = append(*s, result.Success)
+}
+
+func TestEscalation(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	sink := &resultSink{}
+	escalation := NewEscalation(sink, 2*time.Minute)
+	escalation.clock = fake
+	orders := types.Target{Type: "mysql", Host: "orders-db", Port: "3306", Database: "orders"}
+	billing := types.Target{Type: "mysql", Host: "billing-db", Port: "3306", Database: "billing"}
+
+	check := func(target types.Target, result types.Result) {
+		escalation.Observe(context.Background(), target, result)
+		fake.Advance(time.Minute)
+	}
+	check(orders, refused) // 10:00, down since 10:00
+	check(billing, refused)
+	check(orders, refused) // 10:02, escalated
+	check(orders, refused)
+	check(orders, success)
+	check(orders, refused) // down again since 10:05
+	check(orders, success)
+
+	want := resultSink{false, false, true, true}
+	if !reflect.DeepEqual(*sink, want) {
+		t.Errorf("observed %v, want %v", *sink, want)
+	}
+}
+
+// targetSink records the targets whose results it observes.
+type targetSink []string
+
+func (s *targetSink) Observe(ctx context.Context, target types.Target, result types.Result) {
+	*s = append(*s, target.Labels["team"])
+}
+
+func TestEscalationTellsTargetsApart(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	sink := &targetSink{}
+	escalation := NewEscalation(sink, 2*time.Minute)
+	escalation.clock = fake
+	// The same database, routed to two teams: target.String is the same.
+	payments := types.Target{Type: "mysql", Host: "orders-db", Port: "3306", Database: "orders", Labels: map[string]string{"team": "payments"}}
+	analytics := payments
+	analytics.Labels = map[string]string{"team": "analytics"}
+	if payments.String() != analytics.String() {
+		t.Fatalf("targets %s and %s must collide under String", payments, analytics)
+	}
+	// Credentials rotated during the outage do not restart it.
+	rotated := payments
+	rotated.Pass = "rotated"
+
+	check := func(target types.Target) {
+		escalation.Observe(context.Background(), target, refused)
+	}
+	check(payments) // 10:00, payments down since 10:00
+	fake.Advance(time.Minute)
+	check(analytics) // 10:01, analytics down since 10:01
+	fake.Advance(time.Minute)
+	check(rotated)   // 10:02, payments escalated
+	check(analytics) // 10:02, analytics held back
+	fake.Advance(time.Minute)
+	check(analytics) // 10:03, analytics escalated
+
+	want := targetSink{"payments", "analytics"}
+	if !reflect.DeepEqual(*sink, want) {
+		t.Errorf("observed %v, want %v", *sink, want)
+	}
+}
+
+func TestRouterEscalate(t *testing.T) {
+	router := NewRouter(nil)
+	router.Escalate(map[string]time.Duration{"pagerduty": 10 * time.Minute})
+	router.Add("slack", &resultSink{})
+	if err := router.Validate(); err == nil || !strings.Contains(err.Error(), "NOTIFY_ESCALATION: sink pagerduty is not configured") {
+		t.Errorf("Validate() error = %v, want pagerduty not configured", err)
+	}
+
+	pagerDuty := &resultSink{}
+	router.Add("pagerduty", pagerDuty)
+	if err := router.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	router.Observe(context.Background(), target, refused)
+	if len(*pagerDuty) != 0 {
+		t.Errorf("pagerduty observed %v, want the failure held back", *pagerDuty)
+	}
+}
@@ -0,0 +1,256 @@
+// Package notify posts notifications about databases that become
+// unreachable, and reachable again, to Slack and PagerDuty, and routes check
+// results to the sinks whose rules match the labels of their target
+// (NOTIFY_ROUTES), so e.g. production databases page while staging ones only
+// post to a channel.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/message"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// PagerDutyURL is the Events API v2 endpoint alerts are sent to.
+const PagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// timeout limits every request to Slack or PagerDuty.
+const timeout = 10 * time.Second
+
+// targetKey identifies the outage of target. target.String is not enough:
+// targets at the same address can be told apart only by their options, e.g.
+// the Kafka topic, or by their labels, e.g. the same database routed to two
+// teams, and each of them fails on its own. The credentials, timeouts and
+// schedule are left out, as changing them does not start a new outage.
+func targetKey(target types.Target) string {
+	return fmt.Sprintf("%#v", struct {
+		Type, Host, Port, Database, URI string
+		Endpoints                       []string
+		Options, Labels                 map[string]string
+	}{target.Type, target.Host, target.Port, target.Database, target.URI, target.Endpoints, target.Options, target.Labels})
+}
+
+// changes keeps the failure reason of every failing target, so only changes
+// are notified: a target that starts failing or fails for a different
+// reason, and one that recovers. The first success of a target is not a
+// change.
+type changes struct {
+	mu sync.Mutex
+	// failing is keyed by targetKey.
+	failing map[string]string
+}
+
+// update records the result of a check of the target with key and returns the failure
+// reason to notify about, empty for a recovery, and whether to notify.
+func (c *changes) update(key string, result types.Result) (string, bool) {
+	reason := ""
+	if !result.Success {
+		reason = result.Reason
+		if reason == "" {
+			reason = "unknown error"
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failing == nil {
+		c.failing = map[string]string{}
+	}
+	previous, wasFailing := c.failing[key]
+	if reason == "" {
+		delete(c.failing, key)
+		return "", wasFailing
+	}
+	c.failing[key] = reason
+	return reason, !wasFailing || previous != reason
+}
+
+// messages renders the text of notifications.
+type messages struct {
+	// Template renders the message about an unreachable database if set,
+	// with the database as Target, the failure reason as Error and Reason,
+	// its severity as Severity and Labels as Labels.
+	Template *message.Template
+	// Labels are passed to Template, e.g. the owner labels. The labels of
+	// the target take precedence.
+	Labels map[string]string
+}
+
+func (m messages) unreachable(target types.Target, reason string) string {
+	if m.Template != nil {
+		fields := message.Fields{Target: target.String(), Error: reason, Reason: reason, Severity: target.SeverityLevel(), Labels: m.labels(target)}
+		if text, err := m.Template.Execute(fields); err == nil {
+			return text
+		}
+	}
+	return fmt.Sprintf("database %s unreachable: %s", target, reason)
+}
+
+func (m messages) reachable(target types.Target) string {
+	return fmt.Sprintf("database %s is reachable again", target)
+}
+
+func (m messages) labels(target types.Target) map[string]string {
+	if len(target.Labels) == 0 {
+		return m.Labels
+	}
+	labels := make(map[string]string, len(m.Labels)+len(target.Labels))
+	for name, value := range m.Labels {
+		labels[name] = value
+	}
+	for name, value := range target.Labels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// Slack posts a message to an incoming webhook when a database becomes
+// unreachable, fails for a different reason or recovers. It is a
+// checker.Sink and safe for concurrent use.
+type Slack struct {
+	messages
+	url    string
+	client *http.Client
+	state  changes
+}
+
+// NewSlack returns a notifier posting to the incoming webhook url.
+func NewSlack(url string) *Slack {
+	return &Slack{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Observe posts a message if result changes the state of target.
+func (s *Slack) Observe(ctx context.Context, target types.Target, result types.Result) {
+	reason, ok := s.state.update(targetKey(target), result)
+	if !ok {
+		return
+	}
+	text := s.reachable(target)
+	if reason != "" {
+		text = s.unreachable(target, reason)
+	}
+	if err := post(ctx, s.client, s.url, map[string]string{"text": text}); err != nil {
+		log.Error("Error posting to Slack", log.Target(target), "error", err)
+	}
+}
+
+// PagerDuty triggers an alert through the Events API v2 when a database
+// becomes unreachable or fails for a different reason, and resolves it when
+// the database recovers. Alerts of one database share a dedup key, so they
+// form one incident, see dedupKey. It is a checker.Sink and safe for concurrent use.
+type PagerDuty struct {
+	messages
+	routingKey string
+	url        string
+	client     *http.Client
+	state      changes
+}
+
+// NewPagerDuty returns a notifier sending events with the integration key
+// routingKey.
+func NewPagerDuty(routingKey string) *PagerDuty {
+	return &PagerDuty{routingKey: routingKey, url: PagerDutyURL, client: &http.Client{Timeout: timeout}}
+}
+
+// pagerDutyEvent is the body of Events API v2 requests.
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// Observe triggers or resolves the alert of target if result changes its
+// state.
+func (p *PagerDuty) Observe(ctx context.Context, target types.Target, result types.Result) {
+	reason, ok := p.state.update(targetKey(target), result)
+	if !ok {
+		return
+	}
+	event := pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "resolve",
+		DedupKey:    dedupKey(target),
+	}
+	if reason != "" {
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			// PagerDuty truncates longer summaries.
+			Summary:       truncate(p.unreachable(target, reason), 1024),
+			Source:        target.Host,
+			Severity:      target.SeverityLevel(),
+			Component:     target.Type,
+			Group:         target.Database,
+			Class:         reason,
+			CustomDetails: p.labels(target),
+		}
+	}
+	if err := post(ctx, p.client, p.url, event); err != nil {
+		log.Error("Error sending event to PagerDuty", log.Target(target), "error", err)
+	}
+}
+
+// dedupKey is the dedup key of the alerts of target: its name, readable in
+// PagerDuty, and a hash of targetKey, so targets sharing the name open
+// separate incidents.
+func dedupKey(target types.Target) string {
+	sum := sha256.Sum256([]byte(targetKey(target)))
+	return fmt.Sprintf("db-connect-checker/%s/%x", target, sum[:6])
+}
+
+func truncate(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	return text[:size]
+}
+
+// post sends body as JSON to endpoint. The URL is left out of errors, as webhook
+// URLs are secrets.
+func post(ctx context.Context, client *http.Client, endpoint string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	// The check context may end right after the check.
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error of the client repeats the URL.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/message"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// recorder is an HTTP endpoint recording the JSON bodies posted to it.
+type recorder struct {
+	mu     sync.Mutex
+	bodies []map[string]any
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body map[string]any
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.bodies = append(r.bodies, body)
+	r.mu.Unlock()
+}
+
+var (
+	target  = types.Target{Type: "mysql", Host: "orders-db", Port: "3306", Database: "orders", Labels: map[string]string{"env": "prod"}}
+	success = types.Result{Success: true, Attempts: 1}
+	refused = types.Result{Attempts: 1, Reason: "connection refused", Err: errors.New("dial tcp: connection refused")}
+	denied  = types.Result{Attempts: 1, Reason: "auth error", Err: errors.New("access denied for user app")}
+)
+
+func TestSlack(t *testing.T) {
+	endpoint := &recorder{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	slack := NewSlack(server.URL)
+	for _, result := range []types.Result{success, refused, refused, denied, success, success} {
+		slack.Observe(context.Background(), target, result)
+	}
+
+	want := []string{
+		"database mysql orders-db:3306/orders unreachable: connection refused",
+		"database mysql orders-db:3306/orders unreachable: auth error",
+		"database mysql orders-db:3306/orders is reachable again",
+	}
+	if len(endpoint.bodies) != len(want) {
+		t.Fatalf("posted %v, want %d messages", endpoint.bodies, len(want))
+	}
+	for i, text := range want {
+		if endpoint.bodies[i]["text"] != text {
+			t.Errorf("message %d = %v, want %q", i, endpoint.bodies[i]["text"], text)
+		}
+	}
+}
+
+func TestSlackTemplate(t *testing.T) {
+	endpoint := &recorder{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	tmpl, err := message.Parse("NOTIFY_TEMPLATE", "[{{.Labels.env}}/{{.Labels.team}}] {{.Severity}} {{.Target}}: {{.Reason}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack := NewSlack(server.URL)
+	slack.Template, slack.Labels = tmpl, map[string]string{"env": "default", "team": "payments"}
+	slack.Observe(context.Background(), target, refused)
+
+	if len(endpoint.bodies) != 1 || endpoint.bodies[0]["text"] != "[prod/payments] critical mysql orders-db:3306/orders: connection refused" {
+		t.Errorf("posted %v, want the message rendered with the labels of the target", endpoint.bodies)
+	}
+}
+
+func TestPagerDuty(t *testing.T) {
+	endpoint := &recorder{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	pagerDuty := NewPagerDuty("routing-key")
+	pagerDuty.url = server.URL
+	for _, result := range []types.Result{refused, refused, success} {
+		pagerDuty.Observe(context.Background(), target, result)
+	}
+
+	if len(endpoint.bodies) != 2 {
+		t.Fatalf("sent %v, want a trigger and a resolve event", endpoint.bodies)
+	}
+	trigger, resolve := endpoint.bodies[0], endpoint.bodies[1]
+	for _, event := range endpoint.bodies {
+		if event["routing_key"] != "routing-key" || event["dedup_key"] != trigger["dedup_key"] || !strings.HasPrefix(event["dedup_key"].(string), "db-connect-checker/mysql orders-db:3306/orders/") {
+			t.Errorf("event = %v, want the routing key and the dedup key of the target", event)
+		}
+	}
+	if trigger["event_action"] != "trigger" {
+		t.Errorf("first event = %v, want a trigger", trigger)
+	}
+	payload, _ := trigger["payload"].(map[string]any)
+	if payload["summary"] != "database mysql orders-db:3306/orders unreachable: connection refused" || payload["source"] != "orders-db" || payload["severity"] != "critical" || payload["component"] != "mysql" {
+		t.Errorf("trigger payload = %v", payload)
+	}
+	if details, _ := payload["custom_details"].(map[string]any); details["env"] != "prod" {
+		t.Errorf("trigger custom_details = %v, want the labels of the target", payload["custom_details"])
+	}
+	if resolve["event_action"] != "resolve" || resolve["payload"] != nil {
+		t.Errorf("second event = %v, want a resolve without payload", resolve)
+	}
+}
+
+func TestPagerDutySeverity(t *testing.T) {
+	endpoint := &recorder{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	pagerDuty := NewPagerDuty("routing-key")
+	pagerDuty.url = server.URL
+	replica := types.Target{Type: "mysql", Host: "analytics-replica", Port: "3306", Database: "analytics", Severity: "warning"}
+	pagerDuty.Observe(context.Background(), replica, refused)
+
+	if len(endpoint.bodies) != 1 {
+		t.Fatalf("sent %v, want a trigger", endpoint.bodies)
+	}
+	if payload, _ := endpoint.bodies[0]["payload"].(map[string]any); payload["severity"] != "warning" {
+		t.Errorf("trigger payload = %v, want the severity of the target", payload)
+	}
+}
+
+func TestNotifiersTellTargetsApart(t *testing.T) {
+	// The same database, routed to two teams: target.String is the same.
+	payments := types.Target{Type: "mysql", Host: "orders-db", Port: "3306", Database: "orders", Labels: map[string]string{"team": "payments"}}
+	analytics := payments
+	analytics.Labels = map[string]string{"team": "analytics"}
+	if payments.String() != analytics.String() {
+		t.Fatalf("targets %s and %s must collide under String", payments, analytics)
+	}
+
+	slackEndpoint, pagerDutyEndpoint := &recorder{}, &recorder{}
+	slackServer, pagerDutyServer := httptest.NewServer(slackEndpoint), httptest.NewServer(pagerDutyEndpoint)
+	defer slackServer.Close()
+	defer pagerDutyServer.Close()
+	slack := NewSlack(slackServer.URL)
+	pagerDuty := NewPagerDuty("routing-key")
+	pagerDuty.url = pagerDutyServer.URL
+
+	for _, check := range []struct {
+		target types.Target
+		result types.Result
+	}{{payments, refused}, {analytics, refused}, {payments, success}} {
+		slack.Observe(context.Background(), check.target, check.result)
+		pagerDuty.Observe(context.Background(), check.target, check.result)
+	}
+
+	if len(slackEndpoint.bodies) != 3 {
+		t.Errorf("posted %v, want an outage of each target and a recovery", slackEndpoint.bodies)
+	}
+	events := pagerDutyEndpoint.bodies
+	if len(events) != 3 {
+		t.Fatalf("sent %v, want a trigger for each target and a resolve", events)
+	}
+	if events[0]["dedup_key"] == events[1]["dedup_key"] {
+		t.Errorf("triggers share the dedup key %v, want an incident for each target", events[0]["dedup_key"])
+	}
+	if events[2]["event_action"] != "resolve" || events[2]["dedup_key"] != events[0]["dedup_key"] {
+		t.Errorf("third event = %v, want the resolve of the first incident", events[2])
+	}
+}
+
+func TestPostError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := post(context.Background(), http.DefaultClient, server.URL+"/services/T000/B000/secret", map[string]string{"text": "x"})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("post() error = %v, want the status", err)
+	}
+
+	server.Close()
+	err = post(context.Background(), http.DefaultClient, server.URL+"/services/T000/B000/secret", map[string]string{"text": "x"})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("post() error = %v, want an error without the URL", err)
+	}
+}
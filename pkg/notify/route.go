@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// SinkNames are the sinks NOTIFY_ROUTES can name.
+var SinkNames = []string{"audit", "syslog", "mqtt", "kafka", "eventlog", "influx", "slack", "pagerduty"}
+
+// Route sends the results of the targets matching every label pattern of
+// Match to Sinks.
+type Route struct {
+	// Match maps label names to path.Match patterns, e.g. env=prod or
+	// host=*.staging.internal. An empty Match matches every target.
+	Match map[string]string
+	Sinks []string
+}
+
+// ParseRoutes parses NOTIFY_ROUTES: routes separated by semicolons, each
+// comma separated name=pattern pairs, or * for every target, followed by a
+// colon and the comma separated sinks, e.g.
+//
+//	env=prod,type=mysql:pagerduty,slack;env=staging:slack
+func ParseRoutes(spec string) ([]Route, error) {
+	routes := []Route{}
+	for _, text := range strings.Split(spec, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		// Patterns may contain colons, e.g. target=*:3306/*, sink names do
+		// not.
+		i := strings.LastIndex(text, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("route %q must be labels:sinks", text)
+		}
+		route := Route{Match: map[string]string{}}
+		if matcher := strings.TrimSpace(text[:i]); matcher != "*" {
+			for _, pair := range strings.Split(matcher, ",") {
+				name, pattern, ok := strings.Cut(pair, "=")
+				name, pattern = strings.TrimSpace(name), strings.TrimSpace(pattern)
+				if !ok || name == "" {
+					return nil, fmt.Errorf("route %q: %q must be name=pattern", text, pair)
+				}
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("route %q: invalid pattern %q", text, pattern)
+				}
+				route.Match[name] = pattern
+			}
+		}
+		for _, sink := range strings.Split(text[i+1:], ",") {
+			sink = strings.TrimSpace(sink)
+			if !slices.Contains(SinkNames, sink) {
+				return nil, fmt.Errorf("route %q: unknown sink %q, want one of %s", text, sink, strings.Join(SinkNames, ", "))
+			}
+			route.Sinks = append(route.Sinks, sink)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// Labels returns the labels routes match target by: its own labels and
+// type, host, port, database, severity and target, the address as in logs,
+// e.g. "mysql db:3306/app". The built in labels take precedence.
+func Labels(target types.Target) map[string]string {
+	labels := make(map[string]string, len(target.Labels)+6)
+	for name, value := range target.Labels {
+		labels[name] = value
+	}
+	labels["type"] = target.Type
+	labels["host"] = target.Host
+	labels["port"] = target.Port
+	labels["database"] = target.Database
+	labels["severity"] = target.SeverityLevel()
+	labels["target"] = target.String()
+	return labels
+}
+
+// Matches reports whether the labels of target match every pattern of r.
+// A label target does not have matches only the pattern "" or "*".
+func (r Route) Matches(target types.Target) bool {
+	labels := Labels(target)
+	for name, pattern := range r.Match {
+		if ok, _ := path.Match(pattern, labels[name]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Sink receives check results, like a checker.Sink.
+type Sink interface {
+	Observe(ctx context.Context, target types.Target, result types.Result)
+}
+
+// Router passes check results to the sinks the routes select. A sink that
+// no route names gets every result; one that routes name only gets the
+// results of the targets matched by one of them. It is a checker.Sink and
+// safe for concurrent use.
+type Router struct {
+	routes []Route
+
+	mu     sync.Mutex
+	names  []string
+	sinks  map[string]Sink
+	delays map[string]time.Duration
+}
+
+// NewRouter returns a router with routes and no sinks.
+func NewRouter(routes []Route) *Router {
+	return &Router{routes: routes, sinks: map[string]Sink{}}
+}
+
+// Escalate holds back failures from the sinks added later by the delays of
+// their names, see Escalation.
+func (r *Router) Escalate(delays map[string]time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delays = delays
+}
+
+// Add makes sink, one of SinkNames, receive the results routed to name.
+func (r *Router) Add(name string, sink Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if delay, ok := r.delays[name]; ok {
+		sink = NewEscalation(sink, delay)
+	}
+	if _, ok := r.sinks[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.sinks[name] = sink
+}
+
+// Validate returns an error if a route or an escalation names a sink that
+// was not added, so a route to e.g. an unset PAGERDUTY_ROUTING_KEY is not
+// silently dropped.
+func (r *Router) Validate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, route := range r.routes {
+		for _, name := range route.Sinks {
+			if _, ok := r.sinks[name]; !ok {
+				return fmt.Errorf("NOTIFY_ROUTES: sink %s is not configured", name)
+			}
+		}
+	}
+	for _, name := range SinkNames {
+		if _, ok := r.delays[name]; ok && r.sinks[name] == nil {
+			return fmt.Errorf("NOTIFY_ESCALATION: sink %s is not configured", name)
+		}
+	}
+	return nil
+}
+
+// Observe passes the result of a check of target to its sinks.
+func (r *Router) Observe(ctx context.Context, target types.Target, result types.Result) {
+	for _, sink := range r.Sinks(target) {
+		sink.Observe(ctx, target, result)
+	}
+}
+
+// Sinks returns the sinks that get the results of target, in the order they
+// were added.
+func (r *Router) Sinks(target types.Target) []Sink {
+	routed := map[string]bool{}
+	matched := map[string]bool{}
+	for _, route := range r.routes {
+		ok := route.Matches(target)
+		for _, name := range route.Sinks {
+			routed[name] = true
+			matched[name] = matched[name] || ok
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sinks := []Sink{}
+	for _, name := range r.names {
+		if !routed[name] || matched[name] {
+			sinks = append(sinks, r.sinks[name])
+		}
+	}
+	return sinks
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(" env=prod, type=mysql : pagerduty,slack ; target=*:3306/*:audit;*:kafka;")
+	if err != nil {
+		t.Fatalf("ParseRoutes() error = %v", err)
+	}
+	want := []Route{
+		{Match: map[string]string{"env": "prod", "type": "mysql"}, Sinks: []string{"pagerduty", "slack"}},
+		{Match: map[string]string{"target": "*:3306/*"}, Sinks: []string{"audit"}},
+		{Match: map[string]string{}, Sinks: []string{"kafka"}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("ParseRoutes() = %+v, want %+v", routes, want)
+	}
+
+	for spec, wantErr := range map[string]string{
+		"env=prod":         "must be labels:sinks",
+		"env:slack":        "must be name=pattern",
+		"env=[prod:slack":  "invalid pattern",
+		"env=prod:email":   `unknown sink "email"`,
+		"env=prod:slack,":  `unknown sink ""`,
+		"=prod:pagerduty":  "must be name=pattern",
+		"*:slack;env=prod": "must be labels:sinks",
+	} {
+		if _, err := ParseRoutes(spec); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("ParseRoutes(%q) error = %v, want %q", spec, err, wantErr)
+		}
+	}
+}
+
+// sinkFunc records the targets it observes.
+type sinkFunc func(target types.Target)
+
+func (f sinkFunc) Observe(ctx context.Context, target types.Target, result types.Result) {
+	f(target)
+}
+
+func TestRouter(t *testing.T) {
+	routes, err := ParseRoutes("env=prod,severity=critical:pagerduty;env=prod:slack;env=staging:slack;host=legacy-*:slack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(routes)
+	observed := map[string][]string{}
+	for _, name := range []string{"pagerduty", "slack", "audit"} {
+		router.Add(name, sinkFunc(func(target types.Target) {
+			observed[name] = append(observed[name], target.Database)
+		}))
+	}
+	if err := router.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	for _, target := range []types.Target{
+		{Type: "mysql", Host: "orders-db", Database: "orders", Labels: map[string]string{"env": "prod"}},
+		{Type: "mysql", Host: "analytics-db", Database: "analytics", Labels: map[string]string{"env": "prod"}, Severity: "warning"},
+		{Type: "mysql", Host: "orders-db.staging", Database: "orders-staging", Labels: map[string]string{"env": "staging"}},
+		{Type: "redis", Host: "legacy-cache", Database: "0"},
+		{Type: "mock", Host: "mock", Database: "unlabelled"},
+		// The built in labels cannot be overridden.
+		{Type: "mysql", Host: "reports-db", Database: "reports", Labels: map[string]string{"env": "dev", "host": "legacy-reports"}},
+	} {
+		router.Observe(context.Background(), target, types.Result{Success: true})
+	}
+
+	want := map[string][]string{
+		"pagerduty": {"orders"},
+		"slack":     {"orders", "analytics", "orders-staging", "0"},
+		"audit":     {"orders", "analytics", "orders-staging", "0", "unlabelled", "reports"},
+	}
+	if !reflect.DeepEqual(observed, want) {
+		t.Errorf("observed %v, want %v", observed, want)
+	}
+}
+
+func TestRouterValidate(t *testing.T) {
+	routes, err := ParseRoutes("env=prod:pagerduty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(routes)
+	router.Add("slack", sinkFunc(func(types.Target) {}))
+	if err := router.Validate(); err == nil || !strings.Contains(err.Error(), "sink pagerduty is not configured") {
+		t.Errorf("Validate() error = %v, want pagerduty not configured", err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package progress shows a live view of a one-shot check in a terminal: one
+// line per database with its attempt counter and a countdown to the next
+// retry, redrawn in place instead of scrolling retry lines. Anything else the
+// checker prints while the view is shown is written above it.
+package progress
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/message"
+)
+
+// Escape sequences: move the cursor up a line and clear the line.
+const (
+	up    = "\x1b[1A"
+	clear = "\r\x1b[2K"
+)
+
+// View is the live view of the targets of one check. It is a
+// mysqlcheck.AttemptLogger and safe for concurrent use.
+type View struct {
+	out   io.Writer
+	width int
+	clock clock.Clock
+
+	mu    sync.Mutex
+	order []string
+	rows  map[string]*row
+	drawn int
+
+	stop    chan struct{}
+	done    sync.WaitGroup
+	restore func()
+}
+
+type row struct {
+	attempt, tries int
+	problem        string
+	retryAt        time.Time
+	finished       bool
+}
+
+// New returns a view drawn on out, a terminal width columns wide; lines
+// longer than width are cut so that redrawing stays in place. targets are
+// shown in order before their first attempt.
+func New(out io.Writer, width int, targets []string) *View {
+	v := &View{out: out, width: width, clock: clock.Real, rows: map[string]*row{}, stop: make(chan struct{})}
+	for _, target := range targets {
+		v.row(target)
+	}
+	return v
+}
+
+// row returns the row of target, adding it if needed; v.mu must be held.
+func (v *View) row(target string) *row {
+	r, ok := v.rows[target]
+	if !ok {
+		r = &row{}
+		v.rows[target] = r
+		v.order = append(v.order, target)
+	}
+	return r
+}
+
+// Log updates the row of the target of one attempt.
+func (v *View) Log(fields message.Fields) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	r := v.row(fields.Target)
+	r.attempt, r.tries = fields.Attempt, fields.Tries
+	r.problem = ""
+	if fields.Error != "" {
+		r.problem = fields.Reason + ": " + fields.Error
+	}
+	r.retryAt = time.Time{}
+	r.finished = fields.Error == "" || fields.Sleep == 0 || fields.Attempt >= fields.Tries
+	if !r.finished {
+		r.retryAt = v.clock.Now().Add(fields.Sleep)
+	}
+	v.redraw("")
+}
+
+// Start shows the view and redraws it every second until Stop. Until then
+// os.Stdout and os.Stderr are replaced by pipes whose lines are printed
+// above the view.
+func (v *View) Start() {
+	stdout, stderr := os.Stdout, os.Stderr
+	restoreOut := v.capture(&os.Stdout)
+	restoreErr := v.capture(&os.Stderr)
+	v.restore = func() {
+		restoreOut()
+		restoreErr()
+		os.Stdout, os.Stderr = stdout, stderr
+	}
+
+	v.mu.Lock()
+	v.redraw("")
+	v.mu.Unlock()
+
+	ticker := v.clock.NewTicker(time.Second)
+	v.done.Add(1)
+	go func() {
+		defer v.done.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-v.stop:
+				return
+			case <-ticker.C():
+				v.mu.Lock()
+				v.redraw("")
+				v.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// capture points *file at a pipe and prints its lines above the view. The
+// returned function closes the pipe and waits for the last line.
+func (v *View) capture(file **os.File) func() {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return func() {}
+	}
+	*file = w
+
+	var done sync.WaitGroup
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			v.mu.Lock()
+			v.redraw(scanner.Text())
+			v.mu.Unlock()
+		}
+		r.Close()
+	}()
+	return func() {
+		w.Close()
+		done.Wait()
+	}
+}
+
+// Stop draws the final state of the view and restores os.Stdout and
+// os.Stderr.
+func (v *View) Stop() {
+	close(v.stop)
+	v.done.Wait()
+	if v.restore != nil {
+		v.restore()
+	}
+	v.mu.Lock()
+	v.redraw("")
+	v.mu.Unlock()
+}
+
+// redraw clears the view, prints line above it if not empty and draws the
+// view again; v.mu must be held.
+func (v *View) redraw(line string) {
+	var b strings.Builder
+	b.WriteString(strings.Repeat(clear+up, v.drawn))
+	b.WriteString(clear)
+	if line != "" {
+		b.WriteString(line + "\n")
+	}
+
+	nameWidth := 0
+	for _, target := range v.order {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(target))
+	}
+	now := v.clock.Now()
+	for _, target := range v.order {
+		b.WriteString(v.cut(fmt.Sprintf("%-*s  %s", nameWidth, target, v.rows[target].status(now))))
+		b.WriteString("\n")
+	}
+	v.drawn = len(v.order)
+	io.WriteString(v.out, b.String())
+}
+
+// status describes r at now, e.g. "attempt 3/10, retry in 4s: timeout: ...".
+func (r *row) status(now time.Time) string {
+	switch {
+	case r.attempt == 0:
+		return "connecting..."
+	case r.finished && r.problem == "":
+		return fmt.Sprintf("attempt %d/%d, done", r.attempt, r.tries)
+	case r.finished:
+		return fmt.Sprintf("attempt %d/%d, failed: %s", r.attempt, r.tries, r.problem)
+	case now.Before(r.retryAt):
+		wait := r.retryAt.Sub(now).Round(time.Second)
+		return fmt.Sprintf("attempt %d/%d, retry in %v: %s", r.attempt, r.tries, max(wait, time.Second), r.problem)
+	default:
+		return fmt.Sprintf("attempt %d/%d, retrying...: %s", r.attempt+1, r.tries, r.problem)
+	}
+}
+
+// cut shortens line to the terminal width.
+func (v *View) cut(line string) string {
+	if v.width <= 0 || utf8.RuneCountInString(line) <= v.width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:v.width-1]) + "…"
+}
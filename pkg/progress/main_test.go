@@ -0,0 +1,129 @@
+package progress
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/message"
+)
+
+// screen returns the lines of the last drawing of the view in out.
+func screen(out string) []string {
+	last := out[strings.LastIndex(out, clear)+len(clear):]
+	return strings.Split(strings.TrimSuffix(last, "\n"), "\n")
+}
+
+func TestViewLog(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name    string
+		fields  []message.Fields
+		advance time.Duration
+		want    []string
+	}{
+		{
+			name: "before the first attempt",
+			want: []string{"mysql db:3306/app      connecting...", "mongodb mongo:27017/x  connecting..."},
+		},
+		{
+			name:   "waiting for a retry",
+			fields: []message.Fields{{Target: "mysql db:3306/app", Attempt: 2, Tries: 10, Error: "i/o timeout", Reason: "timeout", Sleep: 4 * time.Second}},
+			want:   []string{"mysql db:3306/app      attempt 2/10, retry in 4s: timeout: i/o timeout", "mongodb mongo:27017/x  connecting..."},
+		},
+		{
+			name:    "countdown elapsed",
+			fields:  []message.Fields{{Target: "mysql db:3306/app", Attempt: 2, Tries: 10, Error: "i/o timeout", Reason: "timeout", Sleep: 4 * time.Second}},
+			advance: 5 * time.Second,
+			want:    []string{"mysql db:3306/app      attempt 3/10, retrying...: timeout: i/o timeout", "mongodb mongo:27017/x  connecting..."},
+		},
+		{
+			name: "done and failed",
+			fields: []message.Fields{
+				{Target: "mysql db:3306/app", Attempt: 3, Tries: 10},
+				{Target: "mongodb mongo:27017/x", Attempt: 1, Tries: 10, Error: "auth failed", Reason: "auth error"},
+			},
+			want: []string{"mysql db:3306/app      attempt 3/10, done", "mongodb mongo:27017/x  attempt 1/10, failed: auth error: auth failed"},
+		},
+		{
+			name:   "last attempt failed",
+			fields: []message.Fields{{Target: "mysql db:3306/app", Attempt: 10, Tries: 10, Error: "i/o timeout", Reason: "timeout", Sleep: 4 * time.Second}},
+			want:   []string{"mysql db:3306/app      attempt 10/10, failed: timeout: i/o timeout", "mongodb mongo:27017/x  connecting..."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			v := New(&out, 0, []string{"mysql db:3306/app", "mongodb mongo:27017/x"})
+			v.clock = fake
+			for _, fields := range tt.fields {
+				v.Log(fields)
+			}
+			fake.Advance(tt.advance)
+			v.mu.Lock()
+			v.redraw("")
+			v.mu.Unlock()
+
+			got := screen(out.String())
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("view =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestViewRedrawsInPlace(t *testing.T) {
+	var out strings.Builder
+	v := New(&out, 20, []string{"mysql orders-db:3306/orders"})
+	v.mu.Lock()
+	v.redraw("")
+	v.redraw("Connect success")
+	v.mu.Unlock()
+
+	// The second drawing erases the first one, prints the line above the
+	// view and draws it again, cut to the width.
+	want := clear + "mysql orders-db:330…\n" +
+		clear + up + clear + "Connect success\nmysql orders-db:330…\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestViewCapturesOutput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stdout := os.Stdout
+
+	v := New(w, 0, []string{"mysql db:3306/app"})
+	v.Start()
+	fmt.Println("Connect success")
+	fmt.Fprintln(os.Stderr, "Warning: slow")
+	v.Stop()
+	w.Close()
+
+	if os.Stdout != stdout {
+		t.Error("Stop() did not restore os.Stdout")
+	}
+	var b strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		b.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	for _, line := range []string{"Connect success\n", "Warning: slow\n", "mysql db:3306/app  connecting...\n"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("output %q does not contain %q", b.String(), line)
+		}
+	}
+}
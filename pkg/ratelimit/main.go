@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// The limiter is shared by every connection attempt of the process, across
+// all targets, database types and retries, so that the checker can never
+// become a connection storm against a shared database cluster.
+var (
+	mu      sync.RWMutex
+	limiter *rate.Limiter
+)
+
+// Configure limits connection attempts to perSecond on average with bursts
+// of up to burst attempts. perSecond <= 0 removes the limit.
+func Configure(perSecond float64, burst int) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if perSecond <= 0 {
+		limiter = nil
+		return
+	}
+	limiter = rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+}
+
+// Wait blocks until another connection attempt is allowed or ctx is done.
+func Wait(ctx context.Context) error {
+	mu.RLock()
+	l := limiter
+	mu.RUnlock()
+
+	if l == nil {
+		return nil
+	}
+	return l.Wait(ctx)
+}
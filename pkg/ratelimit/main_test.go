@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		perSecond float64
+		burst     int
+		attempts  int
+		wantMin   time.Duration
+	}{
+		{name: "unlimited", perSecond: 0, attempts: 100, wantMin: 0},
+		{name: "burst passes immediately", perSecond: 10, burst: 5, attempts: 5, wantMin: 0},
+		{name: "attempts beyond burst are delayed", perSecond: 20, burst: 1, attempts: 5, wantMin: 150 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(tt.perSecond, tt.burst)
+			defer Configure(0, 0)
+
+			start := time.Now()
+			for i := 0; i < tt.attempts; i++ {
+				if err := Wait(context.Background()); err != nil {
+					t.Fatalf("Wait() unexpected error: %v", err)
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed < tt.wantMin {
+				t.Errorf("%d attempts took %v, want at least %v", tt.attempts, elapsed, tt.wantMin)
+			}
+			if tt.wantMin == 0 && elapsed > 100*time.Millisecond {
+				t.Errorf("%d attempts took %v, want no delay", tt.attempts, elapsed)
+			}
+		})
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	Configure(0.001, 1)
+	defer Configure(0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := Wait(ctx); err != nil {
+		t.Fatalf("first Wait() unexpected error: %v", err)
+	}
+	cancel()
+	if err := Wait(ctx); err == nil {
+		t.Error("Wait() with cancelled context expected error but got none")
+	}
+}
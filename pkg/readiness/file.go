@@ -0,0 +1,57 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File keeps a file present while all databases are reachable and removes it
+// otherwise, for exec probes and sidecars that cannot use HTTP.
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Report creates or removes the file. The file is written atomically and
+// holds the time of the last successful check, so a consumer can also
+// detect a stuck checker by its age.
+func (f *File) Report(ctx context.Context, result Result) error {
+	if !result.Ready {
+		return f.Remove()
+	}
+
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write readiness file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := fmt.Fprintf(tmp, "%s\n", time.Now().UTC().Format(time.RFC3339)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write readiness file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write readiness file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("cannot write readiness file: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the file if it exists.
+func (f *File) Remove() error {
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove readiness file: %w", err)
+	}
+	return nil
+}
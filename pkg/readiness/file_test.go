@@ -0,0 +1,46 @@
+package readiness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db-ok")
+	file := NewFile(path)
+	ctx := context.Background()
+
+	steps := []struct {
+		name       string
+		result     Result
+		wantExists bool
+	}{
+		{name: "not ready before the file exists", result: Result{Ready: false}, wantExists: false},
+		{name: "ready creates the file", result: Result{Ready: true}, wantExists: true},
+		{name: "ready again keeps the file", result: Result{Ready: true}, wantExists: true},
+		{name: "not ready removes the file", result: Result{Ready: false}, wantExists: false},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := file.Report(ctx, step.result); err != nil {
+				t.Fatalf("Report() unexpected error: %v", err)
+			}
+			_, err := os.Stat(path)
+			if exists := err == nil; exists != step.wantExists {
+				t.Errorf("file exists = %v, want %v", exists, step.wantExists)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,120 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/wait"
+)
+
+// Result is the combined state of all targets after one round of checks.
+type Result struct {
+	Ready bool
+	// Failing maps the names of unreachable targets to the error reason.
+	Failing map[string]string
+}
+
+// Message is a one line summary of the result, e.g. for a pod condition.
+func (r Result) Message() string {
+	if r.Ready {
+		return "all databases are reachable"
+	}
+	names := make([]string, 0, len(r.Failing))
+	for name := range r.Failing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, r.Failing[name]))
+	}
+	return "unreachable: " + strings.Join(parts, ", ")
+}
+
+// Reporter publishes a result, e.g. to a pod condition or a file.
+type Reporter interface {
+	Report(ctx context.Context, result Result) error
+}
+
+// ReporterFunc adapts a function to the Reporter interface.
+type ReporterFunc func(ctx context.Context, result Result) error
+
+func (f ReporterFunc) Report(ctx context.Context, result Result) error {
+	return f(ctx, result)
+}
+
+// Reporters passes a result to every reporter and joins their errors.
+type Reporters []Reporter
+
+func (r Reporters) Report(ctx context.Context, result Result) error {
+	var errs []error
+	for _, reporter := range r {
+		if err := reporter.Report(ctx, result); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckAll runs one attempt for every target concurrently.
+func CheckAll(targets []wait.Target) Result {
+	result := Result{Ready: true, Failing: map[string]string{}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target wait.Target) {
+			defer wg.Done()
+			err := target.Check()
+			if err == nil {
+				return
+			}
+			reason := "error"
+			if target.Reason != nil {
+				reason = target.Reason(err)
+			}
+
+			mu.Lock()
+			result.Ready = false
+			result.Failing[target.Name] = reason
+			mu.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	return result
+}
+
+// Run checks all targets every interval and passes every result to the
+// reporter until ctx is cancelled. Readiness follows the databases for the
+// whole life of the pod, not only at startup.
+func Run(ctx context.Context, targets []wait.Target, interval time.Duration, reporter Reporter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous *Result
+	for {
+		result := CheckAll(targets)
+		if previous == nil || previous.Message() != result.Message() {
+			log.Info("Readiness changed", "ready", result.Ready, "message", result.Message())
+		}
+		previous = &result
+
+		if err := reporter.Report(ctx, result); err != nil {
+			log.Error("Error reporting readiness", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
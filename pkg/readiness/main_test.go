@@ -0,0 +1,66 @@
+package readiness
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/wait"
+)
+
+func TestCheckAll(t *testing.T) {
+	ok := func() error { return nil }
+	fail := func() error { return errors.New("dial tcp: connection refused") }
+	reason := func(error) string { return "connection refused" }
+
+	tests := []struct {
+		name        string
+		targets     []wait.Target
+		wantReady   bool
+		wantMessage string
+	}{
+		{
+			name:        "no targets",
+			wantReady:   true,
+			wantMessage: "all databases are reachable",
+		},
+		{
+			name: "all reachable",
+			targets: []wait.Target{
+				{Name: "mysql a:3306/app", Check: ok},
+				{Name: "mongodb b/app", Check: ok},
+			},
+			wantReady:   true,
+			wantMessage: "all databases are reachable",
+		},
+		{
+			name: "one unreachable",
+			targets: []wait.Target{
+				{Name: "mysql b:3306/app", Check: fail, Reason: reason},
+				{Name: "mysql a:3306/app", Check: ok},
+			},
+			wantReady:   false,
+			wantMessage: "unreachable: mysql b:3306/app: connection refused",
+		},
+		{
+			name: "reasons default to error",
+			targets: []wait.Target{
+				{Name: "mysql b:3306/app", Check: fail},
+				{Name: "mysql a:3306/app", Check: fail, Reason: reason},
+			},
+			wantReady:   false,
+			wantMessage: "unreachable: mysql a:3306/app: connection refused, mysql b:3306/app: error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CheckAll(tt.targets)
+			if result.Ready != tt.wantReady {
+				t.Errorf("CheckAll() Ready = %v, want %v", result.Ready, tt.wantReady)
+			}
+			if result.Message() != tt.wantMessage {
+				t.Errorf("Message() = %q, want %q", result.Message(), tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodGate sets a readiness gate condition on a pod, so that the kubelet only
+// marks the pod Ready while its databases are reachable. The pod must list
+// the condition type in spec.readinessGates.
+type PodGate struct {
+	client        kubernetes.Interface
+	namespace     string
+	pod           string
+	conditionType corev1.PodConditionType
+
+	last         *Result
+	transitioned metav1.Time
+}
+
+func NewPodGate(client kubernetes.Interface, namespace, pod, conditionType string) *PodGate {
+	return &PodGate{
+		client:        client,
+		namespace:     namespace,
+		pod:           pod,
+		conditionType: corev1.PodConditionType(conditionType),
+	}
+}
+
+// Report patches the pod status when the readiness or its message changed
+// since the previous successful patch.
+func (g *PodGate) Report(ctx context.Context, result Result) error {
+	if g.last != nil && g.last.Ready == result.Ready && g.last.Message() == result.Message() {
+		return nil
+	}
+
+	transitioned := g.transitioned
+	if g.last == nil || g.last.Ready != result.Ready {
+		transitioned = metav1.Now()
+	}
+
+	condition := corev1.PodCondition{
+		Type:               g.conditionType,
+		Status:             corev1.ConditionFalse,
+		Reason:             "DatabasesUnreachable",
+		Message:            result.Message(),
+		LastTransitionTime: transitioned,
+	}
+	if result.Ready {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "DatabasesReachable"
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.PodCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = g.client.CoreV1().Pods(g.namespace).
+		Patch(ctx, g.pod, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("cannot patch pod %s/%s: %w", g.namespace, g.pod, err)
+	}
+	g.last = &result
+	g.transitioned = transitioned
+	return nil
+}
@@ -0,0 +1,73 @@
+package readiness
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPodGateReport(t *testing.T) {
+	const conditionType = "dbcheck.tapclap.com/databases-ready"
+	client := kubefake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-0", Namespace: "shop"},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+		}},
+	})
+	gate := NewPodGate(client, "shop", "app-0", conditionType)
+	ctx := context.Background()
+
+	down := Result{Ready: false, Failing: map[string]string{"mysql a:3306/app": "auth error"}}
+	up := Result{Ready: true, Failing: map[string]string{}}
+
+	steps := []struct {
+		result      Result
+		wantStatus  corev1.ConditionStatus
+		wantPatches int
+	}{
+		{result: down, wantStatus: corev1.ConditionFalse, wantPatches: 1},
+		// Unchanged result does not patch the pod again.
+		{result: down, wantStatus: corev1.ConditionFalse, wantPatches: 1},
+		{result: up, wantStatus: corev1.ConditionTrue, wantPatches: 2},
+	}
+
+	for i, step := range steps {
+		if err := gate.Report(ctx, step.result); err != nil {
+			t.Fatalf("step %d: Report() unexpected error: %v", i, err)
+		}
+
+		patches := 0
+		for _, action := range client.Actions() {
+			if _, ok := action.(k8stesting.PatchAction); ok {
+				patches++
+			}
+		}
+		if patches != step.wantPatches {
+			t.Errorf("step %d: %d patches, want %d", i, patches, step.wantPatches)
+		}
+
+		pod, err := client.CoreV1().Pods("shop").Get(ctx, "app-0", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found *corev1.PodCondition
+		for j := range pod.Status.Conditions {
+			if pod.Status.Conditions[j].Type == conditionType {
+				found = &pod.Status.Conditions[j]
+			}
+		}
+		if found == nil {
+			t.Fatalf("step %d: condition %s not set: %+v", i, conditionType, pod.Status.Conditions)
+		}
+		if found.Status != step.wantStatus {
+			t.Errorf("step %d: condition status = %s, want %s", i, found.Status, step.wantStatus)
+		}
+		if len(pod.Status.Conditions) != 2 {
+			t.Errorf("step %d: other pod conditions were not preserved: %+v", i, pod.Status.Conditions)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package redischeck checks Redis servers with the RESP protocol: it
+// authenticates, selects the database, sends PING and optionally reads INFO
+// to fail while the server is still loading its dataset or, on a replica,
+// while the link to the primary is down.
+package redischeck
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A database
+// index above the databases setting of the server is reported as unknown
+// database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Error is an error reply of the server, e.g. WRONGPASS or LOADING.
+type Error struct {
+	// Code is the first word of the reply, e.g. ERR or NOAUTH.
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("redis error %s: %s", e.Code, e.Message)
+}
+
+// defaultTimeout limits a check: connecting, authenticating, PING and INFO.
+const defaultTimeout = 10 * time.Second
+
+// Check connects to the Redis server of target, authenticates with its User
+// and Pass if set, selects the database index in Database and sends PING.
+// With the info option it then reads INFO and fails while the server is
+// loading or is a replica whose link to the primary is down. The phases are
+// connecting (with AUTH and SELECT), PING and INFO.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	db := 0
+	if target.Database != "" {
+		var err error
+		if db, err = strconv.Atoi(target.Database); err != nil || db < 0 {
+			return newResult(nil, "", retry.Permanent(fmt.Errorf("invalid database index %q", target.Database)))
+		}
+	}
+	tlsConfig, err := targetTLSConfig(target)
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	c, err := connect(ctx, target, tlsConfig, o)
+	if err == nil {
+		defer c.conn.Close()
+		err = c.login(target, db)
+	}
+	phases = append(phases, types.Phase{Name: "connect", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error connecting: %w", err))
+	}
+
+	start = time.Now()
+	reply, err := c.do("PING")
+	phases = append(phases, types.Phase{Name: "ping", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error ping: %w", err))
+	}
+	if reply != "PONG" {
+		return newResult(phases, "", fmt.Errorf("unexpected answer to PING: %q", reply))
+	}
+	if target.Options["info"] != "true" {
+		return newResult(phases, "", nil)
+	}
+
+	start = time.Now()
+	reply, err = c.do("INFO")
+	phases = append(phases, types.Phase{Name: "info", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error info: %w", err))
+	}
+	info := parseInfo(reply)
+	return newResult(phases, info["redis_version"], checkInfo(info))
+}
+
+// checkInfo returns an error while the server loads its dataset from disk or
+// is a replica without a working link to its primary. Both usually end by
+// themselves, so the errors are retryable.
+func checkInfo(info map[string]string) error {
+	if info["loading"] == "1" {
+		return errors.New("server is loading the dataset into memory")
+	}
+	if info["role"] == "slave" && info["master_link_status"] != "up" {
+		return fmt.Errorf("replica link to the primary %s:%s is %s", info["master_host"], info["master_port"], info["master_link_status"])
+	}
+	return nil
+}
+
+// parseInfo returns the fields of an INFO reply.
+func parseInfo(reply string) map[string]string {
+	info := map[string]string{}
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, found := strings.Cut(line, ":"); found {
+			info[name] = value
+		}
+	}
+	return info
+}
+
+// targetTLSConfig returns the TLS config of target: its TLSConfig, or one
+// trusting the CA bundle of TLSCAFile, or the system roots if neither is set.
+func targetTLSConfig(target types.Target) (*tls.Config, error) {
+	if !target.TLS {
+		return nil, nil
+	}
+	if target.TLSConfig != nil {
+		return target.TLSConfig.Clone(), nil
+	}
+	config := &tls.Config{ServerName: target.Host}
+	if target.TLSCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return config, nil
+}
+
+// client sends commands over one connection.
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connect opens a connection to target, with TLS if tlsConfig is set. The
+// deadline of ctx applies to every command.
+func connect(ctx context.Context, target types.Target, tlsConfig *tls.Config, o checkbase.Options) (*client, error) {
+	conn, err := o.Dial(ctx, "tcp", net.JoinHostPort(target.Host, target.Port))
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = target.Host
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return &client{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// login authenticates, with an ACL user if one is set, and selects db.
+func (c *client) login(target types.Target, db int) error {
+	if target.Pass != "" {
+		args := []string{"AUTH", target.Pass}
+		if target.User != "" {
+			args = []string{"AUTH", target.User, target.Pass}
+		}
+		if _, err := c.do(args...); err != nil {
+			return err
+		}
+	}
+	if db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(db)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a command and returns its reply, a simple or bulk string.
+func (c *client) do(args ...string) (string, error) {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return "", err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		code, message, _ := strings.Cut(line[1:], " ")
+		return "", &Error{Code: code, Message: message}
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < -1 || size > 1<<20 {
+			return "", fmt.Errorf("invalid reply %q", line)
+		}
+		if size == -1 {
+			return "", nil
+		}
+		content := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, content); err != nil {
+			return "", err
+		}
+		return string(content[:size]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	return checkbase.Result(phases, version, err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "unknown database".
+func ErrorReason(err error) string {
+	var redisErr *Error
+	if errors.As(err, &redisErr) {
+		switch {
+		case redisErr.Code == "WRONGPASS" || redisErr.Code == "NOAUTH" || redisErr.Code == "NOPERM":
+			return "auth error"
+		case redisErr.Code == "ERR" && strings.Contains(redisErr.Message, "AUTH"):
+			// AUTH without a password configured on the server.
+			return "auth error"
+		case redisErr.Code == "ERR" && strings.Contains(redisErr.Message, "DB index"):
+			return "unknown database"
+		}
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures, database indexes out of range and invalid configs are not
+// retryable; a server still loading its dataset is.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
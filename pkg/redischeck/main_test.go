@@ -0,0 +1,331 @@
+package redischeck
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeRedis answers like a Redis server with 16 databases whose default user
+// has the password secret. info is the reply to INFO.
+func fakeRedis(t *testing.T, info string) types.Target {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveRedis(conn, info)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return types.RedisConfig{Addr: net.JoinHostPort(host, port), Password: "secret", Info: true}.Target()
+}
+
+func serveRedis(conn net.Conn, info string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		var reply string
+		switch command := strings.ToUpper(args[0]); {
+		case command == "AUTH" && args[len(args)-1] == "secret" && (len(args) == 2 || args[1] == "default"):
+			authenticated = true
+			reply = "+OK\r\n"
+		case command == "AUTH":
+			reply = "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case command == "SELECT":
+			if db, _ := strconv.Atoi(args[1]); db >= 16 {
+				reply = "-ERR DB index is out of range\r\n"
+			} else {
+				reply = "+OK\r\n"
+			}
+		case command == "PING":
+			reply = "+PONG\r\n"
+		case command == "INFO":
+			reply = fmt.Sprintf("$%d\r\n%s\r\n", len(info), info)
+		default:
+			reply = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestCheck(t *testing.T) {
+	const primary = "# Server\r\nredis_version:7.2.4\r\n\r\n# Persistence\r\nloading:0\r\n\r\n# Replication\r\nrole:master\r\n"
+	tests := []struct {
+		name       string
+		info       string
+		modify     func(target *types.Target)
+		wantReason string
+		wantPhases []string
+	}{
+		{
+			name:       "ping and info",
+			info:       primary,
+			modify:     func(target *types.Target) {},
+			wantPhases: []string{"connect", "ping", "info"},
+		},
+		{
+			name:       "ping only",
+			modify:     func(target *types.Target) { target.Options["info"] = "false" },
+			wantPhases: []string{"connect", "ping"},
+		},
+		{
+			name:       "acl user and database",
+			info:       primary,
+			modify:     func(target *types.Target) { target.User, target.Database = "default", "15" },
+			wantPhases: []string{"connect", "ping", "info"},
+		},
+		{
+			name:       "loading",
+			info:       "# Server\r\nredis_version:7.2.4\r\n# Persistence\r\nloading:1\r\n",
+			modify:     func(target *types.Target) {},
+			wantReason: "error",
+			wantPhases: []string{"connect", "ping", "info"},
+		},
+		{
+			name:       "replica link down",
+			info:       "# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6379\r\nmaster_link_status:down\r\n",
+			modify:     func(target *types.Target) {},
+			wantReason: "error",
+			wantPhases: []string{"connect", "ping", "info"},
+		},
+		{
+			name:       "wrong password",
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "no password",
+			modify:     func(target *types.Target) { target.Pass = "" },
+			wantReason: "auth error",
+			wantPhases: []string{"connect", "ping"},
+		},
+		{
+			name:       "database out of range",
+			modify:     func(target *types.Target) { target.Database = "16" },
+			wantReason: "unknown database",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "invalid database",
+			modify:     func(target *types.Target) { target.Database = "cache" },
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeRedis(t, tt.info)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if retryable := tt.wantReason == "error"; tt.wantReason != "" && Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if tt.wantReason == "" && tt.info != "" && result.ServerVersion != "7.2.4" {
+				t.Errorf("ServerVersion = %q", result.ServerVersion)
+			}
+		})
+	}
+}
+
+// scriptedRedis answers the commands of one check with replies in order and
+// then closes the connection. An empty reply is never sent, so the check
+// times out waiting for it. With refused,
+// nothing listens on the returned address.
+func scriptedRedis(t *testing.T, refused bool, replies []string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	if refused {
+		listener.Close()
+		return addr
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for _, reply := range replies {
+			if _, err := readCommand(reader); err != nil {
+				return
+			}
+			if reply == "" {
+				// Wait for the check to give up.
+				io.Copy(io.Discard, reader)
+				return
+			}
+			if _, err := io.WriteString(conn, reply); err != nil {
+				return
+			}
+		}
+		// Only half-close, so that the check reads EOF rather than a reset.
+		conn.(*net.TCPConn).CloseWrite()
+		io.Copy(io.Discard, reader)
+	}()
+	return addr
+}
+
+func TestCheckProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		refused    bool
+		replies    []string
+		wantReason string
+		wantErr    string
+		wantPhases []string
+	}{
+		{
+			name:       "connection refused",
+			refused:    true,
+			wantReason: "connection refused",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "closed before AUTH reply",
+			wantReason: "error",
+			wantErr:    "EOF",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "not a RESP reply",
+			replies:    []string{"HTTP/1.1 400 Bad Request\r\n"},
+			wantReason: "error",
+			wantErr:    "unexpected reply",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "empty reply",
+			replies:    []string{"\r\n"},
+			wantReason: "error",
+			wantErr:    "empty reply",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "AUTH without a server password",
+			replies:    []string{"-ERR AUTH <password> called without any password configured for the default user.\r\n"},
+			wantReason: "auth error",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "unexpected PING answer",
+			replies:    []string{"+OK\r\n", "+HELLO\r\n"},
+			wantReason: "error",
+			wantErr:    `unexpected answer to PING: "HELLO"`,
+			wantPhases: []string{"connect", "ping"},
+		},
+		{
+			name:       "invalid bulk length",
+			replies:    []string{"+OK\r\n", "+PONG\r\n", "$many\r\n"},
+			wantReason: "error",
+			wantErr:    "invalid reply",
+			wantPhases: []string{"connect", "ping", "info"},
+		},
+		{
+			name:       "truncated INFO",
+			replies:    []string{"+OK\r\n", "+PONG\r\n", "$100\r\nredis_version:7.2.4\r\n"},
+			wantReason: "error",
+			wantErr:    "EOF",
+			wantPhases: []string{"connect", "ping", "info"},
+		},
+		{
+			name:       "no answer",
+			replies:    []string{""},
+			wantReason: "timeout",
+			wantPhases: []string{"connect"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := types.RedisConfig{Addr: scriptedRedis(t, tt.refused, tt.replies), Password: "secret", Info: true}.Target()
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(time.Second))
+			if result.Success || result.Reason != tt.wantReason {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want it to mention %q", result.Err, tt.wantErr)
+			}
+			if retryable := tt.wantReason != "auth error"; Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
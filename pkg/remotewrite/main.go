@@ -0,0 +1,195 @@
+// Package remotewrite pushes metrics with the Prometheus remote write
+// protocol (version 1.0) to Mimir, VictoriaMetrics, Thanos Receive or
+// Prometheus itself, for sites without a Prometheus that could scrape the
+// exporter.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+)
+
+// Pusher sends the metrics of a gatherer to a remote write endpoint.
+type Pusher struct {
+	url      string
+	gatherer prometheus.Gatherer
+	client   *http.Client
+
+	// BearerToken, if set, is sent in the Authorization header. Basic auth
+	// credentials can be given in the URL instead.
+	BearerToken string
+	// Tenant, if set, is sent as X-Scope-OrgID, the tenant header of Mimir,
+	// Cortex and Thanos Receive.
+	Tenant string
+}
+
+// New returns a pusher of the metrics of gatherer to url. Every push may
+// take up to timeout.
+func New(url string, gatherer prometheus.Gatherer, timeout time.Duration) *Pusher {
+	return &Pusher{url: url, gatherer: gatherer, client: &http.Client{Timeout: timeout}}
+}
+
+// Run pushes the metrics every interval until ctx is done. Failed pushes are
+// logged; their samples are not resent, the next push has current values.
+func (p *Pusher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Push(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Error("Error pushing metrics with remote write", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push gathers the metrics and sends them with timestamp now.
+func (p *Pusher) Push(ctx context.Context, now time.Time) error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("remote write: gathering metrics: %v", err)
+	}
+	body := snappy.Encode(nil, EncodeWriteRequest(Series(families), now))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("remote write: %v", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "db-connect-checker")
+	if p.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	}
+	if p.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", p.Tenant)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote write: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Label is a label of a time series.
+type Label struct {
+	Name, Value string
+}
+
+// TimeSeries is one sample of a series, labels sorted by name and including
+// __name__.
+type TimeSeries struct {
+	Labels []Label
+	Value  float64
+}
+
+// Series flattens metric families into time series the way Prometheus
+// stores scraped metrics: histograms become _bucket, _sum and _count series,
+// summaries quantile, _sum and _count series.
+func Series(families []*dto.MetricFamily) []TimeSeries {
+	series := []TimeSeries{}
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			add := func(suffix string, value float64, extra ...Label) {
+				labels := []Label{{Name: "__name__", Value: name + suffix}}
+				for _, pair := range metric.GetLabel() {
+					labels = append(labels, Label{Name: pair.GetName(), Value: pair.GetValue()})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+				series = append(series, TimeSeries{Labels: labels, Value: value})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_GAUGE:
+				add("", metric.GetGauge().GetValue())
+			case dto.MetricType_COUNTER:
+				add("", metric.GetCounter().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					add("_bucket", float64(bucket.GetCumulativeCount()), Label{Name: "le", Value: formatFloat(bucket.GetUpperBound())})
+				}
+				add("_bucket", float64(histogram.GetSampleCount()), Label{Name: "le", Value: "+Inf"})
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add("", quantile.GetValue(), Label{Name: "quantile", Value: formatFloat(quantile.GetQuantile())})
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprint(f)
+}
+
+// EncodeWriteRequest encodes series as a prometheus.WriteRequest protobuf
+// message with one sample per series at now:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func EncodeWriteRequest(series []TimeSeries, now time.Time) []byte {
+	var request []byte
+	for _, s := range series {
+		var ts []byte
+		for _, label := range s.Labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label.Name)
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label.Value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(now.UnixMilli()))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, ts)
+	}
+	return request
+}
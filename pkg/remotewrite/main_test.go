@@ -0,0 +1,139 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decode parses a WriteRequest back into series and their timestamps.
+func decode(t *testing.T, data []byte) ([]TimeSeries, []int64) {
+	t.Helper()
+	series := []TimeSeries{}
+	timestamps := []int64{}
+	for _, ts := range fields(t, data, 1) {
+		s := TimeSeries{}
+		for _, l := range fields(t, ts, 1) {
+			name, value := fields(t, l, 1), fields(t, l, 2)
+			s.Labels = append(s.Labels, Label{Name: string(name[0]), Value: string(value[0])})
+		}
+		sample := fields(t, ts, 2)[0]
+		num, _, n := protowire.ConsumeTag(sample)
+		if num != 1 {
+			t.Fatalf("sample field %d, want 1", num)
+		}
+		bits, m := protowire.ConsumeFixed64(sample[n:])
+		s.Value = math.Float64frombits(bits)
+		_, _, k := protowire.ConsumeTag(sample[n+m:])
+		ms, _ := protowire.ConsumeVarint(sample[n+m+k:])
+		series = append(series, s)
+		timestamps = append(timestamps, int64(ms))
+	}
+	return series, timestamps
+}
+
+// fields returns the length-delimited fields number num of message data.
+func fields(t *testing.T, data []byte, num protowire.Number) [][]byte {
+	t.Helper()
+	values := [][]byte{}
+	for len(data) > 0 {
+		n, typ, l := protowire.ConsumeTag(data)
+		if l < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(l))
+		}
+		data = data[l:]
+		if typ != protowire.BytesType {
+			l = protowire.ConsumeFieldValue(n, typ, data)
+			data = data[l:]
+			continue
+		}
+		value, l := protowire.ConsumeBytes(data)
+		data = data[l:]
+		if n == num {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func TestPush(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	available := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "mysql_connection_available"}, []string{"target"})
+	available.WithLabelValues("db:3306/app").Set(1)
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "check_seconds", Buckets: []float64{0.1, 1}})
+	duration.Observe(0.5)
+	registry.MustRegister(available, duration)
+
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		compressed, _ := io.ReadAll(r.Body)
+		var err error
+		if body, err = snappy.Decode(nil, compressed); err != nil {
+			t.Errorf("body is not snappy compressed: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := New(server.URL, registry, time.Second)
+	p.BearerToken, p.Tenant = "token", "edge-1"
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := p.Push(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer token",
+		"X-Scope-Orgid":                     "edge-1",
+	}
+	for name, want := range headers {
+		if value := got.Header.Get(name); value != want {
+			t.Errorf("header %s = %q, want %q", name, value, want)
+		}
+	}
+
+	series, timestamps := decode(t, body)
+	want := []TimeSeries{
+		{Labels: []Label{{"__name__", "check_seconds_bucket"}, {"le", "0.1"}}, Value: 0},
+		{Labels: []Label{{"__name__", "check_seconds_bucket"}, {"le", "1"}}, Value: 1},
+		{Labels: []Label{{"__name__", "check_seconds_bucket"}, {"le", "+Inf"}}, Value: 1},
+		{Labels: []Label{{"__name__", "check_seconds_sum"}}, Value: 0.5},
+		{Labels: []Label{{"__name__", "check_seconds_count"}}, Value: 1},
+		{Labels: []Label{{"__name__", "mysql_connection_available"}, {"target", "db:3306/app"}}, Value: 1},
+	}
+	if !reflect.DeepEqual(series, want) {
+		t.Errorf("series = %+v, want %+v", series, want)
+	}
+	for _, ts := range timestamps {
+		if ts != now.UnixMilli() {
+			t.Errorf("timestamp = %d, want %d", ts, now.UnixMilli())
+		}
+	}
+}
+
+func TestPushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := New(server.URL, prometheus.NewRegistry(), time.Second).Push(context.Background(), time.Now())
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request: out of order sample") {
+		t.Errorf("Push() error = %v, want the status and message of the response", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Package report collects the outcome of every target of a one-shot check
+// and writes it as one JSON document, so that sibling containers and
+// entrypoint scripts sharing a volume can react to individual targets rather
+// than to the exit code alone, or as annotations of a CI pipeline or a table
+// for the terminal.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Report is the content of the result file.
+type Report struct {
+	// Status is "success" if the process exits with 0, otherwise "failure".
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exit_code"`
+	Finished time.Time `json:"finished"`
+	// WaitFor is the awaited state of the targets, "available" or
+	// "unavailable".
+	WaitFor string         `json:"wait_for"`
+	Targets []TargetReport `json:"targets"`
+}
+
+// TargetReport is the last check of one target.
+type TargetReport struct {
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	// Available reports whether the last attempt reached the database.
+	Available      bool    `json:"available"`
+	Attempts       int     `json:"attempts"`
+	LatencySeconds float64 `json:"latency_seconds"`
+	// Reason and Error describe the failure of the last attempt, with
+	// passwords removed.
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Warnings []string  `json:"warnings,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Collector keeps the last result of every target in the order the targets
+// were first checked. It is a checker.Sink and safe for concurrent use.
+type Collector struct {
+	mu      sync.Mutex
+	order   []string
+	targets map[string]*TargetReport
+}
+
+// NewCollector returns an empty collector.
+func NewCollector() *Collector {
+	return &Collector{targets: map[string]*TargetReport{}}
+}
+
+// Observe records one check result.
+func (c *Collector) Observe(ctx context.Context, target types.Target, result types.Result) {
+	name := target.String()
+	entry := TargetReport{
+		Target:         name,
+		Type:           target.Type,
+		Available:      result.Success,
+		LatencySeconds: result.Duration().Seconds(),
+		Warnings:       result.Warnings,
+		Time:           time.Now().UTC(),
+	}
+	if result.Err != nil {
+		entry.Reason = result.Reason
+		entry.Error = util.Redact(result.Err.Error(), target.Pass)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, seen := c.targets[name]
+	if !seen {
+		c.order = append(c.order, name)
+		last = &TargetReport{}
+		c.targets[name] = last
+	}
+	entry.Attempts = last.Attempts + 1
+	*last = entry
+}
+
+// Report returns the collected results for a process exiting with code.
+func (c *Collector) Report(code int, waitFor string) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := Report{
+		Status:   "success",
+		ExitCode: code,
+		Finished: time.Now().UTC(),
+		WaitFor:  waitFor,
+		Targets:  make([]TargetReport, 0, len(c.order)),
+	}
+	if code != 0 {
+		report.Status = "failure"
+	}
+	for _, name := range c.order {
+		report.Targets = append(report.Targets, *c.targets[name])
+	}
+	return report
+}
+
+// Write stores report at path. The file is written next to path and renamed,
+// so readers never see a partial document.
+func Write(path string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing result file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing result file: %v", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing result file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing result file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing result file: %v", err)
+	}
+	return nil
+}
+
+// WriteAnnotations prints report as GitHub Actions workflow commands: an
+// error per target that did not reach the awaited state and a warning per
+// warning of a check. When the check as a whole succeeded, e.g. because
+// WAIT_FOR_ANY only needs one replica, unreachable targets are warnings.
+func WriteAnnotations(w io.Writer, report Report) {
+	level := "error"
+	if report.ExitCode == 0 {
+		level = "warning"
+	}
+	for _, target := range report.Targets {
+		for _, warning := range target.Warnings {
+			annotate(w, "warning", "DB warning", target.Target+": "+warning)
+		}
+		switch {
+		case report.WaitFor == "unavailable" && target.Available:
+			annotate(w, level, "DB still reachable", target.Target)
+		case report.WaitFor != "unavailable" && !target.Available:
+			annotate(w, level, "DB unreachable", fmt.Sprintf("%s: %s: %s", target.Target, target.Reason, target.Error))
+		}
+	}
+}
+
+func annotate(w io.Writer, level, title, message string) {
+	fmt.Fprintf(w, "::%s title=%s::%s\n", level, escapeProperty(title), escapeData(message))
+}
+
+// escapeData and escapeProperty encode the characters that would end a
+// workflow command early.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// ANSI escape sequences of the table.
+const (
+	green = "\x1b[32m"
+	red   = "\x1b[31m"
+	amber = "\x1b[33m"
+	reset = "\x1b[0m"
+)
+
+// WriteTable prints report as a table with one aligned row per target, for
+// people running the checker in a terminal. color highlights the status of
+// every target.
+func WriteTable(w io.Writer, report Report, color bool) {
+	// The status column has a fixed width and is written in front of the
+	// aligned columns, as tabwriter would count escape sequences as text.
+	var rows strings.Builder
+	tw := tabwriter.NewWriter(&rows, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tATTEMPTS\tLATENCY\tERROR")
+	statuses := []string{"STATUS"}
+	for _, target := range report.Targets {
+		status := "up"
+		if !target.Available {
+			status = "down"
+		}
+		// Green is the awaited state, which is down with WAIT_FOR=unavailable.
+		code := green
+		if target.Available == (report.WaitFor == "unavailable") {
+			code = red
+		} else if len(target.Warnings) > 0 {
+			code = amber
+		}
+		status = fmt.Sprintf("%-6s", status)
+		if color {
+			status = code + status + reset
+		}
+		statuses = append(statuses, status)
+
+		problems := target.Warnings
+		if target.Error != "" {
+			problems = append([]string{target.Reason + ": " + target.Error}, problems...)
+		}
+		latency := time.Duration(target.LatencySeconds * float64(time.Second)).Round(time.Millisecond)
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%s\n", target.Target, target.Attempts, latency, strings.Join(problems, "; "))
+	}
+	tw.Flush()
+
+	for i, row := range strings.SplitAfter(strings.TrimSuffix(rows.String(), "\n"), "\n") {
+		fmt.Fprintf(w, "%s  %s", statuses[i], row)
+	}
+	fmt.Fprintln(w)
+}
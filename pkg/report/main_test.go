@@ -0,0 +1,193 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestCollectorReport(t *testing.T) {
+	orders := types.Target{Type: "mysql", Host: "orders-db", Port: "3306", Database: "orders", Pass: "s3cret"}
+	events := types.Target{Type: "mongodb", Host: "events-db", Port: "27017", Database: "events"}
+
+	c := NewCollector()
+	c.Observe(context.Background(), orders, types.Result{Reason: "auth error", Err: errors.New("access denied with password s3cret")})
+	c.Observe(context.Background(), events, types.Result{Success: true, Phases: []types.Phase{{Name: "connect", Duration: 20 * time.Millisecond}}})
+	c.Observe(context.Background(), orders, types.Result{Reason: "timeout", Err: errors.New("i/o timeout")})
+
+	tests := []struct {
+		name       string
+		code       int
+		wantStatus string
+	}{
+		{name: "success", code: 0, wantStatus: "success"},
+		{name: "failure", code: 2, wantStatus: "failure"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.Report(tt.code, "available")
+			if got.Status != tt.wantStatus || got.ExitCode != tt.code || got.WaitFor != "available" {
+				t.Errorf("Report() = %+v, want status %q and exit code %d", got, tt.wantStatus, tt.code)
+			}
+			if len(got.Targets) != 2 {
+				t.Fatalf("Report() has %d targets, want 2", len(got.Targets))
+			}
+			first, second := got.Targets[0], got.Targets[1]
+			if first.Target != "mysql orders-db:3306/orders" || first.Attempts != 2 || first.Available || first.Reason != "timeout" || first.Error != "i/o timeout" {
+				t.Errorf("first target = %+v, want the last of two failed attempts", first)
+			}
+			if second.Target != "mongodb events-db:27017/events" || second.Attempts != 1 || !second.Available || second.LatencySeconds != 0.02 || second.Error != "" {
+				t.Errorf("second target = %+v, want one successful attempt", second)
+			}
+		})
+	}
+}
+
+func TestCollectorRedactsPassword(t *testing.T) {
+	target := types.Target{Type: "mysql", Host: "db", Port: "3306", Database: "app", Pass: "s3cret"}
+	c := NewCollector()
+	c.Observe(context.Background(), target, types.Result{Reason: "auth error", Err: errors.New("access denied with password s3cret")})
+
+	if got := c.Report(3, "available").Targets[0].Error; got != "access denied with password ****" {
+		t.Errorf("Error = %q, want the password hidden", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db-check.json")
+	os.WriteFile(path, []byte("stale"), 0o644)
+
+	want := Report{Status: "failure", ExitCode: 2, WaitFor: "available", Targets: []TargetReport{{Target: "mysql db:3306/app", Type: "mysql", Attempts: 10, Reason: "timeout"}}}
+	if err := Write(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("result file is not JSON: %v", err)
+	}
+	if got.Status != want.Status || got.ExitCode != want.ExitCode || len(got.Targets) != 1 || got.Targets[0].Reason != "timeout" {
+		t.Errorf("result file = %+v, want %+v", got, want)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d files, want only the result file", len(entries))
+	}
+}
+
+func TestWriteMissingDirectory(t *testing.T) {
+	err := Write(filepath.Join(t.TempDir(), "missing", "db-check.json"), Report{})
+	if err == nil {
+		t.Fatal("Write() into a missing directory succeeded")
+	}
+}
+
+func TestWriteAnnotations(t *testing.T) {
+	orders := TargetReport{Target: "mysql orders-db:3306/orders", Type: "mysql", Reason: "timeout", Error: "dial tcp: i/o timeout"}
+	replica := TargetReport{Target: "mysql replica:3306/orders", Type: "mysql", Available: true, Warnings: []string{"matched 'app'@'%'"}}
+	multiline := TargetReport{Target: "mongodb events-db:27017/events", Type: "mongodb", Reason: "auth error", Error: "auth failed\n100% sure"}
+
+	tests := []struct {
+		name   string
+		report Report
+		want   string
+	}{
+		{
+			name:   "failure",
+			report: Report{ExitCode: 2, WaitFor: "available", Targets: []TargetReport{orders, replica}},
+			want: "::error title=DB unreachable::mysql orders-db:3306/orders: timeout: dial tcp: i/o timeout\n" +
+				"::warning title=DB warning::mysql replica:3306/orders: matched 'app'@'%25'\n",
+		},
+		{
+			name:   "wait for any succeeded",
+			report: Report{ExitCode: 0, WaitFor: "available", Targets: []TargetReport{orders}},
+			want:   "::warning title=DB unreachable::mysql orders-db:3306/orders: timeout: dial tcp: i/o timeout\n",
+		},
+		{
+			name:   "wait for unavailable",
+			report: Report{ExitCode: 2, WaitFor: "unavailable", Targets: []TargetReport{orders, {Target: "mysql old-db:3306/orders", Available: true}}},
+			want:   "::error title=DB still reachable::mysql old-db:3306/orders\n",
+		},
+		{
+			name:   "escaped message",
+			report: Report{ExitCode: 3, WaitFor: "available", Targets: []TargetReport{multiline}},
+			want:   "::error title=DB unreachable::mongodb events-db:27017/events: auth error: auth failed%0A100%25 sure\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			WriteAnnotations(&out, tt.report)
+			if out.String() != tt.want {
+				t.Errorf("WriteAnnotations() =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	up := TargetReport{Target: "mysql orders-db:3306/orders", Available: true, Attempts: 1, LatencySeconds: 0.012}
+	down := TargetReport{Target: "mongodb events:27017/events", Attempts: 10, LatencySeconds: 5.0012, Reason: "timeout", Error: "i/o timeout"}
+	warned := TargetReport{Target: "mysql replica:3306/orders", Available: true, Attempts: 2, Warnings: []string{"unexpected account"}}
+
+	tests := []struct {
+		name   string
+		report Report
+		color  bool
+		want   string
+	}{
+		{
+			name:   "plain",
+			report: Report{WaitFor: "available", Targets: []TargetReport{up, down, warned}},
+			want: "STATUS  TARGET                       ATTEMPTS  LATENCY  ERROR\n" +
+				"up      mysql orders-db:3306/orders  1         12ms     \n" +
+				"down    mongodb events:27017/events  10        5.001s   timeout: i/o timeout\n" +
+				"up      mysql replica:3306/orders    2         0s       unexpected account\n",
+		},
+		{
+			name:   "color",
+			report: Report{WaitFor: "available", Targets: []TargetReport{up, down, warned}},
+			color:  true,
+			want: "STATUS  TARGET                       ATTEMPTS  LATENCY  ERROR\n" +
+				"\x1b[32mup    \x1b[0m  mysql orders-db:3306/orders  1         12ms     \n" +
+				"\x1b[31mdown  \x1b[0m  mongodb events:27017/events  10        5.001s   timeout: i/o timeout\n" +
+				"\x1b[33mup    \x1b[0m  mysql replica:3306/orders    2         0s       unexpected account\n",
+		},
+		{
+			name:   "wait for unavailable",
+			report: Report{WaitFor: "unavailable", Targets: []TargetReport{up, down}},
+			color:  true,
+			want: "STATUS  TARGET                       ATTEMPTS  LATENCY  ERROR\n" +
+				"\x1b[31mup    \x1b[0m  mysql orders-db:3306/orders  1         12ms     \n" +
+				"\x1b[32mdown  \x1b[0m  mongodb events:27017/events  10        5.001s   timeout: i/o timeout\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			WriteTable(&out, tt.report, tt.color)
+			if out.String() != tt.want {
+				t.Errorf("WriteTable() =\n%q\nwant\n%q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Package resolve provides a dialer that looks up the host name of every
+// connection afresh. The system resolver (nscd, systemd-resolved, the cgo
+// resolver of the C library) may serve a cached address for a while after a
+// DNS based failover; checks dialing through this package see the new
+// address on their next attempt.
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Dialer resolves the host of every connection with Go's own resolver, which
+// does not cache, and dials the resolved addresses in order until one
+// answers. It implements the Dialer interfaces of the check packages.
+type Dialer struct {
+	// Server is the host:port of the DNS server to ask; empty uses the
+	// servers of /etc/resolv.conf.
+	Server string
+	// Timeout limits each connection attempt, 0 means no limit beyond the
+	// context.
+	Timeout time.Duration
+	// OnChange, if set, is called when a host resolves to other addresses
+	// than on the previous dial.
+	OnChange func(host string, old, new []string)
+
+	// lookup replaces the resolver in tests.
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	mu   sync.Mutex
+	last map[string][]string
+}
+
+// DialContext resolves the host of address and connects to it.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: d.Timeout}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	d.remember(host, addrs)
+
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+func (d *Dialer) resolve(ctx context.Context, host string) ([]string, error) {
+	if d.lookup != nil {
+		return d.lookup(ctx, host)
+	}
+	resolver := &net.Resolver{PreferGo: true}
+	if d.Server != "" {
+		resolver.Dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, d.Server)
+		}
+	}
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// remember stores the addresses of host and reports a change.
+func (d *Dialer) remember(host string, addrs []string) {
+	sorted := slices.Sorted(slices.Values(addrs))
+
+	d.mu.Lock()
+	if d.last == nil {
+		d.last = map[string][]string{}
+	}
+	old, seen := d.last[host]
+	d.last[host] = sorted
+	d.mu.Unlock()
+
+	if seen && !slices.Equal(old, sorted) && d.OnChange != nil {
+		d.OnChange(host, old, sorted)
+	}
+}
+
+// String describes the dialer for logs.
+func (d *Dialer) String() string {
+	if d.Server == "" {
+		return "fresh DNS lookups"
+	}
+	return fmt.Sprintf("fresh DNS lookups via %s", d.Server)
+}
@@ -0,0 +1,105 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDialContextResolvesEveryDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// The first answer has an address nobody listens on, so the dialer must
+	// fall through to the next one; the second answer only has the listener.
+	answers := [][]string{{"127.0.0.2", "127.0.0.1"}, {"127.0.0.1"}}
+	lookups := 0
+	var changes [][]string
+	d := &Dialer{
+		Timeout: time.Second,
+		lookup: func(ctx context.Context, host string) ([]string, error) {
+			if host != "db.internal" {
+				t.Errorf("lookup(%q)", host)
+			}
+			answer := answers[min(lookups, len(answers)-1)]
+			lookups++
+			return answer, nil
+		},
+		OnChange: func(host string, old, new []string) {
+			changes = append(changes, old, new)
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("db.internal", port))
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		conn.Close()
+	}
+
+	if lookups != 2 {
+		t.Errorf("lookups = %d, want one per dial", lookups)
+	}
+	want := [][]string{{"127.0.0.1", "127.0.0.2"}, {"127.0.0.1"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("OnChange got %v, want %v", changes, want)
+	}
+}
+
+func TestDialContextLookupError(t *testing.T) {
+	lookupErr := &net.DNSError{Err: "no such host", Name: "db.internal", IsNotFound: true}
+	d := &Dialer{lookup: func(ctx context.Context, host string) ([]string, error) {
+		return nil, lookupErr
+	}}
+
+	_, err := d.DialContext(context.Background(), "tcp", "db.internal:3306")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Errorf("DialContext() error = %v, want a *net.DNSError", err)
+	}
+}
+
+func TestDialContextUsesServer(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	queried := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 512)
+		if _, _, err := server.ReadFrom(buf); err == nil {
+			queried <- struct{}{}
+		}
+	}()
+
+	d := &Dialer{Server: server.LocalAddr().String()}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := d.DialContext(ctx, "tcp", "db.internal:3306"); err == nil {
+		t.Fatal("DialContext() without DNS answers succeeded")
+	}
+
+	select {
+	case <-queried:
+	case <-time.After(time.Second):
+		t.Error("DNS server was not queried")
+	}
+}
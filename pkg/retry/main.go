@@ -0,0 +1,202 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+)
+
+// Backoff computes sleep durations between connection attempts:
+// Initial * Multiplier^(attempt-1) + Step * (attempt-1), capped at Max.
+// A zero Multiplier is treated as 1, so {Initial, Step} alone gives a linear
+// sequence. Jitter randomizes the result so that many checkers started at
+// the same time (e.g. pods restarted after a failover) do not retry in
+// lockstep.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Step       time.Duration
+	Jitter     Jitter
+	// Factors multiply the sleep after failures of the given reasons (e.g.
+	// "too many connections"), so an overloaded server gets more time to
+	// recover than an address that refuses connections. The result may
+	// exceed Max.
+	Factors map[string]float64
+}
+
+// Jitter selects how a computed sleep d is randomized.
+type Jitter string
+
+const (
+	// JitterNone keeps d as is.
+	JitterNone Jitter = ""
+	// JitterEqual picks a value in [d/2, d]: keeps a minimum pause while
+	// still spreading retries.
+	JitterEqual Jitter = "equal"
+	// JitterFull picks a value in [0, d]: spreads retries the most.
+	JitterFull Jitter = "full"
+)
+
+// Linear is the historical one-shot sequence: 4s, 7s, 10s, ...
+var Linear = Backoff{Initial: 4 * time.Second, Step: 3 * time.Second}
+
+// WithJitter returns b with the given jitter mode; "" keeps the current one
+// and "none" disables jitter.
+func (b Backoff) WithJitter(mode string) Backoff {
+	switch mode {
+	case "":
+	case "none":
+		b.Jitter = JitterNone
+	default:
+		b.Jitter = Jitter(mode)
+	}
+	return b
+}
+
+// Override returns b with the non-zero fields of the user supplied settings
+// applied. Setting initial or multiplier switches to a plain exponential
+// formula, i.e. drops the linear Step.
+func (b Backoff) Override(initial time.Duration, multiplier float64, max time.Duration) Backoff {
+	if initial > 0 {
+		b.Initial = initial
+		b.Step = 0
+	}
+	if multiplier > 0 {
+		b.Multiplier = multiplier
+		b.Step = 0
+	}
+	if max > 0 {
+		b.Max = max
+	}
+	return b
+}
+
+// Duration returns the sleep before the next attempt after the given
+// (1-based) failed attempt.
+func (b Backoff) Duration(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	d := float64(b.Initial)*math.Pow(multiplier, float64(attempt-1)) + float64(b.Step)*float64(attempt-1)
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+
+	switch b.Jitter {
+	case JitterEqual:
+		half := d / 2
+		d = half + rand.Float64()*half
+	case JitterFull:
+		d = rand.Float64() * d
+	}
+	return time.Duration(d)
+}
+
+// DurationFor returns Duration(attempt) multiplied by the factor of reason,
+// if any.
+func (b Backoff) DurationFor(attempt int, reason string) time.Duration {
+	d := b.Duration(attempt)
+	if factor, ok := b.Factors[reason]; ok {
+		d = time.Duration(float64(d) * factor)
+	}
+	return d
+}
+
+// WithFactors returns b with the given Factors; nil keeps the current ones.
+func (b Backoff) WithFactors(factors map[string]float64) Backoff {
+	if factors != nil {
+		b.Factors = factors
+	}
+	return b
+}
+
+// ParseFactors parses comma separated reason=factor pairs, e.g.
+// "too many connections=4,host blocked=8". "none" gives no factors.
+func ParseFactors(spec string) (map[string]float64, error) {
+	factors := map[string]float64{}
+	if strings.TrimSpace(spec) == "none" {
+		return factors, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		reason, value, ok := strings.Cut(pair, "=")
+		reason = strings.TrimSpace(reason)
+		if !ok || reason == "" {
+			return nil, fmt.Errorf("%q must be reason=factor", pair)
+		}
+		factor, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || factor <= 0 {
+			return nil, fmt.Errorf("factor of %s must be a positive number, got %q", reason, value)
+		}
+		factors[reason] = factor
+	}
+	return factors, nil
+}
+
+// PermanentError wraps an error that another attempt cannot fix, such as
+// wrong credentials, an unknown database or malformed connection settings.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as not worth retrying. It returns nil for a nil err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent reports whether err or any error it wraps was marked with
+// Permanent.
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// ErrBudgetExhausted is returned by Sleep when the deadline of its context
+// passes before the sleep would end, so there is no time left for another
+// attempt.
+var ErrBudgetExhausted = errors.New("budget exhausted")
+
+// Sleep waits d on clk before the next attempt. If the deadline of ctx, e.g.
+// MAX_WAIT, comes before d is over on clk, it returns an error wrapping
+// ErrBudgetExhausted right away instead of sleeping until the deadline. It
+// returns ctx.Err() if ctx is done during the sleep.
+func Sleep(ctx context.Context, clk clock.Clock, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := deadline.Sub(clk.Now()); remaining < d {
+			return fmt.Errorf("%w: next attempt in %v would start after the deadline in %v", ErrBudgetExhausted, d.Round(time.Millisecond), max(remaining, 0).Round(time.Millisecond))
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clk.After(d):
+		return nil
+	}
+}
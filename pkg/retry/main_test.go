@@ -0,0 +1,253 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		attempt  int
+		expected time.Duration
+	}{
+		{
+			name:     "first attempt returns initial",
+			backoff:  Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2},
+			attempt:  1,
+			expected: time.Second,
+		},
+		{
+			name:     "grows exponentially",
+			backoff:  Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2},
+			attempt:  4,
+			expected: 8 * time.Second,
+		},
+		{
+			name:     "capped at max",
+			backoff:  Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2},
+			attempt:  10,
+			expected: 30 * time.Second,
+		},
+		{
+			name:     "zero attempt treated as first",
+			backoff:  Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2},
+			attempt:  0,
+			expected: time.Second,
+		},
+		{
+			name:     "linear sequence",
+			backoff:  Linear,
+			attempt:  3,
+			expected: 10 * time.Second,
+		},
+		{
+			name:     "linear sequence capped",
+			backoff:  Linear.Override(0, 0, 30*time.Second),
+			attempt:  50,
+			expected: 30 * time.Second,
+		},
+		{
+			name:     "override switches linear to exponential",
+			backoff:  Linear.Override(time.Second, 2, 0),
+			attempt:  3,
+			expected: 4 * time.Second,
+		},
+		{
+			name:     "override of multiplier only keeps initial",
+			backoff:  Linear.Override(0, 1.5, 0),
+			attempt:  3,
+			expected: 9 * time.Second,
+		},
+		{
+			name:     "no max means no cap",
+			backoff:  Backoff{Initial: time.Second, Multiplier: 3},
+			attempt:  5,
+			expected: 81 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Duration(tt.attempt); got != tt.expected {
+				t.Errorf("Duration(%d) = %v, want %v", tt.attempt, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBackoffDurationJitter(t *testing.T) {
+	tests := []struct {
+		name    string
+		jitter  Jitter
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "no jitter", jitter: JitterNone, wantMin: 4 * time.Second, wantMax: 4 * time.Second},
+		{name: "equal jitter", jitter: JitterEqual, wantMin: 2 * time.Second, wantMax: 4 * time.Second},
+		{name: "full jitter", jitter: JitterFull, wantMin: 0, wantMax: 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backoff := Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2, Jitter: tt.jitter}
+			for i := 0; i < 100; i++ {
+				got := backoff.Duration(3)
+				if got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("Duration(3) = %v, want value in [%v, %v]", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffWithJitter(t *testing.T) {
+	tests := []struct {
+		mode string
+		base Jitter
+		want Jitter
+	}{
+		{mode: "", base: JitterEqual, want: JitterEqual},
+		{mode: "none", base: JitterEqual, want: JitterNone},
+		{mode: "full", base: JitterNone, want: JitterFull},
+		{mode: "equal", base: JitterFull, want: JitterEqual},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got := Backoff{Jitter: tt.base}.WithJitter(tt.mode).Jitter
+			if got != tt.want {
+				t.Errorf("WithJitter(%q) = %q, want %q", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffDurationFor(t *testing.T) {
+	factors, err := ParseFactors("too many connections=4, auth throttled=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Backoff{Initial: time.Second, Max: 2 * time.Second, Multiplier: 2}.WithFactors(factors)
+
+	tests := []struct {
+		attempt int
+		reason  string
+		want    time.Duration
+	}{
+		{attempt: 1, reason: "connection refused", want: time.Second},
+		{attempt: 1, reason: "too many connections", want: 4 * time.Second},
+		{attempt: 3, reason: "too many connections", want: 8 * time.Second},
+		{attempt: 2, reason: "auth throttled", want: time.Second},
+		{attempt: 2, reason: "", want: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := b.DurationFor(tt.attempt, tt.reason); got != tt.want {
+			t.Errorf("DurationFor(%d, %q) = %v, want %v", tt.attempt, tt.reason, got, tt.want)
+		}
+	}
+
+	if got := b.WithFactors(nil).Factors; len(got) != 2 {
+		t.Errorf("WithFactors(nil) = %v, want the factors kept", got)
+	}
+}
+
+func TestParseFactors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{spec: "", want: map[string]float64{}},
+		{spec: "none", want: map[string]float64{}},
+		{spec: "too many connections=4,host blocked=2.5", want: map[string]float64{"too many connections": 4, "host blocked": 2.5}},
+		{spec: "too many connections", wantErr: true},
+		{spec: "=4", wantErr: true},
+		{spec: "timeout=fast", wantErr: true},
+		{spec: "timeout=0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFactors(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFactors(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFactors(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	base := errors.New("access denied")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "plain error", err: base, want: false},
+		{name: "permanent", err: Permanent(base), want: true},
+		{name: "wrapped permanent", err: fmt.Errorf("[db:3306/app] %w", Permanent(base)), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+	if !errors.Is(Permanent(base), base) {
+		t.Error("Permanent() does not unwrap to the original error")
+	}
+}
+
+func TestSleep(t *testing.T) {
+	// Deadlines of contexts are wall clock times, so the fake starts now.
+	fake := clock.NewFake(time.Now())
+
+	errc := make(chan error, 1)
+	go func() { errc <- Sleep(context.Background(), fake, 4*time.Second) }()
+	fake.BlockUntil(1)
+	fake.Advance(4 * time.Second)
+	if err := <-errc; err != nil {
+		t.Errorf("Sleep() without deadline = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := Sleep(ctx, fake, 2*time.Minute)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Sleep() past the deadline = %v, want ErrBudgetExhausted", err)
+	}
+	if pending := fake.Pending(); len(pending) != 0 {
+		t.Errorf("Sleep() past the deadline left timers %v, want none", pending)
+	}
+
+	// The time left is measured on the clock of the sleep.
+	fake.Advance(50 * time.Second)
+	err = Sleep(ctx, fake, 20*time.Second)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Sleep() past the deadline on the clock = %v, want ErrBudgetExhausted", err)
+	}
+
+	go func() { errc <- Sleep(ctx, fake, time.Second) }()
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("Sleep() cancelled = %v, want context.Canceled", err)
+	}
+}
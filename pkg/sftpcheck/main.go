@@ -0,0 +1,223 @@
+// Package sftpcheck checks SFTP servers: it verifies the host key, logs in
+// with a key or a password and optionally lists a directory, e.g. the drop
+// zone an ingestion service reads from.
+package sftpcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A directory
+// that does not exist is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	// ErrHostKeyMismatch fails checks of servers whose host key is not in
+	// the known hosts file or differs from the expected fingerprint.
+	ErrHostKeyMismatch = util.ErrHostKeyMismatch
+)
+
+// defaultTimeout limits a check: the SSH handshake and listing the directory.
+const defaultTimeout = 10 * time.Second
+
+// Check connects to the SSH server of target, verifies its host key against
+// the host_key fingerprint option or the known_hosts file option and logs in
+// as User with the private key of the key_file option or with Pass. If
+// Database is set, it then lists that directory over SFTP. The phases are
+// connecting, with the handshake and login, and the listing.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	config, err := clientConfig(target)
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	client, err := dial(ctx, target, config, o)
+	phases = append(phases, types.Phase{Name: "connect", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error connecting: %w", err))
+	}
+	defer client.Close()
+	serverVersion := strings.TrimPrefix(string(client.ServerVersion()), "SSH-2.0-")
+	if target.Database == "" {
+		return newResult(phases, serverVersion, nil)
+	}
+
+	start = time.Now()
+	err = listDir(client, target.Database)
+	phases = append(phases, types.Phase{Name: "list", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, serverVersion, fmt.Errorf("error listing %s: %w", target.Database, err))
+	}
+	return newResult(phases, serverVersion, nil)
+}
+
+// clientConfig returns the SSH config of target with its host key check and
+// authentication methods.
+func clientConfig(target types.Target) (*ssh.ClientConfig, error) {
+	hostKeyCallback, err := hostKeyCallback(target)
+	if err != nil {
+		return nil, err
+	}
+	methods := []ssh.AuthMethod{}
+	if keyFile := target.Options["key_file"]; keyFile != "" {
+		pem, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading key file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key file %s: %w", keyFile, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if target.Pass != "" {
+		methods = append(methods, ssh.Password(target.Pass))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no key file or password to log in with")
+	}
+	return &ssh.ClientConfig{
+		User:            target.User,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		ClientVersion:   "SSH-2.0-db-connect-checker",
+	}, nil
+}
+
+// hostKeyCallback accepts only the host key with the fingerprint of the
+// host_key option or, without it, the keys of the host in the known_hosts
+// file. Unknown and changed keys fail with ErrHostKeyMismatch.
+func hostKeyCallback(target types.Target) (ssh.HostKeyCallback, error) {
+	if fingerprint := target.Options["host_key"]; fingerprint != "" {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != fingerprint {
+				return util.WithClass(ErrHostKeyMismatch, fmt.Errorf("host key %s is not %s", got, fingerprint))
+			}
+			return nil
+		}, nil
+	}
+	file := target.Options["known_hosts"]
+	if file == "" {
+		return nil, errors.New("no known hosts file or host key fingerprint to verify the server with")
+	}
+	callback, err := knownhosts.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts file: %w", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		var revokedErr *knownhosts.RevokedError
+		if errors.As(err, &keyErr) || errors.As(err, &revokedErr) {
+			return util.WithClass(ErrHostKeyMismatch, err)
+		}
+		return err
+	}, nil
+}
+
+// dial opens the SSH connection to target. The deadline of ctx applies to
+// the whole check.
+func dial(ctx context.Context, target types.Target, config *ssh.ClientConfig, o checkbase.Options) (*ssh.Client, error) {
+	addr := net.JoinHostPort(target.Host, target.Port)
+	conn, err := o.Dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// listDir reads the first entries of the directory path over SFTP.
+func listDir(client *ssh.Client, path string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return fmt.Errorf("starting sftp: %w", err)
+	}
+	c, err := newSFTPClient(w, r)
+	if err != nil {
+		return err
+	}
+	_, err = c.list(path)
+	return err
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	return checkbase.Result(phases, version, err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "host key mismatch".
+func ErrorReason(err error) string {
+	var status *StatusError
+	if errors.As(err, &status) {
+		switch status.Code {
+		case fxNoSuchFile:
+			return "unknown database"
+		case fxPermissionDenied:
+			return "auth error"
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "unable to authenticate") {
+		return "auth error"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected logins,
+// missing directories, unexpected host keys and invalid configs are not
+// retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database", "host key mismatch":
+		return false
+	}
+	return true
+}
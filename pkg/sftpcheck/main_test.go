@@ -0,0 +1,461 @@
+package sftpcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// directories of the fake server; /private cannot be opened.
+var directories = map[string][]string{
+	"/incoming": {"orders-1.csv", "orders-2.csv"},
+	"/empty":    {},
+}
+
+// fakeSFTP starts an SSH server whose sftp subsystem is served by serve, or
+// refused if serve is nil. It accepts the user checker with the password secret or with a generated
+// key. The returned target lists /incoming, logs in with both and verifies
+// the server by fingerprint; its known_hosts option names a file with the
+// host key as well.
+func fakeSFTP(t *testing.T, serve func(ssh.Channel)) types.Target {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPublic, userKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPublicKey, err := ssh.NewPublicKey(userPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "checker" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "checker" && bytes.Equal(key.Marshal(), userPublicKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config, serve)
+		}
+	}()
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(userKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(listener.Addr().String())}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return types.SFTPConfig{
+		Host:               host,
+		Port:               port,
+		User:               "checker",
+		Pass:               "secret",
+		KeyFile:            keyFile,
+		KnownHosts:         knownHosts,
+		HostKeyFingerprint: ssh.FingerprintSHA256(hostSigner.PublicKey()),
+		Dir:                "/incoming",
+	}.Target()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig, serve func(ssh.Channel)) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				name, _, _ := readString(req.Payload)
+				ok := req.Type == "subsystem" && string(name) == "sftp" && serve != nil
+				req.Reply(ok, nil)
+				if ok {
+					go serve(channel)
+				}
+			}
+		}()
+	}
+}
+
+// serveSFTP answers the requests of sftpClient for directories, using the
+// directory path as its handle.
+func serveSFTP(channel ssh.Channel) {
+	defer channel.Close()
+	c := &sftpClient{w: channel, r: channel}
+	for {
+		packetType, payload, err := c.receive()
+		if err != nil {
+			return
+		}
+		if packetType == fxpInit {
+			c.send(fxpVersion, binary.BigEndian.AppendUint32(nil, 3))
+			continue
+		}
+		id := payload[:4:4]
+		path, _, _ := readString(payload[4:])
+		status := func(code uint32) {
+			reply := binary.BigEndian.AppendUint32(id, code)
+			c.send(fxpStatus, appendString(appendString(reply, "status"), ""))
+		}
+		entries, found := directories[string(path)]
+		switch {
+		case packetType == fxpClose:
+			status(0)
+		case string(path) == "/private":
+			status(fxPermissionDenied)
+		case !found:
+			status(fxNoSuchFile)
+		case packetType == fxpOpendir:
+			c.send(fxpHandle, appendString(id, string(path)))
+		case packetType == fxpReaddir && len(entries) == 0:
+			status(fxEOF)
+		case packetType == fxpReaddir:
+			reply := binary.BigEndian.AppendUint32(id, uint32(len(entries)))
+			for _, entry := range entries {
+				reply = binary.BigEndian.AppendUint32(appendString(appendString(reply, entry), entry), 0)
+			}
+			c.send(fxpName, reply)
+		default:
+			status(8)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(target *types.Target)
+		wantReason string
+		wantPhases []string
+	}{
+		{
+			name:       "list directory",
+			modify:     func(target *types.Target) {},
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "empty directory",
+			modify:     func(target *types.Target) { target.Database = "/empty" },
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "login with password only",
+			modify:     func(target *types.Target) { target.Database, target.Options["key_file"] = "", "" },
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "login with key only",
+			modify:     func(target *types.Target) { target.Database, target.Pass = "", "" },
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "known hosts",
+			modify:     func(target *types.Target) { target.Options["host_key"] = "" },
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "missing directory",
+			modify:     func(target *types.Target) { target.Database = "/archive" },
+			wantReason: "unknown database",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "permission denied",
+			modify:     func(target *types.Target) { target.Database = "/private" },
+			wantReason: "auth error",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "wrong password",
+			modify:     func(target *types.Target) { target.Pass, target.Options["key_file"] = "wrong", "" },
+			wantReason: "auth error",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name: "changed host key",
+			modify: func(target *types.Target) {
+				target.Options["host_key"] = "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+			},
+			wantReason: "host key mismatch",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "no host key",
+			modify:     func(target *types.Target) { target.Options["host_key"], target.Options["known_hosts"] = "", "" },
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeSFTP(t, serveSFTP)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if tt.wantReason != "" && Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true, want false", result.Err)
+			}
+			if tt.wantReason == "" && !strings.HasPrefix(result.ServerVersion, "Go") {
+				t.Errorf("ServerVersion = %q, want the version of the Go SSH server", result.ServerVersion)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
+
+// scriptedSFTP answers every packet it receives with the next of replies,
+// raw packets that may be malformed, and closes the channel once they run
+// out.
+func scriptedSFTP(replies ...[]byte) func(ssh.Channel) {
+	return func(channel ssh.Channel) {
+		defer channel.Close()
+		c := &sftpClient{w: channel, r: channel}
+		for _, reply := range replies {
+			if _, _, err := c.receive(); err != nil {
+				return
+			}
+			if _, err := channel.Write(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// packet returns an SFTP packet of packetType with the request id and
+// payload.
+func packet(packetType byte, id uint32, payload []byte) []byte {
+	body := append([]byte{packetType}, binary.BigEndian.AppendUint32(nil, id)...)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(body)+len(payload))), append(body, payload...)...)
+}
+
+// answerRaw writes answer to the first connection of listener and ends the
+// stream, since the SSH client skips lines before the version.
+func answerRaw(listener net.Listener, answer string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(answer))
+	conn.(*net.TCPConn).CloseWrite()
+	io.Copy(io.Discard, conn)
+}
+
+func TestCheckProtocolErrors(t *testing.T) {
+	// The version packet has no id; its first field is the version.
+	version := packet(fxpVersion, 3, nil)
+	handle := packet(fxpHandle, 1, appendString(nil, "/incoming"))
+	tests := []struct {
+		name    string
+		refused bool
+		// raw is the answer of a server that does not speak SSH.
+		raw string
+		// sftp answers the sftp subsystem, which is refused without it.
+		sftp       func(ssh.Channel)
+		wantReason string
+		wantErr    string
+		wantPhases []string
+	}{
+		{
+			name:       "connection refused",
+			refused:    true,
+			wantReason: "connection refused",
+			wantErr:    "refused",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "not an SSH server",
+			raw:        "220 ftp.example.com FTP server ready\r\n",
+			wantErr:    "ssh: ",
+			wantPhases: []string{"connect"},
+		},
+		{
+			name:       "sftp subsystem refused",
+			wantErr:    "starting sftp",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "closed before version",
+			sftp:       scriptedSFTP(),
+			wantErr:    "EOF",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "status instead of version",
+			sftp:       scriptedSFTP(packet(fxpStatus, 0, nil)),
+			wantErr:    "unexpected sftp packet 101 instead of version",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "oversized packet",
+			sftp:       scriptedSFTP([]byte{0x7f, 0, 0, 0, fxpVersion}),
+			wantErr:    "invalid sftp packet length",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "truncated packet",
+			sftp:       scriptedSFTP(version[:len(version)-2]),
+			wantErr:    "EOF",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "reply to another request",
+			sftp:       scriptedSFTP(version, packet(fxpHandle, 7, appendString(nil, "/incoming"))),
+			wantErr:    "sftp reply with unexpected id",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "unexpected reply to opendir",
+			sftp:       scriptedSFTP(version, packet(fxpName, 1, binary.BigEndian.AppendUint32(nil, 0))),
+			wantErr:    "unexpected sftp packet 104",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "short status",
+			sftp:       scriptedSFTP(version, packet(fxpStatus, 1, []byte{0, 0})),
+			wantErr:    "short sftp status packet",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "short handle",
+			sftp:       scriptedSFTP(version, packet(fxpHandle, 1, binary.BigEndian.AppendUint32(nil, 64))),
+			wantErr:    "short sftp string",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "short name packet",
+			sftp:       scriptedSFTP(version, handle, packet(fxpName, 2, nil), packet(fxpStatus, 3, binary.BigEndian.AppendUint32(nil, 0))),
+			wantErr:    "short sftp name packet",
+			wantPhases: []string{"connect", "list"},
+		},
+		{
+			name:       "failure status",
+			sftp:       scriptedSFTP(version, packet(fxpStatus, 1, appendString(binary.BigEndian.AppendUint32(nil, 4), "Failure"))),
+			wantErr:    "sftp status 4: Failure",
+			wantPhases: []string{"connect", "list"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var target types.Target
+			if tt.refused || tt.raw != "" {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.refused {
+					listener.Close()
+				} else {
+					t.Cleanup(func() { listener.Close() })
+					go answerRaw(listener, tt.raw)
+				}
+				host, port, _ := net.SplitHostPort(listener.Addr().String())
+				target = types.SFTPConfig{
+					Host:               host,
+					Port:               port,
+					User:               "checker",
+					Pass:               "secret",
+					HostKeyFingerprint: "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8",
+				}.Target()
+			} else {
+				target = fakeSFTP(t, tt.sftp)
+			}
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			wantReason := tt.wantReason
+			if wantReason == "" {
+				wantReason = "error"
+			}
+			if result.Success || result.Reason != wantReason {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, wantReason)
+			}
+			if !strings.Contains(result.Err.Error(), tt.wantErr) {
+				t.Errorf("Check() error = %v, want it to mention %q", result.Err, tt.wantErr)
+			}
+			if !Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = false, want true", result.Err)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package sftpcheck
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Packet types of SFTP version 3, see draft-ietf-secsh-filexfer-02.
+const (
+	fxpInit    = 1
+	fxpVersion = 2
+	fxpClose   = 4
+	fxpOpendir = 11
+	fxpReaddir = 12
+	fxpStatus  = 101
+	fxpHandle  = 102
+	fxpName    = 104
+)
+
+// Status codes of SFTP version 3.
+const (
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+)
+
+// StatusError is an SSH_FXP_STATUS reply other than success.
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sftp status %d: %s", e.Code, e.Message)
+}
+
+// sftpClient speaks the few requests of SFTP version 3 a directory listing
+// needs over a session running the sftp subsystem.
+type sftpClient struct {
+	w  io.Writer
+	r  io.Reader
+	id uint32
+}
+
+// newSFTPClient negotiates version 3 of the protocol.
+func newSFTPClient(w io.Writer, r io.Reader) (*sftpClient, error) {
+	c := &sftpClient{w: w, r: r}
+	if err := c.send(fxpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, err
+	}
+	packetType, _, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if packetType != fxpVersion {
+		return nil, fmt.Errorf("unexpected sftp packet %d instead of version", packetType)
+	}
+	return c, nil
+}
+
+// list opens the directory path and reads its first batch of entries. It
+// returns the number of entries read, zero for an empty directory.
+func (c *sftpClient) list(path string) (int, error) {
+	handle, err := c.request(fxpOpendir, appendString(nil, path), fxpHandle)
+	if err != nil {
+		return 0, err
+	}
+	handle, _, err = readString(handle)
+	if err != nil {
+		return 0, err
+	}
+	defer c.request(fxpClose, appendString(nil, string(handle)), fxpStatus)
+
+	names, err := c.request(fxpReaddir, appendString(nil, string(handle)), fxpName)
+	var status *StatusError
+	if errors.As(err, &status) && status.Code == fxEOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(names) < 4 {
+		return 0, errors.New("short sftp name packet")
+	}
+	return int(binary.BigEndian.Uint32(names)), nil
+}
+
+// request sends a request with a new id and returns the payload of the
+// reply after its id. A status reply is returned as *StatusError unless it
+// is the expected reply and reports success.
+func (c *sftpClient) request(packetType byte, payload []byte, want byte) ([]byte, error) {
+	c.id++
+	if err := c.send(packetType, append(binary.BigEndian.AppendUint32(nil, c.id), payload...)); err != nil {
+		return nil, err
+	}
+	replyType, reply, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < 4 || binary.BigEndian.Uint32(reply) != c.id {
+		return nil, errors.New("sftp reply with unexpected id")
+	}
+	reply = reply[4:]
+	if replyType == fxpStatus {
+		if len(reply) < 4 {
+			return nil, errors.New("short sftp status packet")
+		}
+		code := binary.BigEndian.Uint32(reply)
+		if code == 0 && want == fxpStatus {
+			return nil, nil
+		}
+		message, _, _ := readString(reply[4:])
+		return nil, &StatusError{Code: code, Message: string(message)}
+	}
+	if replyType != want {
+		return nil, fmt.Errorf("unexpected sftp packet %d", replyType)
+	}
+	return reply, nil
+}
+
+func (c *sftpClient) send(packetType byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	packet = append(packet, packetType)
+	_, err := c.w.Write(append(packet, payload...))
+	return err
+}
+
+func (c *sftpClient) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size < 1 || size > 1<<20 {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", size)
+	}
+	payload := make([]byte, size-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(binary.BigEndian.AppendUint32(b, uint32(len(s))), s...)
+}
+
+func readString(b []byte) ([]byte, []byte, error) {
+	if len(b) < 4 || uint32(len(b)-4) < binary.BigEndian.Uint32(b) {
+		return nil, nil, errors.New("short sftp string")
+	}
+	size := binary.BigEndian.Uint32(b)
+	return b[4 : 4+size], b[4+size:], nil
+}
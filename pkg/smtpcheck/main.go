@@ -0,0 +1,187 @@
+// Package smtpcheck checks SMTP servers the way a service sending mail uses
+// its relay: it reads the greeting, sends EHLO, upgrades the connection with
+// STARTTLS and optionally authenticates.
+package smtpcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A server that
+// does not offer STARTTLS although it is required fails with ErrTLS.
+var (
+	ErrAuthFailed = util.ErrAuthFailed
+	ErrDNS        = util.ErrDNS
+	ErrTimeout    = util.ErrTimeout
+	ErrTLS        = util.ErrTLS
+)
+
+// authCodes are the reply codes of rejected or required authentication.
+var authCodes = map[int]bool{
+	530: true,
+	534: true,
+	535: true,
+}
+
+// defaultTimeout limits a check: connecting, EHLO, STARTTLS and AUTH.
+const defaultTimeout = 10 * time.Second
+
+// Check connects to the SMTP server of target, with TLS from the start if
+// target.TLS is set, reads the greeting and sends EHLO with the helo option,
+// the local host name if empty. With the starttls option it then requires
+// and performs STARTTLS, and with a User it authenticates with AUTH PLAIN.
+// The phases are connecting, EHLO, STARTTLS and AUTH.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	tlsConfig, err := targetTLSConfig(target)
+	if err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	helo := target.Options["helo"]
+	if helo == "" {
+		if helo, err = os.Hostname(); err != nil {
+			helo = "localhost"
+		}
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	var client *smtp.Client
+	conn, err := dial(ctx, target, tlsConfig, o)
+	if err == nil {
+		if client, err = smtp.NewClient(conn, target.Host); err != nil {
+			conn.Close()
+		}
+	}
+	phases = append(phases, types.Phase{Name: "connect", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error connecting: %w", err))
+	}
+	defer client.Close()
+
+	start = time.Now()
+	err = client.Hello(helo)
+	phases = append(phases, types.Phase{Name: "ehlo", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error ehlo: %w", err))
+	}
+
+	if !target.TLS && target.Options["starttls"] == "true" {
+		start = time.Now()
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			err = client.StartTLS(tlsConfig)
+		} else {
+			err = util.WithClass(ErrTLS, errors.New("server does not offer STARTTLS"))
+		}
+		phases = append(phases, types.Phase{Name: "starttls", Duration: time.Since(start)})
+		if err != nil {
+			return newResult(phases, fmt.Errorf("error starttls: %w", err))
+		}
+	}
+
+	if target.User != "" {
+		start = time.Now()
+		err = client.Auth(smtp.PlainAuth("", target.User, target.Pass, target.Host))
+		phases = append(phases, types.Phase{Name: "auth", Duration: time.Since(start)})
+		if err != nil {
+			return newResult(phases, fmt.Errorf("error auth: %w", err))
+		}
+	}
+	client.Quit()
+	return newResult(phases, nil)
+}
+
+// dial opens a connection to target, with TLS if target.TLS is set. The
+// deadline of ctx applies to the whole conversation.
+func dial(ctx context.Context, target types.Target, tlsConfig *tls.Config, o checkbase.Options) (net.Conn, error) {
+	conn, err := o.Dial(ctx, "tcp", net.JoinHostPort(target.Host, target.Port))
+	if err != nil {
+		return nil, err
+	}
+	if !target.TLS {
+		return conn, nil
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// targetTLSConfig returns the TLS config of target for implicit TLS and
+// STARTTLS: its TLSConfig, or one trusting the CA bundle of TLSCAFile, or
+// the system roots if neither is set.
+func targetTLSConfig(target types.Target) (*tls.Config, error) {
+	if target.TLSConfig != nil {
+		config := target.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = target.Host
+		}
+		return config, nil
+	}
+	config := &tls.Config{ServerName: target.Host}
+	if target.TLSCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return config, nil
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "tls error".
+func ErrorReason(err error) string {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) && authCodes[smtpErr.Code] {
+		return "auth error"
+	}
+	if errors.Is(err, ErrTLS) {
+		// STARTTLS missing, not seen by util.NetErrorReason.
+		return ErrTLS.Error()
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected
+// credentials and invalid configs are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	return ErrorReason(err) != "auth error"
+}
@@ -0,0 +1,178 @@
+package smtpcheck
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeSMTP answers like a mail relay that offers STARTTLS if starttls is set
+// and accepts AUTH PLAIN of the user checker with the password secret after
+// it. It returns the target with a TLS config trusting the relay.
+func fakeSMTP(t *testing.T, starttls bool) types.Target {
+	t.Helper()
+	// The test server is only used for its certificate.
+	certServer := httptest.NewUnstartedServer(nil)
+	certServer.StartTLS()
+	certServer.Close()
+	serverConfig := &tls.Config{Certificates: certServer.TLS.Certificates}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, starttls, serverConfig)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(certServer.Certificate())
+	target := types.SMTPConfig{Host: host, Port: port, User: "checker", Pass: "secret", Helo: "checker.example.com", StartTLS: true}.Target()
+	target.TLSConfig = &tls.Config{RootCAs: pool}
+	return target
+}
+
+func serveSMTP(conn net.Conn, starttls bool, config *tls.Config) {
+	defer func() { conn.Close() }()
+	reader := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		io.WriteString(conn, strings.Join(lines, "\r\n")+"\r\n")
+	}
+	encrypted := false
+	reply("220 mx.example.com ESMTP fake")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			if starttls && !encrypted {
+				reply("250-mx.example.com", "250-STARTTLS", "250 AUTH PLAIN")
+			} else {
+				reply("250-mx.example.com", "250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, config)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, reader, encrypted = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if string(credentials) == "\x00checker\x00secret" {
+				reply("235 2.7.0 Authentication successful")
+			} else {
+				reply("535 5.7.8 Error: authentication failed")
+			}
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Error: command not recognized")
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		starttls   bool
+		modify     func(target *types.Target)
+		wantReason string
+		wantPhases []string
+	}{
+		{
+			name:       "starttls and auth",
+			starttls:   true,
+			modify:     func(target *types.Target) {},
+			wantPhases: []string{"connect", "ehlo", "starttls", "auth"},
+		},
+		{
+			name:       "ehlo only",
+			modify:     func(target *types.Target) { target.User, target.Options["starttls"] = "", "false" },
+			wantPhases: []string{"connect", "ehlo"},
+		},
+		{
+			name:       "wrong password",
+			starttls:   true,
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"connect", "ehlo", "starttls", "auth"},
+		},
+		{
+			name:       "starttls not offered",
+			modify:     func(target *types.Target) {},
+			wantReason: "tls error",
+			wantPhases: []string{"connect", "ehlo", "starttls"},
+		},
+		{
+			name:     "untrusted certificate",
+			starttls: true,
+			modify: func(target *types.Target) {
+				target.TLSConfig = nil
+			},
+			wantReason: "tls error",
+			wantPhases: []string{"connect", "ehlo", "starttls"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeSMTP(t, tt.starttls)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if retryable := tt.wantReason == "tls error"; tt.wantReason != "" && Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	target := types.SMTPConfig{Host: host, Port: port, StartTLS: true}.Target()
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
@@ -0,0 +1,363 @@
+// Package snowflakecheck checks Snowflake accounts: it logs in with a
+// password or a key pair, resumes the warehouse if asked to and runs
+// SELECT 1, using the REST endpoints of the Snowflake drivers.
+package snowflakecheck
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// Error classes wrapped by check errors, see util.WithClass. A missing
+// database or warehouse is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Codes of Snowflake errors with an error class.
+var (
+	authCodes = map[string]bool{
+		"390100": true, // incorrect username or password
+		"390144": true, // JWT token is invalid
+	}
+	unknownDatabaseCodes = map[string]bool{
+		"390201": true, // the requested database does not exist or not authorized
+		"002003": true, // the object (e.g. the warehouse) does not exist or not authorized
+	}
+)
+
+// Codes of queries that are still running; the result is polled.
+const (
+	codeQueryInProgress      = "333333"
+	codeQueryInProgressAsync = "333334"
+)
+
+// Error is an error answer of Snowflake.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("snowflake error %s: %s", e.Code, e.Message)
+}
+
+// response is the envelope of every answer.
+type response struct {
+	Data    json.RawMessage `json:"data"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Success bool            `json:"success"`
+}
+
+// client is one session of a check.
+type client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+}
+
+// defaultTimeout limits a check. Resuming a warehouse usually takes a few
+// seconds, but can take longer for large warehouses.
+const defaultTimeout = 60 * time.Second
+
+// Check logs in to the Snowflake account of target, resumes its warehouse
+// unless the resume_warehouse option is false and runs SELECT 1. The phases
+// are the login, the warehouse resume, whose duration is the resume latency
+// (close to zero for a running warehouse), and the query.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	body, err := loginBody(target, time.Now())
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+
+	transport := o.Transport(target.TLSConfig)
+	defer transport.CloseIdleConnections()
+	c := &client{
+		http:    &http.Client{Transport: transport},
+		baseURL: "https://" + net.JoinHostPort(target.Host, target.Port),
+	}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	serverVersion, err := c.login(ctx, target, body)
+	phases = append(phases, types.Phase{Name: "login", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, "", fmt.Errorf("error login: %w", err))
+	}
+	defer c.logout(ctx)
+
+	if warehouse := target.Options["warehouse"]; warehouse != "" && target.Options["resume_warehouse"] != "false" {
+		start = time.Now()
+		err = c.query(ctx, "ALTER WAREHOUSE IDENTIFIER('"+strings.ReplaceAll(warehouse, "'", "''")+"') RESUME IF SUSPENDED")
+		phases = append(phases, types.Phase{Name: "warehouse resume", Duration: time.Since(start)})
+		if err != nil {
+			return newResult(phases, serverVersion, fmt.Errorf("error resuming warehouse %s: %w", warehouse, err))
+		}
+	}
+
+	start = time.Now()
+	err = c.query(ctx, "SELECT 1")
+	phases = append(phases, types.Phase{Name: "query", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, serverVersion, fmt.Errorf("error query: %w", err))
+	}
+	return newResult(phases, serverVersion, nil)
+}
+
+// loginBody returns the login request of target: password authentication,
+// or key-pair authentication if the private_key_file option is set.
+func loginBody(target types.Target, now time.Time) ([]byte, error) {
+	account, _, _ := strings.Cut(target.Options["account"], ".")
+	data := map[string]string{
+		"CLIENT_APP_ID":      "db-connect-checker",
+		"CLIENT_APP_VERSION": version.Version,
+		"ACCOUNT_NAME":       strings.ToUpper(account),
+		"LOGIN_NAME":         target.User,
+	}
+	switch {
+	case target.Options["private_key_file"] != "":
+		key, err := readPrivateKey(target.Options["private_key_file"])
+		if err != nil {
+			return nil, err
+		}
+		token, err := keyPairToken(account, target.User, key, now)
+		if err != nil {
+			return nil, err
+		}
+		data["AUTHENTICATOR"] = "SNOWFLAKE_JWT"
+		data["TOKEN"] = token
+	case target.Pass != "":
+		data["PASSWORD"] = target.Pass
+	default:
+		return nil, fmt.Errorf("snowflake user %s has neither a password nor a private key file", target.User)
+	}
+	return json.Marshal(map[string]interface{}{"data": data})
+}
+
+// readPrivateKey reads an unencrypted PKCS#8 or PKCS#1 PEM RSA key.
+func readPrivateKey(file string) (*rsa.PrivateKey, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("private key file %s is not PEM encoded", file)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing private key %s: %w", file, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key %s is not an RSA key", file)
+		}
+		return rsaKey, nil
+	}
+	return nil, fmt.Errorf("unsupported private key %s of type %q, encrypted keys are not supported", file, block.Type)
+}
+
+// keyPairToken returns the JWT of key-pair authentication, valid for one
+// minute. The issuer names the key by the SHA-256 fingerprint of its public
+// key, like RSA_PUBLIC_KEY_FP of DESCRIBE USER.
+func keyPairToken(account, user string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	fingerprint := sha256.Sum256(publicKey)
+	subject := strings.ToUpper(account) + "." + strings.ToUpper(user)
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": subject + ".SHA256:" + base64.StdEncoding.EncodeToString(fingerprint[:]),
+		"sub": subject,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	signed := encoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encoding.EncodeToString(signature), nil
+}
+
+// login opens a session and returns the server version.
+func (c *client) login(ctx context.Context, target types.Target, body []byte) (string, error) {
+	query := url.Values{"requestId": {uuid.NewString()}}
+	for option, parameter := range map[string]string{"warehouse": "warehouse", "role": "roleName"} {
+		if value := target.Options[option]; value != "" {
+			query.Set(parameter, value)
+		}
+	}
+	if target.Database != "" {
+		query.Set("databaseName", target.Database)
+	}
+	var data struct {
+		Token         string `json:"token"`
+		ServerVersion string `json:"serverVersion"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/session/v1/login-request?"+query.Encode(), body, &data); err != nil {
+		return "", err
+	}
+	c.token = data.Token
+	return data.ServerVersion, nil
+}
+
+// logout closes the session; errors are ignored, sessions also expire.
+func (c *client) logout(ctx context.Context) {
+	c.do(ctx, http.MethodPost, "/session?delete=true", nil, nil)
+}
+
+// query runs sql and waits for it to finish. The rows are discarded.
+func (c *client) query(ctx context.Context, sql string) error {
+	body, err := json.Marshal(map[string]interface{}{"sqlText": sql, "asyncExec": false})
+	if err != nil {
+		return err
+	}
+	var data struct {
+		GetResultURL string `json:"getResultUrl"`
+	}
+	path := "/queries/v1/query-request?requestId=" + uuid.NewString()
+	method := http.MethodPost
+	for {
+		err := c.do(ctx, method, path, body, &data)
+		var snowflakeErr *Error
+		if !errors.As(err, &snowflakeErr) || (snowflakeErr.Code != codeQueryInProgress && snowflakeErr.Code != codeQueryInProgressAsync) {
+			return err
+		}
+		if data.GetResultURL == "" {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+		method, path, body = http.MethodGet, data.GetResultURL, nil
+	}
+}
+
+// do sends one request and decodes the data of a successful answer into
+// data. A failed answer is returned as *Error; the data of a query in
+// progress is still decoded.
+func (c *client) do(ctx context.Context, method, path string, body []byte, data interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("User-Agent", "db-connect-checker/"+version.Version)
+	if c.token != "" {
+		request.Header.Set("Authorization", `Snowflake Token="`+c.token+`"`)
+	}
+	resp, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	var answer response
+	if err := json.Unmarshal(content, &answer); err != nil {
+		return fmt.Errorf("invalid answer: %w", err)
+	}
+	if data != nil && len(answer.Data) > 0 && string(answer.Data) != "null" {
+		if err := json.Unmarshal(answer.Data, data); err != nil {
+			return fmt.Errorf("invalid answer: %w", err)
+		}
+	}
+	if !answer.Success {
+		return &Error{Code: answer.Code, Message: answer.Message}
+	}
+	return nil
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	return checkbase.Result(phases, version, err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var snowflakeErr *Error
+	if errors.As(err, &snowflakeErr) {
+		if authCodes[snowflakeErr.Code] {
+			return "auth error"
+		}
+		if unknownDatabaseCodes[snowflakeErr.Code] {
+			return "unknown database"
+		}
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures, missing databases or warehouses and invalid configs are not
+// retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
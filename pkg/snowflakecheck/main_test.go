@@ -0,0 +1,215 @@
+package snowflakecheck
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeSnowflake answers like a Snowflake account whose only user is app with
+// password secret or key, and whose only database is ANALYTICS. The resume
+// of a warehouse is reported in progress once. It returns the target and the
+// SQL texts it ran.
+func fakeSnowflake(t *testing.T, key *rsa.PublicKey) (types.Target, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries []string
+	answer := func(w http.ResponseWriter, data interface{}, code, message string) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "code": code, "message": message, "success": code == ""})
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/session/v1/login-request":
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			login := body.Data
+			if login["ACCOUNT_NAME"] != "XY12345" || login["LOGIN_NAME"] != "app" || !validLogin(login, key) {
+				answer(w, nil, "390100", "Incorrect username or password was specified.")
+				return
+			}
+			if db := r.URL.Query().Get("databaseName"); db != "" && db != "ANALYTICS" {
+				answer(w, nil, "390201", "The requested database does not exist or not authorized.")
+				return
+			}
+			answer(w, map[string]string{"token": "session-token", "serverVersion": "9.1.0"}, "", "")
+		case r.Header.Get("Authorization") != `Snowflake Token="session-token"`:
+			answer(w, nil, "390104", "User must login again to access the service.")
+		case r.URL.Path == "/queries/v1/query-request":
+			var body struct {
+				SQLText string `json:"sqlText"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			queries = append(queries, body.SQLText)
+			mu.Unlock()
+			if strings.HasPrefix(body.SQLText, "ALTER WAREHOUSE") {
+				answer(w, map[string]string{"getResultUrl": "/queries/resume/result"}, codeQueryInProgressAsync, "Asynchronous execution in progress.")
+				return
+			}
+			answer(w, map[string]interface{}{"rowset": [][]string{{"1"}}}, "", "")
+		case r.URL.Path == "/queries/resume/result":
+			answer(w, map[string]interface{}{"rowset": [][]string{{"Statement executed successfully."}}}, "", "")
+		case r.URL.Path == "/session":
+			answer(w, nil, "", "")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	target := types.SnowflakeConfig{Account: "xy12345.eu-central-1", Host: host, User: "app", Warehouse: "etl", Database: "ANALYTICS", ResumeWarehouse: true}.Target()
+	target.Port = port
+	target.TLSConfig = &tls.Config{RootCAs: pool}
+	return target, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+// validLogin checks the password or the JWT of key-pair authentication.
+func validLogin(login map[string]string, key *rsa.PublicKey) bool {
+	if login["AUTHENTICATOR"] != "SNOWFLAKE_JWT" {
+		return login["PASSWORD"] == "secret"
+	}
+	parts := strings.Split(login["TOKEN"], ".")
+	if len(parts) != 3 || key == nil {
+		return false
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+		return false
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var jwt struct {
+		Iss string `json:"iss"`
+		Sub string `json:"sub"`
+	}
+	json.Unmarshal(claims, &jwt)
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	fingerprint := sha256.Sum256(der)
+	return jwt.Sub == "XY12345.APP" && jwt.Iss == "XY12345.APP.SHA256:"+base64.StdEncoding.EncodeToString(fingerprint[:])
+}
+
+func TestCheck(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyFile := filepath.Join(t.TempDir(), "rsa_key.p8")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(target *types.Target)
+		wantReason  string
+		wantPhases  []string
+		wantQueries []string
+	}{
+		{
+			name:        "password",
+			modify:      func(target *types.Target) { target.Pass = "secret" },
+			wantPhases:  []string{"login", "warehouse resume", "query"},
+			wantQueries: []string{"ALTER WAREHOUSE IDENTIFIER('etl') RESUME IF SUSPENDED", "SELECT 1"},
+		},
+		{
+			name: "key pair without resume",
+			modify: func(target *types.Target) {
+				target.Options["private_key_file"] = keyFile
+				target.Options["resume_warehouse"] = "false"
+			},
+			wantPhases:  []string{"login", "query"},
+			wantQueries: []string{"SELECT 1"},
+		},
+		{
+			name:       "wrong password",
+			modify:     func(target *types.Target) { target.Pass = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"login"},
+		},
+		{
+			name:       "unknown database",
+			modify:     func(target *types.Target) { target.Pass = "secret"; target.Database = "MISSING" },
+			wantReason: "unknown database",
+			wantPhases: []string{"login"},
+		},
+		{
+			name:       "no credentials",
+			modify:     func(target *types.Target) {},
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, queries := fakeSnowflake(t, &key.PublicKey)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if tt.wantReason != "" && Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true", result.Err)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if got := queries(); strings.Join(got, ";") != strings.Join(tt.wantQueries, ";") {
+				t.Errorf("queries = %q, want %q", got, tt.wantQueries)
+			}
+			if result.Success && result.ServerVersion != "9.1.0" {
+				t.Errorf("ServerVersion = %q", result.ServerVersion)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	target := types.Target{Type: "snowflake", Host: host, Port: port, User: "app", Pass: "secret", Options: map[string]string{"account": "xy12345"}}
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
@@ -0,0 +1,228 @@
+// Package spannercheck checks Cloud Spanner databases: it obtains a token
+// with Application Default Credentials or a credentials file, creates a
+// session in the database and runs SELECT 1 in it. Creating the session is
+// the slow part of connecting to Spanner, so it is reported as a phase of
+// its own.
+package spannercheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+)
+
+// scope is the OAuth scope of the check.
+const scope = "https://www.googleapis.com/auth/spanner.data"
+
+// deleteTimeout limits deleting the session after the check; an undeleted
+// session expires on its own after an hour.
+const deleteTimeout = 5 * time.Second
+
+// Error classes wrapped by check errors, see util.WithClass. Missing
+// permissions are reported as auth error, a missing instance or database as
+// unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+)
+
+// Error is an error answer of the Spanner API.
+type Error struct {
+	// Code is the HTTP status code.
+	Code    int
+	Status  string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("spanner error %d %s: %s", e.Code, e.Status, e.Message)
+}
+
+// defaultTimeout limits a check: fetching a token, creating a session and a query.
+const defaultTimeout = 30 * time.Second
+
+// Check obtains a token for target, creates a session in its database of the
+// instance and project options and runs SELECT 1 in the session, which is
+// deleted afterwards. The phases are the token, the session and the query.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	project, instance := target.Options["project"], target.Options["instance"]
+	if project == "" || instance == "" || target.Database == "" {
+		return newResult(nil, retry.Permanent(fmt.Errorf("spanner project, instance and database are required")))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, err)
+	}
+
+	transport := o.Transport(target.TLSConfig)
+	defer transport.CloseIdleConnections()
+	// Tokens are fetched with the same transport.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+
+	phases := []types.Phase{}
+	start := time.Now()
+	credentials, err := findCredentials(ctx, target.Options["credentials_file"])
+	if err != nil {
+		return newResult(nil, retry.Permanent(err))
+	}
+	token, err := credentials.TokenSource.Token()
+	phases = append(phases, types.Phase{Name: "token", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error token: %w", err))
+	}
+
+	client := &http.Client{Transport: &oauth2.Transport{Source: oauth2.StaticTokenSource(token), Base: transport}}
+	baseURL := "https://" + net.JoinHostPort(target.Host, target.Port) + "/v1/"
+	database := "projects/" + url.PathEscape(project) + "/instances/" + url.PathEscape(instance) + "/databases/" + url.PathEscape(target.Database)
+
+	start = time.Now()
+	var session struct {
+		Name string `json:"name"`
+	}
+	err = call(ctx, client, http.MethodPost, baseURL+database+"/sessions", map[string]interface{}{}, &session)
+	phases = append(phases, types.Phase{Name: "session", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error creating session in database %s: %w", target.Database, err))
+	}
+	defer func() {
+		// The check context may be expired already.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteTimeout)
+		defer cancel()
+		call(ctx, client, http.MethodDelete, baseURL+session.Name, nil, nil)
+	}()
+
+	start = time.Now()
+	err = call(ctx, client, http.MethodPost, baseURL+session.Name+":executeSql", map[string]string{"sql": "SELECT 1"}, nil)
+	phases = append(phases, types.Phase{Name: "query", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, fmt.Errorf("error query: %w", err))
+	}
+	return newResult(phases, nil)
+}
+
+// findCredentials reads the credentials file, or Application Default
+// Credentials if file is empty: GOOGLE_APPLICATION_CREDENTIALS, the gcloud
+// credentials or the metadata server.
+func findCredentials(ctx context.Context, file string) (*google.Credentials, error) {
+	if file == "" {
+		return google.FindDefaultCredentials(ctx, scope)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials: %w", err)
+	}
+	return google.CredentialsFromJSON(ctx, content, scope)
+}
+
+// call sends a request with the JSON body, if not nil, to endpoint and
+// decodes a successful answer into data. A failed answer is returned as
+// *Error.
+func call(ctx context.Context, client *http.Client, method, endpoint string, body, data interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error struct {
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(content, &answer) != nil || answer.Error.Message == "" {
+			return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+		}
+		return &Error{Code: resp.StatusCode, Status: answer.Error.Status, Message: answer.Error.Message}
+	}
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(content, data); err != nil {
+		return fmt.Errorf("invalid answer: %w", err)
+	}
+	return nil
+}
+
+func newResult(phases []types.Phase, err error) types.Result {
+	return checkbase.Result(phases, "", err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "connection refused".
+func ErrorReason(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "auth error"
+		case http.StatusNotFound:
+			return "unknown database"
+		}
+	}
+	// A rejected credential, e.g. a deleted service account key.
+	var tokenErr *oauth2.RetrieveError
+	if errors.As(err, &tokenErr) && tokenErr.Response != nil && tokenErr.Response.StatusCode >= 400 && tokenErr.Response.StatusCode < 500 {
+		return "auth error"
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Rejected
+// credentials, missing permissions, missing instances or databases and
+// invalid configs are not retryable.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
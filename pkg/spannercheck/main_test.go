@@ -0,0 +1,199 @@
+package spannercheck
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeSpanner answers like the token endpoint of Google and the Spanner API
+// of a project app-prod whose instance main has the only database orders,
+// readable by the service account checker. It returns the target with a
+// credentials file of that account and the requests it received.
+func fakeSpanner(t *testing.T) (types.Target, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	apiError := func(w http.ResponseWriter, code int, status, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "status": status, "message": message}})
+	}
+	const database = "/v1/projects/app-prod/instances/main/databases/orders"
+	const session = database + "/sessions/s1"
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			r.ParseForm()
+			if strings.Count(r.PostForm.Get("assertion"), ".") != 2 {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Invalid JWT Signature."})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-token", "token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			apiError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Request is missing required authentication credential.")
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, database))
+		mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == database+"/sessions":
+			json.NewEncoder(w).Encode(map[string]string{"name": strings.TrimPrefix(session, "/v1/")})
+		case r.Method == http.MethodPost && r.URL.Path == session+":executeSql":
+			var body struct {
+				SQL string `json:"sql"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.SQL != "SELECT 1" {
+				apiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "unexpected query")
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"rows": [][]string{{"1"}}})
+		case r.Method == http.MethodDelete && r.URL.Path == session:
+			w.Write([]byte("{}"))
+		case strings.HasPrefix(r.URL.Path, "/v1/projects/app-prod/"):
+			apiError(w, http.StatusNotFound, "NOT_FOUND", "Database not found: "+strings.TrimPrefix(r.URL.Path, "/v1/"))
+		default:
+			apiError(w, http.StatusForbidden, "PERMISSION_DENIED", "Caller is missing IAM permission spanner.sessions.create on resource.")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "app-prod",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "checker@app-prod.iam.gserviceaccount.com",
+		"token_uri":      server.URL + "/token",
+	})
+	file := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(file, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	target := types.SpannerConfig{Project: "app-prod", Instance: "main", Database: "orders", CredentialsFile: file}.Target()
+	target.Host = host
+	target.Port = port
+	target.TLSConfig = &tls.Config{RootCAs: pool}
+	return target, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(target *types.Target)
+		wantReason   string
+		wantPhases   []string
+		wantRequests []string
+	}{
+		{
+			name:         "database",
+			modify:       func(target *types.Target) {},
+			wantPhases:   []string{"token", "session", "query"},
+			wantRequests: []string{"POST /sessions", "POST /sessions/s1:executeSql", "DELETE /sessions/s1"},
+		},
+		{
+			name:         "missing database",
+			modify:       func(target *types.Target) { target.Database = "missing" },
+			wantReason:   "unknown database",
+			wantPhases:   []string{"token", "session"},
+			wantRequests: []string{"POST /v1/projects/app-prod/instances/main/databases/missing/sessions"},
+		},
+		{
+			name:         "no permission",
+			modify:       func(target *types.Target) { target.Options["project"] = "other-project" },
+			wantReason:   "auth error",
+			wantPhases:   []string{"token", "session"},
+			wantRequests: []string{"POST /v1/projects/other-project/instances/main/databases/orders/sessions"},
+		},
+		{
+			name:       "missing instance",
+			modify:     func(target *types.Target) { target.Options["instance"] = "" },
+			wantReason: "invalid config",
+		},
+		{
+			name: "missing credentials file",
+			modify: func(target *types.Target) {
+				target.Options["credentials_file"] = filepath.Join(t.TempDir(), "missing.json")
+			},
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, requests := fakeSpanner(t)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if tt.wantReason != "" && Retryable(result.Err) {
+				t.Errorf("Retryable(%v) = true", result.Err)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if got := requests(); strings.Join(got, ";") != strings.Join(tt.wantRequests, ";") {
+				t.Errorf("requests = %q, want %q", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	target, _ := fakeSpanner(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	// The token endpoint answers, the API does not.
+	target.Host, target.Port, _ = net.SplitHostPort(addr)
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
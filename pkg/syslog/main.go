@@ -0,0 +1,200 @@
+// Package syslog sends check results as RFC 5424 messages with structured
+// data to a local or remote syslog endpoint. The standard log/syslog writes
+// the older BSD format and is not available on Windows, so the messages are
+// formatted here.
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// AppName is the APP-NAME field of every message.
+const AppName = "db-connect-checker"
+
+// sdID identifies the structured data element; 32473 is the enterprise
+// number reserved for documentation (RFC 5612).
+const sdID = "check@32473"
+
+const (
+	severityError = 3
+	severityInfo  = 6
+)
+
+// Facilities maps the facility names accepted by Dial to their codes.
+var Facilities = map[string]int{
+	"user":   1,
+	"daemon": 3,
+	"local0": 16,
+	"local1": 17,
+	"local2": 18,
+	"local3": 19,
+	"local4": 20,
+	"local5": 21,
+	"local6": 22,
+	"local7": 23,
+}
+
+// Writer sends messages to one syslog endpoint. It is safe for concurrent
+// use.
+type Writer struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	pid      int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// Dial connects to addr, given as udp://host:port, tcp://host:port or
+// unix:///path (e.g. unix:///dev/log for the local daemon). Messages over TCP
+// are framed by octet counting (RFC 6587).
+func Dial(addr, facility string) (*Writer, error) {
+	code, ok := Facilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unsupported syslog facility %q", facility)
+	}
+	network, address, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	w := &Writer{network: network, address: address, facility: code, hostname: hostname, pid: os.Getpid()}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func parseAddr(addr string) (network, address string, err error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %q: %v", addr, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: host is empty", addr)
+		}
+		if u.Port() == "" {
+			return u.Scheme, net.JoinHostPort(u.Hostname(), "514"), nil
+		}
+		return u.Scheme, u.Host, nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: path is empty", addr)
+		}
+		return "unixgram", u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog address %q: scheme must be udp, tcp or unix", addr)
+	}
+}
+
+// connect opens the connection; w.mu must be held or w not yet shared.
+func (w *Writer) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("connecting to syslog: %v", err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// Observe sends one check result. It makes Writer a checker.Sink.
+func (w *Writer) Observe(ctx context.Context, target types.Target, result types.Result) {
+	if err := w.Send(audit.NewEntry(time.Now(), target, result)); err != nil {
+		log.Error("Error sending to syslog", log.Target(target), "error", err)
+	}
+}
+
+// Send writes entry as one message, reconnecting once if the write fails
+// (e.g. after the TCP peer restarted).
+func (w *Writer) Send(entry audit.Entry) error {
+	msg := format(w.facility, w.hostname, w.pid, entry)
+	if w.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		if _, err := w.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	if _, err := w.conn.Write([]byte(msg)); err != nil {
+		return fmt.Errorf("writing to syslog: %v", err)
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// format renders entry as an RFC 5424 message: failures are sent with
+// severity err, successes with info.
+func format(facility int, hostname string, pid int, entry audit.Entry) string {
+	severity := severityInfo
+	msg := fmt.Sprintf("%s: %s", entry.Target, entry.Outcome)
+	if entry.Outcome != "success" {
+		severity = severityError
+		msg += " (" + entry.ErrorClass + ")"
+	}
+
+	var sd strings.Builder
+	sd.WriteString("[" + sdID)
+	for _, param := range [][2]string{
+		{"target", entry.Target},
+		{"type", entry.Type},
+		{"outcome", entry.Outcome},
+		{"latency_seconds", strconv.FormatFloat(entry.LatencySeconds, 'f', -1, 64)},
+		{"error_class", entry.ErrorClass},
+	} {
+		if param[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&sd, " %s=\"%s\"", param[0], escapeParam(param[1]))
+	}
+	sd.WriteString("]")
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d check %s %s",
+		facility*8+severity,
+		entry.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		hostname, AppName, pid, sd.String(), msg)
+}
+
+// escapeParam escapes the characters RFC 5424 does not allow unescaped in
+// a PARAM-VALUE.
+func escapeParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
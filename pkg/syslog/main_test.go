@@ -0,0 +1,169 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 120000000, time.UTC)
+
+	tests := []struct {
+		name     string
+		facility int
+		entry    audit.Entry
+		want     string
+	}{
+		{
+			name:     "success",
+			facility: 3,
+			entry:    audit.Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Outcome: "success", LatencySeconds: 0.012},
+			want:     `<30>1 2024-05-01T10:00:00.120000Z host db-connect-checker 42 check [check@32473 target="mysql db:3306/app" type="mysql" outcome="success" latency_seconds="0.012"] mysql db:3306/app: success`,
+		},
+		{
+			name:     "failure",
+			facility: 16,
+			entry:    audit.Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Outcome: "failure", LatencySeconds: 5, ErrorClass: "timeout"},
+			want:     `<131>1 2024-05-01T10:00:00.120000Z host db-connect-checker 42 check [check@32473 target="mysql db:3306/app" type="mysql" outcome="failure" latency_seconds="5" error_class="timeout"] mysql db:3306/app: failure (timeout)`,
+		},
+		{
+			name:     "escaped values",
+			facility: 1,
+			entry:    audit.Entry{Time: now, Target: `mock mock/a"b]c\d`, Type: "mock", Outcome: "success"},
+			want:     `<14>1 2024-05-01T10:00:00.120000Z host db-connect-checker 42 check [check@32473 target="mock mock/a\"b\]c\\d" type="mock" outcome="success" latency_seconds="0"] mock mock/a"b]c\d: success`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := format(tt.facility, "host", 42, tt.entry); got != tt.want {
+				t.Errorf("format() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr        string
+		wantNetwork string
+		wantAddress string
+		wantErr     bool
+	}{
+		{addr: "udp://syslog:514", wantNetwork: "udp", wantAddress: "syslog:514"},
+		{addr: "udp://syslog", wantNetwork: "udp", wantAddress: "syslog:514"},
+		{addr: "tcp://10.0.0.1:601", wantNetwork: "tcp", wantAddress: "10.0.0.1:601"},
+		{addr: "unix:///dev/log", wantNetwork: "unixgram", wantAddress: "/dev/log"},
+		{addr: "syslog:514", wantErr: true},
+		{addr: "http://syslog:514", wantErr: true},
+		{addr: "udp://", wantErr: true},
+		{addr: "unix://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			network, address, err := parseAddr(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAddr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if network != tt.wantNetwork || address != tt.wantAddress {
+				t.Errorf("parseAddr() = %q, %q, want %q, %q", network, address, tt.wantNetwork, tt.wantAddress)
+			}
+		})
+	}
+}
+
+func TestDialUnsupportedFacility(t *testing.T) {
+	if _, err := Dial("udp://127.0.0.1:514", "mail"); err == nil {
+		t.Error("Dial() with facility mail succeeded, want error")
+	}
+}
+
+var target = types.Target{Type: "mock", Host: "mock", Database: "smoke"}
+
+func TestObserveUDP(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	w, err := Dial("udp://"+server.LocalAddr().String(), "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Observe(context.Background(), target, types.Result{Reason: "timeout"})
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<27>1 ") || !strings.HasSuffix(msg, `error_class="timeout"] mock mock/smoke: failure (timeout)`) {
+		t.Errorf("received %q, want a daemon.err message about mock mock/smoke", msg)
+	}
+}
+
+func TestObserveTCPReconnects(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	w, err := Dial("tcp://"+server.Addr().String(), "local0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// The first connection is dropped by the server, the next message must
+	// arrive over a new one.
+	first, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	for i := 0; i < 10; i++ {
+		w.Observe(context.Background(), target, types.Result{Success: true})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	second, err := server.Accept()
+	if err != nil {
+		t.Fatalf("no reconnect: %v", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Octet counting: "LEN MSG".
+	reader := bufio.NewReader(second)
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if _, err := fmt.Sscanf(length, "%d ", &n); err != nil {
+		t.Fatalf("frame starts with %q, want length", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(msg), "<134>1 ") || !strings.HasSuffix(string(msg), "mock mock/smoke: success") {
+		t.Errorf("received %q, want a local0.info message about mock mock/smoke", msg)
+	}
+}
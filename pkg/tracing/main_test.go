@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler sdktrace.Sampler
+		wantID  bool
+	}{
+		{name: "sampled span", sampler: sdktrace.AlwaysSample(), wantID: true},
+		{name: "unsampled span", sampler: sdktrace.NeverSample(), wantID: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(tt.sampler))
+			ctx, span := provider.Tracer("test").Start(context.Background(), "check")
+			defer span.End()
+
+			id := TraceID(ctx)
+			if (id != "") != tt.wantID {
+				t.Errorf("TraceID() = %q, want trace ID: %v", id, tt.wantID)
+			}
+			if tt.wantID && id != span.SpanContext().TraceID().String() {
+				t.Errorf("TraceID() = %q, want %q", id, span.SpanContext().TraceID())
+			}
+		})
+	}
+
+	if id := TraceID(context.Background()); id != "" {
+		t.Errorf("TraceID() without span = %q, want empty", id)
+	}
+}
@@ -0,0 +1,278 @@
+// Package trinocheck checks Trino and Presto coordinators through their HTTP
+// protocol: it runs SELECT 1 and optionally counts the active workers, since
+// a coordinator without workers accepts connections but cannot run queries
+// that read data.
+package trinocheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/ratelimit"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+	"github.com/tapclap/db-connect-checker/pkg/util"
+	"github.com/tapclap/db-connect-checker/pkg/version"
+)
+
+// workersQuery counts the workers that accept tasks. The coordinator is not
+// counted, even if it also schedules work on itself.
+const workersQuery = "SELECT count(*) FROM system.runtime.nodes WHERE coordinator = false AND state = 'active'"
+
+// Error classes wrapped by check errors, see util.WithClass. A missing
+// catalog or schema is reported as unknown database.
+var (
+	ErrAuthFailed      = util.ErrAuthFailed
+	ErrUnknownDatabase = util.ErrUnknownDatabase
+	ErrDNS             = util.ErrDNS
+	ErrTimeout         = util.ErrTimeout
+	ErrTLS             = util.ErrTLS
+	// ErrTooFewWorkers fails checks with the min_workers option if fewer
+	// workers are active.
+	ErrTooFewWorkers = util.ErrTooFewWorkers
+)
+
+// Names of Trino errors with an error class.
+var (
+	authErrors = map[string]bool{
+		"PERMISSION_DENIED": true,
+	}
+	unknownDatabaseErrors = map[string]bool{
+		"CATALOG_NOT_FOUND": true,
+		"SCHEMA_NOT_FOUND":  true,
+	}
+)
+
+// Error is a failed query or a request rejected by the coordinator.
+type Error struct {
+	// Code is the HTTP status code.
+	Code int
+	// Name is the error name of a failed query, e.g. CATALOG_NOT_FOUND.
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("trino error (HTTP %d): %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("trino error %s: %s", e.Name, e.Message)
+}
+
+// defaultTimeout limits a check: SELECT 1, which may wait in a queue, and
+// counting the workers.
+const defaultTimeout = 30 * time.Second
+
+// Check runs SELECT 1 on the Trino coordinator of target as its user, in its
+// catalog (Database) and schema option, if set. With a min_workers option
+// above zero it then fails with ErrTooFewWorkers if fewer workers are
+// active. The phases are the query and the worker count.
+func Check(ctx context.Context, target types.Target, opts ...checkbase.Option) types.Result {
+	o := checkbase.New(defaultTimeout, opts)
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	minWorkers := 0
+	if value := target.Options["min_workers"]; value != "" {
+		var err error
+		if minWorkers, err = strconv.Atoi(value); err != nil {
+			return newResult(nil, "", retry.Permanent(fmt.Errorf("invalid min_workers %q: %w", value, err)))
+		}
+	}
+	tlsConfig, err := targetTLSConfig(target)
+	if err != nil {
+		return newResult(nil, "", retry.Permanent(err))
+	}
+	if err := ratelimit.Wait(ctx); err != nil {
+		return newResult(nil, "", err)
+	}
+
+	transport := o.Transport(tlsConfig)
+	defer transport.CloseIdleConnections()
+	scheme := "http"
+	if target.TLS {
+		scheme = "https"
+	}
+	c := &client{http: &http.Client{Transport: transport}, target: target, baseURL: scheme + "://" + net.JoinHostPort(target.Host, target.Port)}
+
+	phases := []types.Phase{}
+	start := time.Now()
+	_, serverVersion, err := c.query(ctx, "SELECT 1")
+	phases = append(phases, types.Phase{Name: "query", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, serverVersion, fmt.Errorf("error query: %w", err))
+	}
+	if minWorkers <= 0 {
+		return newResult(phases, serverVersion, nil)
+	}
+
+	start = time.Now()
+	rows, _, err := c.query(ctx, workersQuery)
+	phases = append(phases, types.Phase{Name: "workers", Duration: time.Since(start)})
+	if err != nil {
+		return newResult(phases, serverVersion, fmt.Errorf("error counting workers: %w", err))
+	}
+	var workers int
+	if len(rows) != 1 || len(rows[0]) != 1 || json.Unmarshal(rows[0][0], &workers) != nil {
+		return newResult(phases, serverVersion, fmt.Errorf("unexpected worker count %v", rows))
+	}
+	if workers < minWorkers {
+		return newResult(phases, serverVersion, util.WithClass(ErrTooFewWorkers, fmt.Errorf("%d active workers, fewer than %d", workers, minWorkers)))
+	}
+	return newResult(phases, serverVersion, nil)
+}
+
+// targetTLSConfig returns the TLS config of target: its TLSConfig, or one
+// trusting the CA bundle of TLSCAFile, or the system roots if neither is set.
+func targetTLSConfig(target types.Target) (*tls.Config, error) {
+	if !target.TLS || target.TLSConfig != nil {
+		return target.TLSConfig, nil
+	}
+	if target.TLSCAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(target.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificate in %s", target.TLSCAFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// client runs statements with the Trino client protocol.
+type client struct {
+	http    *http.Client
+	target  types.Target
+	baseURL string
+}
+
+// queryResults is a page of the results of a statement.
+type queryResults struct {
+	NextURI string              `json:"nextUri"`
+	Data    [][]json.RawMessage `json:"data"`
+	Error   *struct {
+		Message   string `json:"message"`
+		ErrorName string `json:"errorName"`
+	} `json:"error"`
+}
+
+// query submits statement and follows the pages of its results until the
+// last one. It returns the rows and the server version.
+func (c *client) query(ctx context.Context, statement string) ([][]json.RawMessage, string, error) {
+	rows := [][]json.RawMessage{}
+	results, serverVersion, err := c.do(ctx, http.MethodPost, c.baseURL+"/v1/statement", statement)
+	for err == nil {
+		if results.Error != nil {
+			return nil, serverVersion, &Error{Code: http.StatusOK, Name: results.Error.ErrorName, Message: results.Error.Message}
+		}
+		rows = append(rows, results.Data...)
+		if results.NextURI == "" {
+			return rows, serverVersion, nil
+		}
+		results, _, err = c.do(ctx, http.MethodGet, results.NextURI, "")
+	}
+	return nil, serverVersion, err
+}
+
+// do sends one request of the protocol. Statements are sent with the user,
+// credentials, catalog and schema of the target, using both the Trino and
+// the older Presto header names. It returns the results and the server
+// version.
+func (c *client) do(ctx context.Context, method, endpoint, statement string) (*queryResults, string, error) {
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(statement))
+	if err != nil {
+		return nil, "", err
+	}
+	request.Header.Set("User-Agent", "db-connect-checker/"+version.Version)
+	headers := map[string]string{
+		"User":    c.target.User,
+		"Source":  "db-connect-checker",
+		"Catalog": c.target.Database,
+		"Schema":  c.target.Options["schema"],
+	}
+	for name, value := range headers {
+		if value != "" {
+			request.Header.Set("X-Trino-"+name, value)
+			request.Header.Set("X-Presto-"+name, value)
+		}
+	}
+	if token := c.target.Options["token"]; token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	} else if c.target.Pass != "" {
+		request.SetBasicAuth(c.target.User, c.target.Pass)
+	}
+
+	resp, err := c.http.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	serverVersion := resp.Header.Get("X-Trino-Server-Version")
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, serverVersion, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(content))
+		if message == "" {
+			message = resp.Status
+		}
+		return nil, serverVersion, &Error{Code: resp.StatusCode, Message: message}
+	}
+	results := &queryResults{}
+	if err := json.Unmarshal(content, results); err != nil {
+		return nil, serverVersion, fmt.Errorf("invalid answer: %w", err)
+	}
+	return results, serverVersion, nil
+}
+
+func newResult(phases []types.Phase, version string, err error) types.Result {
+	return checkbase.Result(phases, version, err, ErrorReason)
+}
+
+// ErrorReason returns a short human readable class of a check error,
+// e.g. "auth error" or "too few workers".
+func ErrorReason(err error) string {
+	var trinoErr *Error
+	if errors.As(err, &trinoErr) {
+		if authErrors[trinoErr.Name] || trinoErr.Code == http.StatusUnauthorized || trinoErr.Code == http.StatusForbidden {
+			return "auth error"
+		}
+		if unknownDatabaseErrors[trinoErr.Name] {
+			return "unknown database"
+		}
+	}
+	if retry.IsPermanent(err) {
+		return "invalid config"
+	}
+	return util.NetErrorReason(err)
+}
+
+// Retryable reports whether another attempt may succeed. Authentication
+// failures, missing catalogs or schemas and invalid configs are not
+// retryable; too few workers are, as workers may still be starting.
+func Retryable(err error) bool {
+	if err == nil || retry.IsPermanent(err) {
+		return false
+	}
+	switch ErrorReason(err) {
+	case "auth error", "unknown database":
+		return false
+	}
+	return true
+}
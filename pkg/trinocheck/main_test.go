@@ -0,0 +1,158 @@
+package trinocheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/checkbase"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// fakeTrino answers like a Trino coordinator with the given number of active
+// workers, the catalog hive with the schema default and the user checker,
+// whose token is secret. Every statement is queued once before its results.
+func fakeTrino(t *testing.T, workers int) types.Target {
+	t.Helper()
+	var server *httptest.Server
+	failed := func(name, message string) map[string]interface{} {
+		return map[string]interface{}{"id": "q", "stats": map[string]string{"state": "FAILED"}, "error": map[string]string{"errorName": name, "message": message}}
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Trino-Server-Version", "435")
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Trino-User") != "checker" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized"))
+			return
+		}
+		var results map[string]interface{}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/statement":
+			statement, _ := io.ReadAll(r.Body)
+			results = map[string]interface{}{"id": "q", "stats": map[string]string{"state": "QUEUED"}, "nextUri": server.URL + "/v1/statement/queued/q?statement=" + url.QueryEscape(string(statement))}
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/statement/queued/q":
+			catalog, schema := r.Header.Get("X-Trino-Catalog"), r.Header.Get("X-Trino-Schema")
+			switch statement := r.URL.Query().Get("statement"); {
+			case catalog != "" && catalog != "hive":
+				results = failed("CATALOG_NOT_FOUND", fmt.Sprintf("Catalog '%s' does not exist", catalog))
+			case schema != "" && schema != "default":
+				results = failed("SCHEMA_NOT_FOUND", fmt.Sprintf("Schema '%s' does not exist", schema))
+			case statement == "SELECT 1":
+				results = map[string]interface{}{"id": "q", "stats": map[string]string{"state": "FINISHED"}, "data": [][]int{{1}}}
+			case statement == workersQuery:
+				results = map[string]interface{}{"id": "q", "stats": map[string]string{"state": "FINISHED"}, "data": [][]int{{workers}}}
+			default:
+				results = failed("SYNTAX_ERROR", "unexpected statement")
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(results)
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	return types.TrinoConfig{Host: host, Port: port, User: "checker", Token: "secret", Catalog: "hive", Schema: "default"}.Target()
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		workers    int
+		modify     func(target *types.Target)
+		wantReason string
+		wantPhases []string
+	}{
+		{
+			name:       "query",
+			modify:     func(target *types.Target) {},
+			wantPhases: []string{"query"},
+		},
+		{
+			name:       "enough workers",
+			workers:    3,
+			modify:     func(target *types.Target) { target.Options["min_workers"] = "3" },
+			wantPhases: []string{"query", "workers"},
+		},
+		{
+			name:       "too few workers",
+			workers:    2,
+			modify:     func(target *types.Target) { target.Options["min_workers"] = "3" },
+			wantReason: "too few workers",
+			wantPhases: []string{"query", "workers"},
+		},
+		{
+			name:       "missing catalog",
+			modify:     func(target *types.Target) { target.Database = "iceberg" },
+			wantReason: "unknown database",
+			wantPhases: []string{"query"},
+		},
+		{
+			name:       "missing schema",
+			modify:     func(target *types.Target) { target.Options["schema"] = "missing" },
+			wantReason: "unknown database",
+			wantPhases: []string{"query"},
+		},
+		{
+			name:       "wrong token",
+			modify:     func(target *types.Target) { target.Options["token"] = "wrong" },
+			wantReason: "auth error",
+			wantPhases: []string{"query"},
+		},
+		{
+			name:       "invalid worker count",
+			modify:     func(target *types.Target) { target.Options["min_workers"] = "all" },
+			wantReason: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fakeTrino(t, tt.workers)
+			tt.modify(&target)
+
+			result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+			if result.Reason != tt.wantReason || result.Success != (tt.wantReason == "") {
+				t.Fatalf("Check() = %v (%q), want reason %q", result.Err, result.Reason, tt.wantReason)
+			}
+			if retryable := tt.wantReason == "too few workers"; tt.wantReason != "" && Retryable(result.Err) != retryable {
+				t.Errorf("Retryable(%v) = %v, want %v", result.Err, !retryable, retryable)
+			}
+			phases := []string{}
+			for _, phase := range result.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if strings.Join(phases, ",") != strings.Join(tt.wantPhases, ",") {
+				t.Errorf("phases = %v, want %v", phases, tt.wantPhases)
+			}
+			if len(result.Phases) > 0 && result.ServerVersion != "435" {
+				t.Errorf("ServerVersion = %q", result.ServerVersion)
+			}
+		})
+	}
+}
+
+func TestCheckUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	host, port, _ := net.SplitHostPort(addr)
+	target := types.TrinoConfig{Host: host, Port: port, User: "checker", MinWorkers: 1}.Target()
+	result := Check(context.Background(), target, checkbase.WithTimeout(5*time.Second))
+	if result.Reason != "connection refused" || !Retryable(result.Err) {
+		t.Errorf("Check() = %v (%q), want retryable connection refused", result.Err, result.Reason)
+	}
+}
@@ -2,14 +2,329 @@ package types
 
 import (
 	"crypto/tls"
+	"time"
 )
 
+// Struct tags describe how a field is read from the environment:
+//   - env: variable name (indexed targets append "_N")
+//   - default: value used when the variable is not set (time.Duration fields
+//     accept "30s" or a plain number of seconds)
+//   - required: "true" if the target is incomplete without it
+//   - oneof: comma separated list of allowed values
+//   - format: "port" for TCP ports, "cron" for cron expressions, "template"
+//     for message templates, "labels" for OWNER_LABELS, "variables" for
+//     MYSQL_EXPECT_VARIABLES, "credentials" for MYSQL_EXTRA_USERS,
+//     "factors" for RETRY_BACKOFF_FACTORS, "topic" for MQTT_TOPIC, "routes"
+//     for NOTIFY_ROUTES, "escalation" for NOTIFY_ESCALATION
+//   - desc: one line description used by `config init`
+//
+// Fields without an env tag are derived at runtime.
+
+// Settings are the global (not per target) options.
+type Settings struct {
+	DBTypes                   string        `env:"DB_TYPES" default:"" desc:"Comma separated database types to check, e.g. mysql,mongodb; inferred from the configured databases if empty"`
+	DBType                    string        `env:"DB_TYPE" default:"" oneof:",mysql,mongodb" desc:"Deprecated, use DB_TYPES: checks MySQL and the given type"`
+	Mode                      string        `env:"MODE" default:"" oneof:",init,controller,readiness-gate,readiness-file" desc:"Run mode: empty for one-shot check, init for Kubernetes initContainer, controller for DatabaseCheck resources, readiness-gate or readiness-file for a sidecar reporting current availability"`
+	Exporter                  bool          `env:"EXPORTER" default:"false" desc:"Run Prometheus exporter instead of one-shot check"`
+	Tries                     int           `env:"TRIES" default:"10" desc:"Connection attempts in one-shot mode"`
+	RetryBase                 time.Duration `env:"RETRY_BASE" default:"" desc:"First sleep between attempts, e.g. 1s; switches one-shot mode from linear to exponential backoff"`
+	RetryMultiplier           float64       `env:"RETRY_MULTIPLIER" default:"" desc:"Growth factor of sleeps between attempts; switches one-shot mode from linear to exponential backoff"`
+	RetryJitter               string        `env:"RETRY_JITTER" default:"" oneof:",none,full,equal" desc:"Randomization of sleeps between attempts: full in [0, d], equal in [d/2, d], none; empty keeps the mode default"`
+	RetryBackoffFactors       string        `env:"RETRY_BACKOFF_FACTORS" default:"too many connections=4,host blocked=4,auth throttled=8" format:"factors" desc:"Comma separated reason=factor pairs multiplying the sleep after failures of that reason, so overloaded or throttling servers get more time than refused connections; none disables them"`
+	RetryMaxSleep             time.Duration `env:"RETRY_MAX_SLEEP" default:"" desc:"Upper limit for a single sleep between attempts, e.g. 30s"`
+	AttemptTimeout            time.Duration `env:"ATTEMPT_TIMEOUT" default:"" desc:"How long a single connection attempt, connecting and running the check queries, may take before it fails with a timeout, e.g. 3s; TRIES, MAX_WAIT and CHECK_ATTEMPTS limit the attempts on top of it; empty keeps the default of the database type, 5s for MySQL"`
+	ConnectTimeout            time.Duration `env:"CONNECT_TIMEOUT" default:"" desc:"How long connecting to a MySQL or MongoDB database, including TLS and authentication, may take in one attempt, e.g. 2s; ATTEMPT_TIMEOUT still limits the whole attempt; empty sets no separate limit"`
+	QueryTimeout              time.Duration `env:"QUERY_TIMEOUT" default:"" desc:"How long the queries of one attempt against a MySQL or MongoDB database may take after connecting, e.g. 10s; ATTEMPT_TIMEOUT still limits the whole attempt; empty sets no separate limit"`
+	ConnectRate               float64       `env:"CONNECT_RATE" default:"0" desc:"Maximum connection attempts per second across all targets and retries, unlimited if 0"`
+	ConnectBurst              int           `env:"CONNECT_BURST" default:"10" desc:"Connection attempts allowed at once before CONNECT_RATE applies"`
+	WaitFor                   string        `env:"WAIT_FOR" default:"available" oneof:"available,unavailable" desc:"Wait until databases become available or unavailable"`
+	WaitForAny                bool          `env:"WAIT_FOR_ANY" default:"false" desc:"Succeed once any database of each type is reachable"`
+	MaxWait                   int           `env:"MAX_WAIT" default:"300" desc:"Total time budget in seconds for MODE=init"`
+	ProgressInterval          int           `env:"PROGRESS_INTERVAL" default:"30" desc:"Seconds between progress logs in MODE=init"`
+	ExporterPort              string        `env:"EXPORTER_PORT" default:"38080" format:"port" desc:"Exporter HTTP port"`
+	CheckInterval             int           `env:"CHECK_INTERVAL" default:"30" desc:"Seconds between exporter checks"`
+	CheckIntervalMin          time.Duration `env:"CHECK_INTERVAL_MIN" default:"" desc:"Shortest interval between exporter checks of a database: databases whose last check failed are checked this often, e.g. 5s; enables adaptive intervals together with CHECK_INTERVAL_MAX"`
+	CheckIntervalMax          time.Duration `env:"CHECK_INTERVAL_MAX" default:"" desc:"Longest interval between exporter checks of a database: every successful check doubles the interval up to this, e.g. 5m; enables adaptive intervals together with CHECK_INTERVAL_MIN"`
+	CheckSchedule             string        `env:"CHECK_SCHEDULE" default:"" format:"cron" desc:"Cron expression for exporter checks, e.g. \"*/5 * * * *\", used instead of CHECK_INTERVAL"`
+	CheckAttempts             int           `env:"CHECK_ATTEMPTS" default:"1" desc:"Connection attempts in one exporter check of a database; the check fails only if all of them fail"`
+	CheckRetryDelay           time.Duration `env:"CHECK_RETRY_DELAY" default:"1s" desc:"Pause between attempts of one exporter check"`
+	ConfirmStateChanges       bool          `env:"CONFIRM_STATE_CHANGES" default:"false" desc:"Check a database again right away when an exporter check finds it went down or came back, and report the result of the second check, so that a one-off network blip does not flip its state"`
+	ProbeCacheTTL             time.Duration `env:"PROBE_CACHE_TTL" default:"10s" desc:"How long /probe reuses a check result before connecting again"`
+	CredentialsRefresh        time.Duration `env:"CREDENTIALS_REFRESH" default:"1m" desc:"How long the exporter uses the MySQL user and password read from a TARGETS_DIR entry before reading them again; they are also read again right after an auth error, so rotated passwords are picked up without a restart; 0 reads them only at startup"`
+	SimulateFailure           string        `env:"SIMULATE_FAILURE" default:"" desc:"Daily windows in which exporter checks of a database fail without connecting, e.g. \"db:3306/app@14:00-14:05\", for testing alerts"`
+	SimulateEndpoint          bool          `env:"SIMULATE_ENDPOINT" default:"false" desc:"Expose /simulate to force or clear simulated failures of a database over HTTP; requires TARGETS_API_TOKEN"`
+	TargetsAPIToken           string        `env:"TARGETS_API_TOKEN" default:"" desc:"Bearer token for /targets, which adds and removes exporter targets at runtime and saves them in TARGETS_DIR; empty disables the endpoint"`
+	OutputFormat              string        `env:"OUTPUT_FORMAT" default:"text" oneof:"text,annotations" desc:"annotations also prints the outcome of the one-shot mode as GitHub Actions style workflow commands (::error title=DB unreachable::...), so CI pipelines show failed databases as annotated errors"`
+	ResultFile                string        `env:"RESULT_FILE" default:"" desc:"File the one-shot mode writes the outcome of every target to as JSON when it finishes, e.g. on a volume shared with other containers; empty disables it"`
+	RemoteWriteURL            string        `env:"REMOTE_WRITE_URL" default:"" desc:"Prometheus remote write endpoint the exporter pushes its metrics to, e.g. https://mimir/api/v1/push, for sites without a Prometheus to scrape it; user:password@ in the URL enables basic auth; empty disables pushing"`
+	RemoteWriteInterval       time.Duration `env:"REMOTE_WRITE_INTERVAL" default:"30s" desc:"Pause between remote write pushes"`
+	RemoteWriteBearerToken    string        `env:"REMOTE_WRITE_BEARER_TOKEN" default:"" desc:"Bearer token of remote write requests"`
+	RemoteWriteTenant         string        `env:"REMOTE_WRITE_TENANT" default:"" desc:"Tenant of remote write requests, sent as X-Scope-OrgID (Mimir, Cortex, Thanos Receive)"`
+	InfluxURL                 string        `env:"INFLUX_URL" default:"" desc:"HTTP write endpoint receiving every check result in InfluxDB line protocol, once per CHECK_INTERVAL, e.g. http://influxdb:8086/api/v2/write?org=ops&bucket=db or http://victoriametrics:8428/write; empty disables it"`
+	InfluxToken               string        `env:"INFLUX_TOKEN" default:"" desc:"InfluxDB 2.x API token of INFLUX_URL"`
+	InfluxMeasurement         string        `env:"INFLUX_MEASUREMENT" default:"db_connection" desc:"Measurement of the lines written to INFLUX_URL"`
+	MQTTBroker                string        `env:"MQTT_BROKER" default:"" desc:"MQTT broker that receives every connection attempt as a JSON message: tcp://host:1883 or ssl://host:8883, user:password@ for authentication; empty disables MQTT"`
+	MQTTTopic                 string        `env:"MQTT_TOPIC" default:"db-connect-checker/{{.Hostname}}/{{.Type}}/{{.Host}}/{{.Database}}" format:"topic" desc:"Go text/template for the topic of MQTT messages; fields: Type, Host, Port, Database, Hostname, Labels"`
+	MQTTQoS                   int           `env:"MQTT_QOS" default:"0" oneof:"0,1,2" desc:"Quality of service of MQTT messages: 0 sends them without confirmation, 1 and 2 wait for the broker to acknowledge them"`
+	MQTTRetain                bool          `env:"MQTT_RETAIN" default:"false" desc:"Make the broker keep the last message of every topic for subscribers that connect later"`
+	MQTTClientID              string        `env:"MQTT_CLIENT_ID" default:"" desc:"Client identifier of the MQTT connection, db-connect-checker-<hostname> if empty"`
+	KafkaBrokers              string        `env:"KAFKA_BROKERS" default:"" desc:"Comma separated host:port of Kafka brokers that receive check results as JSON events; empty disables Kafka"`
+	KafkaTopic                string        `env:"KAFKA_TOPIC" default:"db-connect-checker" desc:"Kafka topic of the events"`
+	KafkaEvents               string        `env:"KAFKA_EVENTS" default:"changes" oneof:"changes,checks" desc:"changes sends an event for the first check of a database and when it becomes available or unavailable, checks one for every check"`
+	KafkaTLS                  bool          `env:"KAFKA_TLS" default:"false" desc:"Connect to the Kafka brokers using TLS"`
+	KafkaSASLMechanism        string        `env:"KAFKA_SASL_MECHANISM" default:"plain" oneof:"plain,scram-sha-256,scram-sha-512" desc:"SASL mechanism used when KAFKA_SASL_USER is set"`
+	KafkaSASLUser             string        `env:"KAFKA_SASL_USER" default:"" desc:"SASL user of the Kafka connection, empty disables SASL"`
+	KafkaSASLPassword         string        `env:"KAFKA_SASL_PASSWORD" default:"" desc:"SASL password of the Kafka connection"`
+	AuditLog                  string        `env:"AUDIT_LOG" default:"" desc:"File to append every connection attempt to as a JSON line, empty disables the audit log"`
+	AuditLogMaxSize           int           `env:"AUDIT_LOG_MAX_SIZE" default:"100" desc:"Size in megabytes after which the audit log is rotated, 0 disables rotation"`
+	AuditLogMaxBackups        int           `env:"AUDIT_LOG_MAX_BACKUPS" default:"5" desc:"Number of rotated audit log files to keep"`
+	SyslogAddr                string        `env:"SYSLOG_ADDR" default:"" desc:"Syslog endpoint that receives every connection attempt as an RFC 5424 message: udp://host:port, tcp://host:port or unix:///dev/log; empty disables syslog"`
+	SyslogFacility            string        `env:"SYSLOG_FACILITY" default:"daemon" oneof:"user,daemon,local0,local1,local2,local3,local4,local5,local6,local7" desc:"Facility of syslog messages"`
+	WindowsEventLog           bool          `env:"WINDOWS_EVENT_LOG" default:"false" desc:"Write every connection attempt to the Windows Event Log (source registered by \"service install\"), Windows only"`
+	LogFormat                 string        `env:"LOG_FORMAT" default:"text" oneof:"text,json" desc:"Format of log records on stderr: text (key=value pairs) or json (one JSON object per line)"`
+	LogLevel                  string        `env:"LOG_LEVEL" default:"info" oneof:"debug,info,warn,error" desc:"Least severe level of log records that are written"`
+	LogTemplate               string        `env:"LOG_TEMPLATE" default:"" format:"template" desc:"Go text/template for the line logged after every connection attempt, e.g. \"{{.Target}} attempt={{.Attempt}} error={{.Error}}\"; fields: Target, Attempt, Tries, Error, Reason, Severity, Duration, Sleep, Labels"`
+	NotifyTemplate            string        `env:"NOTIFY_TEMPLATE" default:"" format:"template" desc:"Go text/template for the message of DatabaseUnreachable Events, Slack messages and PagerDuty alerts; fields: Target, Error, Reason, Severity (empty in Events), Labels"`
+	SlackWebhookURL           string        `env:"SLACK_WEBHOOK_URL" default:"" format:"url" desc:"Slack incoming webhook that gets a message when a database becomes unreachable, fails for another reason or recovers; empty disables Slack"`
+	PagerDutyRoutingKey       string        `env:"PAGERDUTY_ROUTING_KEY" default:"" desc:"Integration key of a PagerDuty Events API v2 service that gets an alert when a database becomes unreachable, resolved when it recovers; empty disables PagerDuty"`
+	NotifyRoutes              string        `env:"NOTIFY_ROUTES" default:"" format:"routes" desc:"Routes of check results to sinks by target labels, separated by semicolons, e.g. \"env=prod:pagerduty,slack;env=staging:slack\"; patterns match the labels of the config file and type, host, port, database, severity and target; sinks: audit, syslog, mqtt, kafka, eventlog, influx, slack, pagerduty; a sink no route names gets every result"`
+	NotifyEscalation          string        `env:"NOTIFY_ESCALATION" default:"" format:"escalation" desc:"Delays before the failures of a database reach a sink in exporter mode, as comma separated sink=duration pairs, e.g. \"slack=2m,pagerduty=10m\" to post to Slack after 2 minutes down and page after 10; a sink without a delay gets failures at once"`
+	OwnerLabels               string        `env:"OWNER_LABELS" default:"" format:"labels" desc:"Comma separated name=value labels added to every exporter metric and Kubernetes Event, e.g. team=payments,namespace=${POD_NAMESPACE},node=file:/etc/podinfo/nodename; file:<path>#<key> reads a downward API labels file"`
+	MaxClockSkew              time.Duration `env:"MAX_CLOCK_SKEW" default:"" desc:"Compare the server clock of MySQL and MongoDB databases with the local one after every successful check and fail the check if they differ by more than this, e.g. 2s; empty disables the check"`
+	MinFreeSpace              float64       `env:"MIN_FREE_SPACE" default:"0" desc:"Fail one-shot and init checks of MySQL databases whose tables have less free space in their tablespaces than this percentage of the tablespace size; the exporter exports the sizes as metrics; 0 disables the check"`
+	LongQueryThreshold        time.Duration `env:"LONG_QUERY_THRESHOLD" default:"" desc:"Export the number of MySQL queries running for at least this long and of sessions waiting for locks in exporter mode, e.g. 30s; needs the PROCESS privilege; empty disables it"`
+	MaxThreadsConnected       int           `env:"MAX_THREADS_CONNECTED" default:"0" desc:"Fail one-shot and init checks of MySQL databases with more Threads_connected, so deploys wait while the database is saturated; the exporter exports the thread counts as metrics; 0 disables the limit"`
+	MaxThreadsRunning         int           `env:"MAX_THREADS_RUNNING" default:"0" desc:"Like MAX_THREADS_CONNECTED for Threads_running"`
+	MaxFlowControlPaused      float64       `env:"MAX_FLOW_CONTROL_PAUSED" default:"0" desc:"Fail one-shot and init checks of Percona XtraDB Cluster nodes paused by flow control for more than this fraction of the time, e.g. 0.1; the exporter exports the flow control status as metrics; 1 only exports the metrics, 0 disables both"`
+	ReresolveDNS              bool          `env:"RERESOLVE_DNS" default:"false" desc:"Look up database host names afresh with the Go resolver before every connection, bypassing caches of the system resolver, so checks follow DNS based failovers"`
+	DNSServer                 string        `env:"DNS_SERVER" default:"" desc:"host:port of the DNS server asked with RERESOLVE_DNS; empty uses /etc/resolv.conf"`
+	CircuitBreakerFailures    int           `env:"CIRCUIT_BREAKER_FAILURES" default:"0" desc:"Consecutive failures after which exporter checks of a database are suspended, 0 disables the circuit breaker"`
+	CircuitBreakerCooldown    time.Duration `env:"CIRCUIT_BREAKER_COOLDOWN" default:"1m" desc:"Pause before the first probe of a suspended database; doubles after every failed probe"`
+	CircuitBreakerMaxCooldown time.Duration `env:"CIRCUIT_BREAKER_MAX_COOLDOWN" default:"10m" desc:"Upper limit for the pause between probes of a suspended database"`
+	ShutdownTimeout           int           `env:"SHUTDOWN_TIMEOUT" default:"10" desc:"Seconds to drain requests and checks on SIGTERM"`
+	Tracing                   bool          `env:"TRACING" default:"false" desc:"Export check spans over OTLP (OTEL_EXPORTER_OTLP_* variables) and attach trace IDs as exemplars"`
+	HealthcheckTimeout        int           `env:"HEALTHCHECK_TIMEOUT" default:"2" desc:"Timeout in seconds for --healthcheck"`
+	ControllerNamespace       string        `env:"CONTROLLER_NAMESPACE" default:"" desc:"Namespace watched for DatabaseCheck resources in MODE=controller, all namespaces if empty"`
+	ControllerResync          int           `env:"CONTROLLER_RESYNC" default:"5" desc:"Seconds between DatabaseCheck list requests in MODE=controller"`
+	PodName                   string        `env:"POD_NAME" default:"" desc:"Name of the pod patched in MODE=readiness-gate (from the downward API)"`
+	PodNamespace              string        `env:"POD_NAMESPACE" default:"" desc:"Namespace of the pod patched in MODE=readiness-gate (from the downward API)"`
+	ReadinessGate             string        `env:"READINESS_GATE" default:"dbcheck.tapclap.com/databases-ready" desc:"Pod condition type set in MODE=readiness-gate"`
+	EventTarget               string        `env:"EVENT_TARGET" default:"" desc:"Workload in POD_NAMESPACE (e.g. deployment/orders-api) that gets Kubernetes Events about unreachable databases"`
+	ReadinessFile             string        `env:"READINESS_FILE" default:"/ready/db-ok" desc:"File kept present while all databases are reachable in MODE=readiness-file"`
+	MaxTargetIndex            int           `env:"MAX_TARGET_INDEX" default:"0" desc:"Highest N of indexed _N variables read, skipping incomplete indices below it; 0 stops at the first incomplete index"`
+	TargetsDir                string        `env:"TARGETS_DIR" default:"/etc/db-connect-checker/targets.d" desc:"Directory with one MySQL target per file or per projected Secret directory"`
+	TargetsFile               string        `env:"TARGETS_FILE" default:"" desc:"JSON or YAML list of targets keyed by the variable names without the _N suffix, e.g. [{MYSQL_HOST: db, MYSQL_NAME: app, ...}, {MONGODB_URI: ...}]; - reads it from stdin"`
+	ConfigFile                string        `env:"CONFIG_FILE" default:"" desc:"YAML or JSON config file listing targets of any type with their type, dsn, tls, tls_ca_file, timeout, connect_timeout, query_timeout, tries, labels and further variables in env; checked together with the targets of the environment"`
+}
+
 type MysqlConfig struct {
-	Name      string
-	User      string
-	Pass      string
-	Host      string
-	Port      string
-	TLS       bool
-	TLSConfig *tls.Config
+	Name      string `env:"MYSQL_NAME" required:"true" desc:"Database name"`
+	User      string `env:"MYSQL_USER" required:"true" desc:"User name"`
+	Pass      string `env:"MYSQL_PASS" required:"true" desc:"Password"`
+	Host      string `env:"MYSQL_HOST" required:"true" desc:"Host; with MYSQL_HOSTS it only names the target and defaults to the first endpoint"`
+	Hosts     string `env:"MYSQL_HOSTS" default:"" format:"hosts" desc:"Comma separated endpoints of the same database, host or host:port (MYSQL_PORT if omitted), e.g. db1,db2,db3:3307 like the failover list of a client; they are connected to at the same time and the check succeeds if any of them works"`
+	Port      string `env:"MYSQL_PORT" default:"3306" format:"port" desc:"Port"`
+	TLS       bool   `env:"MYSQL_TLS" default:"false" desc:"Connect using TLS"`
+	TLSCAFile string `env:"MYSQL_TLS_CA_FILE" default:"/etc/ssl/certs/ca-certificates.crt" desc:"CA bundle used when MYSQL_TLS=true"`
+	Schedule  string `env:"MYSQL_CHECK_SCHEDULE" default:"" format:"cron" desc:"Cron expression for this database in exporter mode, overrides CHECK_SCHEDULE"`
+	// ExpectVariables is parsed by ParseVariables.
+	ExpectVariables string `env:"MYSQL_EXPECT_VARIABLES" default:"" format:"variables" desc:"Expected global server variables as name=value pairs separated by semicolons, e.g. \"sql_mode=STRICT_TRANS_TABLES;character_set_server=utf8mb4\""`
+	// ExtraUsers is parsed by ParseCredentials.
+	ExtraUsers      string `env:"MYSQL_EXTRA_USERS" default:"" format:"credentials" desc:"Further users that must be able to connect, as comma separated user:password pairs; passwords may reference variables, e.g. \"migrator:${MIGRATOR_PASS}\""`
+	XPort           string `env:"MYSQL_X_PORT" default:"" format:"port" desc:"X Protocol port (X DevAPI, MySQL Shell) also checked after the classic port, e.g. 33060; the same user must be able to authenticate there; empty disables the check"`
+	AccountHost     string `env:"MYSQL_ACCOUNT_HOST" default:"" desc:"Host part of the account MYSQL_USER should be matched to, e.g. 10.0.%; warns when the server matches another account such as user@'%'"`
+	RequireBinlog   string `env:"MYSQL_REQUIRE_BINLOG" default:"" oneof:",replication,cdc" desc:"Expect binary logging with GTIDs (replication), and also row based events with full row images (cdc, e.g. Debezium)"`
+	Vitess          bool   `env:"MYSQL_VITESS" default:"false" desc:"The target is a vtgate or a PlanetScale-style endpoint: run SELECT 1 instead of SHOW TABLES, check that every shard of the keyspace in MYSQL_NAME has a serving primary where SHOW VITESS_TABLETS is allowed, and connect using TLS"`
+	VitessPlaintext bool   `env:"MYSQL_VITESS_PLAINTEXT" default:"false" desc:"Allow a Vitess target without MYSQL_TLS, e.g. a local vttestserver"`
+	CDCConnector    string `env:"MYSQL_CDC_CONNECTOR" default:"" format:"url" desc:"Kafka Connect REST URL of a Debezium connector reading this database, e.g. http://connect:8083/connectors/inventory; the check then also requires a row based binary log, the REPLICATION SLAVE and REPLICATION CLIENT privileges and the connector and its tasks RUNNING"`
+	FailOnMismatch  bool   `env:"MYSQL_FAIL_ON_VARIABLES_MISMATCH" default:"false" desc:"Fail the check when a server variable differs from MYSQL_EXPECT_VARIABLES or MYSQL_REQUIRE_BINLOG instead of only exporting the difference"`
+	Severity        string `env:"MYSQL_SEVERITY" default:"critical" oneof:"critical,warning,info" desc:"How bad an outage of this database is, added as the severity label to its exporter metrics and sent with notifications, e.g. warning for an analytics replica"`
+	TLSConfig       *tls.Config
+	// CredentialsFile is the TARGETS_DIR entry the config was read from, so
+	// rotated credentials can be read again, see util.ReadMysqlCredentials.
+	CredentialsFile string
+	// Timeout, ConnectTimeout, QueryTimeout, Tries and Labels are set per
+	// target by a config file, see the Target fields of the same names.
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	QueryTimeout   time.Duration
+	Tries          int
+	Labels         map[string]string
+}
+
+type MongoConfig struct {
+	URI string `env:"MONGODB_URI" required:"true" desc:"Connection URI including database name"`
+}
+
+// TargetConfig selects the checker of an indexed target, so one _N scheme
+// can mix database types.
+type TargetConfig struct {
+	Type string `env:"TARGET_TYPE" default:"mysql" oneof:"mysql,mongodb,mock,snowflake,bigquery,dynamodb,arangodb,spanner,firestore,trino,redis,smtp,imap,sftp,kafka,elasticsearch" desc:"Database type of the target with this index, mongodb by default if MONGODB_URI is set; mongodb reads MONGODB_URI, the other types read their own variables with the same suffix, e.g. SNOWFLAKE_* or ARANGODB_*"`
+}
+
+// MockConfig is a fake target that needs no database, for testing exporter
+// wiring, notifications and alert rules.
+type MockConfig struct {
+	Name   string        `env:"MOCK_NAME" required:"true" desc:"Name of the mock target, reported as its database"`
+	Result string        `env:"MOCK_RESULT" default:"success" oneof:"success,failure,flap" desc:"Outcome of every check; flap alternates failure and success"`
+	Delay  time.Duration `env:"MOCK_DELAY" default:"0s" desc:"How long every check takes"`
+	Reason string        `env:"MOCK_REASON" default:"connection refused" oneof:"connection refused,timeout,auth error,unknown database,dns error,tls error" desc:"Error class of failed checks"`
+	// ClockSkew is reported as the server clock minus the local clock when
+	// MAX_CLOCK_SKEW is set.
+	ClockSkew time.Duration `env:"MOCK_CLOCK_SKEW" default:"0s" desc:"How far the clock of the mock server is ahead of the local one, compared with MAX_CLOCK_SKEW"`
+}
+
+// SnowflakeConfig is a Snowflake account checked with SELECT 1, for data
+// jobs that gate on a warehouse like services gate on an OLTP database.
+type SnowflakeConfig struct {
+	Account         string `env:"SNOWFLAKE_ACCOUNT" required:"true" desc:"Account identifier, e.g. myorg-myaccount or xy12345.eu-central-1"`
+	Host            string `env:"SNOWFLAKE_HOST" default:"" desc:"Host to connect to, e.g. a PrivateLink endpoint; ACCOUNT.snowflakecomputing.com if empty"`
+	User            string `env:"SNOWFLAKE_USER" required:"true" desc:"Login name"`
+	Password        string `env:"SNOWFLAKE_PASSWORD" default:"" desc:"Password; empty for key-pair authentication"`
+	PrivateKeyFile  string `env:"SNOWFLAKE_PRIVATE_KEY_FILE" default:"" desc:"Unencrypted PEM file of the RSA private key registered for the user (RSA_PUBLIC_KEY); used instead of SNOWFLAKE_PASSWORD"`
+	Warehouse       string `env:"SNOWFLAKE_WAREHOUSE" default:"" desc:"Warehouse of the session"`
+	Role            string `env:"SNOWFLAKE_ROLE" default:"" desc:"Role of the session; the default role of the user if empty"`
+	Database        string `env:"SNOWFLAKE_DATABASE" default:"" desc:"Database of the session"`
+	ResumeWarehouse bool   `env:"SNOWFLAKE_RESUME_WAREHOUSE" default:"true" desc:"Resume SNOWFLAKE_WAREHOUSE if it is suspended and report how long that took; the role needs the OPERATE privilege on the warehouse"`
+}
+
+// BigQueryConfig is a BigQuery dataset checked with a dry-run query, for
+// analytics services that should fail fast on IAM misconfiguration.
+type BigQueryConfig struct {
+	Project         string `env:"BIGQUERY_PROJECT" required:"true" desc:"Project that runs the query job; the service account needs bigquery.jobs.create in it"`
+	Dataset         string `env:"BIGQUERY_DATASET" required:"true" desc:"Dataset that must be readable, DATASET in BIGQUERY_PROJECT or PROJECT.DATASET"`
+	CredentialsFile string `env:"BIGQUERY_CREDENTIALS_FILE" default:"" desc:"JSON key file of a service account; Application Default Credentials if empty"`
+}
+
+// DynamoDBConfig is a DynamoDB table checked with DescribeTable and an
+// optional canary GetItem, for serverless stacks that depend on DynamoDB the
+// way other services depend on MySQL.
+type DynamoDBConfig struct {
+	Table           string `env:"DYNAMODB_TABLE" required:"true" desc:"Name of the table"`
+	Region          string `env:"DYNAMODB_REGION" required:"true" desc:"AWS region of the table, e.g. eu-west-1"`
+	Endpoint        string `env:"DYNAMODB_ENDPOINT" default:"" desc:"Endpoint URL, e.g. http://localhost:8000 for DynamoDB Local or a VPC endpoint; https://dynamodb.REGION.amazonaws.com if empty"`
+	AccessKeyID     string `env:"DYNAMODB_ACCESS_KEY_ID" default:"" desc:"Access key ID; AWS_ACCESS_KEY_ID if empty"`
+	SecretAccessKey string `env:"DYNAMODB_SECRET_ACCESS_KEY" default:"" desc:"Secret access key; AWS_SECRET_ACCESS_KEY if DYNAMODB_ACCESS_KEY_ID is empty"`
+	SessionToken    string `env:"DYNAMODB_SESSION_TOKEN" default:"" desc:"Session token of temporary credentials; AWS_SESSION_TOKEN if DYNAMODB_ACCESS_KEY_ID is empty"`
+	CanaryKey       string `env:"DYNAMODB_CANARY_KEY" default:"" desc:"Primary key of an item to read with GetItem, in DynamoDB JSON, e.g. {\"pk\":{\"S\":\"canary\"}}; the item must exist"`
+}
+
+// ArangoDBConfig is an ArangoDB server checked through its HTTP API.
+type ArangoDBConfig struct {
+	Host       string `env:"ARANGODB_HOST" required:"true" desc:"Host of a coordinator or single server"`
+	Port       string `env:"ARANGODB_PORT" default:"8529" format:"port" desc:"Port of the HTTP API"`
+	Database   string `env:"ARANGODB_DATABASE" default:"_system" desc:"Database that must exist"`
+	Collection string `env:"ARANGODB_COLLECTION" default:"" desc:"Collection that must exist in ARANGODB_DATABASE; empty skips the check"`
+	User       string `env:"ARANGODB_USER" default:"root" desc:"User name of basic authentication; empty sends no credentials"`
+	Pass       string `env:"ARANGODB_PASS" default:"" desc:"Password"`
+	TLS        bool   `env:"ARANGODB_TLS" default:"false" desc:"Connect using HTTPS"`
+	TLSCAFile  string `env:"ARANGODB_TLS_CA_FILE" default:"" desc:"CA bundle used when ARANGODB_TLS=true; the system roots if empty"`
+}
+
+// SpannerConfig is a Cloud Spanner database checked by creating a session
+// and running SELECT 1 in it.
+type SpannerConfig struct {
+	Project         string `env:"SPANNER_PROJECT" required:"true" desc:"Project of the instance"`
+	Instance        string `env:"SPANNER_INSTANCE" required:"true" desc:"Instance ID"`
+	Database        string `env:"SPANNER_DATABASE" required:"true" desc:"Database ID; the service account needs spanner.sessions.create and spanner.databases.select on it, e.g. roles/spanner.databaseReader"`
+	CredentialsFile string `env:"SPANNER_CREDENTIALS_FILE" default:"" desc:"JSON key file of a service account; Application Default Credentials if empty"`
+}
+
+// FirestoreConfig is a Firestore database, in native or Datastore mode,
+// checked by reading a canary document or listing a collection.
+type FirestoreConfig struct {
+	Project         string `env:"FIRESTORE_PROJECT" required:"true" desc:"Project of the database"`
+	Database        string `env:"FIRESTORE_DATABASE" default:"(default)" desc:"Database ID"`
+	Document        string `env:"FIRESTORE_DOCUMENT" default:"" desc:"Path of a canary document that must exist, e.g. health/canary"`
+	Collection      string `env:"FIRESTORE_COLLECTION" default:"" desc:"Path of a collection to list with a limit of 1, e.g. users; FIRESTORE_DOCUMENT or FIRESTORE_COLLECTION is required"`
+	CredentialsFile string `env:"FIRESTORE_CREDENTIALS_FILE" default:"" desc:"JSON key file of a service account; Application Default Credentials if empty"`
+}
+
+// TrinoConfig is a Trino or Presto coordinator checked with SELECT 1 and a
+// count of its active workers.
+type TrinoConfig struct {
+	Host       string `env:"TRINO_HOST" required:"true" desc:"Host of the coordinator"`
+	Port       string `env:"TRINO_PORT" default:"8080" format:"port" desc:"Port of the HTTP protocol"`
+	User       string `env:"TRINO_USER" default:"db-connect-checker" desc:"User of the queries"`
+	Pass       string `env:"TRINO_PASS" default:"" desc:"Password of basic authentication; the coordinator accepts it only over HTTPS"`
+	Token      string `env:"TRINO_TOKEN" default:"" desc:"JWT sent as bearer token instead of TRINO_PASS"`
+	Catalog    string `env:"TRINO_CATALOG" default:"" desc:"Catalog of the session"`
+	Schema     string `env:"TRINO_SCHEMA" default:"" desc:"Schema of the session"`
+	MinWorkers int    `env:"TRINO_MIN_WORKERS" default:"0" desc:"Fail the check with fewer active workers, not counting the coordinator; 0 disables the worker count"`
+	TLS        bool   `env:"TRINO_TLS" default:"false" desc:"Connect using HTTPS"`
+	TLSCAFile  string `env:"TRINO_TLS_CA_FILE" default:"" desc:"CA bundle used when TRINO_TLS=true; the system roots if empty"`
+}
+
+// RedisConfig is a Redis server checked with PING and optionally INFO. Unlike
+// the other indexed types it can also be configured without a suffix, like
+// MONGODB_URI.
+type RedisConfig struct {
+	Addr      string `env:"REDIS_ADDR" required:"true" desc:"Address of the server, host:port; the port defaults to 6379"`
+	User      string `env:"REDIS_USER" default:"" desc:"ACL user of AUTH; the default user if empty"`
+	Password  string `env:"REDIS_PASSWORD" default:"" desc:"Password of AUTH; no AUTH if empty"`
+	DB        int    `env:"REDIS_DB" default:"0" desc:"Database index selected with SELECT"`
+	Info      bool   `env:"REDIS_INFO" default:"false" desc:"Read INFO after PING and fail while the server is loading its dataset or is a replica whose link to the primary is down"`
+	TLS       bool   `env:"REDIS_TLS" default:"false" desc:"Connect using TLS"`
+	TLSCAFile string `env:"REDIS_TLS_CA_FILE" default:"" desc:"CA bundle used when REDIS_TLS=true; the system roots if empty"`
+}
+
+// SMTPConfig is a mail relay checked with EHLO, STARTTLS and optionally AUTH.
+type SMTPConfig struct {
+	Host      string `env:"SMTP_HOST" required:"true" desc:"Host of the server"`
+	Port      string `env:"SMTP_PORT" default:"25" format:"port" desc:"Port of the server, e.g. 587 for submission or 465 with SMTP_TLS=true"`
+	User      string `env:"SMTP_USER" default:"" desc:"User of AUTH PLAIN; no AUTH if empty"`
+	Pass      string `env:"SMTP_PASS" default:"" desc:"Password of AUTH PLAIN"`
+	Helo      string `env:"SMTP_HELO" default:"" desc:"Name sent with EHLO; the host name if empty"`
+	StartTLS  bool   `env:"SMTP_STARTTLS" default:"true" desc:"Require STARTTLS and upgrade the connection before AUTH"`
+	TLS       bool   `env:"SMTP_TLS" default:"false" desc:"Connect using TLS from the start (SMTPS) instead of STARTTLS"`
+	TLSCAFile string `env:"SMTP_TLS_CA_FILE" default:"" desc:"CA bundle used for TLS and STARTTLS; the system roots if empty"`
+}
+
+// IMAPConfig is a mail store checked with LOGIN and a read-only SELECT of a
+// mailbox.
+type IMAPConfig struct {
+	Host      string `env:"IMAP_HOST" required:"true" desc:"Host of the server"`
+	Port      string `env:"IMAP_PORT" default:"993" format:"port" desc:"Port of the server, 143 with IMAP_TLS=false"`
+	User      string `env:"IMAP_USER" required:"true" desc:"User of LOGIN"`
+	Pass      string `env:"IMAP_PASS" required:"true" desc:"Password of LOGIN"`
+	Mailbox   string `env:"IMAP_MAILBOX" default:"INBOX" desc:"Mailbox opened read-only with EXAMINE"`
+	TLS       bool   `env:"IMAP_TLS" default:"true" desc:"Connect using TLS (IMAPS)"`
+	TLSCAFile string `env:"IMAP_TLS_CA_FILE" default:"" desc:"CA bundle used when IMAP_TLS=true; the system roots if empty"`
+}
+
+// SFTPConfig is a file drop checked by logging in over SSH and optionally
+// listing a directory.
+type SFTPConfig struct {
+	Host               string `env:"SFTP_HOST" required:"true" desc:"Host of the server"`
+	Port               string `env:"SFTP_PORT" default:"22" format:"port" desc:"Port of the server"`
+	User               string `env:"SFTP_USER" required:"true" desc:"User to log in as"`
+	Pass               string `env:"SFTP_PASS" default:"" desc:"Password; SFTP_PASS or SFTP_KEY_FILE is required"`
+	KeyFile            string `env:"SFTP_KEY_FILE" default:"" desc:"Unencrypted private key file in OpenSSH or PEM format"`
+	KnownHosts         string `env:"SFTP_KNOWN_HOSTS" default:"" desc:"known_hosts file with the host key of the server; SFTP_KNOWN_HOSTS or SFTP_HOST_KEY_FINGERPRINT is required"`
+	HostKeyFingerprint string `env:"SFTP_HOST_KEY_FINGERPRINT" default:"" desc:"SHA256 fingerprint of the host key as printed by ssh-keygen -l, e.g. SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8; takes precedence over SFTP_KNOWN_HOSTS"`
+	Dir                string `env:"SFTP_DIR" default:"" desc:"Directory listed after login; only the login is checked if empty"`
+}
+
+// KafkaConfig is a Kafka cluster checked by reading its metadata from one of
+// the bootstrap brokers and optionally looking up a topic. The variables
+// without a suffix are those of the event sink, so they only configure a
+// target when DB_TYPES lists kafka.
+type KafkaConfig struct {
+	Brokers       string `env:"KAFKA_BROKERS" required:"true" format:"hosts" desc:"Comma separated bootstrap brokers, host or host:port (port 9092 if omitted), tried in order until one answers"`
+	Topic         string `env:"KAFKA_CHECK_TOPIC" default:"" desc:"Topic that must exist, e.g. the one the application consumes; the check never creates it; only the brokers are checked if empty"`
+	TLS           bool   `env:"KAFKA_TLS" default:"false" desc:"Connect using TLS"`
+	TLSCAFile     string `env:"KAFKA_TLS_CA_FILE" default:"" desc:"CA bundle used when KAFKA_TLS=true; the system roots if empty"`
+	SASLMechanism string `env:"KAFKA_SASL_MECHANISM" default:"plain" oneof:"plain,scram-sha-256,scram-sha-512" desc:"SASL mechanism used when KAFKA_SASL_USER is set"`
+	SASLUser      string `env:"KAFKA_SASL_USER" default:"" desc:"SASL user, empty disables SASL"`
+	SASLPassword  string `env:"KAFKA_SASL_PASSWORD" default:"" desc:"SASL password"`
+}
+
+// ElasticsearchConfig is an Elasticsearch or OpenSearch cluster checked by
+// reading its version and cluster health.
+type ElasticsearchConfig struct {
+	URL       string `env:"ELASTICSEARCH_URL" required:"true" format:"url" desc:"URL of a node or a load balancer in front of the cluster, e.g. https://es.internal:9200; https connects using TLS"`
+	User      string `env:"ELASTICSEARCH_USER" default:"" desc:"User name of basic authentication; empty sends no credentials"`
+	Pass      string `env:"ELASTICSEARCH_PASS" default:"" desc:"Password"`
+	MinStatus string `env:"ELASTICSEARCH_MIN_STATUS" default:"red" oneof:"red,yellow,green" desc:"Lowest cluster health that passes: yellow fails red clusters, green also fails clusters with unassigned replicas; red accepts any cluster that answers"`
+	TLSCAFile string `env:"ELASTICSEARCH_TLS_CA_FILE" default:"" desc:"CA bundle used for https URLs; the system roots if empty"`
 }
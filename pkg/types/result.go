@@ -0,0 +1,120 @@
+package types
+
+import "time"
+
+// Result is the outcome of checking one target. The exporter, the JSON
+// outputs and notifications are all built from it.
+type Result struct {
+	Success  bool
+	Attempts int
+	// Phases are the timed steps of the check in order, e.g. connect and
+	// query. A failed check ends with the phase that failed.
+	Phases []Phase
+	// ServerVersion is reported by the server, empty if it could not be
+	// read.
+	ServerVersion string
+	// ClockSkew is the server clock minus the local clock, measured only
+	// when requested and the database was reachable; see ClockSkewMeasured.
+	ClockSkew         time.Duration
+	ClockSkewMeasured bool
+	// Variables compare the server variables of Target.ExpectVariables with
+	// their live values, empty if none are expected or they were not read.
+	Variables []VariableCheck
+	// Tablespace is the size and free space of the database, valid if
+	// TablespaceMeasured.
+	Tablespace         Tablespace
+	TablespaceMeasured bool
+	// Sessions counts busy sessions of the server, valid if
+	// SessionsMeasured.
+	Sessions         Sessions
+	SessionsMeasured bool
+	// Threads are the thread counts of the server, valid if ThreadsMeasured.
+	Threads         Threads
+	ThreadsMeasured bool
+	// FlowControl is the Galera flow control status of a Percona XtraDB
+	// Cluster node, valid if FlowControlMeasured.
+	FlowControl         FlowControl
+	FlowControlMeasured bool
+	// Credentials are the results of Target.User and every user of
+	// Target.Credentials, empty if the target has no further users.
+	Credentials []CredentialCheck
+	// Account is the account the server matched the user to, as
+	// user@host, read if Target.AccountHost is set.
+	Account string
+	// Warnings are problems found by a successful check that do not fail
+	// it, e.g. an unexpected account.
+	Warnings []string
+	// Reason is the class of Err, e.g. "auth error"; empty on success.
+	Reason string
+	Err    error
+}
+
+// Phase is the duration of one step of a check.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Duration returns the total time spent in all phases.
+func (r Result) Duration() time.Duration {
+	var total time.Duration
+	for _, phase := range r.Phases {
+		total += phase.Duration
+	}
+	return total
+}
+
+// VariableCheck is the live value of one expected server variable.
+type VariableCheck struct {
+	Name     string
+	Expected string
+	Actual   string
+	Match    bool
+}
+
+// Tablespace is the space used by the tables of a database and the space
+// allocated to them but not used, in bytes.
+type Tablespace struct {
+	DataBytes int64
+	FreeBytes int64
+}
+
+// FreePercent returns the free space as a percentage of the whole
+// tablespace, 100 for an empty one.
+func (t Tablespace) FreePercent() float64 {
+	if t.DataBytes+t.FreeBytes <= 0 {
+		return 100
+	}
+	return float64(t.FreeBytes) / float64(t.DataBytes+t.FreeBytes) * 100
+}
+
+// Sessions counts the sessions of a server that are stuck: running a query
+// for longer than a threshold, or waiting for a lock.
+type Sessions struct {
+	LongQueries int
+	LockWaits   int
+}
+
+// Threads are the Threads_connected and Threads_running status variables of
+// a MySQL server.
+type Threads struct {
+	Connected int
+	Running   int
+}
+
+// FlowControl are the wsrep_flow_control_* status variables of a Galera
+// node: the fraction of time replication was paused by flow control and the
+// number of pause requests the node sent and received, all since the last
+// FLUSH STATUS.
+type FlowControl struct {
+	Paused   float64
+	Sent     int64
+	Received int64
+}
+
+// CredentialCheck is the result of connecting as one user.
+type CredentialCheck struct {
+	User   string
+	Err    error
+	Reason string
+}
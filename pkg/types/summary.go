@@ -0,0 +1,134 @@
+package types
+
+import "fmt"
+
+// The Summary methods describe a config in one line for the validate
+// command, without secrets.
+
+// tlsSummary describes the TLS setting of a target: off, on, or on with the
+// CA bundle file.
+func tlsSummary(enabled bool, caFile string) string {
+	switch {
+	case !enabled:
+		return "off"
+	case caFile != "":
+		return fmt.Sprintf("on, ca %s", caFile)
+	}
+	return "on"
+}
+
+func (c MockConfig) Summary() string {
+	return fmt.Sprintf("mock %s (result: %s, delay: %v)", c.Name, c.Result, c.Delay)
+}
+
+func (c SnowflakeConfig) Summary() string {
+	auth := "password"
+	if c.PrivateKeyFile != "" {
+		auth = "key pair " + c.PrivateKeyFile
+	}
+	return fmt.Sprintf("snowflake %s@%s/%s (warehouse: %s, auth: %s)", c.User, c.Target().Host, c.Database, c.Warehouse, auth)
+}
+
+func (c BigQueryConfig) Summary() string {
+	credentials := "application default"
+	if c.CredentialsFile != "" {
+		credentials = c.CredentialsFile
+	}
+	return fmt.Sprintf("bigquery %s/%s (credentials: %s)", c.Project, c.Dataset, credentials)
+}
+
+func (c DynamoDBConfig) Summary() string {
+	canary := "off"
+	if c.CanaryKey != "" {
+		canary = c.CanaryKey
+	}
+	target := c.Target()
+	return fmt.Sprintf("dynamodb %s:%s/%s (canary: %s)", target.Host, target.Port, c.Table, canary)
+}
+
+func (c ArangoDBConfig) Summary() string {
+	return fmt.Sprintf("arangodb %s@%s:%s/%s (collection: %s, tls: %s)", c.User, c.Host, c.Port, c.Database, c.Collection, tlsSummary(c.TLS, c.TLSCAFile))
+}
+
+func (c SpannerConfig) Summary() string {
+	credentials := "application default"
+	if c.CredentialsFile != "" {
+		credentials = c.CredentialsFile
+	}
+	return fmt.Sprintf("spanner %s/%s/%s (credentials: %s)", c.Project, c.Instance, c.Database, credentials)
+}
+
+func (c FirestoreConfig) Summary() string {
+	credentials := "application default"
+	if c.CredentialsFile != "" {
+		credentials = c.CredentialsFile
+	}
+	return fmt.Sprintf("firestore %s/%s (document: %s, collection: %s, credentials: %s)", c.Project, c.Database, c.Document, c.Collection, credentials)
+}
+
+func (c TrinoConfig) Summary() string {
+	return fmt.Sprintf("trino %s@%s:%s/%s (min workers: %d, tls: %s)", c.User, c.Host, c.Port, c.Catalog, c.MinWorkers, tlsSummary(c.TLS, c.TLSCAFile))
+}
+
+func (c RedisConfig) Summary() string {
+	target := c.Target()
+	return fmt.Sprintf("redis %s:%s/%d (info: %v, tls: %s)", target.Host, target.Port, c.DB, c.Info, tlsSummary(c.TLS, c.TLSCAFile))
+}
+
+func (c SMTPConfig) Summary() string {
+	tls := "off"
+	switch {
+	case c.TLS:
+		tls = "on"
+	case c.StartTLS:
+		tls = "starttls"
+	}
+	if tls != "off" && c.TLSCAFile != "" {
+		tls = fmt.Sprintf("%s, ca %s", tls, c.TLSCAFile)
+	}
+	auth := "off"
+	if c.User != "" {
+		auth = c.User
+	}
+	return fmt.Sprintf("smtp %s:%s (tls: %s, auth: %s)", c.Host, c.Port, tls, auth)
+}
+
+func (c IMAPConfig) Summary() string {
+	return fmt.Sprintf("imap %s@%s:%s/%s (tls: %s)", c.User, c.Host, c.Port, c.Mailbox, tlsSummary(c.TLS, c.TLSCAFile))
+}
+
+func (c SFTPConfig) Summary() string {
+	auth := "password"
+	if c.KeyFile != "" {
+		auth = fmt.Sprintf("key %s", c.KeyFile)
+	}
+	hostKey := c.HostKeyFingerprint
+	if hostKey == "" {
+		hostKey = fmt.Sprintf("known hosts %s", c.KnownHosts)
+	}
+	dir := c.Dir
+	if dir == "" {
+		dir = "not listed"
+	}
+	return fmt.Sprintf("sftp %s@%s:%s (dir: %s, auth: %s, host key: %s)", c.User, c.Host, c.Port, dir, auth, hostKey)
+}
+
+func (c KafkaConfig) Summary() string {
+	topic := c.Topic
+	if topic == "" {
+		topic = "not checked"
+	}
+	sasl := "off"
+	if c.SASLUser != "" {
+		sasl = fmt.Sprintf("%s as %s", c.SASLMechanism, c.SASLUser)
+	}
+	return fmt.Sprintf("kafka %s (topic: %s, tls: %s, sasl: %s)", c.Brokers, topic, tlsSummary(c.TLS, c.TLSCAFile), sasl)
+}
+
+func (c ElasticsearchConfig) Summary() string {
+	auth := "none"
+	if c.User != "" {
+		auth = c.User
+	}
+	return fmt.Sprintf("elasticsearch %s (min status: %s, auth: %s)", c.URL, c.MinStatus, auth)
+}
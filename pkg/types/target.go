@@ -0,0 +1,533 @@
+package types
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Target is one database of any type in the form all checkers consume.
+// Type selects the checker; fields a database type does not use stay empty.
+type Target struct {
+	Type     string
+	Host     string
+	Port     string
+	Database string
+	User     string
+	Pass     string
+	// URI is the full connection string for checkers that accept one. When
+	// set it takes precedence over the address and credential fields.
+	URI       string
+	TLS       bool
+	TLSCAFile string
+	TLSConfig *tls.Config
+	// Options are checker specific connection parameters, e.g. DSN
+	// parameters for MySQL or URI options for MongoDB.
+	Options map[string]string
+	// Schedule is the cron expression for this target in exporter mode.
+	Schedule string
+	// ExpectVariables are global server variables (e.g. sql_mode) and the
+	// values the server should have, checked after connecting.
+	ExpectVariables map[string]string
+	// FailOnMismatch fails the check when a variable differs from
+	// ExpectVariables instead of only reporting it.
+	FailOnMismatch bool
+	// Credentials are further users verified after User connected, e.g. a
+	// migration and a read-only user of the same database.
+	Credentials []Credential
+	// AccountHost is the host part of the account User should be matched
+	// to, e.g. "10.0.%"; empty skips the account check.
+	AccountHost string
+	// XPort is the MySQL X Protocol port checked in addition to Port, empty
+	// skips the X Protocol check.
+	XPort string
+	// Vitess marks a MySQL target served by vtgate, whose keyspace is
+	// Database.
+	Vitess bool
+	// CDCConnector is the Kafka Connect REST URL of a Debezium connector
+	// reading the binary log of a MySQL target, empty skips the CDC check.
+	CDCConnector string
+	// CredentialsFile is the file or directory User and Pass were read
+	// from, read again by the exporter when the password is rotated. Empty
+	// if they did not come from a file.
+	CredentialsFile string
+	// Endpoints are the host:port addresses of a target with several, e.g.
+	// the failover list of a client. Checks try them at the same time and
+	// succeed if any of them works; Host and Port then only name the target.
+	Endpoints []string
+	// Timeout, if positive, limits every check of this target instead of
+	// ATTEMPT_TIMEOUT.
+	Timeout time.Duration
+	// ConnectTimeout and QueryTimeout, if positive, limit connecting and
+	// the queries run after connecting instead of CONNECT_TIMEOUT and
+	// QUERY_TIMEOUT. Only MySQL and MongoDB checks have these phases.
+	ConnectTimeout time.Duration
+	QueryTimeout   time.Duration
+	// Tries, if positive, replaces TRIES for this target in the one-shot
+	// mode.
+	Tries int
+	// Labels describe the target, e.g. env=prod, for matching it in
+	// NOTIFY_ROUTES and in notifications.
+	Labels map[string]string
+	// Severity is how bad an outage of the target is, one of Severities;
+	// critical if empty. It is exported as a metric label and sent with
+	// notifications, so alerting can tell a down analytics replica from a
+	// down payments primary.
+	Severity string
+}
+
+// Severities are the values of Target.Severity, most severe first. They are
+// the severities of PagerDuty alerts as well.
+var Severities = []string{"critical", "warning", "info"}
+
+// SeverityLevel returns the severity of t, critical if not set.
+func (t Target) SeverityLevel() string {
+	if t.Severity == "" {
+		return Severities[0]
+	}
+	return t.Severity
+}
+
+// Credential is a user name and password.
+type Credential struct {
+	User string
+	Pass string
+}
+
+// Address returns host:port, or just the host if the port is not set.
+func (t Target) Address() string {
+	if t.Port == "" {
+		return t.Host
+	}
+	return fmt.Sprintf("%s:%s", t.Host, t.Port)
+}
+
+// String returns the name used in logs, e.g. "mysql db:3306/orders".
+func (t Target) String() string {
+	return fmt.Sprintf("%s %s/%s", t.Type, t.Address(), t.Database)
+}
+
+// Target converts the MySQL environment config to the generic form.
+func (c MysqlConfig) Target() Target {
+	variables := binlogVariables(c.RequireBinlog)
+	// The value is validated when the configuration is read.
+	expected, _ := ParseVariables(c.ExpectVariables)
+	for name, value := range expected {
+		variables[name] = value
+	}
+	credentials, _ := ParseCredentials(c.ExtraUsers)
+	endpoints, _ := ParseHosts(c.Hosts, c.Port)
+	// Vitess endpoints are usually reached over untrusted networks, so TLS
+	// is on unless MYSQL_VITESS_PLAINTEXT is set.
+	useTLS := c.TLS || c.Vitess && !c.VitessPlaintext
+	return Target{
+		Type:            "mysql",
+		Host:            c.Host,
+		Port:            c.Port,
+		Database:        c.Name,
+		User:            c.User,
+		Pass:            c.Pass,
+		TLS:             useTLS,
+		TLSCAFile:       c.TLSCAFile,
+		TLSConfig:       c.TLSConfig,
+		Schedule:        c.Schedule,
+		ExpectVariables: variables,
+		FailOnMismatch:  c.FailOnMismatch,
+		Credentials:     credentials,
+		AccountHost:     c.AccountHost,
+		XPort:           c.XPort,
+		Vitess:          c.Vitess,
+		CDCConnector:    c.CDCConnector,
+		CredentialsFile: c.CredentialsFile,
+		Endpoints:       endpoints,
+		Timeout:         c.Timeout,
+		ConnectTimeout:  c.ConnectTimeout,
+		QueryTimeout:    c.QueryTimeout,
+		Tries:           c.Tries,
+		Labels:          c.Labels,
+		Severity:        c.Severity,
+	}
+}
+
+// Target converts the Snowflake config to the generic form. The account,
+// session parameters and key file are passed in Options.
+func (c SnowflakeConfig) Target() Target {
+	host := c.Host
+	if host == "" {
+		host = c.Account + ".snowflakecomputing.com"
+	}
+	return Target{
+		Type:     "snowflake",
+		Host:     host,
+		Port:     "443",
+		Database: c.Database,
+		User:     c.User,
+		Pass:     c.Password,
+		Options: map[string]string{
+			"account":          c.Account,
+			"warehouse":        c.Warehouse,
+			"role":             c.Role,
+			"private_key_file": c.PrivateKeyFile,
+			"resume_warehouse": strconv.FormatBool(c.ResumeWarehouse),
+		},
+	}
+}
+
+// Target converts the BigQuery config to the generic form. The dataset is
+// the database; the project and credentials file are passed in Options.
+func (c BigQueryConfig) Target() Target {
+	return Target{
+		Type:     "bigquery",
+		Host:     "bigquery.googleapis.com",
+		Port:     "443",
+		Database: c.Dataset,
+		Options: map[string]string{
+			"project":          c.Project,
+			"credentials_file": c.CredentialsFile,
+		},
+	}
+}
+
+// Target converts the DynamoDB config to the generic form. The table is the
+// database and the access key the user; the region, endpoint, session token
+// and canary key are passed in Options.
+func (c DynamoDBConfig) Target() Target {
+	host, port := "dynamodb."+c.Region+".amazonaws.com", "443"
+	if endpoint, err := url.Parse(c.Endpoint); err == nil && endpoint.Host != "" {
+		host, port = endpoint.Hostname(), endpoint.Port()
+		if port == "" && endpoint.Scheme == "http" {
+			port = "80"
+		} else if port == "" {
+			port = "443"
+		}
+	}
+	return Target{
+		Type:     "dynamodb",
+		Host:     host,
+		Port:     port,
+		Database: c.Table,
+		User:     c.AccessKeyID,
+		Pass:     c.SecretAccessKey,
+		Options: map[string]string{
+			"region":        c.Region,
+			"endpoint":      c.Endpoint,
+			"session_token": c.SessionToken,
+			"canary_key":    c.CanaryKey,
+		},
+	}
+}
+
+// Target converts the ArangoDB config to the generic form. The collection is
+// passed in Options.
+func (c ArangoDBConfig) Target() Target {
+	return Target{
+		Type:      "arangodb",
+		Host:      c.Host,
+		Port:      c.Port,
+		Database:  c.Database,
+		User:      c.User,
+		Pass:      c.Pass,
+		TLS:       c.TLS,
+		TLSCAFile: c.TLSCAFile,
+		Options: map[string]string{
+			"collection": c.Collection,
+		},
+	}
+}
+
+// Target converts the Spanner config to the generic form. The project,
+// instance and credentials file are passed in Options.
+func (c SpannerConfig) Target() Target {
+	return Target{
+		Type:     "spanner",
+		Host:     "spanner.googleapis.com",
+		Port:     "443",
+		Database: c.Database,
+		Options: map[string]string{
+			"project":          c.Project,
+			"instance":         c.Instance,
+			"credentials_file": c.CredentialsFile,
+		},
+	}
+}
+
+// Target converts the Firestore config to the generic form. The project,
+// document, collection and credentials file are passed in Options.
+func (c FirestoreConfig) Target() Target {
+	return Target{
+		Type:     "firestore",
+		Host:     "firestore.googleapis.com",
+		Port:     "443",
+		Database: c.Database,
+		Options: map[string]string{
+			"project":          c.Project,
+			"document":         c.Document,
+			"collection":       c.Collection,
+			"credentials_file": c.CredentialsFile,
+		},
+	}
+}
+
+// Target converts the Trino config to the generic form. The catalog is the
+// database; the schema, token and minimum worker count are passed in
+// Options.
+func (c TrinoConfig) Target() Target {
+	return Target{
+		Type:      "trino",
+		Host:      c.Host,
+		Port:      c.Port,
+		Database:  c.Catalog,
+		User:      c.User,
+		Pass:      c.Pass,
+		TLS:       c.TLS,
+		TLSCAFile: c.TLSCAFile,
+		Options: map[string]string{
+			"schema":      c.Schema,
+			"token":       c.Token,
+			"min_workers": strconv.Itoa(c.MinWorkers),
+		},
+	}
+}
+
+// Target converts the Elasticsearch config to the generic form. Host and Port
+// are those of the URL, the port of the scheme if it has none, the Database
+// is its path prefix, if any; the URL and the minimum cluster health are
+// passed in Options.
+func (c ElasticsearchConfig) Target() Target {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		// The check reports the invalid URL.
+		u = &url.URL{Host: c.URL}
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return Target{
+		Type:      "elasticsearch",
+		Host:      u.Hostname(),
+		Port:      port,
+		Database:  strings.Trim(u.Path, "/"),
+		User:      c.User,
+		Pass:      c.Pass,
+		TLS:       u.Scheme == "https",
+		TLSCAFile: c.TLSCAFile,
+		Options: map[string]string{
+			"url":        c.URL,
+			"min_status": c.MinStatus,
+		},
+	}
+}
+
+// Target converts the Redis config to the generic form. The database index
+// is the Database, an address without a port gets the default port 6379.
+func (c RedisConfig) Target() Target {
+	host, port, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		host, port = c.Addr, "6379"
+	}
+	return Target{
+		Type:      "redis",
+		Host:      host,
+		Port:      port,
+		Database:  strconv.Itoa(c.DB),
+		User:      c.User,
+		Pass:      c.Password,
+		TLS:       c.TLS,
+		TLSCAFile: c.TLSCAFile,
+		Options: map[string]string{
+			"info": strconv.FormatBool(c.Info),
+		},
+	}
+}
+
+// Target converts the SMTP config to the generic form. The EHLO name and
+// whether STARTTLS is required are passed in Options.
+func (c SMTPConfig) Target() Target {
+	return Target{
+		Type:      "smtp",
+		Host:      c.Host,
+		Port:      c.Port,
+		User:      c.User,
+		Pass:      c.Pass,
+		TLS:       c.TLS,
+		TLSCAFile: c.TLSCAFile,
+		Options: map[string]string{
+			"helo":     c.Helo,
+			"starttls": strconv.FormatBool(c.StartTLS),
+		},
+	}
+}
+
+// Target converts the IMAP config to the generic form. The mailbox is the
+// database.
+func (c IMAPConfig) Target() Target {
+	return Target{
+		Type:      "imap",
+		Host:      c.Host,
+		Port:      c.Port,
+		Database:  c.Mailbox,
+		User:      c.User,
+		Pass:      c.Pass,
+		TLS:       c.TLS,
+		TLSCAFile: c.TLSCAFile,
+	}
+}
+
+// Target converts the SFTP config to the generic form. The directory is the
+// database; the key file and the expected host key are passed in Options.
+func (c SFTPConfig) Target() Target {
+	return Target{
+		Type:     "sftp",
+		Host:     c.Host,
+		Port:     c.Port,
+		Database: c.Dir,
+		User:     c.User,
+		Pass:     c.Pass,
+		Options: map[string]string{
+			"key_file":    c.KeyFile,
+			"known_hosts": c.KnownHosts,
+			"host_key":    c.HostKeyFingerprint,
+		},
+	}
+}
+
+// Target converts the Kafka config to the generic form. The brokers, with
+// the default port 9092 where it is omitted, are the Host and the topic is
+// the Database.
+func (c KafkaConfig) Target() Target {
+	// The brokers are validated when the configuration is read.
+	brokers, _ := ParseHosts(c.Brokers, "9092")
+	return Target{
+		Type:      "kafka",
+		Host:      strings.Join(brokers, ","),
+		Database:  c.Topic,
+		User:      c.SASLUser,
+		Pass:      c.SASLPassword,
+		TLS:       c.TLS,
+		TLSCAFile: c.TLSCAFile,
+		Options: map[string]string{
+			"sasl_mechanism": c.SASLMechanism,
+		},
+	}
+}
+
+// binlogVariables returns the server variables implied by
+// MYSQL_REQUIRE_BINLOG: binary logging with GTIDs for replication, and
+// additionally full row events for change data capture such as Debezium.
+func binlogVariables(require string) map[string]string {
+	variables := map[string]string{}
+	switch require {
+	case "cdc":
+		variables["binlog_format"] = "ROW"
+		variables["binlog_row_image"] = "FULL"
+		fallthrough
+	case "replication":
+		variables["log_bin"] = "ON"
+		variables["gtid_mode"] = "ON"
+		variables["enforce_gtid_consistency"] = "ON"
+	}
+	return variables
+}
+
+// Target converts the mock config to the generic form. The behaviour is
+// passed in Options, so mock targets can also be built without environment
+// variables.
+func (c MockConfig) Target() Target {
+	return Target{
+		Type:     "mock",
+		Host:     "mock",
+		Database: c.Name,
+		Options: map[string]string{
+			"result":     c.Result,
+			"delay":      c.Delay.String(),
+			"reason":     c.Reason,
+			"clock_skew": c.ClockSkew.String(),
+		},
+	}
+}
+
+var variableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseVariables parses expected server variables given as name=value pairs
+// separated by semicolons, e.g.
+// "sql_mode=STRICT_TRANS_TABLES,NO_ZERO_DATE;time_zone=+00:00". Values may
+// contain commas.
+func ParseVariables(spec string) (map[string]string, error) {
+	variables := map[string]string{}
+	for _, pair := range strings.Split(spec, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("variable %q must be name=value", pair)
+		}
+		if !variableName.MatchString(name) {
+			return nil, fmt.Errorf("invalid variable name %q", name)
+		}
+		variables[name] = strings.TrimSpace(value)
+	}
+	return variables, nil
+}
+
+// ParseHosts parses comma separated endpoints given as host or host:port,
+// e.g. "db1,db2:3307,[fd00::3]:3306", into host:port addresses. Endpoints
+// without a port use defaultPort.
+func ParseHosts(spec, defaultPort string) ([]string, error) {
+	var addresses []string
+	for _, endpoint := range strings.Split(spec, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			// No port, or an IPv6 address without brackets.
+			host, port = strings.Trim(endpoint, "[]"), defaultPort
+		}
+		if host == "" {
+			return nil, fmt.Errorf("endpoint %q has no host", endpoint)
+		}
+		if num, err := strconv.Atoi(port); err != nil || num < 1 || num > 65535 {
+			return nil, fmt.Errorf("endpoint %q has an invalid port", endpoint)
+		}
+		addresses = append(addresses, net.JoinHostPort(host, port))
+	}
+	return addresses, nil
+}
+
+// ParseCredentials parses comma separated user:password pairs, e.g.
+// "migrator:${MIGRATOR_PASS},readonly:${READONLY_PASS}". Passwords are
+// expanded from the environment after splitting, so they may contain commas
+// when taken from a variable.
+func ParseCredentials(spec string) ([]Credential, error) {
+	var credentials []Credential
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		user, pass, ok := strings.Cut(pair, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("credential %q must be user:password", user)
+		}
+		pass = os.ExpandEnv(pass)
+		if pass == "" {
+			return nil, fmt.Errorf("password of %s is empty", user)
+		}
+		credentials = append(credentials, Credential{User: user, Pass: pass})
+	}
+	return credentials, nil
+}
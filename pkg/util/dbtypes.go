@@ -0,0 +1,112 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// SupportedDBTypes are the database types that have a checker.
+var SupportedDBTypes = []string{"mysql", "mongodb", "mock", "snowflake", "bigquery", "dynamodb", "arangodb", "spanner", "firestore", "trino", "redis", "smtp", "imap", "sftp", "kafka", "elasticsearch"}
+
+// DBTypes returns the set of database types to check. DB_TYPES lists them
+// explicitly; the deprecated DB_TYPE checks MySQL plus the given type; with
+// neither set the types are inferred from which configs are present.
+// configured tells which types have at least one target.
+func DBTypes(settings types.Settings, configured map[string]bool) (map[string]bool, error) {
+	dbTypes := map[string]bool{}
+
+	switch {
+	case settings.DBTypes != "":
+		for _, dbType := range strings.Split(settings.DBTypes, ",") {
+			dbType = strings.TrimSpace(dbType)
+			if dbType == "" {
+				continue
+			}
+			if !supportedDBType(dbType) {
+				return nil, fmt.Errorf("DB_TYPES: unsupported database type %q, supported: %s", dbType, strings.Join(SupportedDBTypes, ", "))
+			}
+			dbTypes[dbType] = true
+		}
+		if dbTypes["mysql"] && !configured["mysql"] {
+			return nil, fmt.Errorf("no MySQL databases configured, but DB_TYPES includes \"mysql\"")
+		}
+		if dbTypes["mongodb"] && !configured["mongodb"] {
+			return nil, fmt.Errorf("MONGODB_URI is not set, but DB_TYPES includes \"mongodb\"")
+		}
+		if dbTypes["mock"] && !configured["mock"] {
+			return nil, fmt.Errorf("no mock targets configured, but DB_TYPES includes \"mock\"")
+		}
+		if dbTypes["snowflake"] && !configured["snowflake"] {
+			return nil, fmt.Errorf("no Snowflake targets configured, but DB_TYPES includes \"snowflake\"")
+		}
+		if dbTypes["bigquery"] && !configured["bigquery"] {
+			return nil, fmt.Errorf("no BigQuery targets configured, but DB_TYPES includes \"bigquery\"")
+		}
+		if dbTypes["dynamodb"] && !configured["dynamodb"] {
+			return nil, fmt.Errorf("no DynamoDB targets configured, but DB_TYPES includes \"dynamodb\"")
+		}
+		if dbTypes["arangodb"] && !configured["arangodb"] {
+			return nil, fmt.Errorf("no ArangoDB targets configured, but DB_TYPES includes \"arangodb\"")
+		}
+		if dbTypes["spanner"] && !configured["spanner"] {
+			return nil, fmt.Errorf("no Spanner targets configured, but DB_TYPES includes \"spanner\"")
+		}
+		if dbTypes["firestore"] && !configured["firestore"] {
+			return nil, fmt.Errorf("no Firestore targets configured, but DB_TYPES includes \"firestore\"")
+		}
+		if dbTypes["trino"] && !configured["trino"] {
+			return nil, fmt.Errorf("no Trino targets configured, but DB_TYPES includes \"trino\"")
+		}
+		if dbTypes["redis"] && !configured["redis"] {
+			return nil, fmt.Errorf("no Redis targets configured, but DB_TYPES includes \"redis\"")
+		}
+		if dbTypes["smtp"] && !configured["smtp"] {
+			return nil, fmt.Errorf("no SMTP targets configured, but DB_TYPES includes \"smtp\"")
+		}
+		if dbTypes["imap"] && !configured["imap"] {
+			return nil, fmt.Errorf("no IMAP targets configured, but DB_TYPES includes \"imap\"")
+		}
+		if dbTypes["sftp"] && !configured["sftp"] {
+			return nil, fmt.Errorf("no SFTP targets configured, but DB_TYPES includes \"sftp\"")
+		}
+		if dbTypes["kafka"] && !configured["kafka"] {
+			return nil, fmt.Errorf("no Kafka targets configured, but DB_TYPES includes \"kafka\"")
+		}
+		if dbTypes["elasticsearch"] && !configured["elasticsearch"] {
+			return nil, fmt.Errorf("no Elasticsearch targets configured, but DB_TYPES includes \"elasticsearch\"")
+		}
+	case settings.DBType != "":
+		// MySQL was always checked with DB_TYPE, an empty list passes.
+		dbTypes["mysql"] = true
+		dbTypes[settings.DBType] = true
+		if dbTypes["mongodb"] && !configured["mongodb"] {
+			return nil, fmt.Errorf("MONGODB_URI is not set, but DB_TYPE is \"mongodb\"")
+		}
+	default:
+		for _, dbType := range SupportedDBTypes {
+			dbTypes[dbType] = configured[dbType]
+		}
+	}
+	return dbTypes, nil
+}
+
+// ListsDBType reports whether DB_TYPES names dbType explicitly.
+func ListsDBType(settings types.Settings, dbType string) bool {
+	for _, listed := range strings.Split(settings.DBTypes, ",") {
+		if strings.TrimSpace(listed) == dbType {
+			return true
+		}
+	}
+	return false
+}
+
+func supportedDBType(dbType string) bool {
+	for _, supported := range SupportedDBTypes {
+		if dbType == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestDBTypes(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   types.Settings
+		configured map[string]bool
+		want       map[string]bool
+		wantErr    bool
+	}{
+		{
+			name:       "inferred from configs",
+			configured: map[string]bool{"mysql": true, "mongodb": true},
+			want:       map[string]bool{"mysql": true, "mongodb": true, "mock": false, "snowflake": false, "bigquery": false, "dynamodb": false, "arangodb": false, "spanner": false, "firestore": false, "trino": false, "redis": false, "smtp": false, "imap": false, "sftp": false, "kafka": false, "elasticsearch": false},
+		},
+		{
+			name:       "inferred mongodb only",
+			configured: map[string]bool{"mongodb": true},
+			want:       map[string]bool{"mysql": false, "mongodb": true, "mock": false, "snowflake": false, "bigquery": false, "dynamodb": false, "arangodb": false, "spanner": false, "firestore": false, "trino": false, "redis": false, "smtp": false, "imap": false, "sftp": false, "kafka": false, "elasticsearch": false},
+		},
+		{
+			name:       "explicit list",
+			settings:   types.Settings{DBTypes: "mysql, mongodb"},
+			configured: map[string]bool{"mysql": true, "mongodb": true},
+			want:       map[string]bool{"mysql": true, "mongodb": true},
+		},
+		{
+			name:       "explicit list skips configured type",
+			settings:   types.Settings{DBTypes: "mongodb"},
+			configured: map[string]bool{"mysql": true, "mongodb": true},
+			want:       map[string]bool{"mongodb": true},
+		},
+		{
+			name:     "unsupported type",
+			settings: types.Settings{DBTypes: "mysql,postgres"},
+			wantErr:  true,
+		},
+		{
+			name:       "listed type without config",
+			settings:   types.Settings{DBTypes: "mysql,mongodb"},
+			configured: map[string]bool{"mysql": true},
+			wantErr:    true,
+		},
+		{
+			name:       "explicit mock",
+			settings:   types.Settings{DBTypes: "mock"},
+			configured: map[string]bool{"mock": true},
+			want:       map[string]bool{"mock": true},
+		},
+		{
+			name:       "mock without targets",
+			settings:   types.Settings{DBTypes: "mysql,mock"},
+			configured: map[string]bool{"mysql": true},
+			wantErr:    true,
+		},
+		{
+			name:     "legacy DB_TYPE always checks mysql",
+			settings: types.Settings{DBType: "mysql"},
+			want:     map[string]bool{"mysql": true},
+		},
+		{
+			name:       "legacy DB_TYPE mongodb",
+			settings:   types.Settings{DBType: "mongodb"},
+			configured: map[string]bool{"mongodb": true},
+			want:       map[string]bool{"mysql": true, "mongodb": true},
+		},
+		{
+			name:     "legacy DB_TYPE mongodb without uri",
+			settings: types.Settings{DBType: "mongodb"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DBTypes(tt.settings, tt.configured)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DBTypes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DBTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
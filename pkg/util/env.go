@@ -0,0 +1,181 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// EnvField describes one struct field read from the environment.
+type EnvField struct {
+	Env         string
+	Default     string
+	Required    bool
+	OneOf       []string
+	Format      string
+	Description string
+	Kind        reflect.Kind
+}
+
+// EnvFields returns the environment description of a struct type from its
+// env/default/required/oneof/format/desc tags.
+func EnvFields(v interface{}) []EnvField {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := []EnvField{}
+	for i := 0; i < t.NumField(); i++ {
+		if field, ok := envFieldOf(t.Field(i)); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func envFieldOf(field reflect.StructField) (EnvField, bool) {
+	env := field.Tag.Get("env")
+	if env == "" {
+		return EnvField{}, false
+	}
+	var oneOf []string
+	if tag, ok := field.Tag.Lookup("oneof"); ok {
+		oneOf = strings.Split(tag, ",")
+	}
+	return EnvField{
+		Env:         env,
+		Default:     field.Tag.Get("default"),
+		Required:    field.Tag.Get("required") == "true",
+		OneOf:       oneOf,
+		Format:      field.Tag.Get("format"),
+		Description: field.Tag.Get("desc"),
+		Kind:        field.Type.Kind(),
+	}, true
+}
+
+// lookupFunc returns the full name of a variable (used in messages) and its
+// raw value, empty if not set.
+type lookupFunc func(key string) (name string, value string)
+
+func envLookup(suffix string) lookupFunc {
+	return func(key string) (string, string) {
+		return key + suffix, os.Getenv(key + suffix)
+	}
+}
+
+func mapLookup(source string, values map[string]string) lookupFunc {
+	return func(key string) (string, string) {
+		return fmt.Sprintf("%s: %s", source, key), values[key]
+	}
+}
+
+// LoadEnv fills the tagged fields of the struct pointed to by v from
+// environment variables, appending suffix ("" or "_N") to every name.
+func LoadEnv(v interface{}, suffix string) {
+	if err := loadFields(v, envLookup(suffix)); err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// loadFields sets every field it can; numbers that fail to parse are left
+// zero and reported in the returned error.
+func loadFields(v interface{}, lookup lookupFunc) error {
+	value := reflect.ValueOf(v).Elem()
+	errs := []error{}
+
+	for i := 0; i < value.NumField(); i++ {
+		field, ok := envFieldOf(value.Type().Field(i))
+		if !ok {
+			continue
+		}
+
+		name, raw := lookup(field.Env)
+		if raw == "" {
+			raw = field.Default
+		}
+
+		switch field.Kind {
+		case reflect.String:
+			value.Field(i).SetString(raw)
+		case reflect.Bool:
+			value.Field(i).SetBool(raw == "true")
+		case reflect.Int:
+			num := 0
+			if raw != "" {
+				var err error
+				num, err = strconv.Atoi(raw)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("converting %s value %s to number: %v", name, raw, err))
+					continue
+				}
+			}
+			value.Field(i).SetInt(int64(num))
+		case reflect.Int64:
+			var d time.Duration
+			if raw != "" {
+				var err error
+				d, err = ParseDuration(raw)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("converting %s value %s to duration: %v", name, raw, err))
+					continue
+				}
+			}
+			value.Field(i).SetInt(int64(d))
+		case reflect.Float64:
+			num := 0.0
+			if raw != "" {
+				var err error
+				num, err = strconv.ParseFloat(raw, 64)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("converting %s value %s to number: %v", name, raw, err))
+					continue
+				}
+			}
+			value.Field(i).SetFloat(num)
+		default:
+			panic(fmt.Sprintf("unsupported kind %s for env %s", field.Kind, field.Env))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseDuration parses a Go duration ("30s", "1m30s") or a plain number of
+// seconds, as used by the older integer settings.
+func ParseDuration(raw string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration %s is negative", raw)
+	}
+	return d, nil
+}
+
+// LoadSettings reads the global options from the environment.
+func LoadSettings() types.Settings {
+	var settings types.Settings
+	LoadEnv(&settings, "")
+	return settings
+}
+
+func fieldsSet(v interface{}, lookup lookupFunc) bool {
+	for _, field := range EnvFields(v) {
+		if _, value := lookup(field.Env); value != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestLoadSettings(t *testing.T) {
+	for _, field := range EnvFields(types.Settings{}) {
+		os.Unsetenv(field.Env)
+	}
+
+	settings := LoadSettings()
+	if settings.DBType != "" || settings.Tries != 10 || settings.Exporter || settings.ExporterPort != "38080" {
+		t.Errorf("LoadSettings() defaults = %+v", settings)
+	}
+
+	if settings.RetryBase != 0 || settings.RetryMultiplier != 0 || settings.RetryMaxSleep != 0 {
+		t.Errorf("LoadSettings() retry defaults = %v/%v/%v, want zero", settings.RetryBase, settings.RetryMultiplier, settings.RetryMaxSleep)
+	}
+
+	os.Setenv("TRIES", "3")
+	os.Setenv("EXPORTER", "true")
+	os.Setenv("DB_TYPE", "mongodb")
+	os.Setenv("RETRY_MAX_SLEEP", "30s")
+	os.Setenv("RETRY_MULTIPLIER", "1.5")
+	defer os.Unsetenv("TRIES")
+	defer os.Unsetenv("EXPORTER")
+	defer os.Unsetenv("DB_TYPE")
+	defer os.Unsetenv("RETRY_MAX_SLEEP")
+	defer os.Unsetenv("RETRY_MULTIPLIER")
+
+	settings = LoadSettings()
+	if settings.Tries != 3 || !settings.Exporter || settings.DBType != "mongodb" {
+		t.Errorf("LoadSettings() from env = %+v", settings)
+	}
+	if settings.RetryMaxSleep != 30*time.Second || settings.RetryMultiplier != 1.5 {
+		t.Errorf("LoadSettings() retry from env = %v/%v", settings.RetryMaxSleep, settings.RetryMultiplier)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{raw: "30s", want: 30 * time.Second},
+		{raw: "1m30s", want: 90 * time.Second},
+		{raw: "500ms", want: 500 * time.Millisecond},
+		{raw: "45", want: 45 * time.Second},
+		{raw: "-5s", wantErr: true},
+		{raw: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseDuration(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDuration(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvWithSuffix(t *testing.T) {
+	os.Setenv("MYSQL_HOST_7", "db7")
+	os.Setenv("MYSQL_TLS_7", "true")
+	defer os.Unsetenv("MYSQL_HOST_7")
+	defer os.Unsetenv("MYSQL_TLS_7")
+
+	var config types.MysqlConfig
+	LoadEnv(&config, "_7")
+
+	if config.Host != "db7" {
+		t.Errorf("LoadEnv() Host = %q, want %q", config.Host, "db7")
+	}
+	if config.Port != "3306" {
+		t.Errorf("LoadEnv() Port = %q, want default %q", config.Port, "3306")
+	}
+	if !config.TLS {
+		t.Error("LoadEnv() TLS = false, want true")
+	}
+	if config.TLSCAFile != "/etc/ssl/certs/ca-certificates.crt" {
+		t.Errorf("LoadEnv() TLSCAFile = %q, want default CA bundle", config.TLSCAFile)
+	}
+}
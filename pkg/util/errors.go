@@ -0,0 +1,181 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Error classes shared by the check packages. Check errors wrap one of them
+// when the class is known, so callers can use errors.Is instead of matching
+// messages. Each message is the reason reported for the class.
+var (
+	ErrAuthFailed      = errors.New("auth error")
+	ErrUnknownDatabase = errors.New("unknown database")
+	ErrDNS             = errors.New("dns error")
+	ErrTimeout         = errors.New("timeout")
+	ErrTLS             = errors.New("tls error")
+	ErrClockSkew       = errors.New("clock skew")
+	// ErrVariableMismatch is a server variable differing from the value
+	// expected for the target.
+	ErrVariableMismatch = errors.New("variable mismatch")
+	// ErrLowFreeSpace is less free space in the tablespaces of a database
+	// than required.
+	ErrLowFreeSpace = errors.New("low free space")
+	// ErrTooManyThreads is a server with more connected or running threads
+	// than allowed.
+	ErrTooManyThreads = errors.New("too many threads")
+	// ErrFlowControl is a Galera node that spent more time paused by flow
+	// control than allowed.
+	ErrFlowControl = errors.New("flow control")
+	// ErrShardNotServing is a Vitess shard without a serving primary
+	// tablet, e.g. during a failover or resharding.
+	ErrShardNotServing = errors.New("shard not serving")
+	// ErrTooFewWorkers is a Trino cluster with fewer active workers than
+	// required.
+	ErrTooFewWorkers = errors.New("too few workers")
+	// ErrClusterUnhealthy is an Elasticsearch or OpenSearch cluster whose
+	// health is worse than required.
+	ErrClusterUnhealthy = errors.New("cluster unhealthy")
+	// ErrMissingPrivilege is a user without a privilege the target needs,
+	// e.g. REPLICATION SLAVE for change data capture.
+	ErrMissingPrivilege = errors.New("missing privilege")
+	// ErrConnectorNotRunning is a Kafka Connect connector, or one of its
+	// tasks, that is missing, paused or failed.
+	ErrConnectorNotRunning = errors.New("connector not running")
+	// ErrHostKeyMismatch is an SSH server whose host key is not the one
+	// known for it.
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+)
+
+// classifiedError adds a class to err without changing its message.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.class, e.err}
+}
+
+// WithClass wraps err so that errors.Is(err, class) is true. The message
+// and the chain of err are kept, so errors.As still finds driver errors.
+func WithClass(class, err error) error {
+	if err == nil || class == nil || errors.Is(err, class) {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// ClassifyNetError wraps network level errors with ErrDNS, ErrTimeout or
+// ErrTLS. Other errors are returned unchanged.
+func ClassifyNetError(err error) error {
+	return WithClass(netErrorClass(err), err)
+}
+
+func netErrorClass(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrDNS
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &certInvalidErr) || errors.As(err, &recordHeaderErr) {
+		return ErrTLS
+	}
+	return nil
+}
+
+// NetErrorReason returns a short human readable class for network level
+// errors shared by all database drivers. Driver specific classification
+// (auth errors, unknown database, ...) is done by the check packages.
+func NetErrorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "connection refused"
+	}
+	if errors.Is(err, ErrClockSkew) {
+		return ErrClockSkew.Error()
+	}
+	if errors.Is(err, ErrVariableMismatch) {
+		return ErrVariableMismatch.Error()
+	}
+	if errors.Is(err, ErrLowFreeSpace) {
+		return ErrLowFreeSpace.Error()
+	}
+	if errors.Is(err, ErrTooManyThreads) {
+		return ErrTooManyThreads.Error()
+	}
+	if errors.Is(err, ErrFlowControl) {
+		return ErrFlowControl.Error()
+	}
+	if errors.Is(err, ErrShardNotServing) {
+		return ErrShardNotServing.Error()
+	}
+	if errors.Is(err, ErrTooFewWorkers) {
+		return ErrTooFewWorkers.Error()
+	}
+	if errors.Is(err, ErrClusterUnhealthy) {
+		return ErrClusterUnhealthy.Error()
+	}
+	if errors.Is(err, ErrMissingPrivilege) {
+		return ErrMissingPrivilege.Error()
+	}
+	if errors.Is(err, ErrConnectorNotRunning) {
+		return ErrConnectorNotRunning.Error()
+	}
+	if errors.Is(err, ErrHostKeyMismatch) {
+		return ErrHostKeyMismatch.Error()
+	}
+	if class := netErrorClass(err); class != nil {
+		return class.Error()
+	}
+	return "error"
+}
+
+// CheckClockSkew returns an error of class ErrClockSkew if the server clock
+// is more than max ahead of or behind the local one. skew is the server time
+// minus the local time.
+func CheckClockSkew(skew, max time.Duration) error {
+	if skew.Abs() <= max {
+		return nil
+	}
+	return WithClass(ErrClockSkew, fmt.Errorf("server clock is %v off the local clock, more than %v", skew.Round(time.Millisecond), max))
+}
+
+var uriPassword = regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`)
+
+// Redact hides the given secrets and passwords embedded in connection URIs,
+// so that driver error messages can be exposed over HTTP.
+func Redact(message string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			message = strings.ReplaceAll(message, secret, "****")
+		}
+	}
+	return uriPassword.ReplaceAllString(message, "${1}****@")
+}
@@ -4,9 +4,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
+	"github.com/tapclap/db-connect-checker/pkg/log"
 	"github.com/tapclap/db-connect-checker/pkg/types"
 )
 
@@ -25,13 +31,181 @@ func (o OsFileReader) ReadFile(filename string) ([]byte, error) {
 // defaultFileReader is the default implementation used in production
 var defaultFileReader FileReader = OsFileReader{}
 
-func GetAllMysqlConfigsFromEnvs() []types.MysqlConfig {
-	configs := []types.MysqlConfig{}
-	for i := 0; true; i++ {
-		config, err := getMysqlConfigFromEnvsByIndex(i)
+// targetType returns TARGET_TYPE with the given suffix. If it is not set,
+// the target is a MongoDB one when MONGODB_URI with the suffix is set and a
+// MySQL one otherwise.
+func targetType(suffix string) string {
+	if os.Getenv("TARGET_TYPE"+suffix) == "" && os.Getenv("MONGODB_URI"+suffix) != "" {
+		return "mongodb"
+	}
+	var target types.TargetConfig
+	LoadEnv(&target, suffix)
+	return target.Type
+}
+
+// configTypes are the indexed target types configured by a struct of
+// types with env tags, e.g. MOCK_* for TARGET_TYPE_N=mock.
+var configTypes = map[string]interface{}{
+	"mock":          types.MockConfig{},
+	"snowflake":     types.SnowflakeConfig{},
+	"bigquery":      types.BigQueryConfig{},
+	"dynamodb":      types.DynamoDBConfig{},
+	"arangodb":      types.ArangoDBConfig{},
+	"spanner":       types.SpannerConfig{},
+	"firestore":     types.FirestoreConfig{},
+	"trino":         types.TrinoConfig{},
+	"redis":         types.RedisConfig{},
+	"smtp":          types.SMTPConfig{},
+	"imap":          types.IMAPConfig{},
+	"sftp":          types.SFTPConfig{},
+	"kafka":         types.KafkaConfig{},
+	"elasticsearch": types.ElasticsearchConfig{},
+}
+
+// MaxTargetIndex is the highest index of _N variables read (MAX_TARGET_INDEX).
+// Up to it, indices without a complete target are skipped; 0 keeps the old
+// behavior of ending the list at the first such index.
+var MaxTargetIndex int
+
+// indexedTarget is the target configured by the variables with suffix _N.
+type indexedTarget struct {
+	index      int
+	targetType string
+}
+
+// indexedTargets returns every complete indexed target, stopping at the
+// first index without a complete config unless MaxTargetIndex is set.
+func indexedTargets() []indexedTarget {
+	targets := []indexedTarget{}
+	for i := 0; MaxTargetIndex == 0 || i <= MaxTargetIndex; i++ {
+		targetType, err := indexedTargetType(i)
 		if err != nil {
+			if MaxTargetIndex == 0 {
+				break
+			}
+			continue
+		}
+		targets = append(targets, indexedTarget{index: i, targetType: targetType})
+	}
+	return targets
+}
+
+// indexedTargetType returns the type of the target with index, or why its
+// config is incomplete.
+func indexedTargetType(index int) (string, error) {
+	suffix := fmt.Sprintf("_%d", index)
+	targetType := targetType(suffix)
+	switch targetType {
+	case "mongodb":
+		if os.Getenv("MONGODB_URI"+suffix) == "" {
+			return "", fmt.Errorf("MONGODB_URI%s is not set", suffix)
+		}
+	case "mysql":
+		config := readMysqlConfig(suffix)
+		missing := []string{}
+		for name, value := range map[string]string{"MYSQL_NAME": config.Name, "MYSQL_USER": config.User, "MYSQL_PASS": config.Pass, "MYSQL_HOST": config.Host, "MYSQL_PORT": config.Port} {
+			if value == "" {
+				missing = append(missing, name+suffix)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return "", fmt.Errorf("%s not set", strings.Join(missing, ", "))
+		}
+	default:
+		config, ok := configTypes[targetType]
+		if !ok {
 			break
 		}
+		for _, field := range EnvFields(config) {
+			if field.Required && os.Getenv(field.Env+suffix) == "" {
+				return "", fmt.Errorf("%s%s is not set", field.Env, suffix)
+			}
+		}
+	}
+	return targetType, nil
+}
+
+// IndexWarnings describes indexed variables that configure no target: those
+// of incomplete targets, those behind the first gap when MaxTargetIndex is 0
+// and those above MaxTargetIndex. Without MaxTargetIndex, indices that are
+// not set at all are only reported when later ones are lost behind them.
+func IndexWarnings() []string {
+	present := indexedVariables()
+	complete := map[int]bool{}
+	for _, target := range indexedTargets() {
+		complete[target.index] = true
+	}
+	indices := make([]int, 0, len(present))
+	for index := range present {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	warnings := []string{}
+	if MaxTargetIndex > 0 && len(indices) > 0 {
+		for i := 0; i < min(indices[len(indices)-1], MaxTargetIndex); i++ {
+			if _, ok := present[i]; !ok {
+				warnings = append(warnings, fmt.Sprintf("no target with index _%d, skipped", i))
+			}
+		}
+	}
+	// Without MaxTargetIndex the list ends at the first incomplete index.
+	end := len(complete)
+	for _, index := range indices {
+		if complete[index] {
+			continue
+		}
+		names := strings.Join(present[index], ", ")
+		switch {
+		case MaxTargetIndex == 0 && index > end:
+			warnings = append(warnings, fmt.Sprintf("%s ignored: indexed targets end at index _%d, which is incomplete or not set; set MAX_TARGET_INDEX to read past it", names, end))
+		case MaxTargetIndex > 0 && index > MaxTargetIndex:
+			warnings = append(warnings, fmt.Sprintf("%s ignored: index is above MAX_TARGET_INDEX=%d", names, MaxTargetIndex))
+		default:
+			_, err := indexedTargetType(index)
+			warnings = append(warnings, fmt.Sprintf("target with index _%d skipped: %v", index, err))
+		}
+	}
+	return warnings
+}
+
+// indexedVariables returns the set variables of indexed targets, sorted and
+// grouped by index.
+func indexedVariables() map[int][]string {
+	known := map[string]bool{}
+	for _, config := range append([]interface{}{types.TargetConfig{}, types.MysqlConfig{}, types.MongoConfig{}}, configValues()...) {
+		for _, field := range EnvFields(config) {
+			known[field.Env] = true
+		}
+	}
+
+	variables := map[int][]string{}
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		cut := strings.LastIndex(name, "_")
+		if cut < 0 || value == "" || !known[name[:cut]] {
+			continue
+		}
+		index, err := strconv.Atoi(name[cut+1:])
+		if err != nil || index < 0 || name[cut+1:] != strconv.Itoa(index) {
+			continue
+		}
+		variables[index] = append(variables[index], name)
+	}
+	for _, names := range variables {
+		sort.Strings(names)
+	}
+	return variables
+}
+
+func GetAllMysqlConfigsFromEnvs() []types.MysqlConfig {
+	configs := []types.MysqlConfig{}
+	for _, target := range indexedTargets() {
+		if target.targetType != "mysql" {
+			continue
+		}
+		config, _ := getMysqlConfigFromEnvsByIndex(target.index)
 		configs = append(configs, config)
 	}
 
@@ -40,53 +214,269 @@ func GetAllMysqlConfigsFromEnvs() []types.MysqlConfig {
 		configs = append(configs, config)
 	}
 
-	if len(configs) > 0 {
-		fmt.Println("Discovered MySQL configurations from environment variables:")
-		for _, config := range configs {
-			fmt.Printf(" - %s@%s:%s/%s\n", config.User, config.Host, config.Port, config.Name)
+	for _, config := range configs {
+		log.Info("Discovered MySQL configuration in environment variables", log.Target(config.Target()), "user", config.User)
+	}
+
+	return configs
+}
+
+// GetAllMongoURIsFromEnvs returns MONGODB_URI_N of the indexed MongoDB
+// targets, those with TARGET_TYPE_N=mongodb or with MONGODB_URI_N and no
+// TARGET_TYPE_N, followed by MONGODB_URI, if set.
+func GetAllMongoURIsFromEnvs() []string {
+	uris := []string{}
+	for _, target := range indexedTargets() {
+		if target.targetType == "mongodb" {
+			uris = append(uris, os.Getenv(fmt.Sprintf("MONGODB_URI_%d", target.index)))
 		}
 	}
 
+	var config types.MongoConfig
+	LoadEnv(&config, "")
+	if config.URI != "" {
+		uris = append(uris, config.URI)
+	}
+
+	for _, uri := range uris {
+		log.Info("Discovered MongoDB configuration in environment variables", "db_type", "mongodb", "uri", redactURI(uri))
+	}
+	return uris
+}
+
+// redactURI returns uri with its password replaced by "xxxxx".
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "<invalid URI>"
+	}
+	return u.Redacted()
+}
+
+// GetAllMockConfigsFromEnvs returns the MOCK_* configs of the indexed
+// targets with TARGET_TYPE_N=mock.
+func GetAllMockConfigsFromEnvs() []types.MockConfig {
+	return indexedConfigs[types.MockConfig]("mock")
+}
+
+// GetAllSnowflakeConfigsFromEnvs returns the SNOWFLAKE_* configs of the
+// indexed targets with TARGET_TYPE_N=snowflake.
+func GetAllSnowflakeConfigsFromEnvs() []types.SnowflakeConfig {
+	return indexedConfigs[types.SnowflakeConfig]("snowflake")
+}
+
+// GetAllBigQueryConfigsFromEnvs returns the BIGQUERY_* configs of the
+// indexed targets with TARGET_TYPE_N=bigquery.
+func GetAllBigQueryConfigsFromEnvs() []types.BigQueryConfig {
+	return indexedConfigs[types.BigQueryConfig]("bigquery")
+}
+
+// GetAllDynamoDBConfigsFromEnvs returns the DYNAMODB_* configs of the
+// indexed targets with TARGET_TYPE_N=dynamodb.
+func GetAllDynamoDBConfigsFromEnvs() []types.DynamoDBConfig {
+	return indexedConfigs[types.DynamoDBConfig]("dynamodb")
+}
+
+// GetAllArangoDBConfigsFromEnvs returns the ARANGODB_* configs of the
+// indexed targets with TARGET_TYPE_N=arangodb.
+func GetAllArangoDBConfigsFromEnvs() []types.ArangoDBConfig {
+	return indexedConfigs[types.ArangoDBConfig]("arangodb")
+}
+
+// GetAllSpannerConfigsFromEnvs returns the SPANNER_* configs of the indexed
+// targets with TARGET_TYPE_N=spanner.
+func GetAllSpannerConfigsFromEnvs() []types.SpannerConfig {
+	return indexedConfigs[types.SpannerConfig]("spanner")
+}
+
+// GetAllFirestoreConfigsFromEnvs returns the FIRESTORE_* configs of the
+// indexed targets with TARGET_TYPE_N=firestore.
+func GetAllFirestoreConfigsFromEnvs() []types.FirestoreConfig {
+	return indexedConfigs[types.FirestoreConfig]("firestore")
+}
+
+// GetAllTrinoConfigsFromEnvs returns the TRINO_* configs of the indexed
+// targets with TARGET_TYPE_N=trino.
+func GetAllTrinoConfigsFromEnvs() []types.TrinoConfig {
+	return indexedConfigs[types.TrinoConfig]("trino")
+}
+
+// GetAllRedisConfigsFromEnvs returns the REDIS_* configs of the indexed
+// targets with TARGET_TYPE_N=redis followed by the one without a suffix, if
+// REDIS_ADDR is set.
+func GetAllRedisConfigsFromEnvs() []types.RedisConfig {
+	configs := indexedConfigs[types.RedisConfig]("redis")
+	if os.Getenv("REDIS_ADDR") != "" {
+		var config types.RedisConfig
+		LoadEnv(&config, "")
+		configs = append(configs, config)
+	}
 	return configs
 }
 
-func getMysqlConfigFromEnvsByIndex(index int) (types.MysqlConfig, error) {
+// GetAllSMTPConfigsFromEnvs returns the SMTP_* configs of the indexed
+// targets with TARGET_TYPE_N=smtp.
+func GetAllSMTPConfigsFromEnvs() []types.SMTPConfig {
+	return indexedConfigs[types.SMTPConfig]("smtp")
+}
+
+// GetAllIMAPConfigsFromEnvs returns the IMAP_* configs of the indexed
+// targets with TARGET_TYPE_N=imap.
+func GetAllIMAPConfigsFromEnvs() []types.IMAPConfig {
+	return indexedConfigs[types.IMAPConfig]("imap")
+}
+
+// GetAllSFTPConfigsFromEnvs returns the SFTP_* configs of the indexed
+// targets with TARGET_TYPE_N=sftp.
+func GetAllSFTPConfigsFromEnvs() []types.SFTPConfig {
+	return indexedConfigs[types.SFTPConfig]("sftp")
+}
+
+// GetAllKafkaConfigsFromEnvs returns the KAFKA_* configs of the indexed
+// targets with TARGET_TYPE_N=kafka followed, if unsuffixed is set, by the
+// one without a suffix if KAFKA_BROKERS is set. The variables without a
+// suffix configure the event sink as well, so callers only ask for them
+// when DB_TYPES lists kafka.
+func GetAllKafkaConfigsFromEnvs(unsuffixed bool) []types.KafkaConfig {
+	configs := indexedConfigs[types.KafkaConfig]("kafka")
+	if unsuffixed && os.Getenv("KAFKA_BROKERS") != "" {
+		var config types.KafkaConfig
+		LoadEnv(&config, "")
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// GetAllElasticsearchConfigsFromEnvs returns the ELASTICSEARCH_* configs of
+// the indexed targets with TARGET_TYPE_N=elasticsearch followed by the one
+// without a suffix, if ELASTICSEARCH_URL is set.
+func GetAllElasticsearchConfigsFromEnvs() []types.ElasticsearchConfig {
+	configs := indexedConfigs[types.ElasticsearchConfig]("elasticsearch")
+	if os.Getenv("ELASTICSEARCH_URL") != "" {
+		var config types.ElasticsearchConfig
+		LoadEnv(&config, "")
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// indexedConfigs reads the config of every indexed target of the type name,
+// one of configTypes.
+func indexedConfigs[T any](name string) []T {
+	configs := []T{}
+	for _, target := range indexedTargets() {
+		if target.targetType == name {
+			var config T
+			LoadEnv(&config, fmt.Sprintf("_%d", target.index))
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
+
+// configValues returns the config structs of configTypes in a stable order.
+func configValues() []interface{} {
+	names := make([]string, 0, len(configTypes))
+	for name := range configTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = configTypes[name]
+	}
+	return values
+}
+
+// TargetFields returns the variables that configure a target of
+// targetType, one of the values of TARGET_TYPE, or nil for unknown types.
+func TargetFields(targetType string) []EnvField {
+	switch targetType {
+	case "mysql":
+		return EnvFields(types.MysqlConfig{})
+	case "mongodb":
+		return EnvFields(types.MongoConfig{})
+	}
+	config, ok := configTypes[targetType]
+	if !ok {
+		return nil
+	}
+	return EnvFields(config)
+}
+
+// TargetFromValues reads a target of targetType, one of configTypes, from
+// values keyed by its variable names without the _N suffix. source
+// prefixes the names in errors.
+func TargetFromValues(source, targetType string, values map[string]string) (types.Target, []error) {
+	config, ok := configTypes[targetType]
+	if !ok {
+		return types.Target{}, []error{fmt.Errorf("%s: unsupported target type %q", source, targetType)}
+	}
+	lookup := mapLookup(source, values)
+	if errs := validateFields(config, lookup); len(errs) > 0 {
+		return types.Target{}, errs
+	}
+	value := reflect.New(reflect.TypeOf(config))
+	loadFields(value.Interface(), lookup)
+	return value.Elem().Interface().(interface{ Target() types.Target }).Target(), nil
+}
+
+// readMysqlConfig reads MYSQL_* variables with the given suffix ("" or "_N")
+// without validating them or loading the CA file.
+func readMysqlConfig(suffix string) types.MysqlConfig {
 	var config types.MysqlConfig
-	config.Name = GetEnvString(fmt.Sprintf("MYSQL_NAME_%d", index), "")
-	config.User = GetEnvString(fmt.Sprintf("MYSQL_USER_%d", index), "")
-	config.Pass = GetEnvString(fmt.Sprintf("MYSQL_PASS_%d", index), "")
-	config.Host = GetEnvString(fmt.Sprintf("MYSQL_HOST_%d", index), "")
-	config.Port = GetEnvString(fmt.Sprintf("MYSQL_PORT_%d", index), "3306")
-	config.TLS = GetEnvBool(fmt.Sprintf("MYSQL_TLS_%d", index), false)
-
-	capath := GetEnvString(fmt.Sprintf("MYSQL_TLS_CA_FILE_%d", index), "/etc/ssl/certs/ca-certificates.crt")
-	if config.TLS {
-		config.TLSConfig = mysqlTLSConfig(capath, defaultFileReader)
+	LoadEnv(&config, suffix)
+	if !config.TLS {
+		config.TLSCAFile = ""
 	}
+	defaultMysqlHost(&config)
+	return config
+}
+
+// defaultMysqlHost sets an empty MYSQL_HOST to the host of the first of
+// MYSQL_HOSTS, which then names the target.
+func defaultMysqlHost(config *types.MysqlConfig) {
+	if config.Host != "" {
+		return
+	}
+	endpoints, err := types.ParseHosts(config.Hosts, config.Port)
+	if err != nil || len(endpoints) == 0 {
+		return
+	}
+	config.Host, _, _ = net.SplitHostPort(endpoints[0])
+}
+
+func getMysqlConfigFromEnvsByIndex(index int) (types.MysqlConfig, error) {
+	config := readMysqlConfig(fmt.Sprintf("_%d", index))
 
 	if config.Name == "" || config.User == "" || config.Pass == "" || config.Host == "" || config.Port == "" {
 		return types.MysqlConfig{}, fmt.Errorf("no MySQL config found for index %d", index)
 	}
+
+	if config.TLS {
+		config.TLSConfig = mysqlTLSConfig(config.TLSCAFile, defaultFileReader)
+	}
 	return config, nil
 }
 
 func getMysqlConfigFromEnvs() types.MysqlConfig {
-	var config types.MysqlConfig
-	config.Name = GetEnvString("MYSQL_NAME", "")
-	config.User = GetEnvString("MYSQL_USER", "")
-	config.Pass = GetEnvString("MYSQL_PASS", "")
-	config.Host = GetEnvString("MYSQL_HOST", "")
-	config.Port = GetEnvString("MYSQL_PORT", "3306")
-	config.TLS = GetEnvBool("MYSQL_TLS", false)
-
-	capath := GetEnvString("MYSQL_TLS_CA_FILE", "/etc/ssl/certs/ca-certificates.crt")
+	config := readMysqlConfig("")
 	if config.TLS {
-		config.TLSConfig = mysqlTLSConfig(capath, defaultFileReader)
+		config.TLSConfig = mysqlTLSConfig(config.TLSCAFile, defaultFileReader)
 	}
 	return config
 }
 
 func mysqlTLSConfig(capath string, reader FileReader) *tls.Config {
+	tlsConfig, err := loadTLSConfig(capath, reader)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	return tlsConfig
+}
+
+func loadTLSConfig(capath string, reader FileReader) (*tls.Config, error) {
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: true,
 	}
@@ -94,17 +484,13 @@ func mysqlTLSConfig(capath string, reader FileReader) *tls.Config {
 	rootCertPool := x509.NewCertPool()
 	pem, err := reader.ReadFile(capath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading CA file: %v\n", err)
-		os.Exit(1)
-
+		return nil, fmt.Errorf("reading CA file: %v", err)
 	}
 	if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
-		fmt.Fprintf(os.Stderr, "Error appending CA cert\n")
-		os.Exit(1)
+		return nil, fmt.Errorf("appending CA cert from %s", capath)
 	}
 	tlsConfig.RootCAs = rootCertPool
-	return tlsConfig
-
+	return tlsConfig, nil
 }
 
 func GetEnvString(key string, defaultValue string) string {
@@ -130,8 +516,13 @@ func GetEnvNumber(key string, defaultValue int) int {
 	}
 	num, err := strconv.Atoi(value)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error converting env %s value %s to number: %v\n", key, value, err)
+		log.Error("Error converting env value to number", "env", key, "value", value, "error", err)
 		os.Exit(1)
 	}
 	return num
 }
+
+// LoadTLSConfig builds a TLS config trusting the CA bundle at capath.
+func LoadTLSConfig(capath string) (*tls.Config, error) {
+	return loadTLSConfig(capath, defaultFileReader)
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// MysqlSource is a set of MySQL targets read from one place, such as the
+// environment or a targets directory.
+type MysqlSource struct {
+	Name    string
+	Configs []types.MysqlConfig
+}
+
+// TargetConflict describes a target (host:port/database) configured more
+// than once with different settings.
+type TargetConflict struct {
+	Target string `json:"target"`
+	// Sources lists where the target is configured; the settings of the first
+	// one are used.
+	Sources []string `json:"sources"`
+	// Fields lists the variables that differ, without their values.
+	Fields []string `json:"fields"`
+}
+
+// ReconcileMysqlConfigs merges sources into one list with a single config per
+// host:port/database, keeping the first one in source order. Identical
+// duplicates are dropped silently, different ones are reported as conflicts.
+func ReconcileMysqlConfigs(sources ...MysqlSource) ([]types.MysqlConfig, []TargetConflict) {
+	configs := []types.MysqlConfig{}
+	firstSource := map[string]string{}
+	index := map[string]int{}
+	conflicts := []TargetConflict{}
+	conflictIndex := map[string]int{}
+
+	for _, source := range sources {
+		for _, config := range source.Configs {
+			target := mysqlTargetName(config)
+			i, seen := index[target]
+			if !seen {
+				index[target] = len(configs)
+				firstSource[target] = source.Name
+				configs = append(configs, config)
+				continue
+			}
+
+			fields := differentFields(configs[i], config)
+			if len(fields) == 0 {
+				continue
+			}
+			if c, ok := conflictIndex[target]; ok {
+				conflicts[c].Sources = merge(conflicts[c].Sources, []string{source.Name})
+				conflicts[c].Fields = merge(conflicts[c].Fields, fields)
+				continue
+			}
+			conflictIndex[target] = len(conflicts)
+			conflicts = append(conflicts, TargetConflict{
+				Target:  target,
+				Sources: []string{firstSource[target], source.Name},
+				Fields:  fields,
+			})
+		}
+	}
+	return configs, conflicts
+}
+
+func mysqlTargetName(config types.MysqlConfig) string {
+	return fmt.Sprintf("%s:%s/%s", config.Host, config.Port, config.Name)
+}
+
+// differentFields returns the variables whose values differ in a and b.
+func differentFields(a, b types.MysqlConfig) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	fields := []string{}
+	for i := 0; i < va.NumField(); i++ {
+		field, ok := envFieldOf(va.Type().Field(i))
+		if !ok {
+			continue
+		}
+		if va.Field(i).Interface() != vb.Field(i).Interface() {
+			fields = append(fields, field.Env)
+		}
+	}
+	return fields
+}
+
+// merge appends the elements of more missing from list.
+func merge(list, more []string) []string {
+	for _, s := range more {
+		if !slices.Contains(list, s) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestReconcileMysqlConfigs(t *testing.T) {
+	orders := types.MysqlConfig{Name: "orders", User: "app", Pass: "secret", Host: "orders-db", Port: "3306"}
+	billing := types.MysqlConfig{Name: "billing", User: "app", Pass: "secret", Host: "billing-db", Port: "3306"}
+	ordersOtherUser := orders
+	ordersOtherUser.User = "checker"
+	ordersOtherUser.Pass = "other"
+	ordersTLS := orders
+	ordersTLS.TLS = true
+
+	tests := []struct {
+		name          string
+		sources       []MysqlSource
+		wantUsers     map[string]string
+		wantConflicts []TargetConflict
+	}{
+		{
+			name: "distinct targets are merged",
+			sources: []MysqlSource{
+				{Name: "env", Configs: []types.MysqlConfig{orders}},
+				{Name: "/targets", Configs: []types.MysqlConfig{billing}},
+			},
+			wantUsers:     map[string]string{"orders-db:3306/orders": "app", "billing-db:3306/billing": "app"},
+			wantConflicts: []TargetConflict{},
+		},
+		{
+			name: "identical duplicate is dropped",
+			sources: []MysqlSource{
+				{Name: "env", Configs: []types.MysqlConfig{orders}},
+				{Name: "/targets", Configs: []types.MysqlConfig{orders, billing}},
+			},
+			wantUsers:     map[string]string{"orders-db:3306/orders": "app", "billing-db:3306/billing": "app"},
+			wantConflicts: []TargetConflict{},
+		},
+		{
+			name: "different duplicate is a conflict and the first source wins",
+			sources: []MysqlSource{
+				{Name: "env", Configs: []types.MysqlConfig{orders}},
+				{Name: "/targets", Configs: []types.MysqlConfig{ordersOtherUser}},
+			},
+			wantUsers: map[string]string{"orders-db:3306/orders": "app"},
+			wantConflicts: []TargetConflict{
+				{Target: "orders-db:3306/orders", Sources: []string{"env", "/targets"}, Fields: []string{"MYSQL_USER", "MYSQL_PASS"}},
+			},
+		},
+		{
+			name: "conflicts of one target are combined",
+			sources: []MysqlSource{
+				{Name: "env", Configs: []types.MysqlConfig{orders}},
+				{Name: "/targets", Configs: []types.MysqlConfig{ordersOtherUser, ordersTLS}},
+			},
+			wantUsers: map[string]string{"orders-db:3306/orders": "app"},
+			wantConflicts: []TargetConflict{
+				{Target: "orders-db:3306/orders", Sources: []string{"env", "/targets"}, Fields: []string{"MYSQL_USER", "MYSQL_PASS", "MYSQL_TLS"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs, conflicts := ReconcileMysqlConfigs(tt.sources...)
+
+			users := map[string]string{}
+			for _, config := range configs {
+				users[mysqlTargetName(config)] = config.User
+			}
+			if len(configs) != len(users) || !reflect.DeepEqual(users, tt.wantUsers) {
+				t.Errorf("ReconcileMysqlConfigs() configs = %v, want users %v", configs, tt.wantUsers)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("ReconcileMysqlConfigs() conflicts = %+v, want %+v", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// WriteSampleEnv writes a commented example environment block with every
+// supported option. It is generated from the struct tags of the config
+// types, so it always matches what the checker actually reads.
+func WriteSampleEnv(w io.Writer) {
+	sections := []struct {
+		title  string
+		note   string
+		config interface{}
+		suffix string
+	}{
+		{
+			title:  "General options",
+			config: types.Settings{},
+		},
+		{
+			title:  "Target type",
+			note:   "Use suffixes _0, _1, ... to configure several databases, or no suffix for a single one.",
+			config: types.TargetConfig{},
+			suffix: "_0",
+		},
+		{
+			title:  "MySQL target",
+			config: types.MysqlConfig{},
+			suffix: "_0",
+		},
+		{
+			title:  "MongoDB target",
+			config: types.MongoConfig{},
+		},
+		{
+			title:  "Mock target",
+			note:   "Set TARGET_TYPE_N=mock to add a fake target that needs no database.",
+			config: types.MockConfig{},
+			suffix: "_1",
+		},
+		{
+			title:  "Snowflake target",
+			note:   "Set TARGET_TYPE_N=snowflake to check a Snowflake account.",
+			config: types.SnowflakeConfig{},
+			suffix: "_2",
+		},
+		{
+			title:  "BigQuery target",
+			note:   "Set TARGET_TYPE_N=bigquery to check a BigQuery dataset.",
+			config: types.BigQueryConfig{},
+			suffix: "_3",
+		},
+		{
+			title:  "DynamoDB target",
+			note:   "Set TARGET_TYPE_N=dynamodb to check a DynamoDB table.",
+			config: types.DynamoDBConfig{},
+			suffix: "_4",
+		},
+		{
+			title:  "ArangoDB target",
+			note:   "Set TARGET_TYPE_N=arangodb to check an ArangoDB server.",
+			config: types.ArangoDBConfig{},
+			suffix: "_5",
+		},
+		{
+			title:  "Spanner target",
+			note:   "Set TARGET_TYPE_N=spanner to check a Cloud Spanner database.",
+			config: types.SpannerConfig{},
+			suffix: "_6",
+		},
+		{
+			title:  "Firestore target",
+			note:   "Set TARGET_TYPE_N=firestore to check a Firestore or Datastore database.",
+			config: types.FirestoreConfig{},
+			suffix: "_7",
+		},
+		{
+			title:  "Trino target",
+			note:   "Set TARGET_TYPE_N=trino to check a Trino or Presto coordinator.",
+			config: types.TrinoConfig{},
+			suffix: "_8",
+		},
+		{
+			title:  "Redis target",
+			note:   "Set TARGET_TYPE_N=redis to check a Redis server, or set REDIS_* without a suffix.",
+			config: types.RedisConfig{},
+			suffix: "_9",
+		},
+		{
+			title:  "SMTP target",
+			note:   "Set TARGET_TYPE_N=smtp to check a mail relay.",
+			config: types.SMTPConfig{},
+			suffix: "_10",
+		},
+		{
+			title:  "IMAP target",
+			note:   "Set TARGET_TYPE_N=imap to check a mail store.",
+			config: types.IMAPConfig{},
+			suffix: "_11",
+		},
+		{
+			title:  "SFTP target",
+			note:   "Set TARGET_TYPE_N=sftp to check a file drop.",
+			config: types.SFTPConfig{},
+			suffix: "_12",
+		},
+		{
+			title:  "Kafka target",
+			note:   "Set TARGET_TYPE_N=kafka to check a Kafka cluster, or list kafka in DB_TYPES to check KAFKA_BROKERS.",
+			config: types.KafkaConfig{},
+			suffix: "_13",
+		},
+		{
+			title:  "Elasticsearch target",
+			note:   "Set TARGET_TYPE_N=elasticsearch to check an Elasticsearch or OpenSearch cluster, or set ELASTICSEARCH_* without a suffix.",
+			config: types.ElasticsearchConfig{},
+			suffix: "_14",
+		},
+	}
+
+	fmt.Fprintln(w, "# db-connect-checker configuration")
+	for _, section := range sections {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "# --- %s ---\n", section.title)
+		if section.note != "" {
+			fmt.Fprintf(w, "# %s\n", section.note)
+		}
+		for _, field := range EnvFields(section.config) {
+			fmt.Fprintf(w, "\n# %s%s\n", field.Description, sampleFieldDetails(field))
+			fmt.Fprintf(w, "%s%s=%s\n", field.Env, section.suffix, field.Default)
+		}
+	}
+}
+
+func sampleFieldDetails(field EnvField) string {
+	details := []string{}
+	if field.Required {
+		details = append(details, "required")
+	}
+	if field.OneOf != nil {
+		values := make([]string, len(field.OneOf))
+		for i, value := range field.OneOf {
+			if value == "" {
+				value = `""`
+			}
+			values[i] = value
+		}
+		details = append(details, "one of: "+strings.Join(values, ", "))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(details, "; ") + ")"
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestWriteSampleEnv(t *testing.T) {
+	var buf bytes.Buffer
+	WriteSampleEnv(&buf)
+	sample := buf.String()
+
+	// Every option read from the environment must appear in the sample.
+	expected := []string{}
+	for _, field := range EnvFields(types.Settings{}) {
+		expected = append(expected, field.Env+"=")
+	}
+	for _, field := range EnvFields(types.MysqlConfig{}) {
+		expected = append(expected, field.Env+"_0=")
+	}
+	for _, field := range EnvFields(types.MongoConfig{}) {
+		expected = append(expected, field.Env+"=")
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(sample, "\n"+want) {
+			t.Errorf("WriteSampleEnv() output is missing %q", want)
+		}
+	}
+
+	if !strings.Contains(sample, "MYSQL_PORT_0=3306") {
+		t.Error("WriteSampleEnv() should include default values")
+	}
+	if !strings.Contains(sample, "(required)") {
+		t.Error("WriteSampleEnv() should mark required fields")
+	}
+}
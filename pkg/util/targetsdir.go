@@ -0,0 +1,306 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// targetSource is the raw configuration of one target found in a targets
+// directory, keyed by the same variable names as the environment (without
+// the _N suffix).
+type targetSource struct {
+	name   string
+	values map[string]string
+}
+
+// GetMysqlConfigsFromDir reads one MySQL target per entry of dir. An entry is
+// either a file in env format (MYSQL_HOST=...) or a directory with one file
+// per variable, which is how Kubernetes projects a Secret into a volume.
+// A missing dir is not an error.
+func GetMysqlConfigsFromDir(dir string) ([]types.MysqlConfig, error) {
+	configs, errs := ValidateMysqlDir(dir)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	for _, config := range configs {
+		log.Info("Discovered MySQL configuration in targets directory", log.Target(config.Target()), "user", config.User, "dir", dir)
+	}
+
+	for i := range configs {
+		if configs[i].TLS {
+			tlsConfig, err := loadTLSConfig(configs[i].TLSCAFile, defaultFileReader)
+			if err != nil {
+				return nil, err
+			}
+			configs[i].TLSConfig = tlsConfig
+		}
+	}
+	return configs, nil
+}
+
+// ValidateMysqlDir reads dir like GetMysqlConfigsFromDir, reporting every
+// problem found instead of stopping at the first one.
+func ValidateMysqlDir(dir string) ([]types.MysqlConfig, []error) {
+	sources, err := readTargetsDir(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	configs := []types.MysqlConfig{}
+	errs := []error{}
+	for _, source := range sources {
+		config, configErrs := MysqlConfigFromValues(filepath.Join(dir, source.name), source.values)
+		if len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+			continue
+		}
+		config.CredentialsFile = filepath.Join(dir, source.name)
+		configs = append(configs, config)
+	}
+	return configs, errs
+}
+
+// MysqlConfigFromValues reads a MySQL target from values keyed by the
+// variable names of the environment without the _N suffix, like an entry of
+// a targets directory. source prefixes the names in errors. The CA file is
+// checked but not loaded.
+func MysqlConfigFromValues(source string, values map[string]string) (types.MysqlConfig, []error) {
+	lookup := mapLookup(source, values)
+
+	var config types.MysqlConfig
+	if err := loadFields(&config, lookup); err != nil {
+		return config, []error{err}
+	}
+	if !config.TLS {
+		config.TLSCAFile = ""
+	}
+	defaultMysqlHost(&config)
+	return config, validateMysqlConfig(config, lookup, defaultFileReader)
+}
+
+// CheckMysqlVariables reports every key of values that is not a variable of
+// a MySQL target, e.g. a typo or a name with a line break, with source
+// prefixing the errors.
+func CheckMysqlVariables(source string, values map[string]string) []error {
+	known := map[string]bool{}
+	for _, field := range EnvFields(types.MysqlConfig{}) {
+		known[field.Env] = true
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if !known[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	errs := []error{}
+	for _, key := range keys {
+		errs = append(errs, fmt.Errorf("%s: unknown variable %q", source, key))
+	}
+	return errs
+}
+
+// ReadMysqlCredentials reads MYSQL_USER and MYSQL_PASS again from an entry
+// of a targets directory, e.g. after Kubernetes updated a projected Secret
+// or an agent of a secret manager rewrote the file.
+func ReadMysqlCredentials(path string) (types.Credential, error) {
+	// Projected Secret entries are symlinks, so stat the target.
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.Credential{}, fmt.Errorf("reading credentials %s: %v", path, err)
+	}
+	var values map[string]string
+	if info.IsDir() {
+		values, err = readKeyPerFileDir(path)
+	} else {
+		values, err = readEnvFile(path)
+	}
+	if err != nil {
+		return types.Credential{}, fmt.Errorf("reading credentials %s: %v", path, err)
+	}
+	if values["MYSQL_USER"] == "" || values["MYSQL_PASS"] == "" {
+		return types.Credential{}, fmt.Errorf("reading credentials %s: MYSQL_USER and MYSQL_PASS must be set", path)
+	}
+	return types.Credential{User: values["MYSQL_USER"], Pass: values["MYSQL_PASS"]}, nil
+}
+
+// TargetsDir stores MySQL targets as env files in a targets directory, so
+// targets added at runtime survive a restart.
+type TargetsDir string
+
+// Save writes values to an env file named after the address of the target
+// (host:port/database). A key that is not a variable name or a value that
+// cannot be written so that both readEnvFile and a shell read it back
+// unchanged is an error, and nothing is written.
+func (d TargetsDir) Save(address string, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		if !envName.MatchString(key) {
+			return fmt.Errorf("saving target %s: invalid variable name %q", address, key)
+		}
+		value, err := quoteEnvValue(values[key])
+		if err != nil {
+			return fmt.Errorf("saving target %s: %s %v", address, key, err)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+	}
+
+	path := filepath.Join(string(d), targetFileName(address))
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("saving target %s: %v", address, err)
+	}
+	return nil
+}
+
+// Delete removes every entry of the directory that configures the target at
+// address. No entry is not an error.
+func (d TargetsDir) Delete(address string) error {
+	sources, err := readTargetsDir(string(d))
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		var config types.MysqlConfig
+		loadFields(&config, mapLookup(source.name, source.values))
+		defaultMysqlHost(&config)
+		if fmt.Sprintf("%s:%s/%s", config.Host, config.Port, config.Name) != address {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(string(d), source.name)); err != nil {
+			return fmt.Errorf("deleting target %s: %v", address, err)
+		}
+	}
+	return nil
+}
+
+// envName matches the variable names Save writes, so a key cannot add
+// lines or further variables to the file.
+var envName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// quoteEnvValue quotes value for an env file. readEnvFile only strips the
+// quotes, so nothing can be escaped: single quotes keep every other
+// character literal, double quotes are used only for a value with a single
+// quote and nothing a shell would expand or unescape between double quotes.
+func quoteEnvValue(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return "", errors.New("cannot contain line breaks")
+	}
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'", nil
+	}
+	if strings.ContainsAny(value, "\"$\\`") {
+		return "", errors.New("cannot contain a single quote together with \", $, \\ or `")
+	}
+	return `"` + value + `"`, nil
+}
+
+// targetFileName turns host:port/database into a file name.
+func targetFileName(address string) string {
+	return strings.NewReplacer(":", "_", "/", "_", string(filepath.Separator), "_").Replace(address) + ".env"
+}
+
+func readTargetsDir(dir string) ([]targetSource, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading targets dir: %v", err)
+	}
+
+	sources := []targetSource{}
+	for _, entry := range entries {
+		// Kubernetes keeps projected data in hidden ..data directories.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		// Projected Secret entries are symlinks, so stat the target.
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading target %s: %v", path, err)
+		}
+
+		var values map[string]string
+		if info.IsDir() {
+			values, err = readKeyPerFileDir(path)
+		} else {
+			values, err = readEnvFile(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading target %s: %v", path, err)
+		}
+		sources = append(sources, targetSource{name: entry.Name(), values: values})
+	}
+
+	sort.Slice(sources, func(i, j int) bool { return sources[i].name < sources[j].name })
+	return sources, nil
+}
+
+func readKeyPerFileDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = strings.TrimRight(string(content), "\r\n")
+	}
+	return values, nil
+}
+
+func readEnvFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
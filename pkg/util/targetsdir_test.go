@@ -0,0 +1,241 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetMysqlConfigsFromDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, dir string)
+		wantHosts []string
+		wantErr   string
+	}{
+		{
+			name:      "missing directory returns no configs",
+			setup:     func(t *testing.T, dir string) { os.RemoveAll(dir) },
+			wantHosts: nil,
+		},
+		{
+			name: "env file per target",
+			setup: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "orders.env"), "# orders database\nMYSQL_NAME=orders\nMYSQL_USER=app\nMYSQL_PASS=\"secret\"\nexport MYSQL_HOST=orders-db\nMYSQL_PORT=3307\n")
+			},
+			wantHosts: []string{"orders-db:3307"},
+		},
+		{
+			name: "projected secret directory per target",
+			setup: func(t *testing.T, dir string) {
+				target := filepath.Join(dir, "billing")
+				writeFile(t, filepath.Join(target, "MYSQL_NAME"), "billing\n")
+				writeFile(t, filepath.Join(target, "MYSQL_USER"), "app\n")
+				writeFile(t, filepath.Join(target, "MYSQL_PASS"), "secret\n")
+				writeFile(t, filepath.Join(target, "MYSQL_HOST"), "billing-db\n")
+				writeFile(t, filepath.Join(target, "..data", "MYSQL_HOST"), "ignored\n")
+			},
+			wantHosts: []string{"billing-db:3306"},
+		},
+		{
+			name: "hidden entries are skipped",
+			setup: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "..2024_01_01"), "garbage")
+			},
+			wantHosts: nil,
+		},
+		{
+			name: "incomplete target is an error",
+			setup: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "broken.env"), "MYSQL_NAME=orders\nMYSQL_HOST=orders-db\n")
+			},
+			wantErr: "MYSQL_USER is not set",
+		},
+		{
+			name: "malformed env file is an error",
+			setup: func(t *testing.T, dir string) {
+				writeFile(t, filepath.Join(dir, "broken.env"), "MYSQL_NAME orders\n")
+			},
+			wantErr: "expected KEY=VALUE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "targets.d")
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(t, dir)
+
+			configs, err := GetMysqlConfigsFromDir(dir)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetMysqlConfigsFromDir() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMysqlConfigsFromDir() unexpected error: %v", err)
+			}
+			if len(configs) != len(tt.wantHosts) {
+				t.Fatalf("GetMysqlConfigsFromDir() returned %d configs, want %d", len(configs), len(tt.wantHosts))
+			}
+			for i, want := range tt.wantHosts {
+				if got := configs[i].Host + ":" + configs[i].Port; got != want {
+					t.Errorf("config[%d] = %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTargetsDirSaveAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "billing.env"), "MYSQL_NAME=billing\nMYSQL_USER=app\nMYSQL_PASS=secret\nMYSQL_HOST=billing-db\n")
+	store := TargetsDir(dir)
+
+	values := map[string]string{"MYSQL_NAME": "orders", "MYSQL_USER": "app", "MYSQL_PASS": `pa"ss word`, "MYSQL_HOST": "orders-db", "MYSQL_PORT": "3307"}
+	if err := store.Save("orders-db:3307/orders", values); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := GetMysqlConfigsFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 || configs[1].Host != "orders-db" || configs[1].Pass != `pa"ss word` {
+		t.Fatalf("configs after Save() = %+v, want billing and orders", configs)
+	}
+
+	// Targets are found by address, whatever the entry is called.
+	for _, address := range []string{"orders-db:3307/orders", "billing-db:3306/billing", "missing-db:3306/missing"} {
+		if err := store.Delete(address); err != nil {
+			t.Fatalf("Delete(%s) error = %v", address, err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("entries left after Delete(): %v", entries)
+	}
+}
+
+func TestTargetsDirSaveRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "plain", value: "secret"},
+		{name: "empty", value: ""},
+		{name: "spaces", value: "  pa ss  "},
+		{name: "double quote", value: `pa"ss`},
+		{name: "quoted", value: `"secret"`},
+		{name: "single quote", value: "pa'ss"},
+		{name: "dollar", value: "pa$HOME"},
+		{name: "backslash", value: `pa\ss\n`},
+		{name: "comment and equals", value: "#pa=ss"},
+		{name: "both quotes", value: `pa'ss"`, wantErr: "cannot contain a single quote"},
+		{name: "single quote and dollar", value: "pa'$HOME", wantErr: "cannot contain a single quote"},
+		{name: "single quote and backslash", value: `pa'\ss`, wantErr: "cannot contain a single quote"},
+		{name: "newline", value: "pa\nss", wantErr: "cannot contain line breaks"},
+		{name: "carriage return", value: "pass\r", wantErr: "cannot contain line breaks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			values := map[string]string{"MYSQL_NAME": "orders", "MYSQL_USER": "app", "MYSQL_PASS": tt.value, "MYSQL_HOST": "orders-db"}
+			err := TargetsDir(dir).Save("orders-db:3306/orders", values)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Save() error = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(fmt.Sprint(err), tt.value) {
+					t.Errorf("Save() error %q contains the value", err)
+				}
+				if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+					t.Errorf("entries after a failed Save(): %v", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sources, err := readTargetsDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sources) != 1 || !reflect.DeepEqual(sources[0].values, values) {
+				t.Errorf("values after Save() = %q, want %q", sources, values)
+			}
+		})
+	}
+}
+
+func TestTargetsDirSaveRejectsKeys(t *testing.T) {
+	for _, key := range []string{"MYSQL_NAME\nMYSQL_TLS", "MYSQL_PASS=x", "mysql_pass", "", "1MYSQL"} {
+		dir := t.TempDir()
+		values := map[string]string{"MYSQL_NAME": "orders", "MYSQL_HOST": "orders-db", key: "true"}
+		if err := TargetsDir(dir).Save("orders-db:3306/orders", values); err == nil || !strings.Contains(err.Error(), "invalid variable name") {
+			t.Errorf("Save() with key %q error = %v, want invalid variable name", key, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("entries after Save() with key %q: %v", key, entries)
+		}
+	}
+}
+
+func TestCheckMysqlVariables(t *testing.T) {
+	values := map[string]string{"MYSQL_NAME": "orders", "MYSQL_HOST": "orders-db", "MYSQL_PASWORD": "x", "MYSQL_NAME\nMYSQL_TLS": "true"}
+	errs := CheckMysqlVariables("request", values)
+	want := []string{`request: unknown variable "MYSQL_NAME\nMYSQL_TLS"`, `request: unknown variable "MYSQL_PASWORD"`}
+	if len(errs) != len(want) {
+		t.Fatalf("CheckMysqlVariables() = %v, want %q", errs, want)
+	}
+	for i, err := range errs {
+		if err.Error() != want[i] {
+			t.Errorf("CheckMysqlVariables()[%d] = %v, want %s", i, err, want[i])
+		}
+	}
+}
+
+func TestReadMysqlCredentials(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "orders.env"), "MYSQL_NAME=orders\nMYSQL_USER=app\nMYSQL_PASS=\"rotated\"\nMYSQL_HOST=orders-db\n")
+	writeFile(t, filepath.Join(dir, "billing", "MYSQL_USER"), "billing\n")
+	writeFile(t, filepath.Join(dir, "billing", "MYSQL_PASS"), "rotated\n")
+	writeFile(t, filepath.Join(dir, "broken", "MYSQL_USER"), "app\n")
+
+	configs, errs := ValidateMysqlDir(dir)
+	if len(errs) == 0 || len(configs) != 1 || configs[0].CredentialsFile != filepath.Join(dir, "orders.env") {
+		t.Fatalf("ValidateMysqlDir() = %+v, %v, want orders from orders.env and an error for the incomplete entries", configs, errs)
+	}
+
+	for _, name := range []string{"orders.env", "billing"} {
+		credential, err := ReadMysqlCredentials(filepath.Join(dir, name))
+		if err != nil || credential.Pass != "rotated" {
+			t.Errorf("ReadMysqlCredentials(%s) = %+v, %v, want the rotated password", name, credential, err)
+		}
+	}
+	if _, err := ReadMysqlCredentials(filepath.Join(dir, "broken")); err == nil || !strings.Contains(err.Error(), "MYSQL_USER and MYSQL_PASS must be set") {
+		t.Errorf("ReadMysqlCredentials(broken) error = %v, want missing password", err)
+	}
+	if _, err := ReadMysqlCredentials(filepath.Join(dir, "missing.env")); err == nil {
+		t.Error("ReadMysqlCredentials(missing.env) returned no error")
+	}
+}
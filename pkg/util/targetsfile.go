@@ -0,0 +1,121 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// FileTargets are the targets of a targets file.
+type FileTargets struct {
+	Mysql   []types.MysqlConfig
+	MongoDB []string
+}
+
+// GetTargetsFromFile reads a JSON or YAML list of targets from path, or from
+// stdin if path is "-", so that a script can pipe generated targets into the
+// checker. Each element is an object keyed by the variable names of the
+// environment without the _N suffix, like an entry of a targets directory:
+//
+//   - {MYSQL_HOST: orders-db, MYSQL_NAME: orders, MYSQL_USER: app, MYSQL_PASS: secret}
+//   - {MONGODB_URI: "mongodb://events-db:27017/events"}
+//
+// An element with MONGODB_URI is a MongoDB target, any other one a MySQL
+// target.
+func GetTargetsFromFile(path string, stdin io.Reader) (FileTargets, error) {
+	targets, errs := ValidateTargetsFile(path, stdin)
+	if len(errs) > 0 {
+		return FileTargets{}, errs[0]
+	}
+	for i := range targets.Mysql {
+		if targets.Mysql[i].TLS {
+			tlsConfig, err := loadTLSConfig(targets.Mysql[i].TLSCAFile, defaultFileReader)
+			if err != nil {
+				return FileTargets{}, err
+			}
+			targets.Mysql[i].TLSConfig = tlsConfig
+		}
+	}
+	return targets, nil
+}
+
+// ValidateTargetsFile reads path like GetTargetsFromFile, reporting every
+// problem found instead of stopping at the first one. The CA files are
+// checked but not loaded.
+func ValidateTargetsFile(path string, stdin io.Reader) (FileTargets, []error) {
+	name := path
+	var content []byte
+	var err error
+	if path == "-" {
+		name = "stdin"
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return FileTargets{}, []error{fmt.Errorf("reading targets from %s: %v", name, err)}
+	}
+
+	// JSON is YAML, so one parser takes both.
+	data, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return FileTargets{}, []error{fmt.Errorf("reading targets from %s: %v", name, err)}
+	}
+	var entries []map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entries); err != nil {
+		return FileTargets{}, []error{fmt.Errorf("reading targets from %s: expected a list of objects: %v", name, err)}
+	}
+
+	targets := FileTargets{Mysql: []types.MysqlConfig{}, MongoDB: []string{}}
+	errs := []error{}
+	for i, entry := range entries {
+		source := fmt.Sprintf("%s[%d]", name, i)
+		values := make(map[string]string, len(entry))
+		for key, value := range entry {
+			// YAML reads ports and flags as numbers and booleans.
+			values[key] = fmt.Sprint(value)
+		}
+
+		if uri, ok := values["MONGODB_URI"]; ok {
+			if extra := otherKeys(values, "MONGODB_URI"); len(extra) > 0 {
+				errs = append(errs, fmt.Errorf("%s: MONGODB_URI cannot be combined with %v", source, extra))
+				continue
+			}
+			if uri == "" {
+				errs = append(errs, fmt.Errorf("%s: MONGODB_URI is empty", source))
+				continue
+			}
+			targets.MongoDB = append(targets.MongoDB, uri)
+			continue
+		}
+
+		config, configErrs := MysqlConfigFromValues(source, values)
+		if len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+			continue
+		}
+		targets.Mysql = append(targets.Mysql, config)
+	}
+	return targets, errs
+}
+
+// otherKeys returns the keys of values except key, sorted.
+func otherKeys(values map[string]string, key string) []string {
+	keys := []string{}
+	for k := range values {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
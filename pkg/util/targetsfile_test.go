@@ -0,0 +1,96 @@
+package util
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetTargetsFromFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantHosts []string
+		wantMongo []string
+		wantErr   string
+	}{
+		{
+			name:      "json",
+			content:   `[{"MYSQL_HOST": "orders-db", "MYSQL_PORT": "3307", "MYSQL_NAME": "orders", "MYSQL_USER": "app", "MYSQL_PASS": "secret"}]`,
+			wantHosts: []string{"orders-db:3307/orders"},
+			wantMongo: []string{},
+		},
+		{
+			name: "yaml with numbers and booleans",
+			content: "- MYSQL_HOST: orders-db\n  MYSQL_PORT: 3307\n  MYSQL_NAME: orders\n  MYSQL_USER: app\n  MYSQL_PASS: secret\n  MYSQL_TLS: false\n" +
+				"- MONGODB_URI: mongodb://events-db:27017/events\n",
+			wantHosts: []string{"orders-db:3307/orders"},
+			wantMongo: []string{"mongodb://events-db:27017/events"},
+		},
+		{
+			name:      "empty list",
+			content:   "[]",
+			wantHosts: []string{},
+			wantMongo: []string{},
+		},
+		{
+			name:    "not a list",
+			content: "MYSQL_HOST: orders-db\n",
+			wantErr: "expected a list of objects",
+		},
+		{
+			name:    "invalid mysql target",
+			content: `[{"MYSQL_HOST": "orders-db", "MYSQL_PORT": "99999", "MYSQL_NAME": "orders", "MYSQL_USER": "app", "MYSQL_PASS": "secret"}]`,
+			wantErr: "stdin[0]: MYSQL_PORT",
+		},
+		{
+			name:    "mongodb uri with mysql variables",
+			content: `[{"MONGODB_URI": "mongodb://events-db", "MYSQL_HOST": "orders-db"}]`,
+			wantErr: "MONGODB_URI cannot be combined with [MYSQL_HOST]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := GetTargetsFromFile("-", strings.NewReader(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetTargetsFromFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts := []string{}
+			for _, config := range targets.Mysql {
+				hosts = append(hosts, mysqlTargetName(config))
+			}
+			if !reflect.DeepEqual(hosts, tt.wantHosts) {
+				t.Errorf("MySQL targets = %v, want %v", hosts, tt.wantHosts)
+			}
+			if !reflect.DeepEqual(targets.MongoDB, tt.wantMongo) {
+				t.Errorf("MongoDB targets = %v, want %v", targets.MongoDB, tt.wantMongo)
+			}
+		})
+	}
+}
+
+func TestGetTargetsFromFilePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	writeFile(t, path, "- {MYSQL_HOST: billing-db, MYSQL_NAME: billing, MYSQL_USER: app, MYSQL_PASS: secret}\n")
+
+	targets, err := GetTargetsFromFile(path, strings.NewReader("ignored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets.Mysql) != 1 || targets.Mysql[0].Host != "billing-db" {
+		t.Errorf("GetTargetsFromFile() = %+v, want billing-db", targets)
+	}
+
+	_, err = GetTargetsFromFile(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	if err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("GetTargetsFromFile() of a missing file error = %v", err)
+	}
+}
@@ -0,0 +1,549 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/tapclap/db-connect-checker/pkg/labels"
+	"github.com/tapclap/db-connect-checker/pkg/message"
+	"github.com/tapclap/db-connect-checker/pkg/mqtt"
+	"github.com/tapclap/db-connect-checker/pkg/notify"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// ValidateMysqlEnvs reads MYSQL_* environment variables the same way as
+// GetAllMysqlConfigsFromEnvs, but instead of silently skipping incomplete
+// configurations or exiting on an unreadable CA file it reports every
+// problem found. Only valid configurations are returned.
+func ValidateMysqlEnvs() ([]types.MysqlConfig, []error) {
+	configs := []types.MysqlConfig{}
+	errs := []error{}
+
+	suffixes := []string{}
+	for _, suffix := range indexedSuffixes() {
+		errs = append(errs, validateFields(types.TargetConfig{}, envLookup(suffix))...)
+		if targetType(suffix) == "mysql" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	if fieldsSet(types.MysqlConfig{}, envLookup("")) {
+		suffixes = append(suffixes, "")
+	}
+
+	for _, suffix := range suffixes {
+		config := readMysqlConfig(suffix)
+		configErrs := validateMysqlConfig(config, envLookup(suffix), defaultFileReader)
+		if len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+			continue
+		}
+		configs = append(configs, config)
+	}
+	return configs, errs
+}
+
+// ValidateMongoEnvs returns the MongoDB URIs configured like
+// GetAllMongoURIsFromEnvs, reporting every missing URI and every URI
+// rejected by validate.
+func ValidateMongoEnvs(validate func(uri string) error) ([]string, []error) {
+	uris := []string{}
+	errs := []error{}
+
+	suffixes := []string{}
+	for _, suffix := range indexedSuffixes() {
+		if targetType(suffix) == "mongodb" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	if fieldsSet(types.MongoConfig{}, envLookup("")) {
+		suffixes = append(suffixes, "")
+	}
+
+	for _, suffix := range suffixes {
+		name, uri := envLookup(suffix)("MONGODB_URI")
+		if uri == "" {
+			errs = append(errs, fmt.Errorf("%s is not set", name))
+			continue
+		}
+		if err := validate(uri); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		uris = append(uris, uri)
+	}
+	return uris, errs
+}
+
+// ValidateMockEnvs returns the mock targets configured like
+// GetAllMockConfigsFromEnvs, reporting every invalid MOCK_* variable.
+func ValidateMockEnvs() ([]types.MockConfig, []error) {
+	return validateIndexedConfigs[types.MockConfig]("mock")
+}
+
+// ValidateSnowflakeEnvs returns the Snowflake targets configured like
+// GetAllSnowflakeConfigsFromEnvs, reporting every invalid SNOWFLAKE_*
+// variable and targets without a password or private key.
+func ValidateSnowflakeEnvs() ([]types.SnowflakeConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.SnowflakeConfig]("snowflake")
+	valid := []types.SnowflakeConfig{}
+	for _, config := range configs {
+		if config.Password == "" && config.PrivateKeyFile == "" {
+			errs = append(errs, fmt.Errorf("snowflake account %s: SNOWFLAKE_PASSWORD or SNOWFLAKE_PRIVATE_KEY_FILE must be set", config.Account))
+			continue
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateBigQueryEnvs returns the BigQuery targets configured like
+// GetAllBigQueryConfigsFromEnvs, reporting every invalid BIGQUERY_* variable.
+func ValidateBigQueryEnvs() ([]types.BigQueryConfig, []error) {
+	return validateIndexedConfigs[types.BigQueryConfig]("bigquery")
+}
+
+// ValidateDynamoDBEnvs returns the DynamoDB targets configured like
+// GetAllDynamoDBConfigsFromEnvs, reporting every invalid DYNAMODB_*
+// variable, endpoints that are not URLs and canary keys rejected by
+// validateKey.
+func ValidateDynamoDBEnvs(validateKey func(key string) error) ([]types.DynamoDBConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.DynamoDBConfig]("dynamodb")
+	valid := []types.DynamoDBConfig{}
+	for _, config := range configs {
+		if endpoint, err := url.Parse(config.Endpoint); config.Endpoint != "" && (err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https")) {
+			errs = append(errs, fmt.Errorf("dynamodb table %s: DYNAMODB_ENDPOINT %q is not an http or https URL", config.Table, config.Endpoint))
+			continue
+		}
+		if config.CanaryKey != "" {
+			if err := validateKey(config.CanaryKey); err != nil {
+				errs = append(errs, fmt.Errorf("dynamodb table %s: DYNAMODB_CANARY_KEY: %v", config.Table, err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateArangoDBEnvs returns the ArangoDB targets configured like
+// GetAllArangoDBConfigsFromEnvs, reporting every invalid ARANGODB_* variable
+// and unreadable CA bundles.
+func ValidateArangoDBEnvs() ([]types.ArangoDBConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.ArangoDBConfig]("arangodb")
+	valid := []types.ArangoDBConfig{}
+	for _, config := range configs {
+		if config.TLS && config.TLSCAFile != "" {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("arangodb %s: ARANGODB_TLS_CA_FILE: %v", net.JoinHostPort(config.Host, config.Port), err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateSpannerEnvs returns the Spanner targets configured like
+// GetAllSpannerConfigsFromEnvs, reporting every invalid SPANNER_* variable.
+func ValidateSpannerEnvs() ([]types.SpannerConfig, []error) {
+	return validateIndexedConfigs[types.SpannerConfig]("spanner")
+}
+
+// ValidateFirestoreEnvs returns the Firestore targets configured like
+// GetAllFirestoreConfigsFromEnvs, reporting every invalid FIRESTORE_*
+// variable and document or collection paths rejected by validatePaths.
+func ValidateFirestoreEnvs(validatePaths func(document, collection string) error) ([]types.FirestoreConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.FirestoreConfig]("firestore")
+	valid := []types.FirestoreConfig{}
+	for _, config := range configs {
+		if err := validatePaths(config.Document, config.Collection); err != nil {
+			errs = append(errs, fmt.Errorf("firestore %s/%s: %v", config.Project, config.Database, err))
+			continue
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateTrinoEnvs returns the Trino targets configured like
+// GetAllTrinoConfigsFromEnvs, reporting every invalid TRINO_* variable and
+// unreadable CA bundles.
+func ValidateTrinoEnvs() ([]types.TrinoConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.TrinoConfig]("trino")
+	valid := []types.TrinoConfig{}
+	for _, config := range configs {
+		if config.TLS && config.TLSCAFile != "" {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("trino %s: TRINO_TLS_CA_FILE: %v", net.JoinHostPort(config.Host, config.Port), err))
+				continue
+			}
+		}
+		if config.MinWorkers < 0 {
+			errs = append(errs, fmt.Errorf("trino %s: TRINO_MIN_WORKERS must not be negative", net.JoinHostPort(config.Host, config.Port)))
+			continue
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateRedisEnvs returns the Redis targets configured like
+// GetAllRedisConfigsFromEnvs, reporting every invalid REDIS_* variable,
+// invalid addresses and unreadable CA bundles.
+func ValidateRedisEnvs() ([]types.RedisConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.RedisConfig]("redis")
+	if lookup := envLookup(""); fieldsSet(types.RedisConfig{}, lookup) {
+		if configErrs := validateFields(types.RedisConfig{}, lookup); len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+		} else {
+			var config types.RedisConfig
+			loadFields(&config, lookup)
+			configs = append(configs, config)
+		}
+	}
+
+	valid := []types.RedisConfig{}
+	for _, config := range configs {
+		if _, port, err := net.SplitHostPort(config.Addr); err == nil {
+			if err := ValidatePort(port); err != nil {
+				errs = append(errs, fmt.Errorf("redis %s: REDIS_ADDR: %v", config.Addr, err))
+				continue
+			}
+		}
+		if config.DB < 0 {
+			errs = append(errs, fmt.Errorf("redis %s: REDIS_DB must not be negative", config.Addr))
+			continue
+		}
+		if config.TLS && config.TLSCAFile != "" {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("redis %s: REDIS_TLS_CA_FILE: %v", config.Addr, err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateSMTPEnvs returns the SMTP targets configured like
+// GetAllSMTPConfigsFromEnvs, reporting every invalid SMTP_* variable,
+// passwords that would be sent without TLS and unreadable CA bundles.
+func ValidateSMTPEnvs() ([]types.SMTPConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.SMTPConfig]("smtp")
+	valid := []types.SMTPConfig{}
+	for _, config := range configs {
+		if config.User != "" && !config.TLS && !config.StartTLS {
+			errs = append(errs, fmt.Errorf("smtp %s: SMTP_USER requires SMTP_STARTTLS=true or SMTP_TLS=true", net.JoinHostPort(config.Host, config.Port)))
+			continue
+		}
+		if config.TLSCAFile != "" {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("smtp %s: SMTP_TLS_CA_FILE: %v", net.JoinHostPort(config.Host, config.Port), err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateIMAPEnvs returns the IMAP targets configured like
+// GetAllIMAPConfigsFromEnvs, reporting every invalid IMAP_* variable and
+// unreadable CA bundles.
+func ValidateIMAPEnvs() ([]types.IMAPConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.IMAPConfig]("imap")
+	valid := []types.IMAPConfig{}
+	for _, config := range configs {
+		if config.TLS && config.TLSCAFile != "" {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("imap %s: IMAP_TLS_CA_FILE: %v", net.JoinHostPort(config.Host, config.Port), err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateSFTPEnvs returns the SFTP targets configured like
+// GetAllSFTPConfigsFromEnvs, reporting every invalid SFTP_* variable,
+// targets without credentials or a host key to verify, and unreadable key
+// and known_hosts files.
+func ValidateSFTPEnvs() ([]types.SFTPConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.SFTPConfig]("sftp")
+	valid := []types.SFTPConfig{}
+	for _, config := range configs {
+		addr := net.JoinHostPort(config.Host, config.Port)
+		if config.Pass == "" && config.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("sftp %s: SFTP_PASS or SFTP_KEY_FILE is required", addr))
+			continue
+		}
+		if config.HostKeyFingerprint == "" && config.KnownHosts == "" {
+			errs = append(errs, fmt.Errorf("sftp %s: SFTP_KNOWN_HOSTS or SFTP_HOST_KEY_FINGERPRINT is required", addr))
+			continue
+		}
+		if config.HostKeyFingerprint != "" && !strings.HasPrefix(config.HostKeyFingerprint, "SHA256:") {
+			errs = append(errs, fmt.Errorf("sftp %s: SFTP_HOST_KEY_FINGERPRINT: %q is not a SHA256: fingerprint", addr, config.HostKeyFingerprint))
+			continue
+		}
+		if config.KeyFile != "" {
+			if _, err := defaultFileReader.ReadFile(config.KeyFile); err != nil {
+				errs = append(errs, fmt.Errorf("sftp %s: SFTP_KEY_FILE: %v", addr, err))
+				continue
+			}
+		}
+		if config.HostKeyFingerprint == "" {
+			if _, err := defaultFileReader.ReadFile(config.KnownHosts); err != nil {
+				errs = append(errs, fmt.Errorf("sftp %s: SFTP_KNOWN_HOSTS: %v", addr, err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateKafkaEnvs returns the Kafka targets configured like
+// GetAllKafkaConfigsFromEnvs, reporting every invalid KAFKA_* variable and
+// unreadable CA bundles.
+func ValidateKafkaEnvs(unsuffixed bool) ([]types.KafkaConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.KafkaConfig]("kafka")
+	if lookup := envLookup(""); unsuffixed && fieldsSet(types.KafkaConfig{}, lookup) {
+		if configErrs := validateFields(types.KafkaConfig{}, lookup); len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+		} else {
+			var config types.KafkaConfig
+			loadFields(&config, lookup)
+			configs = append(configs, config)
+		}
+	}
+
+	valid := []types.KafkaConfig{}
+	for _, config := range configs {
+		if config.TLS && config.TLSCAFile != "" {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("kafka %s: KAFKA_TLS_CA_FILE: %v", config.Brokers, err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// ValidateElasticsearchEnvs returns the Elasticsearch targets configured
+// like GetAllElasticsearchConfigsFromEnvs, reporting every invalid
+// ELASTICSEARCH_* variable and unreadable CA bundles of https URLs.
+func ValidateElasticsearchEnvs() ([]types.ElasticsearchConfig, []error) {
+	configs, errs := validateIndexedConfigs[types.ElasticsearchConfig]("elasticsearch")
+	if lookup := envLookup(""); fieldsSet(types.ElasticsearchConfig{}, lookup) {
+		if configErrs := validateFields(types.ElasticsearchConfig{}, lookup); len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+		} else {
+			var config types.ElasticsearchConfig
+			loadFields(&config, lookup)
+			configs = append(configs, config)
+		}
+	}
+	valid := []types.ElasticsearchConfig{}
+	for _, config := range configs {
+		if config.TLSCAFile != "" && strings.HasPrefix(config.URL, "https://") {
+			if _, err := loadTLSConfig(config.TLSCAFile, defaultFileReader); err != nil {
+				errs = append(errs, fmt.Errorf("elasticsearch %s: ELASTICSEARCH_TLS_CA_FILE: %v", config.URL, err))
+				continue
+			}
+		}
+		valid = append(valid, config)
+	}
+	return valid, errs
+}
+
+// validateIndexedConfigs validates and reads the config of every indexed
+// target of the type name, one of configTypes.
+func validateIndexedConfigs[T any](name string) ([]T, []error) {
+	configs := []T{}
+	errs := []error{}
+
+	for _, suffix := range indexedSuffixes() {
+		if targetType(suffix) != name {
+			continue
+		}
+		lookup := envLookup(suffix)
+		configErrs := validateFields(configTypes[name], lookup)
+		if len(configErrs) > 0 {
+			errs = append(errs, configErrs...)
+			continue
+		}
+		var config T
+		loadFields(&config, lookup)
+		configs = append(configs, config)
+	}
+	return configs, errs
+}
+
+// indexedSuffixes returns _0, _1, ... for as long as any variable of a
+// target with that index is set, or every such suffix up to MaxTargetIndex.
+func indexedSuffixes() []string {
+	suffixes := []string{}
+	for i := 0; MaxTargetIndex == 0 || i <= MaxTargetIndex; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		lookup := envLookup(suffix)
+		set := false
+		for _, config := range append([]interface{}{types.TargetConfig{}, types.MysqlConfig{}, types.MongoConfig{}}, configValues()...) {
+			set = set || fieldsSet(config, lookup)
+		}
+		if !set {
+			if MaxTargetIndex == 0 {
+				break
+			}
+			continue
+		}
+		suffixes = append(suffixes, suffix)
+	}
+	return suffixes
+}
+
+func validateMysqlConfig(config types.MysqlConfig, lookup lookupFunc, reader FileReader) []error {
+	// MYSQL_HOST may be left to MYSQL_HOSTS, see defaultMysqlHost.
+	errs := validateFields(config, func(key string) (string, string) {
+		name, value := lookup(key)
+		if key == "MYSQL_HOST" && value == "" {
+			value = config.Host
+		}
+		return name, value
+	})
+
+	if config.TLS {
+		if _, err := loadTLSConfig(config.TLSCAFile, reader); err != nil {
+			name, _ := lookup("MYSQL_TLS_CA_FILE")
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return errs
+}
+
+// ValidatePort checks that port is a number in the 1-65535 range.
+func ValidatePort(port string) error {
+	num, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("port %q is not a number", port)
+	}
+	if num < 1 || num > 65535 {
+		return fmt.Errorf("port %d is out of range 1-65535", num)
+	}
+	return nil
+}
+
+// ValidateSettings reads the global options like LoadSettings, but reports
+// values the checker cannot use instead of exiting.
+func ValidateSettings() (types.Settings, []error) {
+	var settings types.Settings
+	// Parse errors are reported by validateFields with more context.
+	loadFields(&settings, envLookup(""))
+	return settings, validateFields(settings, envLookup(""))
+}
+
+// validateFields checks the values of v's tagged fields against their
+// required, kind, oneof and format tags.
+func validateFields(v interface{}, lookup lookupFunc) []error {
+	errs := []error{}
+	for _, field := range EnvFields(v) {
+		name, value := lookup(field.Env)
+		if value == "" {
+			if field.Required {
+				errs = append(errs, fmt.Errorf("%s is not set", name))
+				continue
+			}
+			value = field.Default
+		}
+
+		if field.Kind == reflect.Int {
+			if _, err := strconv.Atoi(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: value %q is not a number", name, value))
+			}
+		}
+		if field.Kind == reflect.Int64 && value != "" {
+			if _, err := ParseDuration(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: value %q is not a duration", name, value))
+			}
+		}
+		if field.Kind == reflect.Float64 && value != "" {
+			if num, err := strconv.ParseFloat(value, 64); err != nil || num < 0 {
+				errs = append(errs, fmt.Errorf("%s: value %q is not a non-negative number", name, value))
+			}
+		}
+		if field.OneOf != nil && !slices.Contains(field.OneOf, value) {
+			errs = append(errs, fmt.Errorf("%s: unsupported value %q, allowed: %s", name, value, strings.Join(field.OneOf, ", ")))
+		}
+		if field.Format == "port" && value != "" {
+			if err := ValidatePort(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "url" && value != "" {
+			if parsed, err := url.Parse(value); err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				errs = append(errs, fmt.Errorf("%s: %q is not an http or https URL", name, value))
+			}
+		}
+		if field.Format == "template" && value != "" {
+			if _, err := message.Parse(field.Env, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "topic" {
+			if _, err := mqtt.ParseTopic(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "labels" && value != "" {
+			if _, err := labels.Parse(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "routes" && value != "" {
+			if _, err := notify.ParseRoutes(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "escalation" && value != "" {
+			if _, err := notify.ParseEscalation(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "variables" && value != "" {
+			if _, err := types.ParseVariables(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "hosts" && value != "" {
+			// Only the ports given in value are checked here.
+			if _, err := types.ParseHosts(value, "3306"); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "credentials" && value != "" {
+			if _, err := types.ParseCredentials(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "factors" && value != "" {
+			if _, err := retry.ParseFactors(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			}
+		}
+		if field.Format == "cron" && value != "" {
+			if _, err := cron.ParseStandard(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid cron expression %q: %v", name, value, err))
+			}
+		}
+	}
+	return errs
+}
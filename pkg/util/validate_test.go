@@ -0,0 +1,1173 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+func TestValidatePort(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    string
+		wantErr bool
+	}{
+		{name: "valid port", port: "3306", wantErr: false},
+		{name: "lowest port", port: "1", wantErr: false},
+		{name: "highest port", port: "65535", wantErr: false},
+		{name: "zero port", port: "0", wantErr: true},
+		{name: "port out of range", port: "70000", wantErr: true},
+		{name: "not a number", port: "mysql", wantErr: true},
+		{name: "empty port", port: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePort(tt.port)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePort(%q) error = %v, wantErr %v", tt.port, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMysqlEnvs(t *testing.T) {
+	validCert := generateTestCertificate(t)
+
+	oldReader := defaultFileReader
+	defer func() { defaultFileReader = oldReader }()
+
+	defaultFileReader = MockFileReader{
+		ReadFileFunc: func(filename string) ([]byte, error) {
+			if filename == "/valid/ca.pem" {
+				return validCert, nil
+			}
+			return nil, errors.New("no such file or directory")
+		},
+	}
+
+	tests := []struct {
+		name        string
+		envVars     map[string]string
+		wantConfigs int
+		wantErrs    []string
+	}{
+		{
+			name:        "no env vars",
+			envVars:     map[string]string{},
+			wantConfigs: 0,
+		},
+		{
+			name: "valid indexed and unindexed configs",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_NAME": "db", "MYSQL_USER": "user", "MYSQL_PASS": "pass", "MYSQL_HOST": "host",
+			},
+			wantConfigs: 2,
+		},
+		{
+			name: "reports missing fields of incomplete index",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_HOST_0": "host0",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_USER_0 is not set", "MYSQL_PASS_0 is not set"},
+		},
+		{
+			name: "reports bad port",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0", "MYSQL_PORT_0": "99999",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_PORT_0"},
+		},
+		{
+			name: "reports bad cron schedule",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_CHECK_SCHEDULE_0": "every five minutes",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_CHECK_SCHEDULE_0"},
+		},
+		{
+			name: "endpoints name the target without MYSQL_HOST",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOSTS_0": "db1, db2:3307",
+			},
+			wantConfigs: 1,
+		},
+		{
+			name: "reports bad endpoint",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOSTS_0": "db1,db2:99999",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_HOSTS_0: endpoint \"db2:99999\" has an invalid port"},
+		},
+		{
+			name: "accepts cron schedule",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_CHECK_SCHEDULE_0": "*/5 9-18 * * 1-5",
+			},
+			wantConfigs: 1,
+		},
+		{
+			name: "reports CDC connector that is not a URL",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_CDC_CONNECTOR_0": "connect:8083/connectors/inventory",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_CDC_CONNECTOR_0"},
+		},
+		{
+			name: "reports bad expected variables",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_EXPECT_VARIABLES_0": "sql_mode=STRICT_TRANS_TABLES;@@time_zone=+00:00",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_EXPECT_VARIABLES_0", "invalid variable name"},
+		},
+		{
+			name: "accepts expected variables",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_EXPECT_VARIABLES_0":           "sql_mode=STRICT_TRANS_TABLES,NO_ZERO_DATE; max_allowed_packet=67108864",
+				"MYSQL_FAIL_ON_VARIABLES_MISMATCH_0": "true",
+			},
+			wantConfigs: 1,
+		},
+		{
+			name: "reports unknown binlog requirement",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_REQUIRE_BINLOG_0": "debezium",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_REQUIRE_BINLOG_0"},
+		},
+		{
+			name: "reports extra user without password",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_EXTRA_USERS_0": "migrator:${MIGRATOR_PASS_UNSET}",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_EXTRA_USERS_0: password of migrator is empty"},
+		},
+		{
+			name: "accepts extra users",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_EXTRA_USERS_0": "migrator:m1,readonly:r1",
+			},
+			wantConfigs: 1,
+		},
+		{
+			name: "reports unreadable CA file",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_TLS_0": "true", "MYSQL_TLS_CA_FILE_0": "/missing/ca.pem",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"MYSQL_TLS_CA_FILE_0"},
+		},
+		{
+			name: "accepts readable CA file",
+			envVars: map[string]string{
+				"MYSQL_NAME_0": "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+				"MYSQL_TLS_0": "true", "MYSQL_TLS_CA_FILE_0": "/valid/ca.pem",
+			},
+			wantConfigs: 1,
+		},
+		{
+			name: "skips mongodb index",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mongodb",
+				"MYSQL_NAME_1":  "db1", "MYSQL_USER_1": "user", "MYSQL_PASS_1": "pass", "MYSQL_HOST_1": "host1",
+			},
+			wantConfigs: 1,
+		},
+		{
+			name: "reports unsupported target type",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "postgres",
+				"MYSQL_NAME_0":  "db0", "MYSQL_USER_0": "user", "MYSQL_PASS_0": "pass", "MYSQL_HOST_0": "host0",
+			},
+			wantConfigs: 0,
+			wantErrs:    []string{"TARGET_TYPE_0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, suffix := range []string{"", "_0", "_1"} {
+				for _, field := range EnvFields(types.MysqlConfig{}) {
+					os.Unsetenv(field.Env + suffix)
+				}
+				os.Unsetenv("TARGET_TYPE" + suffix)
+			}
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			configs, errs := ValidateMysqlEnvs()
+
+			if len(configs) != tt.wantConfigs {
+				t.Errorf("ValidateMysqlEnvs() returned %d configs, want %d", len(configs), tt.wantConfigs)
+			}
+			if len(tt.wantErrs) == 0 && len(errs) > 0 {
+				t.Errorf("ValidateMysqlEnvs() unexpected errors: %v", errs)
+			}
+			for _, want := range tt.wantErrs {
+				found := false
+				for _, err := range errs {
+					if strings.Contains(err.Error(), want) {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("ValidateMysqlEnvs() errors = %v, want error containing %q", errs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateMongoEnvs(t *testing.T) {
+	rejectBad := func(uri string) error {
+		if strings.Contains(uri, "bad") {
+			return errors.New("invalid uri")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		wantURIs int
+		wantErrs []string
+	}{
+		{
+			name:     "no env vars",
+			envVars:  map[string]string{},
+			wantURIs: 0,
+		},
+		{
+			name: "indexed and unindexed uris",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mongodb", "MONGODB_URI_0": "mongodb://host0/db",
+				"MONGODB_URI": "mongodb://host/db",
+			},
+			wantURIs: 2,
+		},
+		{
+			name: "uris without target type",
+			envVars: map[string]string{
+				"MONGODB_URI_0": "mongodb://host0/db",
+				"MONGODB_URI_1": "mongodb://host1/db",
+			},
+			wantURIs: 2,
+		},
+		{
+			name: "ignores uri of mysql index",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mysql", "MONGODB_URI_0": "mongodb://host0/db",
+			},
+			wantURIs: 0,
+		},
+		{
+			name: "reports missing uri",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mongodb",
+			},
+			wantURIs: 0,
+			wantErrs: []string{"MONGODB_URI_0 is not set"},
+		},
+		{
+			name: "reports rejected uri",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mongodb", "MONGODB_URI_0": "mongodb://bad/db",
+			},
+			wantURIs: 0,
+			wantErrs: []string{"MONGODB_URI_0: invalid uri"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, suffix := range []string{"", "_0", "_1"} {
+				for _, key := range []string{"TARGET_TYPE", "MONGODB_URI", "MYSQL_NAME", "MYSQL_HOST"} {
+					os.Unsetenv(key + suffix)
+				}
+			}
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			uris, errs := ValidateMongoEnvs(rejectBad)
+
+			if len(uris) != tt.wantURIs {
+				t.Errorf("ValidateMongoEnvs() returned %d uris, want %d", len(uris), tt.wantURIs)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateMongoEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateMongoEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateMockEnvs(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantNames []string
+		wantErrs  []string
+	}{
+		{
+			name:    "no env vars",
+			envVars: map[string]string{},
+		},
+		{
+			name: "mock with defaults",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mock", "MOCK_NAME_0": "smoke",
+			},
+			wantNames: []string{"smoke"},
+		},
+		{
+			name: "reports missing name",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mock", "MOCK_RESULT_0": "failure",
+			},
+			wantErrs: []string{"MOCK_NAME_0 is not set"},
+		},
+		{
+			name: "reports invalid result and delay",
+			envVars: map[string]string{
+				"TARGET_TYPE_0": "mock", "MOCK_NAME_0": "smoke", "MOCK_RESULT_0": "maybe", "MOCK_DELAY_0": "soon",
+			},
+			wantErrs: []string{
+				`MOCK_RESULT_0: unsupported value "maybe", allowed: success, failure, flap`,
+				`MOCK_DELAY_0: value "soon" is not a duration`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TARGET_TYPE_0", "MOCK_NAME_0", "MOCK_RESULT_0", "MOCK_DELAY_0"} {
+				os.Unsetenv(key)
+			}
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			configs, errs := ValidateMockEnvs()
+
+			names := []string{}
+			for _, config := range configs {
+				names = append(names, config.Name)
+			}
+			if len(names) != len(tt.wantNames) || (len(names) > 0 && !reflect.DeepEqual(names, tt.wantNames)) {
+				t.Errorf("ValidateMockEnvs() returned %v, want %v", names, tt.wantNames)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateMockEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateMockEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSnowflakeEnvs(t *testing.T) {
+	tests := []struct {
+		name         string
+		envVars      map[string]string
+		wantAccounts []string
+		wantErrs     []string
+	}{
+		{
+			name:         "password",
+			envVars:      map[string]string{"SNOWFLAKE_USER_0": "etl", "SNOWFLAKE_PASSWORD_0": "secret"},
+			wantAccounts: []string{"xy12345"},
+		},
+		{
+			name:         "key pair",
+			envVars:      map[string]string{"SNOWFLAKE_USER_0": "etl", "SNOWFLAKE_PRIVATE_KEY_FILE_0": "/keys/etl.p8"},
+			wantAccounts: []string{"xy12345"},
+		},
+		{
+			name:     "reports missing user",
+			envVars:  map[string]string{"SNOWFLAKE_PASSWORD_0": "secret"},
+			wantErrs: []string{"SNOWFLAKE_USER_0 is not set"},
+		},
+		{
+			name:     "reports missing credentials",
+			envVars:  map[string]string{"SNOWFLAKE_USER_0": "etl"},
+			wantErrs: []string{"snowflake account xy12345: SNOWFLAKE_PASSWORD or SNOWFLAKE_PRIVATE_KEY_FILE must be set"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"SNOWFLAKE_USER_0", "SNOWFLAKE_PASSWORD_0", "SNOWFLAKE_PRIVATE_KEY_FILE_0"} {
+				os.Unsetenv(key)
+			}
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "snowflake")
+			defer os.Unsetenv("TARGET_TYPE_0")
+			os.Setenv("SNOWFLAKE_ACCOUNT_0", "xy12345")
+			defer os.Unsetenv("SNOWFLAKE_ACCOUNT_0")
+
+			configs, errs := ValidateSnowflakeEnvs()
+
+			accounts := []string{}
+			for _, config := range configs {
+				accounts = append(accounts, config.Account)
+			}
+			if len(accounts) != len(tt.wantAccounts) || (len(accounts) > 0 && !reflect.DeepEqual(accounts, tt.wantAccounts)) {
+				t.Errorf("ValidateSnowflakeEnvs() returned %v, want %v", accounts, tt.wantAccounts)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateSnowflakeEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateSnowflakeEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateBigQueryEnvs(t *testing.T) {
+	tests := []struct {
+		name         string
+		envVars      map[string]string
+		wantDatasets []string
+		wantErrs     []string
+	}{
+		{
+			name:         "application default credentials",
+			envVars:      map[string]string{"BIGQUERY_PROJECT_0": "app-prod", "BIGQUERY_DATASET_0": "analytics"},
+			wantDatasets: []string{"analytics"},
+		},
+		{
+			name:         "credentials file",
+			envVars:      map[string]string{"BIGQUERY_PROJECT_0": "app-prod", "BIGQUERY_DATASET_0": "analytics", "BIGQUERY_CREDENTIALS_FILE_0": "/keys/checker.json"},
+			wantDatasets: []string{"analytics"},
+		},
+		{
+			name:     "reports missing dataset",
+			envVars:  map[string]string{"BIGQUERY_PROJECT_0": "app-prod"},
+			wantErrs: []string{"BIGQUERY_DATASET_0 is not set"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "bigquery")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateBigQueryEnvs()
+
+			datasets := []string{}
+			for _, config := range configs {
+				datasets = append(datasets, config.Dataset)
+			}
+			if len(datasets) != len(tt.wantDatasets) || (len(datasets) > 0 && !reflect.DeepEqual(datasets, tt.wantDatasets)) {
+				t.Errorf("ValidateBigQueryEnvs() returned %v, want %v", datasets, tt.wantDatasets)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateBigQueryEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateBigQueryEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateDynamoDBEnvs(t *testing.T) {
+	validateKey := func(key string) error {
+		if !strings.HasPrefix(key, "{") {
+			return errors.New("not a key")
+		}
+		return nil
+	}
+	tests := []struct {
+		name       string
+		envVars    map[string]string
+		wantTables []string
+		wantErrs   []string
+	}{
+		{
+			name:       "table",
+			envVars:    map[string]string{"DYNAMODB_TABLE_0": "orders"},
+			wantTables: []string{"orders"},
+		},
+		{
+			name:       "local endpoint and canary key",
+			envVars:    map[string]string{"DYNAMODB_TABLE_0": "orders", "DYNAMODB_ENDPOINT_0": "http://localhost:8000", "DYNAMODB_CANARY_KEY_0": `{"pk":{"S":"canary"}}`},
+			wantTables: []string{"orders"},
+		},
+		{
+			name:     "reports missing table",
+			envVars:  map[string]string{},
+			wantErrs: []string{"DYNAMODB_TABLE_0 is not set"},
+		},
+		{
+			name:     "reports invalid endpoint",
+			envVars:  map[string]string{"DYNAMODB_TABLE_0": "orders", "DYNAMODB_ENDPOINT_0": "localhost:8000"},
+			wantErrs: []string{`dynamodb table orders: DYNAMODB_ENDPOINT "localhost:8000" is not an http or https URL`},
+		},
+		{
+			name:     "reports invalid canary key",
+			envVars:  map[string]string{"DYNAMODB_TABLE_0": "orders", "DYNAMODB_CANARY_KEY_0": "canary"},
+			wantErrs: []string{"dynamodb table orders: DYNAMODB_CANARY_KEY: not a key"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "dynamodb")
+			defer os.Unsetenv("TARGET_TYPE_0")
+			os.Setenv("DYNAMODB_REGION_0", "eu-west-1")
+			defer os.Unsetenv("DYNAMODB_REGION_0")
+
+			configs, errs := ValidateDynamoDBEnvs(validateKey)
+
+			tables := []string{}
+			for _, config := range configs {
+				tables = append(tables, config.Table)
+			}
+			if len(tables) != len(tt.wantTables) || (len(tables) > 0 && !reflect.DeepEqual(tables, tt.wantTables)) {
+				t.Errorf("ValidateDynamoDBEnvs() returned %v, want %v", tables, tt.wantTables)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateDynamoDBEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateDynamoDBEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateArangoDBEnvs(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantHosts []string
+		wantErrs  []string
+	}{
+		{
+			name:      "defaults",
+			envVars:   map[string]string{"ARANGODB_HOST_0": "arangodb"},
+			wantHosts: []string{"arangodb"},
+		},
+		{
+			name:     "reports invalid port",
+			envVars:  map[string]string{"ARANGODB_HOST_0": "arangodb", "ARANGODB_PORT_0": "http"},
+			wantErrs: []string{`ARANGODB_PORT_0: port "http" is not a number`},
+		},
+		{
+			name:     "reports missing CA file",
+			envVars:  map[string]string{"ARANGODB_HOST_0": "arangodb", "ARANGODB_TLS_0": "true", "ARANGODB_TLS_CA_FILE_0": "/nonexistent/ca.pem"},
+			wantErrs: []string{"arangodb arangodb:8529: ARANGODB_TLS_CA_FILE: reading CA file: open /nonexistent/ca.pem: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "arangodb")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateArangoDBEnvs()
+
+			hosts := []string{}
+			for _, config := range configs {
+				hosts = append(hosts, config.Host)
+			}
+			if len(hosts) != len(tt.wantHosts) || (len(hosts) > 0 && !reflect.DeepEqual(hosts, tt.wantHosts)) {
+				t.Errorf("ValidateArangoDBEnvs() returned %v, want %v", hosts, tt.wantHosts)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateArangoDBEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateArangoDBEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSpannerEnvs(t *testing.T) {
+	tests := []struct {
+		name          string
+		envVars       map[string]string
+		wantDatabases []string
+		wantErrs      []string
+	}{
+		{
+			name:          "application default credentials",
+			envVars:       map[string]string{"SPANNER_PROJECT_0": "app-prod", "SPANNER_INSTANCE_0": "main", "SPANNER_DATABASE_0": "orders"},
+			wantDatabases: []string{"orders"},
+		},
+		{
+			name:     "reports missing instance and database",
+			envVars:  map[string]string{"SPANNER_PROJECT_0": "app-prod"},
+			wantErrs: []string{"SPANNER_INSTANCE_0 is not set", "SPANNER_DATABASE_0 is not set"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "spanner")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateSpannerEnvs()
+
+			databases := []string{}
+			for _, config := range configs {
+				databases = append(databases, config.Database)
+			}
+			if len(databases) != len(tt.wantDatabases) || (len(databases) > 0 && !reflect.DeepEqual(databases, tt.wantDatabases)) {
+				t.Errorf("ValidateSpannerEnvs() returned %v, want %v", databases, tt.wantDatabases)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateSpannerEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateSpannerEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFirestoreEnvs(t *testing.T) {
+	validatePaths := func(document, collection string) error {
+		if document == "" && collection == "" {
+			return errors.New("a canary document or a collection is required")
+		}
+		return nil
+	}
+	tests := []struct {
+		name          string
+		envVars       map[string]string
+		wantDocuments []string
+		wantErrs      []string
+	}{
+		{
+			name:          "canary document",
+			envVars:       map[string]string{"FIRESTORE_PROJECT_0": "app-prod", "FIRESTORE_DOCUMENT_0": "health/canary"},
+			wantDocuments: []string{"health/canary"},
+		},
+		{
+			name:     "reports missing document and collection",
+			envVars:  map[string]string{"FIRESTORE_PROJECT_0": "app-prod"},
+			wantErrs: []string{"firestore app-prod/(default): a canary document or a collection is required"},
+		},
+		{
+			name:     "reports missing project",
+			envVars:  map[string]string{"FIRESTORE_COLLECTION_0": "users"},
+			wantErrs: []string{"FIRESTORE_PROJECT_0 is not set"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "firestore")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateFirestoreEnvs(validatePaths)
+
+			documents := []string{}
+			for _, config := range configs {
+				documents = append(documents, config.Document)
+			}
+			if len(documents) != len(tt.wantDocuments) || (len(documents) > 0 && !reflect.DeepEqual(documents, tt.wantDocuments)) {
+				t.Errorf("ValidateFirestoreEnvs() returned %v, want %v", documents, tt.wantDocuments)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateFirestoreEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateFirestoreEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTrinoEnvs(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantHosts []string
+		wantErrs  []string
+	}{
+		{
+			name:      "defaults",
+			envVars:   map[string]string{"TRINO_HOST_0": "trino"},
+			wantHosts: []string{"trino"},
+		},
+		{
+			name:     "reports invalid worker count",
+			envVars:  map[string]string{"TRINO_HOST_0": "trino", "TRINO_MIN_WORKERS_0": "-1"},
+			wantErrs: []string{"trino trino:8080: TRINO_MIN_WORKERS must not be negative"},
+		},
+		{
+			name:     "reports missing CA file",
+			envVars:  map[string]string{"TRINO_HOST_0": "trino", "TRINO_TLS_0": "true", "TRINO_TLS_CA_FILE_0": "/nonexistent/ca.pem"},
+			wantErrs: []string{"trino trino:8080: TRINO_TLS_CA_FILE: reading CA file: open /nonexistent/ca.pem: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "trino")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateTrinoEnvs()
+
+			hosts := []string{}
+			for _, config := range configs {
+				hosts = append(hosts, config.Host)
+			}
+			if len(hosts) != len(tt.wantHosts) || (len(hosts) > 0 && !reflect.DeepEqual(hosts, tt.wantHosts)) {
+				t.Errorf("ValidateTrinoEnvs() returned %v, want %v", hosts, tt.wantHosts)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateTrinoEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateTrinoEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRedisEnvs(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantAddrs []string
+		wantErrs  []string
+	}{
+		{
+			name:      "indexed and unindexed",
+			envVars:   map[string]string{"TARGET_TYPE_0": "redis", "REDIS_ADDR_0": "cache:6380", "REDIS_ADDR": "sessions"},
+			wantAddrs: []string{"cache:6380", "sessions"},
+		},
+		{
+			name:     "reports missing address",
+			envVars:  map[string]string{"REDIS_PASSWORD": "secret"},
+			wantErrs: []string{"REDIS_ADDR is not set"},
+		},
+		{
+			name:     "reports bad port",
+			envVars:  map[string]string{"TARGET_TYPE_0": "redis", "REDIS_ADDR_0": "cache:99999"},
+			wantErrs: []string{"redis cache:99999: REDIS_ADDR: port 99999 is out of range 1-65535"},
+		},
+		{
+			name:     "reports negative database",
+			envVars:  map[string]string{"REDIS_ADDR": "cache", "REDIS_DB": "-1"},
+			wantErrs: []string{"redis cache: REDIS_DB must not be negative"},
+		},
+		{
+			name:     "reports missing CA file",
+			envVars:  map[string]string{"REDIS_ADDR": "cache", "REDIS_TLS": "true", "REDIS_TLS_CA_FILE": "/nonexistent/ca.pem"},
+			wantErrs: []string{"redis cache: REDIS_TLS_CA_FILE: reading CA file: open /nonexistent/ca.pem: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			configs, errs := ValidateRedisEnvs()
+
+			addrs := []string{}
+			for _, config := range configs {
+				addrs = append(addrs, config.Addr)
+			}
+			if len(addrs) != len(tt.wantAddrs) || (len(addrs) > 0 && !reflect.DeepEqual(addrs, tt.wantAddrs)) {
+				t.Errorf("ValidateRedisEnvs() returned %v, want %v", addrs, tt.wantAddrs)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateRedisEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateRedisEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateElasticsearchEnvs(t *testing.T) {
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		wantURLs []string
+		wantErrs []string
+	}{
+		{
+			name:     "indexed and unindexed",
+			envVars:  map[string]string{"TARGET_TYPE_0": "elasticsearch", "ELASTICSEARCH_URL_0": "https://logs.internal:9200", "ELASTICSEARCH_URL": "http://search:9200"},
+			wantURLs: []string{"https://logs.internal:9200", "http://search:9200"},
+		},
+		{
+			name:     "reports missing URL",
+			envVars:  map[string]string{"ELASTICSEARCH_USER": "monitoring"},
+			wantErrs: []string{"ELASTICSEARCH_URL is not set"},
+		},
+		{
+			name:     "reports missing CA file",
+			envVars:  map[string]string{"ELASTICSEARCH_URL": "https://search:9200", "ELASTICSEARCH_TLS_CA_FILE": "/nonexistent/ca.pem"},
+			wantErrs: []string{"elasticsearch https://search:9200: ELASTICSEARCH_TLS_CA_FILE: reading CA file: open /nonexistent/ca.pem: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			configs, errs := ValidateElasticsearchEnvs()
+
+			urls := []string{}
+			for _, config := range configs {
+				urls = append(urls, config.URL)
+			}
+			if len(urls) != len(tt.wantURLs) || (len(urls) > 0 && !reflect.DeepEqual(urls, tt.wantURLs)) {
+				t.Errorf("ValidateElasticsearchEnvs() returned %v, want %v", urls, tt.wantURLs)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateElasticsearchEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateElasticsearchEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSMTPEnvs(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantHosts []string
+		wantErrs  []string
+	}{
+		{
+			name:      "defaults",
+			envVars:   map[string]string{"SMTP_HOST_0": "mx"},
+			wantHosts: []string{"mx"},
+		},
+		{
+			name:     "reports password without TLS",
+			envVars:  map[string]string{"SMTP_HOST_0": "mx", "SMTP_USER_0": "app", "SMTP_PASS_0": "secret", "SMTP_STARTTLS_0": "false"},
+			wantErrs: []string{"smtp mx:25: SMTP_USER requires SMTP_STARTTLS=true or SMTP_TLS=true"},
+		},
+		{
+			name:     "reports missing CA file",
+			envVars:  map[string]string{"SMTP_HOST_0": "mx", "SMTP_TLS_CA_FILE_0": "/nonexistent/ca.pem"},
+			wantErrs: []string{"smtp mx:25: SMTP_TLS_CA_FILE: reading CA file: open /nonexistent/ca.pem: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "smtp")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateSMTPEnvs()
+
+			hosts := []string{}
+			for _, config := range configs {
+				hosts = append(hosts, config.Host)
+			}
+			if len(hosts) != len(tt.wantHosts) || (len(hosts) > 0 && !reflect.DeepEqual(hosts, tt.wantHosts)) {
+				t.Errorf("ValidateSMTPEnvs() returned %v, want %v", hosts, tt.wantHosts)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateSMTPEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateSMTPEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateIMAPEnvs(t *testing.T) {
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantHosts []string
+		wantErrs  []string
+	}{
+		{
+			name:      "defaults",
+			envVars:   map[string]string{"IMAP_HOST_0": "imap", "IMAP_USER_0": "orders", "IMAP_PASS_0": "secret"},
+			wantHosts: []string{"imap"},
+		},
+		{
+			name:     "reports missing password",
+			envVars:  map[string]string{"IMAP_HOST_0": "imap", "IMAP_USER_0": "orders"},
+			wantErrs: []string{"IMAP_PASS_0 is not set"},
+		},
+		{
+			name:     "reports missing CA file",
+			envVars:  map[string]string{"IMAP_HOST_0": "imap", "IMAP_USER_0": "orders", "IMAP_PASS_0": "secret", "IMAP_TLS_CA_FILE_0": "/nonexistent/ca.pem"},
+			wantErrs: []string{"imap imap:993: IMAP_TLS_CA_FILE: reading CA file: open /nonexistent/ca.pem: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "imap")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateIMAPEnvs()
+
+			hosts := []string{}
+			for _, config := range configs {
+				hosts = append(hosts, config.Host)
+			}
+			if len(hosts) != len(tt.wantHosts) || (len(hosts) > 0 && !reflect.DeepEqual(hosts, tt.wantHosts)) {
+				t.Errorf("ValidateIMAPEnvs() returned %v, want %v", hosts, tt.wantHosts)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateIMAPEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateIMAPEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSFTPEnvs(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		envVars   map[string]string
+		wantHosts []string
+		wantErrs  []string
+	}{
+		{
+			name:      "password and fingerprint",
+			envVars:   map[string]string{"SFTP_HOST_0": "files", "SFTP_USER_0": "ingest", "SFTP_PASS_0": "secret", "SFTP_HOST_KEY_FINGERPRINT_0": "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"},
+			wantHosts: []string{"files"},
+		},
+		{
+			name:      "key file and known hosts",
+			envVars:   map[string]string{"SFTP_HOST_0": "files", "SFTP_USER_0": "ingest", "SFTP_KEY_FILE_0": keyFile, "SFTP_KNOWN_HOSTS_0": keyFile},
+			wantHosts: []string{"files"},
+		},
+		{
+			name:     "reports missing credentials",
+			envVars:  map[string]string{"SFTP_HOST_0": "files", "SFTP_USER_0": "ingest", "SFTP_KNOWN_HOSTS_0": keyFile},
+			wantErrs: []string{"sftp files:22: SFTP_PASS or SFTP_KEY_FILE is required"},
+		},
+		{
+			name:     "reports missing host key",
+			envVars:  map[string]string{"SFTP_HOST_0": "files", "SFTP_USER_0": "ingest", "SFTP_PASS_0": "secret"},
+			wantErrs: []string{"sftp files:22: SFTP_KNOWN_HOSTS or SFTP_HOST_KEY_FINGERPRINT is required"},
+		},
+		{
+			name:     "reports fingerprint that is not SHA256",
+			envVars:  map[string]string{"SFTP_HOST_0": "files", "SFTP_USER_0": "ingest", "SFTP_PASS_0": "secret", "SFTP_HOST_KEY_FINGERPRINT_0": "16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48"},
+			wantErrs: []string{`sftp files:22: SFTP_HOST_KEY_FINGERPRINT: "16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48" is not a SHA256: fingerprint`},
+		},
+		{
+			name:     "reports missing known hosts file",
+			envVars:  map[string]string{"SFTP_HOST_0": "files", "SFTP_USER_0": "ingest", "SFTP_PASS_0": "secret", "SFTP_KNOWN_HOSTS_0": "/nonexistent/known_hosts"},
+			wantErrs: []string{"sftp files:22: SFTP_KNOWN_HOSTS: open /nonexistent/known_hosts: no such file or directory"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.envVars {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+			os.Setenv("TARGET_TYPE_0", "sftp")
+			defer os.Unsetenv("TARGET_TYPE_0")
+
+			configs, errs := ValidateSFTPEnvs()
+
+			hosts := []string{}
+			for _, config := range configs {
+				hosts = append(hosts, config.Host)
+			}
+			if len(hosts) != len(tt.wantHosts) || (len(hosts) > 0 && !reflect.DeepEqual(hosts, tt.wantHosts)) {
+				t.Errorf("ValidateSFTPEnvs() returned %v, want %v", hosts, tt.wantHosts)
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("ValidateSFTPEnvs() errors = %v, want %v", errs, tt.wantErrs)
+			}
+			for i, want := range tt.wantErrs {
+				if errs[i].Error() != want {
+					t.Errorf("ValidateSFTPEnvs() error = %q, want %q", errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSettingsTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		envVars map[string]string
+		wantErr string
+	}{
+		{name: "no templates", envVars: map[string]string{}},
+		{name: "valid templates", envVars: map[string]string{"LOG_TEMPLATE": "{{.Target}} {{.Attempt}}", "NOTIFY_TEMPLATE": "{{.Target}}: {{.Reason}}"}},
+		{name: "syntax error", envVars: map[string]string{"LOG_TEMPLATE": "{{.Target"}, wantErr: "LOG_TEMPLATE"},
+		{name: "unknown field", envVars: map[string]string{"NOTIFY_TEMPLATE": "{{.Host}}"}, wantErr: "NOTIFY_TEMPLATE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_TEMPLATE", "")
+			t.Setenv("NOTIFY_TEMPLATE", "")
+			for key, value := range tt.envVars {
+				t.Setenv(key, value)
+			}
+
+			_, errs := ValidateSettings()
+			var got []string
+			for _, err := range errs {
+				if strings.Contains(err.Error(), "TEMPLATE") {
+					got = append(got, err.Error())
+				}
+			}
+			if tt.wantErr == "" && len(got) > 0 {
+				t.Errorf("ValidateSettings() unexpected errors: %v", got)
+			}
+			if tt.wantErr != "" && (len(got) != 1 || !strings.HasPrefix(got[0], tt.wantErr)) {
+				t.Errorf("ValidateSettings() errors = %v, want one error about %s", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSettingsOwnerLabels(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "shop")
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "not set", value: ""},
+		{name: "valid", value: "team=payments,namespace=${POD_NAMESPACE}"},
+		{name: "invalid name", value: "team-name=payments", wantErr: true},
+		{name: "missing file", value: "node=file:/nonexistent/nodename", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OWNER_LABELS", tt.value)
+
+			_, errs := ValidateSettings()
+			var got []string
+			for _, err := range errs {
+				if strings.HasPrefix(err.Error(), "OWNER_LABELS") {
+					got = append(got, err.Error())
+				}
+			}
+			if (len(got) > 0) != tt.wantErr {
+				t.Errorf("ValidateSettings() errors = %v, want error %v", got, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Values are injected at build time via ldflags:
+//
+//	go build -ldflags "-X github.com/tapclap/db-connect-checker/pkg/version.Version=v1.2.3 \
+//	  -X github.com/tapclap/db-connect-checker/pkg/version.Commit=abcdef0 \
+//	  -X github.com/tapclap/db-connect-checker/pkg/version.Date=2024-01-01T00:00:00Z"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+func String() string {
+	return fmt.Sprintf("db-connect-checker %s (commit %s, built %s, %s)", Version, Commit, Date, runtime.Version())
+}
@@ -0,0 +1,25 @@
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	oldVersion, oldCommit, oldDate := Version, Commit, Date
+	defer func() {
+		Version, Commit, Date = oldVersion, oldCommit, oldDate
+	}()
+
+	Version = "v1.2.3"
+	Commit = "abcdef0"
+	Date = "2024-01-01T00:00:00Z"
+
+	got := String()
+	for _, want := range []string{"v1.2.3", "abcdef0", "2024-01-01T00:00:00Z", runtime.Version()} {
+		if !strings.Contains(got, want) {
+			t.Errorf("String() = %q, want it to contain %q", got, want)
+		}
+	}
+}
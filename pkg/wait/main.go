@@ -0,0 +1,259 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+)
+
+// Target is a single dependency to wait for.
+type Target struct {
+	Name string
+	// Group joins equivalent targets (e.g. replicas of one database). It is
+	// only used when Options.Any is set.
+	Group string
+	// Check performs one connection attempt.
+	Check func() error
+	// Reason returns a short class of a Check error for progress logs.
+	Reason func(error) string
+	// Retryable reports whether another attempt may fix a Check error. A
+	// target with a non-retryable error is not retried; nil retries all errors.
+	Retryable func(error) bool
+	// Log adds fields identifying the target to its log records, e.g.
+	// log.Target; they always have the target's Name.
+	Log slog.Attr
+}
+
+type Options struct {
+	// Budget is the total time allowed for all targets to become available,
+	// zero waits until ctx is done.
+	Budget time.Duration
+	// ProgressInterval is how often a summary of still failing targets is logged.
+	ProgressInterval time.Duration
+	Backoff          retry.Backoff
+	// Any makes a group satisfied as soon as one of its targets is available.
+	Any bool
+	// Clock measures the budget and the sleeps, clock.Real if nil.
+	Clock clock.Clock
+}
+
+// ForAll retries every target concurrently until all of them succeed (or,
+// with Options.Any, at least one target of every group) or the time budget
+// is exhausted, periodically logging which targets are still failing and why.
+// It gives up early with a retry.Permanent error when a target fails with a
+// non-retryable error, and with a retry.ErrBudgetExhausted error as soon as
+// no failing target has time left for another attempt before the budget or
+// the deadline of ctx runs out.
+func ForAll(ctx context.Context, targets []Target, opts Options) error {
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.Real
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var budget <-chan time.Time
+	if opts.Budget > 0 {
+		budget = clk.After(opts.Budget)
+	}
+
+	start := clk.Now()
+	var mu sync.Mutex
+	failing := make(map[string]string, len(targets))
+	for _, target := range targets {
+		failing[target.Name] = "not checked yet"
+	}
+
+	groupCtx := make(map[string]context.Context)
+	groupCancel := make(map[string]context.CancelFunc)
+	for _, target := range targets {
+		if _, ok := groupCtx[target.Group]; !ok {
+			groupCtx[target.Group], groupCancel[target.Group] = context.WithCancel(ctx)
+			defer groupCancel[target.Group]()
+		}
+	}
+
+	available := make(chan struct{})
+	var availableOnce sync.Once
+	if len(targets) == 0 {
+		close(available)
+	}
+
+	// A group fails for good once all its targets (or, without Options.Any,
+	// any target) hit a non-retryable error.
+	groupSize := map[string]int{}
+	for _, target := range targets {
+		groupSize[target.Group]++
+	}
+	permanent := map[string]int{}
+	fatal := make(chan error, 1)
+
+	// Once every target has stopped retrying and at least one of them ran
+	// out of time, waiting for the budget timer is pointless.
+	deadline := start.Add(opts.Budget)
+	retrying := len(targets)
+	outOfTime := 0
+	exhausted := make(chan struct{})
+	stopRetrying := func(noTimeLeft bool) {
+		retrying--
+		if noTimeLeft {
+			outOfTime++
+		}
+		if retrying == 0 && outOfTime > 0 {
+			close(exhausted)
+		}
+	}
+
+	for _, target := range targets {
+		go func(ctx context.Context, target Target) {
+			for attempt := 1; ; attempt++ {
+				err := target.Check()
+				if err == nil {
+					log.Info("Connect success", "target", target.Name, target.Log, "attempt", attempt)
+
+					mu.Lock()
+					delete(failing, target.Name)
+					if opts.Any {
+						for _, other := range targets {
+							if other.Group == target.Group {
+								delete(failing, other.Name)
+							}
+						}
+						groupCancel[target.Group]()
+					}
+					if len(failing) == 0 {
+						availableOnce.Do(func() { close(available) })
+					}
+					stopRetrying(false)
+					mu.Unlock()
+					return
+				}
+
+				reason := "error"
+				if target.Reason != nil {
+					reason = target.Reason(err)
+				}
+				mu.Lock()
+				if _, ok := failing[target.Name]; ok {
+					failing[target.Name] = reason
+				}
+				if target.Retryable != nil && !target.Retryable(err) {
+					permanent[target.Group]++
+					if !opts.Any || permanent[target.Group] == groupSize[target.Group] {
+						select {
+						case fatal <- retry.Permanent(fmt.Errorf("[%s] %s, not retrying: %w", target.Name, reason, err)):
+						default:
+						}
+					}
+					stopRetrying(false)
+					mu.Unlock()
+					log.Error("Connection attempt failed with a non-retryable error", "target", target.Name, target.Log, "attempt", attempt, "reason", reason, "error", err)
+					return
+				}
+				mu.Unlock()
+
+				sleep := opts.Backoff.DurationFor(attempt, reason)
+				var sleepErr error
+				if remaining := deadline.Sub(clk.Now()); opts.Budget > 0 && remaining < sleep {
+					sleepErr = fmt.Errorf("%w: next attempt in %v would start after the deadline in %v", retry.ErrBudgetExhausted, sleep.Round(time.Millisecond), remaining.Round(time.Millisecond))
+				} else {
+					log.Warn("Connection attempt failed", "target", target.Name, target.Log, "attempt", attempt, "sleep", sleep.Round(time.Millisecond), "reason", reason, "error", err)
+					sleepErr = retry.Sleep(ctx, clk, sleep)
+				}
+				if errors.Is(sleepErr, retry.ErrBudgetExhausted) {
+					log.Error("Connection attempt failed, not retrying", "target", target.Name, target.Log, "attempt", attempt, "reason", reason, "error", err, "stopped", sleepErr)
+					mu.Lock()
+					stopRetrying(true)
+					mu.Unlock()
+					return
+				}
+				if sleepErr != nil {
+					return
+				}
+			}
+		}(groupCtx[target.Group], target)
+	}
+
+	var progress <-chan time.Time
+	if opts.ProgressInterval > 0 {
+		ticker := clk.NewTicker(opts.ProgressInterval)
+		defer ticker.Stop()
+		progress = ticker.C()
+	}
+
+	for {
+		select {
+		case <-available:
+			return nil
+		case err := <-fatal:
+			return err
+		case <-budget:
+			cancel()
+			// A check may still be blocked in the driver; do not wait for it.
+			mu.Lock()
+			defer mu.Unlock()
+			if len(failing) == 0 {
+				return nil
+			}
+			return fmt.Errorf("time budget of %v exhausted; still failing: %s", opts.Budget, describeFailing(failing))
+		case <-exhausted:
+			cancel()
+			mu.Lock()
+			defer mu.Unlock()
+			if len(failing) == 0 {
+				return nil
+			}
+			limit := "deadline"
+			if opts.Budget > 0 {
+				limit = fmt.Sprintf("time budget of %v", opts.Budget)
+			}
+			return fmt.Errorf("%w: no time left for another attempt within the %s; still failing: %s", retry.ErrBudgetExhausted, limit, describeFailing(failing))
+		case <-parent.Done():
+			mu.Lock()
+			defer mu.Unlock()
+			if len(failing) == 0 {
+				return nil
+			}
+			return fmt.Errorf("wait cancelled; still failing: %s", describeFailing(failing))
+		case <-progress:
+			mu.Lock()
+			summary := describeFailing(failing)
+			mu.Unlock()
+			log.Info("Still waiting", "waited", clk.Now().Sub(start).Round(time.Second), "budget", opts.Budget, "failing", summary)
+		}
+	}
+}
+
+func describeFailing(failing map[string]string) string {
+	names := make([]string, 0, len(failing))
+	for name := range failing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s (%s)", name, failing[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Unavailable inverts a check: it succeeds only when check fails. It is used
+// to wait for a database to be decommissioned.
+func Unavailable(check func() error) func() error {
+	return func() error {
+		if err := check(); err == nil {
+			return errors.New("still reachable")
+		}
+		return nil
+	}
+}
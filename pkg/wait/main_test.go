@@ -0,0 +1,239 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/clock"
+	"github.com/tapclap/db-connect-checker/pkg/retry"
+)
+
+func TestForAll(t *testing.T) {
+	fastBackoff := retry.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}
+
+	tests := []struct {
+		name          string
+		targets       func() []Target
+		budget        time.Duration
+		any           bool
+		wantErr       bool
+		wantPermanent bool
+		errContains   []string
+	}{
+		{
+			name:    "no targets succeeds immediately",
+			targets: func() []Target { return nil },
+			budget:  time.Second,
+			wantErr: false,
+		},
+		{
+			name: "all targets available",
+			targets: func() []Target {
+				return []Target{
+					{Name: "mysql db1", Check: func() error { return nil }},
+					{Name: "mysql db2", Check: func() error { return nil }},
+				}
+			},
+			budget:  time.Second,
+			wantErr: false,
+		},
+		{
+			name: "target becomes available after retries",
+			targets: func() []Target {
+				var calls int32
+				return []Target{
+					{Name: "mysql db1", Check: func() error {
+						if atomic.AddInt32(&calls, 1) < 3 {
+							return errors.New("connection refused")
+						}
+						return nil
+					}},
+				}
+			},
+			budget:  time.Second,
+			wantErr: false,
+		},
+		{
+			name: "budget exhausted reports failing targets with reason",
+			targets: func() []Target {
+				return []Target{
+					{Name: "mysql db1", Check: func() error { return nil }},
+					{
+						Name:   "mysql primary",
+						Check:  func() error { return errors.New("access denied") },
+						Reason: func(error) string { return "auth error" },
+					},
+				}
+			},
+			budget:      50 * time.Millisecond,
+			wantErr:     true,
+			errContains: []string{"mysql primary (auth error)"},
+		},
+		{
+			name: "any: one available replica satisfies the group",
+			targets: func() []Target {
+				return []Target{
+					{Name: "mysql replica1", Group: "mysql", Check: func() error { return errors.New("connection refused") }},
+					{Name: "mysql replica2", Group: "mysql", Check: func() error { return nil }},
+				}
+			},
+			budget:  time.Second,
+			any:     true,
+			wantErr: false,
+		},
+		{
+			name: "any: every group needs an available target",
+			targets: func() []Target {
+				return []Target{
+					{Name: "mysql db1", Group: "mysql", Check: func() error { return nil }},
+					{Name: "mongodb db2", Group: "mongodb", Check: func() error { return errors.New("connection refused") }},
+				}
+			},
+			budget:      50 * time.Millisecond,
+			any:         true,
+			wantErr:     true,
+			errContains: []string{"mongodb db2"},
+		},
+		{
+			name: "non-retryable error fails without waiting for the budget",
+			targets: func() []Target {
+				return []Target{
+					{Name: "mysql db1", Check: func() error { return nil }},
+					{
+						Name:      "mysql primary",
+						Check:     func() error { return errors.New("access denied") },
+						Reason:    func(error) string { return "auth error" },
+						Retryable: func(error) bool { return false },
+					},
+				}
+			},
+			budget:        time.Minute,
+			wantErr:       true,
+			wantPermanent: true,
+			errContains:   []string{"mysql primary", "auth error", "not retrying"},
+		},
+		{
+			name: "any: non-retryable replica does not fail the group",
+			targets: func() []Target {
+				var calls int32
+				return []Target{
+					{
+						Name:      "mysql replica1",
+						Group:     "mysql",
+						Check:     func() error { return errors.New("access denied") },
+						Retryable: func(error) bool { return false },
+					},
+					{Name: "mysql replica2", Group: "mysql", Check: func() error {
+						if atomic.AddInt32(&calls, 1) < 3 {
+							return errors.New("connection refused")
+						}
+						return nil
+					}},
+				}
+			},
+			budget:  time.Second,
+			any:     true,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ForAll(context.Background(), tt.targets(), Options{
+				Budget:           tt.budget,
+				ProgressInterval: 10 * time.Millisecond,
+				Backoff:          fastBackoff,
+				Any:              tt.any,
+			})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ForAll() expected error but got none")
+				}
+				for _, want := range tt.errContains {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("ForAll() error = %v, want error containing %q", err, want)
+					}
+				}
+				if retry.IsPermanent(err) != tt.wantPermanent {
+					t.Errorf("ForAll() permanent = %v, want %v", retry.IsPermanent(err), tt.wantPermanent)
+				}
+				if strings.Contains(err.Error(), "mysql db1") {
+					t.Errorf("ForAll() error = %v, should not mention available target", err)
+				}
+			} else if err != nil {
+				t.Errorf("ForAll() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestForAllFakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var calls int32
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ForAll(context.Background(), []Target{
+			{Name: "mysql db1", Check: func() error {
+				atomic.AddInt32(&calls, 1)
+				return errors.New("connection refused")
+			}},
+		}, Options{
+			Budget:  10 * time.Second,
+			Backoff: retry.Backoff{Initial: time.Second, Max: 3 * time.Second, Multiplier: 2},
+			Clock:   fake,
+		})
+	}()
+
+	// Each step waits for the next backoff sleep next to the budget timer.
+	steps := []struct {
+		sleep     time.Duration
+		remaining time.Duration
+	}{
+		{sleep: time.Second, remaining: 10 * time.Second},
+		{sleep: 2 * time.Second, remaining: 9 * time.Second},
+		{sleep: 3 * time.Second, remaining: 7 * time.Second},
+		{sleep: 3 * time.Second, remaining: 4 * time.Second},
+	}
+	for i, step := range steps {
+		fake.BlockUntil(2)
+		pending := fake.Pending()
+		if len(pending) != 2 || pending[0] != step.sleep || pending[1] != step.remaining {
+			t.Fatalf("step %d: pending timers = %v, want [%v %v]", i, pending, step.sleep, step.remaining)
+		}
+		fake.Advance(step.sleep)
+	}
+
+	// The fifth attempt fails at 9s; the next one would start after the
+	// budget, so ForAll gives up without waiting for the budget timer.
+	err := <-errc
+	if !errors.Is(err, retry.ErrBudgetExhausted) || !strings.Contains(err.Error(), "time budget of 10s; still failing: mysql db1 (error)") {
+		t.Fatalf("ForAll() error = %v, want exhausted budget", err)
+	}
+	if now := fake.Now(); now != time.Date(2024, 1, 1, 0, 0, 9, 0, time.UTC) {
+		t.Errorf("ForAll() returned at %v, want right after the attempt at 9s", now)
+	}
+	if got := atomic.LoadInt32(&calls); got != 5 {
+		t.Errorf("target checked %d times, want 5", got)
+	}
+}
+
+func TestForAllContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	err := ForAll(ctx, []Target{
+		{Name: "mysql db1", Check: func() error { return errors.New("connection refused") }},
+	}, Options{Backoff: retry.Backoff{Initial: 2 * time.Minute}})
+	if !errors.Is(err, retry.ErrBudgetExhausted) || !strings.Contains(err.Error(), "within the deadline") {
+		t.Fatalf("ForAll() error = %v, want exhausted budget", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("ForAll() returned after %v, want without sleeping", elapsed)
+	}
+}
@@ -0,0 +1,45 @@
+// Package winsvc runs the checker as a Windows service and writes check
+// results to the Windows Event Log. On other systems the process is never a
+// service and the functions report that Windows is required.
+package winsvc
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+)
+
+// Name is the service name and the Event Log source.
+const Name = "db-connect-checker"
+
+// Event IDs of check results.
+const (
+	eventSuccess = 1
+	eventFailure = 2
+)
+
+var errUnsupported = errors.New("Windows services and the Event Log are only available on Windows")
+
+// message renders entry as the text of an event: a summary line followed by
+// the fields of the entry, one per line.
+func message(entry audit.Entry) string {
+	summary := entry.Target + ": " + entry.Outcome
+	if entry.Outcome != "success" {
+		summary += " (" + entry.ErrorClass + ")"
+	}
+
+	lines := []string{
+		summary,
+		"",
+		"target: " + entry.Target,
+		"type: " + entry.Type,
+		"outcome: " + entry.Outcome,
+		"latency_seconds: " + strconv.FormatFloat(entry.LatencySeconds, 'f', -1, 64),
+	}
+	if entry.ErrorClass != "" {
+		lines = append(lines, "error_class: "+entry.ErrorClass)
+	}
+	return strings.Join(lines, "\r\n")
+}
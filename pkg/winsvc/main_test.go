@@ -0,0 +1,37 @@
+package winsvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+)
+
+func TestMessage(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		entry audit.Entry
+		want  string
+	}{
+		{
+			name:  "success",
+			entry: audit.Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Outcome: "success", LatencySeconds: 0.012},
+			want:  "mysql db:3306/app: success\r\n\r\ntarget: mysql db:3306/app\r\ntype: mysql\r\noutcome: success\r\nlatency_seconds: 0.012",
+		},
+		{
+			name:  "failure",
+			entry: audit.Entry{Time: now, Target: "mysql db:3306/app", Type: "mysql", Outcome: "failure", LatencySeconds: 5, ErrorClass: "timeout"},
+			want:  "mysql db:3306/app: failure (timeout)\r\n\r\ntarget: mysql db:3306/app\r\ntype: mysql\r\noutcome: failure\r\nlatency_seconds: 5\r\nerror_class: timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := message(tt.entry); got != tt.want {
+				t.Errorf("message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
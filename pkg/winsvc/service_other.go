@@ -0,0 +1,46 @@
+//go:build !windows
+
+package winsvc
+
+import (
+	"context"
+
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// IsService reports whether the process was started by the Windows service
+// control manager.
+func IsService() bool {
+	return false
+}
+
+// Run calls run directly, there is no service control manager to report to.
+func Run(run func(ctx context.Context) int) int {
+	return run(context.Background())
+}
+
+// Install registers the service and the Event Log source.
+func Install() error {
+	return errUnsupported
+}
+
+// Uninstall removes the service and the Event Log source.
+func Uninstall() error {
+	return errUnsupported
+}
+
+// EventLog writes check results to the Windows Event Log.
+type EventLog struct{}
+
+// OpenEventLog opens the Event Log source registered by Install.
+func OpenEventLog() (*EventLog, error) {
+	return nil, errUnsupported
+}
+
+// Observe writes one check result. It makes EventLog a checker.Sink.
+func (l *EventLog) Observe(ctx context.Context, target types.Target, result types.Result) {}
+
+// Close closes the Event Log handle.
+func (l *EventLog) Close() error {
+	return nil
+}
@@ -0,0 +1,162 @@
+//go:build windows
+
+package winsvc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/tapclap/db-connect-checker/pkg/audit"
+	"github.com/tapclap/db-connect-checker/pkg/log"
+	"github.com/tapclap/db-connect-checker/pkg/types"
+)
+
+// IsService reports whether the process was started by the Windows service
+// control manager.
+func IsService() bool {
+	service, err := svc.IsWindowsService()
+	return err == nil && service
+}
+
+// handler runs the checker under the service control manager, cancelling its
+// context on Stop and Shutdown.
+type handler struct {
+	run  func(ctx context.Context) int
+	code int
+}
+
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan int, 1)
+	go func() {
+		done <- h.run(ctx)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case h.code = <-done:
+			return h.code != 0, uint32(h.code)
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32((30 * time.Second).Milliseconds())}
+				cancel()
+				h.code = <-done
+				return h.code != 0, uint32(h.code)
+			}
+		}
+	}
+}
+
+// Run runs run as the service and returns its exit code. The exit code is
+// also reported to the service control manager as a service specific code.
+func Run(run func(ctx context.Context) int) int {
+	h := &handler{run: run}
+	if err := svc.Run(Name, h); err != nil {
+		log.Error("Error running service", "error", err)
+		return 1
+	}
+	return h.code
+}
+
+// Install registers the running executable as an automatically started
+// service and Name as an Event Log source.
+func Install() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("installing service: %v", err)
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("installing service: %v", err)
+	}
+	defer manager.Disconnect()
+
+	if service, err := manager.OpenService(Name); err == nil {
+		service.Close()
+		return fmt.Errorf("service %s already exists", Name)
+	}
+	service, err := manager.CreateService(Name, exe, mgr.Config{
+		DisplayName: "DB connect checker",
+		Description: "Checks connectivity to databases",
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return fmt.Errorf("installing service: %v", err)
+	}
+	defer service.Close()
+
+	if err := eventlog.InstallAsEventCreate(Name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		service.Delete()
+		return fmt.Errorf("installing Event Log source: %v", err)
+	}
+	return nil
+}
+
+// Uninstall removes the service and the Event Log source.
+func Uninstall() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("removing service: %v", err)
+	}
+	defer manager.Disconnect()
+
+	service, err := manager.OpenService(Name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", Name)
+	}
+	defer service.Close()
+	if err := service.Delete(); err != nil {
+		return fmt.Errorf("removing service: %v", err)
+	}
+	if err := eventlog.Remove(Name); err != nil {
+		return fmt.Errorf("removing Event Log source: %v", err)
+	}
+	return nil
+}
+
+// EventLog writes check results to the Windows Event Log: successes as
+// information events with ID 1, failures as error events with ID 2.
+type EventLog struct {
+	log *eventlog.Log
+}
+
+// OpenEventLog opens the Event Log source registered by Install.
+func OpenEventLog() (*EventLog, error) {
+	log, err := eventlog.Open(Name)
+	if err != nil {
+		return nil, fmt.Errorf("opening Event Log: %v", err)
+	}
+	return &EventLog{log: log}, nil
+}
+
+// Observe writes one check result. It makes EventLog a checker.Sink.
+func (l *EventLog) Observe(ctx context.Context, target types.Target, result types.Result) {
+	entry := audit.NewEntry(time.Now(), target, result)
+	var err error
+	if result.Success {
+		err = l.log.Info(eventSuccess, message(entry))
+	} else {
+		err = l.log.Error(eventFailure, message(entry))
+	}
+	if err != nil {
+		log.Error("Error writing Event Log", log.Target(target), "error", err)
+	}
+}
+
+// Close closes the Event Log handle.
+func (l *EventLog) Close() error {
+	return l.log.Close()
+}